@@ -2,6 +2,7 @@ package repository
 
 import (
 	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	oauthclient "github.com/fabric8-services/fabric8-auth/authentication/oauthclient/repository"
 	provider "github.com/fabric8-services/fabric8-auth/authentication/provider/repository"
 	invitation "github.com/fabric8-services/fabric8-auth/authorization/invitation/repository"
 	permission "github.com/fabric8-services/fabric8-auth/authorization/permission/repository"
@@ -16,8 +17,13 @@ type Repositories interface {
 	Identities() account.IdentityRepository
 	Users() account.UserRepository
 	OauthStates() provider.OauthStateReferenceRepository
+	DeviceCodes() provider.DeviceCodeRepository
+	OAuthClients() oauthclient.OAuthClientRepository
 	ExternalTokens() token.ExternalTokenRepository
+	SigningKeys() token.SigningKeyRepository
 	VerificationCodes() account.VerificationCodeRepository
+	UsernameHistory() account.UsernameHistoryRepository
+	ProfileAttributeDefinitions() account.ProfileAttributeDefinitionRepository
 	InvitationRepository() invitation.InvitationRepository
 	ResourceRepository() resource.ResourceRepository
 	ResourceTypeRepository() resourcetype.ResourceTypeRepository
@@ -26,6 +32,7 @@ type Repositories interface {
 	RoleRepository() role.RoleRepository
 	DefaultRoleMappingRepository() role.DefaultRoleMappingRepository
 	RoleMappingRepository() role.RoleMappingRepository
+	DenyAssignmentRepository() role.DenyAssignmentRepository
 	TokenRepository() token.TokenRepository
 	PrivilegeCacheRepository() permission.PrivilegeCacheRepository
 }
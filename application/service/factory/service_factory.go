@@ -9,8 +9,11 @@ import (
 	servicecontext "github.com/fabric8-services/fabric8-auth/application/service/context"
 	"github.com/fabric8-services/fabric8-auth/application/transaction"
 	userservice "github.com/fabric8-services/fabric8-auth/authentication/account/service"
+	transferservice "github.com/fabric8-services/fabric8-auth/authentication/account/transfer/service"
 	logoutservice "github.com/fabric8-services/fabric8-auth/authentication/logout/service"
+	oauthclientservice "github.com/fabric8-services/fabric8-auth/authentication/oauthclient/service"
 	providerservice "github.com/fabric8-services/fabric8-auth/authentication/provider/service"
+	scimservice "github.com/fabric8-services/fabric8-auth/authentication/scim/service"
 	subscriptionservice "github.com/fabric8-services/fabric8-auth/authentication/subscription/service"
 	invitationservice "github.com/fabric8-services/fabric8-auth/authorization/invitation/service"
 	organizationservice "github.com/fabric8-services/fabric8-auth/authorization/organization/service"
@@ -212,6 +215,10 @@ func (f *ServiceFactory) AuthenticationProviderService() service.AuthenticationP
 	return f.authProviderServiceFunc()
 }
 
+func (f *ServiceFactory) DeviceAuthorizationService() service.DeviceAuthorizationService {
+	return providerservice.NewDeviceAuthorizationService(f.getContext(), f.config)
+}
+
 func (f *ServiceFactory) InvitationService() service.InvitationService {
 	return invitationservice.NewInvitationService(f.getContext(), f.config)
 }
@@ -224,6 +231,10 @@ func (f *ServiceFactory) LogoutService() service.LogoutService {
 	return logoutservice.NewLogoutService(f.getContext(), f.config)
 }
 
+func (f *ServiceFactory) OAuthClientService() service.OAuthClientService {
+	return oauthclientservice.NewOAuthClientService(f.getContext(), f.config)
+}
+
 func (f *ServiceFactory) OrganizationService() service.OrganizationService {
 	return organizationservice.NewOrganizationService(f.getContext())
 }
@@ -240,14 +251,26 @@ func (f *ServiceFactory) PrivilegeCacheService() service.PrivilegeCacheService {
 	return permissionservice.NewPrivilegeCacheService(f.getContext(), f.config)
 }
 
+func (f *ServiceFactory) ProfileAttributeService() service.ProfileAttributeService {
+	return userservice.NewProfileAttributeService(f.getContext())
+}
+
 func (f *ServiceFactory) ResourceService() service.ResourceService {
 	return resourceservice.NewResourceService(f.getContext())
 }
 
+func (f *ServiceFactory) RetentionService() service.RetentionService {
+	return userservice.NewRetentionService(f.getContext())
+}
+
 func (f *ServiceFactory) RoleManagementService() service.RoleManagementService {
 	return roleservice.NewRoleManagementService(f.getContext())
 }
 
+func (f *ServiceFactory) ScimService() service.ScimService {
+	return scimservice.NewScimService(f.getContext(), f.config)
+}
+
 func (f *ServiceFactory) TeamService() service.TeamService {
 	return teamservice.NewTeamService(f.getContext())
 }
@@ -256,12 +279,20 @@ func (f *ServiceFactory) TokenService() service.TokenService {
 	return tokenservice.NewTokenService(f.getContext(), f.config)
 }
 
+func (f *ServiceFactory) SigningKeyService() service.SigningKeyService {
+	return tokenservice.NewSigningKeyService(f.getContext(), f.config)
+}
+
 func (f *ServiceFactory) SpaceService() service.SpaceService {
 	return spaceservice.NewSpaceService(f.getContext())
 }
 
 func (f *ServiceFactory) UserService() service.UserService {
-	return userservice.NewUserService(f.getContext())
+	return userservice.NewUserService(f.getContext(), f.config)
+}
+
+func (f *ServiceFactory) UserTransferService() service.UserTransferService {
+	return transferservice.NewUserTransferService(f.getContext())
 }
 
 func (f *ServiceFactory) UserProfileService() service.UserProfileService {
@@ -4,8 +4,11 @@ import (
 	"context"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/application/repository"
 	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	oauthclient "github.com/fabric8-services/fabric8-auth/authentication/oauthclient/repository"
 	"github.com/fabric8-services/fabric8-auth/authentication/provider"
+	"github.com/fabric8-services/fabric8-auth/authentication/scim"
 	"github.com/fabric8-services/fabric8-auth/authentication/subscription"
 	"github.com/fabric8-services/fabric8-auth/authorization"
 	"github.com/fabric8-services/fabric8-auth/authorization/invitation"
@@ -22,7 +25,9 @@ import (
 	"github.com/goadesign/goa"
 	"github.com/satori/go.uuid"
 	"golang.org/x/oauth2"
+	"io"
 	"net/url"
+	"time"
 )
 
 const (
@@ -49,14 +54,15 @@ type AuthenticationProviderService interface {
 	CreateOrUpdateIdentityAndUser(ctx context.Context, referrerURL *url.URL,
 		providerToken *oauth2.Token) (*string, *oauth2.Token, error)
 	UpdateIdentityUsingUserInfoEndPoint(ctx context.Context, accessToken string) (*account.Identity, error)
-	ExchangeAuthorizationCodeForUserToken(ctx context.Context, code string, clientID string, redirectURL *url.URL) (*string, *app.OauthToken, error)
+	ExchangeAuthorizationCodeForUserToken(ctx context.Context, code string, clientID string, redirectURL *url.URL, codeVerifier *string) (*string, *app.OauthToken, error)
 	ExchangeCodeWithProvider(ctx context.Context, code string, redirectURL string) (*oauth2.Token, error)
 	GenerateAuthCodeURL(ctx context.Context, redirect *string, apiClient *string,
-		state *string, scopes []string, responseMode *string, referrer string, callbackURL string) (*string, error)
+		state *string, scopes []string, responseMode *string, referrer string, callbackURL string,
+		codeChallenge *string, codeChallengeMethod *string, nonce *string, clientID *string) (*string, error)
 	LoginCallback(ctx context.Context, state string, code string, redirectURL string) (*string, error)
 	LoadReferrerAndResponseMode(ctx context.Context, state string) (string, *string, error)
 	SaveReferrer(ctx context.Context, state string, referrer string,
-		responseMode *string, validReferrerURL string) error
+		responseMode *string) error
 }
 
 type ClusterService interface {
@@ -68,6 +74,13 @@ type ClusterService interface {
 	Stop()
 }
 
+type DeviceAuthorizationService interface {
+	AuthorizeDevice(ctx context.Context, clientID string, scope *string, verificationURI string) (*app.DeviceAuthorization, error)
+	CompleteVerification(ctx context.Context, state string, code string) (bool, error)
+	ExchangeDeviceCode(ctx context.Context, deviceCode string, clientID string, redirectURL *url.URL) (*string, *app.OauthToken, error)
+	VerifyDevice(ctx context.Context, userCode string, redirect *string, referrer string, callbackURL string) (*string, error)
+}
+
 type InvitationService interface {
 	// Issue creates a new invitation for a user.
 	Issue(ctx context.Context, issuingUserID uuid.UUID, inviteTo string, invitations []invitation.Invitation) error
@@ -92,6 +105,22 @@ type NotificationService interface {
 	SendMessagesAsync(ctx context.Context, messages []notification.Message, options ...rest.HTTPClientOption) (chan error, error)
 }
 
+// OAuthClientService manages the OAuth clients, which are either the public client and the service accounts of the
+// configuration, or the clients registered by the administrators and with the RFC 7591 registration endpoint
+type OAuthClientService interface {
+	LoadClient(ctx context.Context, clientID string) (*oauthclient.OAuthClient, error)
+	LoadClientForGrantType(ctx context.Context, clientID string, grantType string) (*oauthclient.OAuthClient, error)
+	AuthenticateClient(ctx context.Context, clientID string, clientSecret *string, grantType string) (*oauthclient.OAuthClient, error)
+	ValidateRedirectURI(ctx context.Context, client *oauthclient.OAuthClient, redirectURI string) error
+	ValidateReferrer(ctx context.Context, apiClient *string, referrer string) error
+	CreateClient(ctx context.Context, byIdentityID uuid.UUID, client *oauthclient.OAuthClient, authMethod string) (*string, error)
+	RegisterClient(ctx context.Context, byIdentityID uuid.UUID, client *oauthclient.OAuthClient, authMethod string) (*string, error)
+	ListClients(ctx context.Context, byIdentityID uuid.UUID) ([]oauthclient.OAuthClient, error)
+	ShowClient(ctx context.Context, byIdentityID uuid.UUID, clientID string) (*oauthclient.OAuthClient, error)
+	UpdateClient(ctx context.Context, byIdentityID uuid.UUID, clientID string, name *string, redirectURIs []string, redirectURIMatch *string, grantTypes []string) (*oauthclient.OAuthClient, error)
+	DeleteClient(ctx context.Context, byIdentityID uuid.UUID, clientID string) error
+}
+
 type OrganizationService interface {
 	CreateOrganization(ctx context.Context, creatorIdentityID uuid.UUID, organizationName string) (*uuid.UUID, error)
 	ListOrganizations(ctx context.Context, identityID uuid.UUID) ([]authorization.IdentityAssociation, error)
@@ -104,10 +133,25 @@ type OSOSubscriptionService interface {
 type PermissionService interface {
 	HasScope(ctx context.Context, identityID uuid.UUID, resourceID string, scopeName string) (bool, error)
 	RequireScope(ctx context.Context, identityID uuid.UUID, resourceID string, scopeName string) error
+	RequireSystemScope(ctx context.Context, identityID uuid.UUID, scopeName string) error
+	HasScopes(ctx context.Context, identityID uuid.UUID, checks []authorization.ResourceScope) ([]bool, error)
+	ExplainScope(ctx context.Context, byIdentityID uuid.UUID, identityID uuid.UUID, resourceID string, scopeName string) (*authorization.ScopeExplanation, error)
 }
 
 type PrivilegeCacheService interface {
 	CachedPrivileges(ctx context.Context, identityID uuid.UUID, resourceID string) (*permission.PrivilegeCache, error)
+	CachedPrivilegesForResources(ctx context.Context, identityID uuid.UUID, resourceIDs []string) (map[string]*permission.PrivilegeCache, error)
+}
+
+// ProfileAttributeService manages the definitions of the custom profile attributes, and validates and stores their
+// values in the profile of the users
+type ProfileAttributeService interface {
+	ListDefinitions(ctx context.Context) ([]account.ProfileAttributeDefinition, error)
+	CreateDefinition(ctx context.Context, byIdentityID uuid.UUID, definition *account.ProfileAttributeDefinition) error
+	UpdateDefinition(ctx context.Context, byIdentityID uuid.UUID, name string, description *string, pattern *string, visibility *string, editableByUser *bool) (*account.ProfileAttributeDefinition, error)
+	DeleteDefinition(ctx context.Context, byIdentityID uuid.UUID, name string) error
+	UpdateAttributes(ctx context.Context, byIdentityID uuid.UUID, identityID uuid.UUID, values map[string]interface{}) (*account.Identity, error)
+	SetAttributes(ctx context.Context, repositories repository.Repositories, byIdentityID uuid.UUID, identityID uuid.UUID, user *account.User, values map[string]interface{}) error
 }
 
 type ResourceService interface {
@@ -118,13 +162,50 @@ type ResourceService interface {
 	FindWithRoleByResourceTypeAndIdentity(ctx context.Context, resourceType string, identityID uuid.UUID) ([]string, error)
 }
 
+// RetentionService purges the data which is kept beyond its retention period: the deleted and deprovisioned users,
+// the orphaned external tokens, the stale verification codes, the expired OAuth state references and the expired
+// privilege caches. Each method returns the number of purged entities.
+type RetentionService interface {
+	PurgeUsers(ctx context.Context, deletedBefore, deprovisionedBefore time.Time, limit int) (int, error)
+	PurgeExternalTokens(ctx context.Context, deletedBefore time.Time) (int, error)
+	PurgeVerificationCodes(ctx context.Context, createdBefore time.Time) (int, error)
+	PurgeOAuthStates(ctx context.Context, createdBefore time.Time) (int, error)
+	PurgePrivilegeCaches(ctx context.Context, expiredBefore time.Time) (int, error)
+}
+
 type RoleManagementService interface {
 	ListByResource(ctx context.Context, currentIdentity uuid.UUID, resourceID string) ([]rolerepo.IdentityRole, error)
+	ListPrincipalsByScope(ctx context.Context, currentIdentity uuid.UUID, resourceID string, scopeName string) ([]authorization.EffectivePrincipal, error)
 	ListAvailableRolesByResourceType(ctx context.Context, resourceType string) ([]role.RoleDescriptor, error)
 	ListByResourceAndRoleName(ctx context.Context, currentIdentity uuid.UUID, resourceID string, roleName string) ([]rolerepo.IdentityRole, error)
-	Assign(ctx context.Context, assignedBy uuid.UUID, roleAssignments map[string][]uuid.UUID, resourceID string, appendToExistingRoles bool) error
+	Assign(ctx context.Context, assignedBy uuid.UUID, roleAssignments map[string][]uuid.UUID, resourceID string, appendToExistingRoles bool, validity role.Validity) error
 	ForceAssign(ctx context.Context, assignedTo uuid.UUID, roleName string, res resource.Resource) error
 	RevokeResourceRoles(ctx context.Context, currentIdentity uuid.UUID, identities []uuid.UUID, resourceID string) error
+	ListDenials(ctx context.Context, currentIdentity uuid.UUID, resourceID string) ([]rolerepo.DenyAssignment, error)
+	Deny(ctx context.Context, deniedBy uuid.UUID, denials map[string][]uuid.UUID, resourceID string) error
+	RevokeDenial(ctx context.Context, currentIdentity uuid.UUID, resourceID string, denyAssignmentID uuid.UUID) error
+	ListExpiredRoles(ctx context.Context, limit int) ([]rolerepo.IdentityRole, error)
+	RevokeExpiredRole(ctx context.Context, identityRole rolerepo.IdentityRole) error
+}
+
+// ScimService provisions and deprovisions the users and the members of the teams and organizations from an external
+// identity provider, as defined by SCIM 2.0
+type ScimService interface {
+	ListUsers(ctx context.Context, filter *scim.Filter, startIndex int, count int) ([]account.Identity, int, error)
+	LoadUser(ctx context.Context, id uuid.UUID) (*account.Identity, error)
+	CreateUser(ctx context.Context, user scim.User) (*account.Identity, error)
+	ReplaceUser(ctx context.Context, id uuid.UUID, ifMatch *string, user scim.User) (*account.Identity, bool, error)
+	PatchUser(ctx context.Context, id uuid.UUID, ifMatch *string, operations []scim.PatchOperation) (*account.Identity, bool, error)
+	DeleteUser(ctx context.Context, id uuid.UUID, ifMatch *string) error
+	ListGroups(ctx context.Context, filter *scim.Filter, startIndex int, count int) ([]scim.Group, int, error)
+	LoadGroup(ctx context.Context, id uuid.UUID) (*scim.Group, error)
+	PatchGroup(ctx context.Context, id uuid.UUID, ifMatch *string, operations []scim.PatchOperation) (*scim.Group, error)
+}
+
+// SigningKeyService manages the rotation of the keys used to sign tokens
+type SigningKeyService interface {
+	RotateKeys(ctx context.Context) error
+	LoadKeys(ctx context.Context) error
 }
 
 type SpaceService interface {
@@ -142,8 +223,11 @@ type TokenService interface {
 	Audit(ctx context.Context, identity *account.Identity, tokenString string, resourceID string) (*string, error)
 	DeleteExternalToken(ctx context.Context, currentIdentity uuid.UUID, authURL string, forResource string) error
 	ExchangeRefreshToken(ctx context.Context, refreshToken string, rptToken string) (*manager.TokenSet, error)
+	ExchangeToken(ctx context.Context, actorID string, subjectToken string, audience string, resourceID *string, scopes []string) (*manager.TokenSet, error)
+	Introspect(ctx context.Context, tokenString string) (*app.TokenIntrospection, error)
 	RegisterToken(ctx context.Context, identityID uuid.UUID, tokenString string, tokenType string, privileges []tokenrepo.TokenPrivilege) (*tokenrepo.Token, error)
 	RetrieveExternalToken(ctx context.Context, forResource string, req *goa.RequestData, forcePull *bool) (*app.ExternalToken, *string, error)
+	RevokeToken(ctx context.Context, tokenString string) error
 	SetStatusForAllIdentityTokens(ctx context.Context, accessToken *jwt.Token, status int) error
 }
 
@@ -158,8 +242,21 @@ type UserService interface {
 	LoadContextIdentityIfNotDeprovisioned(ctx context.Context) (*account.Identity, error)
 	ContextIdentityIfExists(ctx context.Context) (uuid.UUID, error)
 	IdentityByUsernameAndEmail(ctx context.Context, username, email string) (*account.Identity, error)
+	ClaimUsername(ctx context.Context, repositories repository.Repositories, identity *account.Identity, username string) error
 	ResetDeprovision(ctx context.Context, user account.User) error
 	HardDeleteUser(ctx context.Context, identity account.Identity) error
+	ExportPersonalData(ctx context.Context, identityID uuid.UUID) (*app.UserDataExport, error)
+	MergeUsers(ctx context.Context, sourceIdentityID, targetIdentityID uuid.UUID) (*account.Identity, error)
+	RequestDeletion(ctx context.Context) (*account.Identity, error)
+	CancelDeletion(ctx context.Context) (*account.Identity, error)
+	ListUsersDueForDeletion(ctx context.Context, limit int) ([]account.Identity, error)
+}
+
+// UserTransferService exports the users, with their identities, memberships and roles, and the resources as JSON Lines,
+// and imports them idempotently, in order to move the users between environments
+type UserTransferService interface {
+	Export(ctx context.Context, w io.Writer) (int, error)
+	Import(ctx context.Context, r io.Reader) (int, error)
 }
 
 type WITService interface {
@@ -172,21 +269,28 @@ type WITService interface {
 type Services interface {
 	AuthenticationProviderService() AuthenticationProviderService
 	ClusterService() ClusterService
+	DeviceAuthorizationService() DeviceAuthorizationService
 	InvitationService() InvitationService
 	LinkService() LinkService
 	LogoutService() LogoutService
 	NotificationService() NotificationService
+	OAuthClientService() OAuthClientService
 	OrganizationService() OrganizationService
 	OSOSubscriptionService() OSOSubscriptionService
 	PermissionService() PermissionService
 	PrivilegeCacheService() PrivilegeCacheService
+	ProfileAttributeService() ProfileAttributeService
 	ResourceService() ResourceService
+	RetentionService() RetentionService
 	RoleManagementService() RoleManagementService
+	ScimService() ScimService
+	SigningKeyService() SigningKeyService
 	SpaceService() SpaceService
 	TeamService() TeamService
 	TokenService() TokenService
 	UserProfileService() UserProfileService
 	UserService() UserService
+	UserTransferService() UserTransferService
 	WITService() WITService
 }
 
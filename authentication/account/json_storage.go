@@ -33,6 +33,63 @@ func (j *ContextInformation) Scan(src interface{}) error {
 	return fromBytes(src, j)
 }
 
+const (
+	// ProfileAttributeVisibilityPublic the visibility of the profile attributes returned to everyone
+	ProfileAttributeVisibilityPublic = "public"
+	// ProfileAttributeVisibilityPrivate the visibility of the profile attributes only returned to the user and to the service accounts
+	ProfileAttributeVisibilityPrivate = "private"
+	// ProfileAttributeVisibilityService the visibility of the profile attributes only returned to the service accounts
+	ProfileAttributeVisibilityService = "service"
+)
+
+// ProfileAttribute is the value of a custom profile attribute of a user. The visibility of the attribute definition
+// is kept along with the value, so that the attributes can be filtered without loading their definitions.
+type ProfileAttribute struct {
+	Value      interface{} `json:"value"`
+	Visibility string      `json:"visibility"`
+}
+
+// ProfileAttributes are the custom profile attributes of a user, by name
+type ProfileAttributes map[string]ProfileAttribute
+
+// Ensure ProfileAttributes implements the Equaler interface
+var _ convert.Equaler = ProfileAttributes{}
+var _ convert.Equaler = (*ProfileAttributes)(nil)
+
+// Equal returns true if two ProfileAttributes objects are equal; otherwise false is returned.
+func (a ProfileAttributes) Equal(u convert.Equaler) bool {
+	other, ok := u.(ProfileAttributes)
+	if !ok {
+		return false
+	}
+	return reflect.DeepEqual(a, other)
+}
+
+// Visible returns the values of the attributes with one of the given visibilities
+func (a ProfileAttributes) Visible(visibilities ...string) map[string]interface{} {
+	result := make(map[string]interface{})
+	for name, attribute := range a {
+		for _, visibility := range visibilities {
+			if attribute.Visibility == visibility {
+				result[name] = attribute.Value
+				break
+			}
+		}
+	}
+	return result
+}
+
+func (a ProfileAttributes) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return toBytes(a)
+}
+
+func (a *ProfileAttributes) Scan(src interface{}) error {
+	return fromBytes(src, a)
+}
+
 func toBytes(j interface{}) (driver.Value, error) {
 	if j == nil {
 		// log.Trace("returning null")
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -127,13 +128,16 @@ type IdentityRepository interface {
 	Delete(ctx context.Context, id uuid.UUID, funcs ...func(*gorm.DB) *gorm.DB) error
 	DeleteForResource(ctx context.Context, resourceID string) error
 	Query(funcs ...func(*gorm.DB) *gorm.DB) ([]Identity, error)
+	Count(ctx context.Context, funcs ...func(*gorm.DB) *gorm.DB) (int, error)
 	List(ctx context.Context) ([]Identity, error)
 	IsValid(context.Context, uuid.UUID) bool
-	Search(ctx context.Context, q string, start int, limit int) ([]Identity, int, error)
+	Search(ctx context.Context, q string, start int, limit int, funcs ...func(*gorm.DB) *gorm.DB) ([]Identity, int, error)
 	FindIdentityMemberships(ctx context.Context, identityID uuid.UUID, resourceType *string) ([]authorization.IdentityAssociation, error)
 	FindIdentitiesByResourceTypeWithParentResource(ctx context.Context, resourceTypeID uuid.UUID, parentResourceID string) ([]Identity, error)
 	AddMember(ctx context.Context, identityID uuid.UUID, memberID uuid.UUID) error
 	RemoveMember(ctx context.Context, memberOf uuid.UUID, memberID uuid.UUID) error
+	RemoveMemberships(ctx context.Context, memberID uuid.UUID) error
+	FindMemberships(ctx context.Context, memberID uuid.UUID) ([]Membership, error)
 	FlagPrivilegeCacheStaleForMembershipChange(ctx context.Context, memberID uuid.UUID, memberOf uuid.UUID) error
 }
 
@@ -304,6 +308,17 @@ func (m *GormIdentityRepository) Query(funcs ...func(*gorm.DB) *gorm.DB) ([]Iden
 	return identities, nil
 }
 
+// Count returns the number of Identities that match the given criteria
+func (m *GormIdentityRepository) Count(ctx context.Context, funcs ...func(*gorm.DB) *gorm.DB) (int, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "identity", "count"}, time.Now())
+	var count int
+	err := m.db.Model(&Identity{}).Scopes(funcs...).Count(&count).Error
+	if err != nil {
+		return 0, errs.WithStack(err)
+	}
+	return count, nil
+}
+
 // First returns the first Identity element that matches the given criteria
 func (m *GormIdentityRepository) First(funcs ...func(*gorm.DB) *gorm.DB) (*Identity, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "identity", "first"}, time.Now())
@@ -361,6 +376,51 @@ func IdentityWithUser() func(db *gorm.DB) *gorm.DB {
 	}
 }
 
+// IdentityFilterHasUser is a gorm filter of the identities which are linked to a user
+func IdentityFilterHasUser() func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id IS NOT NULL")
+	}
+}
+
+// IdentityFilterByUserEmail is a gorm filter by the email of the user
+func IdentityFilterByUserEmail(email string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id IN (SELECT id FROM users WHERE email = ? AND deleted_at IS NULL)", email)
+	}
+}
+
+// IdentityFilterByResourceTypes is a gorm filter of the identities whose resource is of one of the given types, such
+// as the teams or the organizations
+func IdentityFilterByResourceTypes(resourceTypes ...string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`identity_resource_id IN (SELECT r.resource_id FROM resource r
+			JOIN resource_type rt ON rt.resource_type_id = r.resource_type_id
+			WHERE rt.name IN (?) AND r.deleted_at IS NULL)`, resourceTypes)
+	}
+}
+
+// IdentityFilterByResourceName is a gorm filter by the name of the resource of the identity
+func IdentityFilterByResourceName(name string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("identity_resource_id IN (SELECT resource_id FROM resource WHERE name = ? AND deleted_at IS NULL)", name)
+	}
+}
+
+// IdentityFilterByMemberOf is a gorm filter of the direct members of the given identity
+func IdentityFilterByMemberOf(memberOf uuid.UUID) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("id IN (SELECT member_id FROM membership WHERE member_of = ?)", memberOf)
+	}
+}
+
+// IdentityWithResource is a gorm filter for preloading the IdentityResource relationship.
+func IdentityWithResource() func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Preload("IdentityResource")
+	}
+}
+
 // IdentityFilterByProviderType is a gorm filter by 'provider_type'
 func IdentityFilterByProviderType(providerType string) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
@@ -394,85 +454,106 @@ func (m *GormIdentityRepository) IsValid(ctx context.Context, id uuid.UUID) bool
 	return true
 }
 
-// Search searches for Identities where FullName like %q% or users.email like %q% (but ignores private emails)
-// or users.username like %q%
-func (m *GormIdentityRepository) Search(ctx context.Context, q string, start int, limit int) ([]Identity, int, error) {
-	paramVal := strings.ToLower(q) + "%"
-	db := m.db
-
-	queryStr := `SELECT count(*) OVER () as cnt2, identity_id, username, users.* FROM (SELECT 
-  identities.id AS identity_id,
-  identities.username,  
-  users.*
-FROM 
-  identities, users
-WHERE 
-  identities.user_id = users.id 
-  AND identities.username LIKE ?
-  AND identities.deleted_at IS NULL
-  AND users.deprovisioned IS false
-  AND users.deleted_at IS NULL
-UNION SELECT
-  identities.id AS identity_id,
-  identities.username,
-  users.*
-FROM
-  identities, users
-WHERE  
-  identities.user_id = users.id 
-  AND identities.deleted_at IS NULL
-  AND users.deleted_at IS NULL
-  AND users.deprovisioned IS false 
-  AND (LOWER(users.full_name) LIKE ?
-  OR (LOWER(users.email) LIKE ? AND users.email_private is false))) users LIMIT ?`
+// searchTermPattern matches the search queries which are only made of letters, digits, whitespaces and the separators
+// of the usernames and emails. Only these queries are matched by similarity, as pg_trgm ignores the other characters
+var searchTermPattern = regexp.MustCompile(`^[\w\s.@-]+$`)
 
-	rows, err := db.Raw(queryStr, paramVal, paramVal, paramVal, strconv.Itoa(limit)).Rows()
+// likeEscaper escapes the wildcards of the LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
 
-	if err != nil {
-		return nil, 0, err
+// IdentitySearchFilterByCompany is a gorm filter of the Search by the (case insensitive) company of the users
+func IdentitySearchFilterByCompany(company string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("LOWER(users.company) = LOWER(?)", company)
 	}
-	defer rows.Close()
+}
 
-	result := []Identity{}
-	value := Identity{}
-	columns, err := rows.Columns()
-	if err != nil {
-		return nil, 0, errors.NewInternalError(ctx, err)
+// IdentitySearchFilterByCluster is a gorm filter of the Search by the cluster of the users
+func IdentitySearchFilterByCluster(cluster string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("users.cluster = ?", cluster)
 	}
+}
 
-	// need to set up a result for Scan() in order to extract total count.
-	var count int
-	var identityID string
-	var identityUsername string
-	var ignore interface{}
-	columnValues := make([]interface{}, len(columns))
+// Search searches for the Identities of the (non deprovisioned) users whose username, full name or public email starts
+// with q, or contains a word similar to q (using the word similarity of pg_trgm, so that the search tolerates typos).
+// The Identities are sorted by relevance: the prefix matches first, then by decreasing similarity. The optional
+// funcs filter the identities, which are joined with their users.
+// Returns the Identities of the given page along with the total count of matching Identities.
+func (m *GormIdentityRepository) Search(ctx context.Context, q string, start int, limit int, funcs ...func(*gorm.DB) *gorm.DB) ([]Identity, int, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "identity", "search"}, time.Now())
+
+	term := strings.ToLower(q)
+	prefix := likeEscaper.Replace(term) + "%"
+	similar := searchTermPattern.MatchString(term)
 
-	for index := range columnValues {
-		columnValues[index] = &ignore
+	db := m.db.Table(m.TableName()).
+		Joins("JOIN users ON users.id = identities.user_id").
+		Where("identities.deleted_at IS NULL AND users.deleted_at IS NULL AND users.deprovisioned IS false").
+		Where(`identities.username LIKE ?
+			OR LOWER(users.full_name) LIKE ?
+			OR (users.email_private IS false AND LOWER(users.email) LIKE ?)
+			OR (? AND (? <% identities.username
+				OR ? <% LOWER(users.full_name)
+				OR (users.email_private IS false AND ? <% LOWER(users.email))))`,
+			prefix, prefix, prefix, similar, term, term, term)
+	for _, f := range funcs {
+		db = f(db)
 	}
-	columnValues[0] = &count
-	// FIXME When our User Profile endpoints start giving "user" response
-	// instead of "identity" response, the identity.ID would be less relevant.
 
-	for rows.Next() {
-		columnValues[1] = &identityID
-		columnValues[2] = &identityUsername
-		db.ScanRows(rows, &value.User)
+	var count int
+	err := db.Count(&count).Error
+	if err != nil {
+		return nil, 0, errors.NewInternalError(ctx, err)
+	}
+	if count == 0 {
+		return []Identity{}, 0, nil
+	}
+
+	// the identity ID is the last sort key, so that the pages are stable
+	var ids []struct {
+		ID uuid.UUID
+	}
+	err = db.Select(`identities.id,
+			CASE WHEN identities.username LIKE ?
+				OR LOWER(users.full_name) LIKE ?
+				OR (users.email_private IS false AND LOWER(users.email) LIKE ?) THEN 1 ELSE 0 END AS prefix_rank,
+			GREATEST(word_similarity(?, identities.username),
+				word_similarity(?, LOWER(users.full_name)),
+				CASE WHEN users.email_private IS false THEN word_similarity(?, LOWER(users.email)) ELSE 0 END) AS similarity_rank`,
+		prefix, prefix, prefix, term, term, term).
+		Order("prefix_rank DESC, similarity_rank DESC, identities.username, identities.id").
+		Offset(start).
+		Limit(limit).
+		Scan(&ids).Error
+	if err != nil {
+		return nil, 0, errors.NewInternalError(ctx, err)
+	}
+	if len(ids) == 0 {
+		return []Identity{}, count, nil
+	}
 
-		if err = rows.Scan(columnValues...); err != nil {
-			return nil, 0, errors.NewInternalError(ctx, err)
-		}
+	identityIDs := make([]uuid.UUID, len(ids))
+	for i, id := range ids {
+		identityIDs[i] = id.ID
+	}
+	var rows []Identity
+	err = m.db.Preload("User").Where("id IN (?)", identityIDs).Find(&rows).Error
+	if err != nil {
+		return nil, 0, errors.NewInternalError(ctx, err)
+	}
 
-		value.ID, err = uuid.FromString(identityID)
-		if err != nil {
-			return nil, 0, errors.NewInternalError(ctx, err)
+	// restore the order of the search
+	identities := make(map[uuid.UUID]Identity, len(rows))
+	for _, identity := range rows {
+		identities[identity.ID] = identity
+	}
+	result := make([]Identity, 0, len(rows))
+	for _, id := range identityIDs {
+		if identity, found := identities[id]; found {
+			result = append(result, identity)
 		}
-
-		value.Username = identityUsername
-
-		result = append(result, value)
 	}
-
 	return result, count, nil
 }
 
@@ -594,6 +675,34 @@ func (m *GormIdentityRepository) AddMember(ctx context.Context, identityID uuid.
 	return nil
 }
 
+// FindMemberships returns the direct memberships of the given member
+func (m *GormIdentityRepository) FindMemberships(ctx context.Context, memberID uuid.UUID) ([]Membership, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "identity", "FindMemberships"}, time.Now())
+
+	var memberships []Membership
+	err := m.db.Where("member_id = ?", memberID).Find(&memberships).Error
+	if err != nil {
+		return nil, errs.WithStack(err)
+	}
+	return memberships, nil
+}
+
+// RemoveMemberships removes all the memberships of the given member, without flagging the privilege caches as stale
+// since it is meant to be used when the member itself is deleted
+func (m *GormIdentityRepository) RemoveMemberships(ctx context.Context, memberID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "identity", "RemoveMemberships"}, time.Now())
+
+	err := m.db.Exec("DELETE FROM membership WHERE member_id = ?", memberID).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"member_id": memberID,
+			"err":       err,
+		}, "unable to remove the memberships")
+		return errs.WithStack(err)
+	}
+	return nil
+}
+
 // RemoveMember removes an existing membership with the specified memberOf and memberID values
 func (m *GormIdentityRepository) RemoveMember(ctx context.Context, memberOf uuid.UUID, memberID uuid.UUID) error {
 	defer goa.MeasureSince([]string{"goa", "db", "identity", "RemoveMember"}, time.Now())
@@ -1,8 +1,10 @@
 package repository_test
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/fabric8-services/fabric8-auth/authentication/account/repository"
 	"github.com/fabric8-services/fabric8-auth/authorization"
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
@@ -380,3 +382,82 @@ func (s *IdentityRepositoryTestSuite) TestRemoveMember() {
 	require.NoError(s.T(), err)
 	require.Len(s.T(), memberships, 0)
 }
+
+func (s *IdentityRepositoryTestSuite) TestSearch() {
+	// given a word which is only used by the users of this test
+	g := s.NewTestGraph(s.T())
+	word := "quibbleford" + strings.Replace(uuid.NewV4().String(), "-", "", -1)[:8]
+	prefixMatch := g.CreateUser(word + " Alpha")
+	wordMatch := g.CreateUser("Beta " + word)
+	typoMatch := g.CreateUser("Gamma " + word[:len(word)-1] + "z")
+	g.CreateUser("Delta Unrelated")
+	deprovisioned := g.CreateUser("Epsilon " + word)
+	deprovisioned.User().Deprovisioned = true
+	err := s.Application.Users().Save(s.Ctx, deprovisioned.User())
+	require.NoError(s.T(), err)
+
+	s.T().Run("sorted by relevance", func(t *testing.T) {
+		// when
+		result, count, err := s.Application.Identities().Search(s.Ctx, strings.ToUpper(word), 0, 10)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+		require.Len(t, result, 3)
+		assert.Equal(t, prefixMatch.IdentityID(), result[0].ID)
+		assert.Equal(t, wordMatch.IdentityID(), result[1].ID)
+		assert.Equal(t, typoMatch.IdentityID(), result[2].ID)
+		assert.Equal(t, prefixMatch.User().FullName, result[0].User.FullName)
+	})
+
+	s.T().Run("paged", func(t *testing.T) {
+		// when
+		result, count, err := s.Application.Identities().Search(s.Ctx, word, 1, 1)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+		require.Len(t, result, 1)
+		assert.Equal(t, wordMatch.IdentityID(), result[0].ID)
+
+		// when the offset exceeds the count
+		result, count, err = s.Application.Identities().Search(s.Ctx, word, 5, 1)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+		assert.Empty(t, result)
+	})
+
+	s.T().Run("filtered by company", func(t *testing.T) {
+		// given
+		wordMatch.User().Company = "Acme " + word
+		err := s.Application.Users().Save(s.Ctx, wordMatch.User())
+		require.NoError(t, err)
+		// when
+		result, count, err := s.Application.Identities().Search(s.Ctx, word, 0, 10,
+			repository.IdentitySearchFilterByCompany(strings.ToUpper("Acme "+word)))
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		require.Len(t, result, 1)
+		assert.Equal(t, wordMatch.IdentityID(), result[0].ID)
+	})
+
+	s.T().Run("filtered by cluster", func(t *testing.T) {
+		// when
+		result, count, err := s.Application.Identities().Search(s.Ctx, word, 0, 10,
+			repository.IdentitySearchFilterByCluster(typoMatch.User().Cluster))
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		require.Len(t, result, 1)
+		assert.Equal(t, typoMatch.IdentityID(), result[0].ID)
+	})
+
+	s.T().Run("wildcards are not expanded", func(t *testing.T) {
+		// when
+		result, count, err := s.Application.Identities().Search(s.Ctx, "%"+word[4:], 0, 10)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 0, count)
+		assert.Empty(t, result)
+	})
+}
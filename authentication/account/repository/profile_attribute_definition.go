@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	profileAttributeDefinitionTableName = "profile_attribute_definitions"
+
+	// ProfileAttributeTypeString the type of the profile attributes whose values are strings
+	ProfileAttributeTypeString = "string"
+	// ProfileAttributeTypeNumber the type of the profile attributes whose values are numbers
+	ProfileAttributeTypeNumber = "number"
+	// ProfileAttributeTypeBoolean the type of the profile attributes whose values are booleans
+	ProfileAttributeTypeBoolean = "boolean"
+	// ProfileAttributeTypeURL the type of the profile attributes whose values are absolute http(s) URLs
+	ProfileAttributeTypeURL = "url"
+)
+
+// ProfileAttributeDefinition defines a custom profile attribute of the users
+type ProfileAttributeDefinition struct {
+	gormsupport.Lifecycle
+	ProfileAttributeDefinitionID uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key;column:profile_attribute_definition_id"`
+	// The name of the attribute, used as the key of its value in the profile of the users
+	Name        string
+	Description string
+	// The type of the values of the attribute
+	Type string
+	// The regular expression which the values of the string and url attributes must match, if any
+	Pattern string
+	// Who the values of the attribute are returned to: everyone, the user and the service accounts, or only the service accounts
+	Visibility string
+	// Whether the users can set the value of the attribute in their own profile, otherwise only the administrators can
+	EditableByUser bool `gorm:"column:editable_by_user"`
+}
+
+// TableName implements gorm.tabler
+func (d ProfileAttributeDefinition) TableName() string {
+	return profileAttributeDefinitionTableName
+}
+
+// ProfileAttributeDefinitionRepository encapsulate storage & retrieval of the definitions of the custom profile attributes
+type ProfileAttributeDefinitionRepository interface {
+	Create(ctx context.Context, definition *ProfileAttributeDefinition) error
+	LoadByName(ctx context.Context, name string) (*ProfileAttributeDefinition, error)
+	List(ctx context.Context) ([]ProfileAttributeDefinition, error)
+	Save(ctx context.Context, definition *ProfileAttributeDefinition) error
+	Delete(ctx context.Context, ID uuid.UUID) error
+}
+
+// NewProfileAttributeDefinitionRepository creates a new profile attribute definition repo
+func NewProfileAttributeDefinitionRepository(db *gorm.DB) *GormProfileAttributeDefinitionRepository {
+	return &GormProfileAttributeDefinitionRepository{db}
+}
+
+// GormProfileAttributeDefinitionRepository implements ProfileAttributeDefinitionRepository using gorm
+type GormProfileAttributeDefinitionRepository struct {
+	db *gorm.DB
+}
+
+// Create creates a new profile attribute definition in the DB
+// returns InternalError
+func (r *GormProfileAttributeDefinitionRepository) Create(ctx context.Context, definition *ProfileAttributeDefinition) error {
+	defer goa.MeasureSince([]string{"goa", "db", "profile_attribute_definitions", "create"}, time.Now())
+	if definition.ProfileAttributeDefinitionID == uuid.Nil {
+		definition.ProfileAttributeDefinitionID = uuid.NewV4()
+	}
+
+	tx := r.db.Create(definition)
+	if err := tx.Error; err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"profile_attribute_definition_id": definition.ProfileAttributeDefinitionID,
+		"name":                            definition.Name,
+	}, "Profile attribute definition created")
+	return nil
+}
+
+// LoadByName returns the definition of the profile attribute with the given name
+// returns NotFoundError or InternalError
+func (r *GormProfileAttributeDefinitionRepository) LoadByName(ctx context.Context, name string) (*ProfileAttributeDefinition, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "profile_attribute_definitions", "load"}, time.Now())
+	definition := ProfileAttributeDefinition{}
+	tx := r.db.Where("name = ?", name).First(&definition)
+	if tx.RecordNotFound() {
+		return nil, errors.NewNotFoundError("profile attribute", name)
+	}
+	if err := tx.Error; err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	return &definition, nil
+}
+
+// List returns all the profile attribute definitions, ordered by name
+func (r *GormProfileAttributeDefinitionRepository) List(ctx context.Context) ([]ProfileAttributeDefinition, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "profile_attribute_definitions", "list"}, time.Now())
+	var definitions []ProfileAttributeDefinition
+	err := r.db.Order("name").Find(&definitions).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return definitions, nil
+}
+
+// Save updates the given profile attribute definition in the DB
+// returns NotFoundError or InternalError
+func (r *GormProfileAttributeDefinitionRepository) Save(ctx context.Context, definition *ProfileAttributeDefinition) error {
+	defer goa.MeasureSince([]string{"goa", "db", "profile_attribute_definitions", "save"}, time.Now())
+	// the fields are updated with a map so that they can be emptied or set to false
+	tx := r.db.Model(definition).Updates(map[string]interface{}{
+		"description":      definition.Description,
+		"pattern":          definition.Pattern,
+		"visibility":       definition.Visibility,
+		"editable_by_user": definition.EditableByUser,
+	})
+	if err := tx.Error; err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	if tx.RowsAffected == 0 {
+		return errors.NewNotFoundError("profile attribute", definition.Name)
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"profile_attribute_definition_id": definition.ProfileAttributeDefinitionID,
+		"name":                            definition.Name,
+	}, "Profile attribute definition updated")
+	return nil
+}
+
+// Delete deletes the profile attribute definition with the given ID
+// returns NotFoundError or InternalError
+func (r *GormProfileAttributeDefinitionRepository) Delete(ctx context.Context, ID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "profile_attribute_definitions", "delete"}, time.Now())
+	if ID == uuid.Nil {
+		return errors.NewNotFoundError("profile attribute", ID.String())
+	}
+	tx := r.db.Delete(ProfileAttributeDefinition{ProfileAttributeDefinitionID: ID})
+	if err := tx.Error; err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	if tx.RowsAffected == 0 {
+		return errors.NewNotFoundError("profile attribute", ID.String())
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"profile_attribute_definition_id": ID,
+	}, "Profile attribute definition deleted")
+	return nil
+}
@@ -0,0 +1,106 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/authentication/account"
+	"github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/test"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type profileAttributeDefinitionBlackboxTest struct {
+	gormtestsupport.DBTestSuite
+	repo repository.ProfileAttributeDefinitionRepository
+}
+
+func TestRunProfileAttributeDefinitionBlackboxTest(t *testing.T) {
+	suite.Run(t, &profileAttributeDefinitionBlackboxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *profileAttributeDefinitionBlackboxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.repo = repository.NewProfileAttributeDefinitionRepository(s.DB)
+}
+
+func (s *profileAttributeDefinitionBlackboxTest) create(attributeType string) *repository.ProfileAttributeDefinition {
+	definition := &repository.ProfileAttributeDefinition{
+		Name:       "attr_" + uuid.NewV4().String()[:8],
+		Type:       attributeType,
+		Visibility: account.ProfileAttributeVisibilityPublic,
+	}
+	require.NoError(s.T(), s.repo.Create(s.Ctx, definition))
+	return definition
+}
+
+func (s *profileAttributeDefinitionBlackboxTest) TestCreateAndLoad() {
+	// given
+	definition := s.create(repository.ProfileAttributeTypeString)
+	// when
+	loaded, err := s.repo.LoadByName(s.Ctx, definition.Name)
+	// then
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), definition.ProfileAttributeDefinitionID, loaded.ProfileAttributeDefinitionID)
+	assert.Equal(s.T(), repository.ProfileAttributeTypeString, loaded.Type)
+	assert.Equal(s.T(), account.ProfileAttributeVisibilityPublic, loaded.Visibility)
+	assert.False(s.T(), loaded.EditableByUser)
+}
+
+func (s *profileAttributeDefinitionBlackboxTest) TestList() {
+	// given
+	first := s.create(repository.ProfileAttributeTypeString)
+	second := s.create(repository.ProfileAttributeTypeNumber)
+	// when
+	definitions, err := s.repo.List(s.Ctx)
+	// then
+	require.NoError(s.T(), err)
+	names := []string{}
+	for _, definition := range definitions {
+		names = append(names, definition.Name)
+	}
+	assert.Contains(s.T(), names, first.Name)
+	assert.Contains(s.T(), names, second.Name)
+}
+
+func (s *profileAttributeDefinitionBlackboxTest) TestSave() {
+	// given
+	definition := s.create(repository.ProfileAttributeTypeString)
+	definition.Description = "updated"
+	definition.Visibility = account.ProfileAttributeVisibilityService
+	definition.EditableByUser = true
+	// when
+	err := s.repo.Save(s.Ctx, definition)
+	// then
+	require.NoError(s.T(), err)
+	loaded, err := s.repo.LoadByName(s.Ctx, definition.Name)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "updated", loaded.Description)
+	assert.Equal(s.T(), account.ProfileAttributeVisibilityService, loaded.Visibility)
+	assert.True(s.T(), loaded.EditableByUser)
+}
+
+func (s *profileAttributeDefinitionBlackboxTest) TestDelete() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		definition := s.create(repository.ProfileAttributeTypeBoolean)
+		// when
+		err := s.repo.Delete(s.Ctx, definition.ProfileAttributeDefinitionID)
+		// then
+		require.NoError(t, err)
+		_, err = s.repo.LoadByName(s.Ctx, definition.Name)
+		test.AssertError(t, err, errors.NotFoundError{}, "profile attribute with id '%s' not found", definition.Name)
+	})
+
+	s.T().Run("not found", func(t *testing.T) {
+		id := uuid.NewV4()
+		err := s.repo.Delete(s.Ctx, id)
+		test.AssertError(t, err, errors.NotFoundError{}, "profile attribute with id '%s' not found", id)
+	})
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"time"
@@ -36,10 +37,18 @@ type User struct {
 	Company       string // The (optional) Company of the User
 	FeatureLevel  string // the level of features that the user opted in (to access unreleased features). Defaults to `released` so no non-released feature is enabled for the user.
 	Cluster       string // The OpenShift cluster allocated to the user.
+	// The new email address of the user, until the change is confirmed from both the current and the new address
+	PendingEmail string `gorm:"column:pending_email"`
 	// Whether the user has been deprovisioned
-	Deprovisioned      bool                       `gorm:"column:deprovisioned"`
-	Identities         []Identity                 // has many Identities from different IDPs
-	ContextInformation account.ContextInformation `sql:"type:jsonb"` // context information of the user activity
+	Deprovisioned bool `gorm:"column:deprovisioned"`
+	// The user into which this user was merged, if any. Merged users are kept as soft deleted tombstones.
+	MergedInto NullUUID `sql:"type:uuid" gorm:"column:merged_into"`
+	// The time after which the user is deleted, if the user requested the deletion of the account
+	DeletionScheduledAt *time.Time                 `gorm:"column:deletion_scheduled_at"`
+	Identities          []Identity                 // has many Identities from different IDPs
+	ContextInformation  account.ContextInformation `sql:"type:jsonb"` // context information of the user activity
+	// The values of the custom profile attributes of the user, as defined by the administrators
+	ProfileAttributes account.ProfileAttributes `sql:"type:jsonb" gorm:"column:profile_attributes"`
 }
 
 const (
@@ -83,6 +92,8 @@ type UserRepository interface {
 	List(ctx context.Context) ([]User, error)
 	Delete(ctx context.Context, ID uuid.UUID, funcs ...func(*gorm.DB) *gorm.DB) error
 	Query(funcs ...func(*gorm.DB) *gorm.DB) ([]User, error)
+	UpdateProfileAttributeVisibility(ctx context.Context, name string, visibility string) error
+	RemoveProfileAttribute(ctx context.Context, name string) error
 }
 
 // TableName overrides the table name settings in Gorm to force a specific table name
@@ -203,6 +214,34 @@ func (m *GormUserRepository) Query(funcs ...func(*gorm.DB) *gorm.DB) ([]User, er
 	return objs, nil
 }
 
+// UpdateProfileAttributeVisibility sets the visibility of the values of the given custom profile attribute of all the users
+func (m *GormUserRepository) UpdateProfileAttributeVisibility(ctx context.Context, name string, visibility string) error {
+	defer goa.MeasureSince([]string{"goa", "db", "user", "update_profile_attribute_visibility"}, time.Now())
+	err := m.db.Exec(`UPDATE users SET profile_attributes = jsonb_set(profile_attributes, ARRAY[?::text], jsonb_set(profile_attributes->?::text, '{visibility}', to_jsonb(?::text)))
+		WHERE profile_attributes->?::text IS NOT NULL`, name, name, visibility, name).Error
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	log.Info(ctx, map[string]interface{}{
+		"name":       name,
+		"visibility": visibility,
+	}, "Profile attribute visibility updated")
+	return nil
+}
+
+// RemoveProfileAttribute removes the values of the given custom profile attribute from all the users
+func (m *GormUserRepository) RemoveProfileAttribute(ctx context.Context, name string) error {
+	defer goa.MeasureSince([]string{"goa", "db", "user", "remove_profile_attribute"}, time.Now())
+	err := m.db.Exec("UPDATE users SET profile_attributes = profile_attributes - ?::text WHERE profile_attributes->?::text IS NOT NULL", name, name).Error
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	log.Info(ctx, map[string]interface{}{
+		"name": name,
+	}, "Profile attribute removed")
+	return nil
+}
+
 // UserFilterByID is a gorm filter for User ID.
 func UserFilterByID(userID uuid.UUID) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
@@ -210,6 +249,21 @@ func UserFilterByID(userID uuid.UUID) func(db *gorm.DB) *gorm.DB {
 	}
 }
 
+// UserFilterPurgeable is a gorm filter for the users which were deleted before the given time, or which were
+// deprovisioned and not updated since the given time. The deleted users are only found by unscoped queries.
+func UserFilterPurgeable(deletedBefore, deprovisionedBefore time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("deleted_at < ? OR (deprovisioned IS TRUE AND updated_at < ?)", deletedBefore, deprovisionedBefore)
+	}
+}
+
+// UserFilterDeletionDue is a gorm filter for the users whose deletion was scheduled before the given time
+func UserFilterDeletionDue(before time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("deletion_scheduled_at < ?", before)
+	}
+}
+
 // UserFilterByEmail is a gorm filter for User ID.
 func UserFilterByEmail(email string) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
@@ -217,6 +271,19 @@ func UserFilterByEmail(email string) func(db *gorm.DB) *gorm.DB {
 	}
 }
 
+// UserFilterByProfileAttribute is a gorm filter for the users with the given value of a custom profile attribute
+// with the given visibility
+func UserFilterByProfileAttribute(name string, value interface{}, visibility string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		attributes, err := json.Marshal(account.ProfileAttributes{name: {Value: value, Visibility: visibility}})
+		if err != nil {
+			db.AddError(err)
+			return db
+		}
+		return db.Where("profile_attributes @> ?::jsonb", string(attributes))
+	}
+}
+
 // UserFilterByEmailPrivacy is to be used to filter only public or only private emails
 func UserFilterByEmailPrivacy(privateEmails bool) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	usernameHistoryTableName = "username_history"
+)
+
+// UsernameHistory records a username released by an identity when its username was changed
+type UsernameHistory struct {
+	gormsupport.Lifecycle
+	UsernameHistoryID uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key;column:username_history_id"`
+	IdentityID        uuid.UUID `sql:"type:uuid"`
+	// The previous username of the identity
+	Username string
+	// The time at which the identity released the username
+	ReleasedAt time.Time
+}
+
+// TableName implements gorm.tabler
+func (h UsernameHistory) TableName() string {
+	return usernameHistoryTableName
+}
+
+// UsernameHistoryRepository encapsulate storage & retrieval of the usernames released by the identities
+type UsernameHistoryRepository interface {
+	Create(ctx context.Context, history *UsernameHistory) error
+	ListForIdentity(ctx context.Context, identityID uuid.UUID) ([]UsernameHistory, error)
+	LoadLatestByUsername(ctx context.Context, username string) (*UsernameHistory, error)
+	IsQuarantined(ctx context.Context, username string, identityID uuid.UUID, releasedAfter time.Time) (bool, error)
+}
+
+// NewUsernameHistoryRepository creates a new username history repo
+func NewUsernameHistoryRepository(db *gorm.DB) *GormUsernameHistoryRepository {
+	return &GormUsernameHistoryRepository{db}
+}
+
+// GormUsernameHistoryRepository implements UsernameHistoryRepository using gorm
+type GormUsernameHistoryRepository struct {
+	db *gorm.DB
+}
+
+// Create records a released username in the DB
+// returns InternalError
+func (r *GormUsernameHistoryRepository) Create(ctx context.Context, history *UsernameHistory) error {
+	defer goa.MeasureSince([]string{"goa", "db", "username_history", "create"}, time.Now())
+	if history.UsernameHistoryID == uuid.Nil {
+		history.UsernameHistoryID = uuid.NewV4()
+	}
+	if history.ReleasedAt.IsZero() {
+		history.ReleasedAt = time.Now()
+	}
+
+	tx := r.db.Create(history)
+	if err := tx.Error; err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"identity_id": history.IdentityID,
+		"username":    history.Username,
+	}, "Username release recorded")
+	return nil
+}
+
+// ListForIdentity returns the usernames released by the given identity, the most recently released first
+func (r *GormUsernameHistoryRepository) ListForIdentity(ctx context.Context, identityID uuid.UUID) ([]UsernameHistory, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "username_history", "list"}, time.Now())
+	var history []UsernameHistory
+	err := r.db.Where("identity_id = ?", identityID).Order("released_at DESC").Find(&history).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return history, nil
+}
+
+// LoadLatestByUsername returns the most recent release of the given username
+// returns NotFoundError or InternalError
+func (r *GormUsernameHistoryRepository) LoadLatestByUsername(ctx context.Context, username string) (*UsernameHistory, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "username_history", "load"}, time.Now())
+	history := UsernameHistory{}
+	tx := r.db.Where("username = ?", username).Order("released_at DESC").First(&history)
+	if tx.RecordNotFound() {
+		return nil, errors.NewNotFoundErrorFromString("no identity released the username " + username)
+	}
+	if err := tx.Error; err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	return &history, nil
+}
+
+// IsQuarantined returns true if another identity than the given one released the given username after the given time
+func (r *GormUsernameHistoryRepository) IsQuarantined(ctx context.Context, username string, identityID uuid.UUID, releasedAfter time.Time) (bool, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "username_history", "quarantined"}, time.Now())
+	var count int
+	err := r.db.Model(&UsernameHistory{}).
+		Where("username = ? AND identity_id <> ? AND released_at > ?", username, identityID, releasedAfter).
+		Count(&count).Error
+	if err != nil {
+		return false, errs.WithStack(err)
+	}
+	return count > 0, nil
+}
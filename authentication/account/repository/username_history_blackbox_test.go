@@ -0,0 +1,108 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/test"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type usernameHistoryBlackboxTest struct {
+	gormtestsupport.DBTestSuite
+	repo repository.UsernameHistoryRepository
+}
+
+func TestRunUsernameHistoryBlackboxTest(t *testing.T) {
+	suite.Run(t, &usernameHistoryBlackboxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *usernameHistoryBlackboxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.repo = repository.NewUsernameHistoryRepository(s.DB)
+}
+
+func (s *usernameHistoryBlackboxTest) release(identityID uuid.UUID, username string, releasedAt time.Time) {
+	err := s.repo.Create(s.Ctx, &repository.UsernameHistory{
+		IdentityID: identityID,
+		Username:   username,
+		ReleasedAt: releasedAt,
+	})
+	require.NoError(s.T(), err)
+}
+
+func (s *usernameHistoryBlackboxTest) TestListForIdentity() {
+	// given
+	identity := s.Graph.CreateUser().Identity()
+	first := "first-" + uuid.NewV4().String()
+	second := "second-" + uuid.NewV4().String()
+	s.release(identity.ID, first, time.Now().Add(-time.Hour))
+	s.release(identity.ID, second, time.Now())
+	s.release(s.Graph.CreateUser().IdentityID(), "other-"+uuid.NewV4().String(), time.Now())
+	// when
+	history, err := s.repo.ListForIdentity(s.Ctx, identity.ID)
+	// then
+	require.NoError(s.T(), err)
+	require.Len(s.T(), history, 2)
+	assert.Equal(s.T(), second, history[0].Username)
+	assert.Equal(s.T(), first, history[1].Username)
+}
+
+func (s *usernameHistoryBlackboxTest) TestLoadLatestByUsername() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		username := "released-" + uuid.NewV4().String()
+		previousOwner := s.Graph.CreateUser()
+		latestOwner := s.Graph.CreateUser()
+		s.release(previousOwner.IdentityID(), username, time.Now().Add(-time.Hour))
+		s.release(latestOwner.IdentityID(), username, time.Now())
+		// when
+		history, err := s.repo.LoadLatestByUsername(s.Ctx, username)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, latestOwner.IdentityID(), history.IdentityID)
+	})
+
+	s.T().Run("not found", func(t *testing.T) {
+		// given
+		username := "unknown-" + uuid.NewV4().String()
+		// when
+		_, err := s.repo.LoadLatestByUsername(s.Ctx, username)
+		// then
+		test.AssertError(t, err, errors.NotFoundError{}, "no identity released the username %s", username)
+	})
+}
+
+func (s *usernameHistoryBlackboxTest) TestIsQuarantined() {
+	// given
+	username := "quarantined-" + uuid.NewV4().String()
+	previousOwner := s.Graph.CreateUser()
+	s.release(previousOwner.IdentityID(), username, time.Now().Add(-time.Hour))
+	other := s.Graph.CreateUser()
+
+	s.T().Run("released within the quarantine", func(t *testing.T) {
+		quarantined, err := s.repo.IsQuarantined(s.Ctx, username, other.IdentityID(), time.Now().Add(-24*time.Hour))
+		require.NoError(t, err)
+		assert.True(t, quarantined)
+	})
+
+	s.T().Run("released before the quarantine", func(t *testing.T) {
+		quarantined, err := s.repo.IsQuarantined(s.Ctx, username, other.IdentityID(), time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		assert.False(t, quarantined)
+	})
+
+	s.T().Run("claimed back by the previous owner", func(t *testing.T) {
+		quarantined, err := s.repo.IsQuarantined(s.Ctx, username, previousOwner.IdentityID(), time.Now().Add(-24*time.Hour))
+		require.NoError(t, err)
+		assert.False(t, quarantined)
+	})
+}
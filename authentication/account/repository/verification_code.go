@@ -22,7 +22,22 @@ type VerificationCode struct {
 	UserID uuid.UUID `sql:"type:uuid"`
 
 	Code string
-}
+	// What the code is used for, see the `VerificationCodeKind...` constants
+	Kind string
+	// The email address to which the code was sent, if it differs from the current address of the user
+	Email string
+}
+
+const (
+	// VerificationCodeKindVerify the kind of codes which verify the current email address of the user
+	VerificationCodeKindVerify = "verify"
+	// VerificationCodeKindEmailChange the kind of codes which confirm the change of the email address of the user. A code
+	// is sent to both the current and the new address, and the change takes effect once both codes are verified.
+	VerificationCodeKindEmailChange = "email_change"
+	// VerificationCodeKindEmailRevert the kind of codes sent to the previous address of the user to revert a change of
+	// the email address
+	VerificationCodeKindEmailRevert = "email_revert"
+)
 
 // TableName overrides the table name settings in Gorm to force a specific table name
 // in the database.
@@ -49,6 +64,8 @@ type VerificationCodeRepository interface {
 	Create(ctx context.Context, VerificationCode *VerificationCode) error
 	Save(ctx context.Context, VerificationCode *VerificationCode) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	DeleteForUser(ctx context.Context, userID uuid.UUID) error
+	DeleteStale(ctx context.Context, createdBefore time.Time) (int64, error)
 	Query(funcs ...func(*gorm.DB) *gorm.DB) ([]VerificationCode, error)
 }
 
@@ -151,6 +168,33 @@ func (m *GormVerificationCodeRepository) Delete(ctx context.Context, id uuid.UUI
 	return nil
 }
 
+// DeleteForUser removes all the verification codes of the given user. This is a hard delete!
+func (m *GormVerificationCodeRepository) DeleteForUser(ctx context.Context, userID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "VerificationCode", "deleteForUser"}, time.Now())
+	err := m.db.Table(m.TableName()).Where("user_id = ?", userID).Delete(nil).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return errs.WithStack(err)
+	}
+	return nil
+}
+
+// DeleteStale removes the verification codes which were created or used before the given time, as well as the codes
+// of the deleted users, and returns the number of deleted codes. This is a hard delete!
+func (m *GormVerificationCodeRepository) DeleteStale(ctx context.Context, createdBefore time.Time) (int64, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "VerificationCode", "deleteStale"}, time.Now())
+	result := m.db.Table(m.TableName()).
+		Where("created_at < ? OR deleted_at < ? OR user_id IS NULL OR user_id IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)", createdBefore, createdBefore).
+		Delete(nil)
+	if result.Error != nil {
+		log.Error(ctx, map[string]interface{}{
+			"created_before": createdBefore,
+			"err":            result.Error,
+		}, "unable to delete the stale verification codes")
+		return 0, errs.WithStack(result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
 // Query expose an open ended Query model
 func (m *GormVerificationCodeRepository) Query(funcs ...func(*gorm.DB) *gorm.DB) ([]VerificationCode, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "VerificationCode", "query"}, time.Now())
@@ -180,6 +224,13 @@ func VerificationCodeFilterByCode(code string) func(db *gorm.DB) *gorm.DB {
 	}
 }
 
+// VerificationCodeFilterByKind is a gorm filter by kind of verification code.
+func VerificationCodeFilterByKind(kind string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("kind = ?", kind)
+	}
+}
+
 // VerificationCodeWithUser is a gorm filter for preloading the user relationship.
 func VerificationCodeWithUser() func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
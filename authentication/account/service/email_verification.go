@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/fabric8-services/fabric8-auth/application"
 	"github.com/fabric8-services/fabric8-auth/application/service"
@@ -19,19 +20,28 @@ import (
 
 type EmailVerificationService interface {
 	SendVerificationCode(ctx context.Context, req *goa.RequestData, identity repository.Identity) (*repository.VerificationCode, error)
+	SendEmailChangeCodes(ctx context.Context, req *goa.RequestData, identity repository.Identity) error
 	VerifyCode(ctx context.Context, code string) (*repository.VerificationCode, error)
+	RevertEmail(ctx context.Context, code string) (*repository.VerificationCode, error)
+}
+
+// EmailVerificationServiceConfiguration the configuration of the email verification service
+type EmailVerificationServiceConfiguration interface {
+	GetEmailRevertPeriod() time.Duration
 }
 
 type EmailVerificationClient struct {
 	app          application.Application
 	notification service.NotificationService
+	config       EmailVerificationServiceConfiguration
 }
 
 // NewEmailVerificationClient creates a new client for managing email verification.
-func NewEmailVerificationClient(app application.Application) *EmailVerificationClient {
+func NewEmailVerificationClient(app application.Application, config EmailVerificationServiceConfiguration) *EmailVerificationClient {
 	return &EmailVerificationClient{
 		app:          app,
 		notification: app.NotificationService(),
+		config:       config,
 	}
 }
 
@@ -42,6 +52,7 @@ func (c *EmailVerificationClient) SendVerificationCode(ctx context.Context, req
 	newVerificationCode := repository.VerificationCode{
 		User: identity.User,
 		Code: generatedCode,
+		Kind: repository.VerificationCodeKindVerify,
 	}
 
 	log.Info(ctx, map[string]interface{}{
@@ -66,11 +77,78 @@ func (c *EmailVerificationClient) SendVerificationCode(ctx context.Context, req
 	return &newVerificationCode, err
 }
 
+// SendEmailChangeCodes generates and sends out the codes to confirm the change of the email address of the user of
+// the given identity to its pending email address. A code is sent to both the current and the new address, and the
+// current address also receives a code to revert the change. The codes of a previous change are invalidated, including
+// its revert codes, so that only the latest previous address can revert the email address of the user.
+func (c *EmailVerificationClient) SendEmailChangeCodes(ctx context.Context, req *goa.RequestData, identity repository.Identity) error {
+	user := identity.User
+	if user.PendingEmail == "" {
+		return errors.NewBadParameterErrorFromString("email", user.PendingEmail, "no email change pending")
+	}
+	currentCode := repository.VerificationCode{
+		User:  user,
+		Code:  uuid.NewV4().String(),
+		Kind:  repository.VerificationCodeKindEmailChange,
+		Email: user.Email,
+	}
+	newCode := repository.VerificationCode{
+		User:  user,
+		Code:  uuid.NewV4().String(),
+		Kind:  repository.VerificationCodeKindEmailChange,
+		Email: user.PendingEmail,
+	}
+	revertCode := repository.VerificationCode{
+		User:  user,
+		Code:  uuid.NewV4().String(),
+		Kind:  repository.VerificationCodeKindEmailRevert,
+		Email: user.Email,
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"email":     user.Email,
+		"new_email": user.PendingEmail,
+	}, "email change codes to be sent")
+
+	err := transaction.Transactional(c.app, func(tr transaction.TransactionalResources) error {
+		for _, kind := range []string{repository.VerificationCodeKindEmailChange, repository.VerificationCodeKindEmailRevert} {
+			err := deleteVerificationCodes(ctx, tr, user.ID, kind)
+			if err != nil {
+				return err
+			}
+		}
+		for _, code := range []*repository.VerificationCode{&currentCode, &newCode, &revertCode} {
+			err := tr.VerificationCodes().Create(ctx, code)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.notification.SendMessageAsync(ctx, notification.NewUserEmailUpdated(identity.ID.String(), map[string]interface{}{
+		"email":     user.PendingEmail,
+		"verifyURL": c.generateVerificationURL(ctx, req, newCode.Code),
+	}))
+	c.notification.SendMessageAsync(ctx, notification.NewUserEmailChangeRequested(identity.ID.String(), user.Email, user.PendingEmail,
+		c.generateVerificationURL(ctx, req, currentCode.Code), c.generateRevertURL(ctx, req, revertCode.Code)))
+	return nil
+}
+
 func (c *EmailVerificationClient) generateVerificationURL(ctx context.Context, req *goa.RequestData, code string) string {
 	return rest.AbsoluteURL(req, authclient.VerifyEmailUsersPath(), nil) + "?code=" + code
 }
 
+func (c *EmailVerificationClient) generateRevertURL(ctx context.Context, req *goa.RequestData, code string) string {
+	return rest.AbsoluteURL(req, authclient.RevertEmailUsersPath(), nil) + "?code=" + code
+}
+
 // VerifyCode validates whether the code is present in our database and returns a non-nil if yes.
+// If the code confirms a change of the email address and the code sent to the other address was already verified,
+// the pending email address of the user replaces the current one.
 func (c *EmailVerificationClient) VerifyCode(ctx context.Context, code string) (*repository.VerificationCode, error) {
 
 	var verificationCode *repository.VerificationCode
@@ -95,6 +173,42 @@ func (c *EmailVerificationClient) VerifyCode(ctx context.Context, code string) (
 		verificationCode = &verificationCodeList[0]
 
 		user := verificationCode.User
+		switch verificationCode.Kind {
+		case repository.VerificationCodeKindEmailRevert:
+			// revert codes are only used by RevertEmail
+			return errors.NewNotFoundError("code", code)
+		case repository.VerificationCodeKindEmailChange:
+			// the code may belong to a change which was cancelled since then
+			if user.PendingEmail == "" || (verificationCode.Email != user.Email && verificationCode.Email != user.PendingEmail) {
+				return errors.NewNotFoundError("code", code)
+			}
+			err = tr.VerificationCodes().Delete(ctx, verificationCode.ID)
+			if err != nil {
+				return err
+			}
+			remaining, err := tr.VerificationCodes().Query(
+				repository.VerificationCodeFilterByUserID(user.ID),
+				repository.VerificationCodeFilterByKind(repository.VerificationCodeKindEmailChange))
+			if err != nil {
+				return err
+			}
+			if len(remaining) > 0 {
+				// the other address has not been confirmed yet
+				return nil
+			}
+			err = checkEmailAvailable(ctx, tr, user, user.PendingEmail)
+			if err != nil {
+				return err
+			}
+			log.Info(ctx, map[string]interface{}{
+				"user_id": user.ID,
+			}, "email change confirmed from both addresses")
+			user.Email = user.PendingEmail
+			user.PendingEmail = ""
+			user.EmailVerified = true
+			return tr.Users().Save(ctx, &user)
+		}
+
 		user.EmailVerified = true
 		err = tr.Users().Save(ctx, &user)
 		if err != nil {
@@ -113,3 +227,90 @@ func (c *EmailVerificationClient) VerifyCode(ctx context.Context, code string) (
 	}
 	return verificationCode, err
 }
+
+// RevertEmail restores the email address to which the given revert code was sent, and cancels any pending change of
+// the email address of the user. Following the link of the code proves the ownership of the restored address, which
+// is thus verified. The revert codes expire after the configured revert period, and are superseded by the codes of
+// any later change.
+func (c *EmailVerificationClient) RevertEmail(ctx context.Context, code string) (*repository.VerificationCode, error) {
+	var verificationCode *repository.VerificationCode
+	err := transaction.Transactional(c.app, func(tr transaction.TransactionalResources) error {
+		verificationCodeList, err := tr.VerificationCodes().Query(
+			repository.VerificationCodeWithUser(),
+			repository.VerificationCodeFilterByCode(code),
+			repository.VerificationCodeFilterByKind(repository.VerificationCodeKindEmailRevert))
+		if err != nil {
+			return err
+		}
+		if len(verificationCodeList) == 0 {
+			return errors.NewNotFoundError("code", code)
+		}
+		verificationCode = &verificationCodeList[0]
+		if verificationCode.CreatedAt.Before(time.Now().Add(-c.config.GetEmailRevertPeriod())) {
+			log.Info(ctx, map[string]interface{}{
+				"user_id": verificationCode.UserID,
+			}, "email revert code expired")
+			return errors.NewNotFoundError("code", code)
+		}
+
+		user := verificationCode.User
+		err = checkEmailAvailable(ctx, tr, user, verificationCode.Email)
+		if err != nil {
+			return err
+		}
+		user.Email = verificationCode.Email
+		user.PendingEmail = ""
+		user.EmailVerified = true
+		err = tr.Users().Save(ctx, &user)
+		if err != nil {
+			return err
+		}
+		err = deleteVerificationCodes(ctx, tr, user.ID, repository.VerificationCodeKindEmailChange)
+		if err != nil {
+			return err
+		}
+		return tr.VerificationCodes().Delete(ctx, verificationCode.ID)
+	})
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"code": code,
+			"err":  err,
+		}, "email revert failed")
+		return nil, err
+	}
+	log.Info(ctx, map[string]interface{}{
+		"user_id": verificationCode.UserID,
+	}, "email reverted")
+	return verificationCode, nil
+}
+
+// checkEmailAvailable returns a BadParameterError if the given email address is used by another user than the given one
+func checkEmailAvailable(ctx context.Context, tr transaction.TransactionalResources, user repository.User, email string) error {
+	users, err := tr.Users().Query(repository.UserFilterByEmail(email))
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if u.ID != user.ID {
+			return errors.NewBadParameterErrorFromString("email", email, "email address already in use")
+		}
+	}
+	return nil
+}
+
+// deleteVerificationCodes deletes the verification codes of the given kind of the given user
+func deleteVerificationCodes(ctx context.Context, tr transaction.TransactionalResources, userID uuid.UUID, kind string) error {
+	codes, err := tr.VerificationCodes().Query(
+		repository.VerificationCodeFilterByUserID(userID),
+		repository.VerificationCodeFilterByKind(kind))
+	if err != nil {
+		return err
+	}
+	for _, code := range codes {
+		err := tr.VerificationCodes().Delete(ctx, code.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
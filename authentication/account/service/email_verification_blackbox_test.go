@@ -3,14 +3,22 @@ package service_test
 import (
 	"context"
 	"net/http"
+	"time"
 
+	"github.com/fabric8-services/fabric8-auth/application/service/factory"
 	"github.com/fabric8-services/fabric8-auth/authentication/account/repository"
 	"github.com/fabric8-services/fabric8-auth/authentication/account/service"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormapplication"
 	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/notification"
+	"github.com/fabric8-services/fabric8-auth/rest"
 	"github.com/fabric8-services/fabric8-auth/test"
+	testservice "github.com/fabric8-services/fabric8-auth/test/service"
 	"github.com/goadesign/goa"
 	"github.com/satori/go.uuid"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"testing"
@@ -29,7 +37,7 @@ func TestRunVerificationServiceBlackboxTest(t *testing.T) {
 func (s *verificationServiceBlackboxTest) SetupTest() {
 	s.DBTestSuite.SetupTest()
 	s.repo = repository.NewVerificationCodeRepository(s.DB)
-	s.verificationService = service.NewEmailVerificationClient(s.Application)
+	s.verificationService = service.NewEmailVerificationClient(s.Application, s.Configuration)
 }
 
 func (s *verificationServiceBlackboxTest) TestSendVerificationCodeOK() {
@@ -91,3 +99,210 @@ func (s *verificationServiceBlackboxTest) TestVerifyCodeFails() {
 	require.Error(s.T(), err)
 	require.Nil(s.T(), codeOK)
 }
+
+// requestEmailChange sets the pending email address of the user of the given identity and sends the email change codes
+func (s *verificationServiceBlackboxTest) requestEmailChange(verificationService service.EmailVerificationService, identity repository.Identity) (repository.Identity, string) {
+	newEmail := uuid.NewV4().String() + "@example.com"
+	identity.User.PendingEmail = newEmail
+	require.NoError(s.T(), s.Application.Users().Save(context.Background(), &identity.User))
+	r := &goa.RequestData{
+		Request: &http.Request{Host: "example.com"},
+	}
+	require.NoError(s.T(), verificationService.SendEmailChangeCodes(context.Background(), r, identity))
+	return identity, newEmail
+}
+
+// emailChangeCodes returns the codes of the given kind of the given user, by email address
+func (s *verificationServiceBlackboxTest) emailChangeCodes(userID uuid.UUID, kind string) map[string]string {
+	codes, err := s.Application.VerificationCodes().Query(
+		repository.VerificationCodeFilterByUserID(userID),
+		repository.VerificationCodeFilterByKind(kind))
+	require.NoError(s.T(), err)
+	result := map[string]string{}
+	for _, code := range codes {
+		result[code.Email] = code.Code
+	}
+	return result
+}
+
+func (s *verificationServiceBlackboxTest) TestSendEmailChangeCodesOK() {
+	// given
+	var messages []notification.Message
+	notificationServiceMock := testservice.NewNotificationServiceMock(s.T())
+	notificationServiceMock.SendMessageAsyncFunc = func(ctx context.Context, msg notification.Message, options ...rest.HTTPClientOption) (chan error, error) {
+		messages = append(messages, msg)
+		return nil, nil
+	}
+	application := gormapplication.NewGormDB(s.DB, s.Configuration, s.Wrappers, factory.WithNotificationService(notificationServiceMock))
+	identity := *s.Graph.CreateUser().Identity()
+
+	// when
+	identity, newEmail := s.requestEmailChange(service.NewEmailVerificationClient(application, s.Configuration), identity)
+
+	// then a code is sent to both addresses, and a revert code to the current address
+	changeCodes := s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailChange)
+	require.Len(s.T(), changeCodes, 2)
+	require.Contains(s.T(), changeCodes, identity.User.Email)
+	require.Contains(s.T(), changeCodes, newEmail)
+	revertCodes := s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailRevert)
+	require.Contains(s.T(), revertCodes, identity.User.Email)
+	require.Len(s.T(), messages, 2)
+	assert.Equal(s.T(), "user.email.update", messages[0].MessageType)
+	assert.Equal(s.T(), newEmail, messages[0].Custom["email"])
+	assert.Equal(s.T(), "http://example.com/api/users/verifyemail?code="+changeCodes[newEmail], messages[0].Custom["verifyURL"])
+	assert.Equal(s.T(), "user.email.change", messages[1].MessageType)
+	assert.Equal(s.T(), identity.User.Email, messages[1].Custom["email"])
+	assert.Equal(s.T(), "http://example.com/api/users/verifyemail?code="+changeCodes[identity.User.Email], messages[1].Custom["verifyURL"])
+	assert.Equal(s.T(), "http://example.com/api/users/revertemail?code="+revertCodes[identity.User.Email], messages[1].Custom["revertURL"])
+
+	s.T().Run("codes of the previous change invalidated", func(t *testing.T) {
+		// when
+		identity, newEmail := s.requestEmailChange(service.NewEmailVerificationClient(application, s.Configuration), identity)
+		// then
+		codes := s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailChange)
+		require.Len(t, codes, 2)
+		assert.Contains(t, codes, newEmail)
+		assert.NotEqual(t, changeCodes[identity.User.Email], codes[identity.User.Email])
+	})
+}
+
+func (s *verificationServiceBlackboxTest) TestVerifyEmailChangeCodes() {
+	// given
+	identity, newEmail := s.requestEmailChange(s.verificationService, *s.Graph.CreateUser().Identity())
+	oldEmail := identity.User.Email
+	codes := s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailChange)
+
+	// when the new address is confirmed
+	_, err := s.verificationService.VerifyCode(context.Background(), codes[newEmail])
+	// then the email address is not changed yet
+	require.NoError(s.T(), err)
+	user, err := s.Application.Users().Load(context.Background(), identity.User.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), oldEmail, user.Email)
+	assert.Equal(s.T(), newEmail, user.PendingEmail)
+
+	// when the current address is confirmed
+	_, err = s.verificationService.VerifyCode(context.Background(), codes[oldEmail])
+	// then the email address is changed
+	require.NoError(s.T(), err)
+	user, err = s.Application.Users().Load(context.Background(), identity.User.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), newEmail, user.Email)
+	assert.Empty(s.T(), user.PendingEmail)
+	assert.True(s.T(), user.EmailVerified)
+}
+
+func (s *verificationServiceBlackboxTest) TestVerifyEmailChangeCodeFailsWhenEmailTaken() {
+	// given
+	identity, newEmail := s.requestEmailChange(s.verificationService, *s.Graph.CreateUser().Identity())
+	codes := s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailChange)
+	_, err := s.verificationService.VerifyCode(context.Background(), codes[newEmail])
+	require.NoError(s.T(), err)
+	other := s.Graph.CreateUser()
+	other.User().Email = newEmail
+	require.NoError(s.T(), s.Application.Users().Save(context.Background(), other.User()))
+	// when
+	_, err = s.verificationService.VerifyCode(context.Background(), codes[identity.User.Email])
+	// then
+	test.AssertError(s.T(), err, errors.BadParameterError{}, "Bad value for parameter 'email': '%s' - email address already in use", newEmail)
+}
+
+func (s *verificationServiceBlackboxTest) TestRevertEmail() {
+
+	s.T().Run("before the change", func(t *testing.T) {
+		// given
+		identity, _ := s.requestEmailChange(s.verificationService, *s.Graph.CreateUser().Identity())
+		revertCodes := s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailRevert)
+		// when
+		_, err := s.verificationService.RevertEmail(context.Background(), revertCodes[identity.User.Email])
+		// then
+		require.NoError(t, err)
+		user, err := s.Application.Users().Load(context.Background(), identity.User.ID)
+		require.NoError(t, err)
+		assert.Equal(t, identity.User.Email, user.Email)
+		assert.Empty(t, user.PendingEmail)
+		assert.Empty(t, s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailChange))
+	})
+
+	s.T().Run("after the change", func(t *testing.T) {
+		// given
+		identity, newEmail := s.requestEmailChange(s.verificationService, *s.Graph.CreateUser().Identity())
+		codes := s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailChange)
+		revertCodes := s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailRevert)
+		for _, code := range codes {
+			_, err := s.verificationService.VerifyCode(context.Background(), code)
+			require.NoError(t, err)
+		}
+		// when
+		_, err := s.verificationService.RevertEmail(context.Background(), revertCodes[identity.User.Email])
+		// then
+		require.NoError(t, err)
+		user, err := s.Application.Users().Load(context.Background(), identity.User.ID)
+		require.NoError(t, err)
+		assert.Equal(t, identity.User.Email, user.Email)
+		assert.NotEqual(t, newEmail, user.Email)
+	})
+
+	s.T().Run("not a revert code", func(t *testing.T) {
+		// given
+		identity, newEmail := s.requestEmailChange(s.verificationService, *s.Graph.CreateUser().Identity())
+		codes := s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailChange)
+		// when
+		_, err := s.verificationService.RevertEmail(context.Background(), codes[newEmail])
+		// then
+		test.AssertError(t, err, errors.NotFoundError{}, "code with id '%s' not found", codes[newEmail])
+	})
+
+	s.T().Run("expired revert code", func(t *testing.T) {
+		// given
+		identity, newEmail := s.requestEmailChange(s.verificationService, *s.Graph.CreateUser().Identity())
+		revertCodes := s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailRevert)
+		createdAt := time.Now().Add(-s.Configuration.GetEmailRevertPeriod()).Add(-time.Minute)
+		err := s.DB.Exec("UPDATE verification_codes SET created_at = ? WHERE code = ?", createdAt, revertCodes[identity.User.Email]).Error
+		require.NoError(t, err)
+		// when
+		_, err = s.verificationService.RevertEmail(context.Background(), revertCodes[identity.User.Email])
+		// then
+		test.AssertError(t, err, errors.NotFoundError{}, "code with id '%s' not found", revertCodes[identity.User.Email])
+		user, err := s.Application.Users().Load(context.Background(), identity.User.ID)
+		require.NoError(t, err)
+		assert.Equal(t, newEmail, user.PendingEmail)
+	})
+
+	s.T().Run("superseded revert code", func(t *testing.T) {
+		// given the email address is changed twice
+		identity, newEmail := s.requestEmailChange(s.verificationService, *s.Graph.CreateUser().Identity())
+		oldEmail := identity.User.Email
+		revertCodes := s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailRevert)
+		for _, code := range s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailChange) {
+			_, err := s.verificationService.VerifyCode(context.Background(), code)
+			require.NoError(t, err)
+		}
+		user, err := s.Application.Users().Load(context.Background(), identity.User.ID)
+		require.NoError(t, err)
+		require.Equal(t, newEmail, user.Email)
+		identity.User = *user
+		identity, _ = s.requestEmailChange(s.verificationService, identity)
+		// when the code sent to the first address is used
+		_, err = s.verificationService.RevertEmail(context.Background(), revertCodes[oldEmail])
+		// then
+		test.AssertError(t, err, errors.NotFoundError{}, "code with id '%s' not found", revertCodes[oldEmail])
+		user, err = s.Application.Users().Load(context.Background(), identity.User.ID)
+		require.NoError(t, err)
+		assert.Equal(t, newEmail, user.Email)
+		// only the latest previous address can revert the change
+		latestRevertCodes := s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailRevert)
+		assert.Len(t, latestRevertCodes, 1)
+		assert.Contains(t, latestRevertCodes, newEmail)
+	})
+
+	s.T().Run("revert code can't verify", func(t *testing.T) {
+		// given
+		identity, _ := s.requestEmailChange(s.verificationService, *s.Graph.CreateUser().Identity())
+		revertCodes := s.emailChangeCodes(identity.User.ID, repository.VerificationCodeKindEmailRevert)
+		// when
+		_, err := s.verificationService.VerifyCode(context.Background(), revertCodes[identity.User.Email])
+		// then
+		test.AssertError(t, err, errors.NotFoundError{}, "code with id '%s' not found", revertCodes[identity.User.Email])
+	})
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	apprepository "github.com/fabric8-services/fabric8-auth/application/repository"
+	"github.com/fabric8-services/fabric8-auth/application/service"
+	"github.com/fabric8-services/fabric8-auth/application/service/base"
+	servicecontext "github.com/fabric8-services/fabric8-auth/application/service/context"
+	"github.com/fabric8-services/fabric8-auth/authentication/account"
+	"github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// profileAttributeNamePattern the pattern of the names of the profile attributes, which are used as JSON keys
+var profileAttributeNamePattern = regexp.MustCompile("^[a-z][a-z0-9_]{0,62}$")
+
+// NewProfileAttributeService creates a new service to manage the custom profile attributes
+func NewProfileAttributeService(ctx servicecontext.ServiceContext) service.ProfileAttributeService {
+	return &profileAttributeServiceImpl{
+		BaseService: base.NewBaseService(ctx),
+	}
+}
+
+// profileAttributeServiceImpl implements the ProfileAttributeService
+type profileAttributeServiceImpl struct {
+	base.BaseService
+}
+
+// ListDefinitions returns the definitions of all the custom profile attributes
+func (s *profileAttributeServiceImpl) ListDefinitions(ctx context.Context) ([]repository.ProfileAttributeDefinition, error) {
+	var definitions []repository.ProfileAttributeDefinition
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		definitions, err = s.Repositories().ProfileAttributeDefinitions().List(ctx)
+		return err
+	})
+	return definitions, err
+}
+
+// CreateDefinition creates the definition of a new custom profile attribute. The visibility defaults to private.
+// The identity must have the manage_user scope for the system resources, otherwise ForbiddenError is returned
+func (s *profileAttributeServiceImpl) CreateDefinition(ctx context.Context, byIdentityID uuid.UUID, definition *repository.ProfileAttributeDefinition) error {
+	err := s.Services().PermissionService().RequireSystemScope(ctx, byIdentityID, authorization.ManageUserSystemScope)
+	if err != nil {
+		return err
+	}
+	if !profileAttributeNamePattern.MatchString(definition.Name) {
+		return errors.NewBadParameterErrorFromString("name", definition.Name, "the name must start with a lowercase letter and only contain lowercase letters, digits and underscores")
+	}
+	switch definition.Type {
+	case repository.ProfileAttributeTypeString, repository.ProfileAttributeTypeNumber, repository.ProfileAttributeTypeBoolean, repository.ProfileAttributeTypeURL:
+	default:
+		return errors.NewBadParameterErrorFromString("type", definition.Type, "the type must be one of string, number, boolean or url")
+	}
+	if definition.Visibility == "" {
+		definition.Visibility = account.ProfileAttributeVisibilityPrivate
+	}
+	err = validateProfileAttributeDefinition(definition)
+	if err != nil {
+		return err
+	}
+
+	return s.ExecuteInTransaction(func() error {
+		_, err := s.Repositories().ProfileAttributeDefinitions().LoadByName(ctx, definition.Name)
+		if err == nil {
+			return errors.NewDataConflictError(fmt.Sprintf("profile attribute %s already exists", definition.Name))
+		}
+		if notFound, _ := errors.IsNotFoundError(err); !notFound {
+			return err
+		}
+		return s.Repositories().ProfileAttributeDefinitions().Create(ctx, definition)
+	})
+}
+
+// UpdateDefinition updates the description, pattern, visibility or editable flag of the definition of a custom profile
+// attribute. The type can't be updated, as the existing values would not match it. The values stored in the profile of
+// the users are updated along with the visibility.
+// The identity must have the manage_user scope for the system resources, otherwise ForbiddenError is returned
+func (s *profileAttributeServiceImpl) UpdateDefinition(ctx context.Context, byIdentityID uuid.UUID, name string, description *string, pattern *string, visibility *string, editableByUser *bool) (*repository.ProfileAttributeDefinition, error) {
+	err := s.Services().PermissionService().RequireSystemScope(ctx, byIdentityID, authorization.ManageUserSystemScope)
+	if err != nil {
+		return nil, err
+	}
+	var definition *repository.ProfileAttributeDefinition
+	err = s.ExecuteInTransaction(func() error {
+		var err error
+		definition, err = s.Repositories().ProfileAttributeDefinitions().LoadByName(ctx, name)
+		if err != nil {
+			return err
+		}
+		visibilityChanged := visibility != nil && *visibility != definition.Visibility
+		if description != nil {
+			definition.Description = *description
+		}
+		if pattern != nil {
+			definition.Pattern = *pattern
+		}
+		if visibility != nil {
+			definition.Visibility = *visibility
+		}
+		if editableByUser != nil {
+			definition.EditableByUser = *editableByUser
+		}
+		err = validateProfileAttributeDefinition(definition)
+		if err != nil {
+			return err
+		}
+		err = s.Repositories().ProfileAttributeDefinitions().Save(ctx, definition)
+		if err != nil {
+			return err
+		}
+		if visibilityChanged {
+			return s.Repositories().Users().UpdateProfileAttributeVisibility(ctx, definition.Name, definition.Visibility)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return definition, nil
+}
+
+// DeleteDefinition deletes the definition of a custom profile attribute, along with its values in the profile of the users
+// The identity must have the manage_user scope for the system resources, otherwise ForbiddenError is returned
+func (s *profileAttributeServiceImpl) DeleteDefinition(ctx context.Context, byIdentityID uuid.UUID, name string) error {
+	err := s.Services().PermissionService().RequireSystemScope(ctx, byIdentityID, authorization.ManageUserSystemScope)
+	if err != nil {
+		return err
+	}
+	return s.ExecuteInTransaction(func() error {
+		definition, err := s.Repositories().ProfileAttributeDefinitions().LoadByName(ctx, name)
+		if err != nil {
+			return err
+		}
+		err = s.Repositories().ProfileAttributeDefinitions().Delete(ctx, definition.ProfileAttributeDefinitionID)
+		if err != nil {
+			return err
+		}
+		return s.Repositories().Users().RemoveProfileAttribute(ctx, definition.Name)
+	})
+}
+
+// UpdateAttributes validates and sets the given values of the custom profile attributes of the user of the given identity.
+// The attributes whose value is nil are removed. The users can only update the attributes which are editable by the users
+// in their own profile, the other attributes and the profile of the other users can only be updated by an identity with
+// the manage_user scope for the system resources, otherwise ForbiddenError is returned.
+func (s *profileAttributeServiceImpl) UpdateAttributes(ctx context.Context, byIdentityID uuid.UUID, identityID uuid.UUID, values map[string]interface{}) (*repository.Identity, error) {
+	var identity *repository.Identity
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		identity, err = s.Repositories().Identities().LoadWithUser(ctx, identityID)
+		if err != nil {
+			return err
+		}
+		err = s.SetAttributes(ctx, s.Repositories(), byIdentityID, identityID, &identity.User, values)
+		if err != nil {
+			return err
+		}
+		return s.Repositories().Users().Save(ctx, &identity.User)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Info(ctx, map[string]interface{}{
+		"identity_id":    identityID,
+		"by_identity_id": byIdentityID,
+	}, "profile attributes updated")
+	return identity, nil
+}
+
+// SetAttributes validates and sets the given values of the custom profile attributes of the given user, which belongs
+// to the given identity, without saving the user. The given repositories are the ones of the transaction in which the
+// user is saved by the caller. The permissions are the same as in UpdateAttributes.
+func (s *profileAttributeServiceImpl) SetAttributes(ctx context.Context, repositories apprepository.Repositories, byIdentityID uuid.UUID, identityID uuid.UUID, user *repository.User, values map[string]interface{}) error {
+	byAdmin := byIdentityID != identityID
+	if byAdmin {
+		err := s.Services().PermissionService().RequireSystemScope(ctx, byIdentityID, authorization.ManageUserSystemScope)
+		if err != nil {
+			return err
+		}
+	}
+	if user.ProfileAttributes == nil {
+		user.ProfileAttributes = account.ProfileAttributes{}
+	}
+	for name, value := range values {
+		definition, err := repositories.ProfileAttributeDefinitions().LoadByName(ctx, name)
+		if err != nil {
+			if notFound, _ := errors.IsNotFoundError(err); notFound {
+				return errors.NewBadParameterErrorFromString("profileAttributes", name, "unknown profile attribute")
+			}
+			return err
+		}
+		if !byAdmin && !definition.EditableByUser {
+			return errors.NewForbiddenError(fmt.Sprintf("profile attribute %s can't be updated by the user", name))
+		}
+		if value == nil {
+			delete(user.ProfileAttributes, name)
+			continue
+		}
+		value, err = ValidateProfileAttributeValue(*definition, value)
+		if err != nil {
+			return err
+		}
+		user.ProfileAttributes[name] = account.ProfileAttribute{
+			Value:      value,
+			Visibility: definition.Visibility,
+		}
+	}
+	return nil
+}
+
+// ValidateProfileAttributeValue checks that the given value matches the type and pattern of the given profile attribute
+// definition, and returns it in the form in which it is stored: numbers are stored as float64, as when decoded from JSON.
+// Returns BadParameterError if the value doesn't match the definition.
+func ValidateProfileAttributeValue(definition repository.ProfileAttributeDefinition, value interface{}) (interface{}, error) {
+	switch definition.Type {
+	case repository.ProfileAttributeTypeNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+	case repository.ProfileAttributeTypeBoolean:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	case repository.ProfileAttributeTypeString, repository.ProfileAttributeTypeURL:
+		v, ok := value.(string)
+		if !ok {
+			break
+		}
+		if definition.Type == repository.ProfileAttributeTypeURL {
+			u, err := url.ParseRequestURI(v)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, errors.NewBadParameterErrorFromString(definition.Name, v, "the value must be an absolute http(s) URL")
+			}
+		}
+		if definition.Pattern != "" && !regexp.MustCompile(definition.Pattern).MatchString(v) {
+			return nil, errors.NewBadParameterErrorFromString(definition.Name, v, fmt.Sprintf("the value must match %s", definition.Pattern))
+		}
+		return v, nil
+	}
+	return nil, errors.NewBadParameterErrorFromString(definition.Name, value, fmt.Sprintf("the value must be a %s", definition.Type))
+}
+
+// ParseProfileAttributeValue parses the given string, e.g. a query parameter, as a value of the given profile attribute
+// definition. Returns BadParameterError if the value doesn't match the definition.
+func ParseProfileAttributeValue(definition repository.ProfileAttributeDefinition, value string) (interface{}, error) {
+	switch definition.Type {
+	case repository.ProfileAttributeTypeNumber:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, errors.NewBadParameterErrorFromString(definition.Name, value, "the value must be a number")
+		}
+		return v, nil
+	case repository.ProfileAttributeTypeBoolean:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.NewBadParameterErrorFromString(definition.Name, value, "the value must be a boolean")
+		}
+		return v, nil
+	}
+	return ValidateProfileAttributeValue(definition, value)
+}
+
+// validateProfileAttributeDefinition checks the visibility and the pattern of the given profile attribute definition
+func validateProfileAttributeDefinition(definition *repository.ProfileAttributeDefinition) error {
+	switch definition.Visibility {
+	case account.ProfileAttributeVisibilityPublic, account.ProfileAttributeVisibilityPrivate, account.ProfileAttributeVisibilityService:
+	default:
+		return errors.NewBadParameterErrorFromString("visibility", definition.Visibility, "the visibility must be one of public, private or service")
+	}
+	if definition.Pattern != "" {
+		if definition.Type != repository.ProfileAttributeTypeString && definition.Type != repository.ProfileAttributeTypeURL {
+			return errors.NewBadParameterErrorFromString("pattern", definition.Pattern, "a pattern can only be set for the string and url attributes")
+		}
+		if _, err := regexp.Compile(definition.Pattern); err != nil {
+			return errors.NewBadParameterErrorFromString("pattern", definition.Pattern, "the pattern is not a valid regular expression")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/application/service"
+	"github.com/fabric8-services/fabric8-auth/authentication/account"
+	"github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	accountservice "github.com/fabric8-services/fabric8-auth/authentication/account/service"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type profileAttributeServiceBlackBoxTest struct {
+	gormtestsupport.DBTestSuite
+	profileAttributeService service.ProfileAttributeService
+}
+
+func TestRunProfileAttributeServiceBlackBoxTest(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &profileAttributeServiceBlackBoxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *profileAttributeServiceBlackBoxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.profileAttributeService = s.Application.ProfileAttributeService()
+}
+
+// newAdmin returns the ID of a new user with the manage_user scope
+func (s *profileAttributeServiceBlackBoxTest) newAdmin(t *testing.T) uuid.UUID {
+	g := s.NewTestGraph(t)
+	user := g.CreateUser()
+	g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+		AddRole(user, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+	return user.IdentityID()
+}
+
+// newDefinition creates a new profile attribute definition with a unique name
+func (s *profileAttributeServiceBlackBoxTest) newDefinition(t *testing.T, attributeType, visibility string, editableByUser bool) *repository.ProfileAttributeDefinition {
+	definition := &repository.ProfileAttributeDefinition{
+		Name:           "attr_" + uuid.NewV4().String()[:8],
+		Type:           attributeType,
+		Visibility:     visibility,
+		EditableByUser: editableByUser,
+	}
+	err := s.profileAttributeService.CreateDefinition(s.Ctx, s.newAdmin(t), definition)
+	require.NoError(t, err)
+	return definition
+}
+
+func (s *profileAttributeServiceBlackBoxTest) TestCreateDefinition() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		definition := &repository.ProfileAttributeDefinition{
+			Name: "attr_" + uuid.NewV4().String()[:8],
+			Type: repository.ProfileAttributeTypeString,
+		}
+		// when
+		err := s.profileAttributeService.CreateDefinition(s.Ctx, s.newAdmin(t), definition)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, account.ProfileAttributeVisibilityPrivate, definition.Visibility)
+		definitions, err := s.profileAttributeService.ListDefinitions(s.Ctx)
+		require.NoError(t, err)
+		names := []string{}
+		for _, d := range definitions {
+			names = append(names, d.Name)
+		}
+		assert.Contains(t, names, definition.Name)
+	})
+
+	s.T().Run("duplicate name", func(t *testing.T) {
+		// given
+		existing := s.newDefinition(t, repository.ProfileAttributeTypeString, account.ProfileAttributeVisibilityPublic, false)
+		// when
+		err := s.profileAttributeService.CreateDefinition(s.Ctx, s.newAdmin(t), &repository.ProfileAttributeDefinition{
+			Name: existing.Name,
+			Type: repository.ProfileAttributeTypeNumber,
+		})
+		// then
+		require.IsType(t, errors.DataConflictError{}, err)
+	})
+
+	s.T().Run("invalid definitions", func(t *testing.T) {
+		admin := s.newAdmin(t)
+		for name, definition := range map[string]repository.ProfileAttributeDefinition{
+			"name":       {Name: "Invalid Name", Type: repository.ProfileAttributeTypeString},
+			"type":       {Name: "attr_type", Type: "date"},
+			"visibility": {Name: "attr_visibility", Type: repository.ProfileAttributeTypeString, Visibility: "friends"},
+			"pattern":    {Name: "attr_pattern", Type: repository.ProfileAttributeTypeString, Pattern: "[a-"},
+			"number":     {Name: "attr_number", Type: repository.ProfileAttributeTypeNumber, Pattern: "[0-9]+"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				err := s.profileAttributeService.CreateDefinition(s.Ctx, admin, &definition)
+				require.IsType(t, errors.BadParameterError{}, err)
+			})
+		}
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		// when
+		err := s.profileAttributeService.CreateDefinition(s.Ctx, g.CreateUser().IdentityID(), &repository.ProfileAttributeDefinition{
+			Name: "attr_" + uuid.NewV4().String()[:8],
+			Type: repository.ProfileAttributeTypeString,
+		})
+		// then
+		require.IsType(t, errors.ForbiddenError{}, err)
+	})
+}
+
+func (s *profileAttributeServiceBlackBoxTest) TestUpdateDefinition() {
+
+	s.T().Run("visibility is propagated to the values", func(t *testing.T) {
+		// given
+		admin := s.newAdmin(t)
+		definition := s.newDefinition(t, repository.ProfileAttributeTypeString, account.ProfileAttributeVisibilityPrivate, true)
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		_, err := s.profileAttributeService.UpdateAttributes(s.Ctx, user.IdentityID(), user.IdentityID(), map[string]interface{}{definition.Name: "value"})
+		require.NoError(t, err)
+		visibility := account.ProfileAttributeVisibilityPublic
+		// when
+		updated, err := s.profileAttributeService.UpdateDefinition(s.Ctx, admin, definition.Name, nil, nil, &visibility, nil)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, account.ProfileAttributeVisibilityPublic, updated.Visibility)
+		assert.True(t, updated.EditableByUser)
+		loaded, err := s.Application.Users().Load(s.Ctx, user.User().ID)
+		require.NoError(t, err)
+		assert.Equal(t, account.ProfileAttribute{Value: "value", Visibility: account.ProfileAttributeVisibilityPublic}, loaded.ProfileAttributes[definition.Name])
+	})
+
+	s.T().Run("not found", func(t *testing.T) {
+		description := "unknown"
+		_, err := s.profileAttributeService.UpdateDefinition(s.Ctx, s.newAdmin(t), "unknown_attribute", &description, nil, nil, nil)
+		require.IsType(t, errors.NotFoundError{}, err)
+	})
+}
+
+func (s *profileAttributeServiceBlackBoxTest) TestDeleteDefinition() {
+	// given
+	admin := s.newAdmin(s.T())
+	definition := s.newDefinition(s.T(), repository.ProfileAttributeTypeBoolean, account.ProfileAttributeVisibilityPublic, true)
+	g := s.NewTestGraph(s.T())
+	user := g.CreateUser()
+	_, err := s.profileAttributeService.UpdateAttributes(s.Ctx, user.IdentityID(), user.IdentityID(), map[string]interface{}{definition.Name: true})
+	require.NoError(s.T(), err)
+	// when
+	err = s.profileAttributeService.DeleteDefinition(s.Ctx, admin, definition.Name)
+	// then
+	require.NoError(s.T(), err)
+	loaded, err := s.Application.Users().Load(s.Ctx, user.User().ID)
+	require.NoError(s.T(), err)
+	assert.NotContains(s.T(), loaded.ProfileAttributes, definition.Name)
+	_, err = s.Application.ProfileAttributeDefinitions().LoadByName(s.Ctx, definition.Name)
+	require.IsType(s.T(), errors.NotFoundError{}, err)
+}
+
+func (s *profileAttributeServiceBlackBoxTest) TestUpdateAttributes() {
+	str := s.newDefinition(s.T(), repository.ProfileAttributeTypeString, account.ProfileAttributeVisibilityPublic, true)
+	number := s.newDefinition(s.T(), repository.ProfileAttributeTypeNumber, account.ProfileAttributeVisibilityPrivate, true)
+	website := s.newDefinition(s.T(), repository.ProfileAttributeTypeURL, account.ProfileAttributeVisibilityPublic, true)
+	restricted := s.newDefinition(s.T(), repository.ProfileAttributeTypeString, account.ProfileAttributeVisibilityService, false)
+
+	s.T().Run("by the user", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		// when
+		identity, err := s.profileAttributeService.UpdateAttributes(s.Ctx, user.IdentityID(), user.IdentityID(), map[string]interface{}{
+			str.Name:     "value",
+			number.Name:  42,
+			website.Name: "https://example.com",
+		})
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, account.ProfileAttributes{
+			str.Name:     {Value: "value", Visibility: account.ProfileAttributeVisibilityPublic},
+			number.Name:  {Value: float64(42), Visibility: account.ProfileAttributeVisibilityPrivate},
+			website.Name: {Value: "https://example.com", Visibility: account.ProfileAttributeVisibilityPublic},
+		}, identity.User.ProfileAttributes)
+		loaded, err := s.Application.Users().Load(s.Ctx, user.User().ID)
+		require.NoError(t, err)
+		assert.Equal(t, identity.User.ProfileAttributes, loaded.ProfileAttributes)
+
+		t.Run("remove", func(t *testing.T) {
+			// when
+			identity, err := s.profileAttributeService.UpdateAttributes(s.Ctx, user.IdentityID(), user.IdentityID(), map[string]interface{}{str.Name: nil})
+			// then
+			require.NoError(t, err)
+			assert.NotContains(t, identity.User.ProfileAttributes, str.Name)
+			assert.Contains(t, identity.User.ProfileAttributes, number.Name)
+		})
+	})
+
+	s.T().Run("not editable by the user", func(t *testing.T) {
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		_, err := s.profileAttributeService.UpdateAttributes(s.Ctx, user.IdentityID(), user.IdentityID(), map[string]interface{}{restricted.Name: "value"})
+		require.IsType(t, errors.ForbiddenError{}, err)
+	})
+
+	s.T().Run("by an administrator", func(t *testing.T) {
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		identity, err := s.profileAttributeService.UpdateAttributes(s.Ctx, s.newAdmin(t), user.IdentityID(), map[string]interface{}{restricted.Name: "value"})
+		require.NoError(t, err)
+		assert.Equal(t, account.ProfileAttribute{Value: "value", Visibility: account.ProfileAttributeVisibilityService}, identity.User.ProfileAttributes[restricted.Name])
+	})
+
+	s.T().Run("other user forbidden", func(t *testing.T) {
+		g := s.NewTestGraph(t)
+		_, err := s.profileAttributeService.UpdateAttributes(s.Ctx, g.CreateUser().IdentityID(), g.CreateUser().IdentityID(), map[string]interface{}{str.Name: "value"})
+		require.IsType(t, errors.ForbiddenError{}, err)
+	})
+
+	s.T().Run("invalid values", func(t *testing.T) {
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		for name, values := range map[string]map[string]interface{}{
+			"unknown": {"unknown_attribute": "value"},
+			"string":  {str.Name: 42},
+			"number":  {number.Name: "42"},
+			"url":     {website.Name: "example.com"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := s.profileAttributeService.UpdateAttributes(s.Ctx, user.IdentityID(), user.IdentityID(), values)
+				require.IsType(t, errors.BadParameterError{}, err)
+			})
+		}
+	})
+}
+
+func (s *profileAttributeServiceBlackBoxTest) TestParseProfileAttributeValue() {
+	pattern := repository.ProfileAttributeDefinition{Name: "code", Type: repository.ProfileAttributeTypeString, Pattern: "^[A-Z]{3}$"}
+	number := repository.ProfileAttributeDefinition{Name: "level", Type: repository.ProfileAttributeTypeNumber}
+	boolean := repository.ProfileAttributeDefinition{Name: "verified", Type: repository.ProfileAttributeTypeBoolean}
+
+	value, err := accountservice.ParseProfileAttributeValue(pattern, "ABC")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "ABC", value)
+	_, err = accountservice.ParseProfileAttributeValue(pattern, "abc")
+	require.IsType(s.T(), errors.BadParameterError{}, err)
+	value, err = accountservice.ParseProfileAttributeValue(number, "1.5")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 1.5, value)
+	value, err = accountservice.ParseProfileAttributeValue(boolean, "true")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), true, value)
+	_, err = accountservice.ParseProfileAttributeValue(boolean, "maybe")
+	require.IsType(s.T(), errors.BadParameterError{}, err)
+}
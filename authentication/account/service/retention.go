@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/application/service"
+	"github.com/fabric8-services/fabric8-auth/application/service/base"
+	servicecontext "github.com/fabric8-services/fabric8-auth/application/service/context"
+	"github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+)
+
+// NewRetentionService creates a new service to purge the data kept beyond its retention period
+func NewRetentionService(ctx servicecontext.ServiceContext) service.RetentionService {
+	return &retentionServiceImpl{
+		BaseService: base.NewBaseService(ctx),
+	}
+}
+
+// retentionServiceImpl implements the RetentionService
+type retentionServiceImpl struct {
+	base.BaseService
+}
+
+// PurgeUsers hard deletes at most `limit` users which were deleted before `deletedBefore` or deprovisioned and not
+// updated since `deprovisionedBefore`, using the same path as UserService.HardDeleteUser. Each user is deleted in its
+// own transaction, so that a user which cannot be deleted doesn't prevent the others from being purged.
+func (s *retentionServiceImpl) PurgeUsers(ctx context.Context, deletedBefore, deprovisionedBefore time.Time, limit int) (int, error) {
+	var users []repository.User
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		users, err = s.Repositories().Users().Query(
+			func(db *gorm.DB) *gorm.DB {
+				return db.Unscoped()
+			},
+			repository.UserFilterPurgeable(deletedBefore, deprovisionedBefore),
+			func(db *gorm.DB) *gorm.DB {
+				return db.Order("updated_at").Limit(limit)
+			})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	var lastErr error
+	for _, user := range users {
+		err := s.Services().UserService().HardDeleteUser(ctx, repository.Identity{User: user})
+		if err != nil {
+			log.Error(ctx, map[string]interface{}{
+				"user_id": user.ID,
+				"err":     err,
+			}, "unable to purge the user")
+			lastErr = err
+			continue
+		}
+		log.Info(ctx, map[string]interface{}{
+			"user_id":       user.ID,
+			"deleted_at":    user.DeletedAt,
+			"deprovisioned": user.Deprovisioned,
+		}, "user purged")
+		purged++
+	}
+	if lastErr != nil {
+		return purged, errs.Wrapf(lastErr, "failed to purge %d user(s)", len(users)-purged)
+	}
+	return purged, nil
+}
+
+// PurgeExternalTokens deletes the external tokens which are linked to no identity or to an identity deleted before
+// the given time
+func (s *retentionServiceImpl) PurgeExternalTokens(ctx context.Context, deletedBefore time.Time) (int, error) {
+	var purged int64
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		purged, err = s.Repositories().ExternalTokens().DeleteOrphaned(ctx, deletedBefore)
+		return err
+	})
+	return int(purged), err
+}
+
+// PurgeVerificationCodes deletes the verification codes which were created or used before the given time, and the
+// codes of the deleted users
+func (s *retentionServiceImpl) PurgeVerificationCodes(ctx context.Context, createdBefore time.Time) (int, error) {
+	var purged int64
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		purged, err = s.Repositories().VerificationCodes().DeleteStale(ctx, createdBefore)
+		return err
+	})
+	return int(purged), err
+}
+
+// PurgeOAuthStates deletes the OAuth state references which were created before the given time
+func (s *retentionServiceImpl) PurgeOAuthStates(ctx context.Context, createdBefore time.Time) (int, error) {
+	var purged int64
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		purged, err = s.Repositories().OauthStates().DeleteExpired(ctx, createdBefore)
+		return err
+	})
+	return int(purged), err
+}
+
+// PurgePrivilegeCaches deletes the privilege caches which expired before the given time
+func (s *retentionServiceImpl) PurgePrivilegeCaches(ctx context.Context, expiredBefore time.Time) (int, error) {
+	var purged int64
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		purged, err = s.Repositories().PrivilegeCacheRepository().DeleteExpired(ctx, expiredBefore)
+		return err
+	})
+	return int(purged), err
+}
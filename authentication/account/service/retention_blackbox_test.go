@@ -0,0 +1,314 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	accountservice "github.com/fabric8-services/fabric8-auth/authentication/account/service"
+	providerrepo "github.com/fabric8-services/fabric8-auth/authentication/provider/repository"
+	permission "github.com/fabric8-services/fabric8-auth/authorization/permission/repository"
+	tokenrepo "github.com/fabric8-services/fabric8-auth/authorization/token/repository"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type retentionServiceBlackboxTestSuite struct {
+	gormtestsupport.DBTestSuite
+}
+
+func TestRetentionService(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &retentionServiceBlackboxTestSuite{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func includeSoftDeletes(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// deleteUser soft deletes the user of the given identity and the identity at the given time
+func (s *retentionServiceBlackboxTestSuite) deleteUser(t *testing.T, identity *repository.Identity, deletedAt time.Time) {
+	err := s.DB.Exec("UPDATE users SET deleted_at = ? WHERE id = ?", deletedAt, identity.User.ID).Error
+	require.NoError(t, err)
+	err = s.DB.Exec("UPDATE identities SET deleted_at = ? WHERE id = ?", deletedAt, identity.ID).Error
+	require.NoError(t, err)
+}
+
+// deprovisionUser deprovisions the user of the given identity and sets its last update time
+func (s *retentionServiceBlackboxTestSuite) deprovisionUser(t *testing.T, identity *repository.Identity, updatedAt time.Time) {
+	err := s.DB.Exec("UPDATE users SET deprovisioned = true, updated_at = ? WHERE id = ?", updatedAt, identity.User.ID).Error
+	require.NoError(t, err)
+}
+
+// userExists returns true if the user or the identity still exist, even soft deleted
+func (s *retentionServiceBlackboxTestSuite) userExists(identity *repository.Identity) bool {
+	_, err := s.Application.Users().Load(s.Ctx, identity.User.ID, includeSoftDeletes)
+	if err == nil {
+		return true
+	}
+	_, err = s.Application.Identities().Load(s.Ctx, identity.ID, includeSoftDeletes)
+	return err == nil
+}
+
+func (s *retentionServiceBlackboxTestSuite) TestPurgeUsers() {
+	now := time.Now()
+	deletedBefore := now.Add(-30 * 24 * time.Hour)
+	deprovisionedBefore := now.Add(-90 * 24 * time.Hour)
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		deleted := g.CreateUser()
+		s.deleteUser(t, deleted.Identity(), deletedBefore.Add(-time.Hour))
+		recentlyDeleted := g.CreateUser()
+		s.deleteUser(t, recentlyDeleted.Identity(), deletedBefore.Add(time.Hour))
+		deprovisioned := g.CreateUser()
+		s.deprovisionUser(t, deprovisioned.Identity(), deprovisionedBefore.Add(-time.Hour))
+		recentlyDeprovisioned := g.CreateUser()
+		s.deprovisionUser(t, recentlyDeprovisioned.Identity(), deprovisionedBefore.Add(time.Hour))
+		active := g.CreateUser()
+		// when
+		purged, err := s.Application.RetentionService().PurgeUsers(s.Ctx, deletedBefore, deprovisionedBefore, 1000)
+		// then
+		require.NoError(t, err)
+		assert.True(t, purged >= 2)
+		assert.False(t, s.userExists(deleted.Identity()))
+		assert.False(t, s.userExists(deprovisioned.Identity()))
+		assert.True(t, s.userExists(recentlyDeleted.Identity()))
+		assert.True(t, s.userExists(recentlyDeprovisioned.Identity()))
+		assert.True(t, s.userExists(active.Identity()))
+	})
+
+	s.T().Run("user with associated data", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		g.CreateOrganization().AddMember(user)
+		g.CreateSpace().AddAdmin(user)
+		g.CreateInvitation(user, g.CreateTeam())
+		token := g.CreateToken(user)
+		cache := &permission.PrivilegeCache{
+			IdentityID: user.IdentityID(),
+			ResourceID: g.CreateResource().ResourceID(),
+			ExpiryTime: now.Add(time.Hour),
+		}
+		require.NoError(t, s.Application.PrivilegeCacheRepository().Create(s.Ctx, cache))
+		externalToken := &tokenrepo.ExternalToken{
+			ProviderID: uuid.NewV4(),
+			Token:      uuid.NewV4().String(),
+			IdentityID: user.IdentityID(),
+		}
+		require.NoError(t, s.Application.ExternalTokens().Create(s.Ctx, externalToken))
+		code := &repository.VerificationCode{User: *user.User(), Code: uuid.NewV4().String()}
+		require.NoError(t, s.Application.VerificationCodes().Create(s.Ctx, code))
+		s.deleteUser(t, user.Identity(), deletedBefore.Add(-time.Hour))
+		// when
+		_, err := s.Application.RetentionService().PurgeUsers(s.Ctx, deletedBefore, time.Time{}, 1000)
+		// then
+		require.NoError(t, err)
+		assert.False(t, s.userExists(user.Identity()))
+		_, err = s.Application.TokenRepository().Load(s.Ctx, token.TokenID())
+		assert.Error(t, err)
+		_, err = s.Application.PrivilegeCacheRepository().Load(s.Ctx, cache.PrivilegeCacheID)
+		assert.Error(t, err)
+		_, err = s.Application.ExternalTokens().Load(s.Ctx, externalToken.ID)
+		assert.Error(t, err)
+		_, err = s.Application.VerificationCodes().Load(s.Ctx, code.ID)
+		assert.Error(t, err)
+		var memberships int
+		err = s.DB.Table("membership").Where("member_id = ?", user.IdentityID()).Count(&memberships).Error
+		require.NoError(t, err)
+		assert.Equal(t, 0, memberships)
+		invitations, err := s.Application.InvitationRepository().ListForInvitee(s.Ctx, user.IdentityID())
+		require.NoError(t, err)
+		assert.Empty(t, invitations)
+		roles, err := s.Application.IdentityRoleRepository().FindIdentityRolesForIdentity(s.Ctx, user.IdentityID(), nil)
+		require.NoError(t, err)
+		assert.Empty(t, roles)
+	})
+
+	s.T().Run("limit", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		s.deleteUser(t, g.CreateUser().Identity(), deletedBefore.Add(-time.Hour))
+		s.deleteUser(t, g.CreateUser().Identity(), deletedBefore.Add(-time.Hour))
+		// when
+		purged, err := s.Application.RetentionService().PurgeUsers(s.Ctx, deletedBefore, time.Time{}, 1)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, purged)
+	})
+
+	s.T().Run("disabled", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		deleted := g.CreateUser()
+		s.deleteUser(t, deleted.Identity(), deletedBefore.Add(-time.Hour))
+		// when
+		_, err := s.Application.RetentionService().PurgeUsers(s.Ctx, time.Time{}, time.Time{}, 1000)
+		// then
+		require.NoError(t, err)
+		assert.True(t, s.userExists(deleted.Identity()))
+	})
+}
+
+func (s *retentionServiceBlackboxTestSuite) TestPurgeExternalTokens() {
+	// given
+	now := time.Now()
+	deleted := s.Graph.CreateUser()
+	s.deleteUser(s.T(), deleted.Identity(), now.Add(-2*time.Hour))
+	active := s.Graph.CreateUser()
+	orphaned := &tokenrepo.ExternalToken{ProviderID: uuid.NewV4(), Token: uuid.NewV4().String(), IdentityID: deleted.IdentityID()}
+	require.NoError(s.T(), s.Application.ExternalTokens().Create(s.Ctx, orphaned))
+	kept := &tokenrepo.ExternalToken{ProviderID: uuid.NewV4(), Token: uuid.NewV4().String(), IdentityID: active.IdentityID()}
+	require.NoError(s.T(), s.Application.ExternalTokens().Create(s.Ctx, kept))
+	// when
+	purged, err := s.Application.RetentionService().PurgeExternalTokens(s.Ctx, now.Add(-time.Hour))
+	// then
+	require.NoError(s.T(), err)
+	assert.True(s.T(), purged >= 1)
+	_, err = s.Application.ExternalTokens().Load(s.Ctx, orphaned.ID)
+	assert.Error(s.T(), err)
+	_, err = s.Application.ExternalTokens().Load(s.Ctx, kept.ID)
+	assert.NoError(s.T(), err)
+}
+
+func (s *retentionServiceBlackboxTestSuite) TestPurgeVerificationCodes() {
+	// given
+	now := time.Now()
+	user := s.Graph.CreateUser()
+	old := &repository.VerificationCode{
+		Lifecycle: gormsupport.Lifecycle{CreatedAt: now.Add(-48 * time.Hour)},
+		User:      *user.User(),
+		Code:      uuid.NewV4().String(),
+	}
+	require.NoError(s.T(), s.Application.VerificationCodes().Create(s.Ctx, old))
+	recent := &repository.VerificationCode{User: *user.User(), Code: uuid.NewV4().String()}
+	require.NoError(s.T(), s.Application.VerificationCodes().Create(s.Ctx, recent))
+	// when
+	purged, err := s.Application.RetentionService().PurgeVerificationCodes(s.Ctx, now.Add(-24*time.Hour))
+	// then
+	require.NoError(s.T(), err)
+	assert.True(s.T(), purged >= 1)
+	_, err = s.Application.VerificationCodes().Load(s.Ctx, old.ID)
+	assert.Error(s.T(), err)
+	_, err = s.Application.VerificationCodes().Load(s.Ctx, recent.ID)
+	assert.NoError(s.T(), err)
+}
+
+func (s *retentionServiceBlackboxTestSuite) TestPurgeOAuthStates() {
+	// given
+	now := time.Now()
+	old, err := s.Application.OauthStates().Create(s.Ctx, &providerrepo.OauthStateReference{
+		Lifecycle: gormsupport.Lifecycle{CreatedAt: now.Add(-48 * time.Hour)},
+		State:     uuid.NewV4().String(),
+		Referrer:  "https://example.com",
+	})
+	require.NoError(s.T(), err)
+	recent, err := s.Application.OauthStates().Create(s.Ctx, &providerrepo.OauthStateReference{
+		State:    uuid.NewV4().String(),
+		Referrer: "https://example.com",
+	})
+	require.NoError(s.T(), err)
+	// when
+	purged, err := s.Application.RetentionService().PurgeOAuthStates(s.Ctx, now.Add(-24*time.Hour))
+	// then
+	require.NoError(s.T(), err)
+	assert.True(s.T(), purged >= 1)
+	_, err = s.Application.OauthStates().Load(s.Ctx, old.State)
+	assert.Error(s.T(), err)
+	_, err = s.Application.OauthStates().Load(s.Ctx, recent.State)
+	assert.NoError(s.T(), err)
+}
+
+func (s *retentionServiceBlackboxTestSuite) TestPurgePrivilegeCaches() {
+	// given
+	now := time.Now()
+	user := s.Graph.CreateUser()
+	expired := &permission.PrivilegeCache{
+		IdentityID: user.IdentityID(),
+		ResourceID: s.Graph.CreateResource().ResourceID(),
+		ExpiryTime: now.Add(-48 * time.Hour),
+	}
+	require.NoError(s.T(), s.Application.PrivilegeCacheRepository().Create(s.Ctx, expired))
+	valid := &permission.PrivilegeCache{
+		IdentityID: user.IdentityID(),
+		ResourceID: s.Graph.CreateResource().ResourceID(),
+		ExpiryTime: now.Add(time.Hour),
+	}
+	require.NoError(s.T(), s.Application.PrivilegeCacheRepository().Create(s.Ctx, valid))
+	// when
+	purged, err := s.Application.RetentionService().PurgePrivilegeCaches(s.Ctx, now.Add(-24*time.Hour))
+	// then
+	require.NoError(s.T(), err)
+	assert.True(s.T(), purged >= 1)
+	_, err = s.Application.PrivilegeCacheRepository().Load(s.Ctx, expired.PrivilegeCacheID)
+	assert.Error(s.T(), err)
+	_, err = s.Application.PrivilegeCacheRepository().Load(s.Ctx, valid.PrivilegeCacheID)
+	assert.NoError(s.T(), err)
+}
+
+type retentionWorkerConfig struct {
+	deletedUserGracePeriod    time.Duration
+	privilegeCacheGracePeriod time.Duration
+}
+
+func (c retentionWorkerConfig) GetRetentionInterval() time.Duration {
+	return time.Hour
+}
+
+func (c retentionWorkerConfig) GetRetentionBatchSize() int {
+	return 1000
+}
+
+func (c retentionWorkerConfig) GetRetentionDeletedUserGracePeriod() time.Duration {
+	return c.deletedUserGracePeriod
+}
+
+func (c retentionWorkerConfig) GetRetentionDeprovisionedUserGracePeriod() time.Duration {
+	return 0
+}
+
+func (c retentionWorkerConfig) GetRetentionExternalTokenGracePeriod() time.Duration {
+	return 0
+}
+
+func (c retentionWorkerConfig) GetRetentionVerificationCodeGracePeriod() time.Duration {
+	return 0
+}
+
+func (c retentionWorkerConfig) GetRetentionOAuthStateGracePeriod() time.Duration {
+	return 0
+}
+
+func (c retentionWorkerConfig) GetRetentionPrivilegeCacheGracePeriod() time.Duration {
+	return c.privilegeCacheGracePeriod
+}
+
+func (s *retentionServiceBlackboxTestSuite) TestWorkerPurge() {
+	// given
+	now := time.Now()
+	deleted := s.Graph.CreateUser()
+	s.deleteUser(s.T(), deleted.Identity(), now.Add(-48*time.Hour))
+	expired := &permission.PrivilegeCache{
+		IdentityID: s.Graph.CreateUser().IdentityID(),
+		ResourceID: s.Graph.CreateResource().ResourceID(),
+		ExpiryTime: now.Add(-48 * time.Hour),
+	}
+	require.NoError(s.T(), s.Application.PrivilegeCacheRepository().Create(s.Ctx, expired))
+	// the privilege caches are not purged, as their grace period is zero
+	worker := accountservice.NewRetentionWorker(s.Application.RetentionService(), retentionWorkerConfig{deletedUserGracePeriod: 24 * time.Hour})
+	// when
+	worker.Purge(s.Ctx)
+	// then
+	assert.False(s.T(), s.userExists(deleted.Identity()))
+	_, err := s.Application.PrivilegeCacheRepository().Load(s.Ctx, expired.PrivilegeCacheID)
+	assert.NoError(s.T(), err)
+}
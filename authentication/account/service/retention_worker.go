@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/application/service"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type retentionWorkerConfig interface {
+	GetRetentionInterval() time.Duration
+	GetRetentionBatchSize() int
+	GetRetentionDeletedUserGracePeriod() time.Duration
+	GetRetentionDeprovisionedUserGracePeriod() time.Duration
+	GetRetentionExternalTokenGracePeriod() time.Duration
+	GetRetentionVerificationCodeGracePeriod() time.Duration
+	GetRetentionOAuthStateGracePeriod() time.Duration
+	GetRetentionPrivilegeCacheGracePeriod() time.Duration
+}
+
+// the entity types reported in the metrics of the retention worker
+const (
+	retentionEntityUser             = "user"
+	retentionEntityExternalToken    = "external_token"
+	retentionEntityVerificationCode = "verification_code"
+	retentionEntityOAuthState       = "oauth_state"
+	retentionEntityPrivilegeCache   = "privilege_cache"
+)
+
+var (
+	retentionPurgedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "auth",
+		Subsystem: "retention",
+		Name:      "purged_total",
+		Help:      "Number of entities purged by the retention worker.",
+	}, []string{"entity"})
+	retentionFailuresCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "auth",
+		Subsystem: "retention",
+		Name:      "failures_total",
+		Help:      "Number of failed purges of the retention worker.",
+	}, []string{"entity"})
+	retentionLastRunGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "auth",
+		Subsystem: "retention",
+		Name:      "last_run_timestamp_seconds",
+		Help:      "Time of the last run of the retention worker, in seconds since the epoch.",
+	})
+	retentionLastRunDurationGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "auth",
+		Subsystem: "retention",
+		Name:      "last_run_duration_seconds",
+		Help:      "Duration of the last run of the retention worker, in seconds.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(retentionPurgedCounter)
+	prometheus.MustRegister(retentionFailuresCounter)
+	prometheus.MustRegister(retentionLastRunGauge)
+	prometheus.MustRegister(retentionLastRunDurationGauge)
+}
+
+// RetentionWorker periodically purges the data kept beyond the grace period configured for its entity type, and
+// reports the number of purged entities and of failures through the Prometheus metrics
+type RetentionWorker struct {
+	config           retentionWorkerConfig
+	retentionService service.RetentionService
+	ticker           *time.Ticker
+	stopCh           chan bool
+}
+
+// NewRetentionWorker returns a new retention worker
+func NewRetentionWorker(retentionService service.RetentionService, config retentionWorkerConfig) *RetentionWorker {
+	return &RetentionWorker{
+		config:           config,
+		retentionService: retentionService,
+	}
+}
+
+// Start initializes the regular purges
+func (w *RetentionWorker) Start() {
+	w.ticker = time.NewTicker(w.config.GetRetentionInterval())
+	w.stopCh = make(chan bool, 1)
+	go func() {
+		defer log.Info(nil, map[string]interface{}{}, "retention worker stopped")
+		log.Info(nil, map[string]interface{}{"interval": w.config.GetRetentionInterval()}, "retention worker started")
+		for {
+			select {
+			case <-w.ticker.C:
+				w.Purge(context.Background())
+			case <-w.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the purges
+func (w *RetentionWorker) Stop() {
+	if w.stopCh != nil {
+		w.ticker.Stop()
+		w.stopCh <- true
+	}
+}
+
+// Purge purges the data of all the entity types whose grace period is not zero. A failed purge doesn't prevent the
+// other entity types from being purged, and is retried during the next run.
+func (w *RetentionWorker) Purge(ctx context.Context) {
+	start := time.Now()
+	deletedUserGracePeriod := w.config.GetRetentionDeletedUserGracePeriod()
+	deprovisionedUserGracePeriod := w.config.GetRetentionDeprovisionedUserGracePeriod()
+	if deletedUserGracePeriod > 0 || deprovisionedUserGracePeriod > 0 {
+		w.purge(ctx, retentionEntityUser, func() (int, error) {
+			return w.retentionService.PurgeUsers(ctx, retentionCutoff(start, deletedUserGracePeriod), retentionCutoff(start, deprovisionedUserGracePeriod), w.config.GetRetentionBatchSize())
+		})
+	}
+	if gracePeriod := w.config.GetRetentionExternalTokenGracePeriod(); gracePeriod > 0 {
+		w.purge(ctx, retentionEntityExternalToken, func() (int, error) {
+			return w.retentionService.PurgeExternalTokens(ctx, start.Add(-gracePeriod))
+		})
+	}
+	if gracePeriod := w.config.GetRetentionVerificationCodeGracePeriod(); gracePeriod > 0 {
+		w.purge(ctx, retentionEntityVerificationCode, func() (int, error) {
+			return w.retentionService.PurgeVerificationCodes(ctx, start.Add(-gracePeriod))
+		})
+	}
+	if gracePeriod := w.config.GetRetentionOAuthStateGracePeriod(); gracePeriod > 0 {
+		w.purge(ctx, retentionEntityOAuthState, func() (int, error) {
+			return w.retentionService.PurgeOAuthStates(ctx, start.Add(-gracePeriod))
+		})
+	}
+	if gracePeriod := w.config.GetRetentionPrivilegeCacheGracePeriod(); gracePeriod > 0 {
+		w.purge(ctx, retentionEntityPrivilegeCache, func() (int, error) {
+			return w.retentionService.PurgePrivilegeCaches(ctx, start.Add(-gracePeriod))
+		})
+	}
+	retentionLastRunGauge.Set(float64(start.Unix()))
+	retentionLastRunDurationGauge.Set(time.Since(start).Seconds())
+}
+
+// purge runs the given purge of the given entity type and records its outcome in the metrics
+func (w *RetentionWorker) purge(ctx context.Context, entity string, purgeFunc func() (int, error)) {
+	purged, err := purgeFunc()
+	retentionPurgedCounter.WithLabelValues(entity).Add(float64(purged))
+	if err != nil {
+		retentionFailuresCounter.WithLabelValues(entity).Inc()
+		log.Error(ctx, map[string]interface{}{
+			"entity": entity,
+			"purged": purged,
+			"err":    err,
+		}, "failed to purge the data kept beyond its retention period")
+		return
+	}
+	log.Info(ctx, map[string]interface{}{
+		"entity": entity,
+		"purged": purged,
+	}, "purged the data kept beyond its retention period")
+}
+
+// retentionCutoff returns the time before which the data is purged, or the zero time, which matches no data, if the
+// grace period is zero
+func retentionCutoff(now time.Time, gracePeriod time.Duration) time.Time {
+	if gracePeriod <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-gracePeriod)
+}
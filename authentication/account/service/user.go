@@ -3,29 +3,47 @@ package service
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/fabric8-services/fabric8-auth/app"
+	apprepository "github.com/fabric8-services/fabric8-auth/application/repository"
 	"github.com/fabric8-services/fabric8-auth/application/service"
 	"github.com/fabric8-services/fabric8-auth/application/service/base"
 	servicecontext "github.com/fabric8-services/fabric8-auth/application/service/context"
+	"github.com/fabric8-services/fabric8-auth/authentication/account"
 	"github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	rolerepo "github.com/fabric8-services/fabric8-auth/authorization/role/repository"
+	"github.com/fabric8-services/fabric8-auth/authorization/token"
 	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
+	tokenrepo "github.com/fabric8-services/fabric8-auth/authorization/token/repository"
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/notification"
 
+	goajwt "github.com/goadesign/goa/middleware/security/jwt"
 	"github.com/jinzhu/gorm"
 	"github.com/satori/go.uuid"
 )
 
+// UserServiceConfiguration the configuration of the user service
+type UserServiceConfiguration interface {
+	GetUserDeletionCoolingOffPeriod() time.Duration
+	GetUsernameQuarantinePeriod() time.Duration
+}
+
 // NewUserService creates a new service to manage users
-func NewUserService(ctx servicecontext.ServiceContext) service.UserService {
+func NewUserService(ctx servicecontext.ServiceContext, config UserServiceConfiguration) service.UserService {
 	return &userServiceImpl{
 		BaseService: base.NewBaseService(ctx),
+		config:      config,
 	}
 }
 
 // userServiceImpl implements the UserService to manage users
 type userServiceImpl struct {
 	base.BaseService
+	config UserServiceConfiguration
 }
 
 // ResetDeprovisioned sets User.Deprovisioned to false
@@ -51,6 +69,36 @@ func (s *userServiceImpl) IdentityByUsernameAndEmail(ctx context.Context, userna
 	return nil, nil
 }
 
+// ClaimUsername sets the username of the given identity, which is either a new identity or an identity being renamed.
+// The username must not have been released by another identity during the quarantine period. The previous username of
+// a renamed identity is recorded in the username history, so that it still resolves to the identity.
+// The given repositories are the ones of the transaction in which the identity is saved by the caller.
+// Returns BadParameterError if the username is quarantined
+func (s *userServiceImpl) ClaimUsername(ctx context.Context, repositories apprepository.Repositories, identity *repository.Identity, username string) error {
+	if username == identity.Username {
+		return nil
+	}
+	quarantined, err := repositories.UsernameHistory().IsQuarantined(ctx, username, identity.ID, time.Now().Add(-s.config.GetUsernameQuarantinePeriod()))
+	if err != nil {
+		return err
+	}
+	if quarantined {
+		return errors.NewBadParameterErrorFromString("username", username, "the username was recently released by another user")
+	}
+	// keep the previous username, so that it can still be resolved to this identity
+	if identity.Username != "" {
+		err = repositories.UsernameHistory().Create(ctx, &repository.UsernameHistory{
+			IdentityID: identity.ID,
+			Username:   identity.Username,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	identity.Username = username
+	return nil
+}
+
 // UserInfo gets user information given a context containing access_token
 func (s *userServiceImpl) UserInfo(ctx context.Context, identityID uuid.UUID) (*repository.User, *repository.Identity, error) {
 	var identity *repository.Identity
@@ -149,18 +197,510 @@ func (s *userServiceImpl) LoadContextIdentityIfNotDeprovisioned(ctx context.Cont
 	return identity, err
 }
 
+// RequestDeletion schedules the deletion of the account of the current user at the end of the cooling-off period,
+// during which the deletion can be cancelled with CancelDeletion. All the tokens of the current identity are revoked
+// and the user is notified. Requesting again the deletion of an account keeps the original schedule.
+func (s *userServiceImpl) RequestDeletion(ctx context.Context) (*repository.Identity, error) {
+	identity, err := s.LoadContextIdentityIfNotDeprovisioned(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scheduled := identity.User.DeletionScheduledAt == nil
+	if scheduled {
+		deletionScheduledAt := time.Now().Add(s.config.GetUserDeletionCoolingOffPeriod())
+		identity.User.DeletionScheduledAt = &deletionScheduledAt
+		err = s.ExecuteInTransaction(func() error {
+			return s.Repositories().Users().Save(ctx, &identity.User)
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Info(ctx, map[string]interface{}{
+			"identity_id":           identity.ID,
+			"deletion_scheduled_at": deletionScheduledAt,
+		}, "deletion of the user scheduled")
+	}
+
+	tkn := goajwt.ContextJWT(ctx)
+	if tkn != nil {
+		err = s.Services().TokenService().SetStatusForAllIdentityTokens(ctx, tkn, token.TOKEN_STATUS_REVOKED)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if scheduled {
+		msg := notification.NewUserDeletionScheduled(identity.ID.String(), *identity.User.DeletionScheduledAt)
+		_, err = s.Services().NotificationService().SendMessageAsync(ctx, msg)
+		if err != nil {
+			log.Error(ctx, map[string]interface{}{
+				"identity_id": identity.ID,
+				"err":         err,
+			}, "unable to send the notification of the scheduled deletion of the user")
+		}
+	}
+	return identity, nil
+}
+
+// CancelDeletion cancels the scheduled deletion of the account of the current user.
+// Returns NotFoundError if the deletion of the account was not requested.
+func (s *userServiceImpl) CancelDeletion(ctx context.Context) (*repository.Identity, error) {
+	identity, err := s.LoadContextIdentityIfNotDeprovisioned(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if identity.User.DeletionScheduledAt == nil {
+		return nil, errors.NewNotFoundErrorFromString(fmt.Sprintf("no deletion scheduled for the user with identity '%s'", identity.ID))
+	}
+	identity.User.DeletionScheduledAt = nil
+	err = s.ExecuteInTransaction(func() error {
+		return s.Repositories().Users().Save(ctx, &identity.User)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Info(ctx, map[string]interface{}{
+		"identity_id": identity.ID,
+	}, "deletion of the user cancelled")
+	return identity, nil
+}
+
+// ListUsersDueForDeletion returns at most `limit` users whose cooling-off period is over, with their identity of the
+// default identity provider if any, in the order in which their deletion was scheduled
+func (s *userServiceImpl) ListUsersDueForDeletion(ctx context.Context, limit int) ([]repository.Identity, error) {
+	result := []repository.Identity{}
+	err := s.ExecuteInTransaction(func() error {
+		users, err := s.Repositories().Users().Query(
+			repository.UserFilterDeletionDue(time.Now()),
+			func(db *gorm.DB) *gorm.DB {
+				return db.Order("deletion_scheduled_at").Limit(limit)
+			})
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			identities, err := s.Repositories().Identities().Query(
+				repository.IdentityFilterByUserID(user.ID),
+				repository.IdentityFilterByProviderType(repository.DefaultIDP))
+			if err != nil {
+				return err
+			}
+			identity := repository.Identity{}
+			if len(identities) > 0 {
+				identity = identities[0]
+			}
+			identity.User = user
+			result = append(result, identity)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// HardDeleteUser deletes the user of the given identity along with all its identities, even the soft-deleted ones.
+// The tokens, external tokens, privilege caches, roles, memberships and invitations of the identities, as well as the
+// verification codes of the user, are deleted first. This is a hard delete!
 func (s *userServiceImpl) HardDeleteUser(ctx context.Context, identity repository.Identity) error {
 	return s.ExecuteInTransaction(func() error {
 		unscoped := func(db *gorm.DB) *gorm.DB {
 			return db.Unscoped()
 		}
-		if err := s.Repositories().Identities().Delete(ctx, identity.ID, unscoped); err != nil {
+		identities, err := s.Repositories().Identities().Query(repository.IdentityFilterByUserID(identity.User.ID), unscoped)
+		if err != nil {
 			return err
 		}
+		identityIDs := []uuid.UUID{}
+		if identity.ID != uuid.Nil {
+			identityIDs = append(identityIDs, identity.ID)
+		}
+		for _, i := range identities {
+			if i.ID != identity.ID {
+				identityIDs = append(identityIDs, i.ID)
+			}
+		}
+		for _, identityID := range identityIDs {
+			if err := s.deleteIdentityData(ctx, identityID); err != nil {
+				return err
+			}
+			if err := s.Repositories().Identities().Delete(ctx, identityID, unscoped); err != nil {
+				return err
+			}
+		}
 
+		if err := s.Repositories().VerificationCodes().DeleteForUser(ctx, identity.User.ID); err != nil {
+			return err
+		}
 		if err := s.Repositories().Users().Delete(ctx, identity.User.ID, unscoped); err != nil {
 			return err
 		}
 		return nil
 	})
 }
+
+// deleteIdentityData deletes the tokens, external tokens, privilege caches, roles, memberships and invitations of the
+// given identity, which would otherwise prevent the identity from being deleted
+func (s *userServiceImpl) deleteIdentityData(ctx context.Context, identityID uuid.UUID) error {
+	repositories := s.Repositories()
+	for _, deleteForIdentity := range []func(context.Context, uuid.UUID) error{
+		repositories.TokenRepository().DeleteForIdentity,
+		repositories.PrivilegeCacheRepository().DeleteForIdentity,
+		repositories.ExternalTokens().DeleteForIdentity,
+		repositories.IdentityRoleRepository().DeleteForIdentity,
+		repositories.Identities().RemoveMemberships,
+		repositories.InvitationRepository().DeleteForInvitee,
+	} {
+		if err := deleteForIdentity(ctx, identityID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeUsers merges the user of the identity `sourceIdentityID` into the user of the identity `targetIdentityID`, for
+// the users who signed up twice. In a single transaction, the identities of the source user are re-parented to the
+// target user, while their external tokens, memberships, roles, deny assignments and invitations are transferred to the
+// target identity, and the privilege caches affected by these changes are flagged as stale. The source user is then kept
+// as a soft deleted tombstone which refers to the target user, and the target user is notified of the merge.
+// Returns the target identity with its user, NotFoundError if any of the identities doesn't exist, or
+// BadParameterError if both identities belong to the same user.
+func (s *userServiceImpl) MergeUsers(ctx context.Context, sourceIdentityID, targetIdentityID uuid.UUID) (*repository.Identity, error) {
+	var source, target *repository.Identity
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		source, err = s.Repositories().Identities().LoadWithUser(ctx, sourceIdentityID)
+		if err != nil {
+			return err
+		}
+		target, err = s.Repositories().Identities().LoadWithUser(ctx, targetIdentityID)
+		if err != nil {
+			return err
+		}
+		if source.User.ID == target.User.ID {
+			return errors.NewBadParameterErrorFromString("source_identity_id", sourceIdentityID, "the source and target identities belong to the same user")
+		}
+
+		identities, err := s.Repositories().Identities().Query(repository.IdentityFilterByUserID(source.User.ID))
+		if err != nil {
+			return err
+		}
+		for _, identity := range identities {
+			err := s.transferIdentityData(ctx, identity.ID, target.ID)
+			if err != nil {
+				return err
+			}
+			identity.UserID = repository.NullUUID{UUID: target.User.ID, Valid: true}
+			err = s.Repositories().Identities().Save(ctx, &identity)
+			if err != nil {
+				return err
+			}
+		}
+
+		source.User.MergedInto = repository.NullUUID{UUID: target.User.ID, Valid: true}
+		err = s.Repositories().Users().Save(ctx, &source.User)
+		if err != nil {
+			return err
+		}
+		return s.Repositories().Users().Delete(ctx, source.User.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Info(ctx, map[string]interface{}{
+		"source_user_id": source.User.ID,
+		"target_user_id": target.User.ID,
+	}, "users merged")
+
+	// the merge is not rolled back if the notification can't be sent
+	msg := notification.NewUserMerged(target.ID.String(), source.Username, source.User.Email)
+	_, err = s.Services().NotificationService().SendMessageAsync(ctx, msg)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"identity_id": target.ID,
+			"err":         err,
+		}, "unable to send the notification of the merge of the users")
+	}
+	return target, nil
+}
+
+// transferIdentityData transfers the external tokens, invitations, memberships, roles and deny assignments of the
+// identity `fromIdentityID` to the identity `toIdentityID`. The memberships, roles and deny assignments are removed from
+// `fromIdentityID` and added to `toIdentityID` unless it already has them, which flags the privilege caches of both
+// identities as stale.
+func (s *userServiceImpl) transferIdentityData(ctx context.Context, fromIdentityID, toIdentityID uuid.UUID) error {
+	repositories := s.Repositories()
+	err := repositories.ExternalTokens().TransferToIdentity(ctx, fromIdentityID, toIdentityID)
+	if err != nil {
+		return err
+	}
+	err = repositories.InvitationRepository().TransferToInvitee(ctx, fromIdentityID, toIdentityID)
+	if err != nil {
+		return err
+	}
+
+	memberships, err := repositories.Identities().FindMemberships(ctx, fromIdentityID)
+	if err != nil {
+		return err
+	}
+	existingMemberships, err := repositories.Identities().FindMemberships(ctx, toIdentityID)
+	if err != nil {
+		return err
+	}
+	isMember := map[uuid.UUID]bool{}
+	for _, membership := range existingMemberships {
+		isMember[membership.MemberOf] = true
+	}
+	for _, membership := range memberships {
+		err := repositories.Identities().RemoveMember(ctx, membership.MemberOf, fromIdentityID)
+		if err != nil {
+			return err
+		}
+		if isMember[membership.MemberOf] {
+			continue
+		}
+		err = repositories.Identities().AddMember(ctx, membership.MemberOf, toIdentityID)
+		if err != nil {
+			return err
+		}
+		err = repositories.Identities().FlagPrivilegeCacheStaleForMembershipChange(ctx, toIdentityID, membership.MemberOf)
+		if err != nil {
+			return err
+		}
+	}
+
+	identityRoles, err := repositories.IdentityRoleRepository().FindIdentityRolesByIdentity(ctx, fromIdentityID)
+	if err != nil {
+		return err
+	}
+	for _, identityRole := range identityRoles {
+		err := repositories.IdentityRoleRepository().Delete(ctx, identityRole.IdentityRoleID)
+		if err != nil {
+			return err
+		}
+		existingRoles, err := repositories.IdentityRoleRepository().FindIdentityRolesByIdentityAndResource(ctx, identityRole.ResourceID, toIdentityID)
+		if err != nil {
+			return err
+		}
+		hasRole := false
+		for _, existingRole := range existingRoles {
+			if existingRole.RoleID == identityRole.RoleID {
+				hasRole = true
+				break
+			}
+		}
+		if hasRole {
+			continue
+		}
+		err = repositories.IdentityRoleRepository().Create(ctx, &rolerepo.IdentityRole{
+			IdentityID: toIdentityID,
+			ResourceID: identityRole.ResourceID,
+			RoleID:     identityRole.RoleID,
+			ValidFrom:  identityRole.ValidFrom,
+			ValidUntil: identityRole.ValidUntil,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// the deny assignments follow the roles, otherwise the transferred roles would grant the denied scopes
+	denyAssignments, err := repositories.DenyAssignmentRepository().FindByIdentity(ctx, fromIdentityID)
+	if err != nil {
+		return err
+	}
+	existingDenyAssignments, err := repositories.DenyAssignmentRepository().FindByIdentity(ctx, toIdentityID)
+	if err != nil {
+		return err
+	}
+	isDenied := map[string]bool{}
+	for _, denyAssignment := range existingDenyAssignments {
+		isDenied[denyAssignment.ResourceID+" "+denyAssignment.ScopeName] = true
+	}
+	for _, denyAssignment := range denyAssignments {
+		err := repositories.DenyAssignmentRepository().Delete(ctx, denyAssignment.DenyAssignmentID)
+		if err != nil {
+			return err
+		}
+		if isDenied[denyAssignment.ResourceID+" "+denyAssignment.ScopeName] {
+			continue
+		}
+		err = repositories.DenyAssignmentRepository().Create(ctx, &rolerepo.DenyAssignment{
+			IdentityID: toIdentityID,
+			ResourceID: denyAssignment.ResourceID,
+			ScopeName:  denyAssignment.ScopeName,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportPersonalData returns an archive of all the personal data held about the user of the identity with the given ID:
+// the user account and its context information, the identities, the linked external accounts, the memberships, the
+// roles, the invitations and the email verification history. The secrets, such as the external tokens, the accept codes
+// of the invitations and the verification codes, are not included.
+// Returns NotFoundError if the identity or its user doesn't exist.
+func (s *userServiceImpl) ExportPersonalData(ctx context.Context, identityID uuid.UUID) (*app.UserDataExport, error) {
+	var result *app.UserDataExport
+	err := s.ExecuteInTransaction(func() error {
+		identity, err := s.Repositories().Identities().LoadWithUser(ctx, identityID)
+		if err != nil {
+			return err
+		}
+		user := identity.User
+		result = &app.UserDataExport{
+			ExportedAt:         time.Now(),
+			User:               convertToExportUser(user),
+			Identities:         []*app.UserDataExportIdentity{},
+			ExternalAccounts:   []*app.UserDataExportExternalAccount{},
+			Memberships:        []*app.UserDataExportAssociation{},
+			Roles:              []*app.UserDataExportAssociation{},
+			Invitations:        []*app.UserDataExportInvitation{},
+			EmailVerifications: []*app.UserDataExportEmailVerification{},
+		}
+		identities, err := s.Repositories().Identities().Query(repository.IdentityFilterByUserID(user.ID))
+		if err != nil {
+			return err
+		}
+		for _, i := range identities {
+			exportIdentity := convertToExportIdentity(i)
+			history, err := s.Repositories().UsernameHistory().ListForIdentity(ctx, i.ID)
+			if err != nil {
+				return err
+			}
+			for _, h := range history {
+				exportIdentity.PreviousUsernames = append(exportIdentity.PreviousUsernames, h.Username)
+			}
+			result.Identities = append(result.Identities, exportIdentity)
+
+			externalTokens, err := s.Repositories().ExternalTokens().Query(tokenrepo.ExternalTokenFilterByIdentityID(i.ID))
+			if err != nil {
+				return err
+			}
+			for _, t := range externalTokens {
+				result.ExternalAccounts = append(result.ExternalAccounts, convertToExportExternalAccount(t))
+			}
+
+			memberships, err := s.Repositories().Identities().FindIdentityMemberships(ctx, i.ID, nil)
+			if err != nil {
+				return err
+			}
+			for _, m := range memberships {
+				result.Memberships = append(result.Memberships, convertToExportAssociation(m))
+			}
+
+			roles, err := s.Repositories().IdentityRoleRepository().FindIdentityRolesForIdentity(ctx, i.ID, nil)
+			if err != nil {
+				return err
+			}
+			for _, r := range roles {
+				result.Roles = append(result.Roles, convertToExportAssociation(r))
+			}
+
+			invitations, err := s.Repositories().InvitationRepository().ListForInvitee(ctx, i.ID)
+			if err != nil {
+				return err
+			}
+			for _, inv := range invitations {
+				invitationRoles, err := s.Repositories().InvitationRepository().ListRoles(ctx, inv.InvitationID)
+				if err != nil {
+					return err
+				}
+				roleNames := []string{}
+				for _, r := range invitationRoles {
+					roleNames = append(roleNames, r.Name)
+				}
+				result.Invitations = append(result.Invitations, &app.UserDataExportInvitation{
+					ID:         inv.InvitationID,
+					InviteTo:   inv.InviteTo,
+					ResourceID: inv.ResourceID,
+					Member:     inv.Member,
+					Roles:      roleNames,
+					CreatedAt:  inv.CreatedAt,
+				})
+			}
+		}
+
+		codes, err := s.Repositories().VerificationCodes().Query(repository.VerificationCodeFilterByUserID(user.ID))
+		if err != nil {
+			return err
+		}
+		for _, c := range codes {
+			result.EmailVerifications = append(result.EmailVerifications, &app.UserDataExportEmailVerification{
+				ID:        c.ID,
+				CreatedAt: c.CreatedAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Info(ctx, map[string]interface{}{
+		"identity_id": identityID,
+	}, "personal data exported")
+	return result, nil
+}
+
+func convertToExportUser(user repository.User) *app.UserDataExportUser {
+	profileAttributes := user.ProfileAttributes.Visible(
+		account.ProfileAttributeVisibilityPublic, account.ProfileAttributeVisibilityPrivate, account.ProfileAttributeVisibilityService)
+	return &app.UserDataExportUser{
+		ID:                 user.ID,
+		Email:              user.Email,
+		EmailVerified:      user.EmailVerified,
+		EmailPrivate:       user.EmailPrivate,
+		FullName:           user.FullName,
+		ImageURL:           user.ImageURL,
+		Bio:                user.Bio,
+		URL:                user.URL,
+		Company:            user.Company,
+		FeatureLevel:       user.FeatureLevel,
+		Cluster:            user.Cluster,
+		Deprovisioned:      user.Deprovisioned,
+		ContextInformation: user.ContextInformation,
+		ProfileAttributes:  profileAttributes,
+		CreatedAt:          user.CreatedAt,
+		UpdatedAt:          user.UpdatedAt,
+	}
+}
+
+func convertToExportIdentity(identity repository.Identity) *app.UserDataExportIdentity {
+	return &app.UserDataExportIdentity{
+		ID:                    identity.ID,
+		Username:              identity.Username,
+		ProviderType:          identity.ProviderType,
+		ProfileURL:            identity.ProfileURL,
+		RegistrationCompleted: identity.RegistrationCompleted,
+		CreatedAt:             identity.CreatedAt,
+		UpdatedAt:             identity.UpdatedAt,
+	}
+}
+
+// convertToExportExternalAccount returns the metadata of the given external token, without the token itself
+func convertToExportExternalAccount(token tokenrepo.ExternalToken) *app.UserDataExportExternalAccount {
+	return &app.UserDataExportExternalAccount{
+		ID:         token.ID,
+		IdentityID: token.IdentityID,
+		ProviderID: token.ProviderID,
+		Username:   token.Username,
+		Scope:      token.Scope,
+		CreatedAt:  token.CreatedAt,
+		UpdatedAt:  token.UpdatedAt,
+	}
+}
+
+func convertToExportAssociation(association authorization.IdentityAssociation) *app.UserDataExportAssociation {
+	roles := association.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	return &app.UserDataExportAssociation{
+		ResourceID:       association.ResourceID,
+		ResourceName:     association.ResourceName,
+		ParentResourceID: association.ParentResourceID,
+		IdentityID:       association.IdentityID,
+		Member:           association.Member,
+		Roles:            roles,
+	}
+}
@@ -3,10 +3,22 @@ package service_test
 import (
 	"context"
 	"testing"
-
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/application/service/factory"
+	"github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	permission "github.com/fabric8-services/fabric8-auth/authorization/permission/repository"
+	"github.com/fabric8-services/fabric8-auth/authorization/token"
+	tokenrepo "github.com/fabric8-services/fabric8-auth/authorization/token/repository"
 	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormapplication"
 	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/notification"
+	"github.com/fabric8-services/fabric8-auth/rest"
 	testsupport "github.com/fabric8-services/fabric8-auth/test"
+	testservice "github.com/fabric8-services/fabric8-auth/test/service"
+	testtoken "github.com/fabric8-services/fabric8-auth/test/token"
 	errs "github.com/pkg/errors"
 
 	"fmt"
@@ -96,6 +108,345 @@ func (s *userServiceBlackboxTestSuite) TestHardDeleteUser() {
 	})
 }
 
+func (s *userServiceBlackboxTestSuite) TestExportPersonalData() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		user.User().ContextInformation = map[string]interface{}{"last_visited_url": "https://a.openshift.io"}
+		require.NoError(t, s.Application.Users().Save(s.Ctx, user.User()))
+		org := s.Graph.CreateOrganization().AddMember(user)
+		space := s.Graph.CreateSpace().AddAdmin(user)
+		invitation := s.Graph.CreateInvitation(user, s.Graph.CreateTeam())
+		externalToken := tokenrepo.ExternalToken{
+			ProviderID: uuid.NewV4(),
+			Token:      uuid.NewV4().String(),
+			Scope:      "user:full",
+			Username:   "jdoe",
+			IdentityID: user.IdentityID(),
+		}
+		require.NoError(t, s.Application.ExternalTokens().Create(s.Ctx, &externalToken))
+		code := repository.VerificationCode{User: *user.User(), Code: uuid.NewV4().String()}
+		require.NoError(t, s.Application.VerificationCodes().Create(s.Ctx, &code))
+		previousUsername := repository.UsernameHistory{IdentityID: user.IdentityID(), Username: "previous-" + uuid.NewV4().String()}
+		require.NoError(t, s.Application.UsernameHistory().Create(s.Ctx, &previousUsername))
+		s.Graph.CreateUser() // noise
+
+		// when
+		result, err := s.Application.UserService().ExportPersonalData(s.Ctx, user.IdentityID())
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, user.User().ID, result.User.ID)
+		assert.Equal(t, user.User().Email, result.User.Email)
+		assert.Equal(t, "https://a.openshift.io", result.User.ContextInformation["last_visited_url"])
+		require.Len(t, result.Identities, 1)
+		assert.Equal(t, user.IdentityID(), result.Identities[0].ID)
+		assert.Equal(t, user.Identity().Username, result.Identities[0].Username)
+		assert.Equal(t, []string{previousUsername.Username}, result.Identities[0].PreviousUsernames)
+		// only the metadata of the external accounts are exported
+		require.Len(t, result.ExternalAccounts, 1)
+		assert.Equal(t, externalToken.ID, result.ExternalAccounts[0].ID)
+		assert.Equal(t, "jdoe", result.ExternalAccounts[0].Username)
+		assert.Equal(t, "user:full", result.ExternalAccounts[0].Scope)
+		require.Len(t, result.Memberships, 1)
+		assert.Equal(t, org.ResourceID(), result.Memberships[0].ResourceID)
+		assert.True(t, result.Memberships[0].Member)
+		require.Len(t, result.Roles, 1)
+		assert.Equal(t, space.SpaceID(), result.Roles[0].ResourceID)
+		assert.Equal(t, []string{authorization.SpaceAdminRole}, result.Roles[0].Roles)
+		require.Len(t, result.Invitations, 1)
+		assert.Equal(t, invitation.Invitation().InvitationID, result.Invitations[0].ID)
+		assert.Equal(t, invitation.Invitation().InviteTo, result.Invitations[0].InviteTo)
+		require.Len(t, result.EmailVerifications, 1)
+		assert.Equal(t, code.ID, result.EmailVerifications[0].ID)
+	})
+
+	s.T().Run("not found", func(t *testing.T) {
+		// given
+		id := uuid.NewV4()
+		// when
+		_, err := s.Application.UserService().ExportPersonalData(s.Ctx, id)
+		// then
+		testsupport.AssertError(t, err, errors.NotFoundError{}, "identity with id '%s' not found", id)
+	})
+}
+
+func (s *userServiceBlackboxTestSuite) TestMergeUsers() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		var messages []notification.Message
+		notificationServiceMock := testservice.NewNotificationServiceMock(t)
+		notificationServiceMock.SendMessageAsyncFunc = func(ctx context.Context, msg notification.Message, options ...rest.HTTPClientOption) (chan error, error) {
+			messages = append(messages, msg)
+			return nil, nil
+		}
+		application := gormapplication.NewGormDB(s.DB, s.Configuration, s.Wrappers, factory.WithNotificationService(notificationServiceMock))
+		g := s.NewTestGraph(t)
+		source := g.CreateUser()
+		target := g.CreateUser()
+		org := g.CreateOrganization().AddMember(source)
+		sharedOrg := g.CreateOrganization().AddMember(source).AddMember(target)
+		space := g.CreateSpace().AddAdmin(source)
+		g.CreateInvitation(source, g.CreateTeam())
+		externalToken := tokenrepo.ExternalToken{ProviderID: uuid.NewV4(), Token: uuid.NewV4().String(), IdentityID: source.IdentityID()}
+		require.NoError(t, application.ExternalTokens().Create(s.Ctx, &externalToken))
+		cache := &permission.PrivilegeCache{
+			IdentityID: target.IdentityID(),
+			ResourceID: space.SpaceID(),
+			ExpiryTime: time.Now().Add(time.Hour),
+		}
+		require.NoError(t, application.PrivilegeCacheRepository().Create(s.Ctx, cache))
+
+		// when
+		result, err := application.UserService().MergeUsers(s.Ctx, source.IdentityID(), target.IdentityID())
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, target.IdentityID(), result.ID)
+		assert.Equal(t, target.User().ID, result.User.ID)
+		// the identity of the source user is re-parented to the target user
+		identity, err := application.Identities().LoadWithUser(s.Ctx, source.IdentityID())
+		require.NoError(t, err)
+		assert.Equal(t, target.User().ID, identity.User.ID)
+		// the associations are transferred to the target identity
+		memberships, err := application.Identities().FindMemberships(s.Ctx, target.IdentityID())
+		require.NoError(t, err)
+		memberOf := []uuid.UUID{}
+		for _, membership := range memberships {
+			memberOf = append(memberOf, membership.MemberOf)
+		}
+		assert.ElementsMatch(t, []uuid.UUID{org.OrganizationID(), sharedOrg.OrganizationID()}, memberOf)
+		memberships, err = application.Identities().FindMemberships(s.Ctx, source.IdentityID())
+		require.NoError(t, err)
+		assert.Empty(t, memberships)
+		scopes, err := application.IdentityRoleRepository().FindScopesByIdentityAndResource(s.Ctx, target.IdentityID(), space.SpaceID())
+		require.NoError(t, err)
+		assert.Contains(t, scopes, authorization.ManageSpaceScope)
+		identityRoles, err := application.IdentityRoleRepository().FindIdentityRolesByIdentity(s.Ctx, source.IdentityID())
+		require.NoError(t, err)
+		assert.Empty(t, identityRoles)
+		invitations, err := application.InvitationRepository().ListForInvitee(s.Ctx, target.IdentityID())
+		require.NoError(t, err)
+		assert.Len(t, invitations, 1)
+		loadedToken, err := application.ExternalTokens().Load(s.Ctx, externalToken.ID)
+		require.NoError(t, err)
+		assert.Equal(t, target.IdentityID(), loadedToken.IdentityID)
+		cache, err = application.PrivilegeCacheRepository().Load(s.Ctx, cache.PrivilegeCacheID)
+		require.NoError(t, err)
+		assert.True(t, cache.Stale)
+		// the source user is kept as a tombstone
+		_, err = application.Users().Load(s.Ctx, source.User().ID)
+		testsupport.AssertError(t, err, errors.NotFoundError{}, "user with id '%s' not found", source.User().ID)
+		tombstone, err := application.Users().Load(s.Ctx, source.User().ID, func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		})
+		require.NoError(t, err)
+		assert.Equal(t, repository.NullUUID{UUID: target.User().ID, Valid: true}, tombstone.MergedInto)
+		// the target user is notified
+		require.Len(t, messages, 1)
+		assert.Equal(t, "user.merge", messages[0].MessageType)
+		assert.Equal(t, target.IdentityID().String(), messages[0].TargetID)
+		assert.Equal(t, source.User().Email, messages[0].Custom["mergedEmail"])
+	})
+
+	s.T().Run("with deny assignment", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		source := g.CreateUser()
+		target := g.CreateUser()
+		resourceType := g.CreateResourceType()
+		resourceType.AddScope("test-scope")
+		resourceType.AddScope("other-scope")
+		role := g.CreateRole(resourceType).AddScope("test-scope").AddScope("other-scope")
+		res := g.CreateResource(resourceType).AddRole(source, role).AddDenial(source, "test-scope")
+
+		// when
+		_, err := s.Application.UserService().MergeUsers(s.Ctx, source.IdentityID(), target.IdentityID())
+
+		// then
+		require.NoError(t, err)
+		// the deny assignment is transferred along with the role, so the denied scope is still not granted
+		denyAssignments, err := s.Application.DenyAssignmentRepository().FindByIdentity(s.Ctx, target.IdentityID())
+		require.NoError(t, err)
+		require.Len(t, denyAssignments, 1)
+		assert.Equal(t, res.ResourceID(), denyAssignments[0].ResourceID)
+		assert.Equal(t, "test-scope", denyAssignments[0].ScopeName)
+		denyAssignments, err = s.Application.DenyAssignmentRepository().FindByIdentity(s.Ctx, source.IdentityID())
+		require.NoError(t, err)
+		assert.Empty(t, denyAssignments)
+		scopes, err := s.Application.IdentityRoleRepository().FindScopesByIdentityAndResource(s.Ctx, target.IdentityID(), res.ResourceID())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"other-scope"}, scopes)
+	})
+
+	s.T().Run("with validity window", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		source := g.CreateUser()
+		target := g.CreateUser()
+		resourceType := g.CreateResourceType()
+		validFrom := time.Now().Add(-time.Hour).Round(time.Second).UTC()
+		validUntil := time.Now().Add(time.Hour).Round(time.Second).UTC()
+		res := g.CreateResource(resourceType).AddRoleWithValidity(source, g.CreateRole(resourceType), &validFrom, &validUntil)
+
+		// when
+		_, err := s.Application.UserService().MergeUsers(s.Ctx, source.IdentityID(), target.IdentityID())
+
+		// then
+		require.NoError(t, err)
+		// the transferred role keeps its validity window, so that it still expires
+		identityRoles, err := s.Application.IdentityRoleRepository().FindIdentityRolesByIdentityAndResource(s.Ctx, res.ResourceID(), target.IdentityID())
+		require.NoError(t, err)
+		require.Len(t, identityRoles, 1)
+		require.NotNil(t, identityRoles[0].ValidFrom)
+		assert.True(t, identityRoles[0].ValidFrom.Equal(validFrom))
+		require.NotNil(t, identityRoles[0].ValidUntil)
+		assert.True(t, identityRoles[0].ValidUntil.Equal(validUntil))
+	})
+
+	s.T().Run("same user", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		// when
+		_, err := s.Application.UserService().MergeUsers(s.Ctx, user.IdentityID(), user.IdentityID())
+		// then
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'source_identity_id': '%s' - the source and target identities belong to the same user", user.IdentityID())
+	})
+
+	s.T().Run("unknown identity", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		id := uuid.NewV4()
+		// when
+		_, err := s.Application.UserService().MergeUsers(s.Ctx, id, user.IdentityID())
+		// then
+		testsupport.AssertError(t, err, errors.NotFoundError{}, "identity with id '%s' not found", id)
+	})
+}
+
+func (s *userServiceBlackboxTestSuite) TestRequestDeletion() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		var messages []notification.Message
+		notificationServiceMock := testservice.NewNotificationServiceMock(t)
+		notificationServiceMock.SendMessageAsyncFunc = func(ctx context.Context, msg notification.Message, options ...rest.HTTPClientOption) (chan error, error) {
+			messages = append(messages, msg)
+			return nil, nil
+		}
+		application := gormapplication.NewGormDB(s.DB, s.Configuration, s.Wrappers, factory.WithNotificationService(notificationServiceMock))
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		tkn := g.CreateToken(user)
+		ctx, err := testtoken.EmbedIdentityInContext(*user.Identity())
+		require.NoError(t, err)
+		before := time.Now()
+
+		// when
+		identity, err := application.UserService().RequestDeletion(ctx)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, user.IdentityID(), identity.ID)
+		require.NotNil(t, identity.User.DeletionScheduledAt)
+		assert.True(t, identity.User.DeletionScheduledAt.After(before.Add(s.Configuration.GetUserDeletionCoolingOffPeriod())))
+		loadedUser, err := application.Users().Load(s.Ctx, user.User().ID)
+		require.NoError(t, err)
+		require.NotNil(t, loadedUser.DeletionScheduledAt)
+		// the tokens of the user are revoked
+		loadedToken, err := application.TokenRepository().Load(s.Ctx, tkn.TokenID())
+		require.NoError(t, err)
+		assert.True(t, loadedToken.HasStatus(token.TOKEN_STATUS_REVOKED))
+		// the user is notified
+		require.Len(t, messages, 1)
+		assert.Equal(t, "user.deletion.scheduled", messages[0].MessageType)
+		assert.Equal(t, user.IdentityID().String(), messages[0].TargetID)
+
+		t.Run("requested again", func(t *testing.T) {
+			// when
+			again, err := application.UserService().RequestDeletion(ctx)
+			// then the original schedule is kept and the user isn't notified again
+			require.NoError(t, err)
+			require.NotNil(t, again.User.DeletionScheduledAt)
+			assert.True(t, identity.User.DeletionScheduledAt.Equal(*again.User.DeletionScheduledAt))
+			assert.Len(t, messages, 1)
+		})
+	})
+
+	s.T().Run("deprovisioned user", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		user.User().Deprovisioned = true
+		require.NoError(t, s.Application.Users().Save(s.Ctx, user.User()))
+		ctx, err := testtoken.EmbedIdentityInContext(*user.Identity())
+		require.NoError(t, err)
+		// when
+		_, err = s.Application.UserService().RequestDeletion(ctx)
+		// then
+		testsupport.AssertError(t, err, errors.UnauthorizedError{}, "user deprovisioned")
+	})
+}
+
+func (s *userServiceBlackboxTestSuite) TestCancelDeletion() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		s.scheduleDeletion(user.User(), time.Now().Add(time.Hour))
+		ctx, err := testtoken.EmbedIdentityInContext(*user.Identity())
+		require.NoError(t, err)
+		// when
+		identity, err := s.Application.UserService().CancelDeletion(ctx)
+		// then
+		require.NoError(t, err)
+		assert.Nil(t, identity.User.DeletionScheduledAt)
+		loadedUser, err := s.Application.Users().Load(s.Ctx, user.User().ID)
+		require.NoError(t, err)
+		assert.Nil(t, loadedUser.DeletionScheduledAt)
+	})
+
+	s.T().Run("no deletion scheduled", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		ctx, err := testtoken.EmbedIdentityInContext(*user.Identity())
+		require.NoError(t, err)
+		// when
+		_, err = s.Application.UserService().CancelDeletion(ctx)
+		// then
+		testsupport.AssertError(t, err, errors.NotFoundError{}, "no deletion scheduled for the user with identity '%s'", user.IdentityID())
+	})
+}
+
+func (s *userServiceBlackboxTestSuite) TestListUsersDueForDeletion() {
+	// given
+	due := s.Graph.CreateUser()
+	s.scheduleDeletion(due.User(), time.Now().Add(-time.Minute))
+	notDue := s.Graph.CreateUser()
+	s.scheduleDeletion(notDue.User(), time.Now().Add(time.Hour))
+	notScheduled := s.Graph.CreateUser()
+
+	// when
+	identities, err := s.Application.UserService().ListUsersDueForDeletion(s.Ctx, 1000)
+
+	// then
+	require.NoError(s.T(), err)
+	userIDs := map[uuid.UUID]uuid.UUID{}
+	for _, identity := range identities {
+		userIDs[identity.User.ID] = identity.ID
+	}
+	assert.Equal(s.T(), due.IdentityID(), userIDs[due.User().ID])
+	assert.NotContains(s.T(), userIDs, notDue.User().ID)
+	assert.NotContains(s.T(), userIDs, notScheduled.User().ID)
+}
+
+// scheduleDeletion sets the time after which the given user is deleted
+func (s *userServiceBlackboxTestSuite) scheduleDeletion(user *repository.User, deletionScheduledAt time.Time) {
+	user.DeletionScheduledAt = &deletionScheduledAt
+	require.NoError(s.T(), s.Application.Users().Save(s.Ctx, user))
+}
+
 func (s *userServiceBlackboxTestSuite) TestResetDeprovision() {
 	userToResetDeprovision := s.Graph.CreateUser()
 	userToStayIntact := s.Graph.CreateUser()
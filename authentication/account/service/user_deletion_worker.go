@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/application/service"
+	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/satori/go.uuid"
+)
+
+type userDeletionWorkerConfig interface {
+	GetUserDeletionInterval() time.Duration
+	GetUserDeletionBatchSize() int
+}
+
+// UserDeletionWorker periodically deletes the accounts whose deletion was requested by their users once their
+// cooling-off period is over, along with their tenant
+type UserDeletionWorker struct {
+	config        userDeletionWorkerConfig
+	userService   service.UserService
+	tenantService TenantService
+	tokenManager  manager.TokenManager
+	ticker        *time.Ticker
+	stopCh        chan bool
+}
+
+// NewUserDeletionWorker returns a new user deletion worker. The tenant service is optional, and the token manager is
+// used to sign the requests to the tenant service.
+func NewUserDeletionWorker(userService service.UserService, tenantService TenantService, tokenManager manager.TokenManager, config userDeletionWorkerConfig) *UserDeletionWorker {
+	return &UserDeletionWorker{
+		config:        config,
+		userService:   userService,
+		tenantService: tenantService,
+		tokenManager:  tokenManager,
+	}
+}
+
+// Start initializes the regular deletions
+func (w *UserDeletionWorker) Start() {
+	w.ticker = time.NewTicker(w.config.GetUserDeletionInterval())
+	w.stopCh = make(chan bool, 1)
+	go func() {
+		defer log.Info(nil, map[string]interface{}{}, "user deletion worker stopped")
+		log.Info(nil, map[string]interface{}{"interval": w.config.GetUserDeletionInterval()}, "user deletion worker started")
+		for {
+			select {
+			case <-w.ticker.C:
+				w.DeleteDueUsers(manager.ContextWithTokenManager(context.Background(), w.tokenManager))
+			case <-w.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the deletions
+func (w *UserDeletionWorker) Stop() {
+	if w.stopCh != nil {
+		w.ticker.Stop()
+		w.stopCh <- true
+	}
+}
+
+// DeleteDueUsers deletes the tenant and then the account of the users whose cooling-off period is over, and returns
+// the number of deleted accounts. The tenant is deleted first, so that the deletion of the account is retried during
+// the next run if the tenant can't be deleted.
+func (w *UserDeletionWorker) DeleteDueUsers(ctx context.Context) int {
+	identities, err := w.userService.ListUsersDueForDeletion(ctx, w.config.GetUserDeletionBatchSize())
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err": err,
+		}, "unable to list the users whose deletion is due")
+		return 0
+	}
+	deleted := 0
+	for _, identity := range identities {
+		if w.tenantService != nil && identity.ID != uuid.Nil {
+			err := w.tenantService.Delete(ctx, identity.ID)
+			if err != nil {
+				log.Error(ctx, map[string]interface{}{
+					"identity_id": identity.ID,
+					"err":         err,
+				}, "unable to delete the tenant of the user whose deletion is due")
+				continue
+			}
+		}
+		err := w.userService.HardDeleteUser(ctx, identity)
+		if err != nil {
+			log.Error(ctx, map[string]interface{}{
+				"user_id": identity.User.ID,
+				"err":     err,
+			}, "unable to delete the user whose deletion is due")
+			continue
+		}
+		log.Info(ctx, map[string]interface{}{
+			"user_id":     identity.User.ID,
+			"identity_id": identity.ID,
+		}, "user deleted at the end of the cooling-off period")
+		deleted++
+	}
+	return deleted
+}
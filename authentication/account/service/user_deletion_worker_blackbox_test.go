@@ -0,0 +1,90 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	accountservice "github.com/fabric8-services/fabric8-auth/authentication/account/service"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+	testtoken "github.com/fabric8-services/fabric8-auth/test/token"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type userDeletionWorkerBlackboxTestSuite struct {
+	gormtestsupport.DBTestSuite
+}
+
+func TestUserDeletionWorker(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &userDeletionWorkerBlackboxTestSuite{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+type userDeletionWorkerConfig struct{}
+
+func (c userDeletionWorkerConfig) GetUserDeletionInterval() time.Duration {
+	return time.Hour
+}
+
+func (c userDeletionWorkerConfig) GetUserDeletionBatchSize() int {
+	return 1000
+}
+
+// tenantServiceStub records the deleted tenants and fails to delete the tenants of the given identities
+type tenantServiceStub struct {
+	deleted []uuid.UUID
+	failing map[uuid.UUID]bool
+}
+
+func (t *tenantServiceStub) Init(ctx context.Context) error {
+	return nil
+}
+
+func (t *tenantServiceStub) Delete(ctx context.Context, identityID uuid.UUID) error {
+	if t.failing[identityID] {
+		return errors.NewInternalErrorFromString(ctx, "tenant service unavailable")
+	}
+	t.deleted = append(t.deleted, identityID)
+	return nil
+}
+
+// scheduleDeletion sets the time after which the user of the given identity is deleted
+func (s *userDeletionWorkerBlackboxTestSuite) scheduleDeletion(identity *repository.Identity, deletionScheduledAt time.Time) {
+	identity.User.DeletionScheduledAt = &deletionScheduledAt
+	require.NoError(s.T(), s.Application.Users().Save(s.Ctx, &identity.User))
+}
+
+func (s *userDeletionWorkerBlackboxTestSuite) TestDeleteDueUsers() {
+	// given
+	due := s.Graph.CreateUser()
+	s.scheduleDeletion(due.Identity(), time.Now().Add(-time.Minute))
+	failing := s.Graph.CreateUser()
+	s.scheduleDeletion(failing.Identity(), time.Now().Add(-time.Minute))
+	notDue := s.Graph.CreateUser()
+	s.scheduleDeletion(notDue.Identity(), time.Now().Add(time.Hour))
+	tenantService := &tenantServiceStub{failing: map[uuid.UUID]bool{failing.IdentityID(): true}}
+	worker := accountservice.NewUserDeletionWorker(s.Application.UserService(), tenantService, testtoken.TokenManager, userDeletionWorkerConfig{})
+
+	// when
+	deleted := worker.DeleteDueUsers(s.Ctx)
+
+	// then
+	assert.True(s.T(), deleted >= 1)
+	assert.Contains(s.T(), tenantService.deleted, due.IdentityID())
+	_, err := s.Application.Users().Load(s.Ctx, due.User().ID, includeSoftDeletes)
+	testsupport.AssertError(s.T(), err, errors.NotFoundError{}, "user with id '%s' not found", due.User().ID)
+	// the user whose tenant could not be deleted is kept until the next run
+	_, err = s.Application.Users().Load(s.Ctx, failing.User().ID)
+	assert.NoError(s.T(), err)
+	assert.NotContains(s.T(), tenantService.deleted, notDue.IdentityID())
+	_, err = s.Application.Users().Load(s.Ctx, notDue.User().ID)
+	assert.NoError(s.T(), err)
+}
@@ -0,0 +1,3 @@
+// Package transfer contains the records of the bulk export of the users, their identities, memberships and roles, and
+// of the resources, which are written as JSON Lines in order to move the users between environments.
+package transfer
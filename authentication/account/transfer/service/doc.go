@@ -0,0 +1,2 @@
+// Package service provides the service for the bulk export and import of the users.
+package service
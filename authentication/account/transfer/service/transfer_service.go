@@ -0,0 +1,493 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/application/service"
+	"github.com/fabric8-services/fabric8-auth/application/service/base"
+	servicecontext "github.com/fabric8-services/fabric8-auth/application/service/context"
+	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/authentication/account/transfer"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	resource "github.com/fabric8-services/fabric8-auth/authorization/resource/repository"
+	role "github.com/fabric8-services/fabric8-auth/authorization/role/repository"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+)
+
+// pageSize is the number of rows loaded by each query of the export
+const pageSize = 500
+
+type userTransferServiceImpl struct {
+	base.BaseService
+}
+
+// NewUserTransferService returns a new UserTransferService implementation
+func NewUserTransferService(context servicecontext.ServiceContext) service.UserTransferService {
+	return &userTransferServiceImpl{
+		BaseService: base.NewBaseService(context),
+	}
+}
+
+// exporter writes the records of an export, one JSON record per line
+type exporter struct {
+	encoder *json.Encoder
+	count   int
+}
+
+func (e *exporter) write(record transfer.Record) error {
+	err := e.encoder.Encode(record)
+	if err != nil {
+		return errs.Wrapf(err, "failed to write the %s record", record.Kind)
+	}
+	e.count++
+	return nil
+}
+
+// Export writes the resources, the users, the identities, the memberships and the identity roles to the given writer
+// and returns the number of written records. The rows are loaded page by page, each page in its own transaction, so that
+// the export of a large database doesn't hit the transaction timeout.
+func (s *userTransferServiceImpl) Export(ctx context.Context, w io.Writer) (int, error) {
+	buf := bufio.NewWriter(w)
+	e := &exporter{encoder: json.NewEncoder(buf)}
+	for _, export := range []func(context.Context, *exporter) error{
+		s.exportResources,
+		s.exportUsers,
+		s.exportIdentities,
+		s.exportMemberships,
+		s.exportIdentityRoles,
+	} {
+		err := export(ctx, e)
+		if err != nil {
+			return e.count, err
+		}
+	}
+	err := buf.Flush()
+	if err != nil {
+		return e.count, errs.Wrap(err, "failed to write the records")
+	}
+	log.Info(ctx, map[string]interface{}{
+		"records": e.count,
+	}, "users exported")
+	return e.count, nil
+}
+
+func (s *userTransferServiceImpl) exportResources(ctx context.Context, e *exporter) error {
+	return s.forEachResourcePage(func(resources []resource.Resource) error {
+		for _, r := range resources {
+			record := transfer.NewResource(r)
+			err := e.write(transfer.Record{Kind: transfer.KindResource, Resource: &record})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *userTransferServiceImpl) exportUsers(ctx context.Context, e *exporter) error {
+	last := uuid.Nil
+	for {
+		var users []account.User
+		err := s.ExecuteInTransaction(func() error {
+			var err error
+			users, err = s.Repositories().Users().Query(after("id", last))
+			return err
+		})
+		if err != nil || len(users) == 0 {
+			return err
+		}
+		for _, u := range users {
+			record := transfer.NewUser(u)
+			err := e.write(transfer.Record{Kind: transfer.KindUser, User: &record})
+			if err != nil {
+				return err
+			}
+		}
+		last = users[len(users)-1].ID
+	}
+}
+
+func (s *userTransferServiceImpl) exportIdentities(ctx context.Context, e *exporter) error {
+	return s.forEachIdentityPage(nil, func(identities []account.Identity) error {
+		for _, i := range identities {
+			record := transfer.NewIdentity(i)
+			err := e.write(transfer.Record{Kind: transfer.KindIdentity, Identity: &record})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *userTransferServiceImpl) exportMemberships(ctx context.Context, e *exporter) error {
+	groups := account.IdentityFilterByResourceTypes(
+		authorization.IdentityResourceTypeOrganization,
+		authorization.IdentityResourceTypeTeam,
+		authorization.IdentityResourceTypeGroup)
+	return s.forEachIdentityPage(groups, func(identities []account.Identity) error {
+		for _, group := range identities {
+			var members []account.Identity
+			err := s.ExecuteInTransaction(func() error {
+				var err error
+				members, err = s.Repositories().Identities().Query(account.IdentityFilterByMemberOf(group.ID))
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			for _, member := range members {
+				err := e.write(transfer.Record{
+					Kind:       transfer.KindMembership,
+					Membership: &transfer.Membership{MemberOf: group.ID, MemberID: member.ID},
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *userTransferServiceImpl) exportIdentityRoles(ctx context.Context, e *exporter) error {
+	return s.forEachResourcePage(func(resources []resource.Resource) error {
+		for _, r := range resources {
+			var identityRoles []role.IdentityRole
+			err := s.ExecuteInTransaction(func() error {
+				var err error
+				identityRoles, err = s.Repositories().IdentityRoleRepository().FindIdentityRolesByResource(ctx, r.ResourceID, false)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			for _, ir := range identityRoles {
+				// the roles of the deleted identities can't be imported
+				if ir.Identity.ID == uuid.Nil {
+					continue
+				}
+				err := e.write(transfer.Record{
+					Kind: transfer.KindIdentityRole,
+					IdentityRole: &transfer.IdentityRole{
+						IdentityRoleID: ir.IdentityRoleID,
+						IdentityID:     ir.IdentityID,
+						ResourceID:     ir.ResourceID,
+						Role:           ir.Role.Name,
+						ResourceType:   r.ResourceType.Name,
+						ValidFrom:      ir.ValidFrom,
+						ValidUntil:     ir.ValidUntil,
+						CreatedAt:      ir.CreatedAt,
+					},
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// forEachResourcePage calls the given function with each page of the resources, sorted by ID
+func (s *userTransferServiceImpl) forEachResourcePage(f func([]resource.Resource) error) error {
+	last := ""
+	for {
+		var resources []resource.Resource
+		err := s.ExecuteInTransaction(func() error {
+			var err error
+			resources, err = s.Repositories().ResourceRepository().Query(after("resource_id", last))
+			return err
+		})
+		if err != nil || len(resources) == 0 {
+			return err
+		}
+		err = f(resources)
+		if err != nil {
+			return err
+		}
+		last = resources[len(resources)-1].ResourceID
+	}
+}
+
+// forEachIdentityPage calls the given function with each page of the identities matching the optional filter, sorted
+// by ID
+func (s *userTransferServiceImpl) forEachIdentityPage(filter func(*gorm.DB) *gorm.DB, f func([]account.Identity) error) error {
+	last := uuid.Nil
+	for {
+		funcs := []func(*gorm.DB) *gorm.DB{after("id", last)}
+		if filter != nil {
+			funcs = append(funcs, filter)
+		}
+		var identities []account.Identity
+		err := s.ExecuteInTransaction(func() error {
+			var err error
+			identities, err = s.Repositories().Identities().Query(funcs...)
+			return err
+		})
+		if err != nil || len(identities) == 0 {
+			return err
+		}
+		err = f(identities)
+		if err != nil {
+			return err
+		}
+		last = identities[len(identities)-1].ID
+	}
+}
+
+// after is a gorm filter of the page of rows whose key is greater than the given one, sorted by key
+func after(column string, key interface{}) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(fmt.Sprintf("%s > ?", column), key).Order(column).Limit(pageSize)
+	}
+}
+
+// Import reads the records written by Export from the given reader and creates or updates the matching rows, each
+// record in its own transaction, so that a failed import can simply be run again. The records which already match the
+// rows are left untouched, and the resources are kept aside until their parent is imported. The privilege caches of
+// the identities whose memberships or roles change are flagged as stale. Returns the number of imported records.
+func (s *userTransferServiceImpl) Import(ctx context.Context, r io.Reader) (int, error) {
+	decoder := json.NewDecoder(r)
+	// the resources waiting for their parent, by parent ID
+	pending := map[string][]transfer.Resource{}
+	count := 0
+	for n := 1; ; n++ {
+		var record transfer.Record
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, errs.Wrapf(err, "failed to read record %d", n)
+		}
+		err = record.Validate()
+		if err != nil {
+			return count, errs.Wrapf(err, "invalid record %d", n)
+		}
+		imported := 1
+		switch record.Kind {
+		case transfer.KindResource:
+			imported, err = s.importResource(ctx, pending, *record.Resource)
+		case transfer.KindUser:
+			err = s.importUser(ctx, *record.User)
+		case transfer.KindIdentity:
+			err = s.importIdentity(ctx, *record.Identity)
+		case transfer.KindMembership:
+			err = s.importMembership(ctx, *record.Membership)
+		case transfer.KindIdentityRole:
+			err = s.importIdentityRole(ctx, *record.IdentityRole)
+		}
+		if err != nil {
+			return count, errs.Wrapf(err, "failed to import record %d", n)
+		}
+		count += imported
+	}
+	for parentResourceID := range pending {
+		// the parent is neither in the database nor in the export
+		return count, errors.NewNotFoundError("parent resource", parentResourceID)
+	}
+	log.Info(ctx, map[string]interface{}{
+		"records": count,
+	}, "users imported")
+	return count, nil
+}
+
+// importResource creates or updates the given resource, unless its parent doesn't exist yet, in which case the resource
+// is kept aside in the pending resources. Then imports the pending children of the resource. Returns the number of
+// imported resources.
+func (s *userTransferServiceImpl) importResource(ctx context.Context, pending map[string][]transfer.Resource, record transfer.Resource) (int, error) {
+	if record.ParentResourceID != nil {
+		var exists bool
+		err := s.ExecuteInTransaction(func() error {
+			err := s.Repositories().ResourceRepository().CheckExists(ctx, *record.ParentResourceID)
+			if notFound, _ := errors.IsNotFoundError(err); notFound {
+				return nil
+			}
+			exists = err == nil
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			pending[*record.ParentResourceID] = append(pending[*record.ParentResourceID], record)
+			return 0, nil
+		}
+	}
+	err := s.ExecuteInTransaction(func() error {
+		return s.saveResource(ctx, record)
+	})
+	if err != nil {
+		return 0, err
+	}
+	count := 1
+	children := pending[record.ResourceID]
+	delete(pending, record.ResourceID)
+	for _, child := range children {
+		imported, err := s.importResource(ctx, pending, child)
+		if err != nil {
+			return count, err
+		}
+		count += imported
+	}
+	return count, nil
+}
+
+func (s *userTransferServiceImpl) saveResource(ctx context.Context, record transfer.Resource) error {
+	resourceType, err := s.Repositories().ResourceTypeRepository().Lookup(ctx, record.ResourceType)
+	if err != nil {
+		return err
+	}
+	repo := s.Repositories().ResourceRepository()
+	err = repo.CheckExists(ctx, record.ResourceID)
+	if notFound, _ := errors.IsNotFoundError(err); notFound {
+		res := &resource.Resource{
+			ResourceType:   *resourceType,
+			ResourceTypeID: resourceType.ResourceTypeID,
+		}
+		record.Update(res)
+		return repo.Create(ctx, res)
+	} else if err != nil {
+		return err
+	}
+
+	res, err := repo.Load(ctx, record.ResourceID)
+	if err != nil {
+		return err
+	}
+	parentChanged := !equalResourceIDs(res.ParentResourceID, record.ParentResourceID)
+	var identityRoles []role.IdentityRole
+	if parentChanged {
+		// the roles inherited from the previous parents no longer apply
+		identityRoles, err = s.Repositories().IdentityRoleRepository().FindIdentityRolesByResource(ctx, res.ResourceID, true)
+		if err != nil {
+			return err
+		}
+	}
+	record.Update(res)
+	res.ResourceType = *resourceType
+	res.ResourceTypeID = resourceType.ResourceTypeID
+	err = repo.Save(ctx, res)
+	if err != nil || !parentChanged {
+		return err
+	}
+	inherited, err := s.Repositories().IdentityRoleRepository().FindIdentityRolesByResource(ctx, res.ResourceID, true)
+	if err != nil {
+		return err
+	}
+	for _, ir := range append(identityRoles, inherited...) {
+		err := s.Repositories().IdentityRoleRepository().FlagPrivilegeCacheStaleForIdentityRoleChange(ctx, ir.IdentityID, res.ResourceID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *userTransferServiceImpl) importUser(ctx context.Context, record transfer.User) error {
+	return s.ExecuteInTransaction(func() error {
+		repo := s.Repositories().Users()
+		user, err := repo.Load(ctx, record.ID)
+		if notFound, _ := errors.IsNotFoundError(err); notFound {
+			user = &account.User{}
+			record.Update(user)
+			return repo.Create(ctx, user)
+		} else if err != nil {
+			return err
+		}
+		record.Update(user)
+		return repo.Save(ctx, user)
+	})
+}
+
+func (s *userTransferServiceImpl) importIdentity(ctx context.Context, record transfer.Identity) error {
+	return s.ExecuteInTransaction(func() error {
+		repo := s.Repositories().Identities()
+		identity, err := repo.Load(ctx, record.ID)
+		if notFound, _ := errors.IsNotFoundError(err); notFound {
+			identity = &account.Identity{}
+			record.Update(identity)
+			return repo.Create(ctx, identity)
+		} else if err != nil {
+			return err
+		}
+		record.Update(identity)
+		return repo.Save(ctx, identity)
+	})
+}
+
+func (s *userTransferServiceImpl) importMembership(ctx context.Context, record transfer.Membership) error {
+	return s.ExecuteInTransaction(func() error {
+		count, err := s.Repositories().Identities().Count(ctx,
+			account.IdentityFilterByID(record.MemberID),
+			account.IdentityFilterByMemberOf(record.MemberOf))
+		if err != nil || count > 0 {
+			return err
+		}
+		return s.Repositories().Identities().AddMember(ctx, record.MemberOf, record.MemberID)
+	})
+}
+
+func (s *userTransferServiceImpl) importIdentityRole(ctx context.Context, record transfer.IdentityRole) error {
+	return s.ExecuteInTransaction(func() error {
+		r, err := s.Repositories().RoleRepository().Lookup(ctx, record.Role, record.ResourceType)
+		if err != nil {
+			return err
+		}
+		repo := s.Repositories().IdentityRoleRepository()
+		identityRoles, err := repo.FindIdentityRolesByIdentityAndResource(ctx, record.ResourceID, record.IdentityID)
+		if err != nil {
+			return err
+		}
+		for _, ir := range identityRoles {
+			if ir.IdentityRoleID == record.IdentityRoleID {
+				if ir.RoleID == r.RoleID && equalTimes(ir.ValidFrom, record.ValidFrom) && equalTimes(ir.ValidUntil, record.ValidUntil) {
+					return nil
+				}
+				// the role or its validity window has been changed since the previous import
+				ir.RoleID = r.RoleID
+				ir.ValidFrom = record.ValidFrom
+				ir.ValidUntil = record.ValidUntil
+				return repo.Save(ctx, &ir)
+			}
+			if ir.RoleID == r.RoleID {
+				return nil
+			}
+		}
+		return repo.Create(ctx, &role.IdentityRole{
+			Lifecycle:      gormsupport.Lifecycle{CreatedAt: record.CreatedAt},
+			IdentityRoleID: record.IdentityRoleID,
+			IdentityID:     record.IdentityID,
+			ResourceID:     record.ResourceID,
+			RoleID:         r.RoleID,
+			ValidFrom:      record.ValidFrom,
+			ValidUntil:     record.ValidUntil,
+		})
+	})
+}
+
+func equalResourceIDs(id1, id2 *string) bool {
+	if id1 == nil || id2 == nil {
+		return id1 == id2
+	}
+	return *id1 == *id2
+}
+
+func equalTimes(t1, t2 *time.Time) bool {
+	if t1 == nil || t2 == nil {
+		return t1 == t2
+	}
+	return t1.Equal(*t2)
+}
@@ -0,0 +1,268 @@
+package service_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/authentication/account/transfer"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	permission "github.com/fabric8-services/fabric8-auth/authorization/permission/repository"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type userTransferServiceBlackBoxTest struct {
+	gormtestsupport.DBTestSuite
+}
+
+func TestRunUserTransferServiceBlackBoxTest(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &userTransferServiceBlackBoxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+// records encodes the given records as JSON Lines
+func records(t *testing.T, records ...transfer.Record) io.Reader {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	for _, record := range records {
+		require.NoError(t, encoder.Encode(record))
+	}
+	return buf
+}
+
+func (s *userTransferServiceBlackBoxTest) TestExport() {
+	// given
+	g := s.NewTestGraph(s.T())
+	user := g.CreateUser()
+	org := g.CreateOrganization().AddMember(user).AddAdmin(user)
+	resourceType := g.CreateResourceType()
+	validFrom := time.Now().Add(-time.Hour).Round(time.Second).UTC()
+	validUntil := time.Now().Add(time.Hour).Round(time.Second).UTC()
+	res := g.CreateResource(resourceType).AddRoleWithValidity(user, g.CreateRole(resourceType), &validFrom, &validUntil)
+
+	// when
+	buf := &bytes.Buffer{}
+	count, err := s.Application.UserTransferService().Export(s.Ctx, buf)
+
+	// then
+	require.NoError(s.T(), err)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(s.T(), lines, count)
+	found := map[string]transfer.Record{}
+	kinds := []string{}
+	for _, line := range lines {
+		var record transfer.Record
+		require.NoError(s.T(), json.Unmarshal([]byte(line), &record))
+		require.NoError(s.T(), record.Validate())
+		if len(kinds) == 0 || kinds[len(kinds)-1] != record.Kind {
+			kinds = append(kinds, record.Kind)
+		}
+		switch {
+		case record.Resource != nil && record.Resource.ResourceID == org.ResourceID():
+			found["resource"] = record
+		case record.User != nil && record.User.ID == user.User().ID:
+			found["user"] = record
+		case record.Identity != nil && record.Identity.ID == user.IdentityID():
+			found["identity"] = record
+		case record.Identity != nil && record.Identity.ID == org.OrganizationID():
+			found["organization"] = record
+		case record.Membership != nil && record.Membership.MemberID == user.IdentityID():
+			found["membership"] = record
+		case record.IdentityRole != nil && record.IdentityRole.ResourceID == org.ResourceID():
+			found["identity_role"] = record
+		case record.IdentityRole != nil && record.IdentityRole.ResourceID == res.ResourceID():
+			found["identity_role_with_validity"] = record
+		}
+	}
+	// the records are grouped by kind, in the order in which they can be imported
+	assert.Equal(s.T(), []string{transfer.KindResource, transfer.KindUser, transfer.KindIdentity, transfer.KindMembership, transfer.KindIdentityRole}, kinds)
+	require.Len(s.T(), found, 7)
+	assert.Equal(s.T(), authorization.IdentityResourceTypeOrganization, found["resource"].Resource.ResourceType)
+	assert.Equal(s.T(), org.OrganizationName(), found["resource"].Resource.Name)
+	assert.Equal(s.T(), user.User().Email, found["user"].User.Email)
+	assert.Equal(s.T(), user.User().ID, *found["identity"].Identity.UserID)
+	assert.Equal(s.T(), org.ResourceID(), *found["organization"].Identity.IdentityResourceID)
+	assert.Equal(s.T(), org.OrganizationID(), found["membership"].Membership.MemberOf)
+	assert.Equal(s.T(), authorization.OrganizationAdminRole, found["identity_role"].IdentityRole.Role)
+	assert.Equal(s.T(), authorization.IdentityResourceTypeOrganization, found["identity_role"].IdentityRole.ResourceType)
+	assert.Nil(s.T(), found["identity_role"].IdentityRole.ValidFrom)
+	assert.Nil(s.T(), found["identity_role"].IdentityRole.ValidUntil)
+	assert.Equal(s.T(), user.IdentityID(), found["identity_role_with_validity"].IdentityRole.IdentityID)
+	require.NotNil(s.T(), found["identity_role_with_validity"].IdentityRole.ValidFrom)
+	assert.True(s.T(), found["identity_role_with_validity"].IdentityRole.ValidFrom.Equal(validFrom))
+	require.NotNil(s.T(), found["identity_role_with_validity"].IdentityRole.ValidUntil)
+	assert.True(s.T(), found["identity_role_with_validity"].IdentityRole.ValidUntil.Equal(validUntil))
+}
+
+func (s *userTransferServiceBlackBoxTest) TestImport() {
+	// given
+	createdAt := time.Now().Add(-24 * time.Hour).Round(time.Second).UTC()
+	parentID := uuid.NewV4().String()
+	child := transfer.Resource{
+		ResourceID:       uuid.NewV4().String(),
+		ParentResourceID: &parentID,
+		ResourceType:     authorization.ResourceTypeSpace,
+		Name:             "child",
+	}
+	parent := transfer.Resource{
+		ResourceID:   parentID,
+		ResourceType: authorization.ResourceTypeSpace,
+		Name:         "parent",
+	}
+	orgResource := transfer.Resource{
+		ResourceID:   uuid.NewV4().String(),
+		ResourceType: authorization.IdentityResourceTypeOrganization,
+		Name:         "org-" + uuid.NewV4().String(),
+	}
+	user := transfer.User{
+		ID:           uuid.NewV4(),
+		Email:        uuid.NewV4().String() + "@example.com",
+		FullName:     "John Doe",
+		FeatureLevel: account.DefaultFeatureLevel,
+		CreatedAt:    createdAt,
+	}
+	identity := transfer.Identity{
+		ID:           uuid.NewV4(),
+		Username:     "user-" + uuid.NewV4().String(),
+		ProviderType: account.DefaultIDP,
+		UserID:       &user.ID,
+		CreatedAt:    createdAt,
+	}
+	orgIdentity := transfer.Identity{
+		ID:                 uuid.NewV4(),
+		IdentityResourceID: &orgResource.ResourceID,
+	}
+	membership := transfer.Membership{MemberOf: orgIdentity.ID, MemberID: identity.ID}
+	validUntil := time.Now().Add(24 * time.Hour).Round(time.Second).UTC()
+	identityRole := transfer.IdentityRole{
+		IdentityRoleID: uuid.NewV4(),
+		IdentityID:     identity.ID,
+		ResourceID:     parentID,
+		Role:           authorization.SpaceAdminRole,
+		ResourceType:   authorization.ResourceTypeSpace,
+		ValidUntil:     &validUntil,
+	}
+	all := []transfer.Record{
+		{Kind: transfer.KindResource, Resource: &child},
+		{Kind: transfer.KindResource, Resource: &parent},
+		{Kind: transfer.KindResource, Resource: &orgResource},
+		{Kind: transfer.KindUser, User: &user},
+		{Kind: transfer.KindIdentity, Identity: &identity},
+		{Kind: transfer.KindIdentity, Identity: &orgIdentity},
+		{Kind: transfer.KindMembership, Membership: &membership},
+		{Kind: transfer.KindIdentityRole, IdentityRole: &identityRole},
+	}
+
+	s.T().Run("ok", func(t *testing.T) {
+		// when
+		count, err := s.Application.UserTransferService().Import(s.Ctx, records(t, all[:7]...))
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 7, count)
+		// the child resource has been imported after its parent
+		loadedChild, err := s.Application.ResourceRepository().Load(s.Ctx, child.ResourceID)
+		require.NoError(t, err)
+		assert.Equal(t, parentID, *loadedChild.ParentResourceID)
+		loaded, err := s.Application.Identities().LoadWithUser(s.Ctx, identity.ID)
+		require.NoError(t, err)
+		assert.Equal(t, identity.Username, loaded.Username)
+		assert.Equal(t, user.Email, loaded.User.Email)
+		assert.True(t, loaded.CreatedAt.Equal(createdAt))
+		assert.True(t, loaded.User.CreatedAt.Equal(createdAt))
+		members, err := s.Application.Identities().Query(account.IdentityFilterByMemberOf(orgIdentity.ID))
+		require.NoError(t, err)
+		require.Len(t, members, 1)
+		assert.Equal(t, identity.ID, members[0].ID)
+
+		// given
+		cache := &permission.PrivilegeCache{
+			IdentityID: identity.ID,
+			ResourceID: child.ResourceID,
+			ExpiryTime: time.Now().Add(time.Hour),
+		}
+		require.NoError(t, s.Application.PrivilegeCacheRepository().Create(s.Ctx, cache))
+		// when
+		count, err = s.Application.UserTransferService().Import(s.Ctx, records(t, all[7]))
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		scopes, err := s.Application.IdentityRoleRepository().FindScopesByIdentityAndResource(s.Ctx, identity.ID, child.ResourceID)
+		require.NoError(t, err)
+		assert.Contains(t, scopes, authorization.ManageSpaceScope)
+		loadedRole, err := s.Application.IdentityRoleRepository().Load(s.Ctx, identityRole.IdentityRoleID)
+		require.NoError(t, err)
+		assert.Nil(t, loadedRole.ValidFrom)
+		require.NotNil(t, loadedRole.ValidUntil)
+		assert.True(t, loadedRole.ValidUntil.Equal(validUntil))
+		cache, err = s.Application.PrivilegeCacheRepository().Load(s.Ctx, cache.PrivilegeCacheID)
+		require.NoError(t, err)
+		assert.True(t, cache.Stale)
+	})
+
+	s.T().Run("import again", func(t *testing.T) {
+		// given
+		updated := user
+		updated.FullName = "Johnny Doe"
+		// the validity window of the role has been changed since the previous import
+		validFrom := createdAt
+		updatedRole := identityRole
+		updatedRole.ValidFrom = &validFrom
+		updatedRole.ValidUntil = nil
+		again := append([]transfer.Record{}, all...)
+		again[3] = transfer.Record{Kind: transfer.KindUser, User: &updated}
+		again[7] = transfer.Record{Kind: transfer.KindIdentityRole, IdentityRole: &updatedRole}
+		// when
+		count, err := s.Application.UserTransferService().Import(s.Ctx, records(t, again...))
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 8, count)
+		loaded, err := s.Application.Users().Load(s.Ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Johnny Doe", loaded.FullName)
+		assert.True(t, loaded.CreatedAt.Equal(createdAt))
+		members, err := s.Application.Identities().Query(account.IdentityFilterByMemberOf(orgIdentity.ID))
+		require.NoError(t, err)
+		assert.Len(t, members, 1)
+		identityRoles, err := s.Application.IdentityRoleRepository().FindIdentityRolesByIdentityAndResource(s.Ctx, parentID, identity.ID)
+		require.NoError(t, err)
+		require.Len(t, identityRoles, 1)
+		assert.Equal(t, identityRole.IdentityRoleID, identityRoles[0].IdentityRoleID)
+		require.NotNil(t, identityRoles[0].ValidFrom)
+		assert.True(t, identityRoles[0].ValidFrom.Equal(validFrom))
+		assert.Nil(t, identityRoles[0].ValidUntil)
+	})
+
+	s.T().Run("missing parent", func(t *testing.T) {
+		// given
+		missingID := uuid.NewV4().String()
+		orphan := transfer.Resource{
+			ResourceID:       uuid.NewV4().String(),
+			ParentResourceID: &missingID,
+			ResourceType:     authorization.ResourceTypeSpace,
+		}
+		// when
+		count, err := s.Application.UserTransferService().Import(s.Ctx, records(t, transfer.Record{Kind: transfer.KindResource, Resource: &orphan}))
+		// then
+		testsupport.AssertError(t, err, errors.NotFoundError{}, "parent resource with id '%s' not found", missingID)
+		assert.Equal(t, 0, count)
+	})
+
+	s.T().Run("invalid record", func(t *testing.T) {
+		// when
+		_, err := s.Application.UserTransferService().Import(s.Ctx, strings.NewReader(`{"kind":"user"}`))
+		// then
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "invalid record 1: Bad value for parameter 'kind': 'user' - the record has no user")
+	})
+}
@@ -0,0 +1,224 @@
+package transfer
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/authentication/account"
+	accountrepo "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	resource "github.com/fabric8-services/fabric8-auth/authorization/resource/repository"
+	"github.com/fabric8-services/fabric8-auth/errors"
+
+	"github.com/satori/go.uuid"
+)
+
+const (
+	// KindResource is the kind of the resource records
+	KindResource = "resource"
+	// KindUser is the kind of the user records
+	KindUser = "user"
+	// KindIdentity is the kind of the identity records
+	KindIdentity = "identity"
+	// KindMembership is the kind of the membership records
+	KindMembership = "membership"
+	// KindIdentityRole is the kind of the identity role records
+	KindIdentityRole = "identity_role"
+)
+
+// Record is a line of an export. The records are written in the order in which they can be imported: the resources,
+// then the users, the identities, the memberships and finally the identity roles. Only the entry of the record kind
+// is set.
+type Record struct {
+	Kind         string        `json:"kind"`
+	Resource     *Resource     `json:"resource,omitempty"`
+	User         *User         `json:"user,omitempty"`
+	Identity     *Identity     `json:"identity,omitempty"`
+	Membership   *Membership   `json:"membership,omitempty"`
+	IdentityRole *IdentityRole `json:"identity_role,omitempty"`
+}
+
+// Validate returns a BadParameterError if the entry of the record doesn't match its kind
+func (r Record) Validate() error {
+	var ok bool
+	switch r.Kind {
+	case KindResource:
+		ok = r.Resource != nil
+	case KindUser:
+		ok = r.User != nil
+	case KindIdentity:
+		ok = r.Identity != nil
+	case KindMembership:
+		ok = r.Membership != nil
+	case KindIdentityRole:
+		ok = r.IdentityRole != nil
+	default:
+		return errors.NewBadParameterErrorFromString("kind", r.Kind, "unknown kind of record")
+	}
+	if !ok {
+		return errors.NewBadParameterErrorFromString("kind", r.Kind, fmt.Sprintf("the record has no %s", r.Kind))
+	}
+	return nil
+}
+
+// Resource is the record of a resource. Its type is referenced by name, since the IDs of the resource types differ
+// between environments.
+type Resource struct {
+	ResourceID       string    `json:"resource_id"`
+	ParentResourceID *string   `json:"parent_resource_id,omitempty"`
+	ResourceType     string    `json:"resource_type"`
+	Name             string    `json:"name"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// NewResource returns the record of the given resource, whose resource type must be loaded
+func NewResource(r resource.Resource) Resource {
+	return Resource{
+		ResourceID:       r.ResourceID,
+		ParentResourceID: r.ParentResourceID,
+		ResourceType:     r.ResourceType.Name,
+		Name:             r.Name,
+		CreatedAt:        r.CreatedAt,
+	}
+}
+
+// Update sets the fields of the given resource, except its resource type, with the values of the record
+func (r Resource) Update(res *resource.Resource) {
+	res.ResourceID = r.ResourceID
+	res.ParentResourceID = r.ParentResourceID
+	res.Name = r.Name
+	if res.CreatedAt.IsZero() {
+		res.CreatedAt = r.CreatedAt
+	}
+}
+
+// User is the record of a user account
+type User struct {
+	ID                 uuid.UUID                  `json:"id"`
+	Email              string                     `json:"email"`
+	EmailPrivate       bool                       `json:"email_private"`
+	EmailVerified      bool                       `json:"email_verified"`
+	FullName           string                     `json:"full_name"`
+	ImageURL           string                     `json:"image_url"`
+	Bio                string                     `json:"bio"`
+	URL                string                     `json:"url"`
+	Company            string                     `json:"company"`
+	FeatureLevel       string                     `json:"feature_level"`
+	Cluster            string                     `json:"cluster"`
+	Deprovisioned      bool                       `json:"deprovisioned"`
+	ContextInformation account.ContextInformation `json:"context_information,omitempty"`
+	CreatedAt          time.Time                  `json:"created_at"`
+}
+
+// NewUser returns the record of the given user
+func NewUser(u accountrepo.User) User {
+	return User{
+		ID:                 u.ID,
+		Email:              u.Email,
+		EmailPrivate:       u.EmailPrivate,
+		EmailVerified:      u.EmailVerified,
+		FullName:           u.FullName,
+		ImageURL:           u.ImageURL,
+		Bio:                u.Bio,
+		URL:                u.URL,
+		Company:            u.Company,
+		FeatureLevel:       u.FeatureLevel,
+		Cluster:            u.Cluster,
+		Deprovisioned:      u.Deprovisioned,
+		ContextInformation: u.ContextInformation,
+		CreatedAt:          u.CreatedAt,
+	}
+}
+
+// Update sets the fields of the given user with the values of the record. The creation time is only set on the new
+// users, and the last modification time is left to the repository.
+func (u User) Update(user *accountrepo.User) {
+	user.ID = u.ID
+	user.Email = u.Email
+	user.EmailPrivate = u.EmailPrivate
+	user.EmailVerified = u.EmailVerified
+	user.FullName = u.FullName
+	user.ImageURL = u.ImageURL
+	user.Bio = u.Bio
+	user.URL = u.URL
+	user.Company = u.Company
+	user.FeatureLevel = u.FeatureLevel
+	user.Cluster = u.Cluster
+	user.Deprovisioned = u.Deprovisioned
+	user.ContextInformation = u.ContextInformation
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = u.CreatedAt
+	}
+}
+
+// Identity is the record of an identity, which belongs to a user or to a resource such as a team or an organization
+type Identity struct {
+	ID                    uuid.UUID  `json:"id"`
+	Username              string     `json:"username"`
+	RegistrationCompleted bool       `json:"registration_completed"`
+	ProviderType          string     `json:"provider_type"`
+	ProfileURL            *string    `json:"profile_url,omitempty"`
+	UserID                *uuid.UUID `json:"user_id,omitempty"`
+	IdentityResourceID    *string    `json:"identity_resource_id,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+// NewIdentity returns the record of the given identity
+func NewIdentity(i accountrepo.Identity) Identity {
+	identity := Identity{
+		ID:                    i.ID,
+		Username:              i.Username,
+		RegistrationCompleted: i.RegistrationCompleted,
+		ProviderType:          i.ProviderType,
+		ProfileURL:            i.ProfileURL,
+		CreatedAt:             i.CreatedAt,
+	}
+	if i.UserID.Valid {
+		userID := i.UserID.UUID
+		identity.UserID = &userID
+	}
+	if i.IdentityResourceID.Valid {
+		resourceID := i.IdentityResourceID.String
+		identity.IdentityResourceID = &resourceID
+	}
+	return identity
+}
+
+// Update sets the fields of the given identity with the values of the record
+func (i Identity) Update(identity *accountrepo.Identity) {
+	identity.ID = i.ID
+	identity.Username = i.Username
+	identity.RegistrationCompleted = i.RegistrationCompleted
+	identity.ProviderType = i.ProviderType
+	identity.ProfileURL = i.ProfileURL
+	identity.UserID = accountrepo.NullUUID{}
+	if i.UserID != nil {
+		identity.UserID = accountrepo.NullUUID{UUID: *i.UserID, Valid: true}
+	}
+	identity.IdentityResourceID = sql.NullString{}
+	if i.IdentityResourceID != nil {
+		identity.IdentityResourceID = sql.NullString{String: *i.IdentityResourceID, Valid: true}
+	}
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = i.CreatedAt
+	}
+}
+
+// Membership is the record of the membership of an identity in a team, an organization or a group
+type Membership struct {
+	MemberOf uuid.UUID `json:"member_of"`
+	MemberID uuid.UUID `json:"member_id"`
+}
+
+// IdentityRole is the record of a role assigned to an identity for a resource. The role is referenced by its name and
+// by the name of its resource type, since the IDs of the roles differ between environments.
+type IdentityRole struct {
+	IdentityRoleID uuid.UUID  `json:"identity_role_id"`
+	IdentityID     uuid.UUID  `json:"identity_id"`
+	ResourceID     string     `json:"resource_id"`
+	Role           string     `json:"role"`
+	ResourceType   string     `json:"resource_type"`
+	ValidFrom      *time.Time `json:"valid_from,omitempty"`
+	ValidUntil     *time.Time `json:"valid_until,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
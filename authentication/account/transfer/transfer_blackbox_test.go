@@ -0,0 +1,81 @@
+package transfer_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/authentication/account/transfer"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRecord(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	t.Run("ok", func(t *testing.T) {
+		err := transfer.Record{Kind: transfer.KindMembership, Membership: &transfer.Membership{}}.Validate()
+		require.NoError(t, err)
+	})
+
+	t.Run("unknown kind", func(t *testing.T) {
+		err := transfer.Record{Kind: "space", Resource: &transfer.Resource{}}.Validate()
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'kind': 'space' - unknown kind of record")
+	})
+
+	t.Run("mismatching kind", func(t *testing.T) {
+		err := transfer.Record{Kind: transfer.KindIdentity, User: &transfer.User{}}.Validate()
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'kind': 'identity' - the record has no identity")
+	})
+}
+
+func TestUpdateIdentity(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	createdAt := time.Now().Add(-time.Hour)
+
+	t.Run("new identity", func(t *testing.T) {
+		// given
+		userID := uuid.NewV4()
+		identity := account.Identity{
+			Lifecycle:    gormsupport.Lifecycle{CreatedAt: createdAt},
+			ID:           uuid.NewV4(),
+			Username:     "john",
+			ProviderType: account.DefaultIDP,
+			UserID:       account.NullUUID{UUID: userID, Valid: true},
+		}
+		// when
+		imported := account.Identity{}
+		transfer.NewIdentity(identity).Update(&imported)
+		// then
+		assert.Equal(t, identity, imported)
+	})
+
+	t.Run("existing identity", func(t *testing.T) {
+		// given
+		resourceID := uuid.NewV4().String()
+		record := transfer.Identity{
+			ID:                 uuid.NewV4(),
+			IdentityResourceID: &resourceID,
+			CreatedAt:          createdAt,
+		}
+		existing := account.Identity{
+			Lifecycle: gormsupport.Lifecycle{CreatedAt: time.Now()},
+			ID:        record.ID,
+			UserID:    account.NullUUID{UUID: uuid.NewV4(), Valid: true},
+		}
+		// when
+		record.Update(&existing)
+		// then
+		assert.False(t, existing.UserID.Valid)
+		assert.Equal(t, sql.NullString{String: resourceID, Valid: true}, existing.IdentityResourceID)
+		// the creation time of the existing identities is kept
+		assert.NotEqual(t, createdAt, existing.CreatedAt)
+	})
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"github.com/fabric8-services/fabric8-auth/authorization/token"
 	"net/url"
-	"regexp"
 
 	"github.com/fabric8-services/fabric8-auth/application/service"
 	"github.com/fabric8-services/fabric8-auth/application/service/base"
@@ -41,27 +40,9 @@ func (s *logoutServiceImpl) Logout(ctx context.Context, redirectURL string) (str
 		}, "Redirect URL is not valid")
 		return "", errors.NewBadParameterErrorFromString("redirect", redirectURL, "not valid redirect URL")
 	}
-	matched, err := regexp.MatchString(s.config.GetValidRedirectURLs(), redirectURL)
-	log.Debug(ctx, map[string]interface{}{
-		"redirect_url":        redirectURL,
-		"valid_redirect_urls": s.config.GetValidRedirectURLs(),
-		"matched":             matched,
-		"error":               err,
-	}, "matched redirect URL and whitelist regex")
+	err := s.Services().OAuthClientService().ValidateReferrer(ctx, nil, redirectURL)
 	if err != nil {
-		log.Error(ctx, map[string]interface{}{
-			"redirect_url":        redirectURL,
-			"valid_redirect_urls": s.config.GetValidRedirectURLs(),
-			"err":                 err,
-		}, "Can't match redirect URL and whitelist regex")
-		return "", errors.NewInternalError(ctx, err)
-	}
-	if !matched {
-		log.Error(ctx, map[string]interface{}{
-			"redirect_url":       redirectURL,
-			"valid_redirect_url": s.config.GetValidRedirectURLs(),
-		}, "Redirect URL is not valid")
-		return "", errors.NewBadParameterErrorFromString("redirect", redirectURL, "not valid redirect URL")
+		return "", err
 	}
 	logoutURL, err := url.Parse(s.config.GetOAuthProviderEndpointLogout())
 	if err != nil {
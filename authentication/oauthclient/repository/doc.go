@@ -0,0 +1,2 @@
+// Package repository provides the wrappers for 'oauth client' related database interactions.
+package repository
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	oauthClientTableName = "oauth_clients"
+
+	// GrantTypeAuthorizationCode is the grant type of the OAuth2 authorization code flow
+	GrantTypeAuthorizationCode = "authorization_code"
+	// GrantTypeRefreshToken is the grant type used to refresh a token
+	GrantTypeRefreshToken = "refresh_token"
+	// GrantTypeClientCredentials is the grant type used by the clients to obtain a token for themselves
+	GrantTypeClientCredentials = "client_credentials"
+	// GrantTypeDeviceCode is the grant type of the OAuth2 device authorization flow, as defined by RFC 8628
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+	// GrantTypeTokenExchange is the grant type used by the clients to exchange the token of a user for a token
+	// issued to them on behalf of the user, as defined by RFC 8693
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// RedirectURIMatchExact is the matching mode of the clients whose redirect URIs must be equal to one of the
+	// registered redirect URIs
+	RedirectURIMatchExact = "exact"
+	// RedirectURIMatchPrefix is the matching mode of the clients whose redirect URIs must start with one of the
+	// registered redirect URIs
+	RedirectURIMatchPrefix = "prefix"
+)
+
+// OAuthClient represents an OAuth client allowed to request tokens
+type OAuthClient struct {
+	gormsupport.Lifecycle
+	OAuthClientID uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key;column:oauth_client_id"`
+	// The ID used by the client in the authorization and token requests
+	ClientID string `gorm:"column:client_id"`
+	Name     string `gorm:"column:name"`
+	// The redirect URIs which can be used in the authorization requests of this client
+	RedirectURIs pq.StringArray `sql:"type:text[]" gorm:"column:redirect_uris"`
+	// How the redirect URIs of the authorization requests are matched against the registered redirect URIs:
+	// RedirectURIMatchExact or RedirectURIMatchPrefix
+	RedirectURIMatch string `gorm:"column:redirect_uri_match"`
+	// The grant types which can be used by this client in the token requests
+	GrantTypes pq.StringArray `sql:"type:text[]" gorm:"column:grant_types"`
+	// The bcrypt hashes of the secrets of the client. A client without secret is a public client.
+	SecretHashes pq.StringArray `sql:"type:text[]" gorm:"column:secret_hashes"`
+	// Whether the client was registered with the RFC 7591 registration endpoint
+	DynamicallyRegistered bool       `gorm:"column:dynamically_registered"`
+	CreatedBy             *uuid.UUID `sql:"type:uuid" gorm:"column:created_by"`
+}
+
+// TableName implements gorm.tabler
+func (c OAuthClient) TableName() string {
+	return oauthClientTableName
+}
+
+// Confidential returns true if the client must authenticate with a secret
+func (c OAuthClient) Confidential() bool {
+	return len(c.SecretHashes) > 0
+}
+
+// HasGrantType returns true if the client is allowed to use the given grant type
+func (c OAuthClient) HasGrantType(grantType string) bool {
+	for _, t := range c.GrantTypes {
+		if t == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthClientRepository encapsulate storage & retrieval of OAuth clients
+type OAuthClientRepository interface {
+	Create(ctx context.Context, client *OAuthClient) error
+	Save(ctx context.Context, client *OAuthClient) error
+	Delete(ctx context.Context, ID uuid.UUID) error
+	LoadByClientID(ctx context.Context, clientID string) (*OAuthClient, error)
+	List(ctx context.Context) ([]OAuthClient, error)
+}
+
+// NewOAuthClientRepository creates a new OAuth client repo
+func NewOAuthClientRepository(db *gorm.DB) *GormOAuthClientRepository {
+	return &GormOAuthClientRepository{db}
+}
+
+// GormOAuthClientRepository implements OAuthClientRepository using gorm
+type GormOAuthClientRepository struct {
+	db *gorm.DB
+}
+
+// Create creates a new OAuth client in the DB
+// returns DataConflictError if a client with the same client ID already exists. Otherwise returns InternalError
+func (r *GormOAuthClientRepository) Create(ctx context.Context, client *OAuthClient) error {
+	defer goa.MeasureSince([]string{"goa", "db", "oauth_clients", "create"}, time.Now())
+	if client.OAuthClientID == uuid.Nil {
+		client.OAuthClientID = uuid.NewV4()
+	}
+	client.RedirectURIs = nonNil(client.RedirectURIs)
+	client.GrantTypes = nonNil(client.GrantTypes)
+	client.SecretHashes = nonNil(client.SecretHashes)
+	if client.RedirectURIMatch == "" {
+		client.RedirectURIMatch = RedirectURIMatchExact
+	}
+
+	err := r.db.Create(client).Error
+	if err != nil {
+		if gormsupport.IsUniqueViolation(err, "idx_oauth_clients_client_id") {
+			return errors.NewDataConflictError(fmt.Sprintf("oauth client with client_id %s already exists", client.ClientID))
+		}
+		log.Error(ctx, map[string]interface{}{
+			"client_id": client.ClientID,
+			"err":       err,
+		}, "unable to create the oauth client")
+		return errors.NewInternalError(ctx, err)
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"oauth_client_id": client.OAuthClientID,
+		"client_id":       client.ClientID,
+	}, "OAuth client created successfully")
+	return nil
+}
+
+// Save updates the name, redirect URIs and their matching mode, grant types and secret hashes of the given OAuth client in the DB
+// returns NotFoundError or InternalError
+func (r *GormOAuthClientRepository) Save(ctx context.Context, client *OAuthClient) error {
+	defer goa.MeasureSince([]string{"goa", "db", "oauth_clients", "save"}, time.Now())
+	// the fields are updated with a map so that the lists can be emptied
+	tx := r.db.Model(client).Updates(map[string]interface{}{
+		"name":               client.Name,
+		"redirect_uris":      nonNil(client.RedirectURIs),
+		"redirect_uri_match": client.RedirectURIMatch,
+		"grant_types":        nonNil(client.GrantTypes),
+		"secret_hashes":      nonNil(client.SecretHashes),
+	})
+	if err := tx.Error; err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"oauth_client_id": client.OAuthClientID.String(),
+			"err":             err,
+		}, "unable to update the oauth client")
+		return errors.NewInternalError(ctx, err)
+	}
+	if tx.RowsAffected == 0 {
+		return errors.NewNotFoundError("oauth client", client.OAuthClientID.String())
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"oauth_client_id": client.OAuthClientID,
+		"client_id":       client.ClientID,
+	}, "OAuth client saved")
+	return nil
+}
+
+// Delete deletes the OAuth client with the given id
+// returns NotFoundError or InternalError
+func (r *GormOAuthClientRepository) Delete(ctx context.Context, ID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "oauth_clients", "delete"}, time.Now())
+	if ID == uuid.Nil {
+		return errors.NewNotFoundError("oauth client", ID.String())
+	}
+	tx := r.db.Delete(OAuthClient{OAuthClientID: ID})
+
+	if err := tx.Error; err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"oauth_client_id": ID.String(),
+			"err":             err,
+		}, "unable to delete the oauth client")
+		return errors.NewInternalError(ctx, err)
+	}
+	if tx.RowsAffected == 0 {
+		return errors.NewNotFoundError("oauth client", ID.String())
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"oauth_client_id": ID,
+	}, "OAuth client deleted")
+	return nil
+}
+
+// LoadByClientID loads the OAuth client with the given client ID
+// returns NotFoundError or InternalError
+func (r *GormOAuthClientRepository) LoadByClientID(ctx context.Context, clientID string) (*OAuthClient, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "oauth_clients", "load"}, time.Now())
+	client := OAuthClient{}
+
+	tx := r.db.Where("client_id = ?", clientID).First(&client)
+	if tx.RecordNotFound() {
+		return nil, errors.NewNotFoundErrorWithKey("oauth client", "client_id", clientID)
+	}
+	if tx.Error != nil {
+		return nil, errors.NewInternalError(ctx, tx.Error)
+	}
+	return &client, nil
+}
+
+// List returns all the OAuth clients, ordered by creation date
+func (r *GormOAuthClientRepository) List(ctx context.Context) ([]OAuthClient, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "oauth_clients", "list"}, time.Now())
+	var clients []OAuthClient
+	err := r.db.Order("created_at").Find(&clients).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	return clients, nil
+}
+
+// nonNil returns an empty array if the given array is nil, since the columns of the lists are not nullable
+func nonNil(a pq.StringArray) pq.StringArray {
+	if a == nil {
+		return pq.StringArray{}
+	}
+	return a
+}
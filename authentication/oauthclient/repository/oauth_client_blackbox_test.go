@@ -0,0 +1,150 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/authentication/oauthclient/repository"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+
+	"github.com/lib/pq"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type oauthClientBlackBoxTest struct {
+	gormtestsupport.DBTestSuite
+	repo repository.OAuthClientRepository
+}
+
+func TestRunOAuthClientBlackBoxTest(t *testing.T) {
+	suite.Run(t, &oauthClientBlackBoxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *oauthClientBlackBoxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.repo = repository.NewOAuthClientRepository(s.DB)
+}
+
+func (s *oauthClientBlackBoxTest) newOAuthClient() *repository.OAuthClient {
+	client := &repository.OAuthClient{
+		ClientID:     uuid.NewV4().String(),
+		Name:         "test client",
+		RedirectURIs: pq.StringArray{"https://client.example.com/callback"},
+		GrantTypes:   pq.StringArray{repository.GrantTypeAuthorizationCode, repository.GrantTypeRefreshToken},
+		SecretHashes: pq.StringArray{"hash"},
+	}
+	err := s.repo.Create(s.Ctx, client)
+	require.NoError(s.T(), err, "Could not create oauth client")
+	return client
+}
+
+func (s *oauthClientBlackBoxTest) TestCreateLoad() {
+	// given
+	client := s.newOAuthClient()
+
+	// when
+	loaded, err := s.repo.LoadByClientID(s.Ctx, client.ClientID)
+
+	// then
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), client.OAuthClientID, loaded.OAuthClientID)
+	assert.Equal(s.T(), client.Name, loaded.Name)
+	assert.Equal(s.T(), client.RedirectURIs, loaded.RedirectURIs)
+	assert.Equal(s.T(), repository.RedirectURIMatchExact, loaded.RedirectURIMatch)
+	assert.Equal(s.T(), client.GrantTypes, loaded.GrantTypes)
+	assert.Equal(s.T(), client.SecretHashes, loaded.SecretHashes)
+	assert.True(s.T(), loaded.Confidential())
+	assert.True(s.T(), loaded.HasGrantType(repository.GrantTypeAuthorizationCode))
+	assert.False(s.T(), loaded.HasGrantType(repository.GrantTypeClientCredentials))
+}
+
+func (s *oauthClientBlackBoxTest) TestCreateConflict() {
+	// given
+	client := s.newOAuthClient()
+
+	// when
+	err := s.repo.Create(s.Ctx, &repository.OAuthClient{
+		ClientID: client.ClientID,
+		Name:     "other client",
+	})
+
+	// then
+	require.IsType(s.T(), errors.DataConflictError{}, err)
+}
+
+func (s *oauthClientBlackBoxTest) TestLoadUnknown() {
+	_, err := s.repo.LoadByClientID(s.Ctx, uuid.NewV4().String())
+	require.IsType(s.T(), errors.NotFoundError{}, err)
+}
+
+func (s *oauthClientBlackBoxTest) TestSave() {
+	// given
+	client := s.newOAuthClient()
+
+	s.T().Run("ok", func(t *testing.T) {
+		// when
+		client.Name = "updated client"
+		client.RedirectURIs = pq.StringArray{"https://client.example.com/other"}
+		client.RedirectURIMatch = repository.RedirectURIMatchPrefix
+		client.SecretHashes = pq.StringArray{}
+		err := s.repo.Save(s.Ctx, client)
+
+		// then
+		require.NoError(t, err)
+		loaded, err := s.repo.LoadByClientID(s.Ctx, client.ClientID)
+		require.NoError(t, err)
+		assert.Equal(t, "updated client", loaded.Name)
+		assert.Equal(t, pq.StringArray{"https://client.example.com/other"}, loaded.RedirectURIs)
+		assert.Equal(t, repository.RedirectURIMatchPrefix, loaded.RedirectURIMatch)
+		assert.Empty(t, loaded.SecretHashes)
+		assert.False(t, loaded.Confidential())
+	})
+
+	s.T().Run("unknown client", func(t *testing.T) {
+		err := s.repo.Save(s.Ctx, &repository.OAuthClient{OAuthClientID: uuid.NewV4()})
+		require.IsType(t, errors.NotFoundError{}, err)
+	})
+}
+
+func (s *oauthClientBlackBoxTest) TestDelete() {
+	// given
+	client := s.newOAuthClient()
+	other := s.newOAuthClient()
+
+	// when
+	err := s.repo.Delete(s.Ctx, client.OAuthClientID)
+
+	// then
+	require.NoError(s.T(), err)
+	_, err = s.repo.LoadByClientID(s.Ctx, client.ClientID)
+	require.IsType(s.T(), errors.NotFoundError{}, err)
+	_, err = s.repo.LoadByClientID(s.Ctx, other.ClientID)
+	require.NoError(s.T(), err)
+	// the client ID can be reused once the client is deleted
+	err = s.repo.Create(s.Ctx, &repository.OAuthClient{ClientID: client.ClientID, Name: "new client"})
+	require.NoError(s.T(), err)
+	// unknown client
+	err = s.repo.Delete(s.Ctx, uuid.NewV4())
+	require.IsType(s.T(), errors.NotFoundError{}, err)
+}
+
+func (s *oauthClientBlackBoxTest) TestList() {
+	// given
+	client := s.newOAuthClient()
+	other := s.newOAuthClient()
+
+	// when
+	clients, err := s.repo.List(s.Ctx)
+
+	// then
+	require.NoError(s.T(), err)
+	clientIDs := []string{}
+	for _, c := range clients {
+		clientIDs = append(clientIDs, c.ClientID)
+	}
+	assert.Contains(s.T(), clientIDs, client.ClientID)
+	assert.Contains(s.T(), clientIDs, other.ClientID)
+}
@@ -0,0 +1,2 @@
+// Package service provides the services for registering and authenticating OAuth clients.
+package service
@@ -0,0 +1,500 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/fabric8-services/fabric8-auth/application/service"
+	"github.com/fabric8-services/fabric8-auth/application/service/base"
+	servicecontext "github.com/fabric8-services/fabric8-auth/application/service/context"
+	oauthclient "github.com/fabric8-services/fabric8-auth/authentication/oauthclient/repository"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	"github.com/fabric8-services/fabric8-auth/configuration"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/lib/pq"
+	"github.com/satori/go.uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// TokenEndpointAuthMethodNone is the authentication method of the public clients, which have no secret
+	TokenEndpointAuthMethodNone = "none"
+	// TokenEndpointAuthMethodClientSecretPost is the authentication method of the confidential clients, which send
+	// their secret in the token request
+	TokenEndpointAuthMethodClientSecretPost = "client_secret_post"
+
+	// errors of the client registration, as defined by RFC 7591
+	registrationErrorInvalidRedirectURI    = "invalid_redirect_uri"
+	registrationErrorInvalidClientMetadata = "invalid_client_metadata"
+
+	// clientSecretSize is the number of random bytes of the generated client secrets
+	clientSecretSize = 32
+)
+
+// OAuthClientServiceConfiguration the required configuration for the OAuth client service implementation
+type OAuthClientServiceConfiguration interface {
+	GetPublicOAuthClientID() string
+	GetServiceAccounts() map[string]configuration.ServiceAccount
+	GetValidRedirectURLs() string
+	IsRedirectValidationLogOnly() bool
+}
+
+type oauthClientServiceImpl struct {
+	base.BaseService
+	config OAuthClientServiceConfiguration
+}
+
+// NewOAuthClientService returns a new OAuthClientService implementation
+func NewOAuthClientService(context servicecontext.ServiceContext, config OAuthClientServiceConfiguration) service.OAuthClientService {
+	return &oauthClientServiceImpl{
+		BaseService: base.NewBaseService(context),
+		config:      config,
+	}
+}
+
+// LoadClient returns the OAuth client with the given client ID. The public client and the service accounts of the
+// configuration are looked up first, then the registered clients.
+// Returns NotFoundError if there is no such client
+func (s *oauthClientServiceImpl) LoadClient(ctx context.Context, clientID string) (*oauthclient.OAuthClient, error) {
+	if client := s.configuredClient(clientID); client != nil {
+		return client, nil
+	}
+	var client *oauthclient.OAuthClient
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		client, err = s.Repositories().OAuthClients().LoadByClientID(ctx, clientID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// configuredClient returns the public client or the service account of the configuration with the given ID, if any
+func (s *oauthClientServiceImpl) configuredClient(clientID string) *oauthclient.OAuthClient {
+	// Default value of this public client id is set to "740650a2-9c44-4db5-b067-a3d1b2cd2d01"
+	if clientID == s.config.GetPublicOAuthClientID() {
+		return &oauthclient.OAuthClient{
+			ClientID: clientID,
+			Name:     "public client",
+			GrantTypes: pq.StringArray{
+				oauthclient.GrantTypeAuthorizationCode,
+				oauthclient.GrantTypeRefreshToken,
+				oauthclient.GrantTypeDeviceCode,
+			},
+		}
+	}
+	if sa, found := s.config.GetServiceAccounts()[clientID]; found {
+		return &oauthclient.OAuthClient{
+			ClientID:     sa.ID,
+			Name:         sa.Name,
+			GrantTypes:   pq.StringArray{oauthclient.GrantTypeClientCredentials, oauthclient.GrantTypeTokenExchange},
+			SecretHashes: pq.StringArray(sa.Secrets),
+		}
+	}
+	return nil
+}
+
+// LoadClientForGrantType returns the OAuth client with the given client ID if the client is allowed to use the given
+// grant type. The grant type is not checked if it is empty.
+// Returns UnauthorizedError otherwise.
+func (s *oauthClientServiceImpl) LoadClientForGrantType(ctx context.Context, clientID string, grantType string) (*oauthclient.OAuthClient, error) {
+	client, err := s.LoadClient(ctx, clientID)
+	if err != nil {
+		if notFound, _ := errors.IsNotFoundError(err); notFound {
+			log.Error(ctx, map[string]interface{}{
+				"client_id": clientID,
+			}, "unknown oauth client id")
+			return nil, errors.NewUnauthorizedError("invalid oauth client id")
+		}
+		return nil, err
+	}
+	if grantType != "" && !client.HasGrantType(grantType) {
+		log.Error(ctx, map[string]interface{}{
+			"client_id":  clientID,
+			"grant_type": grantType,
+		}, "grant type not allowed for oauth client")
+		return nil, errors.NewUnauthorizedError(fmt.Sprintf("grant type %s is not allowed for the oauth client", grantType))
+	}
+	return client, nil
+}
+
+// AuthenticateClient is the same as LoadClientForGrantType, except that the given secret must also match one of the
+// secrets of the client if it is a confidential client.
+// Returns UnauthorizedError otherwise.
+func (s *oauthClientServiceImpl) AuthenticateClient(ctx context.Context, clientID string, clientSecret *string, grantType string) (*oauthclient.OAuthClient, error) {
+	client, err := s.LoadClientForGrantType(ctx, clientID, grantType)
+	if err != nil {
+		return nil, err
+	}
+	if !client.Confidential() {
+		return client, nil
+	}
+	if clientSecret == nil {
+		log.Error(ctx, map[string]interface{}{
+			"client_id": clientID,
+		}, "missing oauth client secret")
+		return nil, errors.NewUnauthorizedError("invalid oauth client id or secret")
+	}
+	secret := []byte(*clientSecret)
+	for _, hash := range client.SecretHashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), secret) == nil {
+			return client, nil
+		}
+	}
+	log.Error(ctx, map[string]interface{}{
+		"client_id": clientID,
+	}, "oauth client secret doesn't match")
+	return nil, errors.NewUnauthorizedError("invalid oauth client id or secret")
+}
+
+// ValidateRedirectURI checks that the given redirect URI can be used in the authorization requests of the given
+// client. Depending on the matching mode of the client, the redirect URI must either be equal to one of the redirect
+// URIs of the client, or start with one of them. The redirect URIs of the public client must match the valid redirect
+// URLs of the configuration.
+// Returns BadParameterError otherwise, unless the redirect validation is in log-only mode
+func (s *oauthClientServiceImpl) ValidateRedirectURI(ctx context.Context, client *oauthclient.OAuthClient, redirectURI string) error {
+	if client.ClientID == s.config.GetPublicOAuthClientID() {
+		return s.validateRedirectURL(ctx, redirectURI)
+	}
+	for _, uri := range client.RedirectURIs {
+		if matchRedirectURI(uri, redirectURI, client.RedirectURIMatch) {
+			return nil
+		}
+	}
+	msg := fmt.Sprintf("redirect URI must be equal to one of the redirect URIs registered for the oauth client %s", client.ClientID)
+	if client.RedirectURIMatch == oauthclient.RedirectURIMatchPrefix {
+		msg = fmt.Sprintf("redirect URI must start with one of the redirect URIs registered for the oauth client %s", client.ClientID)
+	}
+	return s.rejectRedirect(ctx, map[string]interface{}{
+		"client_id":          client.ClientID,
+		"redirect_uri":       redirectURI,
+		"redirect_uri_match": client.RedirectURIMatch,
+	}, errors.NewBadParameterErrorFromString("redirect_uri", redirectURI, msg))
+}
+
+// ValidateReferrer checks that the given referrer can be used as the redirect URL of a request which doesn't go
+// through an OAuth client, such as a login or a link request. If the given API client is the client ID of an OAuth
+// client, the referrer is validated against the redirect URIs of this client. Otherwise it must match the valid
+// redirect URLs of the configuration.
+// Returns BadParameterError otherwise, unless the redirect validation is in log-only mode
+func (s *oauthClientServiceImpl) ValidateReferrer(ctx context.Context, apiClient *string, referrer string) error {
+	if apiClient != nil {
+		client, err := s.LoadClient(ctx, *apiClient)
+		if err == nil {
+			return s.ValidateRedirectURI(ctx, client, referrer)
+		}
+		if notFound, _ := errors.IsNotFoundError(err); !notFound {
+			return err
+		}
+		// the API client is not an OAuth client, the referrer is validated against the configuration
+	}
+	return s.validateRedirectURL(ctx, referrer)
+}
+
+// validateRedirectURL checks that the given redirect URL matches the valid redirect URLs of the configuration
+func (s *oauthClientServiceImpl) validateRedirectURL(ctx context.Context, redirectURL string) error {
+	matched, err := regexp.MatchString(s.config.GetValidRedirectURLs(), redirectURL)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"redirect_url":       redirectURL,
+			"valid_redirect_url": s.config.GetValidRedirectURLs(),
+			"err":                err,
+		}, "Can't match redirect URL and whitelist regex")
+		return errors.NewInternalError(ctx, err)
+	}
+	if matched {
+		return nil
+	}
+	return s.rejectRedirect(ctx, map[string]interface{}{
+		"redirect_url":       redirectURL,
+		"valid_redirect_url": s.config.GetValidRedirectURLs(),
+	}, errors.NewBadParameterErrorFromString("redirect", redirectURL, "redirect URL doesn't match the valid redirect URLs"))
+}
+
+// rejectRedirect logs the given invalid redirect and returns the given error, or nil if the redirect validation is in
+// log-only mode
+func (s *oauthClientServiceImpl) rejectRedirect(ctx context.Context, fields map[string]interface{}, err error) error {
+	fields["err"] = err
+	if s.config.IsRedirectValidationLogOnly() {
+		log.Warn(ctx, fields, "invalid redirect URL allowed since the redirect validation is in log-only mode")
+		return nil
+	}
+	log.Error(ctx, fields, "invalid redirect URL")
+	return err
+}
+
+// matchRedirectURI returns true if the given redirect URI matches the registered redirect URI with the given matching
+// mode. With the prefix matching mode, the redirect URI must have the same scheme, host and query as the registered
+// redirect URI, no user info nor fragment, and its path must be the path of the registered redirect URI or one of its
+// sub-paths.
+func matchRedirectURI(registered string, redirectURI string, match string) bool {
+	if match != oauthclient.RedirectURIMatchPrefix {
+		return registered == redirectURI
+	}
+	r, err := url.Parse(registered)
+	if err != nil {
+		return false
+	}
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return false
+	}
+	// comparing the host prevents https://client.example.com from matching https://client.example.com.evil.com
+	if !strings.EqualFold(r.Scheme, u.Scheme) || !strings.EqualFold(r.Host, u.Host) || u.User != nil {
+		return false
+	}
+	if u.Fragment != "" || u.RawQuery != r.RawQuery {
+		return false
+	}
+	// the dot segments would be resolved by the user agent, and could leave the registered path
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+	// comparing whole path segments prevents https://client.example.com/app from matching https://client.example.com/application
+	return u.Path == r.Path || strings.HasPrefix(u.Path, strings.TrimSuffix(r.Path, "/")+"/")
+}
+
+// CreateClient creates a new OAuth client with the given name, redirect URIs and grant types. A secret is generated
+// and returned for confidential clients, only its hash is stored.
+// The identity must have the manage_oauth_clients scope for the system resources, otherwise ForbiddenError is returned
+func (s *oauthClientServiceImpl) CreateClient(ctx context.Context, byIdentityID uuid.UUID, client *oauthclient.OAuthClient, authMethod string) (*string, error) {
+	err := s.Services().PermissionService().RequireSystemScope(ctx, byIdentityID, authorization.ManageOAuthClientsSystemScope)
+	if err != nil {
+		return nil, err
+	}
+	return s.createClient(ctx, byIdentityID, client, authMethod, false)
+}
+
+// RegisterClient registers a new OAuth client on behalf of the given identity, as defined by RFC 7591.
+// A secret is generated and returned for confidential clients, only its hash is stored.
+// Dynamically registered clients can't use the client_credentials grant type, since the tokens obtained with this
+// grant type are service account tokens.
+// The identity must have the manage_oauth_clients scope for the system resources, otherwise ForbiddenError is returned,
+// since the authorization codes are issued to the clients without asking for the consent of the user.
+// Returns BadParameterError with the invalid_redirect_uri or invalid_client_metadata error code if the metadata are
+// not valid
+func (s *oauthClientServiceImpl) RegisterClient(ctx context.Context, byIdentityID uuid.UUID, client *oauthclient.OAuthClient, authMethod string) (*string, error) {
+	err := s.Services().PermissionService().RequireSystemScope(ctx, byIdentityID, authorization.ManageOAuthClientsSystemScope)
+	if err != nil {
+		return nil, err
+	}
+	return s.createClient(ctx, byIdentityID, client, authMethod, true)
+}
+
+func (s *oauthClientServiceImpl) createClient(ctx context.Context, byIdentityID uuid.UUID, client *oauthclient.OAuthClient, authMethod string, dynamic bool) (*string, error) {
+	client.ClientID = uuid.NewV4().String()
+	client.DynamicallyRegistered = dynamic
+	client.CreatedBy = &byIdentityID
+	if len(client.GrantTypes) == 0 {
+		// the default grant type, as defined by RFC 7591
+		client.GrantTypes = pq.StringArray{oauthclient.GrantTypeAuthorizationCode}
+	}
+	if client.Name == "" {
+		client.Name = client.ClientID
+	}
+	if client.RedirectURIMatch == "" {
+		client.RedirectURIMatch = oauthclient.RedirectURIMatchExact
+	}
+
+	var secret *string
+	switch authMethod {
+	case TokenEndpointAuthMethodNone:
+		client.SecretHashes = pq.StringArray{}
+	case "", TokenEndpointAuthMethodClientSecretPost:
+		generated, hash, err := generateClientSecret()
+		if err != nil {
+			return nil, errors.NewInternalError(ctx, err)
+		}
+		secret = &generated
+		client.SecretHashes = pq.StringArray{hash}
+	default:
+		return nil, errors.NewBadParameterErrorFromString("token_endpoint_auth_method", authMethod, registrationErrorInvalidClientMetadata)
+	}
+
+	err := s.validateClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.ExecuteInTransaction(func() error {
+		return s.Repositories().OAuthClients().Create(ctx, client)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"client_id":              client.ClientID,
+		"identity_id":            byIdentityID,
+		"dynamically_registered": dynamic,
+	}, "OAuth client registered")
+	return secret, nil
+}
+
+// ListClients returns the registered OAuth clients.
+// The identity must have the manage_oauth_clients scope for the system resources, otherwise ForbiddenError is returned
+func (s *oauthClientServiceImpl) ListClients(ctx context.Context, byIdentityID uuid.UUID) ([]oauthclient.OAuthClient, error) {
+	err := s.Services().PermissionService().RequireSystemScope(ctx, byIdentityID, authorization.ManageOAuthClientsSystemScope)
+	if err != nil {
+		return nil, err
+	}
+	var clients []oauthclient.OAuthClient
+	err = s.ExecuteInTransaction(func() error {
+		var err error
+		clients, err = s.Repositories().OAuthClients().List(ctx)
+		return err
+	})
+	return clients, err
+}
+
+// ShowClient returns the registered OAuth client with the given client ID.
+// The identity must have the manage_oauth_clients scope for the system resources, otherwise ForbiddenError is returned
+func (s *oauthClientServiceImpl) ShowClient(ctx context.Context, byIdentityID uuid.UUID, clientID string) (*oauthclient.OAuthClient, error) {
+	err := s.Services().PermissionService().RequireSystemScope(ctx, byIdentityID, authorization.ManageOAuthClientsSystemScope)
+	if err != nil {
+		return nil, err
+	}
+	var client *oauthclient.OAuthClient
+	err = s.ExecuteInTransaction(func() error {
+		var err error
+		client, err = s.Repositories().OAuthClients().LoadByClientID(ctx, clientID)
+		return err
+	})
+	return client, err
+}
+
+// UpdateClient updates the name, redirect URIs and their matching mode, and grant types of the registered OAuth client with the given client ID.
+// The identity must have the manage_oauth_clients scope for the system resources, otherwise ForbiddenError is returned
+func (s *oauthClientServiceImpl) UpdateClient(ctx context.Context, byIdentityID uuid.UUID, clientID string, name *string, redirectURIs []string, redirectURIMatch *string, grantTypes []string) (*oauthclient.OAuthClient, error) {
+	err := s.Services().PermissionService().RequireSystemScope(ctx, byIdentityID, authorization.ManageOAuthClientsSystemScope)
+	if err != nil {
+		return nil, err
+	}
+	var client *oauthclient.OAuthClient
+	err = s.ExecuteInTransaction(func() error {
+		var err error
+		client, err = s.Repositories().OAuthClients().LoadByClientID(ctx, clientID)
+		if err != nil {
+			return err
+		}
+		if name != nil {
+			client.Name = *name
+		}
+		if redirectURIs != nil {
+			client.RedirectURIs = pq.StringArray(redirectURIs)
+		}
+		if redirectURIMatch != nil {
+			client.RedirectURIMatch = *redirectURIMatch
+		}
+		if grantTypes != nil {
+			client.GrantTypes = pq.StringArray(grantTypes)
+		}
+		err = s.validateClient(client)
+		if err != nil {
+			return err
+		}
+		return s.Repositories().OAuthClients().Save(ctx, client)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// DeleteClient deletes the registered OAuth client with the given client ID.
+// The identity must have the manage_oauth_clients scope for the system resources, otherwise ForbiddenError is returned
+func (s *oauthClientServiceImpl) DeleteClient(ctx context.Context, byIdentityID uuid.UUID, clientID string) error {
+	err := s.Services().PermissionService().RequireSystemScope(ctx, byIdentityID, authorization.ManageOAuthClientsSystemScope)
+	if err != nil {
+		return err
+	}
+	return s.ExecuteInTransaction(func() error {
+		client, err := s.Repositories().OAuthClients().LoadByClientID(ctx, clientID)
+		if err != nil {
+			return err
+		}
+		return s.Repositories().OAuthClients().Delete(ctx, client.OAuthClientID)
+	})
+}
+
+// validateClient checks the metadata of the given client.
+// Returns BadParameterError with the invalid_redirect_uri or invalid_client_metadata error code, as defined by RFC 7591
+func (s *oauthClientServiceImpl) validateClient(client *oauthclient.OAuthClient) error {
+	for _, grantType := range client.GrantTypes {
+		switch grantType {
+		case oauthclient.GrantTypeAuthorizationCode, oauthclient.GrantTypeRefreshToken, oauthclient.GrantTypeDeviceCode:
+		case oauthclient.GrantTypeClientCredentials:
+			if client.DynamicallyRegistered {
+				return errors.NewBadParameterErrorFromString("grant_types", grantType, registrationErrorInvalidClientMetadata)
+			}
+			if !client.Confidential() {
+				return errors.NewBadParameterErrorFromString("token_endpoint_auth_method", TokenEndpointAuthMethodNone, registrationErrorInvalidClientMetadata)
+			}
+			// the tokens of the clients using the client_credentials grant type are service account tokens, which
+			// are authorized by name
+			for _, sa := range s.config.GetServiceAccounts() {
+				if sa.Name == client.Name {
+					return errors.NewBadParameterErrorFromString("client_name", client.Name, registrationErrorInvalidClientMetadata)
+				}
+			}
+		case oauthclient.GrantTypeTokenExchange:
+			// the exchanged tokens identify the client acting on behalf of the user, so it must be authenticated
+			if client.DynamicallyRegistered {
+				return errors.NewBadParameterErrorFromString("grant_types", grantType, registrationErrorInvalidClientMetadata)
+			}
+			if !client.Confidential() {
+				return errors.NewBadParameterErrorFromString("token_endpoint_auth_method", TokenEndpointAuthMethodNone, registrationErrorInvalidClientMetadata)
+			}
+		default:
+			return errors.NewBadParameterErrorFromString("grant_types", grantType, registrationErrorInvalidClientMetadata)
+		}
+	}
+	switch client.RedirectURIMatch {
+	case oauthclient.RedirectURIMatchExact:
+	case oauthclient.RedirectURIMatchPrefix:
+		// the dynamically registered clients must use exact matching, as recommended by the OAuth security best
+		// practices
+		if client.DynamicallyRegistered {
+			return errors.NewBadParameterErrorFromString("redirect_uri_match", client.RedirectURIMatch, registrationErrorInvalidClientMetadata)
+		}
+	default:
+		return errors.NewBadParameterErrorFromString("redirect_uri_match", client.RedirectURIMatch, registrationErrorInvalidClientMetadata)
+	}
+	if client.HasGrantType(oauthclient.GrantTypeAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		return errors.NewBadParameterErrorFromString("redirect_uris", "", registrationErrorInvalidRedirectURI)
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		// the redirect URIs must be absolute URIs without fragment, as defined by RFC 6749
+		u, err := url.Parse(redirectURI)
+		if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+			return errors.NewBadParameterErrorFromString("redirect_uris", redirectURI, registrationErrorInvalidRedirectURI)
+		}
+	}
+	return nil
+}
+
+// generateClientSecret returns a new random client secret and its bcrypt hash
+func generateClientSecret() (string, string, error) {
+	b := make([]byte, clientSecretSize)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, string(hash), nil
+}
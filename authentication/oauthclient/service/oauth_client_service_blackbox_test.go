@@ -0,0 +1,368 @@
+package service_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/application/service"
+	oauthclient "github.com/fabric8-services/fabric8-auth/authentication/oauthclient/repository"
+	oauthclientservice "github.com/fabric8-services/fabric8-auth/authentication/oauthclient/service"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	"github.com/fabric8-services/fabric8-auth/configuration"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+
+	"github.com/lib/pq"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type oauthClientServiceBlackBoxTest struct {
+	gormtestsupport.DBTestSuite
+	clientService service.OAuthClientService
+}
+
+func TestRunOAuthClientServiceBlackBoxTest(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &oauthClientServiceBlackBoxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *oauthClientServiceBlackBoxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.clientService = s.Application.OAuthClientService()
+}
+
+// newUser returns the ID of a new user
+func (s *oauthClientServiceBlackBoxTest) newUser(t *testing.T) uuid.UUID {
+	g := s.NewTestGraph(t)
+	return g.CreateUser().IdentityID()
+}
+
+// newAdmin returns the ID of a new user with the manage_oauth_clients scope
+func (s *oauthClientServiceBlackBoxTest) newAdmin(t *testing.T) uuid.UUID {
+	g := s.NewTestGraph(t)
+	user := g.CreateUser()
+	g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+		AddRole(user, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+	return user.IdentityID()
+}
+
+func (s *oauthClientServiceBlackBoxTest) newClient(t *testing.T, authMethod string, grantTypes ...string) (*oauthclient.OAuthClient, *string) {
+	client := &oauthclient.OAuthClient{
+		Name:         "test client",
+		RedirectURIs: pq.StringArray{"https://client.example.com/callback"},
+		GrantTypes:   pq.StringArray(grantTypes),
+	}
+	secret, err := s.clientService.RegisterClient(s.Ctx, s.newAdmin(t), client, authMethod)
+	require.NoError(t, err)
+	return client, secret
+}
+
+func (s *oauthClientServiceBlackBoxTest) TestLoadClient() {
+
+	s.T().Run("public client", func(t *testing.T) {
+		client, err := s.clientService.LoadClientForGrantType(s.Ctx, s.Configuration.GetPublicOAuthClientID(), oauthclient.GrantTypeAuthorizationCode)
+		require.NoError(t, err)
+		assert.False(t, client.Confidential())
+	})
+
+	s.T().Run("service account", func(t *testing.T) {
+		client, err := s.clientService.LoadClientForGrantType(s.Ctx, "5dec5fdb-09e3-4453-b73f-5c828832b28e", oauthclient.GrantTypeClientCredentials)
+		require.NoError(t, err)
+		assert.Equal(t, "fabric8-wit", client.Name)
+		assert.True(t, client.Confidential())
+	})
+
+	s.T().Run("service account token exchange", func(t *testing.T) {
+		client, err := s.clientService.LoadClientForGrantType(s.Ctx, "5dec5fdb-09e3-4453-b73f-5c828832b28e", oauthclient.GrantTypeTokenExchange)
+		require.NoError(t, err)
+		assert.Equal(t, "fabric8-wit", client.Name)
+	})
+
+	s.T().Run("registered client", func(t *testing.T) {
+		registered, _ := s.newClient(t, oauthclientservice.TokenEndpointAuthMethodNone)
+		client, err := s.clientService.LoadClientForGrantType(s.Ctx, registered.ClientID, oauthclient.GrantTypeAuthorizationCode)
+		require.NoError(t, err)
+		assert.Equal(t, registered.OAuthClientID, client.OAuthClientID)
+	})
+
+	s.T().Run("grant type not allowed", func(t *testing.T) {
+		_, err := s.clientService.LoadClientForGrantType(s.Ctx, s.Configuration.GetPublicOAuthClientID(), oauthclient.GrantTypeClientCredentials)
+		testsupport.AssertError(t, err, errors.UnauthorizedError{}, "grant type client_credentials is not allowed for the oauth client")
+	})
+
+	s.T().Run("unknown client", func(t *testing.T) {
+		_, err := s.clientService.LoadClientForGrantType(s.Ctx, uuid.NewV4().String(), oauthclient.GrantTypeAuthorizationCode)
+		testsupport.AssertError(t, err, errors.UnauthorizedError{}, "invalid oauth client id")
+	})
+}
+
+func (s *oauthClientServiceBlackBoxTest) TestAuthenticateClient() {
+
+	s.T().Run("confidential client", func(t *testing.T) {
+		client, secret := s.newClient(t, oauthclientservice.TokenEndpointAuthMethodClientSecretPost)
+		require.NotNil(t, secret)
+		// only the hash of the secret is stored
+		assert.NotContains(t, client.SecretHashes, *secret)
+
+		_, err := s.clientService.AuthenticateClient(s.Ctx, client.ClientID, secret, oauthclient.GrantTypeAuthorizationCode)
+		require.NoError(t, err)
+
+		wrongSecret := "foo"
+		_, err = s.clientService.AuthenticateClient(s.Ctx, client.ClientID, &wrongSecret, oauthclient.GrantTypeAuthorizationCode)
+		testsupport.AssertError(t, err, errors.UnauthorizedError{}, "invalid oauth client id or secret")
+		_, err = s.clientService.AuthenticateClient(s.Ctx, client.ClientID, nil, oauthclient.GrantTypeAuthorizationCode)
+		testsupport.AssertError(t, err, errors.UnauthorizedError{}, "invalid oauth client id or secret")
+	})
+
+	s.T().Run("public client", func(t *testing.T) {
+		client, secret := s.newClient(t, oauthclientservice.TokenEndpointAuthMethodNone)
+		require.Nil(t, secret)
+		_, err := s.clientService.AuthenticateClient(s.Ctx, client.ClientID, nil, oauthclient.GrantTypeAuthorizationCode)
+		require.NoError(t, err)
+	})
+
+	s.T().Run("service account", func(t *testing.T) {
+		secret := "witsecret"
+		_, err := s.clientService.AuthenticateClient(s.Ctx, "5dec5fdb-09e3-4453-b73f-5c828832b28e", &secret, oauthclient.GrantTypeClientCredentials)
+		require.NoError(t, err)
+	})
+}
+
+func (s *oauthClientServiceBlackBoxTest) TestValidateRedirectURI() {
+
+	s.T().Run("registered client", func(t *testing.T) {
+		client, _ := s.newClient(t, oauthclientservice.TokenEndpointAuthMethodNone)
+		err := s.clientService.ValidateRedirectURI(s.Ctx, client, "https://client.example.com/callback")
+		require.NoError(t, err)
+		err = s.clientService.ValidateRedirectURI(s.Ctx, client, "https://client.example.com/callback/other")
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'redirect_uri': 'https://client.example.com/callback/other' - redirect URI must be equal to one of the redirect URIs registered for the oauth client %s", client.ClientID)
+	})
+
+	s.T().Run("prefix", func(t *testing.T) {
+		client := &oauthclient.OAuthClient{
+			RedirectURIs:     pq.StringArray{"https://client.example.com/callback"},
+			RedirectURIMatch: oauthclient.RedirectURIMatchPrefix,
+		}
+		_, err := s.clientService.CreateClient(s.Ctx, s.newAdmin(t), client, oauthclientservice.TokenEndpointAuthMethodNone)
+		require.NoError(t, err)
+
+		for _, redirectURI := range []string{
+			"https://client.example.com/callback",
+			"https://client.example.com/callback/",
+			"https://client.example.com/callback/page",
+			"https://CLIENT.example.com/callback/page",
+		} {
+			err = s.clientService.ValidateRedirectURI(s.Ctx, client, redirectURI)
+			assert.NoError(t, err, redirectURI)
+		}
+		for _, redirectURI := range []string{
+			"https://client.example.com/callbackpage",
+			"https://client.example.com/other",
+			"https://client.example.com/callback/../other",
+			"https://client.example.com.evil.com/callback",
+			"https://user@client.example.com/callback",
+			"https://client.example.com:8443/callback",
+			"http://client.example.com/callback",
+			"https://client.example.com/callback?redirect=https://evil.com",
+			"https://client.example.com/callback#fragment",
+		} {
+			err = s.clientService.ValidateRedirectURI(s.Ctx, client, redirectURI)
+			testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'redirect_uri': '%s' - redirect URI must start with one of the redirect URIs registered for the oauth client %s", redirectURI, client.ClientID)
+		}
+	})
+
+	s.T().Run("log only", func(t *testing.T) {
+		existingLogOnly := os.Getenv("AUTH_REDIRECT_VALIDATION_LOGONLY")
+		defer os.Setenv("AUTH_REDIRECT_VALIDATION_LOGONLY", existingLogOnly)
+		os.Setenv("AUTH_REDIRECT_VALIDATION_LOGONLY", "true")
+
+		client, _ := s.newClient(t, oauthclientservice.TokenEndpointAuthMethodNone)
+		err := s.clientService.ValidateRedirectURI(s.Ctx, client, "https://client.example.com/callback/other")
+		require.NoError(t, err)
+	})
+
+	s.T().Run("public client", func(t *testing.T) {
+		// the redirect URIs of the public client are checked against the valid redirect URLs of the configuration
+		client, err := s.clientService.LoadClient(s.Ctx, s.Configuration.GetPublicOAuthClientID())
+		require.NoError(t, err)
+		err = s.clientService.ValidateRedirectURI(s.Ctx, client, "https://openshift.io/home")
+		require.NoError(t, err)
+	})
+}
+
+func (s *oauthClientServiceBlackBoxTest) TestValidateReferrer() {
+
+	s.T().Run("api client", func(t *testing.T) {
+		client, _ := s.newClient(t, oauthclientservice.TokenEndpointAuthMethodNone)
+		err := s.clientService.ValidateReferrer(s.Ctx, &client.ClientID, "https://client.example.com/callback")
+		require.NoError(t, err)
+		err = s.clientService.ValidateReferrer(s.Ctx, &client.ClientID, "https://openshift.io/home")
+		require.IsType(t, errors.BadParameterError{}, err)
+	})
+
+	s.T().Run("unknown api client", func(t *testing.T) {
+		// the referrer is validated against the valid redirect URLs of the configuration
+		apiClient := "vscode"
+		err := s.clientService.ValidateReferrer(s.Ctx, &apiClient, "https://openshift.io/home")
+		require.NoError(t, err)
+	})
+
+	s.T().Run("valid redirect URLs", func(t *testing.T) {
+		existingValidRedirects := os.Getenv("AUTH_REDIRECT_VALID")
+		defer os.Setenv("AUTH_REDIRECT_VALID", existingValidRedirects)
+		os.Setenv("AUTH_REDIRECT_VALID", configuration.DefaultValidRedirectURLs)
+
+		err := s.clientService.ValidateReferrer(s.Ctx, nil, "https://openshift.io/home")
+		require.NoError(t, err)
+		err = s.clientService.ValidateReferrer(s.Ctx, nil, "https://example.com/home")
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'redirect': 'https://example.com/home' - redirect URL doesn't match the valid redirect URLs")
+	})
+}
+
+func (s *oauthClientServiceBlackBoxTest) TestRegisterClient() {
+
+	s.T().Run("forbidden without manage_oauth_clients scope", func(t *testing.T) {
+		client := &oauthclient.OAuthClient{RedirectURIs: pq.StringArray{"https://client.example.com/callback"}}
+		_, err := s.clientService.RegisterClient(s.Ctx, s.newUser(t), client, "")
+		require.IsType(t, errors.ForbiddenError{}, err)
+	})
+
+	s.T().Run("default metadata", func(t *testing.T) {
+		client, secret := s.newClient(t, "")
+		require.NotNil(t, secret)
+		assert.True(t, client.DynamicallyRegistered)
+		assert.Equal(t, pq.StringArray{oauthclient.GrantTypeAuthorizationCode}, client.GrantTypes)
+		assert.True(t, client.Confidential())
+	})
+
+	s.T().Run("client credentials not allowed", func(t *testing.T) {
+		client := &oauthclient.OAuthClient{GrantTypes: pq.StringArray{oauthclient.GrantTypeClientCredentials}}
+		_, err := s.clientService.RegisterClient(s.Ctx, s.newAdmin(t), client, "")
+		require.IsType(t, errors.BadParameterError{}, err)
+		assert.Contains(t, err.Error(), "invalid_client_metadata")
+	})
+
+	s.T().Run("token exchange not allowed", func(t *testing.T) {
+		client := &oauthclient.OAuthClient{GrantTypes: pq.StringArray{oauthclient.GrantTypeTokenExchange}}
+		_, err := s.clientService.RegisterClient(s.Ctx, s.newAdmin(t), client, "")
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'grant_types': 'urn:ietf:params:oauth:grant-type:token-exchange' - invalid_client_metadata")
+	})
+
+	s.T().Run("unknown grant type", func(t *testing.T) {
+		client := &oauthclient.OAuthClient{GrantTypes: pq.StringArray{"implicit"}}
+		_, err := s.clientService.RegisterClient(s.Ctx, s.newAdmin(t), client, "")
+		require.IsType(t, errors.BadParameterError{}, err)
+		assert.Contains(t, err.Error(), "invalid_client_metadata")
+	})
+
+	s.T().Run("prefix redirect URI match not allowed", func(t *testing.T) {
+		client := &oauthclient.OAuthClient{
+			RedirectURIs:     pq.StringArray{"https://client.example.com/callback"},
+			RedirectURIMatch: oauthclient.RedirectURIMatchPrefix,
+		}
+		_, err := s.clientService.RegisterClient(s.Ctx, s.newAdmin(t), client, "")
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'redirect_uri_match': 'prefix' - invalid_client_metadata")
+	})
+
+	s.T().Run("unknown auth method", func(t *testing.T) {
+		client := &oauthclient.OAuthClient{RedirectURIs: pq.StringArray{"https://client.example.com/callback"}}
+		_, err := s.clientService.RegisterClient(s.Ctx, s.newAdmin(t), client, "private_key_jwt")
+		require.IsType(t, errors.BadParameterError{}, err)
+		assert.Contains(t, err.Error(), "invalid_client_metadata")
+	})
+
+	for _, redirectURI := range []string{"", "/callback", "https://client.example.com/callback#fragment"} {
+		s.T().Run("invalid redirect URI "+redirectURI, func(t *testing.T) {
+			client := &oauthclient.OAuthClient{}
+			if redirectURI != "" {
+				client.RedirectURIs = pq.StringArray{redirectURI}
+			}
+			_, err := s.clientService.RegisterClient(s.Ctx, s.newAdmin(t), client, "")
+			require.IsType(t, errors.BadParameterError{}, err)
+			assert.Contains(t, err.Error(), "invalid_redirect_uri")
+		})
+	}
+}
+
+func (s *oauthClientServiceBlackBoxTest) TestManageClients() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		admin := s.newAdmin(t)
+
+		// create
+		client := &oauthclient.OAuthClient{
+			Name:       "backend client",
+			GrantTypes: pq.StringArray{oauthclient.GrantTypeClientCredentials},
+		}
+		secret, err := s.clientService.CreateClient(s.Ctx, admin, client, "")
+		require.NoError(t, err)
+		require.NotNil(t, secret)
+		assert.False(t, client.DynamicallyRegistered)
+		_, err = s.clientService.AuthenticateClient(s.Ctx, client.ClientID, secret, oauthclient.GrantTypeClientCredentials)
+		require.NoError(t, err)
+
+		// list
+		clients, err := s.clientService.ListClients(s.Ctx, admin)
+		require.NoError(t, err)
+		clientIDs := []string{}
+		for _, c := range clients {
+			clientIDs = append(clientIDs, c.ClientID)
+		}
+		assert.Contains(t, clientIDs, client.ClientID)
+
+		// update
+		name := "updated client"
+		updated, err := s.clientService.UpdateClient(s.Ctx, admin, client.ClientID, &name,
+			[]string{"https://client.example.com/callback"}, nil, []string{oauthclient.GrantTypeClientCredentials, oauthclient.GrantTypeAuthorizationCode})
+		require.NoError(t, err)
+		assert.Equal(t, name, updated.Name)
+		shown, err := s.clientService.ShowClient(s.Ctx, admin, client.ClientID)
+		require.NoError(t, err)
+		assert.Equal(t, name, shown.Name)
+		assert.Equal(t, pq.StringArray{"https://client.example.com/callback"}, shown.RedirectURIs)
+		assert.True(t, shown.HasGrantType(oauthclient.GrantTypeAuthorizationCode))
+
+		// update with invalid metadata
+		_, err = s.clientService.UpdateClient(s.Ctx, admin, client.ClientID, nil, []string{}, nil, nil)
+		require.IsType(t, errors.BadParameterError{}, err)
+
+		// delete
+		err = s.clientService.DeleteClient(s.Ctx, admin, client.ClientID)
+		require.NoError(t, err)
+		_, err = s.clientService.ShowClient(s.Ctx, admin, client.ClientID)
+		require.IsType(t, errors.NotFoundError{}, err)
+		_, err = s.clientService.LoadClient(s.Ctx, client.ClientID)
+		require.IsType(t, errors.NotFoundError{}, err)
+	})
+
+	s.T().Run("service account name not allowed", func(t *testing.T) {
+		admin := s.newAdmin(t)
+		client := &oauthclient.OAuthClient{
+			Name:       "fabric8-wit",
+			GrantTypes: pq.StringArray{oauthclient.GrantTypeClientCredentials},
+		}
+		_, err := s.clientService.CreateClient(s.Ctx, admin, client, "")
+		require.IsType(t, errors.BadParameterError{}, err)
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		user := s.newUser(t)
+		registered, _ := s.newClient(t, "")
+
+		_, err := s.clientService.CreateClient(s.Ctx, user, &oauthclient.OAuthClient{}, "")
+		require.IsType(t, errors.ForbiddenError{}, err)
+		_, err = s.clientService.ListClients(s.Ctx, user)
+		require.IsType(t, errors.ForbiddenError{}, err)
+		_, err = s.clientService.ShowClient(s.Ctx, user, registered.ClientID)
+		require.IsType(t, errors.ForbiddenError{}, err)
+		_, err = s.clientService.UpdateClient(s.Ctx, user, registered.ClientID, nil, nil, nil, nil)
+		require.IsType(t, errors.ForbiddenError{}, err)
+		err = s.clientService.DeleteClient(s.Ctx, user, registered.ClientID)
+		require.IsType(t, errors.ForbiddenError{}, err)
+	})
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	deviceCodeTableName = "device_codes"
+)
+
+// DeviceCode represents a pending device authorization request, as defined by RFC 8628
+type DeviceCode struct {
+	gormsupport.Lifecycle
+	DeviceCodeID uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key;column:device_code_id"`
+	// SHA-256 hash of the device code returned to the client, the device code itself is never stored
+	DeviceCodeHash string
+	// The code displayed to the user, which must be entered on the verification page
+	UserCode string
+	ClientID string
+	Scope    *string
+	// The oauth state used while the user is verifying the device with the authentication provider
+	State *string
+	// The authorization code returned by the authentication provider once the user has verified the device. It is only
+	// handed to the client presenting the device code, which is deleted as soon as the code is exchanged
+	Code         *string
+	ExpiryTime   time.Time
+	LastPolledAt *time.Time
+}
+
+// TableName implements gorm.tabler
+func (c DeviceCode) TableName() string {
+	return deviceCodeTableName
+}
+
+// Expired returns true if the device code has expired
+func (c DeviceCode) Expired() bool {
+	return c.ExpiryTime.Before(time.Now())
+}
+
+// DeviceCodeRepository encapsulate storage & retrieval of device codes
+type DeviceCodeRepository interface {
+	Create(ctx context.Context, deviceCode *DeviceCode) error
+	Save(ctx context.Context, deviceCode *DeviceCode) error
+	Delete(ctx context.Context, ID uuid.UUID) error
+	LoadByDeviceCodeHash(ctx context.Context, deviceCodeHash string) (*DeviceCode, error)
+	LoadByUserCode(ctx context.Context, userCode string) (*DeviceCode, error)
+	LoadByState(ctx context.Context, state string) (*DeviceCode, error)
+}
+
+// NewDeviceCodeRepository creates a new device code repo
+func NewDeviceCodeRepository(db *gorm.DB) *GormDeviceCodeRepository {
+	return &GormDeviceCodeRepository{db}
+}
+
+// GormDeviceCodeRepository implements DeviceCodeRepository using gorm
+type GormDeviceCodeRepository struct {
+	db *gorm.DB
+}
+
+// Create creates a new device code in the DB
+// returns InternalError
+func (r *GormDeviceCodeRepository) Create(ctx context.Context, deviceCode *DeviceCode) error {
+	defer goa.MeasureSince([]string{"goa", "db", "device_codes", "create"}, time.Now())
+	if deviceCode.DeviceCodeID == uuid.Nil {
+		deviceCode.DeviceCodeID = uuid.NewV4()
+	}
+
+	tx := r.db.Create(deviceCode)
+	if err := tx.Error; err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"device_code_id": deviceCode.DeviceCodeID,
+	}, "Device code created successfully")
+	return nil
+}
+
+// Save updates the given device code in the DB
+// returns NotFoundError or InternalError
+func (r *GormDeviceCodeRepository) Save(ctx context.Context, deviceCode *DeviceCode) error {
+	defer goa.MeasureSince([]string{"goa", "db", "device_codes", "save"}, time.Now())
+	tx := r.db.Model(deviceCode).Updates(deviceCode)
+	if err := tx.Error; err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"device_code_id": deviceCode.DeviceCodeID.String(),
+			"err":            err,
+		}, "unable to update the device code")
+		return errors.NewInternalError(ctx, err)
+	}
+	if tx.RowsAffected == 0 {
+		return errors.NewNotFoundError("device code", deviceCode.DeviceCodeID.String())
+	}
+
+	log.Debug(ctx, map[string]interface{}{
+		"device_code_id": deviceCode.DeviceCodeID,
+	}, "Device code saved")
+	return nil
+}
+
+// Delete deletes the device code with the given id
+// returns NotFoundError or InternalError
+func (r *GormDeviceCodeRepository) Delete(ctx context.Context, ID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "device_codes", "delete"}, time.Now())
+	if ID == uuid.Nil {
+		return errors.NewNotFoundError("device code", ID.String())
+	}
+	tx := r.db.Delete(DeviceCode{DeviceCodeID: ID})
+
+	if err := tx.Error; err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"device_code_id": ID.String(),
+			"err":            err,
+		}, "unable to delete the device code")
+		return errors.NewInternalError(ctx, err)
+	}
+	if tx.RowsAffected == 0 {
+		return errors.NewNotFoundError("device code", ID.String())
+	}
+
+	return nil
+}
+
+// LoadByDeviceCodeHash loads the device code by the hash of the device code
+func (r *GormDeviceCodeRepository) LoadByDeviceCodeHash(ctx context.Context, deviceCodeHash string) (*DeviceCode, error) {
+	return r.loadBy(ctx, "device_code_hash", deviceCodeHash)
+}
+
+// LoadByUserCode loads the device code by user code
+func (r *GormDeviceCodeRepository) LoadByUserCode(ctx context.Context, userCode string) (*DeviceCode, error) {
+	return r.loadBy(ctx, "user_code", userCode)
+}
+
+// LoadByState loads the device code by the oauth state used to verify the device
+func (r *GormDeviceCodeRepository) LoadByState(ctx context.Context, state string) (*DeviceCode, error) {
+	return r.loadBy(ctx, "state", state)
+}
+
+func (r *GormDeviceCodeRepository) loadBy(ctx context.Context, column string, value string) (*DeviceCode, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "device_codes", "load"}, time.Now())
+	deviceCode := DeviceCode{}
+
+	tx := r.db.Where(column+"=?", value).First(&deviceCode)
+	if tx.RecordNotFound() {
+		return nil, errors.NewNotFoundErrorWithKey("device_codes", column, value)
+	}
+	if tx.Error != nil {
+		return nil, errors.NewInternalError(ctx, tx.Error)
+	}
+	return &deviceCode, nil
+}
@@ -0,0 +1,110 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/authentication/provider/repository"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type deviceCodeBlackBoxTest struct {
+	gormtestsupport.DBTestSuite
+	repo repository.DeviceCodeRepository
+}
+
+func TestRunDeviceCodeBlackBoxTest(t *testing.T) {
+	suite.Run(t, &deviceCodeBlackBoxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *deviceCodeBlackBoxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.repo = repository.NewDeviceCodeRepository(s.DB)
+}
+
+func (s *deviceCodeBlackBoxTest) newDeviceCode() *repository.DeviceCode {
+	deviceCode := &repository.DeviceCode{
+		DeviceCodeHash: uuid.NewV4().String(),
+		UserCode:       uuid.NewV4().String()[:9],
+		ClientID:       "740650a2-9c44-4db5-b067-a3d1b2cd2d01",
+		ExpiryTime:     time.Now().Add(10 * time.Minute),
+	}
+	err := s.repo.Create(s.Ctx, deviceCode)
+	require.NoError(s.T(), err, "Could not create device code")
+	return deviceCode
+}
+
+func (s *deviceCodeBlackBoxTest) TestCreateLoad() {
+	// given
+	deviceCode := s.newDeviceCode()
+
+	s.T().Run("load by device code hash", func(t *testing.T) {
+		// when
+		found, err := s.repo.LoadByDeviceCodeHash(s.Ctx, deviceCode.DeviceCodeHash)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, deviceCode.DeviceCodeID, found.DeviceCodeID)
+		assert.Equal(t, deviceCode.UserCode, found.UserCode)
+		assert.Equal(t, deviceCode.ClientID, found.ClientID)
+		assert.False(t, found.Expired())
+	})
+
+	s.T().Run("load by user code", func(t *testing.T) {
+		// when
+		found, err := s.repo.LoadByUserCode(s.Ctx, deviceCode.UserCode)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, deviceCode.DeviceCodeID, found.DeviceCodeID)
+	})
+
+	s.T().Run("unknown codes", func(t *testing.T) {
+		_, err := s.repo.LoadByDeviceCodeHash(s.Ctx, uuid.NewV4().String())
+		require.IsType(t, errors.NotFoundError{}, err)
+		_, err = s.repo.LoadByUserCode(s.Ctx, uuid.NewV4().String())
+		require.IsType(t, errors.NotFoundError{}, err)
+		_, err = s.repo.LoadByState(s.Ctx, uuid.NewV4().String())
+		require.IsType(t, errors.NotFoundError{}, err)
+	})
+}
+
+func (s *deviceCodeBlackBoxTest) TestSaveLoadByState() {
+	// given
+	deviceCode := s.newDeviceCode()
+	state := uuid.NewV4().String()
+	code := uuid.NewV4().String()
+	deviceCode.State = &state
+	deviceCode.Code = &code
+
+	// when
+	err := s.repo.Save(s.Ctx, deviceCode)
+
+	// then
+	require.NoError(s.T(), err)
+	found, err := s.repo.LoadByState(s.Ctx, state)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), deviceCode.DeviceCodeID, found.DeviceCodeID)
+	require.NotNil(s.T(), found.Code)
+	assert.Equal(s.T(), code, *found.Code)
+}
+
+func (s *deviceCodeBlackBoxTest) TestDelete() {
+	// given
+	deviceCode := s.newDeviceCode()
+
+	// when
+	err := s.repo.Delete(s.Ctx, deviceCode.DeviceCodeID)
+
+	// then
+	require.NoError(s.T(), err)
+	_, err = s.repo.LoadByDeviceCodeHash(s.Ctx, deviceCode.DeviceCodeHash)
+	require.IsType(s.T(), errors.NotFoundError{}, err)
+
+	err = s.repo.Delete(s.Ctx, deviceCode.DeviceCodeID)
+	require.IsType(s.T(), errors.NotFoundError{}, err)
+}
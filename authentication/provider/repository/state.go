@@ -7,6 +7,8 @@ import (
 	"github.com/fabric8-services/fabric8-auth/log"
 
 	"context"
+	"strings"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	uuid "github.com/satori/go.uuid"
@@ -23,6 +25,22 @@ type OauthStateReference struct {
 	State        string
 	Referrer     string
 	ResponseMode *string
+	// PKCE code challenge and method provided with the authorization request, see RFC 7636
+	CodeChallenge       *string
+	CodeChallengeMethod *string
+	// OpenID Connect nonce provided with the authorization request, returned in the ID token
+	Nonce *string
+	// Space-delimited scopes of the authorization request. An ID token is only issued if the openid scope is included
+	Scope *string
+	// Time when the user authenticated with the authentication provider, recorded when the provider redirects the user
+	// back with the authorization code and returned in the ID token
+	AuthTime *time.Time
+	// SHA-256 hash of the authorization code returned to the client, recorded when a code challenge, a nonce or a
+	// client ID is present
+	CodeHash *string
+	// ID of the OAuth client which sent the authorization request, which is the only client allowed to exchange the
+	// authorization code
+	ClientID *string
 }
 
 // TableName implements gorm.tabler
@@ -46,25 +64,69 @@ func (r OauthStateReference) Equal(u convert.Equaler) bool {
 		return false
 	}
 
-	if r.ResponseMode == nil {
-		if other.ResponseMode != nil {
-			return false
-		}
-	} else {
-		if other.ResponseMode == nil {
-			return false
-		} else if *r.ResponseMode != *other.ResponseMode {
-			return false
-		}
+	if !equalStringPointers(r.ResponseMode, other.ResponseMode) {
+		return false
+	}
+	if !equalStringPointers(r.CodeChallenge, other.CodeChallenge) {
+		return false
+	}
+	if !equalStringPointers(r.CodeChallengeMethod, other.CodeChallengeMethod) {
+		return false
+	}
+	if !equalStringPointers(r.Nonce, other.Nonce) {
+		return false
+	}
+	if !equalStringPointers(r.Scope, other.Scope) {
+		return false
+	}
+	if !equalStringPointers(r.CodeHash, other.CodeHash) {
+		return false
+	}
+	if !equalStringPointers(r.ClientID, other.ClientID) {
+		return false
+	}
+	if !equalTimePointers(r.AuthTime, other.AuthTime) {
+		return false
 	}
 	return true
 }
 
+// OpenIDRequested returns true if the openid scope was included in the authorization request, in which case an
+// OpenID Connect ID token is issued when the authorization code is exchanged
+func (r OauthStateReference) OpenIDRequested() bool {
+	if r.Scope == nil {
+		return false
+	}
+	for _, scope := range strings.Fields(*r.Scope) {
+		if scope == "openid" {
+			return true
+		}
+	}
+	return false
+}
+
+func equalStringPointers(s1 *string, s2 *string) bool {
+	if s1 == nil {
+		return s2 == nil
+	}
+	return s2 != nil && *s1 == *s2
+}
+
+func equalTimePointers(t1 *time.Time, t2 *time.Time) bool {
+	if t1 == nil {
+		return t2 == nil
+	}
+	return t2 != nil && t1.Equal(*t2)
+}
+
 // OauthStateReferenceRepository encapsulate storage & retrieval of state references
 type OauthStateReferenceRepository interface {
 	Create(ctx context.Context, state *OauthStateReference) (*OauthStateReference, error)
 	Delete(ctx context.Context, ID uuid.UUID) error
+	DeleteExpired(ctx context.Context, createdBefore time.Time) (int64, error)
 	Load(ctx context.Context, state string) (*OauthStateReference, error)
+	LoadByCodeHash(ctx context.Context, codeHash string) (*OauthStateReference, error)
+	Save(ctx context.Context, state *OauthStateReference) error
 }
 
 // NewOauthStateReferenceRepository creates a new oauth state reference repo
@@ -105,6 +167,20 @@ func (r *GormOauthStateReferenceRepository) Delete(ctx context.Context, ID uuid.
 	return nil
 }
 
+// DeleteExpired removes the references which were created before the given time, including the ones which were already
+// deleted, and returns the number of removed references. This is a hard delete!
+func (r *GormOauthStateReferenceRepository) DeleteExpired(ctx context.Context, createdBefore time.Time) (int64, error) {
+	tx := r.db.Table(oauthStateTableName).Where("created_at < ?", createdBefore).Delete(nil)
+	if err := tx.Error; err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"created_before": createdBefore,
+			"err":            err,
+		}, "unable to delete the expired oauth state references")
+		return 0, errors.NewInternalError(ctx, err)
+	}
+	return tx.RowsAffected, nil
+}
+
 // Create creates a new oauth state reference in the DB
 // returns InternalError
 func (r *GormOauthStateReferenceRepository) Create(ctx context.Context, reference *OauthStateReference) (*OauthStateReference, error) {
@@ -140,3 +216,39 @@ func (r *GormOauthStateReferenceRepository) Load(ctx context.Context, state stri
 	}
 	return &ref, nil
 }
+
+// LoadByCodeHash loads state reference by the hash of the authorization code
+func (r *GormOauthStateReferenceRepository) LoadByCodeHash(ctx context.Context, codeHash string) (*OauthStateReference, error) {
+
+	ref := OauthStateReference{}
+
+	tx := r.db.Where("code_hash=?", codeHash).First(&ref)
+	if tx.RecordNotFound() {
+		return nil, errors.NewNotFoundErrorWithKey("oauth_state_references", "code_hash", codeHash)
+	}
+	if tx.Error != nil {
+		return nil, errors.NewInternalError(ctx, tx.Error)
+	}
+	return &ref, nil
+}
+
+// Save updates the given oauth state reference in the DB
+// returns NotFoundError or InternalError
+func (r *GormOauthStateReferenceRepository) Save(ctx context.Context, reference *OauthStateReference) error {
+	tx := r.db.Model(reference).Updates(reference)
+	if err := tx.Error; err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"oauth_state_reference_id": reference.ID.String(),
+			"err":                      err,
+		}, "unable to update the oauth state reference")
+		return errors.NewInternalError(ctx, err)
+	}
+	if tx.RowsAffected == 0 {
+		return errors.NewNotFoundError("oauth state reference", reference.ID.String())
+	}
+
+	log.Debug(ctx, map[string]interface{}{
+		"oauth_state_reference_id": reference.ID,
+	}, "Oauth state reference saved")
+	return nil
+}
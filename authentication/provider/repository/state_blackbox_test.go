@@ -2,6 +2,7 @@ package repository_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/fabric8-services/fabric8-auth/authentication/provider/repository"
 	"github.com/fabric8-services/fabric8-auth/errors"
@@ -68,3 +69,44 @@ func (s *stateBlackBoxTest) TestCreateDeleteLoad() {
 	require.NotNil(s.T(), foundState)
 	require.True(s.T(), state2.Equal(*foundState))
 }
+
+func (s *stateBlackBoxTest) TestSaveLoadByCodeHash() {
+	// given
+	codeChallenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	codeChallengeMethod := "S256"
+	nonce := uuid.NewV4().String()
+	scope := "openid offline_access"
+	state := &repository.OauthStateReference{
+		State:               uuid.NewV4().String(),
+		Referrer:            "domain.org",
+		CodeChallenge:       &codeChallenge,
+		CodeChallengeMethod: &codeChallengeMethod,
+		Nonce:               &nonce,
+		Scope:               &scope,
+	}
+	_, err := s.repo.Create(s.Ctx, state)
+	require.NoError(s.T(), err, "Could not create state reference")
+	foundState, err := s.repo.Load(s.Ctx, state.State)
+	require.NoError(s.T(), err)
+	require.True(s.T(), state.Equal(*foundState))
+	require.True(s.T(), foundState.OpenIDRequested())
+
+	// when
+	codeHash := uuid.NewV4().String()
+	authTime := time.Now().Round(time.Second)
+	foundState.CodeHash = &codeHash
+	foundState.AuthTime = &authTime
+	err = s.repo.Save(s.Ctx, foundState)
+
+	// then
+	require.NoError(s.T(), err)
+	loadedState, err := s.repo.LoadByCodeHash(s.Ctx, codeHash)
+	require.NoError(s.T(), err)
+	require.True(s.T(), foundState.Equal(*loadedState))
+	require.NotNil(s.T(), loadedState.AuthTime)
+	assert.True(s.T(), authTime.Equal(*loadedState.AuthTime))
+
+	_, err = s.repo.LoadByCodeHash(s.Ctx, uuid.NewV4().String())
+	require.Error(s.T(), err)
+	require.IsType(s.T(), errors.NotFoundError{}, err)
+}
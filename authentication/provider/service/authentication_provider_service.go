@@ -3,14 +3,17 @@ package service
 import (
 	"context"
 	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	token2 "github.com/fabric8-services/fabric8-auth/authorization/token"
 	"net/url"
-	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/fabric8-services/fabric8-auth/app"
@@ -19,6 +22,7 @@ import (
 	servicecontext "github.com/fabric8-services/fabric8-auth/application/service/context"
 	name "github.com/fabric8-services/fabric8-auth/authentication/account"
 	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	oauthclient "github.com/fabric8-services/fabric8-auth/authentication/oauthclient/repository"
 	"github.com/fabric8-services/fabric8-auth/authentication/provider"
 	providerrepo "github.com/fabric8-services/fabric8-auth/authentication/provider/repository"
 	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
@@ -33,7 +37,6 @@ import (
 type AuthenticationProviderServiceConfig interface {
 	provider.IdentityProviderConfiguration
 	manager.TokenManagerConfiguration
-	GetPublicOAuthClientID() string
 	GetWITURL() (string, error)
 }
 
@@ -46,6 +49,9 @@ const (
 	apiClientParam = "api_client"
 	apiTokenParam  = "api_token"
 	tokenJSONParam = "token_json"
+
+	codeChallengeMethodPlain = "plain"
+	codeChallengeMethodS256  = "S256"
 )
 
 // NewAuthenticationProviderService returns a new AuthenticationProviderService implementation
@@ -59,11 +65,15 @@ func NewAuthenticationProviderService(ctx servicecontext.ServiceContext, config
 // GenerateAuthCodeURL is used by both the login and authorize endpoints to generate a URL to which the client will be
 // redirected in order to obtain an authorization code, which will subsequently be exchanged for an access token.
 // https://oauth.net/2/grant-types/authorization-code/
+// If a PKCE code challenge is specified, it is stored along with the state so that the code verifier can be checked when
+// the authorization code is exchanged for a token. https://tools.ietf.org/html/rfc7636
+// If an OpenID Connect nonce is specified, it is stored along with the state so that it can be returned in the ID token.
+// If an OAuth client ID is specified, the redirect URL must be one of the redirect URIs of the client and the client ID
+// is stored along with the state so that the authorization code can only be exchanged by this client. Otherwise the
+// redirect URL must match the valid redirect URLs of the configuration.
 func (s *authenticationProviderServiceImpl) GenerateAuthCodeURL(ctx context.Context, redirect *string, apiClient *string,
-	state *string, scopes []string, responseMode *string, referrer string, callbackURL string) (*string, error) {
-	/* Compute all the configuration urls */
-	validRedirectURL := s.config.GetValidRedirectURLs()
-
+	state *string, scopes []string, responseMode *string, referrer string, callbackURL string,
+	codeChallenge *string, codeChallengeMethod *string, nonce *string, clientID *string) (*string, error) {
 	// First time access, redirect to oauth provider
 	if redirect == nil {
 		if referrer == "" {
@@ -80,12 +90,54 @@ func (s *authenticationProviderServiceImpl) GenerateAuthCodeURL(ctx context.Cont
 		"redirect": redirect,
 	}, "Got Request from!")
 
+	if codeChallengeMethod != nil && codeChallenge == nil {
+		return nil, autherrors.NewBadParameterError("code_challenge", nil).Expected("code_challenge with code_challenge_method")
+	}
+	if codeChallenge != nil && codeChallengeMethod == nil {
+		// "plain" is the default method, as defined by RFC 7636
+		plain := codeChallengeMethodPlain
+		codeChallengeMethod = &plain
+	}
+
+	// the redirect URL of an OAuth client is validated against the redirect URIs of the client, otherwise against
+	// the redirect URIs of the API client if it is an OAuth client, or the valid redirect URLs of the configuration
+	if clientID != nil {
+		client, err := s.Services().OAuthClientService().LoadClientForGrantType(ctx, *clientID, oauthclient.GrantTypeAuthorizationCode)
+		if err != nil {
+			return nil, err
+		}
+		err = s.Services().OAuthClientService().ValidateRedirectURI(ctx, client, *redirect)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err := s.Services().OAuthClientService().ValidateReferrer(ctx, apiClient, *redirect)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	redirect, err := s.saveParams(ctx, *redirect, apiClient)
 	if err != nil {
 		return nil, err
 	}
 
-	err = s.SaveReferrer(ctx, *state, *redirect, responseMode, validRedirectURL)
+	var scope *string
+	if len(scopes) > 0 {
+		joinedScopes := strings.Join(scopes, " ")
+		scope = &joinedScopes
+	}
+	ref := providerrepo.OauthStateReference{
+		State:               *state,
+		Referrer:            *redirect,
+		ResponseMode:        responseMode,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: codeChallengeMethod,
+		Nonce:               nonce,
+		Scope:               scope,
+		ClientID:            clientID,
+	}
+	err = s.createStateReference(ctx, ref)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"state":         state,
@@ -151,13 +203,24 @@ func (s *authenticationProviderServiceImpl) LoginCallback(ctx context.Context, s
 
 // AuthorizeCallback takes care of authorization callback.
 // When authorization_code is requested with /api/authorize, oauth provider returns authorization_code at /api/authorize/callback,
-// which would pass on the code along with the state to client using this method
+// which would pass on the code along with the state to client using this method.
+// If the state belongs to a device verification then the code is kept for the device, which will exchange it
+// using its device code, and the client is redirected to the referrer without the code.
 func (s *authenticationProviderServiceImpl) AuthorizeCallback(ctx context.Context, state string, code string) (*string, error) {
 	referrerURL, responseMode, err := s.reclaimReferrerAndResponseMode(ctx, state, code)
 	if err != nil {
 		return nil, err
 	}
 
+	deviceVerified, err := s.Services().DeviceAuthorizationService().CompleteVerification(ctx, state, code)
+	if err != nil {
+		return nil, err
+	}
+	if deviceVerified {
+		redirectTo := referrerURL.String()
+		return &redirectTo, nil
+	}
+
 	redirectTo := buildRedirectURL(code, state, referrerURL, responseMode)
 	return &redirectTo, nil
 }
@@ -183,14 +246,25 @@ func buildRedirectURL(code string, state string, referrerURL *url.URL, responseM
 	return referrerURL.String()
 }
 
-// ExchangeAuthorizationCodeForUserToken
-func (s *authenticationProviderServiceImpl) ExchangeAuthorizationCodeForUserToken(ctx context.Context, code string, clientID string, redirectURL *url.URL) (*string, *app.OauthToken, error) {
-	// Default value of this public client id is set to "740650a2-9c44-4db5-b067-a3d1b2cd2d01"
-	if clientID != s.config.GetPublicOAuthClientID() {
-		log.Error(ctx, map[string]interface{}{
-			"client_id": clientID,
-		}, "unknown oauth client id")
-		return nil, nil, autherrors.NewUnauthorizedError("invalid oauth client id")
+// ExchangeAuthorizationCodeForUserToken exchanges the authorization code for a user token. If a PKCE code challenge
+// was provided when the code was requested, then the specified code verifier must match it.
+// If the openid scope was requested along with the code, then an OpenID Connect ID token is issued to the client along
+// with the user token, with the nonce which was provided when the code was requested, if any, and the time when the user
+// authenticated with the authentication provider.
+func (s *authenticationProviderServiceImpl) ExchangeAuthorizationCodeForUserToken(ctx context.Context, code string, clientID string, redirectURL *url.URL, codeVerifier *string) (*string, *app.OauthToken, error) {
+	// the grant type is not checked here, since the code is also exchanged on behalf of the clients using the device
+	// authorization grant
+	_, err := s.Services().OAuthClientService().LoadClientForGrantType(ctx, clientID, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ref, err := s.reclaimCodeState(ctx, code, clientID, codeVerifier)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ref != nil && ref.OpenIDRequested() {
+		ctx = manager.ContextWithIDTokenRequest(ctx, clientID, ref.Nonce, ref.AuthTime)
 	}
 
 	// Exchange the authorization code for an access token with the identity provider
@@ -218,11 +292,17 @@ func (s *authenticationProviderServiceImpl) ExchangeAuthorizationCodeForUserToke
 			}
 		}
 
+		var idToken *string
+		if t, ok := userToken.Extra("id_token").(string); ok && t != "" {
+			idToken = &t
+		}
+
 		token = &app.OauthToken{
 			AccessToken:  &userToken.AccessToken,
 			ExpiresIn:    expireIn,
 			RefreshToken: &userToken.RefreshToken,
 			TokenType:    &userToken.TokenType,
+			IDToken:      idToken,
 		}
 	}
 
@@ -454,44 +534,34 @@ func (s *authenticationProviderServiceImpl) saveParams(ctx context.Context, redi
 	return &redirect, nil
 }
 
-// SaveReferrer validates referrer and saves it in DB
+// SaveReferrer validates referrer against the valid redirect URLs of the configuration and saves it in DB
 func (s *authenticationProviderServiceImpl) SaveReferrer(ctx context.Context, state string, referrer string,
-	responseMode *string, validReferrerURL string) error {
-
-	matched, err := regexp.MatchString(validReferrerURL, referrer)
+	responseMode *string) error {
+	err := s.Services().OAuthClientService().ValidateReferrer(ctx, nil, referrer)
 	if err != nil {
-		log.Error(ctx, map[string]interface{}{
-			"referrer":           referrer,
-			"valid_referrer_url": validReferrerURL,
-			"err":                err,
-		}, "Can't match referrer and whitelist regex")
 		return err
 	}
-	if !matched {
-		log.Error(ctx, map[string]interface{}{
-			"referrer":           referrer,
-			"valid_referrer_url": validReferrerURL,
-		}, "Referrer not valid")
-		return autherrors.NewBadParameterError("redirect", "not valid redirect URL")
-	}
-	// TODO The state reference table will be collecting dead states left from some failed login attempts.
-	// We need to clean up the old states from time to time.
-	ref := providerrepo.OauthStateReference{
+	return s.createStateReference(ctx, providerrepo.OauthStateReference{
 		State:        state,
 		Referrer:     referrer,
 		ResponseMode: responseMode,
-	}
+	})
+}
 
-	err = s.ExecuteInTransaction(func() error {
+// createStateReference saves the specified state reference in DB
+func (s *authenticationProviderServiceImpl) createStateReference(ctx context.Context, ref providerrepo.OauthStateReference) error {
+	// TODO The state reference table will be collecting dead states left from some failed login attempts.
+	// We need to clean up the old states from time to time.
+	err := s.ExecuteInTransaction(func() error {
 		_, err := s.Repositories().OauthStates().Create(ctx, &ref)
 		return err
 	})
 
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
-			"state":         state,
-			"referrer":      referrer,
-			"response_mode": log.PointerToString(responseMode),
+			"state":         ref.State,
+			"referrer":      ref.Referrer,
+			"response_mode": log.PointerToString(ref.ResponseMode),
 			"err":           err,
 		}, "unable to create oauth state reference")
 		return err
@@ -501,6 +571,14 @@ func (s *authenticationProviderServiceImpl) SaveReferrer(ctx context.Context, st
 
 // LoadReferrerAndResponseMode loads referrer and responseMode from DB
 func (s *authenticationProviderServiceImpl) LoadReferrerAndResponseMode(ctx context.Context, state string) (string, *string, error) {
+	return s.loadReferrerAndResponseMode(ctx, state, "")
+}
+
+// loadReferrerAndResponseMode loads referrer and responseMode from DB. The state reference is then deleted, unless it
+// holds a PKCE code challenge, an OpenID Connect nonce or scope or a client ID, in which case the hash of the specified
+// authorization code is recorded instead so that the code verifier can be checked and the ID token issued when the code
+// is exchanged for a token
+func (s *authenticationProviderServiceImpl) loadReferrerAndResponseMode(ctx context.Context, state string, code string) (string, *string, error) {
 	var referrer string
 	var responseMode *string
 
@@ -515,6 +593,22 @@ func (s *authenticationProviderServiceImpl) LoadReferrerAndResponseMode(ctx cont
 		}
 		referrer = ref.Referrer
 		responseMode = ref.ResponseMode
+		if (ref.CodeChallenge != nil || ref.Nonce != nil || ref.ClientID != nil || ref.OpenIDRequested()) && code != "" {
+			codeHash := hashCode(code)
+			ref.CodeHash = &codeHash
+			// the user has just authenticated with the authentication provider
+			authTime := time.Now()
+			ref.AuthTime = &authTime
+			err = s.Repositories().OauthStates().Save(ctx, ref)
+			if err != nil {
+				log.Error(ctx, map[string]interface{}{
+					"state": state,
+					"err":   err,
+				}, "unable to save oauth state reference")
+				return err
+			}
+			return nil
+		}
 		err = s.Repositories().OauthStates().Delete(ctx, ref.ID)
 		if err != nil {
 			log.Error(ctx, map[string]interface{}{
@@ -534,7 +628,7 @@ func (s *authenticationProviderServiceImpl) LoadReferrerAndResponseMode(ctx cont
 
 // reclaimReferrer reclaims referrerURL and verifies the state
 func (s *authenticationProviderServiceImpl) reclaimReferrerAndResponseMode(ctx context.Context, state string, code string) (*url.URL, *string, error) {
-	knownReferrer, responseMode, err := s.LoadReferrerAndResponseMode(ctx, state)
+	knownReferrer, responseMode, err := s.loadReferrerAndResponseMode(ctx, state, code)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"state": state,
@@ -563,6 +657,91 @@ func (s *authenticationProviderServiceImpl) reclaimReferrerAndResponseMode(ctx c
 	return referrerURL, responseMode, nil
 }
 
+// reclaimCodeState loads the state reference which was recorded for the given authorization code, if any, and checks
+// that the code was requested by the specified client and that the PKCE code verifier matches its code challenge.
+// The state reference is deleted only if these checks succeed so that the authorization code can't be exchanged again,
+// while a failed attempt can't be used to strip the checks from the code. Returns nil if neither a PKCE code
+// challenge, an OpenID Connect nonce or scope nor a client ID was provided when the authorization code was requested.
+func (s *authenticationProviderServiceImpl) reclaimCodeState(ctx context.Context, code string, clientID string, codeVerifier *string) (*providerrepo.OauthStateReference, error) {
+	var ref *providerrepo.OauthStateReference
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		ref, err = s.Repositories().OauthStates().LoadByCodeHash(ctx, hashCode(code))
+		if err != nil {
+			if notFound, _ := autherrors.IsNotFoundError(err); notFound {
+				ref = nil
+				return nil
+			}
+			return err
+		}
+		// the authorization code can only be exchanged by the client which requested it
+		if ref.ClientID != nil && *ref.ClientID != clientID {
+			log.Error(ctx, map[string]interface{}{
+				"client_id":           clientID,
+				"requested_client_id": *ref.ClientID,
+			}, "authorization code was issued to another oauth client")
+			return autherrors.NewUnauthorizedError("invalid authorization code")
+		}
+		err = verifyCodeVerifier(ctx, ref, codeVerifier)
+		if err != nil {
+			return err
+		}
+		return s.Repositories().OauthStates().Delete(ctx, ref.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// verifyCodeVerifier checks the specified PKCE code verifier against the code challenge of the given state reference,
+// if any
+func verifyCodeVerifier(ctx context.Context, ref *providerrepo.OauthStateReference, codeVerifier *string) error {
+	if ref == nil || ref.CodeChallenge == nil {
+		return nil
+	}
+
+	if codeVerifier == nil {
+		log.Error(ctx, map[string]interface{}{
+			"state": ref.State,
+		}, "missing code verifier")
+		return autherrors.NewBadParameterError("code_verifier", nil).Expected("PKCE code verifier")
+	}
+	codeChallengeMethod := codeChallengeMethodPlain
+	if ref.CodeChallengeMethod != nil {
+		codeChallengeMethod = *ref.CodeChallengeMethod
+	}
+	if !verifyCodeChallenge(*ref.CodeChallenge, codeChallengeMethod, *codeVerifier) {
+		log.Error(ctx, map[string]interface{}{
+			"state":                 ref.State,
+			"code_challenge_method": codeChallengeMethod,
+		}, "code verifier doesn't match the code challenge")
+		return autherrors.NewUnauthorizedError("invalid code verifier")
+	}
+	return nil
+}
+
+// verifyCodeChallenge returns true if the code verifier matches the code challenge with the given method
+func verifyCodeChallenge(codeChallenge string, codeChallengeMethod string, codeVerifier string) bool {
+	var computed string
+	switch codeChallengeMethod {
+	case codeChallengeMethodS256:
+		hash := sha256.Sum256([]byte(codeVerifier))
+		computed = base64.RawURLEncoding.EncodeToString(hash[:])
+	case codeChallengeMethodPlain:
+		computed = codeVerifier
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(codeChallenge)) == 1
+}
+
+// hashCode returns the SHA-256 hash of the authorization code, so that the code itself is never stored
+func hashCode(code string) string {
+	hash := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(hash[:])
+}
+
 // encodeToken
 func encodeToken(ctx context.Context, referrer *url.URL, outhToken *oauth2.Token, apiClient string) error {
 	tokenJSON, err := TokenToJSON(ctx, outhToken)
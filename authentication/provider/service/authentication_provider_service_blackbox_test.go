@@ -17,7 +17,9 @@ import (
 	"github.com/fabric8-services/fabric8-auth/app"
 	servicecontext "github.com/fabric8-services/fabric8-auth/application/service/context"
 	"github.com/fabric8-services/fabric8-auth/application/service/factory"
+	oauthclient "github.com/fabric8-services/fabric8-auth/authentication/oauthclient/repository"
 	"github.com/fabric8-services/fabric8-auth/authentication/provider"
+	"github.com/fabric8-services/fabric8-auth/authorization"
 	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
 	"github.com/fabric8-services/fabric8-auth/client"
 	"github.com/fabric8-services/fabric8-auth/configuration"
@@ -34,7 +36,8 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/goadesign/goa"
 	"github.com/goadesign/goa/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	errs "github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
@@ -95,7 +98,7 @@ func (s *authenticationProviderServiceTestSuite) TestOAuthAuthorizationRedirect(
 	callbackUrl := rest.AbsoluteURL(authorizeCtx.RequestData, client.CallbackLoginPath(), nil)
 	generatedState := uuid.NewV4().String()
 	redirectUrl, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, authorizeCtx.Redirect, authorizeCtx.APIClient,
-		&generatedState, nil, nil, refererUrl, callbackUrl)
+		&generatedState, nil, nil, refererUrl, callbackUrl, nil, nil, nil, nil)
 
 	require.Contains(s.T(), *redirectUrl, s.Configuration.GetOAuthProviderEndpointAuth())
 	require.NotEqual(s.T(), *redirectUrl, "")
@@ -209,7 +212,7 @@ func (s *authenticationProviderServiceTestSuite) TestOAuthAuthorizationRedirects
 	callbackUrl := rest.AbsoluteURL(authorizeCtx.RequestData, client.CallbackLoginPath(), nil)
 	generatedState := uuid.NewV4().String()
 	redirectUrl, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, authorizeCtx.Redirect, authorizeCtx.APIClient,
-		&generatedState, nil, nil, "", callbackUrl)
+		&generatedState, nil, nil, "", callbackUrl, nil, nil, nil, nil)
 
 	assert.Contains(s.T(), *redirectUrl, s.Configuration.GetOAuthProviderEndpointAuth())
 	assert.NotEqual(s.T(), *redirectUrl, "")
@@ -237,7 +240,7 @@ func (s *authenticationProviderServiceTestSuite) TestOAuthAuthorizationWithNoRef
 	callbackUrl := rest.AbsoluteURL(authorizeCtx.RequestData, client.CallbackLoginPath(), nil)
 	generatedState := uuid.NewV4().String()
 	_, err = s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, authorizeCtx.Redirect, authorizeCtx.APIClient,
-		&generatedState, nil, nil, "", callbackUrl)
+		&generatedState, nil, nil, "", callbackUrl, nil, nil, nil, nil)
 
 	require.Error(s.T(), err)
 	require.IsType(s.T(), err, autherrors.BadParameterError{})
@@ -281,7 +284,7 @@ func (s *authenticationProviderServiceTestSuite) TestProviderAuthorizationWithNo
 	callbackUrl := rest.AbsoluteURL(authorizeCtx.RequestData, client.CallbackLoginPath(), nil)
 	generatedState := uuid.NewV4().String()
 	_, err = s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, authorizeCtx.Redirect, authorizeCtx.APIClient,
-		&generatedState, nil, nil, "", callbackUrl)
+		&generatedState, nil, nil, "", callbackUrl, nil, nil, nil, nil)
 
 	require.Error(s.T(), err)
 	require.IsType(s.T(), err, autherrors.BadParameterError{})
@@ -299,7 +302,7 @@ func (s *authenticationProviderServiceTestSuite) TestProviderAuthorizationWithNo
 
 	generatedState = uuid.NewV4().String()
 	redirectUrl, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, authorizeCtx.Redirect, authorizeCtx.APIClient,
-		&generatedState, nil, nil, "", callbackUrl)
+		&generatedState, nil, nil, "", callbackUrl, nil, nil, nil, nil)
 
 	assert.Contains(s.T(), *redirectUrl, s.Configuration.GetOAuthProviderEndpointAuth())
 	assert.NotEqual(s.T(), *redirectUrl, "")
@@ -317,7 +320,7 @@ func (s *authenticationProviderServiceTestSuite) TestProviderAuthorizationWithNo
 
 	generatedState = uuid.NewV4().String()
 	redirectUrl, err = s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, authorizeCtx.Redirect, authorizeCtx.APIClient,
-		&generatedState, nil, nil, "", callbackUrl)
+		&generatedState, nil, nil, "", callbackUrl, nil, nil, nil, nil)
 
 	assert.Contains(s.T(), *redirectUrl, s.Configuration.GetOAuthProviderEndpointAuth())
 	assert.NotEqual(s.T(), *redirectUrl, "")
@@ -346,7 +349,7 @@ func (s *authenticationProviderServiceTestSuite) TestOAuthAuthorizationDevModePa
 	callbackUrl := rest.AbsoluteURL(authorizeCtx.RequestData, client.CallbackLoginPath(), nil)
 	generatedState := uuid.NewV4().String()
 	redirectUrl, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, authorizeCtx.Redirect, authorizeCtx.APIClient,
-		&generatedState, nil, nil, "", callbackUrl)
+		&generatedState, nil, nil, "", callbackUrl, nil, nil, nil, nil)
 
 	require.Contains(s.T(), *redirectUrl, s.Configuration.GetOAuthProviderEndpointAuth())
 	require.NotEqual(s.T(), *redirectUrl, "")
@@ -381,7 +384,7 @@ func (s *authenticationProviderServiceTestSuite) TestInvalidState() {
 	callbackUrl := rest.AbsoluteURL(authorizeCtx.RequestData, client.CallbackLoginPath(), nil)
 	generatedState := uuid.NewV4().String()
 	_, err = s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, authorizeCtx.Redirect, authorizeCtx.APIClient,
-		&generatedState, nil, nil, "", callbackUrl)
+		&generatedState, nil, nil, "", callbackUrl, nil, nil, nil, nil)
 
 	require.Error(s.T(), err)
 	require.IsType(s.T(), err, autherrors.BadParameterError{})
@@ -419,7 +422,7 @@ func (s *authenticationProviderServiceTestSuite) TestInvalidOAuthAuthorizationCo
 	callbackUrl := rest.AbsoluteURL(authorizeCtx.RequestData, client.CallbackLoginPath(), nil)
 	generatedState := uuid.NewV4().String()
 	redirectUrl, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, authorizeCtx.Redirect, authorizeCtx.APIClient,
-		&generatedState, nil, nil, refererUrl, callbackUrl)
+		&generatedState, nil, nil, refererUrl, callbackUrl, nil, nil, nil, nil)
 
 	locationUrl, err := url.Parse(*redirectUrl)
 	require.Nil(s.T(), err)
@@ -828,7 +831,7 @@ func (s *authenticationProviderServiceTestSuite) loginCallback(extraParams map[s
 	callbackUrl := rest.AbsoluteURL(authorizeCtx.RequestData, client.CallbackLoginPath(), nil)
 	generatedState := uuid.NewV4().String()
 	redirectUrl, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, authorizeCtx.Redirect, authorizeCtx.APIClient,
-		&generatedState, nil, nil, "", callbackUrl)
+		&generatedState, nil, nil, "", callbackUrl, nil, nil, nil, nil)
 
 	require.NoError(s.T(), err)
 
@@ -949,7 +952,7 @@ func (s *authenticationProviderServiceTestSuite) TestOAuthAuthorizationRedirectF
 	}
 	require.Nil(s.T(), err)
 
-	redirectTo, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(authorizeCtx, &authorizeCtx.RedirectURI, authorizeCtx.APIClient, &authorizeCtx.State, nil, authorizeCtx.ResponseMode, refererUrl, "")
+	redirectTo, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(authorizeCtx, &authorizeCtx.RedirectURI, authorizeCtx.APIClient, &authorizeCtx.State, nil, authorizeCtx.ResponseMode, refererUrl, "", nil, nil, nil, nil)
 	require.Nil(s.T(), err)
 	require.NotNil(s.T(), redirectTo)
 
@@ -959,7 +962,7 @@ func (s *authenticationProviderServiceTestSuite) TestOAuthAuthorizationRedirectF
 	goaCtx = goa.NewContext(goa.WithAction(ctx, "AuthorizeTest"), rw, req, prms)
 	authorizeCtx, err = app.NewAuthorizeAuthorizeContext(goaCtx, req, goa.New("LoginService"))
 	require.Nil(s.T(), err)
-	redirectTo, err = s.Application.AuthenticationProviderService().GenerateAuthCodeURL(authorizeCtx, &authorizeCtx.RedirectURI, authorizeCtx.APIClient, &authorizeCtx.State, nil, authorizeCtx.ResponseMode, refererUrl, "")
+	redirectTo, err = s.Application.AuthenticationProviderService().GenerateAuthCodeURL(authorizeCtx, &authorizeCtx.RedirectURI, authorizeCtx.APIClient, &authorizeCtx.State, nil, authorizeCtx.ResponseMode, refererUrl, "", nil, nil, nil, nil)
 	require.Nil(s.T(), err)
 	require.NotNil(s.T(), redirectTo)
 }
@@ -1087,6 +1090,243 @@ func (s *authenticationProviderServiceTestSuite) TestCreateOrUpdateIdentityAndUs
 	require.True(s.T(), refreshTokenFound)
 }
 
+func (s *authenticationProviderServiceTestSuite) TestExchangeAuthorizationCodeWithCodeVerifier() {
+	// code verifier and challenge from RFC 7636, appendix B
+	codeVerifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	s256CodeChallenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	ctx := manager.ContextWithTokenManager(testtoken.ContextWithRequest(context.Background()), testtoken.TokenManager)
+	callbackURL := "https://auth.openshift.io/api/authorize/callback"
+	redirectURL, err := url.Parse(callbackURL)
+	require.NoError(s.T(), err)
+
+	// authorize requests an authorization code with the given code challenge, and returns the code
+	authorize := func(t *testing.T, codeChallenge string, codeChallengeMethod *string) string {
+		state := uuid.NewV4().String()
+		redirect := "https://openshift.io/somepath"
+		_, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, &redirect, nil, &state, nil,
+			nil, "", callbackURL, &codeChallenge, codeChallengeMethod, nil, nil)
+		require.NoError(t, err)
+		code := uuid.NewV4().String()
+		_, err = s.Application.AuthenticationProviderService().AuthorizeCallback(ctx, state, code)
+		require.NoError(t, err)
+		return code
+	}
+
+	testsupport.ActivateDummyIdentityProviderFactory(s, s.getDummyOauthIDPService(true))
+	defer s.ResetFactories()
+
+	s.T().Run("ok with S256", func(t *testing.T) {
+		method := "S256"
+		code := authorize(t, s256CodeChallenge, &method)
+		_, token, err := s.Application.AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(ctx, code,
+			s.Configuration.GetPublicOAuthClientID(), redirectURL, &codeVerifier)
+		require.NoError(t, err)
+		require.NotNil(t, token)
+	})
+
+	s.T().Run("ok with plain", func(t *testing.T) {
+		code := authorize(t, codeVerifier, nil)
+		_, token, err := s.Application.AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(ctx, code,
+			s.Configuration.GetPublicOAuthClientID(), redirectURL, &codeVerifier)
+		require.NoError(t, err)
+		require.NotNil(t, token)
+	})
+
+	s.T().Run("fails with wrong verifier", func(t *testing.T) {
+		method := "S256"
+		code := authorize(t, s256CodeChallenge, &method)
+		wrongVerifier := uuid.NewV4().String() + uuid.NewV4().String()
+		_, _, err := s.Application.AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(ctx, code,
+			s.Configuration.GetPublicOAuthClientID(), redirectURL, &wrongVerifier)
+		require.Error(t, err)
+		require.IsType(t, autherrors.UnauthorizedError{}, errs.Cause(err))
+	})
+
+	s.T().Run("fails again when retried after wrong verifier", func(t *testing.T) {
+		method := "S256"
+		code := authorize(t, s256CodeChallenge, &method)
+		wrongVerifier := uuid.NewV4().String() + uuid.NewV4().String()
+		_, _, err := s.Application.AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(ctx, code,
+			s.Configuration.GetPublicOAuthClientID(), redirectURL, &wrongVerifier)
+		require.Error(t, err)
+		// the failed attempt must not remove the code challenge
+		_, _, err = s.Application.AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(ctx, code,
+			s.Configuration.GetPublicOAuthClientID(), redirectURL, &wrongVerifier)
+		require.Error(t, err)
+		require.IsType(t, autherrors.UnauthorizedError{}, errs.Cause(err))
+		_, _, err = s.Application.AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(ctx, code,
+			s.Configuration.GetPublicOAuthClientID(), redirectURL, nil)
+		require.Error(t, err)
+		require.IsType(t, autherrors.BadParameterError{}, errs.Cause(err))
+		// the right verifier is still accepted
+		_, token, err := s.Application.AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(ctx, code,
+			s.Configuration.GetPublicOAuthClientID(), redirectURL, &codeVerifier)
+		require.NoError(t, err)
+		require.NotNil(t, token)
+	})
+
+	s.T().Run("fails with missing verifier", func(t *testing.T) {
+		method := "S256"
+		code := authorize(t, s256CodeChallenge, &method)
+		_, _, err := s.Application.AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(ctx, code,
+			s.Configuration.GetPublicOAuthClientID(), redirectURL, nil)
+		require.Error(t, err)
+		require.IsType(t, autherrors.BadParameterError{}, errs.Cause(err))
+	})
+
+	s.T().Run("fails with method but no challenge", func(t *testing.T) {
+		state := uuid.NewV4().String()
+		redirect := "https://openshift.io/somepath"
+		method := "S256"
+		_, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, &redirect, nil, &state, nil,
+			nil, "", callbackURL, nil, &method, nil, nil)
+		require.Error(t, err)
+		require.IsType(t, autherrors.BadParameterError{}, err)
+	})
+}
+
+func (s *authenticationProviderServiceTestSuite) TestExchangeAuthorizationCodeReturnsIDToken() {
+	ctx := manager.ContextWithTokenManager(testtoken.ContextWithRequest(context.Background()), testtoken.TokenManager)
+	callbackURL := "https://auth.openshift.io/api/authorize/callback"
+	redirectURL, err := url.Parse(callbackURL)
+	require.NoError(s.T(), err)
+
+	// authorize requests an authorization code with the given scopes and nonce, and returns the code
+	authorize := func(t *testing.T, scopes []string, nonce *string) string {
+		state := uuid.NewV4().String()
+		redirect := "https://openshift.io/somepath"
+		_, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, &redirect, nil, &state, scopes,
+			nil, "", callbackURL, nil, nil, nonce, nil)
+		require.NoError(t, err)
+		code := uuid.NewV4().String()
+		_, err = s.Application.AuthenticationProviderService().AuthorizeCallback(ctx, state, code)
+		require.NoError(t, err)
+		return code
+	}
+
+	// exchange exchanges the authorization code and returns the claims of the ID token
+	start := time.Now().Unix()
+	exchange := func(t *testing.T, code string) jwt.MapClaims {
+		_, token, err := s.Application.AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(ctx, code,
+			s.Configuration.GetPublicOAuthClientID(), redirectURL, nil)
+		require.NoError(t, err)
+		require.NotNil(t, token)
+		require.NotNil(t, token.IDToken)
+		claims, err := testtoken.TokenManager.ParseTokenWithMapClaims(ctx, *token.IDToken)
+		require.NoError(t, err)
+		assert.Equal(t, s.Configuration.GetPublicOAuthClientID(), claims["aud"])
+		assert.Equal(t, "ID", claims["typ"])
+		assert.NotEmpty(t, claims["at_hash"])
+		// the auth_time claim is the time when the authentication provider redirected the user back with the code
+		require.IsType(t, float64(0), claims["auth_time"])
+		authTime := int64(claims["auth_time"].(float64))
+		assert.True(t, authTime >= start && authTime <= time.Now().Unix())
+		return claims
+	}
+
+	testsupport.ActivateDummyIdentityProviderFactory(s, s.getDummyOauthIDPService(true))
+	defer s.ResetFactories()
+
+	s.T().Run("with nonce", func(t *testing.T) {
+		nonce := uuid.NewV4().String()
+		code := authorize(t, []string{"openid"}, &nonce)
+		claims := exchange(t, code)
+		assert.Equal(t, nonce, claims["nonce"])
+	})
+
+	s.T().Run("without nonce", func(t *testing.T) {
+		code := authorize(t, []string{"openid offline_access"}, nil)
+		claims := exchange(t, code)
+		assert.Nil(t, claims["nonce"])
+	})
+
+	s.T().Run("no id token without openid scope", func(t *testing.T) {
+		nonce := uuid.NewV4().String()
+		for _, scopes := range [][]string{nil, {"offline_access"}} {
+			code := authorize(t, scopes, &nonce)
+			_, token, err := s.Application.AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(ctx, code,
+				s.Configuration.GetPublicOAuthClientID(), redirectURL, nil)
+			require.NoError(t, err)
+			require.NotNil(t, token)
+			assert.Nil(t, token.IDToken)
+		}
+	})
+}
+
+func (s *authenticationProviderServiceTestSuite) TestExchangeAuthorizationCodeWithRegisteredClient() {
+	ctx := manager.ContextWithTokenManager(testtoken.ContextWithRequest(context.Background()), testtoken.TokenManager)
+	callbackURL := "https://auth.openshift.io/api/authorize/callback"
+	redirectURL, err := url.Parse(callbackURL)
+	require.NoError(s.T(), err)
+
+	g := s.NewTestGraph(s.T())
+	admin := g.CreateUser()
+	g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+		AddRole(admin, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+	client := &oauthclient.OAuthClient{
+		RedirectURIs: pq.StringArray{"https://client.example.com/callback"},
+		GrantTypes:   pq.StringArray{oauthclient.GrantTypeAuthorizationCode},
+	}
+	_, err = s.Application.OAuthClientService().RegisterClient(ctx, admin.IdentityID(), client, "none")
+	require.NoError(s.T(), err)
+
+	// authorize requests an authorization code for the registered client, and returns the code
+	authorize := func(t *testing.T) string {
+		state := uuid.NewV4().String()
+		redirect := "https://client.example.com/callback"
+		_, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, &redirect, nil, &state, nil,
+			nil, "", callbackURL, nil, nil, nil, &client.ClientID)
+		require.NoError(t, err)
+		code := uuid.NewV4().String()
+		_, err = s.Application.AuthenticationProviderService().AuthorizeCallback(ctx, state, code)
+		require.NoError(t, err)
+		return code
+	}
+
+	testsupport.ActivateDummyIdentityProviderFactory(s, s.getDummyOauthIDPService(true))
+	defer s.ResetFactories()
+
+	s.T().Run("ok", func(t *testing.T) {
+		code := authorize(t)
+		_, token, err := s.Application.AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(ctx, code,
+			client.ClientID, redirectURL, nil)
+		require.NoError(t, err)
+		require.NotNil(t, token)
+	})
+
+	s.T().Run("fails with another client", func(t *testing.T) {
+		code := authorize(t)
+		_, _, err := s.Application.AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(ctx, code,
+			s.Configuration.GetPublicOAuthClientID(), redirectURL, nil)
+		require.Error(t, err)
+		require.IsType(t, autherrors.UnauthorizedError{}, errs.Cause(err))
+		// the failed attempt must not release the code to other clients
+		_, _, err = s.Application.AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(ctx, code,
+			s.Configuration.GetPublicOAuthClientID(), redirectURL, nil)
+		require.Error(t, err)
+		require.IsType(t, autherrors.UnauthorizedError{}, errs.Cause(err))
+	})
+
+	s.T().Run("fails with unregistered redirect URI", func(t *testing.T) {
+		state := uuid.NewV4().String()
+		redirect := "https://client.example.com/other"
+		_, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, &redirect, nil, &state, nil,
+			nil, "", callbackURL, nil, nil, nil, &client.ClientID)
+		require.Error(t, err)
+		require.IsType(t, autherrors.BadParameterError{}, err)
+	})
+
+	s.T().Run("fails with unknown client", func(t *testing.T) {
+		state := uuid.NewV4().String()
+		redirect := "https://client.example.com/callback"
+		clientID := uuid.NewV4().String()
+		_, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(ctx, &redirect, nil, &state, nil,
+			nil, "", callbackURL, nil, nil, nil, &clientID)
+		require.Error(t, err)
+		require.IsType(t, autherrors.UnauthorizedError{}, err)
+	})
+}
+
 func (s *authenticationProviderServiceTestSuite) authorizeCallback(testType string) (*httptest.ResponseRecorder, *app.CallbackAuthorizeContext) {
 	// Setup request context
 	rw := httptest.NewRecorder()
@@ -1113,7 +1353,7 @@ func (s *authenticationProviderServiceTestSuite) authorizeCallback(testType stri
 
 	redirectTo, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(authorizeCtx,
 		&authorizeCtx.RedirectURI, authorizeCtx.APIClient, &authorizeCtx.State, nil, authorizeCtx.ResponseMode,
-		"https://openshift.io/somepath", "")
+		"https://openshift.io/somepath", "", nil, nil, nil, nil)
 	require.Nil(s.T(), err)
 
 	authorizeCtx.ResponseData.Header().Set("Cache-Control", "no-cache")
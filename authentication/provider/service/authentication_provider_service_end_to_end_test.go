@@ -106,7 +106,7 @@ func (s *serviceLoginBlackBoxTest) runLoginEndToEnd() {
 	callbackUrl := rest.AbsoluteURL(authorizeCtx.RequestData, client.CallbackLoginPath(), nil)
 	generatedState := uuid.NewV4().String()
 	redirectUrl, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(authorizeCtx, authorizeCtx.Redirect, authorizeCtx.APIClient,
-		&generatedState, nil, nil, "", callbackUrl)
+		&generatedState, nil, nil, "", callbackUrl, nil, nil, nil, nil)
 	require.Nil(s.T(), err)
 
 	// Ensure you get a redirect with a 'state'
@@ -217,7 +217,7 @@ func (s *serviceLoginBlackBoxTest) runOauth2LoginEndToEnd(redirectURL string, re
 	oauthConfig.RedirectURL = oauthCodeRedirectURL
 
 	redirectedTo, err := s.Application.AuthenticationProviderService().GenerateAuthCodeURL(s.Ctx, &redirectURL,
-		nil, &state, nil, &responseMode, "", oauthCodeRedirectURL)
+		nil, &state, nil, &responseMode, "", oauthCodeRedirectURL, nil, nil, nil, nil)
 	require.NoError(s.T(), err)
 	require.NotNil(s.T(), redirectedTo)
 
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/application/service"
+	"github.com/fabric8-services/fabric8-auth/application/service/base"
+	servicecontext "github.com/fabric8-services/fabric8-auth/application/service/context"
+	oauthclient "github.com/fabric8-services/fabric8-auth/authentication/oauthclient/repository"
+	providerrepo "github.com/fabric8-services/fabric8-auth/authentication/provider/repository"
+	autherrors "github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	errs "github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	// Error codes returned while polling the token endpoint, as defined by RFC 8628, section 3.5
+	deviceErrorAuthorizationPending = "authorization_pending"
+	deviceErrorSlowDown             = "slow_down"
+	deviceErrorExpiredToken         = "expired_token"
+	deviceErrorAccessDenied         = "access_denied"
+	deviceErrorInvalidGrant         = "invalid_grant"
+
+	// User codes are made of consonants only, in order to avoid ambiguous characters and accidental words
+	userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength  = 8
+)
+
+// DeviceAuthorizationServiceConfig the config for the device authorization service
+type DeviceAuthorizationServiceConfig interface {
+	GetDeviceCodeExpirySeconds() int
+	GetDeviceCodePollingIntervalSeconds() int
+}
+
+type deviceAuthorizationServiceImpl struct {
+	base.BaseService
+	config DeviceAuthorizationServiceConfig
+}
+
+// NewDeviceAuthorizationService returns a new DeviceAuthorizationService implementation
+func NewDeviceAuthorizationService(ctx servicecontext.ServiceContext, config DeviceAuthorizationServiceConfig) service.DeviceAuthorizationService {
+	return &deviceAuthorizationServiceImpl{
+		BaseService: base.NewBaseService(ctx),
+		config:      config,
+	}
+}
+
+// AuthorizeDevice issues a new device code and user code for the given client, as defined by RFC 8628.
+// Only the hash of the device code is stored, the device code itself is returned to the client once.
+func (s *deviceAuthorizationServiceImpl) AuthorizeDevice(ctx context.Context, clientID string, scope *string, verificationURI string) (*app.DeviceAuthorization, error) {
+	_, err := s.Services().OAuthClientService().LoadClientForGrantType(ctx, clientID, oauthclient.GrantTypeDeviceCode)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceCode, err := generateDeviceCode()
+	if err != nil {
+		return nil, autherrors.NewInternalError(ctx, err)
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, autherrors.NewInternalError(ctx, err)
+	}
+
+	expiresIn := s.config.GetDeviceCodeExpirySeconds()
+	interval := s.config.GetDeviceCodePollingIntervalSeconds()
+	err = s.ExecuteInTransaction(func() error {
+		return s.Repositories().DeviceCodes().Create(ctx, &providerrepo.DeviceCode{
+			DeviceCodeHash: hashCode(deviceCode),
+			UserCode:       userCode,
+			ClientID:       clientID,
+			Scope:          scope,
+			ExpiryTime:     time.Now().Add(time.Duration(expiresIn) * time.Second),
+		})
+	})
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"client_id": clientID,
+			"err":       err,
+		}, "unable to create device code")
+		return nil, err
+	}
+
+	verificationURIComplete, err := url.Parse(verificationURI)
+	if err != nil {
+		return nil, autherrors.NewInternalError(ctx, err)
+	}
+	parameters := verificationURIComplete.Query()
+	parameters.Set("user_code", userCode)
+	verificationURIComplete.RawQuery = parameters.Encode()
+	complete := verificationURIComplete.String()
+
+	return &app.DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: &complete,
+		ExpiresIn:               expiresIn,
+		Interval:                &interval,
+	}, nil
+}
+
+// VerifyDevice generates the URL to which the user should be redirected in order to approve the device identified
+// by the given user code with the authentication provider. The authentication provider then redirects the user to the
+// authorize callback, which records the authorization code for the device.
+func (s *deviceAuthorizationServiceImpl) VerifyDevice(ctx context.Context, userCode string, redirect *string, referrer string, callbackURL string) (*string, error) {
+	userCode = normalizeUserCode(userCode)
+	state := uuid.NewV4().String()
+
+	var scopes []string
+	err := s.ExecuteInTransaction(func() error {
+		deviceCode, err := s.Repositories().DeviceCodes().LoadByUserCode(ctx, userCode)
+		if err != nil {
+			if notFound, _ := autherrors.IsNotFoundError(err); notFound {
+				return autherrors.NewBadParameterErrorFromString("user_code", userCode, "unknown user code")
+			}
+			return err
+		}
+		if deviceCode.Expired() || deviceCode.Code != nil {
+			return autherrors.NewBadParameterErrorFromString("user_code", userCode, "user code is expired or has already been used")
+		}
+		if deviceCode.Scope != nil {
+			scopes = []string{*deviceCode.Scope}
+		}
+		deviceCode.State = &state
+		return s.Repositories().DeviceCodes().Save(ctx, deviceCode)
+	})
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"user_code": userCode,
+			"err":       err,
+		}, "unable to verify device")
+		return nil, err
+	}
+
+	return s.Services().AuthenticationProviderService().GenerateAuthCodeURL(ctx, redirect, nil, &state, scopes, nil,
+		referrer, callbackURL, nil, nil, nil, nil)
+}
+
+// CompleteVerification records the authorization code returned by the authentication provider for the device which
+// is being verified with the given state. The code is kept with the device code, which is looked up by its hash when the
+// device polls the token endpoint. Returns false if the state doesn't belong to a device verification.
+func (s *deviceAuthorizationServiceImpl) CompleteVerification(ctx context.Context, state string, code string) (bool, error) {
+	var verified bool
+	err := s.ExecuteInTransaction(func() error {
+		deviceCode, err := s.Repositories().DeviceCodes().LoadByState(ctx, state)
+		if err != nil {
+			if notFound, _ := autherrors.IsNotFoundError(err); notFound {
+				return nil
+			}
+			return err
+		}
+		if deviceCode.Expired() {
+			return autherrors.NewBadParameterErrorFromString("user_code", deviceCode.UserCode, "user code is expired")
+		}
+		deviceCode.Code = &code
+		verified = true
+		return s.Repositories().DeviceCodes().Save(ctx, deviceCode)
+	})
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"state": state,
+			"err":   err,
+		}, "unable to complete device verification")
+		return false, err
+	}
+	return verified, nil
+}
+
+// ExchangeDeviceCode exchanges the device code for a user token once the user has verified the device. Until then,
+// an OAuthError with the authorization_pending or slow_down error code is returned, as defined by RFC 8628.
+func (s *deviceAuthorizationServiceImpl) ExchangeDeviceCode(ctx context.Context, deviceCode string, clientID string, redirectURL *url.URL) (*string, *app.OauthToken, error) {
+	_, err := s.Services().OAuthClientService().LoadClientForGrantType(ctx, clientID, oauthclient.GrantTypeDeviceCode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var code string
+	var pollingErr error
+	err = s.ExecuteInTransaction(func() error {
+		ref, err := s.Repositories().DeviceCodes().LoadByDeviceCodeHash(ctx, hashCode(deviceCode))
+		if err != nil {
+			if notFound, _ := autherrors.IsNotFoundError(err); notFound {
+				pollingErr = autherrors.NewOAuthError(deviceErrorInvalidGrant, "unknown device code")
+				return nil
+			}
+			return err
+		}
+		if ref.ClientID != clientID {
+			pollingErr = autherrors.NewOAuthError(deviceErrorInvalidGrant, "device code was issued to another client")
+			return nil
+		}
+		if ref.Expired() {
+			pollingErr = autherrors.NewOAuthError(deviceErrorExpiredToken, "device code is expired")
+			return s.Repositories().DeviceCodes().Delete(ctx, ref.DeviceCodeID)
+		}
+		if ref.Code == nil {
+			// The polling state is saved, hence the error is not returned here in order to commit the transaction
+			now := time.Now()
+			interval := time.Duration(s.config.GetDeviceCodePollingIntervalSeconds()) * time.Second
+			if ref.LastPolledAt != nil && now.Sub(*ref.LastPolledAt) < interval {
+				pollingErr = autherrors.NewOAuthError(deviceErrorSlowDown, "device is polling too frequently")
+			} else {
+				pollingErr = autherrors.NewOAuthError(deviceErrorAuthorizationPending, "device hasn't been verified yet")
+			}
+			ref.LastPolledAt = &now
+			return s.Repositories().DeviceCodes().Save(ctx, ref)
+		}
+		// The device code can only be exchanged once
+		code = *ref.Code
+		return s.Repositories().DeviceCodes().Delete(ctx, ref.DeviceCodeID)
+	})
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"client_id": clientID,
+			"err":       err,
+		}, "unable to exchange device code")
+		return nil, nil, err
+	}
+	if pollingErr != nil {
+		return nil, nil, pollingErr
+	}
+
+	notApprovedRedirectURL, token, err := s.Services().AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(ctx, code, clientID, redirectURL, nil)
+	if err != nil {
+		if unauthorized, _ := autherrors.IsUnauthorizedError(err); unauthorized {
+			return nil, nil, autherrors.NewOAuthError(deviceErrorAccessDenied, err.Error())
+		}
+		return nil, nil, err
+	}
+	if notApprovedRedirectURL != nil && token == nil {
+		return nil, nil, autherrors.NewOAuthError(deviceErrorAccessDenied, "user is not authorized to access OpenShift")
+	}
+	return notApprovedRedirectURL, token, nil
+}
+
+// generateDeviceCode returns a new random device code
+func generateDeviceCode() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errs.Wrap(err, "unable to generate device code")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// generateUserCode returns a new random user code, such as "WDJB-MJHT"
+func generateUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	max := big.NewInt(int64(len(userCodeCharset)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", errs.Wrap(err, "unable to generate user code")
+		}
+		code[i] = userCodeCharset[n.Int64()]
+	}
+	return normalizeUserCode(string(code)), nil
+}
+
+// normalizeUserCode makes the user code case insensitive and ignores any dashes or spaces typed in by the user
+func normalizeUserCode(userCode string) string {
+	code := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(userCode))
+	if len(code) != userCodeLength {
+		return code
+	}
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
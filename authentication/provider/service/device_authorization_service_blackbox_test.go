@@ -0,0 +1,146 @@
+package service_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
+	autherrors "github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	testtoken "github.com/fabric8-services/fabric8-auth/test/token"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type deviceAuthorizationServiceTestSuite struct {
+	gormtestsupport.DBTestSuite
+}
+
+func TestDeviceAuthorizationServiceBlackBox(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &deviceAuthorizationServiceTestSuite{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *deviceAuthorizationServiceTestSuite) authorizeDevice(ctx context.Context) *app.DeviceAuthorization {
+	deviceAuthorization, err := s.Application.DeviceAuthorizationService().AuthorizeDevice(ctx,
+		s.Configuration.GetPublicOAuthClientID(), nil, "https://auth.openshift.io/api/authorize/device/verify")
+	require.NoError(s.T(), err)
+	return deviceAuthorization
+}
+
+func (s *deviceAuthorizationServiceTestSuite) exchange(ctx context.Context, deviceCode string) error {
+	redirectURL, err := url.Parse("https://auth.openshift.io/api/authorize/callback")
+	require.NoError(s.T(), err)
+	_, _, err = s.Application.DeviceAuthorizationService().ExchangeDeviceCode(ctx, deviceCode,
+		s.Configuration.GetPublicOAuthClientID(), redirectURL)
+	return err
+}
+
+func (s *deviceAuthorizationServiceTestSuite) TestAuthorizeDevice() {
+	ctx := manager.ContextWithTokenManager(testtoken.ContextWithRequest(context.Background()), testtoken.TokenManager)
+
+	s.T().Run("ok", func(t *testing.T) {
+		deviceAuthorization := s.authorizeDevice(ctx)
+		deviceCode, err := s.Application.DeviceCodes().LoadByUserCode(ctx, deviceAuthorization.UserCode)
+		require.NoError(t, err)
+		// only the hash of the device code is stored
+		assert.NotEqual(t, deviceAuthorization.DeviceCode, deviceCode.DeviceCodeHash)
+		assert.Equal(t, s.Configuration.GetPublicOAuthClientID(), deviceCode.ClientID)
+		assert.False(t, deviceCode.Expired())
+		assert.Nil(t, deviceCode.Code)
+	})
+
+	s.T().Run("unknown client", func(t *testing.T) {
+		_, err := s.Application.DeviceAuthorizationService().AuthorizeDevice(ctx, uuid.NewV4().String(), nil,
+			"https://auth.openshift.io/api/authorize/device/verify")
+		require.Error(t, err)
+		require.IsType(t, autherrors.UnauthorizedError{}, err)
+	})
+}
+
+func (s *deviceAuthorizationServiceTestSuite) TestExchangeDeviceCode() {
+	ctx := manager.ContextWithTokenManager(testtoken.ContextWithRequest(context.Background()), testtoken.TokenManager)
+
+	s.T().Run("slow down", func(t *testing.T) {
+		deviceAuthorization := s.authorizeDevice(ctx)
+		err := s.exchange(ctx, deviceAuthorization.DeviceCode)
+		require.IsType(t, autherrors.OAuthError{}, err)
+		assert.Equal(t, "authorization_pending", err.(autherrors.OAuthError).Code)
+		// polling again within the interval
+		err = s.exchange(ctx, deviceAuthorization.DeviceCode)
+		require.IsType(t, autherrors.OAuthError{}, err)
+		assert.Equal(t, "slow_down", err.(autherrors.OAuthError).Code)
+	})
+
+	s.T().Run("expired", func(t *testing.T) {
+		deviceAuthorization := s.authorizeDevice(ctx)
+		deviceCode, err := s.Application.DeviceCodes().LoadByUserCode(ctx, deviceAuthorization.UserCode)
+		require.NoError(t, err)
+		deviceCode.ExpiryTime = time.Now().Add(-1 * time.Minute)
+		err = s.Application.DeviceCodes().Save(ctx, deviceCode)
+		require.NoError(t, err)
+
+		err = s.exchange(ctx, deviceAuthorization.DeviceCode)
+		require.IsType(t, autherrors.OAuthError{}, err)
+		assert.Equal(t, "expired_token", err.(autherrors.OAuthError).Code)
+		// the expired device code has been deleted
+		err = s.exchange(ctx, deviceAuthorization.DeviceCode)
+		require.IsType(t, autherrors.OAuthError{}, err)
+		assert.Equal(t, "invalid_grant", err.(autherrors.OAuthError).Code)
+	})
+
+	s.T().Run("unknown client", func(t *testing.T) {
+		deviceAuthorization := s.authorizeDevice(ctx)
+		redirectURL, err := url.Parse("https://auth.openshift.io/api/authorize/callback")
+		require.NoError(t, err)
+		_, _, err = s.Application.DeviceAuthorizationService().ExchangeDeviceCode(ctx, deviceAuthorization.DeviceCode,
+			uuid.NewV4().String(), redirectURL)
+		require.IsType(t, autherrors.UnauthorizedError{}, err)
+	})
+}
+
+func (s *deviceAuthorizationServiceTestSuite) TestVerifyDevice() {
+	ctx := manager.ContextWithTokenManager(testtoken.ContextWithRequest(context.Background()), testtoken.TokenManager)
+	redirect := "https://openshift.io/somepath"
+	callbackURL := "https://auth.openshift.io/api/authorize/callback"
+
+	s.T().Run("ok", func(t *testing.T) {
+		deviceAuthorization := s.authorizeDevice(ctx)
+		authCodeURL, err := s.Application.DeviceAuthorizationService().VerifyDevice(ctx, deviceAuthorization.UserCode,
+			&redirect, "", callbackURL)
+		require.NoError(t, err)
+		locationURL, err := url.Parse(*authCodeURL)
+		require.NoError(t, err)
+		state := locationURL.Query().Get("state")
+		deviceCode, err := s.Application.DeviceCodes().LoadByState(ctx, state)
+		require.NoError(t, err)
+		assert.Equal(t, deviceAuthorization.UserCode, deviceCode.UserCode)
+
+		// the authorization code is recorded for the device and not passed on to the browser
+		redirectTo, err := s.Application.AuthenticationProviderService().AuthorizeCallback(ctx, state, "SOME_OAUTH2.0_CODE")
+		require.NoError(t, err)
+		assert.Equal(t, redirect, *redirectTo)
+		deviceCode, err = s.Application.DeviceCodes().LoadByState(ctx, state)
+		require.NoError(t, err)
+		require.NotNil(t, deviceCode.Code)
+		assert.Equal(t, "SOME_OAUTH2.0_CODE", *deviceCode.Code)
+
+		// the user code can't be used again
+		_, err = s.Application.DeviceAuthorizationService().VerifyDevice(ctx, deviceAuthorization.UserCode,
+			&redirect, "", callbackURL)
+		require.IsType(t, autherrors.BadParameterError{}, err)
+	})
+
+	s.T().Run("unknown user code", func(t *testing.T) {
+		_, err := s.Application.DeviceAuthorizationService().VerifyDevice(ctx, uuid.NewV4().String(),
+			&redirect, "", callbackURL)
+		require.IsType(t, autherrors.BadParameterError{}, err)
+	})
+}
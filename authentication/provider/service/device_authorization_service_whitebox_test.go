@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/resource"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateUserCode(t *testing.T) {
+	t.Parallel()
+	resource.Require(t, resource.UnitTest)
+	userCode, err := generateUserCode()
+	require.NoError(t, err)
+	assert.Regexp(t, "^[BCDFGHJKLMNPQRSTVWXZ]{4}-[BCDFGHJKLMNPQRSTVWXZ]{4}$", userCode)
+}
+
+func TestGenerateDeviceCode(t *testing.T) {
+	t.Parallel()
+	resource.Require(t, resource.UnitTest)
+	deviceCode, err := generateDeviceCode()
+	require.NoError(t, err)
+	assert.Len(t, deviceCode, 43)
+	otherDeviceCode, err := generateDeviceCode()
+	require.NoError(t, err)
+	assert.NotEqual(t, deviceCode, otherDeviceCode)
+}
+
+func TestNormalizeUserCode(t *testing.T) {
+	t.Parallel()
+	resource.Require(t, resource.UnitTest)
+	assert.Equal(t, "WDJB-MJHT", normalizeUserCode("WDJB-MJHT"))
+	assert.Equal(t, "WDJB-MJHT", normalizeUserCode("wdjbmjht"))
+	assert.Equal(t, "WDJB-MJHT", normalizeUserCode(" wdjb-MJHT"))
+	assert.Equal(t, "WDJBM", normalizeUserCode("wdjbm"))
+}
@@ -80,7 +80,7 @@ func (s *linkServiceImpl) ProviderLocation(ctx context.Context, req *goa.Request
 		return "", err
 	}
 	state := uuid.NewV4().String()
-	err = s.Services().AuthenticationProviderService().SaveReferrer(ctx, state, redirectURL, nil, s.config.GetValidRedirectURLs())
+	err = s.Services().AuthenticationProviderService().SaveReferrer(ctx, state, redirectURL, nil)
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"redirect_url": redirectURL,
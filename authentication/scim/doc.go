@@ -0,0 +1,3 @@
+// Package scim contains the code to provision and deprovision the users and groups from an external identity provider,
+// as defined by SCIM 2.0 (RFC 7643 and RFC 7644).
+package scim
@@ -0,0 +1,369 @@
+package scim
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/errors"
+
+	errs "github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	// UserSchema is the schema of the SCIM users
+	UserSchema = "urn:ietf:params:scim:schemas:core:2.0:User"
+	// GroupSchema is the schema of the SCIM groups
+	GroupSchema = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	// ListResponseSchema is the schema of the responses of the SCIM list requests
+	ListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	// ErrorSchema is the schema of the SCIM error responses
+	ErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	// OperationAdd is the PATCH operation which adds a value to an attribute
+	OperationAdd = "add"
+	// OperationRemove is the PATCH operation which removes the value(s) of an attribute
+	OperationRemove = "remove"
+	// OperationReplace is the PATCH operation which replaces the value of an attribute
+	OperationReplace = "replace"
+)
+
+const (
+	// ErrorTypeInvalidFilter is the SCIM error type of the unsupported or invalid filters
+	ErrorTypeInvalidFilter = "invalidFilter"
+	// ErrorTypeInvalidPath is the SCIM error type of the unsupported or invalid attribute paths
+	ErrorTypeInvalidPath = "invalidPath"
+	// ErrorTypeInvalidSyntax is the SCIM error type of the requests which can't be parsed
+	ErrorTypeInvalidSyntax = "invalidSyntax"
+	// ErrorTypeInvalidValue is the SCIM error type of the missing or invalid attribute values
+	ErrorTypeInvalidValue = "invalidValue"
+	// ErrorTypeUniqueness is the SCIM error type of the values which are already in use
+	ErrorTypeUniqueness = "uniqueness"
+)
+
+// User holds the SCIM attributes of a user, which are mapped onto the account user and its identity
+type User struct {
+	UserName    string
+	DisplayName string
+	Email       string
+	Active      bool
+}
+
+// NewUser returns the SCIM attributes of the given identity and of its user
+func NewUser(identity account.Identity) User {
+	return User{
+		UserName:    identity.Username,
+		DisplayName: identity.User.FullName,
+		Email:       identity.User.Email,
+		Active:      !identity.User.Deprovisioned,
+	}
+}
+
+// Apply applies the given PATCH operation to the user. As the users only have one email, the filters of the emails
+// are ignored.
+func (u *User) Apply(operation PatchOperation) error {
+	operations, err := operation.Expand()
+	if err != nil {
+		return err
+	}
+	for _, op := range operations {
+		path, err := ParsePath(*op.Path)
+		if err != nil {
+			return err
+		}
+		if op.Op == OperationRemove {
+			// the display name is the only optional attribute
+			if path.is("displayname", "") || path.is("name", "") || path.is("name", "formatted") {
+				u.DisplayName = ""
+				continue
+			}
+			return errors.NewBadParameterErrorFromString("path", *op.Path, "the attribute is required and can't be removed")
+		}
+		err = u.set(*path, op.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *User) set(path Path, value interface{}) error {
+	switch {
+	case path.is("username", ""):
+		userName, ok := value.(string)
+		if !ok || strings.TrimSpace(userName) == "" {
+			return errors.NewBadParameterError(path.raw, value).Expected("non empty string")
+		}
+		u.UserName = userName
+	case path.is("displayname", ""), path.is("name", "formatted"):
+		displayName, ok := value.(string)
+		if !ok {
+			return errors.NewBadParameterError(path.raw, value).Expected("string")
+		}
+		u.DisplayName = displayName
+	case path.is("name", ""):
+		name, ok := value.(map[string]interface{})
+		if !ok {
+			return errors.NewBadParameterError(path.raw, value).Expected("object")
+		}
+		if formatted, ok := lookup(name, "formatted").(string); ok {
+			u.DisplayName = formatted
+		}
+	case path.is("active", ""):
+		active, ok := boolValue(value)
+		if !ok {
+			return errors.NewBadParameterError(path.raw, value).Expected("boolean")
+		}
+		u.Active = active
+	case path.Attribute == "emails" && (path.SubAttribute == "" || path.SubAttribute == "value"):
+		email, ok := emailValue(value)
+		if !ok {
+			return errors.NewBadParameterError(path.raw, value).Expected("email")
+		}
+		u.Email = email
+	default:
+		return errors.NewBadParameterErrorFromString("path", path.raw, "unsupported attribute")
+	}
+	return nil
+}
+
+// Group is a team or an organization, along with the identities of its direct members
+type Group struct {
+	Identity account.Identity
+	Members  []account.Identity
+}
+
+// DisplayName returns the name of the team or organization
+func (g Group) DisplayName() string {
+	return g.Identity.IdentityResource.Name
+}
+
+// GetETagData returns the field values to use to generate the ETag. The members are part of it, as the identity of
+// the group isn't updated when its memberships change.
+func (g Group) GetETagData() []interface{} {
+	memberIDs := make([]string, len(g.Members))
+	for i, member := range g.Members {
+		memberIDs[i] = member.ID.String()
+	}
+	sort.Strings(memberIDs)
+	data := g.Identity.GetETagData()
+	for _, memberID := range memberIDs {
+		data = append(data, memberID)
+	}
+	return data
+}
+
+// GetLastModified returns the last modification time
+func (g Group) GetLastModified() time.Time {
+	return g.Identity.GetLastModified()
+}
+
+// MemberIDs returns the identity IDs of the members in the value of a PATCH operation of a group, which is a list of
+// objects such as {"value": "<identity ID>"}
+func MemberIDs(value interface{}) ([]uuid.UUID, error) {
+	members, ok := value.([]interface{})
+	if !ok {
+		members = []interface{}{value}
+	}
+	memberIDs := make([]uuid.UUID, len(members))
+	for i, m := range members {
+		member, _ := m.(map[string]interface{})
+		id, _ := lookup(member, "value").(string)
+		memberID, err := uuid.FromString(id)
+		if err != nil {
+			return nil, errors.NewBadParameterError("members", m).Expected("object with the identity ID of the member as value")
+		}
+		memberIDs[i] = memberID
+	}
+	return memberIDs, nil
+}
+
+// PatchOperation is an operation of a SCIM PATCH request
+type PatchOperation struct {
+	Op    string
+	Path  *string
+	Value interface{}
+}
+
+// Expand validates the operation and returns it with its lower case name. An operation without path is expanded into
+// one operation per attribute of its value, as its value is then an object holding the modified attributes.
+func (op PatchOperation) Expand() ([]PatchOperation, error) {
+	name := strings.ToLower(op.Op)
+	if name != OperationAdd && name != OperationRemove && name != OperationReplace {
+		return nil, errors.NewBadParameterError("op", op.Op).Expected("add, remove or replace")
+	}
+	if op.Path != nil && strings.TrimSpace(*op.Path) != "" {
+		return []PatchOperation{{Op: name, Path: op.Path, Value: op.Value}}, nil
+	}
+	if name == OperationRemove {
+		return nil, errors.NewBadParameterErrorFromString("path", "", "the path is required by the remove operations")
+	}
+	values, ok := op.Value.(map[string]interface{})
+	if !ok {
+		return nil, errors.NewBadParameterError("value", op.Value).Expected("object with the modified attributes")
+	}
+	attributes := make([]string, 0, len(values))
+	for attribute := range values {
+		attributes = append(attributes, attribute)
+	}
+	sort.Strings(attributes)
+	operations := make([]PatchOperation, len(attributes))
+	for i, attribute := range attributes {
+		path := attribute
+		operations[i] = PatchOperation{Op: name, Path: &path, Value: values[attribute]}
+	}
+	return operations, nil
+}
+
+// Filter is an equality filter, such as `userName eq "john"`, which is the only kind of filter supported
+type Filter struct {
+	// Attribute is the lower case name of the filtered attribute, without its schema
+	Attribute string
+	Value     string
+}
+
+var filterPattern = regexp.MustCompile(`^\s*(\S+)\s+(?i:eq)\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// ParseFilter parses the given SCIM filter, which must be an equality filter such as `userName eq "john"`
+func ParseFilter(filter string) (*Filter, error) {
+	match := filterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return nil, errors.NewBadParameterErrorFromString("filter", filter, `only the equality filters are supported, such as userName eq "john"`)
+	}
+	value, err := strconv.Unquote(match[2])
+	if err != nil {
+		return nil, errors.NewBadParameterErrorFromString("filter", filter, "invalid value")
+	}
+	return &Filter{Attribute: attributeName(match[1]), Value: value}, nil
+}
+
+// Path is the path of a PATCH operation, such as `emails[type eq "work"].value`
+type Path struct {
+	// Attribute is the lower case name of the attribute, without its schema
+	Attribute string
+	// Filter is the optional filter of the values of a multi-valued attribute
+	Filter *Filter
+	// SubAttribute is the lower case name of the optional sub-attribute
+	SubAttribute string
+	raw          string
+}
+
+var pathPattern = regexp.MustCompile(`^([^\[\]]+?)(?:\[(.+)\])?(?:\.(\w+))?$`)
+
+// ParsePath parses the given path of a PATCH operation
+func ParsePath(path string) (*Path, error) {
+	match := pathPattern.FindStringSubmatch(strings.TrimSpace(path))
+	if match == nil {
+		return nil, errors.NewBadParameterErrorFromString("path", path, "invalid path")
+	}
+	result := &Path{
+		Attribute:    attributeName(match[1]),
+		SubAttribute: strings.ToLower(match[3]),
+		raw:          path,
+	}
+	if match[2] != "" {
+		filter, err := ParseFilter(match[2])
+		if err != nil {
+			return nil, err
+		}
+		result.Filter = filter
+	}
+	return result, nil
+}
+
+// is returns true if the path has no filter and has the given attribute and sub-attribute
+func (p Path) is(attribute string, subAttribute string) bool {
+	return p.Filter == nil && p.Attribute == attribute && p.SubAttribute == subAttribute
+}
+
+// MatchesETag returns true if the given value of an If-Match header matches the given entity tag. The weakness
+// indicators and quotes of the header are ignored.
+func MatchesETag(ifMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.Trim(strings.TrimPrefix(candidate, "W/"), `"`) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeName returns the lower case name of the given attribute, without its schema if it is fully qualified
+func attributeName(name string) string {
+	if strings.HasPrefix(strings.ToLower(name), "urn:") {
+		name = name[strings.LastIndex(name, ":")+1:]
+	}
+	return strings.ToLower(name)
+}
+
+// lookup returns the value of the given attribute, whose name is case insensitive
+func lookup(values map[string]interface{}, attribute string) interface{} {
+	for name, value := range values {
+		if strings.EqualFold(name, attribute) {
+			return value
+		}
+	}
+	return nil
+}
+
+// boolValue returns the given boolean, which some identity providers send as a string
+func boolValue(value interface{}) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(strings.ToLower(v))
+		return b, err == nil
+	}
+	return false, false
+}
+
+// emailValue returns the email of the given value, which is either the email, an email object, or a list of email
+// objects in which case the primary email (or the first one) is returned
+func emailValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, v != ""
+	case map[string]interface{}:
+		return emailValue(lookup(v, "value"))
+	case []interface{}:
+		for _, e := range v {
+			if email, ok := e.(map[string]interface{}); ok {
+				if primary, _ := boolValue(lookup(email, "primary")); primary {
+					return emailValue(email)
+				}
+			}
+		}
+		if len(v) > 0 {
+			return emailValue(v[0])
+		}
+	}
+	return "", false
+}
+
+// ErrorType returns the SCIM error type of the given error, as defined by RFC 7644, section 3.12, or an empty string if
+// there is no matching type
+func ErrorType(err error) string {
+	switch cause := errs.Cause(err).(type) {
+	case errors.BadParameterError:
+		switch cause.Parameter() {
+		case "filter":
+			return ErrorTypeInvalidFilter
+		case "path":
+			return ErrorTypeInvalidPath
+		case "payload", "op":
+			return ErrorTypeInvalidSyntax
+		}
+		return ErrorTypeInvalidValue
+	case errors.DataConflictError:
+		return ErrorTypeUniqueness
+	}
+	return ""
+}
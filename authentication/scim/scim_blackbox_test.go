@@ -0,0 +1,203 @@
+package scim_test
+
+import (
+	"testing"
+	"time"
+
+	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/authentication/scim"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+
+	errs "github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	t.Run("ok", func(t *testing.T) {
+		filter, err := scim.ParseFilter(`userName eq "john"`)
+		require.NoError(t, err)
+		assert.Equal(t, scim.Filter{Attribute: "username", Value: "john"}, *filter)
+	})
+
+	t.Run("fully qualified attribute", func(t *testing.T) {
+		filter, err := scim.ParseFilter(`urn:ietf:params:scim:schemas:core:2.0:User:userName EQ "john \"the\" doe"`)
+		require.NoError(t, err)
+		assert.Equal(t, scim.Filter{Attribute: "username", Value: `john "the" doe`}, *filter)
+	})
+
+	t.Run("unsupported operator", func(t *testing.T) {
+		_, err := scim.ParseFilter(`userName sw "jo"`)
+		testsupport.AssertError(t, err, errors.BadParameterError{}, `Bad value for parameter 'filter': 'userName sw "jo"' - only the equality filters are supported, such as userName eq "john"`)
+	})
+
+	t.Run("unquoted value", func(t *testing.T) {
+		_, err := scim.ParseFilter(`userName eq john`)
+		require.Error(t, err)
+	})
+}
+
+func TestParsePath(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	t.Run("attribute", func(t *testing.T) {
+		path, err := scim.ParsePath("userName")
+		require.NoError(t, err)
+		assert.Equal(t, "username", path.Attribute)
+		assert.Nil(t, path.Filter)
+		assert.Empty(t, path.SubAttribute)
+	})
+
+	t.Run("sub-attribute", func(t *testing.T) {
+		path, err := scim.ParsePath("urn:ietf:params:scim:schemas:core:2.0:User:name.formatted")
+		require.NoError(t, err)
+		assert.Equal(t, "name", path.Attribute)
+		assert.Equal(t, "formatted", path.SubAttribute)
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		path, err := scim.ParsePath(`emails[type eq "work"].value`)
+		require.NoError(t, err)
+		assert.Equal(t, "emails", path.Attribute)
+		assert.Equal(t, scim.Filter{Attribute: "type", Value: "work"}, *path.Filter)
+		assert.Equal(t, "value", path.SubAttribute)
+	})
+
+	t.Run("invalid filter", func(t *testing.T) {
+		_, err := scim.ParsePath(`members[value]`)
+		require.Error(t, err)
+	})
+}
+
+func TestApplyToUser(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+
+	newUser := func() scim.User {
+		return scim.User{UserName: "john", DisplayName: "John Doe", Email: "john@example.com", Active: true}
+	}
+	path := func(p string) *string {
+		return &p
+	}
+
+	t.Run("replace attributes", func(t *testing.T) {
+		user := newUser()
+		err := user.Apply(scim.PatchOperation{Op: "Replace", Path: path("active"), Value: false})
+		require.NoError(t, err)
+		err = user.Apply(scim.PatchOperation{Op: "replace", Path: path(`emails[type eq "work"].value`), Value: "jdoe@example.com"})
+		require.NoError(t, err)
+		err = user.Apply(scim.PatchOperation{Op: "add", Path: path("name.formatted"), Value: "Johnny Doe"})
+		require.NoError(t, err)
+		assert.Equal(t, scim.User{UserName: "john", DisplayName: "Johnny Doe", Email: "jdoe@example.com", Active: false}, user)
+	})
+
+	t.Run("replace without path", func(t *testing.T) {
+		user := newUser()
+		err := user.Apply(scim.PatchOperation{Op: "replace", Value: map[string]interface{}{
+			"userName": "jdoe",
+			"active":   "False",
+			"emails": []interface{}{
+				map[string]interface{}{"value": "home@example.com"},
+				map[string]interface{}{"value": "work@example.com", "primary": true},
+			},
+		}})
+		require.NoError(t, err)
+		assert.Equal(t, scim.User{UserName: "jdoe", DisplayName: "John Doe", Email: "work@example.com", Active: false}, user)
+	})
+
+	t.Run("remove display name", func(t *testing.T) {
+		user := newUser()
+		err := user.Apply(scim.PatchOperation{Op: "remove", Path: path("displayName")})
+		require.NoError(t, err)
+		assert.Empty(t, user.DisplayName)
+	})
+
+	t.Run("remove username", func(t *testing.T) {
+		user := newUser()
+		err := user.Apply(scim.PatchOperation{Op: "remove", Path: path("userName")})
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'path': 'userName' - the attribute is required and can't be removed")
+	})
+
+	t.Run("unsupported attribute", func(t *testing.T) {
+		user := newUser()
+		err := user.Apply(scim.PatchOperation{Op: "replace", Path: path("nickName"), Value: "johnny"})
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'path': 'nickName' - unsupported attribute")
+	})
+
+	t.Run("unsupported operation", func(t *testing.T) {
+		user := newUser()
+		err := user.Apply(scim.PatchOperation{Op: "move", Path: path("userName"), Value: "jdoe"})
+		require.Error(t, err)
+		assert.Equal(t, newUser(), user)
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		user := newUser()
+		err := user.Apply(scim.PatchOperation{Op: "replace", Path: path("active"), Value: "maybe"})
+		require.Error(t, err)
+		assert.True(t, user.Active)
+	})
+}
+
+func TestMemberIDs(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	id1 := uuid.NewV4()
+	id2 := uuid.NewV4()
+
+	t.Run("ok", func(t *testing.T) {
+		memberIDs, err := scim.MemberIDs([]interface{}{
+			map[string]interface{}{"value": id1.String()},
+			map[string]interface{}{"value": id2.String(), "display": "john"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{id1, id2}, memberIDs)
+	})
+
+	t.Run("invalid member", func(t *testing.T) {
+		_, err := scim.MemberIDs([]interface{}{"foo"})
+		require.Error(t, err)
+	})
+}
+
+func TestGroupETagData(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	now := time.Now()
+	identity := account.Identity{ID: uuid.NewV4(), Lifecycle: gormsupport.Lifecycle{UpdatedAt: now}}
+	member1 := account.Identity{ID: uuid.NewV4()}
+	member2 := account.Identity{ID: uuid.NewV4()}
+
+	// the order of the members doesn't matter
+	assert.Equal(t,
+		scim.Group{Identity: identity, Members: []account.Identity{member1, member2}}.GetETagData(),
+		scim.Group{Identity: identity, Members: []account.Identity{member2, member1}}.GetETagData())
+	// but the members do
+	assert.NotEqual(t,
+		scim.Group{Identity: identity, Members: []account.Identity{member1}}.GetETagData(),
+		scim.Group{Identity: identity, Members: []account.Identity{member1, member2}}.GetETagData())
+}
+
+func TestMatchesETag(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	assert.True(t, scim.MatchesETag("abc=", "abc="))
+	assert.True(t, scim.MatchesETag(`W/"abc="`, "abc="))
+	assert.True(t, scim.MatchesETag(`"xyz=", "abc="`, "abc="))
+	assert.True(t, scim.MatchesETag("*", "abc="))
+	assert.False(t, scim.MatchesETag(`"xyz="`, "abc="))
+}
+
+func TestErrorType(t *testing.T) {
+	resource.Require(t, resource.UnitTest)
+	_, err := scim.ParseFilter(`userName sw "jo"`)
+	assert.Equal(t, scim.ErrorTypeInvalidFilter, scim.ErrorType(err))
+	_, err = scim.ParsePath("emails[")
+	assert.Equal(t, scim.ErrorTypeInvalidPath, scim.ErrorType(err))
+	assert.Equal(t, scim.ErrorTypeInvalidSyntax, scim.ErrorType(errors.NewBadParameterError("op", "move")))
+	assert.Equal(t, scim.ErrorTypeInvalidValue, scim.ErrorType(errs.WithStack(errors.NewBadParameterError("userName", ""))))
+	assert.Equal(t, scim.ErrorTypeUniqueness, scim.ErrorType(errors.NewDataConflictError("username already in use")))
+	assert.Empty(t, scim.ErrorType(errors.NewVersionConflictError("outdated version")))
+}
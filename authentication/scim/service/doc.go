@@ -0,0 +1,2 @@
+// Package service provides the service for provisioning the users and groups with SCIM 2.0.
+package service
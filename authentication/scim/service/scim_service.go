@@ -0,0 +1,511 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/application/service"
+	"github.com/fabric8-services/fabric8-auth/application/service/base"
+	servicecontext "github.com/fabric8-services/fabric8-auth/application/service/context"
+	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/authentication/scim"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+)
+
+// ScimServiceConfiguration the required configuration for the SCIM service implementation
+type ScimServiceConfiguration interface {
+	GetOpenShiftClientApiUrl() string
+}
+
+type scimServiceImpl struct {
+	base.BaseService
+	config ScimServiceConfiguration
+}
+
+// NewScimService returns a new ScimService implementation
+func NewScimService(context servicecontext.ServiceContext, config ScimServiceConfiguration) service.ScimService {
+	return &scimServiceImpl{
+		BaseService: base.NewBaseService(context),
+		config:      config,
+	}
+}
+
+// ListUsers returns the given page of the users matching the optional filter, sorted by username, along with the
+// total count of matching users. The users can be filtered by userName or by email.
+func (s *scimServiceImpl) ListUsers(ctx context.Context, filter *scim.Filter, startIndex int, count int) ([]account.Identity, int, error) {
+	funcs := []func(*gorm.DB) *gorm.DB{
+		account.IdentityFilterByProviderType(account.DefaultIDP),
+		account.IdentityFilterHasUser(),
+	}
+	if filter != nil {
+		switch filter.Attribute {
+		case "username":
+			funcs = append(funcs, account.IdentityFilterByUsername(filter.Value))
+		case "emails", "emails.value":
+			funcs = append(funcs, account.IdentityFilterByUserEmail(filter.Value))
+		default:
+			return nil, 0, errors.NewBadParameterErrorFromString("filter", filter.Attribute, "only the userName and emails of the users can be filtered")
+		}
+	}
+	var identities []account.Identity
+	var total int
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		total, err = s.Repositories().Identities().Count(ctx, funcs...)
+		if err != nil {
+			return err
+		}
+		identities, err = s.Repositories().Identities().Query(append(funcs, account.IdentityWithUser(), page("username", startIndex, count))...)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return identities, total, nil
+}
+
+// LoadUser returns the identity with the given ID, along with its user.
+// Returns NotFoundError if there is no such user
+func (s *scimServiceImpl) LoadUser(ctx context.Context, id uuid.UUID) (*account.Identity, error) {
+	var identity *account.Identity
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		identity, err = s.loadUser(ctx, id)
+		return err
+	})
+	return identity, err
+}
+
+func (s *scimServiceImpl) loadUser(ctx context.Context, id uuid.UUID) (*account.Identity, error) {
+	identities, err := s.Repositories().Identities().Query(
+		account.IdentityFilterByID(id),
+		account.IdentityFilterByProviderType(account.DefaultIDP),
+		account.IdentityFilterHasUser(),
+		account.IdentityWithUser())
+	if err != nil {
+		return nil, err
+	}
+	if len(identities) == 0 {
+		return nil, errors.NewNotFoundError("user", id.String())
+	}
+	return &identities[0], nil
+}
+
+// CreateUser creates the user and its identity, and links the identity to the default cluster. The user is created in
+// WIT too. Returns DataConflictError if the userName or the email is already used, or BadParameterError if the userName
+// was recently released by another user.
+func (s *scimServiceImpl) CreateUser(ctx context.Context, user scim.User) (*account.Identity, error) {
+	err := validateUser(user)
+	if err != nil {
+		return nil, err
+	}
+	identity := &account.Identity{
+		ID:           uuid.NewV4(),
+		ProviderType: account.DefaultIDP,
+		User: account.User{
+			ID:            uuid.NewV4(),
+			Email:         user.Email,
+			FullName:      user.DisplayName,
+			Cluster:       s.config.GetOpenShiftClientApiUrl(),
+			EmailVerified: true,
+			FeatureLevel:  account.DefaultFeatureLevel,
+			Deprovisioned: !user.Active,
+		},
+	}
+	identity.UserID = account.NullUUID{UUID: identity.User.ID, Valid: true}
+
+	err = s.ExecuteInTransaction(func() error {
+		err := s.checkUserNameAvailable(ctx, user.UserName)
+		if err != nil {
+			return err
+		}
+		err = s.checkEmailAvailable(ctx, user.Email)
+		if err != nil {
+			return err
+		}
+		err = s.Services().UserService().ClaimUsername(ctx, s.Repositories(), identity, user.UserName)
+		if err != nil {
+			return err
+		}
+		err = s.Repositories().Users().Create(ctx, &identity.User)
+		if err != nil {
+			return err
+		}
+		return s.Repositories().Identities().Create(ctx, identity)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Services().ClusterService().LinkIdentityToCluster(ctx, identity.ID, identity.User.Cluster)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":         err,
+			"identity_id": identity.ID,
+			"cluster_url": identity.User.Cluster,
+		}, "failed to link identity to cluster in cluster service")
+		// hard delete user and identity so that the identity provider can repeat the provisioning
+		if err := s.Services().UserService().HardDeleteUser(ctx, *identity); err != nil {
+			return nil, errs.Wrapf(err, "linking identity %s to cluster failed, and deleting its user failed", identity.ID)
+		}
+		return nil, errs.Wrapf(err, "failed to link identity with id %s to cluster having url %s", identity.ID, identity.User.Cluster)
+	}
+
+	err = s.Services().WITService().CreateUser(ctx, identity, identity.ID.String())
+	if err != nil {
+		// not a blocker
+		log.Error(ctx, map[string]interface{}{
+			"err":      err,
+			"username": identity.Username,
+		}, "failed to create user in WIT")
+	}
+	log.Info(ctx, map[string]interface{}{
+		"identity_id": identity.ID,
+		"username":    identity.Username,
+	}, "user provisioned")
+	return identity, nil
+}
+
+// ReplaceUser replaces the attributes of the user with the given identity ID. Returns the updated identity, and whether
+// the user has just been deactivated.
+// Returns VersionConflictError if the ifMatch header doesn't match the ETag of the user
+func (s *scimServiceImpl) ReplaceUser(ctx context.Context, id uuid.UUID, ifMatch *string, user scim.User) (*account.Identity, bool, error) {
+	return s.updateUser(ctx, id, ifMatch, func(u *scim.User) error {
+		*u = user
+		return nil
+	})
+}
+
+// PatchUser applies the given PATCH operations to the user with the given identity ID. Returns the updated identity,
+// and whether the user has just been deactivated.
+// Returns VersionConflictError if the ifMatch header doesn't match the ETag of the user
+func (s *scimServiceImpl) PatchUser(ctx context.Context, id uuid.UUID, ifMatch *string, operations []scim.PatchOperation) (*account.Identity, bool, error) {
+	return s.updateUser(ctx, id, ifMatch, func(u *scim.User) error {
+		for _, op := range operations {
+			err := u.Apply(op)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *scimServiceImpl) updateUser(ctx context.Context, id uuid.UUID, ifMatch *string, update func(*scim.User) error) (*account.Identity, bool, error) {
+	var identity *account.Identity
+	var deactivated bool
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		identity, err = s.loadUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		err = checkVersion(ifMatch, identity.User, "user", id)
+		if err != nil {
+			return err
+		}
+		user := scim.NewUser(*identity)
+		err = update(&user)
+		if err != nil {
+			return err
+		}
+		err = validateUser(user)
+		if err != nil {
+			return err
+		}
+		if user.UserName != identity.Username {
+			err = s.checkUserNameAvailable(ctx, user.UserName)
+			if err != nil {
+				return err
+			}
+			err = s.Services().UserService().ClaimUsername(ctx, s.Repositories(), identity, user.UserName)
+			if err != nil {
+				return err
+			}
+		}
+		if user.Email != identity.User.Email {
+			err = s.checkEmailAvailable(ctx, user.Email)
+			if err != nil {
+				return err
+			}
+		}
+		deactivated = !identity.User.Deprovisioned && !user.Active
+		identity.User.FullName = user.DisplayName
+		identity.User.Email = user.Email
+		identity.User.Deprovisioned = !user.Active
+		err = s.Repositories().Users().Save(ctx, &identity.User)
+		if err != nil {
+			return err
+		}
+		return s.Repositories().Identities().Save(ctx, identity)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return identity, deactivated, nil
+}
+
+// DeleteUser deprovisions the user with the given identity ID. The account is kept, so that it can be reactivated.
+// Returns VersionConflictError if the ifMatch header doesn't match the ETag of the user
+func (s *scimServiceImpl) DeleteUser(ctx context.Context, id uuid.UUID, ifMatch *string) error {
+	return s.ExecuteInTransaction(func() error {
+		identity, err := s.loadUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		err = checkVersion(ifMatch, identity.User, "user", id)
+		if err != nil {
+			return err
+		}
+		identity.User.Deprovisioned = true
+		return s.Repositories().Users().Save(ctx, &identity.User)
+	})
+}
+
+// ListGroups returns the given page of the teams and organizations matching the optional filter, along with the total
+// count of matching groups. The groups can be filtered by displayName.
+func (s *scimServiceImpl) ListGroups(ctx context.Context, filter *scim.Filter, startIndex int, count int) ([]scim.Group, int, error) {
+	funcs := []func(*gorm.DB) *gorm.DB{
+		account.IdentityFilterByResourceTypes(authorization.IdentityResourceTypeTeam, authorization.IdentityResourceTypeOrganization),
+	}
+	if filter != nil {
+		if filter.Attribute != "displayname" {
+			return nil, 0, errors.NewBadParameterErrorFromString("filter", filter.Attribute, "only the displayName of the groups can be filtered")
+		}
+		funcs = append(funcs, account.IdentityFilterByResourceName(filter.Value))
+	}
+	var groups []scim.Group
+	var total int
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		total, err = s.Repositories().Identities().Count(ctx, funcs...)
+		if err != nil {
+			return err
+		}
+		identities, err := s.Repositories().Identities().Query(append(funcs, account.IdentityWithResource(), page("created_at", startIndex, count))...)
+		if err != nil {
+			return err
+		}
+		groups = make([]scim.Group, len(identities))
+		for i, identity := range identities {
+			members, err := s.members(ctx, identity.ID)
+			if err != nil {
+				return err
+			}
+			groups[i] = scim.Group{Identity: identity, Members: members}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return groups, total, nil
+}
+
+// LoadGroup returns the team or organization with the given identity ID, along with its direct members.
+// Returns NotFoundError if there is no such group
+func (s *scimServiceImpl) LoadGroup(ctx context.Context, id uuid.UUID) (*scim.Group, error) {
+	var group *scim.Group
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		group, err = s.loadGroup(ctx, id)
+		return err
+	})
+	return group, err
+}
+
+func (s *scimServiceImpl) loadGroup(ctx context.Context, id uuid.UUID) (*scim.Group, error) {
+	identities, err := s.Repositories().Identities().Query(
+		account.IdentityFilterByID(id),
+		account.IdentityFilterByResourceTypes(authorization.IdentityResourceTypeTeam, authorization.IdentityResourceTypeOrganization),
+		account.IdentityWithResource())
+	if err != nil {
+		return nil, err
+	}
+	if len(identities) == 0 {
+		return nil, errors.NewNotFoundError("group", id.String())
+	}
+	members, err := s.members(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &scim.Group{Identity: identities[0], Members: members}, nil
+}
+
+func (s *scimServiceImpl) members(ctx context.Context, id uuid.UUID) ([]account.Identity, error) {
+	return s.Repositories().Identities().Query(account.IdentityFilterByMemberOf(id), account.IdentityWithResource())
+}
+
+// PatchGroup applies the given PATCH operations to the members of the team or organization with the given identity ID,
+// and returns the updated group. The privilege caches of the added and removed members are flagged as stale.
+// Returns VersionConflictError if the ifMatch header doesn't match the ETag of the group
+func (s *scimServiceImpl) PatchGroup(ctx context.Context, id uuid.UUID, ifMatch *string, operations []scim.PatchOperation) (*scim.Group, error) {
+	var group *scim.Group
+	err := s.ExecuteInTransaction(func() error {
+		var err error
+		group, err = s.loadGroup(ctx, id)
+		if err != nil {
+			return err
+		}
+		err = checkVersion(ifMatch, *group, "group", id)
+		if err != nil {
+			return err
+		}
+		members := make(map[uuid.UUID]bool, len(group.Members))
+		for _, member := range group.Members {
+			members[member.ID] = true
+		}
+		for _, operation := range operations {
+			expanded, err := operation.Expand()
+			if err != nil {
+				return err
+			}
+			for _, op := range expanded {
+				err = s.patchMembers(ctx, id, members, op)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		group, err = s.loadGroup(ctx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// patchMembers applies the given PATCH operation to the given members of the group
+func (s *scimServiceImpl) patchMembers(ctx context.Context, groupID uuid.UUID, members map[uuid.UUID]bool, op scim.PatchOperation) error {
+	path, err := scim.ParsePath(*op.Path)
+	if err != nil {
+		return err
+	}
+	if path.Attribute != "members" || path.SubAttribute != "" {
+		return errors.NewBadParameterErrorFromString("path", *op.Path, "only the members of the groups can be modified")
+	}
+	var memberIDs []uuid.UUID
+	if path.Filter != nil {
+		// e.g. members[value eq "<identity ID>"], which is only supported by the remove operations
+		memberID, err := uuid.FromString(path.Filter.Value)
+		if op.Op != scim.OperationRemove || path.Filter.Attribute != "value" || err != nil {
+			return errors.NewBadParameterErrorFromString("path", *op.Path, `only the members[value eq "<identity ID>"] path of the remove operations is supported`)
+		}
+		memberIDs = []uuid.UUID{memberID}
+	} else if op.Value != nil {
+		memberIDs, err = scim.MemberIDs(op.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	add := map[uuid.UUID]bool{}
+	remove := map[uuid.UUID]bool{}
+	switch op.Op {
+	case scim.OperationAdd:
+		for _, memberID := range memberIDs {
+			add[memberID] = true
+		}
+	case scim.OperationRemove:
+		if path.Filter == nil && op.Value == nil {
+			// removes all the members
+			for memberID := range members {
+				remove[memberID] = true
+			}
+		}
+		for _, memberID := range memberIDs {
+			remove[memberID] = true
+		}
+	case scim.OperationReplace:
+		for _, memberID := range memberIDs {
+			add[memberID] = true
+		}
+		for memberID := range members {
+			if !add[memberID] {
+				remove[memberID] = true
+			}
+		}
+	}
+
+	for memberID := range remove {
+		if !members[memberID] {
+			continue
+		}
+		err := s.Repositories().Identities().RemoveMember(ctx, groupID, memberID)
+		if err != nil {
+			return err
+		}
+		delete(members, memberID)
+	}
+	for memberID := range add {
+		if members[memberID] {
+			continue
+		}
+		if memberID == groupID {
+			return errors.NewBadParameterErrorFromString("members", memberID.String(), "a group can't be a member of itself")
+		}
+		err := s.Repositories().Identities().AddMember(ctx, groupID, memberID)
+		if err != nil {
+			return err
+		}
+		members[memberID] = true
+	}
+	return nil
+}
+
+func (s *scimServiceImpl) checkUserNameAvailable(ctx context.Context, userName string) error {
+	identities, err := s.Repositories().Identities().Query(
+		account.IdentityFilterByUsername(userName),
+		account.IdentityFilterByProviderType(account.DefaultIDP))
+	if err != nil {
+		return err
+	}
+	if len(identities) > 0 {
+		return errors.NewDataConflictError(fmt.Sprintf("user with username '%s' already exists", userName))
+	}
+	return nil
+}
+
+func (s *scimServiceImpl) checkEmailAvailable(ctx context.Context, email string) error {
+	users, err := s.Repositories().Users().Query(account.UserFilterByEmail(email))
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return errors.NewDataConflictError(fmt.Sprintf("user with email '%s' already exists", email))
+	}
+	return nil
+}
+
+func validateUser(user scim.User) error {
+	if user.UserName == "" {
+		return errors.NewBadParameterError("userName", user.UserName).Expected("non empty string")
+	}
+	if user.Email == "" {
+		return errors.NewBadParameterError("emails", user.Email).Expected("at least one email")
+	}
+	return nil
+}
+
+// checkVersion returns VersionConflictError if the given If-Match header doesn't match the ETag of the given entity
+func checkVersion(ifMatch *string, entity app.ConditionalRequestEntity, kind string, id uuid.UUID) error {
+	if ifMatch != nil && !scim.MatchesETag(*ifMatch, app.GenerateEntityTag(entity)) {
+		return errors.NewVersionConflictError(fmt.Sprintf("the %s %s has been modified", kind, id))
+	}
+	return nil
+}
+
+// page returns a gorm filter of the given page, where the startIndex starts at 1 as defined by SCIM
+func page(order string, startIndex int, count int) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Order(order + ", id").Offset(startIndex - 1).Limit(count)
+	}
+}
@@ -0,0 +1,403 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/application/service"
+	"github.com/fabric8-services/fabric8-auth/application/service/factory"
+	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/authentication/scim"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormapplication"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/resource"
+	"github.com/fabric8-services/fabric8-auth/rest"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+	testservice "github.com/fabric8-services/fabric8-auth/test/service"
+
+	errs "github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type scimServiceBlackBoxTest struct {
+	gormtestsupport.DBTestSuite
+	clusterServiceMock *testservice.ClusterServiceMock
+	scimService        service.ScimService
+}
+
+func TestRunScimServiceBlackBoxTest(t *testing.T) {
+	resource.Require(t, resource.Database)
+	suite.Run(t, &scimServiceBlackBoxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *scimServiceBlackBoxTest) SetupSuite() {
+	s.DBTestSuite.SetupSuite()
+	s.clusterServiceMock = testsupport.NewClusterServiceMock(s.T())
+	witServiceMock := testsupport.NewWITMock(s.T(), uuid.NewV4().String(), "")
+	s.Application = gormapplication.NewGormDB(s.DB, s.Configuration, s.Wrappers,
+		factory.WithClusterService(s.clusterServiceMock), factory.WithWITService(witServiceMock))
+}
+
+func (s *scimServiceBlackBoxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.scimService = s.Application.ScimService()
+}
+
+func (s *scimServiceBlackBoxTest) newUser(t *testing.T) *account.Identity {
+	name := uuid.NewV4().String()
+	identity, err := s.scimService.CreateUser(s.Ctx, scim.User{
+		UserName:    "user-" + name,
+		DisplayName: "User " + name,
+		Email:       name + "@example.com",
+		Active:      true,
+	})
+	require.NoError(t, err)
+	return identity
+}
+
+func (s *scimServiceBlackBoxTest) TestCreateUser() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// when
+		identity := s.newUser(t)
+		// then
+		loaded, err := s.scimService.LoadUser(s.Ctx, identity.ID)
+		require.NoError(t, err)
+		assert.Equal(t, identity.Username, loaded.Username)
+		assert.Equal(t, account.DefaultIDP, loaded.ProviderType)
+		assert.Equal(t, identity.User.Email, loaded.User.Email)
+		assert.Equal(t, s.Configuration.GetOpenShiftClientApiUrl(), loaded.User.Cluster)
+		assert.True(t, loaded.User.EmailVerified)
+		assert.False(t, loaded.User.Deprovisioned)
+	})
+
+	s.T().Run("username conflict", func(t *testing.T) {
+		// given
+		identity := s.newUser(t)
+		// when
+		_, err := s.scimService.CreateUser(s.Ctx, scim.User{UserName: identity.Username, Email: uuid.NewV4().String() + "@example.com", Active: true})
+		// then
+		testsupport.AssertError(t, err, errors.DataConflictError{}, fmt.Sprintf("user with username '%s' already exists", identity.Username))
+	})
+
+	s.T().Run("email conflict", func(t *testing.T) {
+		// given
+		identity := s.newUser(t)
+		// when
+		_, err := s.scimService.CreateUser(s.Ctx, scim.User{UserName: uuid.NewV4().String(), Email: identity.User.Email, Active: true})
+		// then
+		testsupport.AssertError(t, err, errors.DataConflictError{}, fmt.Sprintf("user with email '%s' already exists", identity.User.Email))
+	})
+
+	s.T().Run("quarantined username", func(t *testing.T) {
+		// given a username released by another user
+		identity := s.newUser(t)
+		path := "userName"
+		_, _, err := s.scimService.PatchUser(s.Ctx, identity.ID, nil, []scim.PatchOperation{
+			{Op: "replace", Path: &path, Value: uuid.NewV4().String()},
+		})
+		require.NoError(t, err)
+		// when
+		_, err = s.scimService.CreateUser(s.Ctx, scim.User{UserName: identity.Username, Email: uuid.NewV4().String() + "@example.com", Active: true})
+		// then
+		testsupport.AssertError(t, err, errors.BadParameterError{}, fmt.Sprintf("Bad value for parameter 'username': '%s' - the username was recently released by another user", identity.Username))
+	})
+
+	s.T().Run("missing email", func(t *testing.T) {
+		_, err := s.scimService.CreateUser(s.Ctx, scim.User{UserName: uuid.NewV4().String(), Active: true})
+		require.Error(t, err)
+		assert.IsType(t, errors.BadParameterError{}, errs.Cause(err))
+	})
+
+	s.T().Run("cluster link failure", func(t *testing.T) {
+		// given
+		linkFunc := s.clusterServiceMock.LinkIdentityToClusterFunc
+		defer func() {
+			s.clusterServiceMock.LinkIdentityToClusterFunc = linkFunc
+		}()
+		s.clusterServiceMock.LinkIdentityToClusterFunc = func(ctx context.Context, identityID uuid.UUID, clusterURL string, options ...rest.HTTPClientOption) error {
+			return errs.New("cluster service unavailable")
+		}
+		userName := uuid.NewV4().String()
+		// when
+		_, err := s.scimService.CreateUser(s.Ctx, scim.User{UserName: userName, Email: userName + "@example.com", Active: true})
+		// then the user is deleted so that it can be provisioned again
+		require.Error(t, err)
+		identities, _, err := s.scimService.ListUsers(s.Ctx, &scim.Filter{Attribute: "username", Value: userName}, 1, 10)
+		require.NoError(t, err)
+		assert.Empty(t, identities)
+	})
+}
+
+func (s *scimServiceBlackBoxTest) TestListUsers() {
+	// given
+	identity1 := s.newUser(s.T())
+	identity2 := s.newUser(s.T())
+
+	s.T().Run("filter by username", func(t *testing.T) {
+		identities, total, err := s.scimService.ListUsers(s.Ctx, &scim.Filter{Attribute: "username", Value: identity1.Username}, 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		require.Len(t, identities, 1)
+		assert.Equal(t, identity1.ID, identities[0].ID)
+		assert.Equal(t, identity1.User.Email, identities[0].User.Email)
+	})
+
+	s.T().Run("filter by email", func(t *testing.T) {
+		identities, total, err := s.scimService.ListUsers(s.Ctx, &scim.Filter{Attribute: "emails.value", Value: identity2.User.Email}, 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		require.Len(t, identities, 1)
+		assert.Equal(t, identity2.ID, identities[0].ID)
+	})
+
+	s.T().Run("paging", func(t *testing.T) {
+		first, total, err := s.scimService.ListUsers(s.Ctx, nil, 1, 1)
+		require.NoError(t, err)
+		require.True(t, total >= 2)
+		require.Len(t, first, 1)
+		second, _, err := s.scimService.ListUsers(s.Ctx, nil, 2, 1)
+		require.NoError(t, err)
+		require.Len(t, second, 1)
+		assert.NotEqual(t, first[0].ID, second[0].ID)
+	})
+
+	s.T().Run("unsupported filter", func(t *testing.T) {
+		_, _, err := s.scimService.ListUsers(s.Ctx, &scim.Filter{Attribute: "nickname", Value: "john"}, 1, 10)
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'filter': 'nickname' - only the userName and emails of the users can be filtered")
+	})
+}
+
+func (s *scimServiceBlackBoxTest) TestUpdateUser() {
+
+	path := func(p string) *string {
+		return &p
+	}
+
+	s.T().Run("patch", func(t *testing.T) {
+		// given
+		identity := s.newUser(t)
+		userName := uuid.NewV4().String()
+		// when
+		updated, deactivated, err := s.scimService.PatchUser(s.Ctx, identity.ID, nil, []scim.PatchOperation{
+			{Op: "replace", Path: path("userName"), Value: userName},
+			{Op: "replace", Path: path("displayName"), Value: "John Doe"},
+		})
+		// then
+		require.NoError(t, err)
+		assert.False(t, deactivated)
+		loaded, err := s.scimService.LoadUser(s.Ctx, identity.ID)
+		require.NoError(t, err)
+		assert.Equal(t, userName, loaded.Username)
+		assert.Equal(t, "John Doe", loaded.User.FullName)
+		assert.Equal(t, app.GenerateEntityTag(updated.User), app.GenerateEntityTag(loaded.User))
+		// and the previous username is kept in the history
+		history, err := s.Application.UsernameHistory().ListForIdentity(s.Ctx, identity.ID)
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, identity.Username, history[0].Username)
+	})
+
+	s.T().Run("deactivate and reactivate", func(t *testing.T) {
+		// given
+		identity := s.newUser(t)
+		// when
+		_, deactivated, err := s.scimService.PatchUser(s.Ctx, identity.ID, nil, []scim.PatchOperation{
+			{Op: "replace", Value: map[string]interface{}{"active": false}},
+		})
+		// then
+		require.NoError(t, err)
+		assert.True(t, deactivated)
+		loaded, err := s.scimService.LoadUser(s.Ctx, identity.ID)
+		require.NoError(t, err)
+		assert.True(t, loaded.User.Deprovisioned)
+
+		// when
+		user := scim.NewUser(*loaded)
+		user.Active = true
+		_, deactivated, err = s.scimService.ReplaceUser(s.Ctx, identity.ID, nil, user)
+		// then
+		require.NoError(t, err)
+		assert.False(t, deactivated)
+		loaded, err = s.scimService.LoadUser(s.Ctx, identity.ID)
+		require.NoError(t, err)
+		assert.False(t, loaded.User.Deprovisioned)
+	})
+
+	s.T().Run("matching etag", func(t *testing.T) {
+		// given
+		identity := s.newUser(t)
+		etag := fmt.Sprintf(`W/"%s"`, app.GenerateEntityTag(identity.User))
+		// when
+		_, _, err := s.scimService.PatchUser(s.Ctx, identity.ID, &etag, []scim.PatchOperation{
+			{Op: "replace", Path: path("displayName"), Value: "John Doe"},
+		})
+		// then
+		require.NoError(t, err)
+	})
+
+	s.T().Run("outdated etag", func(t *testing.T) {
+		// given
+		identity := s.newUser(t)
+		etag := "outdated"
+		// when
+		_, _, err := s.scimService.PatchUser(s.Ctx, identity.ID, &etag, []scim.PatchOperation{
+			{Op: "replace", Path: path("displayName"), Value: "John Doe"},
+		})
+		// then
+		testsupport.AssertError(t, err, errors.VersionConflictError{}, fmt.Sprintf("the user %s has been modified", identity.ID))
+	})
+
+	s.T().Run("username conflict", func(t *testing.T) {
+		// given
+		identity := s.newUser(t)
+		other := s.newUser(t)
+		// when
+		_, _, err := s.scimService.PatchUser(s.Ctx, identity.ID, nil, []scim.PatchOperation{
+			{Op: "replace", Path: path("userName"), Value: other.Username},
+		})
+		// then
+		testsupport.AssertError(t, err, errors.DataConflictError{}, fmt.Sprintf("user with username '%s' already exists", other.Username))
+	})
+
+	s.T().Run("quarantined username", func(t *testing.T) {
+		// given a username released by another user
+		identity := s.newUser(t)
+		other := s.newUser(t)
+		_, _, err := s.scimService.PatchUser(s.Ctx, other.ID, nil, []scim.PatchOperation{
+			{Op: "replace", Path: path("userName"), Value: uuid.NewV4().String()},
+		})
+		require.NoError(t, err)
+		// when
+		_, _, err = s.scimService.PatchUser(s.Ctx, identity.ID, nil, []scim.PatchOperation{
+			{Op: "replace", Path: path("userName"), Value: other.Username},
+		})
+		// then
+		testsupport.AssertError(t, err, errors.BadParameterError{}, fmt.Sprintf("Bad value for parameter 'username': '%s' - the username was recently released by another user", other.Username))
+	})
+
+	s.T().Run("unknown user", func(t *testing.T) {
+		id := uuid.NewV4()
+		_, _, err := s.scimService.PatchUser(s.Ctx, id, nil, []scim.PatchOperation{})
+		testsupport.AssertError(t, err, errors.NotFoundError{}, fmt.Sprintf("user with id '%s' not found", id))
+	})
+}
+
+func (s *scimServiceBlackBoxTest) TestDeleteUser() {
+	// given
+	identity := s.newUser(s.T())
+	// when
+	err := s.scimService.DeleteUser(s.Ctx, identity.ID, nil)
+	// then the user is deprovisioned
+	require.NoError(s.T(), err)
+	loaded, err := s.scimService.LoadUser(s.Ctx, identity.ID)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), loaded.User.Deprovisioned)
+}
+
+func (s *scimServiceBlackBoxTest) TestGroups() {
+
+	memberIDs := func(group *scim.Group) []uuid.UUID {
+		ids := []uuid.UUID{}
+		for _, member := range group.Members {
+			ids = append(ids, member.ID)
+		}
+		return ids
+	}
+	members := func(ids ...uuid.UUID) []interface{} {
+		values := []interface{}{}
+		for _, id := range ids {
+			values = append(values, map[string]interface{}{"value": id.String()})
+		}
+		return values
+	}
+	path := func(p string) *string {
+		return &p
+	}
+
+	s.T().Run("load and list", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		team := g.CreateTeam().AddMember(user)
+		// when
+		group, err := s.scimService.LoadGroup(s.Ctx, team.TeamID())
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, team.TeamName(), group.DisplayName())
+		assert.Equal(t, []uuid.UUID{user.IdentityID()}, memberIDs(group))
+
+		// when
+		groups, total, err := s.scimService.ListGroups(s.Ctx, &scim.Filter{Attribute: "displayname", Value: team.TeamName()}, 1, 10)
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		require.Len(t, groups, 1)
+		assert.Equal(t, team.TeamID(), groups[0].Identity.ID)
+	})
+
+	s.T().Run("patch members", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user1 := g.CreateUser()
+		user2 := g.CreateUser()
+		user3 := g.CreateUser()
+		org := g.CreateOrganization().AddMember(user1)
+		group, err := s.scimService.LoadGroup(s.Ctx, org.OrganizationID())
+		require.NoError(t, err)
+		etag := app.GenerateEntityTag(*group)
+
+		// when
+		group, err = s.scimService.PatchGroup(s.Ctx, org.OrganizationID(), &etag, []scim.PatchOperation{
+			{Op: "add", Path: path("members"), Value: members(user2.IdentityID(), user3.IdentityID())},
+			{Op: "remove", Path: path(fmt.Sprintf(`members[value eq "%s"]`, user1.IdentityID()))},
+		})
+		// then
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []uuid.UUID{user2.IdentityID(), user3.IdentityID()}, memberIDs(group))
+		assert.NotEqual(t, etag, app.GenerateEntityTag(*group))
+
+		// when
+		group, err = s.scimService.PatchGroup(s.Ctx, org.OrganizationID(), nil, []scim.PatchOperation{
+			{Op: "Replace", Value: map[string]interface{}{"members": members(user1.IdentityID(), user3.IdentityID())}},
+		})
+		// then
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []uuid.UUID{user1.IdentityID(), user3.IdentityID()}, memberIDs(group))
+
+		// when the etag is outdated
+		_, err = s.scimService.PatchGroup(s.Ctx, org.OrganizationID(), &etag, []scim.PatchOperation{
+			{Op: "remove", Path: path("members")},
+		})
+		// then
+		testsupport.AssertError(t, err, errors.VersionConflictError{}, fmt.Sprintf("the group %s has been modified", org.OrganizationID()))
+	})
+
+	s.T().Run("unsupported attribute", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		team := g.CreateTeam()
+		// when
+		_, err := s.scimService.PatchGroup(s.Ctx, team.TeamID(), nil, []scim.PatchOperation{
+			{Op: "replace", Path: path("displayName"), Value: "renamed"},
+		})
+		// then
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'path': 'displayName' - only the members of the groups can be modified")
+	})
+
+	s.T().Run("not a group", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		// when
+		_, err := s.scimService.LoadGroup(s.Ctx, user.IdentityID())
+		// then
+		testsupport.AssertError(t, err, errors.NotFoundError{}, fmt.Sprintf("group with id '%s' not found", user.IdentityID()))
+	})
+}
@@ -37,10 +37,11 @@ const (
 	// ResourceTypeSystem defines the string constant for the system resource type
 	ResourceTypeSystem = "openshift.io/resource/system"
 
-	manageUserScope      = "manage_user"
-	accessScope          = "access"
-	userAdminRole        = "user_admin"
-	adminConsoleUserRole = "admin_console_user"
+	manageUserScope         = "manage_user"
+	manageOAuthClientsScope = "manage_oauth_clients"
+	accessScope             = "access"
+	userAdminRole           = "user_admin"
+	adminConsoleUserRole    = "admin_console_user"
 
 	// SystemUserAdminRole is the constant used to denote the name of the system resource's user administrator role
 	SystemUserAdminRole = userAdminRole
@@ -54,6 +55,9 @@ const (
 	// ManageUserSystemScope is a general scope required to perform operations for managing users in a resource of type system
 	ManageUserSystemScope = manageUserScope
 
+	// ManageOAuthClientsSystemScope is the scope required to register and manage OAuth clients in a resource of type system
+	ManageOAuthClientsSystemScope = manageOAuthClientsScope
+
 	// OrganizationAdminRole is the constant used to denote the name of the organization resource's administrator role
 	OrganizationAdminRole = adminRole
 
@@ -162,6 +166,105 @@ func ScopeForViewingRolesInResourceType(resourceType string) string {
 	return ViewRoleAssignmentsInSpaceScope
 }
 
+// ResourceScope is a scope to check for a resource, e.g. in a batch permission check
+type ResourceScope struct {
+	ResourceID string
+	ScopeName  string
+}
+
+// EffectivePrincipal is an identity which effectively holds a scope on a resource, along with the grants explaining how
+// the scope was obtained
+type EffectivePrincipal struct {
+	IdentityID uuid.UUID
+	// The username of a user, or the name of the resource of a team or organization
+	Name   string
+	Grants []ScopeGrant
+}
+
+// ScopeGrant explains how an identity obtained a scope on a resource
+type ScopeGrant struct {
+	// The identity to which the role is assigned, either the principal itself or a team or organization it belongs to
+	AssigneeID uuid.UUID
+	// The chain of teams and organizations from the one the principal is a direct member of, to the assignee. Empty
+	// if the role is assigned to the principal itself
+	MemberOf []uuid.UUID
+	// The resource for which the role is assigned, either the resource itself or one of its ancestors
+	ResourceID string
+	Inherited  bool
+	// The assigned role
+	RoleName string
+	// The chain of roles to which the assigned role is mapped, ending with the role which has the scope. Empty if the
+	// assigned role has the scope itself
+	MappedRoles []string
+}
+
+// ScopeExplanation is the derivation of the decision of a scope check for an identity on a resource
+type ScopeExplanation struct {
+	IdentityID   uuid.UUID
+	ResourceID   string
+	ResourceType string
+	ScopeName    string
+	Granted      bool
+	// The teams and organizations the identity belongs to, whatever the depth of the memberships
+	Memberships []IdentityMembership
+	// The resource followed by its ancestors
+	ResourceHierarchy []string
+	// The steps which were considered for the decision, one per role assigned to the identity or to one of its teams or
+	// organizations for the resource or one of its ancestors, and per role of the type of the resource obtained from it
+	Steps []ScopeDerivationStep
+	// The deny assignments of the scope to the identity or to one of its teams or organizations for the resource or one
+	// of its ancestors. They take precedence over the steps granting the scope
+	Denials []ScopeDenial
+}
+
+// ScopeDenial is a deny assignment withdrawing a scope from an identity, or from a team or organization it belongs to
+type ScopeDenial struct {
+	DenyAssignmentID uuid.UUID
+	AssigneeID       uuid.UUID
+	MemberOf         []uuid.UUID
+	// The resource for which the scope is denied, either the resource itself or one of its ancestors
+	ResourceID string
+	Inherited  bool
+}
+
+// IdentityMembership is a team or organization which an identity belongs to
+type IdentityMembership struct {
+	IdentityID uuid.UUID
+	// The chain of teams and organizations from the one the identity is a direct member of, ending with this one
+	MemberOf []uuid.UUID
+}
+
+// ScopeDerivationStep explains whether a role assigned to an identity, or to a team or organization it belongs to, grants
+// a scope on a resource
+type ScopeDerivationStep struct {
+	AssigneeID uuid.UUID
+	MemberOf   []uuid.UUID
+	// The resource for which the role is assigned, either the resource itself or one of its ancestors
+	ResourceID string
+	Inherited  bool
+	RoleName   string
+	// The chain of role mappings through which the assigned role was mapped to the effective role
+	RoleMappings []RoleMappingStep
+	// The role of the type of the resource which was obtained, and its scopes. Empty if the assigned role doesn't apply
+	// to the type of the resource and isn't mapped to any role of this type
+	EffectiveRoleName string
+	Scopes            []string
+	GrantsScope       bool
+	// Why the step doesn't grant the scope
+	Reason string
+}
+
+// RoleMappingStep is a role mapping applied in a scope derivation
+type RoleMappingStep struct {
+	RoleMappingID uuid.UUID
+	// The resource for which the role mapping is defined
+	ResourceID string
+	// The default role mapping of the type of the resource from which the role mapping was created, if any
+	DefaultRoleMappingID *uuid.UUID
+	FromRoleName         string
+	ToRoleName           string
+}
+
 // IdentityAssociation represents an association between an Identity and either another Identity or a Resource, whether by
 // membership or by having been granted a role.  It contains metadata about the Identity's relationship with the other
 // entity, including its membership state, and any roles it may have been assigned.
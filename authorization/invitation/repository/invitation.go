@@ -81,7 +81,10 @@ type InvitationRepository interface {
 	Save(ctx context.Context, i *Invitation) error
 	ListForIdentity(ctx context.Context, inviteToID uuid.UUID) ([]Invitation, error)
 	ListForResource(ctx context.Context, resourceID string) ([]Invitation, error)
+	ListForInvitee(ctx context.Context, identityID uuid.UUID) ([]Invitation, error)
 	Delete(ctx context.Context, id uuid.UUID) error
+	DeleteForInvitee(ctx context.Context, identityID uuid.UUID) error
+	TransferToInvitee(ctx context.Context, fromIdentityID, toIdentityID uuid.UUID) error
 
 	ListRoles(ctx context.Context, id uuid.UUID) ([]rolerepo.Role, error)
 	AddRole(ctx context.Context, invitationId uuid.UUID, roleId uuid.UUID) error
@@ -191,6 +194,18 @@ func (m *GormInvitationRepository) ListForResource(ctx context.Context, resource
 	return rows, nil
 }
 
+// ListForInvitee returns the invitations sent to the identity with the given ID
+func (m *GormInvitationRepository) ListForInvitee(ctx context.Context, identityID uuid.UUID) ([]Invitation, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "invitation", "listForInvitee"}, time.Now())
+	var rows []Invitation
+
+	err := m.db.Model(&Invitation{}).Where("identity_id = ?", identityID).Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return rows, nil
+}
+
 func (m *GormInvitationRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	defer goa.MeasureSince([]string{"goa", "db", "invitation", "delete"}, time.Now())
 
@@ -236,6 +251,50 @@ func (m *GormInvitationRepository) Delete(ctx context.Context, id uuid.UUID) err
 	return nil
 }
 
+// DeleteForInvitee removes all the invitations sent to the identity with the given ID, along with their roles. This is
+// a hard delete!
+func (m *GormInvitationRepository) DeleteForInvitee(ctx context.Context, identityID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "invitation", "deleteForInvitee"}, time.Now())
+
+	err := m.db.Exec("DELETE FROM invitation_role WHERE invitation_id IN (SELECT invitation_id FROM invitation WHERE identity_id = ?)", identityID).Error
+	if err != nil {
+		return errs.WithStack(err)
+	}
+	err = m.db.Exec("DELETE FROM invitation WHERE identity_id = ?", identityID).Error
+	if err != nil {
+		return errs.WithStack(err)
+	}
+	return nil
+}
+
+// TransferToInvitee transfers the invitations sent to the identity `fromIdentityID` to the identity `toIdentityID`.
+// The invitations to an organization, team, security group or resource to which `toIdentityID` was already invited
+// are removed instead, along with their roles.
+func (m *GormInvitationRepository) TransferToInvitee(ctx context.Context, fromIdentityID, toIdentityID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "invitation", "transferToInvitee"}, time.Now())
+
+	duplicates := `SELECT f.invitation_id FROM invitation f JOIN invitation t ON t.identity_id = ? AND t.deleted_at IS NULL
+		AND (t.invite_to = f.invite_to OR t.resource_id = f.resource_id) WHERE f.identity_id = ?`
+	err := m.db.Exec("DELETE FROM invitation_role WHERE invitation_id IN ("+duplicates+")", toIdentityID, fromIdentityID).Error
+	if err != nil {
+		return errs.WithStack(err)
+	}
+	err = m.db.Exec("DELETE FROM invitation WHERE invitation_id IN ("+duplicates+")", toIdentityID, fromIdentityID).Error
+	if err != nil {
+		return errs.WithStack(err)
+	}
+	err = m.db.Exec("UPDATE invitation SET identity_id = ? WHERE identity_id = ?", toIdentityID, fromIdentityID).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"from_identity_id": fromIdentityID,
+			"to_identity_id":   toIdentityID,
+			"err":              err,
+		}, "unable to transfer the invitations")
+		return errs.WithStack(err)
+	}
+	return nil
+}
+
 func (m *GormInvitationRepository) ListRoles(ctx context.Context, id uuid.UUID) ([]rolerepo.Role, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "invitation", "list_roles"}, time.Now())
 
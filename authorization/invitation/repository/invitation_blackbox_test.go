@@ -158,6 +158,48 @@ func (s *invitationBlackBoxTest) TestCreateResourceInvitation() {
 	require.False(s.T(), invitations[0].Member)
 }
 
+func (s *invitationBlackBoxTest) TestListForInvitee() {
+	g := s.NewTestGraph(s.T())
+	user := g.CreateUser()
+	i1 := g.CreateInvitation(user, g.CreateOrganization())
+	i2 := g.CreateInvitation(user, g.CreateSpace())
+
+	// Create another invitation for some noise
+	g.CreateInvitation()
+
+	invitations, err := s.repo.ListForInvitee(s.Ctx, user.IdentityID())
+	require.NoError(s.T(), err)
+
+	require.Equal(s.T(), 2, len(invitations))
+	ids := []uuid.UUID{invitations[0].InvitationID, invitations[1].InvitationID}
+	require.Contains(s.T(), ids, i1.Invitation().InvitationID)
+	require.Contains(s.T(), ids, i2.Invitation().InvitationID)
+}
+
+func (s *invitationBlackBoxTest) TestTransferToInvitee() {
+	g := s.NewTestGraph(s.T())
+	from := g.CreateUser()
+	to := g.CreateUser()
+	org := g.CreateOrganization()
+	transferred := g.CreateInvitation(from, g.CreateSpace())
+	g.CreateInvitation(from, org)
+	kept := g.CreateInvitation(to, org)
+
+	err := s.repo.TransferToInvitee(s.Ctx, from.IdentityID(), to.IdentityID())
+	require.NoError(s.T(), err)
+
+	// the invitation to the organization to which the target identity was already invited is removed
+	invitations, err := s.repo.ListForInvitee(s.Ctx, to.IdentityID())
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), 2, len(invitations))
+	ids := []uuid.UUID{invitations[0].InvitationID, invitations[1].InvitationID}
+	require.Contains(s.T(), ids, transferred.Invitation().InvitationID)
+	require.Contains(s.T(), ids, kept.Invitation().InvitationID)
+	invitations, err = s.repo.ListForInvitee(s.Ctx, from.IdentityID())
+	require.NoError(s.T(), err)
+	require.Empty(s.T(), invitations)
+}
+
 func (s *invitationBlackBoxTest) TestAddAndListRoles() {
 	invitation, err := s.CreateTestInvitation()
 	require.NoError(s.T(), err)
@@ -69,7 +69,10 @@ type PrivilegeCacheRepository interface {
 	Create(ctx context.Context, cache *PrivilegeCache) error
 	Save(ctx context.Context, cache *PrivilegeCache) error
 	Delete(ctx context.Context, privilegeCacheID uuid.UUID) error
+	DeleteForIdentity(ctx context.Context, identityID uuid.UUID) error
+	DeleteExpired(ctx context.Context, expiredBefore time.Time) (int64, error)
 	FindForIdentityResource(ctx context.Context, identityID uuid.UUID, resourceID string) (*PrivilegeCache, error)
+	FindForIdentityResources(ctx context.Context, identityID uuid.UUID, resourceIDs []string) ([]PrivilegeCache, error)
 }
 
 // CheckExists returns true if the given ID exists otherwise returns an error
@@ -181,6 +184,46 @@ func (m *GormPrivilegeCacheRepository) Delete(ctx context.Context, privilegeCach
 	return nil
 }
 
+// DeleteForIdentity removes all the privilege caches of the given identity, along with their references from the
+// tokens. This is a hard delete!
+func (m *GormPrivilegeCacheRepository) DeleteForIdentity(ctx context.Context, identityID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "privilege_cache", "deleteForIdentity"}, time.Now())
+
+	err := m.db.Exec(fmt.Sprintf("DELETE FROM token_privilege WHERE privilege_cache_id IN (SELECT privilege_cache_id FROM %s WHERE identity_id = ?)", m.TableName()), identityID).Error
+	if err != nil {
+		return errs.WithStack(err)
+	}
+	err = m.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE identity_id = ?", m.TableName()), identityID).Error
+	if err != nil {
+		return errs.WithStack(err)
+	}
+	return nil
+}
+
+// DeleteExpired removes the privilege caches which expired before the given time, along with their references from
+// the tokens, and returns the number of removed privilege caches. This is a hard delete!
+func (m *GormPrivilegeCacheRepository) DeleteExpired(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "privilege_cache", "deleteExpired"}, time.Now())
+
+	err := m.db.Exec(fmt.Sprintf("DELETE FROM token_privilege WHERE privilege_cache_id IN (SELECT privilege_cache_id FROM %s WHERE expiry_time < ?)", m.TableName()), expiredBefore).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"expired_before": expiredBefore,
+			"err":            err,
+		}, "unable to delete the token privileges of the expired privilege caches")
+		return 0, errs.WithStack(err)
+	}
+	result := m.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE expiry_time < ?", m.TableName()), expiredBefore)
+	if result.Error != nil {
+		log.Error(ctx, map[string]interface{}{
+			"expired_before": expiredBefore,
+			"err":            result.Error,
+		}, "unable to delete the expired privilege caches")
+		return 0, errs.WithStack(result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
 func (m *GormPrivilegeCacheRepository) FindForIdentityResource(ctx context.Context, identityID uuid.UUID, resourceID string) (*PrivilegeCache, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "privilege_cache", "FindForIdentityResource"}, time.Now())
 
@@ -192,3 +235,19 @@ func (m *GormPrivilegeCacheRepository) FindForIdentityResource(ctx context.Conte
 
 	return &native, errs.WithStack(err)
 }
+
+// FindForIdentityResources returns the privilege caches of the given identity for the given resources, in a single query.
+// The resources for which the identity has no privilege cache are missing from the result.
+func (m *GormPrivilegeCacheRepository) FindForIdentityResources(ctx context.Context, identityID uuid.UUID, resourceIDs []string) ([]PrivilegeCache, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "privilege_cache", "FindForIdentityResources"}, time.Now())
+
+	var natives []PrivilegeCache
+	if len(resourceIDs) == 0 {
+		return natives, nil
+	}
+	err := m.db.Table(m.TableName()).Where("identity_id = ? AND resource_id IN (?)", identityID, resourceIDs).Find(&natives).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return natives, nil
+}
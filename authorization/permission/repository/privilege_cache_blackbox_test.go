@@ -138,3 +138,26 @@ func (s *privilegeCacheBlackBoxTest) TestFindForIdentityResource() {
 	require.Len(s.T(), pc2.ScopesAsArray(), 0)
 	require.Empty(s.T(), pc2.Scopes)
 }
+
+func (s *privilegeCacheBlackBoxTest) TestFindForIdentityResources() {
+	identity := s.Graph.CreateIdentity()
+	pc1 := s.Graph.CreatePrivilegeCache(identity, "foo").PrivilegeCache()
+	pc2 := s.Graph.CreatePrivilegeCache(identity, "bar").PrivilegeCache()
+	// privilege cache for another identity, which should not be returned
+	pc3 := s.Graph.CreatePrivilegeCache().PrivilegeCache()
+
+	found, err := s.repo.FindForIdentityResources(s.Ctx, identity.ID(), []string{pc1.ResourceID, pc2.ResourceID, pc3.ResourceID, uuid.NewV4().String()})
+	require.NoError(s.T(), err)
+	require.Len(s.T(), found, 2)
+	foundResourceIDs := map[string]string{}
+	for _, pc := range found {
+		require.Equal(s.T(), identity.ID(), pc.IdentityID)
+		foundResourceIDs[pc.ResourceID] = pc.Scopes
+	}
+	require.Equal(s.T(), "foo", foundResourceIDs[pc1.ResourceID])
+	require.Equal(s.T(), "bar", foundResourceIDs[pc2.ResourceID])
+
+	found, err = s.repo.FindForIdentityResources(s.Ctx, identity.ID(), []string{})
+	require.NoError(s.T(), err)
+	require.Empty(s.T(), found)
+}
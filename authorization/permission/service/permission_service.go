@@ -3,10 +3,13 @@ package service
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/fabric8-services/fabric8-auth/application/service"
 	"github.com/fabric8-services/fabric8-auth/application/service/base"
 	servicecontext "github.com/fabric8-services/fabric8-auth/application/service/context"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	"github.com/fabric8-services/fabric8-auth/authorization/role"
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/satori/go.uuid"
 )
@@ -28,7 +31,8 @@ func NewPermissionService(context servicecontext.ServiceContext) service.Permiss
 // assigned a role that grants the specified scope.  It takes into account resource hierarchies, checking the roles of
 // parent and other ancestor resources, and also takes into account role mappings, which allow roles assigned for a
 // certain type of resource in the resource ancestry to map to a role for a different resource type lower in the
-// resource hierarchy.
+// resource hierarchy. A deny assignment of the scope to the user, or to any of its identity groups, for the resource or
+// any of its ancestors takes precedence over all of these roles.
 func (s *permissionServiceImpl) HasScope(ctx context.Context, identityID uuid.UUID, resourceID string, scopeName string) (bool, error) {
 
 	identityRoles, err := s.Repositories().IdentityRoleRepository().FindPermissions(ctx, identityID, resourceID, scopeName)
@@ -39,6 +43,35 @@ func (s *permissionServiceImpl) HasScope(ctx context.Context, identityID uuid.UU
 	return len(identityRoles) > 0, nil
 }
 
+// HasScopes checks in one go whether an identity has the given scopes for the given resources, and returns a decision
+// for each check, in the same order. The privileges are loaded from the privilege cache, once per resource, rather
+// than with one query per check. The checks on resources which don't exist are denied.
+func (s *permissionServiceImpl) HasScopes(ctx context.Context, identityID uuid.UUID, checks []authorization.ResourceScope) ([]bool, error) {
+	resourceIDs := make([]string, len(checks))
+	for i, check := range checks {
+		resourceIDs[i] = check.ResourceID
+	}
+	privilegeCaches, err := s.Services().PrivilegeCacheService().CachedPrivilegesForResources(ctx, identityID, resourceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions := make([]bool, len(checks))
+	for i, check := range checks {
+		privilegeCache, found := privilegeCaches[check.ResourceID]
+		if !found {
+			continue
+		}
+		for _, scope := range privilegeCache.ScopesAsArray() {
+			if scope == check.ScopeName {
+				decisions[i] = true
+				break
+			}
+		}
+	}
+	return decisions, nil
+}
+
 // RequireScope is the same as HasScope, except instead of returning a boolean value it will just return an error if the
 // identity does not have the specified scope for the resource
 func (s *permissionServiceImpl) RequireScope(ctx context.Context, identityID uuid.UUID, resourceID string, scopeName string) error {
@@ -53,3 +86,250 @@ func (s *permissionServiceImpl) RequireScope(ctx context.Context, identityID uui
 
 	return nil
 }
+
+// RequireSystemScope returns an error if the identity does not have the specified scope for any of the resources of
+// type system, i.e. if it was not assigned a role granting this scope on a system resource
+func (s *permissionServiceImpl) RequireSystemScope(ctx context.Context, identityID uuid.UUID, scopeName string) error {
+	resourceIDs, err := s.Repositories().ResourceRepository().FindWithRoleByResourceTypeAndIdentity(ctx, authorization.ResourceTypeSystem, identityID)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	for _, resourceID := range resourceIDs {
+		result, err := s.HasScope(ctx, identityID, resourceID, scopeName)
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+		if result {
+			return nil
+		}
+	}
+
+	return errors.NewForbiddenError(fmt.Sprintf("identity with ID %s does not have required system scope %s", identityID.String(), scopeName))
+}
+
+// ExplainScope returns the full derivation of the decision of a scope check for an identity on a resource, as made by
+// HasScope: the teams and organizations the identity belongs to, the ancestors of the resource and, for each role
+// assigned to the identity or to one of its teams or organizations for the resource or one of its ancestors, whether the
+// role grants the scope, either directly or through a chain of role mappings, or why it doesn't, along with the deny
+// assignments which withdraw the scope whatever the roles.
+// The identity performing the request must have the manage_user scope for the system resources, otherwise
+// ForbiddenError is returned
+func (s *permissionServiceImpl) ExplainScope(ctx context.Context, byIdentityID uuid.UUID, identityID uuid.UUID, resourceID string, scopeName string) (*authorization.ScopeExplanation, error) {
+	err := s.RequireSystemScope(ctx, byIdentityID, authorization.ManageUserSystemScope)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Repositories().Identities().CheckExists(ctx, identityID.String())
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.Repositories().ResourceRepository().Load(ctx, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	granted, err := s.HasScope(ctx, identityID, resourceID, scopeName)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	explanation := &authorization.ScopeExplanation{
+		IdentityID:   identityID,
+		ResourceID:   resourceID,
+		ResourceType: res.ResourceType.Name,
+		ScopeName:    scopeName,
+		Granted:      granted,
+	}
+
+	// the identity and the teams and organizations it belongs to, with the chain of memberships
+	memberOf := map[uuid.UUID][]uuid.UUID{identityID: {}}
+	queue := []uuid.UUID{identityID}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		memberships, err := s.Repositories().Identities().FindMemberships(ctx, current)
+		if err != nil {
+			return nil, errors.NewInternalError(ctx, err)
+		}
+		for _, membership := range memberships {
+			if _, found := memberOf[membership.MemberOf]; found {
+				continue
+			}
+			chain := append(append([]uuid.UUID{}, memberOf[current]...), membership.MemberOf)
+			memberOf[membership.MemberOf] = chain
+			explanation.Memberships = append(explanation.Memberships, authorization.IdentityMembership{
+				IdentityID: membership.MemberOf,
+				MemberOf:   chain,
+			})
+			queue = append(queue, membership.MemberOf)
+		}
+	}
+
+	// the resource and its ancestors, with the role mappings defined for them
+	var roleMappings []authorization.RoleMappingStep
+	mappingsFrom := make(map[uuid.UUID][]int)
+	mappingTargets := make(map[int]uuid.UUID)
+	roleNames := make(map[uuid.UUID]string)
+	roleName := func(roleID uuid.UUID) (string, error) {
+		if name, found := roleNames[roleID]; found {
+			return name, nil
+		}
+		r, err := s.Repositories().RoleRepository().Load(ctx, roleID)
+		if err != nil {
+			return "", err
+		}
+		roleNames[roleID] = r.Name
+		return r.Name, nil
+	}
+	for current := res; ; {
+		explanation.ResourceHierarchy = append(explanation.ResourceHierarchy, current.ResourceID)
+		mappings, err := s.Repositories().RoleMappingRepository().FindForResource(ctx, current.ResourceID)
+		if err != nil {
+			return nil, errors.NewInternalError(ctx, err)
+		}
+		for _, mapping := range mappings {
+			if mapping.FromRoleID == mapping.ToRoleID {
+				continue
+			}
+			step := authorization.RoleMappingStep{
+				RoleMappingID: mapping.RoleMappingID,
+				ResourceID:    current.ResourceID,
+			}
+			defaultMapping, err := s.Repositories().DefaultRoleMappingRepository().FindForResourceTypeAndRoles(ctx, current.ResourceTypeID, mapping.FromRoleID, mapping.ToRoleID)
+			if err == nil {
+				step.DefaultRoleMappingID = &defaultMapping.DefaultRoleMappingID
+			} else if notFound, _ := errors.IsNotFoundError(err); !notFound {
+				return nil, err
+			}
+			if step.FromRoleName, err = roleName(mapping.FromRoleID); err != nil {
+				return nil, err
+			}
+			if step.ToRoleName, err = roleName(mapping.ToRoleID); err != nil {
+				return nil, err
+			}
+			mappingsFrom[mapping.FromRoleID] = append(mappingsFrom[mapping.FromRoleID], len(roleMappings))
+			mappingTargets[len(roleMappings)] = mapping.ToRoleID
+			roleMappings = append(roleMappings, step)
+		}
+		if current.ParentResourceID == nil {
+			break
+		}
+		current, err = s.Repositories().ResourceRepository().Load(ctx, *current.ParentResourceID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the roles of the type of the resource, which are the only ones whose scopes apply to it
+	roles, err := s.Repositories().RoleRepository().FindRolesByResourceType(ctx, res.ResourceType.Name)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	resourceTypeRoles := make(map[uuid.UUID]role.RoleDescriptor, len(roles))
+	for _, r := range roles {
+		roleID, err := uuid.FromString(r.RoleID)
+		if err != nil {
+			return nil, errors.NewInternalError(ctx, err)
+		}
+		resourceTypeRoles[roleID] = r
+	}
+
+	identityRoles, err := s.Repositories().IdentityRoleRepository().FindIdentityRolesByResource(ctx, resourceID, true)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	now := time.Now()
+	for _, identityRole := range identityRoles {
+		chain, found := memberOf[identityRole.IdentityID]
+		if !found {
+			continue
+		}
+		if !identityRole.IsActiveAt(now) {
+			explanation.Steps = append(explanation.Steps, authorization.ScopeDerivationStep{
+				AssigneeID: identityRole.IdentityID,
+				MemberOf:   chain,
+				ResourceID: identityRole.ResourceID,
+				Inherited:  identityRole.ResourceID != resourceID,
+				RoleName:   identityRole.Role.Name,
+				Reason:     inactiveRoleReason(identityRole.Role.Name, identityRole.ValidFrom, identityRole.ValidUntil, now),
+			})
+			continue
+		}
+		// follow the role mappings from the assigned role, to find the roles of the type of the resource it leads to
+		paths := map[uuid.UUID][]authorization.RoleMappingStep{identityRole.RoleID: {}}
+		reached := []uuid.UUID{identityRole.RoleID}
+		for i := 0; i < len(reached); i++ {
+			for _, index := range mappingsFrom[reached[i]] {
+				toRoleID := mappingTargets[index]
+				if _, found := paths[toRoleID]; found {
+					continue
+				}
+				paths[toRoleID] = append(append([]authorization.RoleMappingStep{}, paths[reached[i]]...), roleMappings[index])
+				reached = append(reached, toRoleID)
+			}
+		}
+		effective := false
+		for _, roleID := range reached {
+			descriptor, found := resourceTypeRoles[roleID]
+			if !found {
+				continue
+			}
+			effective = true
+			step := authorization.ScopeDerivationStep{
+				AssigneeID:        identityRole.IdentityID,
+				MemberOf:          chain,
+				ResourceID:        identityRole.ResourceID,
+				Inherited:         identityRole.ResourceID != resourceID,
+				RoleName:          identityRole.Role.Name,
+				RoleMappings:      paths[roleID],
+				EffectiveRoleName: descriptor.RoleName,
+				Scopes:            descriptor.Scopes,
+			}
+			for _, scope := range descriptor.Scopes {
+				if scope == scopeName {
+					step.GrantsScope = true
+					break
+				}
+			}
+			if !step.GrantsScope {
+				step.Reason = fmt.Sprintf("role %s doesn't have the scope %s", descriptor.RoleName, scopeName)
+			}
+			explanation.Steps = append(explanation.Steps, step)
+		}
+		if !effective {
+			explanation.Steps = append(explanation.Steps, authorization.ScopeDerivationStep{
+				AssigneeID: identityRole.IdentityID,
+				MemberOf:   chain,
+				ResourceID: identityRole.ResourceID,
+				Inherited:  identityRole.ResourceID != resourceID,
+				RoleName:   identityRole.Role.Name,
+				Reason:     fmt.Sprintf("role %s doesn't apply to the resources of type %s and isn't mapped to any role of this type", identityRole.Role.Name, res.ResourceType.Name),
+			})
+		}
+	}
+
+	denyAssignments, err := s.Repositories().DenyAssignmentRepository().FindByResource(ctx, resourceID, true)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	for _, denyAssignment := range denyAssignments {
+		chain, found := memberOf[denyAssignment.IdentityID]
+		if !found || denyAssignment.ScopeName != scopeName {
+			continue
+		}
+		explanation.Denials = append(explanation.Denials, authorization.ScopeDenial{
+			DenyAssignmentID: denyAssignment.DenyAssignmentID,
+			AssigneeID:       denyAssignment.IdentityID,
+			MemberOf:         chain,
+			ResourceID:       denyAssignment.ResourceID,
+			Inherited:        denyAssignment.ResourceID != resourceID,
+		})
+	}
+	return explanation, nil
+}
+
+// inactiveRoleReason explains why a role assignment outside of its validity window doesn't grant any scope
+func inactiveRoleReason(roleName string, validFrom, validUntil *time.Time, now time.Time) string {
+	if validFrom != nil && now.Before(*validFrom) {
+		return fmt.Sprintf("the assignment of role %s is not valid until %s", roleName, validFrom.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("the assignment of role %s expired at %s", roleName, validUntil.UTC().Format(time.RFC3339))
+}
@@ -1,10 +1,17 @@
 package service_test
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
 
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
@@ -356,3 +363,270 @@ func (s *PermissionServiceTestSuite) TestHasScope() {
 	})
 
 }
+
+func (s *PermissionServiceTestSuite) TestHasScopes() {
+
+	permissionService := s.Application.PermissionService()
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		identity := g.CreateIdentity()
+		resourceType := g.CreateResourceType()
+		role := g.CreateRole(resourceType, "test-role").AddScope("test-scope")
+		otherRole := g.CreateRole(resourceType, "test-other-role").AddScope("test-other-scope")
+		resource := g.CreateResource(resourceType).AddRole(identity, role)
+		otherResource := g.CreateResource(resourceType).AddRole(identity, otherRole)
+		childResource := g.CreateResource(resource, resourceType)
+		unassignedResource := g.CreateResource(resourceType)
+		// when
+		result, err := permissionService.HasScopes(s.Ctx, identity.ID(), []authorization.ResourceScope{
+			{ResourceID: resource.ResourceID(), ScopeName: "test-scope"},
+			{ResourceID: resource.ResourceID(), ScopeName: "test-other-scope"},
+			{ResourceID: otherResource.ResourceID(), ScopeName: "test-other-scope"},
+			{ResourceID: childResource.ResourceID(), ScopeName: "test-scope"},
+			{ResourceID: unassignedResource.ResourceID(), ScopeName: "test-scope"},
+			{ResourceID: uuid.NewV4().String(), ScopeName: "test-scope"},
+		})
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []bool{true, false, true, true, false, false}, result)
+	})
+
+	s.T().Run("consistent with has scope", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		identity := g.CreateIdentity()
+		resourceType := g.CreateResourceType()
+		role := g.CreateRole(resourceType, "test-role").AddScope("test-scope")
+		resource := g.CreateResource(resourceType).AddRole(identity, role)
+		// populate the privilege cache with a single check
+		hasScope, err := permissionService.HasScope(s.Ctx, identity.ID(), resource.ResourceID(), "test-scope")
+		require.NoError(t, err)
+		require.True(t, hasScope)
+		// when
+		result, err := permissionService.HasScopes(s.Ctx, identity.ID(), []authorization.ResourceScope{
+			{ResourceID: resource.ResourceID(), ScopeName: "test-scope"},
+			{ResourceID: resource.ResourceID(), ScopeName: "test-scope"},
+		})
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []bool{true, true}, result)
+	})
+
+	s.T().Run("no checks", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		identity := g.CreateIdentity()
+		// when
+		result, err := permissionService.HasScopes(s.Ctx, identity.ID(), []authorization.ResourceScope{})
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, result)
+	})
+}
+
+func (s *PermissionServiceTestSuite) TestExplainScope() {
+
+	permissionService := s.Application.PermissionService()
+
+	s.T().Run("granted", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		admin := g.CreateUser()
+		g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+			AddRole(admin, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+		parentType := g.CreateResourceType()
+		childType := g.CreateResourceType()
+		parentRole := g.CreateRole(parentType, "parent-role")
+		unmappedRole := g.CreateRole(parentType, "unmapped-role")
+		childRole := g.CreateRole(childType, "child-role").AddScope("test-scope")
+		otherChildRole := g.CreateRole(childType, "other-child-role").AddScope("other-scope")
+		parent := g.CreateResource(parentType)
+		child := g.CreateResource(parent, childType)
+		defaultRoleMapping := g.CreateDefaultRoleMapping(parentType, parentRole, childRole)
+		roleMapping := g.CreateRoleMapping(parent, parentRole, childRole)
+		user := g.CreateUser()
+		team := g.CreateTeam().AddMember(user)
+		parent.AddRole(team, parentRole)
+		parent.AddRole(user, unmappedRole)
+		child.AddRole(user, otherChildRole)
+
+		// when
+		explanation, err := permissionService.ExplainScope(s.Ctx, admin.IdentityID(), user.IdentityID(), child.ResourceID(), "test-scope")
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, explanation.Granted)
+		assert.Equal(t, childType.Name(), explanation.ResourceType)
+		assert.Equal(t, []authorization.IdentityMembership{{
+			IdentityID: team.TeamID(),
+			MemberOf:   []uuid.UUID{team.TeamID()},
+		}}, explanation.Memberships)
+		assert.Equal(t, []string{child.ResourceID(), parent.ResourceID()}, explanation.ResourceHierarchy)
+		require.Len(t, explanation.Steps, 3)
+		steps := make(map[string]authorization.ScopeDerivationStep)
+		for _, step := range explanation.Steps {
+			steps[step.RoleName] = step
+		}
+
+		mapped := steps["parent-role"]
+		assert.True(t, mapped.GrantsScope)
+		assert.Equal(t, team.TeamID(), mapped.AssigneeID)
+		assert.Equal(t, []uuid.UUID{team.TeamID()}, mapped.MemberOf)
+		assert.Equal(t, parent.ResourceID(), mapped.ResourceID)
+		assert.True(t, mapped.Inherited)
+		assert.Equal(t, "child-role", mapped.EffectiveRoleName)
+		assert.Equal(t, []string{"test-scope"}, mapped.Scopes)
+		require.Len(t, mapped.RoleMappings, 1)
+		assert.Equal(t, roleMapping.RoleMapping().RoleMappingID, mapped.RoleMappings[0].RoleMappingID)
+		assert.Equal(t, parent.ResourceID(), mapped.RoleMappings[0].ResourceID)
+		require.NotNil(t, mapped.RoleMappings[0].DefaultRoleMappingID)
+		assert.Equal(t, defaultRoleMapping.DefaultRoleMapping().DefaultRoleMappingID, *mapped.RoleMappings[0].DefaultRoleMappingID)
+		assert.Equal(t, "parent-role", mapped.RoleMappings[0].FromRoleName)
+		assert.Equal(t, "child-role", mapped.RoleMappings[0].ToRoleName)
+
+		unmapped := steps["unmapped-role"]
+		assert.False(t, unmapped.GrantsScope)
+		assert.Equal(t, user.IdentityID(), unmapped.AssigneeID)
+		assert.Empty(t, unmapped.MemberOf)
+		assert.Empty(t, unmapped.EffectiveRoleName)
+		assert.Equal(t, fmt.Sprintf("role unmapped-role doesn't apply to the resources of type %s and isn't mapped to any role of this type", childType.Name()), unmapped.Reason)
+
+		other := steps["other-child-role"]
+		assert.False(t, other.GrantsScope)
+		assert.False(t, other.Inherited)
+		assert.Equal(t, "other-child-role", other.EffectiveRoleName)
+		assert.Equal(t, "role other-child-role doesn't have the scope test-scope", other.Reason)
+		assert.Empty(t, explanation.Denials)
+	})
+
+	s.T().Run("overridden by a denial", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		admin := g.CreateUser()
+		g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+			AddRole(admin, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+		resourceType := g.CreateResourceType()
+		role := g.CreateRole(resourceType, "test-role").AddScope("test-scope")
+		user := g.CreateUser()
+		team := g.CreateTeam().AddMember(user)
+		parent := g.CreateResource(resourceType).AddDenial(team, "test-scope")
+		child := g.CreateResource(parent, resourceType).AddRole(user, role)
+		// when
+		explanation, err := permissionService.ExplainScope(s.Ctx, admin.IdentityID(), user.IdentityID(), child.ResourceID(), "test-scope")
+		// then
+		require.NoError(t, err)
+		assert.False(t, explanation.Granted)
+		require.Len(t, explanation.Steps, 1)
+		assert.True(t, explanation.Steps[0].GrantsScope)
+		require.Len(t, explanation.Denials, 1)
+		assert.Equal(t, team.TeamID(), explanation.Denials[0].AssigneeID)
+		assert.Equal(t, []uuid.UUID{team.TeamID()}, explanation.Denials[0].MemberOf)
+		assert.Equal(t, parent.ResourceID(), explanation.Denials[0].ResourceID)
+		assert.True(t, explanation.Denials[0].Inherited)
+	})
+
+	s.T().Run("inactive role assignments", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		admin := g.CreateUser()
+		g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+			AddRole(admin, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+		resourceType := g.CreateResourceType()
+		role := g.CreateRole(resourceType, "test-role").AddScope("test-scope")
+		otherRole := g.CreateRole(resourceType, "other-role").AddScope("test-scope")
+		user := g.CreateUser()
+		validFrom := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		validUntil := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+		resource := g.CreateResource(resourceType).
+			AddRoleWithValidity(user, role, &validFrom, nil).
+			AddRoleWithValidity(user, otherRole, nil, &validUntil)
+		// when
+		explanation, err := permissionService.ExplainScope(s.Ctx, admin.IdentityID(), user.IdentityID(), resource.ResourceID(), "test-scope")
+		// then
+		require.NoError(t, err)
+		assert.False(t, explanation.Granted)
+		require.Len(t, explanation.Steps, 2)
+		reasons := []string{}
+		for _, step := range explanation.Steps {
+			assert.False(t, step.GrantsScope)
+			reasons = append(reasons, step.Reason)
+		}
+		assert.ElementsMatch(t, []string{
+			fmt.Sprintf("the assignment of role test-role is not valid until %s", validFrom.Format(time.RFC3339)),
+			fmt.Sprintf("the assignment of role other-role expired at %s", validUntil.Format(time.RFC3339)),
+		}, reasons)
+	})
+
+	s.T().Run("denied", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		admin := g.CreateUser()
+		g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+			AddRole(admin, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+		resourceType := g.CreateResourceType()
+		g.CreateRole(resourceType, "test-role").AddScope("test-scope")
+		resource := g.CreateResource(resourceType)
+		user := g.CreateUser()
+		// when
+		explanation, err := permissionService.ExplainScope(s.Ctx, admin.IdentityID(), user.IdentityID(), resource.ResourceID(), "test-scope")
+		// then
+		require.NoError(t, err)
+		assert.False(t, explanation.Granted)
+		assert.Empty(t, explanation.Memberships)
+		assert.Equal(t, []string{resource.ResourceID()}, explanation.ResourceHierarchy)
+		assert.Empty(t, explanation.Steps)
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		resource := g.CreateResource()
+		// when
+		_, err := permissionService.ExplainScope(s.Ctx, user.IdentityID(), user.IdentityID(), resource.ResourceID(), "test-scope")
+		// then
+		testsupport.AssertError(t, err, errors.ForbiddenError{}, "identity with ID %s does not have required system scope %s", user.IdentityID(), authorization.ManageUserSystemScope)
+	})
+}
+
+func (s *PermissionServiceTestSuite) TestRequireSystemScope() {
+
+	permissionService := s.Application.PermissionService()
+
+	s.T().Run("user assigned with system role", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+			AddRole(user, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+		// when
+		err := permissionService.RequireSystemScope(s.Ctx, user.IdentityID(), authorization.ManageOAuthClientsSystemScope)
+		// then
+		require.NoError(t, err)
+	})
+
+	s.T().Run("user assigned with system role without the scope", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+			AddRole(user, g.RoleByNameAndResourceType(authorization.SystemAdminConsoleUser, authorization.ResourceTypeSystem))
+		// when
+		err := permissionService.RequireSystemScope(s.Ctx, user.IdentityID(), authorization.ManageOAuthClientsSystemScope)
+		// then
+		testsupport.AssertError(t, err, errors.ForbiddenError{}, "identity with ID %s does not have required system scope %s", user.IdentityID(), authorization.ManageOAuthClientsSystemScope)
+	})
+
+	s.T().Run("user without system role", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem))
+		// when
+		err := permissionService.RequireSystemScope(s.Ctx, user.IdentityID(), authorization.ManageOAuthClientsSystemScope)
+		// then
+		testsupport.AssertError(t, err, errors.ForbiddenError{}, "identity with ID %s does not have required system scope %s", user.IdentityID(), authorization.ManageOAuthClientsSystemScope)
+	})
+}
@@ -36,17 +36,60 @@ func NewPrivilegeCacheService(context servicecontext.ServiceContext, config Priv
 // If there are no privileges cached, or the cached value is stale, the privileges will be re-calculated and
 // the cached value updated.
 func (s *privilegeCacheServiceImpl) CachedPrivileges(ctx context.Context, identityID uuid.UUID, resourceID string) (*permission.PrivilegeCache, error) {
-	nowTime := time.Now()
-
 	// Attempt to load the privilege cache record from the database
 	privilegeCache, err := s.Repositories().PrivilegeCacheRepository().FindForIdentityResource(ctx, identityID, resourceID)
-	notFound := false
 	if err != nil {
 		switch err.(type) {
 		case errors.NotFoundError:
-			notFound = true
+			privilegeCache = nil
+		}
+	}
+	return s.refreshPrivileges(ctx, identityID, resourceID, privilegeCache)
+}
+
+// CachedPrivilegesForResources returns the cached privileges that an identity has for the specified resources, by resource ID.
+// The privilege caches are loaded with a single query, and only the missing or stale ones are re-calculated. The
+// resources which don't exist are missing from the result.
+func (s *privilegeCacheServiceImpl) CachedPrivilegesForResources(ctx context.Context, identityID uuid.UUID, resourceIDs []string) (map[string]*permission.PrivilegeCache, error) {
+	privilegeCaches, err := s.Repositories().PrivilegeCacheRepository().FindForIdentityResources(ctx, identityID, resourceIDs)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	found := make(map[string]*permission.PrivilegeCache, len(privilegeCaches))
+	for i := range privilegeCaches {
+		found[privilegeCaches[i].ResourceID] = &privilegeCaches[i]
+	}
+
+	result := make(map[string]*permission.PrivilegeCache, len(resourceIDs))
+	for _, resourceID := range resourceIDs {
+		if _, done := result[resourceID]; done {
+			continue
+		}
+		privilegeCache, cached := found[resourceID]
+		if !cached {
+			// the privilege cache can only be created for an existing resource
+			err := s.Repositories().ResourceRepository().CheckExists(ctx, resourceID)
+			if err != nil {
+				if notFound, _ := errors.IsNotFoundError(err); notFound {
+					continue
+				}
+				return nil, errors.NewInternalError(ctx, err)
+			}
+		}
+		privilegeCache, err = s.refreshPrivileges(ctx, identityID, resourceID, privilegeCache)
+		if err != nil {
+			return nil, err
 		}
+		result[resourceID] = privilegeCache
 	}
+	return result, nil
+}
+
+// refreshPrivileges returns the given privilege cache of an identity for a resource, after having re-calculated the
+// privileges if the cache is missing (nil), stale or expired, and either created or updated the cached value.
+func (s *privilegeCacheServiceImpl) refreshPrivileges(ctx context.Context, identityID uuid.UUID, resourceID string, privilegeCache *permission.PrivilegeCache) (*permission.PrivilegeCache, error) {
+	nowTime := time.Now()
+	notFound := privilegeCache == nil
 
 	// If there was no privilege cache record found, or the record has expired, then recalculate the scopes and either
 	// update the existing record, or create a new one
@@ -58,6 +101,17 @@ func (s *privilegeCacheServiceImpl) CachedPrivileges(ctx context.Context, identi
 
 		scopeList := strings.Join(scopes, ",")
 
+		// The cached value expires no later than the next time a role assignment of the identity becomes active or
+		// expires, since the scopes may change at that time
+		expiryTime := time.Now().Local().Add(time.Second * time.Duration(s.conf.GetPrivilegeCacheExpirySeconds()))
+		nextTransition, err := s.Repositories().IdentityRoleRepository().FindNextValidityTransition(ctx, identityID, resourceID)
+		if err != nil {
+			return nil, errors.NewInternalError(ctx, err)
+		}
+		if nextTransition != nil && nextTransition.Before(expiryTime) {
+			expiryTime = nextTransition.Local()
+		}
+
 		// If the privilege cache record doesn't exist, create a new one
 		if notFound {
 			privilegeCache = &permission.PrivilegeCache{
@@ -65,7 +119,7 @@ func (s *privilegeCacheServiceImpl) CachedPrivileges(ctx context.Context, identi
 				ResourceID: resourceID,
 				Scopes:     scopeList,
 				Stale:      false,
-				ExpiryTime: time.Now().Local().Add(time.Second * time.Duration(s.conf.GetPrivilegeCacheExpirySeconds())),
+				ExpiryTime: expiryTime,
 			}
 
 			err = s.ExecuteInTransaction(func() error {
@@ -79,7 +133,7 @@ func (s *privilegeCacheServiceImpl) CachedPrivileges(ctx context.Context, identi
 			// Otherwise update the existing record
 			privilegeCache.Scopes = scopeList
 			privilegeCache.Stale = false
-			privilegeCache.ExpiryTime = time.Now().Local().Add(time.Second * time.Duration(s.conf.GetPrivilegeCacheExpirySeconds()))
+			privilegeCache.ExpiryTime = expiryTime
 
 			err = s.ExecuteInTransaction(func() error {
 				return s.Repositories().PrivilegeCacheRepository().Save(ctx, privilegeCache)
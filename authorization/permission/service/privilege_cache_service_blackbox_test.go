@@ -2,8 +2,10 @@ package service_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/satori/go.uuid"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
@@ -67,3 +69,76 @@ func (s *privilegeCacheServiceBlackBoxTest) TestPrivilegeCache() {
 	require.Contains(s.T(), priv.ScopesAsArray(), "charlie")
 	require.Contains(s.T(), priv.ScopesAsArray(), "delta")
 }
+
+func (s *privilegeCacheServiceBlackBoxTest) TestPrivilegeCacheForResources() {
+	// Create a new resource type, with scopes "echo" and "foxtrot"
+	rt := s.Graph.CreateResourceType()
+	rt.AddScope("echo")
+	rt.AddScope("foxtrot")
+
+	echoRole := s.Graph.CreateRole(rt)
+	echoRole.AddScope("echo")
+	foxtrotRole := s.Graph.CreateRole(rt)
+	foxtrotRole.AddScope("foxtrot")
+
+	// Create two resources, and assign a role to the identity for each of them
+	r1 := s.Graph.CreateResource(rt)
+	r2 := s.Graph.CreateResource(rt)
+	id := s.Graph.CreateIdentity()
+	s.Graph.CreateIdentityRole(r1, id, echoRole)
+	s.Graph.CreateIdentityRole(r2, id, foxtrotRole)
+
+	// Populate the privilege cache of the first resource only
+	_, err := s.Application.PrivilegeCacheService().CachedPrivileges(s.Ctx, id.Identity().ID, r1.ResourceID())
+	require.NoError(s.T(), err)
+
+	// Retrieve the privilege caches for both resources, a duplicate and a resource which doesn't exist
+	unknownResourceID := uuid.NewV4().String()
+	privs, err := s.Application.PrivilegeCacheService().CachedPrivilegesForResources(s.Ctx, id.Identity().ID,
+		[]string{r1.ResourceID(), r2.ResourceID(), r1.ResourceID(), unknownResourceID})
+	require.NoError(s.T(), err)
+
+	require.Len(s.T(), privs, 2)
+	require.Equal(s.T(), []string{"echo"}, privs[r1.ResourceID()].ScopesAsArray())
+	require.Equal(s.T(), []string{"foxtrot"}, privs[r2.ResourceID()].ScopesAsArray())
+	require.NotContains(s.T(), privs, unknownResourceID)
+
+	// Assign another role for the first resource, the stale privilege cache should be refreshed
+	s.Graph.CreateIdentityRole(r1, id, foxtrotRole)
+	privs, err = s.Application.PrivilegeCacheService().CachedPrivilegesForResources(s.Ctx, id.Identity().ID, []string{r1.ResourceID()})
+	require.NoError(s.T(), err)
+	require.Len(s.T(), privs[r1.ResourceID()].ScopesAsArray(), 2)
+	require.Contains(s.T(), privs[r1.ResourceID()].ScopesAsArray(), "echo")
+	require.Contains(s.T(), privs[r1.ResourceID()].ScopesAsArray(), "foxtrot")
+}
+
+func (s *privilegeCacheServiceBlackBoxTest) TestPrivilegeCacheExpiresAtNextValidityTransition() {
+	// Create a new resource type, with scopes "golf" and "hotel"
+	rt := s.Graph.CreateResourceType()
+	rt.AddScope("golf")
+	rt.AddScope("hotel")
+
+	golfRole := s.Graph.CreateRole(rt)
+	golfRole.AddScope("golf")
+	hotelRole := s.Graph.CreateRole(rt)
+	hotelRole.AddScope("hotel")
+
+	// Assign golfRole for the next hour, and hotelRole after that
+	validUntil := time.Now().Add(time.Hour).Truncate(time.Second)
+	r := s.Graph.CreateResource(rt)
+	id := s.Graph.CreateIdentity()
+	r.AddRoleWithValidity(id, golfRole, nil, &validUntil)
+	r.AddRoleWithValidity(id, hotelRole, &validUntil, nil)
+
+	// Only the scope of golfRole is granted for now
+	priv, err := s.Application.PrivilegeCacheService().CachedPrivileges(s.Ctx, id.Identity().ID, r.ResourceID())
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), []string{"golf"}, priv.ScopesAsArray())
+
+	// The cached value expires when the assignments change, unless the configured expiry is sooner
+	expiryTime := time.Now().Add(time.Second * time.Duration(s.Configuration.GetPrivilegeCacheExpirySeconds()))
+	if validUntil.Before(expiryTime) {
+		expiryTime = validUntil
+	}
+	require.WithinDuration(s.T(), expiryTime, priv.ExpiryTime, 5*time.Second)
+}
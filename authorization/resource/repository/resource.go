@@ -61,6 +61,7 @@ type ResourceRepository interface {
 	base.Exister
 	Load(ctx context.Context, id string) (*Resource, error)
 	LoadChildren(ctx context.Context, id string) ([]Resource, error)
+	Query(funcs ...func(*gorm.DB) *gorm.DB) ([]Resource, error)
 	Create(ctx context.Context, resource *Resource) error
 	Save(ctx context.Context, resource *Resource) error
 	Delete(ctx context.Context, id string) error
@@ -100,6 +101,18 @@ func (m *GormResourceRepository) LoadChildren(ctx context.Context, id string) ([
 	return rows, nil
 }
 
+// Query expose an open ended Query model, with the resource types preloaded
+func (m *GormResourceRepository) Query(funcs ...func(*gorm.DB) *gorm.DB) ([]Resource, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "resource", "query"}, time.Now())
+
+	var rows []Resource
+	err := m.db.Model(&Resource{}).Preload("ResourceType").Scopes(funcs...).Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return rows, nil
+}
+
 // CheckExists returns nil if the given ID exists otherwise returns an error
 func (m *GormResourceRepository) CheckExists(ctx context.Context, id string) error {
 	defer goa.MeasureSince([]string{"goa", "db", "resource", "exists"}, time.Now())
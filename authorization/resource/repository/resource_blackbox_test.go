@@ -12,6 +12,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
 	testsupport "github.com/fabric8-services/fabric8-auth/test"
 
+	"github.com/jinzhu/gorm"
 	"github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -96,6 +97,19 @@ func (s *resourceBlackBoxTest) TestOKToLoadChildren() {
 	}
 }
 
+func (s *resourceBlackBoxTest) TestQuery() {
+	parent := createAndLoadResource(s, nil)
+	child := createAndLoadResource(s, &parent.ResourceID)
+
+	found, err := s.repo.Query(func(db *gorm.DB) *gorm.DB {
+		return db.Where("parent_resource_id = ?", parent.ResourceID)
+	})
+	require.NoError(s.T(), err)
+	require.Len(s.T(), found, 1)
+	assert.Equal(s.T(), child.ResourceID, found[0].ResourceID)
+	assert.Equal(s.T(), "openshift.io/resource/area", found[0].ResourceType.Name)
+}
+
 func (s *resourceBlackBoxTest) TestExistsResource() {
 	t := s.T()
 
@@ -68,6 +68,12 @@ func (s *resourceServiceImpl) delete(ctx context.Context, resourceID string, vis
 		return err
 	}
 
+	// Delete deny assignments
+	err = s.Repositories().DenyAssignmentRepository().DeleteForResource(ctx, resourceID)
+	if err != nil {
+		return err
+	}
+
 	// Delete assosiated identities in case of Organization, Team or Security Group
 	err = s.Repositories().Identities().DeleteForResource(ctx, resourceID)
 	if err != nil {
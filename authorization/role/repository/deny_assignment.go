@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	resource "github.com/fabric8-services/fabric8-auth/authorization/resource/repository"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+)
+
+// DenyAssignment withdraws a scope from an identity for a resource, whatever the roles granting that scope.
+// A deny assignment takes precedence over any grant: it applies to the identity and to all of its members (whatever
+// the depth of the memberships) for the resource and all of its descendants, and overrides the roles assigned
+// directly, inherited from the parent resources, obtained through a team or organization or through role mappings.
+type DenyAssignment struct {
+	gormsupport.Lifecycle
+
+	// This is the primary key value
+	DenyAssignmentID uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key;column:deny_assignment_id"`
+	// The identity to which the scope is denied
+	IdentityID uuid.UUID        `gorm:"type:uuid"`
+	Identity   account.Identity `gorm:"foreignkey:IdentityID;association_foreignkey:ID"`
+	// The resource for which the scope is denied
+	ResourceID string
+	Resource   resource.Resource `gorm:"foreignkey:ResourceID;association_foreignkey:ResourceID"`
+	// The name of the denied scope
+	ScopeName string
+}
+
+// TableName overrides the table name settings in Gorm to force a specific table name
+// in the database.
+func (m DenyAssignment) TableName() string {
+	return "deny_assignment"
+}
+
+// GetLastModified returns the last modification time
+func (m DenyAssignment) GetLastModified() time.Time {
+	return m.UpdatedAt
+}
+
+// GormDenyAssignmentRepository is the implementation of the storage interface for DenyAssignment.
+type GormDenyAssignmentRepository struct {
+	db *gorm.DB
+}
+
+// NewDenyAssignmentRepository creates a new storage type.
+func NewDenyAssignmentRepository(db *gorm.DB) DenyAssignmentRepository {
+	return &GormDenyAssignmentRepository{db: db}
+}
+
+// DenyAssignmentRepository represents the storage interface.
+type DenyAssignmentRepository interface {
+	Load(ctx context.Context, ID uuid.UUID) (*DenyAssignment, error)
+	Create(ctx context.Context, u *DenyAssignment) error
+	Delete(ctx context.Context, ID uuid.UUID) error
+	DeleteForResource(ctx context.Context, resourceID string) error
+	FindByResource(ctx context.Context, resourceID string, includeParentResources bool) ([]DenyAssignment, error)
+	FindByIdentity(ctx context.Context, identityID uuid.UUID) ([]DenyAssignment, error)
+}
+
+// TableName overrides the table name settings in Gorm to force a specific table name
+// in the database.
+func (m *GormDenyAssignmentRepository) TableName() string {
+	return "deny_assignment"
+}
+
+// Load returns a single DenyAssignment as a Database Model
+func (m *GormDenyAssignmentRepository) Load(ctx context.Context, id uuid.UUID) (*DenyAssignment, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "deny_assignment", "load"}, time.Now())
+	var native DenyAssignment
+	err := m.db.Table(m.TableName()).Preload("Identity").Where("deny_assignment_id = ?", id).Find(&native).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, errors.NewNotFoundError("deny_assignment", id.String())
+	}
+	return &native, errs.WithStack(err)
+}
+
+// Create creates a new record and flags as stale the privileges cached for the identity, its members and the resource
+// with its descendants.
+func (m *GormDenyAssignmentRepository) Create(ctx context.Context, u *DenyAssignment) error {
+	defer goa.MeasureSince([]string{"goa", "db", "deny_assignment", "create"}, time.Now())
+	if u.DenyAssignmentID == uuid.Nil {
+		u.DenyAssignmentID = uuid.NewV4()
+	}
+	err := m.db.Create(u).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"deny_assignment_id": u.DenyAssignmentID,
+			"err":                err,
+		}, "unable to create the deny assignment")
+		if gormsupport.IsUniqueViolation(err, "uq_deny_assignment_identity_resource_scope") {
+			return errs.WithStack(errors.NewDataConflictError(err.Error()))
+		}
+		if gormsupport.IsForeignKeyViolation(err, "deny_assignment_identity_id_fkey") {
+			return errs.WithStack(errors.NewNotFoundError("identity", u.IdentityID.String()))
+		}
+		if gormsupport.IsForeignKeyViolation(err, "deny_assignment_resource_id_fkey") {
+			return errs.WithStack(errors.NewNotFoundError("resource", u.ResourceID))
+		}
+		return errs.WithStack(err)
+	}
+
+	err = NewIdentityRoleRepository(m.db).FlagPrivilegeCacheStaleForIdentityRoleChange(ctx, u.IdentityID, u.ResourceID)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"deny_assignment_id": u.DenyAssignmentID,
+			"err":                err,
+		}, "error notifying privilege cache when creating deny assignment")
+	}
+
+	log.Debug(ctx, map[string]interface{}{
+		"deny_assignment_id": u.DenyAssignmentID,
+	}, "Deny assignment created!")
+	return nil
+}
+
+// Delete removes a single record and flags as stale the privileges cached for the identity, its members and the
+// resource with its descendants.
+func (m *GormDenyAssignmentRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "deny_assignment", "delete"}, time.Now())
+
+	obj, err := m.Load(ctx, id)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"deny_assignment_id": id,
+			"err":                err,
+		}, "unable to delete the deny assignment - record does not exist")
+		return errs.WithStack(err)
+	}
+
+	result := m.db.Delete(obj)
+	if result.Error != nil {
+		log.Error(ctx, map[string]interface{}{
+			"deny_assignment_id": id,
+			"err":                result.Error,
+		}, "unable to delete the deny assignment")
+		return errs.WithStack(result.Error)
+	}
+
+	err = NewIdentityRoleRepository(m.db).FlagPrivilegeCacheStaleForIdentityRoleChange(ctx, obj.IdentityID, obj.ResourceID)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"deny_assignment_id": id,
+			"err":                err,
+		}, "error notifying privilege cache when deleting deny assignment")
+	}
+
+	log.Debug(ctx, map[string]interface{}{
+		"deny_assignment_id": id,
+	}, "Deny assignment deleted!")
+	return nil
+}
+
+// DeleteForResource deletes all deny assignments for the given resource ID
+// No error is returned if no deny assignments found
+func (m *GormDenyAssignmentRepository) DeleteForResource(ctx context.Context, resourceID string) error {
+	defer goa.MeasureSince([]string{"goa", "db", "deny_assignment", "deleteForResource"}, time.Now())
+
+	err := m.db.Table(m.TableName()).Where("resource_id = ?", resourceID).Delete(nil).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return errs.WithStack(err)
+	}
+	return nil
+}
+
+// FindByResource returns the deny assignments for the specified resource, optionally including those for its ancestors
+func (m *GormDenyAssignmentRepository) FindByResource(ctx context.Context, resourceID string, includeParentResources bool) ([]DenyAssignment, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "deny_assignment", "findByResource"}, time.Now())
+
+	var denyAssignments []DenyAssignment
+	q := m.db.Table(m.TableName()).Preload("Identity")
+	if includeParentResources {
+		q = q.Where(`resource_id in (WITH RECURSIVE r AS (
+      SELECT resource_id, parent_resource_id FROM resource WHERE resource_id = ? AND deleted_at IS NULL
+      UNION SELECT p.resource_id, p.parent_resource_id FROM resource p INNER JOIN r ON r.parent_resource_id = p.resource_id)
+	    SELECT r.resource_id FROM r)`, resourceID)
+	} else {
+		q = q.Where("resource_id = ?", resourceID)
+	}
+	err := q.Order("created_at").Find(&denyAssignments).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return denyAssignments, nil
+}
+
+// FindByIdentity returns the deny assignments of the specified identity
+func (m *GormDenyAssignmentRepository) FindByIdentity(ctx context.Context, identityID uuid.UUID) ([]DenyAssignment, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "deny_assignment", "findByIdentity"}, time.Now())
+
+	var denyAssignments []DenyAssignment
+	err := m.db.Table(m.TableName()).Where("identity_id = ?", identityID).Order("created_at").Find(&denyAssignments).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return denyAssignments, nil
+}
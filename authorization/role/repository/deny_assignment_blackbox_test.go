@@ -0,0 +1,195 @@
+package repository_test
+
+import (
+	"testing"
+
+	rolerepo "github.com/fabric8-services/fabric8-auth/authorization/role/repository"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+
+	errs "github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type denyAssignmentBlackBoxTest struct {
+	gormtestsupport.DBTestSuite
+	repo             rolerepo.DenyAssignmentRepository
+	identityRoleRepo rolerepo.IdentityRoleRepository
+}
+
+func TestRunDenyAssignmentBlackBoxTest(t *testing.T) {
+	suite.Run(t, &denyAssignmentBlackBoxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *denyAssignmentBlackBoxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.repo = rolerepo.NewDenyAssignmentRepository(s.DB)
+	s.identityRoleRepo = rolerepo.NewIdentityRoleRepository(s.DB)
+}
+
+func (s *denyAssignmentBlackBoxTest) TestCreateAndFindByResource() {
+	// given
+	g := s.NewTestGraph(s.T())
+	user := g.CreateUser()
+	parent := g.CreateResource()
+	child := g.CreateResource(parent)
+	denyAssignment := &rolerepo.DenyAssignment{
+		IdentityID: user.IdentityID(),
+		ResourceID: parent.ResourceID(),
+		ScopeName:  "test-scope",
+	}
+	// when
+	err := s.repo.Create(s.Ctx, denyAssignment)
+	// then
+	require.NoError(s.T(), err)
+	loaded, err := s.repo.Load(s.Ctx, denyAssignment.DenyAssignmentID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), user.IdentityID(), loaded.IdentityID)
+	assert.Equal(s.T(), user.IdentityID(), loaded.Identity.ID)
+	assert.Equal(s.T(), "test-scope", loaded.ScopeName)
+
+	denyAssignments, err := s.repo.FindByResource(s.Ctx, parent.ResourceID(), false)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), denyAssignments, 1)
+	assert.Equal(s.T(), denyAssignment.DenyAssignmentID, denyAssignments[0].DenyAssignmentID)
+
+	denyAssignments, err = s.repo.FindByResource(s.Ctx, child.ResourceID(), false)
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), denyAssignments)
+
+	denyAssignments, err = s.repo.FindByResource(s.Ctx, child.ResourceID(), true)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), denyAssignments, 1)
+	assert.Equal(s.T(), denyAssignment.DenyAssignmentID, denyAssignments[0].DenyAssignmentID)
+}
+
+func (s *denyAssignmentBlackBoxTest) TestCreateFails() {
+
+	s.T().Run("already exists", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		res := g.CreateResource().AddDenial(user, "test-scope")
+		// when
+		err := s.repo.Create(s.Ctx, &rolerepo.DenyAssignment{
+			IdentityID: user.IdentityID(),
+			ResourceID: res.ResourceID(),
+			ScopeName:  "test-scope",
+		})
+		// then
+		require.Error(t, err)
+		assert.IsType(t, errors.DataConflictError{}, errs.Cause(err))
+	})
+
+	s.T().Run("unknown identity", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		res := g.CreateResource()
+		identityID := uuid.NewV4()
+		// when
+		err := s.repo.Create(s.Ctx, &rolerepo.DenyAssignment{
+			IdentityID: identityID,
+			ResourceID: res.ResourceID(),
+			ScopeName:  "test-scope",
+		})
+		// then
+		testsupport.AssertError(t, err, errors.NotFoundError{}, "identity with id '%s' not found", identityID)
+	})
+}
+
+func (s *denyAssignmentBlackBoxTest) TestDelete() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		res := g.CreateResource().AddDenial(user, "test-scope")
+		denyAssignments, err := s.repo.FindByResource(s.Ctx, res.ResourceID(), false)
+		require.NoError(t, err)
+		require.Len(t, denyAssignments, 1)
+		// when
+		err = s.repo.Delete(s.Ctx, denyAssignments[0].DenyAssignmentID)
+		// then
+		require.NoError(t, err)
+		denyAssignments, err = s.repo.FindByResource(s.Ctx, res.ResourceID(), false)
+		require.NoError(t, err)
+		assert.Empty(t, denyAssignments)
+	})
+
+	s.T().Run("not found", func(t *testing.T) {
+		id := uuid.NewV4()
+		err := s.repo.Delete(s.Ctx, id)
+		testsupport.AssertError(t, err, errors.NotFoundError{}, "deny_assignment with id '%s' not found", id)
+	})
+}
+
+func (s *denyAssignmentBlackBoxTest) TestFindByIdentity() {
+	// given
+	g := s.NewTestGraph(s.T())
+	user := g.CreateUser()
+	other := g.CreateUser()
+	res1 := g.CreateResource().AddDenial(user, "test-scope")
+	res2 := g.CreateResource().AddDenial(user, "test-scope").AddDenial(other, "test-scope")
+
+	// when
+	denyAssignments, err := s.repo.FindByIdentity(s.Ctx, user.IdentityID())
+
+	// then
+	require.NoError(s.T(), err)
+	require.Len(s.T(), denyAssignments, 2)
+	resourceIDs := []string{}
+	for _, denyAssignment := range denyAssignments {
+		assert.Equal(s.T(), user.IdentityID(), denyAssignment.IdentityID)
+		resourceIDs = append(resourceIDs, denyAssignment.ResourceID)
+	}
+	assert.ElementsMatch(s.T(), []string{res1.ResourceID(), res2.ResourceID()}, resourceIDs)
+
+	// when
+	denyAssignments, err = s.repo.FindByIdentity(s.Ctx, uuid.NewV4())
+
+	// then
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), denyAssignments)
+}
+
+func (s *denyAssignmentBlackBoxTest) TestDenialOverridesInheritedGrants() {
+	// given
+	g := s.NewTestGraph(s.T())
+	resourceType := g.CreateResourceType()
+	resourceType.AddScope("test-scope")
+	resourceType.AddScope("other-scope")
+	role := g.CreateRole(resourceType, "test-role").AddScope("test-scope").AddScope("other-scope")
+	user := g.CreateUser()
+	team := g.CreateTeam().AddMember(user)
+	parent := g.CreateResource(resourceType).AddRole(user, role)
+	child := g.CreateResource(parent, resourceType)
+	sibling := g.CreateResource(parent, resourceType)
+	// the scope is denied to the team of the user for the child resource only
+	child.AddDenial(team, "test-scope")
+
+	// when
+	permissions, err := s.identityRoleRepo.FindPermissions(s.Ctx, user.IdentityID(), child.ResourceID(), "test-scope")
+	// then
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), permissions)
+
+	// when
+	scopes, err := s.identityRoleRepo.FindScopesByIdentityAndResource(s.Ctx, user.IdentityID(), child.ResourceID())
+	// then
+	require.NoError(s.T(), err)
+	assert.ElementsMatch(s.T(), []string{"other-scope"}, scopes)
+
+	// the grant still applies to the parent resource and the other children
+	for _, resourceID := range []string{parent.ResourceID(), sibling.ResourceID()} {
+		permissions, err = s.identityRoleRepo.FindPermissions(s.Ctx, user.IdentityID(), resourceID, "test-scope")
+		require.NoError(s.T(), err)
+		assert.NotEmpty(s.T(), permissions)
+		scopes, err = s.identityRoleRepo.FindScopesByIdentityAndResource(s.Ctx, user.IdentityID(), resourceID)
+		require.NoError(s.T(), err)
+		assert.ElementsMatch(s.T(), []string{"test-scope", "other-scope"}, scopes)
+	}
+}
@@ -35,6 +35,9 @@ type IdentityRole struct {
 	// The role that is assigned
 	RoleID uuid.UUID `gorm:"type:uuid"`
 	Role   Role      `gorm:"foreignkey:RoleID;association_foreignkey:RoleID"`
+	// The optional validity window of the assignment, outside of which the role doesn't grant any scope
+	ValidFrom  *time.Time
+	ValidUntil *time.Time
 }
 
 // TableName overrides the table name settings in Gorm to force a specific table name
@@ -48,6 +51,11 @@ func (m IdentityRole) GetLastModified() time.Time {
 	return m.UpdatedAt
 }
 
+// IsActiveAt returns true if the given time is within the validity window of the assignment
+func (m IdentityRole) IsActiveAt(t time.Time) bool {
+	return (m.ValidFrom == nil || !m.ValidFrom.After(t)) && (m.ValidUntil == nil || m.ValidUntil.After(t))
+}
+
 // GormIdentityRoleRepository is the implementation of the storage interface for IdentityRole.
 type GormIdentityRoleRepository struct {
 	db *gorm.DB
@@ -67,13 +75,17 @@ type IdentityRoleRepository interface {
 	List(ctx context.Context) ([]IdentityRole, error)
 	Delete(ctx context.Context, ID uuid.UUID) error
 	DeleteForResource(ctx context.Context, resourceID string) error
+	DeleteForIdentity(ctx context.Context, identityID uuid.UUID) error
 	DeleteForIdentityAndResource(ctx context.Context, resourceID string, identityID uuid.UUID) error
 	FindPermissions(ctx context.Context, identityID uuid.UUID, resourceID string, scopeName string) ([]IdentityRole, error)
 	FindIdentityRolesForIdentity(ctx context.Context, identityID uuid.UUID, resourceType *string) ([]authorization.IdentityAssociation, error)
 	FindIdentityRolesByResourceAndRoleName(ctx context.Context, resourceID string, roleName string, includeParenResources bool) ([]IdentityRole, error)
 	FindIdentityRolesByResource(ctx context.Context, resourceID string, includeParenResources bool) ([]IdentityRole, error)
+	FindIdentityRolesByIdentity(ctx context.Context, identityID uuid.UUID) ([]IdentityRole, error)
 	FindIdentityRolesByIdentityAndResource(ctx context.Context, resourceID string, identityID uuid.UUID) ([]IdentityRole, error)
 	FindScopesByIdentityAndResource(ctx context.Context, identityID uuid.UUID, resourceID string) ([]string, error)
+	FindNextValidityTransition(ctx context.Context, identityID uuid.UUID, resourceID string) (*time.Time, error)
+	FindExpired(ctx context.Context, now time.Time, limit int) ([]IdentityRole, error)
 	FlagPrivilegeCacheStaleForIdentityRoleChange(ctx context.Context, identityID uuid.UUID, resourceID string) error
 }
 
@@ -160,6 +172,14 @@ func (m *GormIdentityRoleRepository) Save(ctx context.Context, model *IdentityRo
 	if err != nil {
 		return errs.WithStack(err)
 	}
+	// the validity window is written separately, since Updates skips the nil fields and would not clear it
+	err = m.db.Model(obj).Updates(map[string]interface{}{
+		"valid_from":  model.ValidFrom,
+		"valid_until": model.ValidUntil,
+	}).Error
+	if err != nil {
+		return errs.WithStack(err)
+	}
 
 	err = m.FlagPrivilegeCacheStaleForIdentityRoleChange(ctx, obj.IdentityID, obj.ResourceID)
 	if err != nil {
@@ -197,6 +217,10 @@ func (m *GormIdentityRoleRepository) Delete(ctx context.Context, id uuid.UUID) e
 		}, "unable to delete the identity role")
 		return errs.WithStack(result.Error)
 	}
+	// the identity role was deleted concurrently since it was loaded
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError("identity_role", id.String())
+	}
 
 	err = m.FlagPrivilegeCacheStaleForIdentityRoleChange(ctx, obj.IdentityID, obj.ResourceID)
 	if err != nil {
@@ -225,10 +249,16 @@ func (m *GormIdentityRoleRepository) List(ctx context.Context) ([]IdentityRole,
 	return rows, nil
 }
 
-// FindPermissions returns an IdentityRole array containing entries that match the specified identity, resource and scope
+// FindPermissions returns an IdentityRole array containing the active entries that match the specified identity,
+// resource and scope.
+// No entry is returned if the scope is denied to the identity (or to any team or organization it belongs to) for the
+// resource or any of its ancestors, since deny assignments take precedence over the roles granting the scope.
 func (m *GormIdentityRoleRepository) FindPermissions(ctx context.Context, identityID uuid.UUID, resourceID string, scopeName string) ([]IdentityRole, error) {
 	var results []IdentityRole
-	err := m.db.Table(m.TableName()).Where(`deleted_at IS NULL AND identity_id IN (
+	err := m.db.Table(m.TableName()).Where(`deleted_at IS NULL
+  AND (valid_from IS NULL OR valid_from <= now()) /* only the active assignments */
+  AND (valid_until IS NULL OR valid_until > now())
+  AND identity_id IN (
   SELECT
     id
   FROM
@@ -361,7 +391,50 @@ func (m *GormIdentityRoleRepository) FindPermissions(ctx context.Context, identi
     CROSS JOIN LATERAL (
       VALUES (from_role_id), (to_role_id)
       ) AS rl (role_id))
-  )`, identityID, identityID, resourceID, resourceID, scopeName, scopeName, resourceID).Scan(&results).Error
+  )
+  AND NOT EXISTS ( /* deny assignments take precedence over any role granting the scope */
+    SELECT
+      1
+    FROM
+      deny_assignment da
+    WHERE
+      da.deleted_at IS NULL
+      AND da.scope_name = ? /* SCOPE */
+      AND (da.identity_id = ? /* IDENTITY_ID */ OR da.identity_id IN (
+        WITH RECURSIVE m AS (
+          SELECT
+            member_of
+          FROM
+            membership
+          WHERE
+            member_id = ? /* IDENTITY_ID */
+          UNION SELECT
+            p.member_of
+          FROM
+            membership p INNER JOIN m ON m.member_of = p.member_id
+        )
+        SELECT member_of FROM m
+      ))
+      AND da.resource_id IN (
+        WITH RECURSIVE m AS (
+          SELECT
+            resource_id, parent_resource_id
+          FROM
+            resource
+          WHERE
+            deleted_at IS NULL
+            AND resource_id = ? /* RESOURCE_ID */
+          UNION SELECT
+            p.resource_id, p.parent_resource_id
+          FROM
+            resource p INNER JOIN m ON m.parent_resource_id = p.resource_id
+        )
+        SELECT
+          m.resource_id
+        FROM
+          m
+      )
+  )`, identityID, identityID, resourceID, resourceID, scopeName, scopeName, resourceID, scopeName, identityID, identityID, resourceID).Scan(&results).Error
 
 	if err != nil {
 		return nil, errs.WithStack(err)
@@ -493,6 +566,17 @@ func (m *GormIdentityRoleRepository) DeleteForResource(ctx context.Context, reso
 	return nil
 }
 
+// DeleteForIdentity deletes all IdentityRoles of the specified identity. This is a hard delete!
+func (m *GormIdentityRoleRepository) DeleteForIdentity(ctx context.Context, identityID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "deleteForIdentity"}, time.Now())
+
+	err := m.db.Table(m.TableName()).Where("identity_id = ?", identityID).Delete(nil).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return errs.WithStack(err)
+	}
+	return nil
+}
+
 // DeleteForIdentityAndResource deletes all IdentityRoles for the specified identity and resource
 // NotFoundError returned if no identity roles found to delete
 func (m *GormIdentityRoleRepository) DeleteForIdentityAndResource(ctx context.Context, resourceID string, identityID uuid.UUID) error {
@@ -512,13 +596,20 @@ func (m *GormIdentityRoleRepository) DeleteForIdentityAndResource(ctx context.Co
 	return nil
 }
 
+// FindIdentityRolesByIdentity returns all identity roles assigned directly to the given identity
+func (m *GormIdentityRoleRepository) FindIdentityRolesByIdentity(ctx context.Context, identityID uuid.UUID) ([]IdentityRole, error) {
+	return m.query(identityRoleFilterByIdentityID(identityID))
+}
+
 // FindIdentityRolesByIdentityAndResource returns all identity roles by identity ID and resource ID
 func (m *GormIdentityRoleRepository) FindIdentityRolesByIdentityAndResource(ctx context.Context, resourceID string, identityID uuid.UUID) ([]IdentityRole, error) {
 	return m.query(identityRoleFilterByIdentityID(identityID), identityRoleFilterByResource(resourceID))
 }
 
 // FindScopesByIdentityAndResource returns all scopes for the specified identity and resource, both assigned directly and
-// also those indirectly inherited via memberships, resource hierarchy and role mappings.
+// also those indirectly inherited via memberships, resource hierarchy and role mappings. Only the assignments within
+// their validity window are taken into account. The scopes denied to the identity (or to any team or organization it
+// belongs to) for the resource or any of its ancestors are excluded.
 func (m *GormIdentityRoleRepository) FindScopesByIdentityAndResource(ctx context.Context, identityID uuid.UUID, resourceID string) ([]string, error) {
 
 	type Result struct {
@@ -638,6 +729,8 @@ func (m *GormIdentityRoleRepository) FindScopesByIdentityAndResource(ctx context
 	WHERE
       ir.role_id = rm.from_role_id
       AND ir.deleted_at IS NULL
+      AND (ir.valid_from IS NULL OR ir.valid_from <= now()) /* only the active assignments */
+      AND (ir.valid_until IS NULL OR ir.valid_until > now())
 	  AND ir.resource_id IN (SELECT resource_id FROM resource_hierarchy)
 	  AND ir.identity_id IN (SELECT identity_id FROM identity_hierarchy)
 	UNION SELECT
@@ -647,6 +740,8 @@ func (m *GormIdentityRoleRepository) FindScopesByIdentityAndResource(ctx context
 	WHERE 
 	  ir2.resource_id IN (SELECT resource_id FROM resource_hierarchy)
       AND ir2.deleted_at IS NULL
+      AND (ir2.valid_from IS NULL OR ir2.valid_from <= now())
+      AND (ir2.valid_until IS NULL OR ir2.valid_until > now())
 	  AND ir2.identity_id IN (SELECT identity_id FROM identity_hierarchy)
 	  AND ir2.role_id IN (SELECT role_id FROM matching_roles)
 )
@@ -654,7 +749,51 @@ SELECT DISTINCT
   rts.name AS scope
 FROM
   identity_resource_roles irr LEFT JOIN role_scope rs ON irr.role_id = rs.role_id
-  LEFT JOIN resource_type_scope rts ON rs.scope_id = rts.resource_type_scope_id`, identityID, identityID, resourceID, resourceID).Scan(&results).Error
+  LEFT JOIN resource_type_scope rts ON rs.scope_id = rts.resource_type_scope_id
+WHERE
+  NOT EXISTS ( /* deny assignments take precedence over any role granting the scope */
+    SELECT
+      1
+    FROM
+      deny_assignment da
+    WHERE
+      da.deleted_at IS NULL
+      AND da.scope_name = rts.name
+      AND (da.identity_id = ? /* IDENTITY_ID */ OR da.identity_id IN (
+        WITH RECURSIVE m AS (
+          SELECT
+            member_of
+          FROM
+            membership
+          WHERE
+            member_id = ? /* IDENTITY_ID */
+          UNION SELECT
+            p.member_of
+          FROM
+            membership p INNER JOIN m ON m.member_of = p.member_id
+        )
+        SELECT member_of FROM m
+      ))
+      AND da.resource_id IN (
+        WITH RECURSIVE m AS (
+          SELECT
+            resource_id, parent_resource_id
+          FROM
+            resource
+          WHERE
+            deleted_at IS NULL
+            AND resource_id = ? /* RESOURCE_ID */
+          UNION SELECT
+            p.resource_id, p.parent_resource_id
+          FROM
+            resource p INNER JOIN m ON m.parent_resource_id = p.resource_id
+        )
+        SELECT
+          m.resource_id
+        FROM
+          m
+      )
+  )`, identityID, identityID, resourceID, resourceID, identityID, identityID, resourceID).Scan(&results).Error
 
 	if err != nil {
 		return nil, errs.WithStack(err)
@@ -669,6 +808,102 @@ FROM
 	return scopes, nil
 }
 
+// FindNextValidityTransition returns the next time at which one of the role assignments of the specified identity (or
+// of any team or organization it belongs to) for the specified resource or any of its ancestors becomes active or
+// expires, or nil if there is no such transition. The scopes of the identity for the resource can change at that time.
+func (m *GormIdentityRoleRepository) FindNextValidityTransition(ctx context.Context, identityID uuid.UUID, resourceID string) (*time.Time, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "findNextValidityTransition"}, time.Now())
+
+	type Result struct {
+		NextTransition *time.Time
+	}
+
+	var result Result
+
+	err := m.db.Raw(`WITH identity_hierarchy AS (
+		WITH RECURSIVE m AS (
+			SELECT
+		    member_of
+		  FROM
+		    membership
+		  WHERE
+		    member_id = ? /* IDENTITY_ID */
+		  UNION SELECT
+		    p.member_of
+		  FROM
+		    membership p INNER JOIN m ON m.member_of = p.member_id
+		)
+		SELECT
+		  member_of AS identity_id
+		FROM
+		  m
+		UNION SELECT
+		  id
+		FROM
+		  identities
+		WHERE
+		  id = ? /* IDENTITY_ID */
+	),
+	resource_hierarchy AS (
+	  WITH RECURSIVE m AS (
+	    SELECT
+	      resource_id, parent_resource_id
+	    FROM
+	      resource
+	    WHERE
+	      deleted_at IS NULL
+	      AND resource_id = ? /* RESOURCE_ID */
+	    UNION SELECT
+	      p.resource_id, p.parent_resource_id
+	    FROM
+	      resource p INNER JOIN m ON m.parent_resource_id = p.resource_id
+	  )
+	  SELECT
+	    m.resource_id
+	  FROM
+	    m
+	),
+	assignments AS (
+	  SELECT
+	    ir.valid_from,
+	    ir.valid_until
+	  FROM
+	    identity_role ir
+	  WHERE
+	    ir.deleted_at IS NULL
+	    AND ir.resource_id IN (SELECT resource_id FROM resource_hierarchy)
+	    AND ir.identity_id IN (SELECT identity_id FROM identity_hierarchy)
+	)
+SELECT
+  MIN(t) AS next_transition
+FROM (
+  SELECT valid_from AS t FROM assignments WHERE valid_from > now()
+  UNION ALL
+  SELECT valid_until AS t FROM assignments WHERE valid_until > now()
+) AS transitions`, identityID, identityID, resourceID).Scan(&result).Error
+
+	if err != nil {
+		return nil, errs.WithStack(err)
+	}
+	return result.NextTransition, nil
+}
+
+// FindExpired returns at most `limit` role assignments whose validity window ended before the given time, with their
+// role, resource and identity, in the order in which they expired
+func (m *GormIdentityRoleRepository) FindExpired(ctx context.Context, now time.Time, limit int) ([]IdentityRole, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "findExpired"}, time.Now())
+
+	var identityRoles []IdentityRole
+
+	err := m.db.Table(m.TableName()).Preload("Role").Preload("Resource").Preload("Identity").
+		Where("valid_until IS NOT NULL AND valid_until <= ?", now).
+		Order("valid_until").Limit(limit).Find(&identityRoles).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errs.WithStack(err)
+	}
+	return identityRoles, nil
+}
+
 // Query exposes an open ended Query model
 func (m *GormIdentityRoleRepository) query(funcs ...func(*gorm.DB) *gorm.DB) ([]IdentityRole, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "identity_role", "list"}, time.Now())
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
 	"github.com/fabric8-services/fabric8-auth/authorization"
@@ -748,3 +749,117 @@ func (s *identityRoleBlackBoxTest) TestFlagPrivilegeCacheAsStale() {
 	t2 = s.Graph.LoadToken(s.Ctx, t2.TokenID())
 	require.False(s.T(), t2.Token().HasStatus(token.TOKEN_STATUS_STALE))
 }
+
+func (s *identityRoleBlackBoxTest) TestInactiveRolesGrantNoScope() {
+	// given
+	g := s.NewTestGraph(s.T())
+	resourceType := g.CreateResourceType()
+	resourceType.AddScope("test-scope")
+	r := g.CreateRole(resourceType, "test-role").AddScope("test-scope")
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	activeUser := g.CreateUser()
+	pendingUser := g.CreateUser()
+	expiredUser := g.CreateUser()
+	team := g.CreateTeam().AddMember(expiredUser)
+	parent := g.CreateResource(resourceType).
+		AddRoleWithValidity(activeUser, r, &past, &future).
+		AddRoleWithValidity(pendingUser, r, &future, nil).
+		AddRoleWithValidity(team, r, nil, &past)
+	child := g.CreateResource(parent, resourceType)
+
+	for _, resourceID := range []string{parent.ResourceID(), child.ResourceID()} {
+		// when
+		permissions, err := s.repo.FindPermissions(s.Ctx, activeUser.IdentityID(), resourceID, "test-scope")
+		// then
+		require.NoError(s.T(), err)
+		assert.NotEmpty(s.T(), permissions)
+		scopes, err := s.repo.FindScopesByIdentityAndResource(s.Ctx, activeUser.IdentityID(), resourceID)
+		require.NoError(s.T(), err)
+		assert.ElementsMatch(s.T(), []string{"test-scope"}, scopes)
+
+		for _, identityID := range []uuid.UUID{pendingUser.IdentityID(), expiredUser.IdentityID()} {
+			// when
+			permissions, err := s.repo.FindPermissions(s.Ctx, identityID, resourceID, "test-scope")
+			// then
+			require.NoError(s.T(), err)
+			assert.Empty(s.T(), permissions)
+			scopes, err := s.repo.FindScopesByIdentityAndResource(s.Ctx, identityID, resourceID)
+			require.NoError(s.T(), err)
+			assert.Empty(s.T(), scopes)
+		}
+	}
+}
+
+func (s *identityRoleBlackBoxTest) TestFindNextValidityTransition() {
+
+	s.T().Run("next transition", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		resourceType := g.CreateResourceType()
+		r := g.CreateRole(resourceType, "test-role")
+		user := g.CreateUser()
+		team := g.CreateTeam().AddMember(user)
+		past := time.Now().Add(-time.Hour)
+		soon := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		later := time.Now().Add(2 * time.Hour)
+		parent := g.CreateResource(resourceType).
+			AddRoleWithValidity(user, r, &past, &later).
+			AddRoleWithValidity(team, r, &soon, nil)
+		child := g.CreateResource(parent, resourceType)
+		// when
+		next, err := s.repo.FindNextValidityTransition(s.Ctx, user.IdentityID(), child.ResourceID())
+		// then
+		require.NoError(t, err)
+		require.NotNil(t, next)
+		assert.True(t, soon.Equal(*next), "expected %s but got %s", soon, *next)
+	})
+
+	s.T().Run("no transition", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		resourceType := g.CreateResourceType()
+		r := g.CreateRole(resourceType, "test-role")
+		user := g.CreateUser()
+		otherUser := g.CreateUser()
+		past := time.Now().Add(-time.Hour)
+		future := time.Now().Add(time.Hour)
+		res := g.CreateResource(resourceType).
+			AddRole(user, r).
+			AddRoleWithValidity(user, g.CreateRole(resourceType, "other-role"), &past, nil).
+			AddRoleWithValidity(otherUser, g.CreateRole(resourceType, "third-role"), nil, &future)
+		// when
+		next, err := s.repo.FindNextValidityTransition(s.Ctx, user.IdentityID(), res.ResourceID())
+		// then
+		require.NoError(t, err)
+		assert.Nil(t, next)
+	})
+}
+
+func (s *identityRoleBlackBoxTest) TestFindExpired() {
+	// given
+	g := s.NewTestGraph(s.T())
+	resourceType := g.CreateResourceType()
+	r := g.CreateRole(resourceType, "test-role")
+	expiredUser := g.CreateUser()
+	activeUser := g.CreateUser()
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	res := g.CreateResource(resourceType).
+		AddRoleWithValidity(expiredUser, r, nil, &past).
+		AddRoleWithValidity(activeUser, r, nil, &future).
+		AddRole(g.CreateUser(), r)
+	// when
+	identityRoles, err := s.repo.FindExpired(s.Ctx, time.Now(), 1000)
+	// then
+	require.NoError(s.T(), err)
+	var found []uuid.UUID
+	for _, identityRole := range identityRoles {
+		if identityRole.ResourceID == res.ResourceID() {
+			found = append(found, identityRole.IdentityID)
+			assert.Equal(s.T(), "test-role", identityRole.Role.Name)
+			assert.Equal(s.T(), expiredUser.IdentityID(), identityRole.Identity.ID)
+		}
+	}
+	assert.Equal(s.T(), []uuid.UUID{expiredUser.IdentityID()}, found)
+}
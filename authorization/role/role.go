@@ -1,5 +1,9 @@
 package role
 
+import (
+	"time"
+)
+
 // RoleDescriptor is a DTO used to pass role information between the service layer and controller layer
 type RoleDescriptor struct {
 	RoleID       string
@@ -7,3 +11,10 @@ type RoleDescriptor struct {
 	Scopes       []string
 	ResourceType string
 }
+
+// Validity is the optional window during which a role assignment grants the scopes of its role. A nil bound leaves
+// the window open on that side.
+type Validity struct {
+	ValidFrom  *time.Time
+	ValidUntil *time.Time
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/application/service"
+	"github.com/fabric8-services/fabric8-auth/log"
+)
+
+type roleExpiryWorkerConfig interface {
+	GetRoleExpiryInterval() time.Duration
+	GetRoleExpiryBatchSize() int
+}
+
+// RoleExpiryWorker periodically revokes the role assignments whose validity window is over, and notifies their
+// assignees
+type RoleExpiryWorker struct {
+	config                roleExpiryWorkerConfig
+	roleManagementService service.RoleManagementService
+	ticker                *time.Ticker
+	stopCh                chan bool
+}
+
+// NewRoleExpiryWorker returns a new role expiry worker
+func NewRoleExpiryWorker(roleManagementService service.RoleManagementService, config roleExpiryWorkerConfig) *RoleExpiryWorker {
+	return &RoleExpiryWorker{
+		config:                config,
+		roleManagementService: roleManagementService,
+	}
+}
+
+// Start initializes the regular revocations
+func (w *RoleExpiryWorker) Start() {
+	w.ticker = time.NewTicker(w.config.GetRoleExpiryInterval())
+	w.stopCh = make(chan bool, 1)
+	go func() {
+		defer log.Info(nil, map[string]interface{}{}, "role expiry worker stopped")
+		log.Info(nil, map[string]interface{}{"interval": w.config.GetRoleExpiryInterval()}, "role expiry worker started")
+		for {
+			select {
+			case <-w.ticker.C:
+				w.RevokeExpiredRoles(context.Background())
+			case <-w.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the revocations
+func (w *RoleExpiryWorker) Stop() {
+	if w.stopCh != nil {
+		w.ticker.Stop()
+		w.stopCh <- true
+	}
+}
+
+// RevokeExpiredRoles revokes the role assignments whose validity window is over, and returns the number of revoked
+// assignments. The expired assignments already grant no scope, so the revocation only cleans them up and notifies
+// their assignees.
+func (w *RoleExpiryWorker) RevokeExpiredRoles(ctx context.Context) int {
+	identityRoles, err := w.roleManagementService.ListExpiredRoles(ctx, w.config.GetRoleExpiryBatchSize())
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err": err,
+		}, "unable to list the expired role assignments")
+		return 0
+	}
+	revoked := 0
+	for _, identityRole := range identityRoles {
+		err := w.roleManagementService.RevokeExpiredRole(ctx, identityRole)
+		if err != nil {
+			log.Error(ctx, map[string]interface{}{
+				"identity_role_id": identityRole.IdentityRoleID,
+				"err":              err,
+			}, "unable to revoke the expired role assignment")
+			continue
+		}
+		revoked++
+	}
+	return revoked
+}
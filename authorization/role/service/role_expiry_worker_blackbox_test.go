@@ -0,0 +1,130 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/application/service/factory"
+	rolerepo "github.com/fabric8-services/fabric8-auth/authorization/role/repository"
+	roleservice "github.com/fabric8-services/fabric8-auth/authorization/role/service"
+	"github.com/fabric8-services/fabric8-auth/gormapplication"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	"github.com/fabric8-services/fabric8-auth/notification"
+	"github.com/fabric8-services/fabric8-auth/rest"
+	testservice "github.com/fabric8-services/fabric8-auth/test/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type roleExpiryWorkerBlackboxTestSuite struct {
+	gormtestsupport.DBTestSuite
+}
+
+func TestRoleExpiryWorker(t *testing.T) {
+	suite.Run(t, &roleExpiryWorkerBlackboxTestSuite{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+type roleExpiryWorkerConfig struct{}
+
+func (c roleExpiryWorkerConfig) GetRoleExpiryInterval() time.Duration {
+	return time.Hour
+}
+
+func (c roleExpiryWorkerConfig) GetRoleExpiryBatchSize() int {
+	return 1000
+}
+
+func (s *roleExpiryWorkerBlackboxTestSuite) TestRevokeExpiredRoles() {
+	// given
+	var messages []notification.Message
+	notificationServiceMock := testservice.NewNotificationServiceMock(s.T())
+	notificationServiceMock.SendMessageAsyncFunc = func(ctx context.Context, msg notification.Message, options ...rest.HTTPClientOption) (chan error, error) {
+		messages = append(messages, msg)
+		return nil, nil
+	}
+	application := gormapplication.NewGormDB(s.DB, s.Configuration, s.Wrappers, factory.WithNotificationService(notificationServiceMock))
+	g := s.NewTestGraph(s.T())
+	resourceType := g.CreateResourceType()
+	r := g.CreateRole(resourceType, "test-role")
+	expiredUser := g.CreateUser()
+	activeUser := g.CreateUser()
+	team := g.CreateTeam()
+	expiredAt := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	future := time.Now().Add(time.Hour)
+	res := g.CreateResource(resourceType).
+		AddRoleWithValidity(expiredUser, r, nil, &expiredAt).
+		AddRoleWithValidity(team, r, nil, &expiredAt).
+		AddRoleWithValidity(activeUser, r, nil, &future)
+	worker := roleservice.NewRoleExpiryWorker(application.RoleManagementService(), roleExpiryWorkerConfig{})
+
+	// when
+	revoked := worker.RevokeExpiredRoles(s.Ctx)
+
+	// then
+	assert.True(s.T(), revoked >= 2)
+	identityRoles, err := application.IdentityRoleRepository().FindIdentityRolesByResource(s.Ctx, res.ResourceID(), false)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), identityRoles, 1)
+	assert.Equal(s.T(), activeUser.IdentityID(), identityRoles[0].IdentityID)
+	// only the users are notified
+	var notified []notification.Message
+	for _, msg := range messages {
+		if msg.UserID != nil && (*msg.UserID == expiredUser.IdentityID().String() || *msg.UserID == team.TeamID().String() || *msg.UserID == activeUser.IdentityID().String()) {
+			notified = append(notified, msg)
+		}
+	}
+	require.Len(s.T(), notified, 1)
+	assert.Equal(s.T(), "role.assignment.expired", notified[0].MessageType)
+	assert.Equal(s.T(), expiredUser.IdentityID().String(), *notified[0].UserID)
+	assert.Equal(s.T(), map[string]interface{}{
+		"resourceID":   res.ResourceID(),
+		"resourceName": res.Resource().Name,
+		"roleName":     "test-role",
+		"expiredAt":    expiredAt.Format(time.RFC3339),
+	}, notified[0].Custom)
+}
+
+func (s *roleExpiryWorkerBlackboxTestSuite) TestRevokeExpiredRoleAlreadyRevoked() {
+	// given
+	var messages []notification.Message
+	notificationServiceMock := testservice.NewNotificationServiceMock(s.T())
+	notificationServiceMock.SendMessageAsyncFunc = func(ctx context.Context, msg notification.Message, options ...rest.HTTPClientOption) (chan error, error) {
+		messages = append(messages, msg)
+		return nil, nil
+	}
+	application := gormapplication.NewGormDB(s.DB, s.Configuration, s.Wrappers, factory.WithNotificationService(notificationServiceMock))
+	g := s.NewTestGraph(s.T())
+	resourceType := g.CreateResourceType()
+	r := g.CreateRole(resourceType)
+	user := g.CreateUser()
+	expiredAt := time.Now().Add(-time.Minute)
+	res := g.CreateResource(resourceType).AddRoleWithValidity(user, r, nil, &expiredAt)
+	// the same batch is picked by two replicas
+	identityRoles, err := application.RoleManagementService().ListExpiredRoles(s.Ctx, 1000)
+	require.NoError(s.T(), err)
+	var identityRole *rolerepo.IdentityRole
+	for i := range identityRoles {
+		if identityRoles[i].ResourceID == res.ResourceID() {
+			identityRole = &identityRoles[i]
+		}
+	}
+	require.NotNil(s.T(), identityRole)
+
+	// when
+	err = application.RoleManagementService().RevokeExpiredRole(s.Ctx, *identityRole)
+	require.NoError(s.T(), err)
+	err = application.RoleManagementService().RevokeExpiredRole(s.Ctx, *identityRole)
+
+	// then
+	require.NoError(s.T(), err)
+	var notified []notification.Message
+	for _, msg := range messages {
+		if msg.UserID != nil && *msg.UserID == user.IdentityID().String() {
+			notified = append(notified, msg)
+		}
+	}
+	assert.Len(s.T(), notified, 1)
+}
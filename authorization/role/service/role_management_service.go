@@ -3,15 +3,20 @@ package service
 import (
 	"context"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/fabric8-services/fabric8-auth/application/service/base"
 	servicecontext "github.com/fabric8-services/fabric8-auth/application/service/context"
+	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
 	"github.com/fabric8-services/fabric8-auth/authorization"
 	resource "github.com/fabric8-services/fabric8-auth/authorization/resource/repository"
 	"github.com/fabric8-services/fabric8-auth/authorization/role"
 	rolerepo "github.com/fabric8-services/fabric8-auth/authorization/role/repository"
+	"github.com/fabric8-services/fabric8-auth/authorization/token"
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/notification"
 
 	"github.com/satori/go.uuid"
 )
@@ -46,6 +51,212 @@ func (s *roleManagementServiceImpl) ListByResource(ctx context.Context, currentI
 	return s.Repositories().IdentityRoleRepository().FindIdentityRolesByResource(ctx, resourceID, false)
 }
 
+// ListPrincipalsByScope returns the identities which effectively hold the given scope on the given resource, i.e. the
+// identities to which a role granting the scope is assigned (and currently active) for the resource or one of its
+// ancestors, either directly or through a role mapping, along with the members of these identities (whatever the depth) if they are teams or
+// organizations. Each principal comes with the grants explaining how it obtained the scope. The identities to which the
+// scope is denied, directly or through a team or organization, for the resource or one of its ancestors are excluded.
+// The current user must have the scope to view the roles of the resource, unless the request is made by the notification
+// service account.
+func (s *roleManagementServiceImpl) ListPrincipalsByScope(ctx context.Context, currentIdentity uuid.UUID, resourceID string, scopeName string) ([]authorization.EffectivePrincipal, error) {
+	if !token.IsSpecificServiceAccount(ctx, token.Notification) {
+		err := s.requireViewRolesScope(ctx, currentIdentity, resourceID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	res, err := s.Repositories().ResourceRepository().Load(ctx, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	grantingRoles, err := s.findRolesGrantingScope(ctx, *res, scopeName)
+	if err != nil {
+		return nil, err
+	}
+	identityRoles, err := s.Repositories().IdentityRoleRepository().FindIdentityRolesByResource(ctx, resourceID, true)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+
+	now := time.Now()
+	principals := make(map[uuid.UUID]*authorization.EffectivePrincipal)
+	// the members of the identities, loaded once per identity even if it has several assignments or denials
+	membersByIdentity := make(map[uuid.UUID][]member)
+	for _, identityRole := range identityRoles {
+		mappedRoles, found := grantingRoles[identityRole.RoleID]
+		if !found || !identityRole.IsActiveAt(now) {
+			continue
+		}
+		members, err := s.findMembers(ctx, identityRole.IdentityID, membersByIdentity)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			principal, found := principals[member.identity.ID]
+			if !found {
+				principal = &authorization.EffectivePrincipal{
+					IdentityID: member.identity.ID,
+					Name:       member.identity.Username,
+				}
+				if member.identity.IdentityResourceID.Valid {
+					principal.Name = member.identity.IdentityResource.Name
+				}
+				principals[member.identity.ID] = principal
+			}
+			principal.Grants = append(principal.Grants, authorization.ScopeGrant{
+				AssigneeID:  identityRole.IdentityID,
+				MemberOf:    member.memberOf,
+				ResourceID:  identityRole.ResourceID,
+				Inherited:   identityRole.ResourceID != resourceID,
+				RoleName:    identityRole.Role.Name,
+				MappedRoles: mappedRoles,
+			})
+		}
+	}
+
+	// the deny assignments of the scope take precedence over the grants, for the assignees and all their members
+	denyAssignments, err := s.Repositories().DenyAssignmentRepository().FindByResource(ctx, resourceID, true)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	for _, denyAssignment := range denyAssignments {
+		if denyAssignment.ScopeName != scopeName {
+			continue
+		}
+		members, err := s.findMembers(ctx, denyAssignment.IdentityID, membersByIdentity)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			delete(principals, member.identity.ID)
+		}
+	}
+
+	result := make([]authorization.EffectivePrincipal, 0, len(principals))
+	for _, principal := range principals {
+		result = append(result, *principal)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].IdentityID.String() < result[j].IdentityID.String()
+	})
+	return result, nil
+}
+
+// findRolesGrantingScope returns the roles which grant the given scope on the given resource: the roles of the type of
+// the resource which have the scope, and the roles which are mapped to one of them (possibly through other roles) by a
+// role mapping defined for the resource or one of its ancestors. The values are the names of the roles to which each
+// role is mapped, ending with the role which has the scope.
+func (s *roleManagementServiceImpl) findRolesGrantingScope(ctx context.Context, res resource.Resource, scopeName string) (map[uuid.UUID][]string, error) {
+	roles, err := s.Repositories().RoleRepository().FindRolesByResourceType(ctx, res.ResourceType.Name)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	roleNames := make(map[uuid.UUID]string)
+	grantingRoles := make(map[uuid.UUID][]string)
+	var queue []uuid.UUID
+	for _, r := range roles {
+		roleID, err := uuid.FromString(r.RoleID)
+		if err != nil {
+			return nil, errors.NewInternalError(ctx, err)
+		}
+		roleNames[roleID] = r.RoleName
+		for _, scope := range r.Scopes {
+			if scope == scopeName {
+				grantingRoles[roleID] = []string{}
+				queue = append(queue, roleID)
+				break
+			}
+		}
+	}
+
+	// collect the role mappings defined for the resource and its ancestors
+	var roleMappings []rolerepo.RoleMapping
+	current := &res
+	for {
+		mappings, err := s.Repositories().RoleMappingRepository().FindForResource(ctx, current.ResourceID)
+		if err != nil {
+			return nil, errors.NewInternalError(ctx, err)
+		}
+		roleMappings = append(roleMappings, mappings...)
+		if current.ParentResourceID == nil {
+			break
+		}
+		current, err = s.Repositories().ResourceRepository().Load(ctx, *current.ParentResourceID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// walk the role mappings backwards, from the roles which have the scope
+	for len(queue) > 0 {
+		toRoleID := queue[0]
+		queue = queue[1:]
+		for _, mapping := range roleMappings {
+			if mapping.ToRoleID != toRoleID || mapping.FromRoleID == toRoleID {
+				continue
+			}
+			if _, found := grantingRoles[mapping.FromRoleID]; found {
+				continue
+			}
+			toRoleName, found := roleNames[toRoleID]
+			if !found {
+				r, err := s.Repositories().RoleRepository().Load(ctx, toRoleID)
+				if err != nil {
+					return nil, err
+				}
+				toRoleName = r.Name
+				roleNames[toRoleID] = toRoleName
+			}
+			grantingRoles[mapping.FromRoleID] = append([]string{toRoleName}, grantingRoles[toRoleID]...)
+			queue = append(queue, mapping.FromRoleID)
+		}
+	}
+	return grantingRoles, nil
+}
+
+// member is an identity which belongs to a team or organization, with the chain of teams and organizations through
+// which it belongs to it
+type member struct {
+	identity account.Identity
+	memberOf []uuid.UUID
+}
+
+// findMembers returns the given identity, along with all its members if it is a team or organization, whatever the depth
+// of the memberships. Each member comes with the shortest chain of memberships to the given identity. The members are
+// read from and added to the given map of the members already found by identity.
+func (s *roleManagementServiceImpl) findMembers(ctx context.Context, identityID uuid.UUID, membersByIdentity map[uuid.UUID][]member) ([]member, error) {
+	if members, found := membersByIdentity[identityID]; found {
+		return members, nil
+	}
+	identity, err := s.Repositories().Identities().Load(ctx, identityID, account.IdentityWithResource())
+	if err != nil {
+		return nil, err
+	}
+	members := []member{{identity: *identity, memberOf: []uuid.UUID{}}}
+	visited := map[uuid.UUID]bool{identity.ID: true}
+	for i := 0; i < len(members); i++ {
+		directMembers, err := s.Repositories().Identities().Query(account.IdentityFilterByMemberOf(members[i].identity.ID), account.IdentityWithResource())
+		if err != nil {
+			return nil, errors.NewInternalError(ctx, err)
+		}
+		for _, directMember := range directMembers {
+			if visited[directMember.ID] {
+				continue
+			}
+			visited[directMember.ID] = true
+			members = append(members, member{
+				identity: directMember,
+				memberOf: append([]uuid.UUID{members[i].identity.ID}, members[i].memberOf...),
+			})
+		}
+	}
+	membersByIdentity[identityID] = members
+	return members, nil
+}
+
 func (s *roleManagementServiceImpl) requireViewRolesScope(ctx context.Context, currentIdentity uuid.UUID, resourceID string) error {
 	// Lookup the resourceID and ensure the resource is valid
 	rt, err := s.Repositories().ResourceRepository().Load(ctx, resourceID)
@@ -67,8 +278,18 @@ func (s *roleManagementServiceImpl) ListAvailableRolesByResourceType(ctx context
 // which we want to assign the role to.
 // If appendToExistingRoles == true then the new roles for these identities will be appended to the existing roles.
 // If appendToExistingRoles == false then the new roles will replace the existing ones (the existing ones will be deleted).
+// The new roles only grant their scopes within the given validity window, and are revoked once it is over.
 // IMPORTANT: This is a transactional method, which manages its own transaction/s internally
-func (s *roleManagementServiceImpl) Assign(ctx context.Context, assignedBy uuid.UUID, roleAssignments map[string][]uuid.UUID, resourceID string, appendToExistingRoles bool) error {
+func (s *roleManagementServiceImpl) Assign(ctx context.Context, assignedBy uuid.UUID, roleAssignments map[string][]uuid.UUID, resourceID string, appendToExistingRoles bool, validity role.Validity) error {
+	if validity.ValidUntil != nil {
+		if !validity.ValidUntil.After(time.Now()) {
+			return errors.NewBadParameterErrorFromString("valid_until", validity.ValidUntil.Format(time.RFC3339), "the end of the validity window must be in the future")
+		}
+		if validity.ValidFrom != nil && !validity.ValidUntil.After(*validity.ValidFrom) {
+			return errors.NewBadParameterErrorFromString("valid_until", validity.ValidUntil.Format(time.RFC3339), "the end of the validity window must be after its start")
+		}
+	}
+
 	// Lookup the resourceID and ensure the resource is valid
 	rt, err := s.Repositories().ResourceRepository().Load(ctx, resourceID)
 	if err != nil {
@@ -153,6 +374,8 @@ func (s *roleManagementServiceImpl) Assign(ctx context.Context, assignedBy uuid.
 					ResourceID: resourceID,
 					IdentityID: identityIDAsUUID,
 					RoleID:     roleID,
+					ValidFrom:  validity.ValidFrom,
+					ValidUntil: validity.ValidUntil,
 				}
 
 				err = s.Repositories().IdentityRoleRepository().Create(ctx, &ir)
@@ -231,3 +454,166 @@ func (s *roleManagementServiceImpl) RevokeResourceRoles(ctx context.Context, cur
 
 	return err
 }
+
+// ListDenials lists the deny assignments for the resource if the current user has permissions to view the roles
+func (s *roleManagementServiceImpl) ListDenials(ctx context.Context, currentIdentity uuid.UUID, resourceID string) ([]rolerepo.DenyAssignment, error) {
+	err := s.requireViewRolesScope(ctx, currentIdentity, resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Repositories().DenyAssignmentRepository().FindByResource(ctx, resourceID, false)
+}
+
+// Deny denies scopes to identities (users, organizations or teams) for a specific resource, whatever the roles granting
+// these scopes. denials is a map where the key is a scope name and the value is an array of IDs of the identities
+// to which the scope is denied. A denial applies to the identity and to all of its members, for the resource and all of
+// its descendants, and takes precedence over the roles assigned directly, inherited from the parent resources,
+// obtained through a team or organization or through role mappings.
+// The scopes which are already denied to an identity for the resource are ignored.
+// IMPORTANT: This is a transactional method, which manages its own transaction/s internally
+func (s *roleManagementServiceImpl) Deny(ctx context.Context, deniedBy uuid.UUID, denials map[string][]uuid.UUID, resourceID string) error {
+	// Lookup the resourceID and ensure the resource is valid
+	rt, err := s.Repositories().ResourceRepository().Load(ctx, resourceID)
+	if err != nil {
+		return err
+	}
+
+	// check if the current user token belongs to a user who has the necessary privileges
+	// for managing roles.
+	err = s.Services().PermissionService().RequireScope(ctx, deniedBy, resourceID, authorization.ScopeForManagingRolesInResourceType(rt.Name))
+	if err != nil {
+		return err
+	}
+
+	// only the scopes of the type of the resource can be denied
+	for scopeName := range denials {
+		_, err := s.Repositories().ResourceTypeScopeRepository().LookupByResourceTypeAndScope(ctx, rt.ResourceTypeID, scopeName)
+		if err != nil {
+			if notFound, _ := errors.IsNotFoundError(err); notFound {
+				return errors.NewBadParameterErrorFromString("scope", scopeName, fmt.Sprintf("scope %s doesn't apply to the resources of type %s", scopeName, rt.ResourceType.Name))
+			}
+			return err
+		}
+	}
+
+	existingDenials, err := s.Repositories().DenyAssignmentRepository().FindByResource(ctx, resourceID, false)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	denied := make(map[string]map[uuid.UUID]bool)
+	for _, denyAssignment := range existingDenials {
+		if denied[denyAssignment.ScopeName] == nil {
+			denied[denyAssignment.ScopeName] = make(map[uuid.UUID]bool)
+		}
+		denied[denyAssignment.ScopeName][denyAssignment.IdentityID] = true
+	}
+
+	return s.ExecuteInTransaction(func() error {
+		for scopeName, identityIDs := range denials {
+			for _, identityID := range identityIDs {
+				if denied[scopeName][identityID] {
+					continue
+				}
+				err := s.Repositories().DenyAssignmentRepository().Create(ctx, &rolerepo.DenyAssignment{
+					ResourceID: resourceID,
+					IdentityID: identityID,
+					ScopeName:  scopeName,
+				})
+				if err != nil {
+					log.Error(ctx, map[string]interface{}{
+						"resource_id": resourceID,
+						"identity_id": identityID,
+						"scope_name":  scopeName,
+					}, "deny assignment failed")
+					return err
+				}
+				if denied[scopeName] == nil {
+					denied[scopeName] = make(map[uuid.UUID]bool)
+				}
+				denied[scopeName][identityID] = true
+			}
+		}
+		return nil
+	})
+}
+
+// RevokeDenial revokes a deny assignment for the resource, so that the identity gets back the scope if one of its
+// roles grants it
+// IMPORTANT: This is a transactional method, which manages its own transaction/s internally
+func (s *roleManagementServiceImpl) RevokeDenial(ctx context.Context, currentIdentity uuid.UUID, resourceID string, denyAssignmentID uuid.UUID) error {
+	// Lookup the resourceID and ensure the resource is valid
+	rt, err := s.Repositories().ResourceRepository().Load(ctx, resourceID)
+	if err != nil {
+		return err
+	}
+
+	// check if the current user token belongs to a user who has the necessary privileges
+	// for managing roles.
+	err = s.Services().PermissionService().RequireScope(ctx, currentIdentity, resourceID, authorization.ScopeForManagingRolesInResourceType(rt.Name))
+	if err != nil {
+		return err
+	}
+
+	return s.ExecuteInTransaction(func() error {
+		denyAssignment, err := s.Repositories().DenyAssignmentRepository().Load(ctx, denyAssignmentID)
+		if err != nil {
+			return err
+		}
+		if denyAssignment.ResourceID != resourceID {
+			return errors.NewNotFoundError("deny_assignment", denyAssignmentID.String())
+		}
+		return s.Repositories().DenyAssignmentRepository().Delete(ctx, denyAssignmentID)
+	})
+}
+
+// ListExpiredRoles returns at most `limit` role assignments whose validity window is over, with their role, resource
+// and identity, in the order in which they expired
+func (s *roleManagementServiceImpl) ListExpiredRoles(ctx context.Context, limit int) ([]rolerepo.IdentityRole, error) {
+	identityRoles, err := s.Repositories().IdentityRoleRepository().FindExpired(ctx, time.Now(), limit)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	return identityRoles, nil
+}
+
+// RevokeExpiredRole deletes the given role assignment whose validity window is over, and notifies the assignee if it
+// is a user. The assignment is not restored if the notification can't be sent. Nothing is done if the assignment was
+// already revoked, e.g. by the worker of another replica, so that the assignee is notified only once.
+// IMPORTANT: This is a transactional method, which manages its own transaction/s internally
+func (s *roleManagementServiceImpl) RevokeExpiredRole(ctx context.Context, identityRole rolerepo.IdentityRole) error {
+	err := s.ExecuteInTransaction(func() error {
+		return s.Repositories().IdentityRoleRepository().Delete(ctx, identityRole.IdentityRoleID)
+	})
+	if notFound, _ := errors.IsNotFoundError(err); notFound {
+		// the role assignment was already revoked by another replica, which also notified the assignee
+		log.Info(ctx, map[string]interface{}{
+			"identity_role_id": identityRole.IdentityRoleID,
+		}, "expired role assignment already revoked")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Info(ctx, map[string]interface{}{
+		"identity_role_id": identityRole.IdentityRoleID,
+		"identity_id":      identityRole.IdentityID,
+		"resource_id":      identityRole.ResourceID,
+		"role_name":        identityRole.Role.Name,
+		"valid_until":      identityRole.ValidUntil,
+	}, "expired role assignment revoked")
+
+	if !identityRole.Identity.IsUser() {
+		return nil
+	}
+	msg := notification.NewRoleAssignmentExpired(identityRole.IdentityID.String(), identityRole.ResourceID, identityRole.Resource.Name, identityRole.Role.Name, *identityRole.ValidUntil)
+	_, err = s.Services().NotificationService().SendMessageAsync(ctx, msg)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"identity_role_id": identityRole.IdentityRoleID,
+			"identity_id":      identityRole.IdentityID,
+			"err":              err,
+		}, "unable to send the notification of the expiry of the role assignment")
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package service_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/fabric8-services/fabric8-auth/application/service"
 	"github.com/fabric8-services/fabric8-auth/authorization"
@@ -235,7 +236,7 @@ func (s *roleManagementServiceBlackboxTest) checkAssignRoleOK(appendToExistingRo
 	roleAssignments[authorization.SpaceAdminRole] = usersToBeAssignedAsAdmin
 	roleAssignments[authorization.SpaceContributorRole] = usersToBeAssignedAsContributor
 
-	err := s.service.Assign(context.Background(), adminUser.Identity().ID, roleAssignments, newSpace.SpaceID(), appendToExistingRoles)
+	err := s.service.Assign(context.Background(), adminUser.Identity().ID, roleAssignments, newSpace.SpaceID(), appendToExistingRoles, role.Validity{})
 	require.NoError(s.T(), err)
 
 	s.addNoisyAssignments()
@@ -288,7 +289,7 @@ func (s *roleManagementServiceBlackboxTest) TestAssignRoleWithLackOfPermissionsF
 	roleAssignments := make(map[string][]uuid.UUID)
 	roleAssignments[authorization.SpaceAdminRole] = []uuid.UUID{userToBeAssigned.Identity().ID}
 
-	err := s.service.Assign(context.Background(), viewer.Identity().ID, roleAssignments, newSpace.SpaceID(), false)
+	err := s.service.Assign(context.Background(), viewer.Identity().ID, roleAssignments, newSpace.SpaceID(), false, role.Validity{})
 	testsupport.AssertError(s.T(), err, errors.ForbiddenError{}, "identity with ID %s does not have required scope manage for resource %s", viewer.Identity().ID.String(), newSpace.SpaceID())
 }
 
@@ -303,7 +304,7 @@ func (s *roleManagementServiceBlackboxTest) TestAssignRoleAlreadyExists() {
 
 	// We've already assigned the contributor and admin roles, lets try to add the admin role again
 	roleAssignments[authorization.SpaceAdminRole] = []uuid.UUID{userToBeAssigned.Identity().ID}
-	err := s.service.Assign(context.Background(), spaceAdmin.Identity().ID, roleAssignments, newSpace.SpaceID(), true)
+	err := s.service.Assign(context.Background(), spaceAdmin.Identity().ID, roleAssignments, newSpace.SpaceID(), true, role.Validity{})
 	require.Error(s.T(), err)
 	require.IsType(s.T(), errors.DataConflictError{}, errs.Cause(err))
 }
@@ -315,7 +316,7 @@ func (s *roleManagementServiceBlackboxTest) TestAssignRoleResourceNotFound() {
 	roleAssignments := make(map[string][]uuid.UUID)
 	roleAssignments[authorization.SpaceContributorRole] = userToBeAdded
 
-	err := s.service.Assign(context.Background(), identityID, roleAssignments, uuid.NewV4().String(), false)
+	err := s.service.Assign(context.Background(), identityID, roleAssignments, uuid.NewV4().String(), false, role.Validity{})
 	require.IsType(s.T(), errors.NotFoundError{}, errs.Cause(err))
 }
 
@@ -327,7 +328,7 @@ func (s *roleManagementServiceBlackboxTest) TestAssignRoleWithRoleNotFound() {
 	roleAssignments := make(map[string][]uuid.UUID)
 	roleAssignments[uuid.NewV4().String()] = userToBeAdded
 
-	err := s.service.Assign(context.Background(), adminUser.Identity().ID, roleAssignments, newSpace.SpaceID(), false)
+	err := s.service.Assign(context.Background(), adminUser.Identity().ID, roleAssignments, newSpace.SpaceID(), false, role.Validity{})
 	require.IsType(s.T(), errors.NotFoundError{}, errs.Cause(err))
 }
 
@@ -339,10 +340,88 @@ func (s *roleManagementServiceBlackboxTest) TestAssignRoleWithIdentityNotFound()
 	roleAssignments := make(map[string][]uuid.UUID)
 	roleAssignments[authorization.SpaceAdminRole] = userToBeAdded
 
-	err := s.service.Assign(context.Background(), adminUser.Identity().ID, roleAssignments, newSpace.SpaceID(), false)
+	err := s.service.Assign(context.Background(), adminUser.Identity().ID, roleAssignments, newSpace.SpaceID(), false, role.Validity{})
 	require.IsType(s.T(), errors.BadParameterError{}, errs.Cause(err))
 }
 
+func (s *roleManagementServiceBlackboxTest) TestAssignRoleWithValidity() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		adminUser := g.CreateUser()
+		newSpace := g.CreateSpace().AddAdmin(adminUser)
+		pendingUser := g.CreateUser()
+		activeUser := g.CreateUser()
+		newSpace.AddViewer(pendingUser).AddViewer(activeUser)
+		validFrom := time.Now().Add(time.Hour)
+		validUntil := time.Now().Add(2 * time.Hour)
+
+		// when
+		err := s.service.Assign(s.Ctx, adminUser.IdentityID(), map[string][]uuid.UUID{authorization.SpaceContributorRole: {pendingUser.IdentityID()}}, newSpace.SpaceID(), true, role.Validity{ValidFrom: &validFrom, ValidUntil: &validUntil})
+		require.NoError(t, err)
+		err = s.service.Assign(s.Ctx, adminUser.IdentityID(), map[string][]uuid.UUID{authorization.SpaceContributorRole: {activeUser.IdentityID()}}, newSpace.SpaceID(), true, role.Validity{ValidUntil: &validUntil})
+		require.NoError(t, err)
+
+		// then
+		identityRoles, err := s.Application.IdentityRoleRepository().FindIdentityRolesByResourceAndRoleName(s.Ctx, newSpace.SpaceID(), authorization.SpaceContributorRole, false)
+		require.NoError(t, err)
+		require.Len(t, identityRoles, 2)
+		for _, identityRole := range identityRoles {
+			require.NotNil(t, identityRole.ValidUntil)
+			assert.WithinDuration(t, validUntil, *identityRole.ValidUntil, time.Millisecond)
+			if identityRole.IdentityID == pendingUser.IdentityID() {
+				require.NotNil(t, identityRole.ValidFrom)
+				assert.WithinDuration(t, validFrom, *identityRole.ValidFrom, time.Millisecond)
+			} else {
+				assert.Nil(t, identityRole.ValidFrom)
+			}
+		}
+		// the role only grants its scopes within the validity window
+		hasScope, err := s.Application.PermissionService().HasScope(s.Ctx, pendingUser.IdentityID(), newSpace.SpaceID(), authorization.ContributeSpaceScope)
+		require.NoError(t, err)
+		assert.False(t, hasScope)
+		hasScope, err = s.Application.PermissionService().HasScope(s.Ctx, activeUser.IdentityID(), newSpace.SpaceID(), authorization.ContributeSpaceScope)
+		require.NoError(t, err)
+		assert.True(t, hasScope)
+		principals, err := s.service.ListPrincipalsByScope(s.Ctx, adminUser.IdentityID(), newSpace.SpaceID(), authorization.ContributeSpaceScope)
+		require.NoError(t, err)
+		var principalIDs []uuid.UUID
+		for _, principal := range principals {
+			principalIDs = append(principalIDs, principal.IdentityID)
+		}
+		assert.Contains(t, principalIDs, activeUser.IdentityID())
+		assert.NotContains(t, principalIDs, pendingUser.IdentityID())
+	})
+
+	s.T().Run("window over", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		adminUser := g.CreateUser()
+		newSpace := g.CreateSpace().AddAdmin(adminUser)
+		userToBeAssigned := g.CreateUser()
+		validUntil := time.Now().Add(-time.Hour)
+		// when
+		err := s.service.Assign(s.Ctx, adminUser.IdentityID(), map[string][]uuid.UUID{authorization.SpaceContributorRole: {userToBeAssigned.IdentityID()}}, newSpace.SpaceID(), true, role.Validity{ValidUntil: &validUntil})
+		// then
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'valid_until': '%s' - the end of the validity window must be in the future", validUntil.Format(time.RFC3339))
+	})
+
+	s.T().Run("window ends before it starts", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		adminUser := g.CreateUser()
+		newSpace := g.CreateSpace().AddAdmin(adminUser)
+		userToBeAssigned := g.CreateUser()
+		validFrom := time.Now().Add(2 * time.Hour)
+		validUntil := time.Now().Add(time.Hour)
+		// when
+		err := s.service.Assign(s.Ctx, adminUser.IdentityID(), map[string][]uuid.UUID{authorization.SpaceContributorRole: {userToBeAssigned.IdentityID()}}, newSpace.SpaceID(), true, role.Validity{ValidFrom: &validFrom, ValidUntil: &validUntil})
+		// then
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'valid_until': '%s' - the end of the validity window must be after its start", validUntil.Format(time.RFC3339))
+	})
+}
+
 func (s *roleManagementServiceBlackboxTest) TestAssignRoleAsAdminOK() {
 	g := s.DBTestSuite.NewTestGraph(s.T())
 	newSpace := g.CreateSpace()
@@ -549,7 +628,7 @@ func (s *roleManagementServiceBlackboxTest) TestPrivilegeCacheNotified() {
 
 	// Assign a role via the role management service Assign() function
 	assignments := map[string][]uuid.UUID{"barRole": {user.IdentityID()}}
-	err = s.Application.RoleManagementService().Assign(s.Ctx, admin.IdentityID(), assignments, res.ResourceID(), true)
+	err = s.Application.RoleManagementService().Assign(s.Ctx, admin.IdentityID(), assignments, res.ResourceID(), true, role.Validity{})
 	require.NoError(s.T(), err)
 
 	// Hit the privilege cache again
@@ -618,6 +697,228 @@ func (s *roleManagementServiceBlackboxTest) TestPrivilegeCacheNotified() {
 	require.Contains(s.T(), privs.ScopesAsArray(), "charlie")
 }
 
+func (s *roleManagementServiceBlackboxTest) TestListPrincipalsByScope() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		parentType := g.CreateResourceType()
+		childType := g.CreateResourceType()
+		childType.AddScope("test-scope")
+		childType.AddScope("view")
+		parentRole := g.CreateRole(parentType, "parent-role")
+		childRole := g.CreateRole(childType, "child-role").AddScope("test-scope")
+		otherChildRole := g.CreateRole(childType, "other-child-role").AddScope("other-scope")
+		viewerRole := g.CreateRole(childType, "viewer-role").AddScope("view")
+		parent := g.CreateResource(parentType)
+		child := g.CreateResource(parent, childType)
+		g.CreateRoleMapping(parent, parentRole, childRole)
+
+		viewer := g.CreateUser()
+		child.AddRole(viewer, viewerRole)
+		// a user with a role granting the scope
+		direct := g.CreateUser()
+		child.AddRole(direct, childRole)
+		// a user with a role for the parent resource, mapped to a role granting the scope
+		mapped := g.CreateUser()
+		parent.AddRole(mapped, parentRole)
+		// a user member of a team which belongs to an organization with a role granting the scope
+		member := g.CreateUser()
+		team := g.CreateTeam().AddMember(member)
+		org := g.CreateOrganization().AddMember(team)
+		child.AddRole(org, childRole)
+		// a user with a role which doesn't grant the scope
+		other := g.CreateUser()
+		child.AddRole(other, otherChildRole)
+
+		// when
+		principals, err := s.service.ListPrincipalsByScope(s.Ctx, viewer.IdentityID(), child.ResourceID(), "test-scope")
+
+		// then
+		require.NoError(t, err)
+		found := make(map[uuid.UUID]authorization.EffectivePrincipal)
+		for _, principal := range principals {
+			found[principal.IdentityID] = principal
+		}
+		require.Len(t, found, 5)
+		assert.NotContains(t, found, viewer.IdentityID())
+		assert.NotContains(t, found, other.IdentityID())
+
+		require.Contains(t, found, direct.IdentityID())
+		assert.Equal(t, direct.Identity().Username, found[direct.IdentityID()].Name)
+		assert.Equal(t, []authorization.ScopeGrant{{
+			AssigneeID:  direct.IdentityID(),
+			MemberOf:    []uuid.UUID{},
+			ResourceID:  child.ResourceID(),
+			Inherited:   false,
+			RoleName:    "child-role",
+			MappedRoles: []string{},
+		}}, found[direct.IdentityID()].Grants)
+
+		require.Contains(t, found, mapped.IdentityID())
+		assert.Equal(t, []authorization.ScopeGrant{{
+			AssigneeID:  mapped.IdentityID(),
+			MemberOf:    []uuid.UUID{},
+			ResourceID:  parent.ResourceID(),
+			Inherited:   true,
+			RoleName:    "parent-role",
+			MappedRoles: []string{"child-role"},
+		}}, found[mapped.IdentityID()].Grants)
+
+		require.Contains(t, found, org.OrganizationID())
+		assert.Equal(t, org.OrganizationName(), found[org.OrganizationID()].Name)
+		require.Contains(t, found, team.TeamID())
+		assert.Equal(t, []uuid.UUID{org.OrganizationID()}, found[team.TeamID()].Grants[0].MemberOf)
+		require.Contains(t, found, member.IdentityID())
+		assert.Equal(t, []authorization.ScopeGrant{{
+			AssigneeID:  org.OrganizationID(),
+			MemberOf:    []uuid.UUID{team.TeamID(), org.OrganizationID()},
+			ResourceID:  child.ResourceID(),
+			Inherited:   false,
+			RoleName:    "child-role",
+			MappedRoles: []string{},
+		}}, found[member.IdentityID()].Grants)
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		resourceType := g.CreateResourceType()
+		resourceType.AddScope("test-scope")
+		res := g.CreateResource(resourceType)
+		user := g.CreateUser()
+		// when
+		_, err := s.service.ListPrincipalsByScope(s.Ctx, user.IdentityID(), res.ResourceID(), "test-scope")
+		// then
+		testsupport.AssertError(t, err, errors.ForbiddenError{}, "identity with ID %s does not have required scope view for resource %s", user.IdentityID(), res.ResourceID())
+	})
+
+	s.T().Run("resource not found", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		resourceID := uuid.NewV4().String()
+		// when
+		_, err := s.service.ListPrincipalsByScope(s.Ctx, user.IdentityID(), resourceID, "test-scope")
+		// then
+		testsupport.AssertError(t, err, errors.NotFoundError{}, "resource with id '%s' not found", resourceID)
+	})
+}
+
+func (s *roleManagementServiceBlackboxTest) TestDeny() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		resourceType := g.CreateResourceType()
+		resourceType.AddScope("manage")
+		resourceType.AddScope("view")
+		resourceType.AddScope("test-scope")
+		resourceType.AddScope("other-scope")
+		adminRole := g.CreateRole(resourceType, "admin-role").AddScope("manage").AddScope("view")
+		role := g.CreateRole(resourceType, "test-role").AddScope("test-scope").AddScope("other-scope")
+		admin := g.CreateUser()
+		user := g.CreateUser()
+		team := g.CreateTeam().AddMember(user)
+		parent := g.CreateResource(resourceType).AddRole(team, role)
+		child := g.CreateResource(parent, resourceType).AddRole(admin, adminRole)
+		// load the privileges of the user before the denial, so that the cache is flagged as stale
+		privilegeCache, err := s.Application.PrivilegeCacheService().CachedPrivileges(s.Ctx, user.IdentityID(), child.ResourceID())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"test-scope", "other-scope"}, privilegeCache.ScopesAsArray())
+
+		// when
+		err = s.service.Deny(s.Ctx, admin.IdentityID(), map[string][]uuid.UUID{"test-scope": {team.TeamID()}}, child.ResourceID())
+
+		// then
+		require.NoError(t, err)
+		// the inherited grant is overridden for the members of the team
+		hasScope, err := s.Application.PermissionService().HasScope(s.Ctx, user.IdentityID(), child.ResourceID(), "test-scope")
+		require.NoError(t, err)
+		assert.False(t, hasScope)
+		hasScope, err = s.Application.PermissionService().HasScope(s.Ctx, user.IdentityID(), child.ResourceID(), "other-scope")
+		require.NoError(t, err)
+		assert.True(t, hasScope)
+		privilegeCache, err = s.Application.PrivilegeCacheService().CachedPrivileges(s.Ctx, user.IdentityID(), child.ResourceID())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"other-scope"}, privilegeCache.ScopesAsArray())
+		// but not for the parent resource
+		hasScope, err = s.Application.PermissionService().HasScope(s.Ctx, user.IdentityID(), parent.ResourceID(), "test-scope")
+		require.NoError(t, err)
+		assert.True(t, hasScope)
+		// and the denied identities are no longer principals of the scope
+		principals, err := s.service.ListPrincipalsByScope(s.Ctx, admin.IdentityID(), child.ResourceID(), "test-scope")
+		require.NoError(t, err)
+		assert.Empty(t, principals)
+
+		// when
+		denials, err := s.service.ListDenials(s.Ctx, admin.IdentityID(), child.ResourceID())
+		// then
+		require.NoError(t, err)
+		require.Len(t, denials, 1)
+		assert.Equal(t, team.TeamID(), denials[0].IdentityID)
+		assert.Equal(t, "test-scope", denials[0].ScopeName)
+
+		// when denying again the same scope, it is ignored
+		err = s.service.Deny(s.Ctx, admin.IdentityID(), map[string][]uuid.UUID{"test-scope": {team.TeamID()}}, child.ResourceID())
+		// then
+		require.NoError(t, err)
+
+		// when
+		err = s.service.RevokeDenial(s.Ctx, admin.IdentityID(), child.ResourceID(), denials[0].DenyAssignmentID)
+		// then
+		require.NoError(t, err)
+		hasScope, err = s.Application.PermissionService().HasScope(s.Ctx, user.IdentityID(), child.ResourceID(), "test-scope")
+		require.NoError(t, err)
+		assert.True(t, hasScope)
+		privilegeCache, err = s.Application.PrivilegeCacheService().CachedPrivileges(s.Ctx, user.IdentityID(), child.ResourceID())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"test-scope", "other-scope"}, privilegeCache.ScopesAsArray())
+	})
+
+	s.T().Run("unknown scope", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		space := g.CreateSpace()
+		admin := g.CreateUser()
+		space.AddAdmin(admin)
+		user := g.CreateUser()
+		// when
+		err := s.service.Deny(s.Ctx, admin.IdentityID(), map[string][]uuid.UUID{"unknown-scope": {user.IdentityID()}}, space.SpaceID())
+		// then
+		testsupport.AssertError(t, err, errors.BadParameterError{}, "Bad value for parameter 'scope': 'unknown-scope' - scope unknown-scope doesn't apply to the resources of type %s", authorization.ResourceTypeSpace)
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		space := g.CreateSpace()
+		user := g.CreateUser()
+		space.AddContributor(user)
+		// when
+		err := s.service.Deny(s.Ctx, user.IdentityID(), map[string][]uuid.UUID{authorization.ViewSpaceScope: {user.IdentityID()}}, space.SpaceID())
+		// then
+		testsupport.AssertError(t, err, errors.ForbiddenError{}, "identity with ID %s does not have required scope manage for resource %s", user.IdentityID(), space.SpaceID())
+	})
+
+	s.T().Run("revoke denial of another resource", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		space := g.CreateSpace()
+		admin := g.CreateUser()
+		space.AddAdmin(admin)
+		user := g.CreateUser()
+		otherResource := g.CreateResource().AddDenial(user, "test-scope")
+		denials, err := s.Application.DenyAssignmentRepository().FindByResource(s.Ctx, otherResource.ResourceID(), false)
+		require.NoError(t, err)
+		require.Len(t, denials, 1)
+		// when
+		err = s.service.RevokeDenial(s.Ctx, admin.IdentityID(), space.SpaceID(), denials[0].DenyAssignmentID)
+		// then
+		testsupport.AssertError(t, err, errors.NotFoundError{}, "deny_assignment with id '%s' not found", denials[0].DenyAssignmentID)
+	})
+}
+
 func validateAssignee(t *testing.T, amongUsers []uuid.UUID, resourceID string, returnedAssignedRoles []rolerepo.IdentityRole) {
 	for _, returnedAssignment := range returnedAssignedRoles {
 		require.Equal(t, resourceID, returnedAssignment.ResourceID)
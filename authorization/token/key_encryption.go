@@ -0,0 +1,74 @@
+package token
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// encryptedPrivateKeyPrefix marks the private keys encrypted by EncryptPrivateKey, as opposed to plain PEM keys
+	encryptedPrivateKeyPrefix = "aes256gcm:"
+	// EncryptionKeySize is the size of the key with which the private keys are encrypted
+	EncryptionKeySize = 32
+)
+
+// EncryptPrivateKey encrypts the given PEM encoded private key with AES-256-GCM and the given encryption key. The ID of
+// the private key is authenticated along with it, so that the encrypted key can't be swapped with another one.
+// The result holds the random nonce and the encrypted key.
+func EncryptPrivateKey(privateKey []byte, keyID string, encryptionKey []byte) (string, error) {
+	aead, err := newPrivateKeyCipher(encryptionKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to generate nonce")
+	}
+	encrypted := aead.Seal(nonce, nonce, privateKey, []byte(keyID))
+	return encryptedPrivateKeyPrefix + base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// DecryptPrivateKey decrypts the private key with the given ID which was encrypted by EncryptPrivateKey
+func DecryptPrivateKey(encryptedKey string, keyID string, encryptionKey []byte) ([]byte, error) {
+	if !IsEncryptedPrivateKey(encryptedKey) {
+		return nil, errors.New("private key is not encrypted")
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encryptedKey, encryptedPrivateKeyPrefix))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid encrypted private key")
+	}
+	aead, err := newPrivateKeyCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted) < aead.NonceSize() {
+		return nil, errors.New("invalid encrypted private key")
+	}
+	privateKey, err := aead.Open(nil, encrypted[:aead.NonceSize()], encrypted[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decrypt private key")
+	}
+	return privateKey, nil
+}
+
+// IsEncryptedPrivateKey returns true if the given private key was encrypted by EncryptPrivateKey
+func IsEncryptedPrivateKey(privateKey string) bool {
+	return strings.HasPrefix(privateKey, encryptedPrivateKeyPrefix)
+}
+
+func newPrivateKeyCipher(encryptionKey []byte) (cipher.AEAD, error) {
+	if len(encryptionKey) != EncryptionKeySize {
+		return nil, errors.Errorf("encryption key must be %d bytes long", EncryptionKeySize)
+	}
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create cipher")
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,207 @@
+package token
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	// AlgorithmRS256 is the algorithm of the tokens signed with RSA keys
+	AlgorithmRS256 = "RS256"
+	// AlgorithmES256 is the algorithm of the tokens signed with ECDSA P-256 keys
+	AlgorithmES256 = "ES256"
+	// AlgorithmEdDSA is the algorithm of the tokens signed with Ed25519 keys
+	AlgorithmEdDSA = "EdDSA"
+
+	// rsaKeyBits is the size of the generated RSA keys
+	rsaKeyBits = 2048
+	// ed25519SeedSize is the size of the seed from which an Ed25519 key pair is derived, as defined by RFC 8032
+	ed25519SeedSize = 32
+)
+
+// oidEd25519 is the object identifier of Ed25519 keys, as defined by RFC 8410.
+// The x509 package of the Go version in use does not support Ed25519 keys, so they are encoded and decoded here.
+var oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// pkcs8 reflects a PKCS#8 encoded private key
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// pkixPublicKey reflects a PKIX encoded public key
+type pkixPublicKey struct {
+	Algo      pkix.AlgorithmIdentifier
+	BitString asn1.BitString
+}
+
+// SigningMethod returns the method used to sign tokens with the private key matching the given public key
+func SigningMethod(key crypto.PublicKey) jwt.SigningMethod {
+	switch key.(type) {
+	case *ecdsa.PublicKey:
+		return jwt.SigningMethodES256
+	case ed25519.PublicKey:
+		return SigningMethodEdDSA
+	default:
+		return jwt.SigningMethodRS256
+	}
+}
+
+// GeneratePrivateKey generates a new private key for the given algorithm, which is one of
+// AlgorithmRS256, AlgorithmES256 or AlgorithmEdDSA
+func GeneratePrivateKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, errors.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+}
+
+// ParsePrivateKeyFromPEM parses a PEM encoded PKCS#1 RSA private key, SEC 1 ECDSA private key or PKCS#8 RSA, ECDSA
+// or Ed25519 private key. ECDSA keys must use the P-256 curve.
+func ParsePrivateKeyFromPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key must be PEM encoded")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = parsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, errors.Errorf("unsupported private key type: %s", block.Type)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse private key")
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.Errorf("unsupported ECDSA curve: %s", k.Curve.Params().Name)
+		}
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, errors.New("private key must be an RSA, ECDSA or Ed25519 key")
+	}
+}
+
+// ParsePublicKeyFromPEM parses a PEM encoded PKIX RSA, ECDSA or Ed25519 public key, PKCS#1 RSA public key or
+// certificate. ECDSA keys must use the P-256 curve.
+func ParsePublicKeyFromPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("public key must be PEM encoded")
+	}
+	var pki pkixPublicKey
+	if _, err := asn1.Unmarshal(block.Bytes, &pki); err == nil && pki.Algo.Algorithm.Equal(oidEd25519) {
+		if len(pki.BitString.Bytes) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key size")
+		}
+		return ed25519.PublicKey(pki.BitString.Bytes), nil
+	}
+	if rsaKey, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return rsaKey, nil
+	}
+	ecdsaKey, err := jwt.ParseECPublicKeyFromPEM(data)
+	if err != nil {
+		return nil, errors.New("public key must be an RSA, ECDSA or Ed25519 key")
+	}
+	if ecdsaKey.Curve != elliptic.P256() {
+		return nil, errors.Errorf("unsupported ECDSA curve: %s", ecdsaKey.Curve.Params().Name)
+	}
+	return ecdsaKey, nil
+}
+
+// MarshalPrivateKeyToPEM encodes the given private key in PEM format: PKCS#1 for RSA keys, SEC 1 for ECDSA keys and
+// PKCS#8 for Ed25519 keys
+func MarshalPrivateKeyToPEM(key crypto.Signer) ([]byte, error) {
+	var block *pem.Block
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to marshal private key")
+		}
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	case ed25519.PrivateKey:
+		// the private key is the seed of the key pair, wrapped in an octet string
+		seed, err := asn1.Marshal([]byte(k[:ed25519SeedSize]))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to marshal private key")
+		}
+		der, err := asn1.Marshal(pkcs8{
+			Algo:       pkix.AlgorithmIdentifier{Algorithm: oidEd25519},
+			PrivateKey: seed,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to marshal private key")
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	default:
+		return nil, errors.New("private key must be an RSA, ECDSA or Ed25519 key")
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// MarshalPKIXPublicKey encodes the given public key in PKIX, ASN.1 DER format
+func MarshalPKIXPublicKey(key crypto.PublicKey) ([]byte, error) {
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return x509.MarshalPKIXPublicKey(key)
+	}
+	return asn1.Marshal(pkixPublicKey{
+		Algo:      pkix.AlgorithmIdentifier{Algorithm: oidEd25519},
+		BitString: asn1.BitString{Bytes: edKey, BitLength: 8 * len(edKey)},
+	})
+}
+
+// parsePKCS8PrivateKey parses a PKCS#8 encoded Ed25519 private key, or any private key supported by the x509 package
+func parsePKCS8PrivateKey(der []byte) (interface{}, error) {
+	var privKey pkcs8
+	if _, err := asn1.Unmarshal(der, &privKey); err != nil {
+		return nil, err
+	}
+	if !privKey.Algo.Algorithm.Equal(oidEd25519) {
+		return x509.ParsePKCS8PrivateKey(der)
+	}
+	var seed []byte
+	if _, err := asn1.Unmarshal(privKey.PrivateKey, &seed); err != nil {
+		return nil, err
+	}
+	if len(seed) != ed25519SeedSize {
+		return nil, errors.New("invalid Ed25519 private key size")
+	}
+	// the key pair is derived from the seed
+	_, key, err := ed25519.GenerateKey(bytes.NewReader(seed))
+	return key, err
+}
@@ -2,8 +2,8 @@ package manager
 
 import (
 	"context"
-	"crypto/rsa"
-	"crypto/x509"
+	"crypto"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -38,8 +38,14 @@ var defaultErr error
 const (
 	//contextTokenManagerKey is a key that will be used to put and to get `tokenManager` from goa.context
 	contextTokenManagerKey = iota
+	//contextIDTokenRequestKey is a key that will be used to put and to get `IDTokenRequest` from goa.context
+	contextIDTokenRequestKey
 )
 
+// ExchangedTokenType is the value of the "typ" claim of the access tokens issued by token exchange. Unlike the
+// "Bearer" access tokens, they are only accepted by the service of their audience.
+const ExchangedTokenType = "Exchanged"
+
 // DefaultManager creates the default manager if it has not created yet.
 // This function must be called in main to make sure the default manager is created during service startup.
 // It will try to create the default manager only once even if called multiple times.
@@ -65,19 +71,29 @@ type TokenManagerConfiguration interface {
 
 // TokenClaims represents access token claims
 type TokenClaims struct {
-	Name          string         `json:"name"`
-	Username      string         `json:"preferred_username"`
-	GivenName     string         `json:"given_name"`
-	FamilyName    string         `json:"family_name"`
-	Email         string         `json:"email"`
-	EmailVerified bool           `json:"email_verified"`
-	Company       string         `json:"company"`
-	SessionState  string         `json:"session_state"`
-	Approved      bool           `json:"approved"`
-	Permissions   *[]Permissions `json:"permissions"`
+	Name            string         `json:"name"`
+	Username        string         `json:"preferred_username"`
+	GivenName       string         `json:"given_name"`
+	FamilyName      string         `json:"family_name"`
+	Email           string         `json:"email"`
+	EmailVerified   bool           `json:"email_verified"`
+	Company         string         `json:"company"`
+	SessionState    string         `json:"session_state"`
+	Approved        bool           `json:"approved"`
+	Permissions     *[]Permissions `json:"permissions"`
+	Nonce           string         `json:"nonce,omitempty"`
+	AccessTokenHash string         `json:"at_hash,omitempty"`
+	Actor           *Actor         `json:"act,omitempty"`
 	jwt.StandardClaims
 }
 
+// Actor represents an "act" claim, which identifies the party acting on behalf of the subject of a token issued by
+// token exchange, as defined by RFC 8693. The prior actors of a delegation chain are nested.
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
+}
+
 // Permissions represents a "permissions" claim in the AuthorizationPayload
 type Permissions struct {
 	ResourceSetName *string  `json:"resource_set_name"`
@@ -162,6 +178,30 @@ func ReadTokenManagerFromContext(ctx context.Context) (TokenManager, error) {
 	return tm.(*tokenManager), nil
 }
 
+// IDTokenRequest represents the parameters of an OpenID Connect ID token which should be issued along with a user token
+type IDTokenRequest struct {
+	// ClientID is the client to which the ID token is issued, used as the audience of the ID token
+	ClientID string
+	// Nonce is the value provided by the client in the authorization request, if any
+	Nonce *string
+	// AuthTime is the time when the user authenticated with the authentication provider, if known
+	AuthTime *time.Time
+}
+
+// ContextWithIDTokenRequest returns a new context with an ID token request, so that an ID token for the given client
+// and nonce is issued along with the user token
+func ContextWithIDTokenRequest(ctx context.Context, clientID string, nonce *string, authTime *time.Time) context.Context {
+	return context.WithValue(ctx, contextIDTokenRequestKey, &IDTokenRequest{ClientID: clientID, Nonce: nonce, AuthTime: authTime})
+}
+
+// ReadIDTokenRequestFromContext extracts the ID token request from the context. Returns nil if no ID token was requested
+func ReadIDTokenRequestFromContext(ctx context.Context) *IDTokenRequest {
+	if idTokenRequest, ok := ctx.Value(contextIDTokenRequestKey).(*IDTokenRequest); ok {
+		return idTokenRequest
+	}
+	return nil
+}
+
 // InjectTokenManager is a middleware responsible for setting up tokenManager in the context for every request.
 func InjectTokenManager(tokenManager TokenManager) goa.Middleware {
 	return func(h goa.Handler) goa.Handler {
@@ -181,11 +221,11 @@ func InjectTokenManager(tokenManager TokenManager) goa.Middleware {
 // TokenManager generates and manages auth tokens
 type TokenManager interface {
 	Parse(ctx context.Context, tokenString string) (*jwt.Token, error)
-	PublicKeys() []*rsa.PublicKey
+	PublicKeys() []crypto.PublicKey
 	Locate(ctx context.Context) (uuid.UUID, error)
 	ParseToken(ctx context.Context, tokenString string) (*TokenClaims, error)
 	ParseTokenWithMapClaims(ctx context.Context, tokenString string) (jwt.MapClaims, error)
-	PublicKey(keyID string) *rsa.PublicKey
+	PublicKey(keyID string) crypto.PublicKey
 	JSONWebKeys() token.JSONKeys
 	PemKeys() token.JSONKeys
 	KeyFunction(context.Context) jwt.Keyfunc
@@ -194,19 +234,34 @@ type TokenManager interface {
 	GenerateUnsignedServiceAccountToken(saID string, saName string) *jwt.Token
 	GenerateUserTokenForAPIClient(ctx context.Context, providerToken oauth2.Token) (*oauth2.Token, error)
 	GenerateUserTokenForIdentity(ctx context.Context, identity repository.Identity, offlineToken bool) (*oauth2.Token, error)
+	GenerateUnsignedUserIDTokenForIdentity(ctx context.Context, identity repository.Identity, clientID string, nonce *string, authTime *time.Time, accessToken string) (*jwt.Token, error)
 	GenerateUserTokenUsingRefreshToken(ctx context.Context, refreshTokenString string, identity *repository.Identity, permissions []Permissions) (*oauth2.Token, error)
 	GenerateUnsignedRPTTokenForIdentity(ctx context.Context, tokenClaims *TokenClaims, identity repository.Identity, permissions *[]Permissions) (*jwt.Token, error)
+	GenerateUnsignedExchangedTokenForIdentity(ctx context.Context, tokenClaims *TokenClaims, identity repository.Identity, actor Actor, permissions []Permissions) (*jwt.Token, error)
 	SignRPTToken(ctx context.Context, rptToken *jwt.Token) (string, error)
 	ConvertTokenSet(tokenSet TokenSet) *oauth2.Token
 	ConvertToken(oauthToken oauth2.Token) (*TokenSet, error)
 	AddLoginRequiredHeaderToUnauthorizedError(err error, rw http.ResponseWriter)
 	AddLoginRequiredHeader(rw http.ResponseWriter)
 	AuthServiceAccountSigner() client.Signer
+	LoadKeySet(keySet KeySet) error
+}
+
+// KeySet represents the keys used by the token manager. The private keys are used to sign new tokens, while all the
+// public keys are published and accepted when verifying tokens, so that the tokens which were signed with a key being
+// rotated remain valid.
+type KeySet struct {
+	UserAccountPrivateKey    *token.PrivateKey
+	ServiceAccountPrivateKey *token.PrivateKey
+	PublicKeys               []*token.PublicKey
 }
 
 type tokenManager struct {
-	publicKeysMap            map[string]*rsa.PublicKey
+	// keysLock protects the keys and the service account token, which are replaced when the keys are rotated
+	keysLock                 sync.RWMutex
+	publicKeysMap            map[string]crypto.PublicKey
 	publicKeys               []*token.PublicKey
+	devModePublicKey         *token.PublicKey
 	serviceAccountPrivateKey *token.PrivateKey
 	userAccountPrivateKey    *token.PrivateKey
 	jsonWebKeys              token.JSONKeys
@@ -218,25 +273,26 @@ type tokenManager struct {
 // NewTokenManager returns a new token Manager for handling tokens
 func NewTokenManager(config TokenManagerConfiguration) (TokenManager, error) {
 	tm := &tokenManager{
-		publicKeysMap: map[string]*rsa.PublicKey{},
+		publicKeysMap: map[string]crypto.PublicKey{},
 	}
 	tm.config = config
 
-	// Load the user account private key and add it to the manager.
-	// Extract the public key from it and add it to the map of public keys.
+	// Load the user account private key and add it to the key set.
+	// Extract the public key from it and add it to the public keys of the key set.
 	var err error
+	keySet := KeySet{}
 	key, kid := config.GetUserAccountPrivateKey()
 	deprecatedKey, deprecatedKid := config.GetDeprecatedUserAccountPrivateKey()
-	tm.userAccountPrivateKey, err = tm.loadPrivateKey(tm, key, kid, deprecatedKey, deprecatedKid)
+	keySet.UserAccountPrivateKey, err = tm.loadPrivateKey(&keySet, key, kid, deprecatedKey, deprecatedKid)
 	if err != nil {
 		log.Error(nil, map[string]interface{}{"err": err}, "unable to load user account private keys")
 		return nil, err
 	}
-	// Load the service account private key and add it to the manager.
-	// Extract the public key from it and add it to the map of public keys.
+	// Load the service account private key and add it to the key set.
+	// Extract the public key from it and add it to the public keys of the key set.
 	key, kid = config.GetServiceAccountPrivateKey()
 	deprecatedKey, deprecatedKid = config.GetDeprecatedServiceAccountPrivateKey()
-	tm.serviceAccountPrivateKey, err = tm.loadPrivateKey(tm, key, kid, deprecatedKey, deprecatedKid)
+	keySet.ServiceAccountPrivateKey, err = tm.loadPrivateKey(&keySet, key, kid, deprecatedKey, deprecatedKid)
 	if err != nil {
 		log.Error(nil, map[string]interface{}{"err": err}, "unable to load service account private keys")
 		return nil, err
@@ -245,35 +301,127 @@ func NewTokenManager(config TokenManagerConfiguration) (TokenManager, error) {
 	// Load Keycloak public key if run in dev mode.
 	devMode, key, kid := config.GetDevModePublicKey()
 	if devMode {
-		rsaKey, err := jwt.ParseRSAPublicKeyFromPEM(key)
+		publicKey, err := token.ParsePublicKeyFromPEM(key)
 		if err != nil {
 			log.Error(nil, map[string]interface{}{"err": err}, "unable to load dev mode public key")
 			return nil, err
 		}
-		tm.publicKeysMap[kid] = rsaKey
-		tm.publicKeys = append(tm.publicKeys, &token.PublicKey{KeyID: kid, Key: rsaKey})
+		tm.devModePublicKey = &token.PublicKey{KeyID: kid, Key: publicKey}
 		log.Info(nil, map[string]interface{}{"kid": kid}, "dev mode public key added")
 	}
 
+	err = tm.LoadKeySet(keySet)
+	if err != nil {
+		return nil, err
+	}
+
+	return tm, nil
+}
+
+// LoadKeySet replaces the keys used by the token manager with the given key set, so that the keys can be rotated
+// without restarting the service. The public keys of the private keys are always published, as well as the dev mode
+// public key if any.
+func (m *tokenManager) LoadKeySet(keySet KeySet) error {
+	if keySet.UserAccountPrivateKey == nil || keySet.ServiceAccountPrivateKey == nil {
+		log.Error(nil, map[string]interface{}{}, "user account or service account private key is missing in the key set")
+		return errors.New("user account or service account private key is missing in the key set")
+	}
+	publicKeys := make([]*token.PublicKey, 0, len(keySet.PublicKeys)+3)
+	publicKeysMap := map[string]crypto.PublicKey{}
+	addPublicKey := func(key *token.PublicKey) {
+		if _, found := publicKeysMap[key.KeyID]; !found {
+			publicKeysMap[key.KeyID] = key.Key
+			publicKeys = append(publicKeys, key)
+		}
+	}
+	for _, key := range keySet.PublicKeys {
+		addPublicKey(key)
+	}
+	addPublicKey(keySet.UserAccountPrivateKey.PublicKey())
+	addPublicKey(keySet.ServiceAccountPrivateKey.PublicKey())
+	if m.devModePublicKey != nil {
+		addPublicKey(m.devModePublicKey)
+	}
+
 	// Convert public keys to JWK format
-	jsonWebKeys, err := tm.toJSONWebKeys(tm.publicKeys)
+	jsonWebKeys, err := m.toJSONWebKeys(publicKeys)
 	if err != nil {
 		log.Error(nil, map[string]interface{}{"err": err}, "unable to convert public keys to JSON Web Keys")
-		return nil, errors.New("unable to convert public keys to JSON Web Keys")
+		return errors.New("unable to convert public keys to JSON Web Keys")
 	}
-	tm.jsonWebKeys = jsonWebKeys
 
 	// Convert public keys to PEM format
-	jsonKeys, err := tm.toPemKeys(tm.publicKeys)
+	pemKeys, err := m.toPemKeys(publicKeys)
 	if err != nil {
 		log.Error(nil, map[string]interface{}{"err": err}, "unable to convert public keys to PEM Keys")
-		return nil, errors.New("unable to convert public keys to PEM Keys")
-	}
-	tm.pemKeys = jsonKeys
+		return errors.New("unable to convert public keys to PEM Keys")
+	}
+
+	m.keysLock.Lock()
+	m.userAccountPrivateKey = keySet.UserAccountPrivateKey
+	m.serviceAccountPrivateKey = keySet.ServiceAccountPrivateKey
+	m.publicKeys = publicKeys
+	m.publicKeysMap = publicKeysMap
+	m.jsonWebKeys = jsonWebKeys
+	m.pemKeys = pemKeys
+	m.keysLock.Unlock()
+	log.Info(nil, map[string]interface{}{
+		"user_account_kid":    keySet.UserAccountPrivateKey.KeyID,
+		"service_account_kid": keySet.ServiceAccountPrivateKey.KeyID,
+		"public_keys":         len(publicKeys),
+	}, "key set loaded")
+
+	_, err = m.initServiceAccountToken()
+	return err
+}
 
-	tm.initServiceAccountToken()
+// userAccountKey returns the private key which is currently used to sign user tokens
+func (m *tokenManager) userAccountKey() *token.PrivateKey {
+	m.keysLock.RLock()
+	defer m.keysLock.RUnlock()
+	return m.userAccountPrivateKey
+}
 
-	return tm, nil
+// serviceAccountKey returns the private key which is currently used to sign service account tokens
+func (m *tokenManager) serviceAccountKey() *token.PrivateKey {
+	m.keysLock.RLock()
+	defer m.keysLock.RUnlock()
+	return m.serviceAccountPrivateKey
+}
+
+// newUserAccountToken returns a new token to be signed with the current user account key
+func (m *tokenManager) newUserAccountToken() *jwt.Token {
+	key := m.userAccountKey()
+	token := jwt.New(key.SigningMethod())
+	token.Header["kid"] = key.KeyID
+	return token
+}
+
+// newServiceAccountToken returns a new token to be signed with the current service account key
+func (m *tokenManager) newServiceAccountToken() *jwt.Token {
+	key := m.serviceAccountKey()
+	token := jwt.New(key.SigningMethod())
+	token.Header["kid"] = key.KeyID
+	return token
+}
+
+// signWithUserAccountKey signs the given token with the current user account key. The "kid" header and the signing
+// method of the token are updated in case the key has been rotated since the token was generated.
+func (m *tokenManager) signWithUserAccountKey(token *jwt.Token) (string, error) {
+	return signWithKey(token, m.userAccountKey())
+}
+
+// signWithServiceAccountKey signs the given token with the current service account key. The "kid" header and the
+// signing method of the token are updated in case the key has been rotated since the token was generated.
+func (m *tokenManager) signWithServiceAccountKey(token *jwt.Token) (string, error) {
+	return signWithKey(token, m.serviceAccountKey())
+}
+
+func signWithKey(token *jwt.Token, key *token.PrivateKey) (string, error) {
+	token.Method = key.SigningMethod()
+	token.Header["alg"] = token.Method.Alg()
+	token.Header["kid"] = key.KeyID
+	return token.SignedString(key.Key)
 }
 
 // #####################################################################################################################
@@ -285,7 +433,7 @@ func NewTokenManager(config TokenManagerConfiguration) (TokenManager, error) {
 // GenerateServiceAccountToken generates and signs a new Service Account Token (Protection API Token)
 func (m *tokenManager) GenerateServiceAccountToken(saID string, saName string) (string, error) {
 	token := m.GenerateUnsignedServiceAccountToken(saID, saName)
-	tokenStr, err := token.SignedString(m.serviceAccountPrivateKey.Key)
+	tokenStr, err := m.signWithServiceAccountKey(token)
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
@@ -294,8 +442,7 @@ func (m *tokenManager) GenerateServiceAccountToken(saID string, saName string) (
 
 // GenerateUnsignedServiceAccountToken generates an unsigned Service Account Token (Protection API Token)
 func (m *tokenManager) GenerateUnsignedServiceAccountToken(saID string, saName string) *jwt.Token {
-	token := jwt.New(jwt.SigningMethodRS256)
-	token.Header["kid"] = m.serviceAccountPrivateKey.KeyID
+	token := m.newServiceAccountToken()
 	claims := token.Claims.(jwt.MapClaims)
 	claims["service_accountname"] = saName
 	claims["sub"] = saID
@@ -313,6 +460,8 @@ func (m *tokenManager) AuthServiceAccountSigner() client.Signer {
 
 // AuthServiceAccountToken returns the service account token which authenticates the Auth service
 func (m *tokenManager) AuthServiceAccountToken() string {
+	m.keysLock.RLock()
+	defer m.keysLock.RUnlock()
 	return m.serviceAccountToken
 }
 
@@ -322,14 +471,15 @@ func (m *tokenManager) AuthServiceAccountToken() string {
 //
 // #####################################################################################################################
 
-// GenerateUserTokenForIdentity generates an OAuth2 user token for the given identity
+// GenerateUserTokenForIdentity generates an OAuth2 user token for the given identity.
+// If an ID token has been requested in the context then an OpenID Connect ID token is returned in the "id_token" extra
 func (m *tokenManager) GenerateUserTokenForIdentity(ctx context.Context, identity repository.Identity, offlineToken bool) (*oauth2.Token, error) {
 	nowTime := time.Now().Unix()
 	unsignedAccessToken, err := m.GenerateUnsignedUserAccessTokenForIdentity(ctx, identity)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	accessToken, err := unsignedAccessToken.SignedString(m.userAccountPrivateKey.Key)
+	accessToken, err := m.signWithUserAccountKey(unsignedAccessToken)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -337,7 +487,7 @@ func (m *tokenManager) GenerateUserTokenForIdentity(ctx context.Context, identit
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	refreshToken, err := unsignedRefreshToken.SignedString(m.userAccountPrivateKey.Key)
+	refreshToken, err := m.signWithUserAccountKey(unsignedRefreshToken)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -357,11 +507,76 @@ func (m *tokenManager) GenerateUserTokenForIdentity(ctx context.Context, identit
 	extra["refresh_expires_in"] = m.config.GetRefreshTokenExpiresIn()
 	extra["not_before_policy"] = nbf
 
+	if idTokenRequest := ReadIDTokenRequestFromContext(ctx); idTokenRequest != nil {
+		unsignedIDToken, err := m.GenerateUnsignedUserIDTokenForIdentity(ctx, identity, idTokenRequest.ClientID, idTokenRequest.Nonce, idTokenRequest.AuthTime, accessToken)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		idToken, err := m.signWithUserAccountKey(unsignedIDToken)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		extra["id_token"] = idToken
+	}
+
 	token = token.WithExtra(extra)
 
 	return token, nil
 }
 
+// #####################################################################################################################
+//
+// ID Token functions (ID tokens are OpenID Connect tokens describing the authentication of a user to a client)
+//
+// #####################################################################################################################
+
+// GenerateUnsignedUserIDTokenForIdentity generates an unsigned OpenID Connect ID token for the given identity, issued to
+// the given client. The at_hash claim binds the ID token to the access token issued along with it, and the auth_time
+// claim is set if the time when the user authenticated is known.
+// See http://openid.net/specs/openid-connect-core-1_0.html#IDToken
+func (m *tokenManager) GenerateUnsignedUserIDTokenForIdentity(ctx context.Context, identity repository.Identity, clientID string, nonce *string, authTime *time.Time, accessToken string) (*jwt.Token, error) {
+	token := m.newUserAccountToken()
+
+	req := goa.ContextRequest(ctx)
+	if req == nil {
+		return nil, errors.New("missing request in context")
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	claims["jti"] = uuid.NewV4().String()
+	iat := time.Now().Unix()
+	claims["exp"] = iat + m.config.GetAccessTokenExpiresIn()
+	claims["iat"] = iat
+	claims["iss"] = rest.AbsoluteURL(req, "", m.config)
+	claims["aud"] = clientID
+	claims["azp"] = clientID
+	claims["typ"] = "ID"
+	if authTime != nil {
+		claims["auth_time"] = authTime.Unix()
+	}
+	claims["at_hash"] = accessTokenHash(accessToken)
+	if nonce != nil {
+		claims["nonce"] = *nonce
+	}
+	claims["sub"] = identity.ID.String()
+	claims["email_verified"] = identity.User.EmailVerified
+	claims["name"] = identity.User.FullName
+	claims["preferred_username"] = identity.Username
+	firstName, lastName := account.SplitFullName(identity.User.FullName)
+	claims["given_name"] = firstName
+	claims["family_name"] = lastName
+	claims["email"] = identity.User.Email
+	claims["company"] = identity.User.Company
+	return token, nil
+}
+
+// accessTokenHash returns the at_hash value for the given access token, which is the base64url encoding of the
+// left-most half of the SHA-256 hash of the access token
+func accessTokenHash(accessToken string) string {
+	hash := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(hash[:len(hash)/2])
+}
+
 // #####################################################################################################################
 //
 // RPT Token functions (RPT tokens are an access token with an additional "permissions" claim
@@ -383,9 +598,29 @@ func (m *tokenManager) GenerateUnsignedRPTTokenForIdentity(ctx context.Context,
 	return unsignedRPTtoken, nil
 }
 
+// GenerateUnsignedExchangedTokenForIdentity generates a JWT access token issued by token exchange for the given
+// identity, as defined by RFC 8693. The audience and the expiry of the token are taken from the given claims, the
+// token only contains the given permissions and its "act" claim identifies the given actor.
+func (m *tokenManager) GenerateUnsignedExchangedTokenForIdentity(ctx context.Context, tokenClaims *TokenClaims, identity repository.Identity, actor Actor, permissions []Permissions) (*jwt.Token, error) {
+	exchangedToken, err := m.GenerateUnsignedUserAccessTokenFromClaims(ctx, tokenClaims, &identity)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := exchangedToken.Claims.(jwt.MapClaims)
+	claims["typ"] = ExchangedTokenType
+	claims["permissions"] = permissions
+	claims["act"] = actor
+	// the token is authorized to the acting client, not to the audience
+	claims["azp"] = actor.Subject
+	claims["client_id"] = actor.Subject
+
+	return exchangedToken, nil
+}
+
 // SignRPTToken generates a signature for the specified rpt token and returns it
 func (mgm *tokenManager) SignRPTToken(ctx context.Context, rptToken *jwt.Token) (string, error) {
-	return rptToken.SignedString(mgm.userAccountPrivateKey.Key)
+	return mgm.signWithUserAccountKey(rptToken)
 }
 
 // #####################################################################################################################
@@ -396,8 +631,7 @@ func (mgm *tokenManager) SignRPTToken(ctx context.Context, rptToken *jwt.Token)
 
 // GenerateUnsignedUserAccessTokenFromClaims generates a new token based on the specified claims
 func (m *tokenManager) GenerateUnsignedUserAccessTokenFromClaims(ctx context.Context, tokenClaims *TokenClaims, identity *repository.Identity) (*jwt.Token, error) {
-	token := jwt.New(jwt.SigningMethodRS256)
-	token.Header["kid"] = m.userAccountPrivateKey.KeyID
+	token := m.newUserAccountToken()
 
 	claims := token.Claims.(jwt.MapClaims)
 	claims["jti"] = uuid.NewV4().String()
@@ -472,8 +706,7 @@ func (m *tokenManager) GenerateUnsignedUserAccessTokenFromClaims(ctx context.Con
 
 // GenerateUnsignedUserAccessTokenForIdentity generates an unsigned OAuth2 user access token for the given identity
 func (m *tokenManager) GenerateUnsignedUserAccessTokenForIdentity(ctx context.Context, identity repository.Identity) (*jwt.Token, error) {
-	token := jwt.New(jwt.SigningMethodRS256)
-	token.Header["kid"] = m.userAccountPrivateKey.KeyID
+	token := m.newUserAccountToken()
 
 	req := goa.ContextRequest(ctx)
 	if req == nil {
@@ -521,8 +754,7 @@ func (m *tokenManager) GenerateUnsignedUserAccessTokenForIdentity(ctx context.Co
 
 // GenerateUnsignedUserRefreshTokenForIdentity generates an unsigned OAuth2 user refresh token for the given identity
 func (m *tokenManager) GenerateUnsignedUserRefreshTokenForIdentity(ctx context.Context, identity repository.Identity, offlineToken bool) (*jwt.Token, error) {
-	token := jwt.New(jwt.SigningMethodRS256)
-	token.Header["kid"] = m.userAccountPrivateKey.KeyID
+	token := m.newUserAccountToken()
 
 	req := goa.ContextRequest(ctx)
 	if req == nil {
@@ -560,8 +792,7 @@ func (m *tokenManager) GenerateUnsignedUserRefreshTokenForIdentity(ctx context.C
 // TODO combine this with GenerateUnsignedUserRefreshTokenForIdentity, make previous refreshToken parameter optional
 // GenerateUnsignedUserRefreshToken generates an unsigned OAuth2 user refresh token for the given identity based on the provided refresh token
 func (m *tokenManager) GenerateUnsignedUserRefreshToken(ctx context.Context, refreshToken string, identity *repository.Identity) (*jwt.Token, error) {
-	token := jwt.New(jwt.SigningMethodRS256)
-	token.Header["kid"] = m.userAccountPrivateKey.KeyID
+	token := m.newUserAccountToken()
 
 	oldClaims, err := m.ParseToken(ctx, refreshToken)
 	if err != nil {
@@ -617,8 +848,7 @@ func (m *tokenManager) GenerateUnsignedUserRefreshToken(ctx context.Context, ref
 
 // GenerateUnsignedUserAccessTokenFromRefreshToken
 func (m *tokenManager) GenerateUnsignedUserAccessTokenFromRefreshToken(ctx context.Context, refreshTokenString string, identity *repository.Identity) (*jwt.Token, error) {
-	token := jwt.New(jwt.SigningMethodRS256)
-	token.Header["kid"] = m.userAccountPrivateKey.KeyID
+	token := m.newUserAccountToken()
 
 	req := goa.ContextRequest(ctx)
 	if req == nil {
@@ -711,7 +941,7 @@ func (m *tokenManager) GenerateUserTokenUsingRefreshToken(ctx context.Context, r
 		claims["permissions"] = permissions
 	}
 
-	accessToken, err := unsignedAccessToken.SignedString(m.userAccountPrivateKey.Key)
+	accessToken, err := m.signWithUserAccountKey(unsignedAccessToken)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -719,7 +949,7 @@ func (m *tokenManager) GenerateUserTokenUsingRefreshToken(ctx context.Context, r
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	refreshToken, err := unsignedRefreshToken.SignedString(m.userAccountPrivateKey.Key)
+	refreshToken, err := m.signWithUserAccountKey(unsignedRefreshToken)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -756,7 +986,7 @@ func (m *tokenManager) GenerateUserTokenForAPIClient(ctx context.Context, provid
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	accessToken, err := unsignedAccessToken.SignedString(m.userAccountPrivateKey.Key)
+	accessToken, err := m.signWithUserAccountKey(unsignedAccessToken)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -764,7 +994,7 @@ func (m *tokenManager) GenerateUserTokenForAPIClient(ctx context.Context, provid
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	refreshToken, err := unsignedRefreshToken.SignedString(m.userAccountPrivateKey.Key)
+	refreshToken, err := m.signWithUserAccountKey(unsignedRefreshToken)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -808,8 +1038,7 @@ func (m *tokenManager) GenerateUnsignedUserAccessTokenForAPIClient(ctx context.C
 
 // GenerateUnsignedUserAccessTokenFromClaimsForAPIClient generates a new token based on the specified claims for api_client
 func (m *tokenManager) GenerateUnsignedUserAccessTokenFromClaimsForAPIClient(ctx context.Context, tokenClaims *TokenClaims) (*jwt.Token, error) {
-	token := jwt.New(jwt.SigningMethodRS256)
-	token.Header["kid"] = m.userAccountPrivateKey.KeyID
+	token := m.newUserAccountToken()
 
 	req := goa.ContextRequest(ctx)
 	if req == nil {
@@ -873,8 +1102,7 @@ func (m *tokenManager) GenerateUnsignedUserAccessTokenFromClaimsForAPIClient(ctx
 
 // GenerateUnsignedUserRefreshToken generates an unsigned OAuth2 user refresh token for the given identity based on the Keycloak token
 func (m *tokenManager) GenerateUnsignedUserRefreshTokenForAPIClient(ctx context.Context, accessToken string) (*jwt.Token, error) {
-	token := jwt.New(jwt.SigningMethodRS256)
-	token.Header["kid"] = m.userAccountPrivateKey.KeyID
+	token := m.newUserAccountToken()
 
 	tokenClaims, err := m.ParseToken(ctx, accessToken)
 	if err != nil {
@@ -929,13 +1157,16 @@ func (m *tokenManager) GenerateUnsignedUserRefreshTokenForAPIClient(ctx context.
 
 // JSONWebKeys returns all the public keys in JSON Web Keys format
 func (mgm *tokenManager) JSONWebKeys() token.JSONKeys {
+	mgm.keysLock.RLock()
+	defer mgm.keysLock.RUnlock()
 	return mgm.jsonWebKeys
 }
 
-// KeyFunction returns a function that can be used to extract the key ID (kid) claim value from a JWT token
+// KeyFunction returns a function that can be used to extract the key ID (kid) claim value from a JWT token. The tokens
+// whose algorithm (alg) is not the one of the key with this ID are rejected, since keys of different types are in use.
 func (m *tokenManager) KeyFunction(ctx context.Context) jwt.Keyfunc {
-	return func(token *jwt.Token) (interface{}, error) {
-		kid := token.Header["kid"]
+	return func(jwtToken *jwt.Token) (interface{}, error) {
+		kid := jwtToken.Header["kid"]
 		if kid == nil {
 			log.Error(ctx, map[string]interface{}{}, "There is no 'kid' header in the token")
 			return nil, errors.New("There is no 'kid' header in the token")
@@ -947,6 +1178,13 @@ func (m *tokenManager) KeyFunction(ctx context.Context) jwt.Keyfunc {
 			}, "There is no public key with such ID")
 			return nil, errors.New(fmt.Sprintf("There is no public key with such ID: %s", kid))
 		}
+		if alg := token.SigningMethod(key).Alg(); jwtToken.Method == nil || jwtToken.Method.Alg() != alg {
+			log.Error(ctx, map[string]interface{}{
+				"kid": kid,
+				"alg": jwtToken.Header["alg"],
+			}, "The signing algorithm of the token doesn't match the public key")
+			return nil, errors.New(fmt.Sprintf("The signing algorithm of the token doesn't match the public key with ID %s: %v", kid, jwtToken.Header["alg"]))
+		}
 		return key, nil
 	}
 }
@@ -1011,17 +1249,23 @@ func (m *tokenManager) ParseTokenWithMapClaims(ctx context.Context, tokenString
 
 // PemKeys returns all the public keys in PEM-like format (PEM without header and footer)
 func (m *tokenManager) PemKeys() token.JSONKeys {
+	m.keysLock.RLock()
+	defer m.keysLock.RUnlock()
 	return m.pemKeys
 }
 
 // PublicKey returns the public key by the ID
-func (m *tokenManager) PublicKey(keyID string) *rsa.PublicKey {
+func (m *tokenManager) PublicKey(keyID string) crypto.PublicKey {
+	m.keysLock.RLock()
+	defer m.keysLock.RUnlock()
 	return m.publicKeysMap[keyID]
 }
 
 // PublicKeys returns all the public keys
-func (m *tokenManager) PublicKeys() []*rsa.PublicKey {
-	keys := make([]*rsa.PublicKey, 0, len(m.publicKeysMap))
+func (m *tokenManager) PublicKeys() []crypto.PublicKey {
+	m.keysLock.RLock()
+	defer m.keysLock.RUnlock()
+	keys := make([]crypto.PublicKey, 0, len(m.publicKeysMap))
 	for _, key := range m.publicKeys {
 		keys = append(keys, key.Key)
 	}
@@ -1125,9 +1369,9 @@ func (m *tokenManager) extraInt(oauthToken oauth2.Token, claimName string) (*int
 }
 
 // LoadPrivateKey loads a private key and a deprecated private key.
-// Extracts public keys from them and adds them to the manager
+// Extracts public keys from them and adds them to the key set
 // Returns the loaded private key.
-func (m *tokenManager) loadPrivateKey(tm *tokenManager, key []byte, kid string, deprecatedKey []byte, deprecatedKid string) (*token.PrivateKey, error) {
+func (m *tokenManager) loadPrivateKey(keySet *KeySet, key []byte, kid string, deprecatedKey []byte, deprecatedKid string) (*token.PrivateKey, error) {
 	if len(key) == 0 || kid == "" {
 		log.Error(nil, map[string]interface{}{
 			"kid":        kid,
@@ -1137,16 +1381,14 @@ func (m *tokenManager) loadPrivateKey(tm *tokenManager, key []byte, kid string,
 	}
 
 	// Load the private key. Extract the public key from it
-	rsaServiceAccountKey, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+	signer, err := token.ParsePrivateKeyFromPEM(key)
 	if err != nil {
 		log.Error(nil, map[string]interface{}{"err": err}, "unable to parse private key")
 		return nil, err
 	}
-	privateKey := &token.PrivateKey{KeyID: kid, Key: rsaServiceAccountKey}
-	pk := &rsaServiceAccountKey.PublicKey
-	tm.publicKeysMap[kid] = pk
-	tm.publicKeys = append(tm.publicKeys, &token.PublicKey{KeyID: kid, Key: pk})
-	log.Info(nil, map[string]interface{}{"kid": kid}, "public key added")
+	privateKey := &token.PrivateKey{KeyID: kid, Key: signer}
+	keySet.PublicKeys = append(keySet.PublicKeys, privateKey.PublicKey())
+	log.Info(nil, map[string]interface{}{"kid": kid, "alg": privateKey.SigningMethod().Alg()}, "public key added")
 
 	// Extract public key from the deprecated key if any and add it to the manager
 	if len(deprecatedKey) == 0 || deprecatedKid == "" {
@@ -1155,14 +1397,12 @@ func (m *tokenManager) loadPrivateKey(tm *tokenManager, key []byte, kid string,
 			"key_length": len(deprecatedKey),
 		}, "no deprecated private key found")
 	} else {
-		rsaServiceAccountKey, err := jwt.ParseRSAPrivateKeyFromPEM(deprecatedKey)
+		signer, err := token.ParsePrivateKeyFromPEM(deprecatedKey)
 		if err != nil {
 			log.Error(nil, map[string]interface{}{"err": err}, "unable to parse deprecated private key")
 			return nil, err
 		}
-		pk := &rsaServiceAccountKey.PublicKey
-		tm.publicKeysMap[deprecatedKid] = pk
-		tm.publicKeys = append(tm.publicKeys, &token.PublicKey{KeyID: deprecatedKid, Key: pk})
+		keySet.PublicKeys = append(keySet.PublicKeys, &token.PublicKey{KeyID: deprecatedKid, Key: signer.Public()})
 		log.Info(nil, map[string]interface{}{"kid": deprecatedKid}, "deprecated public key added")
 	}
 	return privateKey, nil
@@ -1171,7 +1411,7 @@ func (m *tokenManager) loadPrivateKey(tm *tokenManager, key []byte, kid string,
 func (m *tokenManager) toJSONWebKeys(publicKeys []*token.PublicKey) (token.JSONKeys, error) {
 	var result []interface{}
 	for _, key := range publicKeys {
-		jwkey := jose.JSONWebKey{Key: key.Key, KeyID: key.KeyID, Algorithm: "RS256", Use: "sig"}
+		jwkey := jose.JSONWebKey{Key: key.Key, KeyID: key.KeyID, Algorithm: key.Algorithm(), Use: "sig"}
 		keyData, err := jwkey.MarshalJSON()
 		if err != nil {
 			return token.JSONKeys{}, err
@@ -1199,8 +1439,8 @@ func (m *tokenManager) toPemKeys(publicKeys []*token.PublicKey) (token.JSONKeys,
 	return token.JSONKeys{Keys: pemKeys}, nil
 }
 
-func (m *tokenManager) toPem(key *rsa.PublicKey) (string, error) {
-	pubASN1, err := x509.MarshalPKIXPublicKey(key)
+func (m *tokenManager) toPem(key crypto.PublicKey) (string, error) {
+	pubASN1, err := token.MarshalPKIXPublicKey(key)
 	if err != nil {
 		return "", err
 	}
@@ -1212,9 +1452,11 @@ func (m *tokenManager) initServiceAccountToken() (string, error) {
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
+	m.keysLock.Lock()
 	m.serviceAccountToken = tokenStr
+	m.keysLock.Unlock()
 
-	return m.serviceAccountToken, nil
+	return tokenStr, nil
 }
 
 // NumberToInt convert interface{} to int64
@@ -2,6 +2,8 @@ package manager_test
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
 	"net/textproto"
@@ -40,6 +42,88 @@ func (s *TestTokenSuite) TestGenerateUserTokenForIdentity() {
 	s.checkGenerateUserTokenForIdentity(true) // Offline token
 }
 
+func (s *TestTokenSuite) TestGenerateUserTokenForIdentityWithIDToken() {
+	s.T().Run("without id token request", func(t *testing.T) {
+		token, _, _ := s.generateToken(false)
+		assert.Nil(t, token.Extra("id_token"))
+	})
+
+	s.T().Run("with nonce", func(t *testing.T) {
+		nonce := uuid.NewV4().String()
+		s.checkGenerateUserTokenForIdentityWithIDToken(&nonce, nil)
+	})
+
+	s.T().Run("without nonce", func(t *testing.T) {
+		s.checkGenerateUserTokenForIdentityWithIDToken(nil, nil)
+	})
+
+	s.T().Run("with auth time", func(t *testing.T) {
+		authTime := time.Now().Add(-time.Minute)
+		s.checkGenerateUserTokenForIdentityWithIDToken(nil, &authTime)
+	})
+}
+
+func (s *TestTokenSuite) checkGenerateUserTokenForIdentityWithIDToken(nonce *string, authTime *time.Time) {
+	clientID := uuid.NewV4().String()
+	_, identity, ctx := s.generateToken(false)
+	ctx = manager.ContextWithIDTokenRequest(ctx, clientID, nonce, authTime)
+
+	token, err := testtoken.TokenManager.GenerateUserTokenForIdentity(ctx, identity, false)
+	require.NoError(s.T(), err)
+	s.assertGeneratedToken(token, identity, false)
+
+	idTokenString, ok := token.Extra("id_token").(string)
+	require.True(s.T(), ok)
+	require.NotEmpty(s.T(), idTokenString)
+
+	// Headers
+	s.assertHeaders(idTokenString)
+
+	idToken, err := testtoken.TokenManager.ParseTokenWithMapClaims(context.Background(), idTokenString)
+	require.NoError(s.T(), err)
+
+	// Claims
+	s.assertJti(idToken)
+	s.assertIat(idToken)
+	s.assertExpiresIn(idToken["exp"])
+	s.assertClaim(idToken, "iss", "https://auth.openshift.io")
+	s.assertClaim(idToken, "aud", clientID)
+	s.assertClaim(idToken, "azp", clientID)
+	s.assertClaim(idToken, "typ", "ID")
+	if authTime != nil {
+		s.assertIntClaim(idToken, "auth_time", authTime.Unix())
+	} else {
+		assert.Nil(s.T(), idToken["auth_time"])
+	}
+	s.assertClaim(idToken, "sub", identity.ID.String())
+	s.assertClaim(idToken, "name", identity.User.FullName)
+	s.assertClaim(idToken, "email", identity.User.Email)
+	s.assertClaim(idToken, "email_verified", identity.User.EmailVerified)
+	s.assertClaim(idToken, "preferred_username", identity.Username)
+	firstName, lastName := account.SplitFullName(identity.User.FullName)
+	s.assertClaim(idToken, "given_name", firstName)
+	s.assertClaim(idToken, "family_name", lastName)
+
+	// The at_hash claim is the base64url encoded left-most half of the SHA-256 hash of the access token
+	hash := sha256.Sum256([]byte(token.AccessToken))
+	s.assertClaim(idToken, "at_hash", base64.RawURLEncoding.EncodeToString(hash[:16]))
+
+	if nonce != nil {
+		s.assertClaim(idToken, "nonce", *nonce)
+	} else {
+		assert.Nil(s.T(), idToken["nonce"])
+	}
+
+	// The ID token claims can also be parsed as token claims
+	claims, err := testtoken.TokenManager.ParseToken(context.Background(), idTokenString)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), clientID, claims.Audience)
+	assert.Equal(s.T(), idToken["at_hash"], claims.AccessTokenHash)
+	if nonce != nil {
+		assert.Equal(s.T(), *nonce, claims.Nonce)
+	}
+}
+
 func (s *TestTokenSuite) TestRefreshedUserTokenForIdentity() {
 	s.checkRefreshedUserTokenForIdentity(false)
 	s.checkRefreshedUserTokenForIdentity(true)
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/fabric8-services/fabric8-auth/authorization/token"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 
@@ -243,7 +244,148 @@ func (s *TestWhiteboxTokenSuite) checkPrivateKeyLoaded(keyEnvVarName, keyEnvVarV
 
 	rsaServiceAccountKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(keyEnvVarValue))
 	require.NoError(s.T(), err)
-	require.Equal(s.T(), rsaServiceAccountKey.PublicKey, *publicKey)
+	require.Equal(s.T(), &rsaServiceAccountKey.PublicKey, publicKey)
+}
+
+func (s *TestWhiteboxTokenSuite) TestLoadKeySet() {
+	m, err := NewTokenManager(s.Config)
+	require.NoError(s.T(), err)
+	tm, ok := m.(*tokenManager)
+	require.True(s.T(), ok)
+	oldUserAccountKey := tm.userAccountKey()
+	oldToken, err := tm.signWithUserAccountKey(jwt.New(jwt.SigningMethodRS256))
+	require.NoError(s.T(), err)
+
+	// Rotate the user account key, the old key is still published
+	rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(deprecatedUserAccountPrivateKey))
+	require.NoError(s.T(), err)
+	newUserAccountKey := &token.PrivateKey{KeyID: uuid.NewV4().String(), Key: rsaKey}
+	err = tm.LoadKeySet(KeySet{
+		UserAccountPrivateKey:    newUserAccountKey,
+		ServiceAccountPrivateKey: tm.serviceAccountKey(),
+		PublicKeys:               []*token.PublicKey{oldUserAccountKey.PublicKey()},
+	})
+	require.NoError(s.T(), err)
+
+	// The new key is used to sign tokens
+	newToken, err := tm.signWithUserAccountKey(jwt.New(jwt.SigningMethodRS256))
+	require.NoError(s.T(), err)
+	parsed, err := tm.Parse(context.Background(), newToken)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), newUserAccountKey.KeyID, parsed.Header["kid"])
+
+	// Both keys are published, along with the service account key and the dev mode key
+	_, err = tm.Parse(context.Background(), oldToken)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), tm.PublicKeys(), 4)
+	require.Len(s.T(), tm.JSONWebKeys().Keys, 4)
+	require.Len(s.T(), tm.PemKeys().Keys, 4)
+
+	// Once the old key is retired, the tokens it signed are rejected
+	err = tm.LoadKeySet(KeySet{
+		UserAccountPrivateKey:    newUserAccountKey,
+		ServiceAccountPrivateKey: tm.serviceAccountKey(),
+	})
+	require.NoError(s.T(), err)
+	_, err = tm.Parse(context.Background(), oldToken)
+	require.Error(s.T(), err)
+	require.Len(s.T(), tm.PublicKeys(), 3)
+
+	// Private keys are required
+	err = tm.LoadKeySet(KeySet{UserAccountPrivateKey: newUserAccountKey})
+	require.Error(s.T(), err)
+}
+
+func (s *TestWhiteboxTokenSuite) TestLoadKeySetWithECDSAAndEd25519Keys() {
+	m, err := NewTokenManager(s.Config)
+	require.NoError(s.T(), err)
+	tm, ok := m.(*tokenManager)
+	require.True(s.T(), ok)
+
+	ecdsaKey, err := token.GeneratePrivateKey(token.AlgorithmES256)
+	require.NoError(s.T(), err)
+	ed25519Key, err := token.GeneratePrivateKey(token.AlgorithmEdDSA)
+	require.NoError(s.T(), err)
+	userAccountKey := &token.PrivateKey{KeyID: uuid.NewV4().String(), Key: ecdsaKey}
+	serviceAccountKey := &token.PrivateKey{KeyID: uuid.NewV4().String(), Key: ed25519Key}
+	err = tm.LoadKeySet(KeySet{
+		UserAccountPrivateKey:    userAccountKey,
+		ServiceAccountPrivateKey: serviceAccountKey,
+	})
+	require.NoError(s.T(), err)
+
+	s.T().Run("user tokens signed with ES256", func(t *testing.T) {
+		signed, err := tm.signWithUserAccountKey(tm.newUserAccountToken())
+		require.NoError(t, err)
+		parsed, err := tm.Parse(context.Background(), signed)
+		require.NoError(t, err)
+		assert.Equal(t, "ES256", parsed.Header["alg"])
+		assert.Equal(t, userAccountKey.KeyID, parsed.Header["kid"])
+	})
+
+	s.T().Run("service account tokens signed with EdDSA", func(t *testing.T) {
+		parsed, err := tm.Parse(context.Background(), tm.AuthServiceAccountToken())
+		require.NoError(t, err)
+		assert.Equal(t, "EdDSA", parsed.Header["alg"])
+		assert.Equal(t, serviceAccountKey.KeyID, parsed.Header["kid"])
+	})
+
+	s.T().Run("tampered tokens rejected", func(t *testing.T) {
+		parts := strings.Split(tm.AuthServiceAccountToken(), ".")
+		claims, err := jwt.DecodeSegment(parts[1])
+		require.NoError(t, err)
+		parts[1] = jwt.EncodeSegment([]byte(strings.Replace(string(claims), token.Auth, token.WIT, 1)))
+		_, err = tm.Parse(context.Background(), strings.Join(parts, "."))
+		require.Error(t, err)
+	})
+
+	s.T().Run("tokens with another algorithm rejected", func(t *testing.T) {
+		rsaKey, err := token.GeneratePrivateKey(token.AlgorithmRS256)
+		require.NoError(t, err)
+		for _, signed := range []func() (string, error){
+			// an RS256 token with the ID of the ES256 key
+			func() (string, error) {
+				jwtToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "test"})
+				jwtToken.Header["kid"] = userAccountKey.KeyID
+				return jwtToken.SignedString(rsaKey)
+			},
+			// an ES256 token with the ID of the EdDSA key
+			func() (string, error) {
+				jwtToken := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"sub": "test"})
+				jwtToken.Header["kid"] = serviceAccountKey.KeyID
+				return jwtToken.SignedString(ecdsaKey)
+			},
+			// an HS256 token with the ID of the ES256 key
+			func() (string, error) {
+				jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "test"})
+				jwtToken.Header["kid"] = userAccountKey.KeyID
+				return jwtToken.SignedString([]byte("secret"))
+			},
+		} {
+			tokenString, err := signed()
+			require.NoError(t, err)
+			_, err = tm.Parse(context.Background(), tokenString)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "The signing algorithm of the token doesn't match the public key")
+		}
+	})
+
+	s.T().Run("keys published with their type and curve", func(t *testing.T) {
+		expected := map[string]map[string]interface{}{
+			userAccountKey.KeyID:    {"kty": "EC", "crv": "P-256", "alg": "ES256", "use": "sig"},
+			serviceAccountKey.KeyID: {"kty": "OKP", "crv": "Ed25519", "alg": "EdDSA", "use": "sig"},
+		}
+		jwKeys := tm.JSONWebKeys().Keys
+		require.Len(t, jwKeys, 3)
+		for _, key := range jwKeys {
+			jwk, ok := key.(map[string]interface{})
+			require.True(t, ok)
+			for name, value := range expected[jwk["kid"].(string)] {
+				assert.Equal(t, value, jwk[name], "unexpected %s for key %s", name, jwk["kid"])
+			}
+		}
+		require.Len(t, tm.PemKeys().Keys, 3)
+	})
 }
 
 func (s *TestWhiteboxTokenSuite) TestAuthServiceAccount() {
@@ -64,6 +64,9 @@ type ExternalTokenRepository interface {
 	Create(ctx context.Context, ExternalToken *ExternalToken) error
 	Save(ctx context.Context, ExternalToken *ExternalToken) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	DeleteForIdentity(ctx context.Context, identityID uuid.UUID) error
+	DeleteOrphaned(ctx context.Context, deletedBefore time.Time) (int64, error)
+	TransferToIdentity(ctx context.Context, fromIdentityID, toIdentityID uuid.UUID) error
 	LoadByProviderIDAndIdentityID(ctx context.Context, providerID uuid.UUID, identityID uuid.UUID) ([]ExternalToken, error)
 	Query(funcs ...func(*gorm.DB) *gorm.DB) ([]ExternalToken, error)
 }
@@ -163,6 +166,56 @@ func (m *GormExternalTokenRepository) Delete(ctx context.Context, id uuid.UUID)
 	return nil
 }
 
+// DeleteForIdentity removes all the external tokens of the given identity. This is a hard delete!
+func (m *GormExternalTokenRepository) DeleteForIdentity(ctx context.Context, identityID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "ExternalToken", "deleteForIdentity"}, time.Now())
+	err := m.db.Table(m.TableName()).Where("identity_id = ?", identityID).Delete(nil).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return errs.WithStack(err)
+	}
+	return nil
+}
+
+// DeleteOrphaned removes the external tokens which are not linked to any identity or whose identity was deleted before
+// the given time, and returns the number of deleted tokens. This is a hard delete!
+func (m *GormExternalTokenRepository) DeleteOrphaned(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "ExternalToken", "deleteOrphaned"}, time.Now())
+	result := m.db.Table(m.TableName()).
+		Where("identity_id IS NULL OR identity_id IN (SELECT id FROM identities WHERE deleted_at < ?)", deletedBefore).
+		Delete(nil)
+	if result.Error != nil {
+		log.Error(ctx, map[string]interface{}{
+			"deleted_before": deletedBefore,
+			"err":            result.Error,
+		}, "unable to delete the orphaned external tokens")
+		return 0, errs.WithStack(result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// TransferToIdentity transfers the external tokens of the identity `fromIdentityID` to the identity `toIdentityID`.
+// The tokens for the providers to which `toIdentityID` is already linked are removed instead, so that the existing
+// links of `toIdentityID` are kept.
+func (m *GormExternalTokenRepository) TransferToIdentity(ctx context.Context, fromIdentityID, toIdentityID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "ExternalToken", "transferToIdentity"}, time.Now())
+	err := m.db.Table(m.TableName()).
+		Where("identity_id = ? AND provider_id IN (SELECT provider_id FROM external_tokens WHERE identity_id = ?)", fromIdentityID, toIdentityID).
+		Delete(nil).Error
+	if err != nil {
+		return errs.WithStack(err)
+	}
+	err = m.db.Table(m.TableName()).Where("identity_id = ?", fromIdentityID).Update("identity_id", toIdentityID).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"from_identity_id": fromIdentityID,
+			"to_identity_id":   toIdentityID,
+			"err":              err,
+		}, "unable to transfer the external tokens")
+		return errs.WithStack(err)
+	}
+	return nil
+}
+
 // Query expose an open ended Query model
 func (m *GormExternalTokenRepository) Query(funcs ...func(*gorm.DB) *gorm.DB) ([]ExternalToken, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "ExternalToken", "query"}, time.Now())
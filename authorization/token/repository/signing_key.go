@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormsupport"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	signingKeyTableName = "signing_keys"
+
+	// SigningKeyPurposeUserAccount is the purpose of the keys used to sign user tokens
+	SigningKeyPurposeUserAccount = "user_account"
+	// SigningKeyPurposeServiceAccount is the purpose of the keys used to sign service account tokens
+	SigningKeyPurposeServiceAccount = "service_account"
+
+	// SigningKeyStatePending is the state of a key which is published but not used to sign tokens yet, so that
+	// the clients which cache the published keys know the key before it is used
+	SigningKeyStatePending = "pending"
+	// SigningKeyStateActive is the state of the key which is used to sign new tokens
+	SigningKeyStateActive = "active"
+	// SigningKeyStateRetiring is the state of a key which is not used to sign new tokens anymore, but is still
+	// published until the tokens it signed have expired
+	SigningKeyStateRetiring = "retiring"
+	// SigningKeyStateRetired is the state of a key which is neither used nor published anymore
+	SigningKeyStateRetired = "retired"
+)
+
+// SigningKey represents a private key used to sign tokens
+type SigningKey struct {
+	gormsupport.Lifecycle
+	SigningKeyID uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key;column:signing_key_id"`
+	// The ID of the key, used as the "kid" header of the tokens signed with this key
+	KeyID string `gorm:"column:kid"`
+	// Either SigningKeyPurposeUserAccount or SigningKeyPurposeServiceAccount
+	Purpose string
+	// The PEM encoded private key, encrypted with the signing key encryption key of the configuration
+	PrivateKey string
+	State      string
+	// The time when the key entered its current state, used to schedule the next state transition
+	StateChangedAt time.Time
+}
+
+// TableName implements gorm.tabler
+func (k SigningKey) TableName() string {
+	return signingKeyTableName
+}
+
+// SigningKeyRepository encapsulate storage & retrieval of signing keys
+type SigningKeyRepository interface {
+	Create(ctx context.Context, key *SigningKey) error
+	Save(ctx context.Context, key *SigningKey) error
+	ListByPurpose(ctx context.Context, purpose string) ([]SigningKey, error)
+}
+
+// NewSigningKeyRepository creates a new signing key repo
+func NewSigningKeyRepository(db *gorm.DB) *GormSigningKeyRepository {
+	return &GormSigningKeyRepository{db}
+}
+
+// GormSigningKeyRepository implements SigningKeyRepository using gorm
+type GormSigningKeyRepository struct {
+	db *gorm.DB
+}
+
+// Create creates a new signing key in the DB
+// returns DataConflictError if a key with the same ID already exists, or if there is already an active or a pending
+// key with the same purpose. Otherwise returns InternalError
+func (r *GormSigningKeyRepository) Create(ctx context.Context, key *SigningKey) error {
+	defer goa.MeasureSince([]string{"goa", "db", "signing_keys", "create"}, time.Now())
+	if key.SigningKeyID == uuid.Nil {
+		key.SigningKeyID = uuid.NewV4()
+	}
+
+	err := r.db.Create(key).Error
+	if err != nil {
+		if gormsupport.IsUniqueViolation(err, "idx_signing_keys_kid") {
+			return errors.NewDataConflictError(fmt.Sprintf("signing key with kid %s already exists", key.KeyID))
+		}
+		if gormsupport.IsUniqueViolation(err, "idx_signing_keys_pending") || gormsupport.IsUniqueViolation(err, "idx_signing_keys_active") {
+			return errors.NewDataConflictError(fmt.Sprintf("%s signing key with purpose %s already exists", key.State, key.Purpose))
+		}
+		log.Error(ctx, map[string]interface{}{
+			"kid": key.KeyID,
+			"err": err,
+		}, "unable to create the signing key")
+		return errors.NewInternalError(ctx, err)
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"signing_key_id": key.SigningKeyID,
+		"kid":            key.KeyID,
+		"purpose":        key.Purpose,
+		"state":          key.State,
+	}, "Signing key created successfully")
+	return nil
+}
+
+// Save updates the given signing key in the DB
+// returns NotFoundError, DataConflictError if there is already an active or a pending key with the same purpose,
+// or InternalError
+func (r *GormSigningKeyRepository) Save(ctx context.Context, key *SigningKey) error {
+	defer goa.MeasureSince([]string{"goa", "db", "signing_keys", "save"}, time.Now())
+	tx := r.db.Model(key).Updates(key)
+	if err := tx.Error; err != nil {
+		if gormsupport.IsUniqueViolation(err, "idx_signing_keys_pending") || gormsupport.IsUniqueViolation(err, "idx_signing_keys_active") {
+			return errors.NewDataConflictError(fmt.Sprintf("%s signing key with purpose %s already exists", key.State, key.Purpose))
+		}
+		log.Error(ctx, map[string]interface{}{
+			"signing_key_id": key.SigningKeyID.String(),
+			"err":            err,
+		}, "unable to update the signing key")
+		return errors.NewInternalError(ctx, err)
+	}
+	if tx.RowsAffected == 0 {
+		return errors.NewNotFoundError("signing key", key.SigningKeyID.String())
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"signing_key_id": key.SigningKeyID,
+		"kid":            key.KeyID,
+		"state":          key.State,
+	}, "Signing key saved")
+	return nil
+}
+
+// ListByPurpose returns the signing keys with the given purpose which are not retired, ordered by creation date
+func (r *GormSigningKeyRepository) ListByPurpose(ctx context.Context, purpose string) ([]SigningKey, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "signing_keys", "list"}, time.Now())
+	var keys []SigningKey
+	err := r.db.Where("purpose = ? AND state <> ?", purpose, SigningKeyStateRetired).Order("created_at").Find(&keys).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,116 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/authorization/token/repository"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type signingKeyBlackBoxTest struct {
+	gormtestsupport.DBTestSuite
+	repo repository.SigningKeyRepository
+}
+
+func TestRunSigningKeyBlackBoxTest(t *testing.T) {
+	suite.Run(t, &signingKeyBlackBoxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *signingKeyBlackBoxTest) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.repo = repository.NewSigningKeyRepository(s.DB)
+}
+
+func (s *signingKeyBlackBoxTest) newSigningKey(purpose string, state string) *repository.SigningKey {
+	key := &repository.SigningKey{
+		KeyID:          uuid.NewV4().String(),
+		Purpose:        purpose,
+		PrivateKey:     uuid.NewV4().String(),
+		State:          state,
+		StateChangedAt: time.Now(),
+	}
+	err := s.repo.Create(s.Ctx, key)
+	require.NoError(s.T(), err, "Could not create signing key")
+	return key
+}
+
+func (s *signingKeyBlackBoxTest) TestCreateList() {
+	// given
+	purpose := uuid.NewV4().String()
+	active := s.newSigningKey(purpose, repository.SigningKeyStateActive)
+	retiring := s.newSigningKey(purpose, repository.SigningKeyStateRetiring)
+	s.newSigningKey(purpose, repository.SigningKeyStateRetired)
+	s.newSigningKey(uuid.NewV4().String(), repository.SigningKeyStateActive)
+
+	// when
+	keys, err := s.repo.ListByPurpose(s.Ctx, purpose)
+
+	// then
+	require.NoError(s.T(), err)
+	require.Len(s.T(), keys, 2)
+	assert.Equal(s.T(), active.KeyID, keys[0].KeyID)
+	assert.Equal(s.T(), active.PrivateKey, keys[0].PrivateKey)
+	assert.Equal(s.T(), repository.SigningKeyStateActive, keys[0].State)
+	assert.Equal(s.T(), retiring.KeyID, keys[1].KeyID)
+	assert.Equal(s.T(), repository.SigningKeyStateRetiring, keys[1].State)
+}
+
+func (s *signingKeyBlackBoxTest) TestCreateConflicts() {
+	// given
+	purpose := uuid.NewV4().String()
+	active := s.newSigningKey(purpose, repository.SigningKeyStateActive)
+	s.newSigningKey(purpose, repository.SigningKeyStatePending)
+
+	s.T().Run("same kid", func(t *testing.T) {
+		err := s.repo.Create(s.Ctx, &repository.SigningKey{
+			KeyID:          active.KeyID,
+			Purpose:        uuid.NewV4().String(),
+			PrivateKey:     uuid.NewV4().String(),
+			State:          repository.SigningKeyStateRetiring,
+			StateChangedAt: time.Now(),
+		})
+		require.IsType(t, errors.DataConflictError{}, err)
+	})
+
+	for _, state := range []string{repository.SigningKeyStateActive, repository.SigningKeyStatePending} {
+		s.T().Run("second "+state+" key", func(t *testing.T) {
+			err := s.repo.Create(s.Ctx, &repository.SigningKey{
+				KeyID:          uuid.NewV4().String(),
+				Purpose:        purpose,
+				PrivateKey:     uuid.NewV4().String(),
+				State:          state,
+				StateChangedAt: time.Now(),
+			})
+			require.IsType(t, errors.DataConflictError{}, err)
+		})
+	}
+}
+
+func (s *signingKeyBlackBoxTest) TestSave() {
+	// given
+	purpose := uuid.NewV4().String()
+	key := s.newSigningKey(purpose, repository.SigningKeyStatePending)
+
+	// when
+	key.State = repository.SigningKeyStateRetired
+	key.StateChangedAt = time.Now()
+	err := s.repo.Save(s.Ctx, key)
+
+	// then
+	require.NoError(s.T(), err)
+	keys, err := s.repo.ListByPurpose(s.Ctx, purpose)
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), keys)
+
+	s.T().Run("unknown key", func(t *testing.T) {
+		err := s.repo.Save(s.Ctx, &repository.SigningKey{SigningKeyID: uuid.NewV4(), State: repository.SigningKeyStateRetired})
+		require.IsType(t, errors.NotFoundError{}, err)
+	})
+}
@@ -31,6 +31,12 @@ type Token struct {
 
 	// The timestamp when the token will expire
 	ExpiryTime time.Time
+
+	// The audience of a token issued by token exchange
+	Audience *string
+
+	// The ID of the client which acted on behalf of the identity when the token was issued by token exchange
+	ActorID *string
 }
 
 // TableName overrides the table name settings in Gorm to force a specific table name
@@ -90,6 +96,7 @@ type TokenRepository interface {
 	Create(ctx context.Context, token *Token) error
 	Save(ctx context.Context, token *Token) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	DeleteForIdentity(ctx context.Context, identityID uuid.UUID) error
 	ListForIdentity(ctx context.Context, id uuid.UUID) ([]Token, error)
 	CreatePrivilege(ctx context.Context, privilege *TokenPrivilege) error
 	ListPrivileges(ctx context.Context, tokenID uuid.UUID) ([]permission.PrivilegeCache, error)
@@ -216,6 +223,21 @@ func (m *GormTokenRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// DeleteForIdentity removes all the tokens of the given identity, along with their privileges. This is a hard delete!
+func (m *GormTokenRepository) DeleteForIdentity(ctx context.Context, identityID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "token", "DeleteForIdentity"}, time.Now())
+
+	err := m.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE token_id IN (SELECT token_id FROM %s WHERE identity_id = ?)", m.TokenPrivilegeTableName(), m.TableName()), identityID).Error
+	if err != nil {
+		return errs.WithStack(err)
+	}
+	err = m.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE identity_id = ?", m.TableName()), identityID).Error
+	if err != nil {
+		return errs.WithStack(err)
+	}
+	return nil
+}
+
 func (m *GormTokenRepository) ListForIdentity(ctx context.Context, identityID uuid.UUID) ([]Token, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "token", "ListForIdentity"}, time.Now())
 	var rows []Token
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/application/service"
+	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
+	"github.com/fabric8-services/fabric8-auth/log"
+)
+
+type signingKeyRotatorConfig interface {
+	GetSigningKeyRefreshInterval() time.Duration
+}
+
+// SigningKeyRotator periodically applies the scheduled rotations of the signing keys and reloads the keys into the
+// token manager, so that all the instances of the service eventually use and publish the same keys
+type SigningKeyRotator struct {
+	config       signingKeyRotatorConfig
+	keyService   service.SigningKeyService
+	tokenManager manager.TokenManager
+	refresher    *time.Ticker
+	stopCh       chan bool
+}
+
+// NewSigningKeyRotator returns a new signing key rotator for the given token manager
+func NewSigningKeyRotator(keyService service.SigningKeyService, tokenManager manager.TokenManager, config signingKeyRotatorConfig) *SigningKeyRotator {
+	return &SigningKeyRotator{
+		config:       config,
+		keyService:   keyService,
+		tokenManager: tokenManager,
+		refresher:    time.NewTicker(config.GetSigningKeyRefreshInterval()),
+	}
+}
+
+// Start rotates and loads the signing keys, then initializes regular key refreshing.
+// Returns an error if the keys could not be loaded.
+func (r *SigningKeyRotator) Start(ctx context.Context) error {
+	err := r.refreshKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.stopCh = make(chan bool, 1)
+	go func() {
+		defer log.Info(nil, map[string]interface{}{}, "signing key rotator stopped")
+		log.Info(nil, map[string]interface{}{"interval": r.config.GetSigningKeyRefreshInterval()}, "signing key rotator started")
+		for {
+			select {
+			case <-r.refresher.C:
+				err := r.refreshKeys(context.Background())
+				if err != nil {
+					log.Error(nil, map[string]interface{}{"err": err}, "failed to load the signing keys during key refresh")
+				}
+			case <-r.stopCh:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops the key refreshing
+func (r *SigningKeyRotator) Stop() {
+	if r.stopCh != nil {
+		r.stopCh <- true
+	}
+}
+
+// refreshKeys rotates the keys then loads them. A failed rotation is not fatal since it is retried during the next
+// refresh, for example when several instances of the service rotated the keys at the same time.
+func (r *SigningKeyRotator) refreshKeys(ctx context.Context) error {
+	ctx = manager.ContextWithTokenManager(ctx, r.tokenManager)
+	err := r.keyService.RotateKeys(ctx)
+	if err != nil {
+		log.Warn(ctx, map[string]interface{}{"err": err}, "failed to rotate the signing keys")
+	}
+	return r.keyService.LoadKeys(ctx)
+}
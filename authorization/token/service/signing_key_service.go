@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/application/service"
+	"github.com/fabric8-services/fabric8-auth/application/service/base"
+	servicecontext "github.com/fabric8-services/fabric8-auth/application/service/context"
+	authtoken "github.com/fabric8-services/fabric8-auth/authorization/token"
+	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
+	tokenrepo "github.com/fabric8-services/fabric8-auth/authorization/token/repository"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	errs "github.com/pkg/errors"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// SigningKeyServiceConfiguration the required configuration for the signing key service implementation
+type SigningKeyServiceConfiguration interface {
+	GetServiceAccountPrivateKey() ([]byte, string)
+	GetDeprecatedServiceAccountPrivateKey() ([]byte, string)
+	GetUserAccountPrivateKey() ([]byte, string)
+	GetDeprecatedUserAccountPrivateKey() ([]byte, string)
+	GetSigningKeyRotationInterval() time.Duration
+	GetSigningKeyPrepublicationPeriod() time.Duration
+	GetSigningKeyRetirementPeriod() time.Duration
+	GetSigningKeyAlgorithm() string
+	GetSigningKeyEncryptionKey() []byte
+}
+
+type signingKeyServiceImpl struct {
+	base.BaseService
+	config SigningKeyServiceConfiguration
+}
+
+// NewSigningKeyService returns a new SigningKeyService implementation
+func NewSigningKeyService(context servicecontext.ServiceContext, config SigningKeyServiceConfiguration) service.SigningKeyService {
+	return &signingKeyServiceImpl{
+		BaseService: base.NewBaseService(context),
+		config:      config,
+	}
+}
+
+// RotateKeys applies the scheduled state transitions to the user account and service account signing keys:
+// - a new pending key is generated when the active key is about to be replaced, so that the new key is published
+// before it is used,
+// - the pending key becomes the active key once it has been published for the prepublication period, and the
+// previously active key is retiring,
+// - retiring keys are retired once they have been published for the retirement period.
+// If no key has been stored yet, the keys of the configuration are imported so that the rotation starts with the keys
+// currently in use. The private keys are stored encrypted with the encryption key of the configuration, and the keys
+// which were stored unencrypted are encrypted.
+func (s *signingKeyServiceImpl) RotateKeys(ctx context.Context) error {
+	for _, purpose := range []string{tokenrepo.SigningKeyPurposeUserAccount, tokenrepo.SigningKeyPurposeServiceAccount} {
+		err := s.ExecuteInTransaction(func() error {
+			return s.rotateKeys(ctx, purpose)
+		})
+		if err != nil {
+			log.Error(ctx, map[string]interface{}{
+				"purpose": purpose,
+				"err":     err,
+			}, "unable to rotate signing keys")
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *signingKeyServiceImpl) rotateKeys(ctx context.Context, purpose string) error {
+	keys, err := s.Repositories().SigningKeys().ListByPurpose(ctx, purpose)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return s.importConfiguredKeys(ctx, purpose)
+	}
+	for i := range keys {
+		if authtoken.IsEncryptedPrivateKey(keys[i].PrivateKey) {
+			continue
+		}
+		err = s.encryptPrivateKey(&keys[i], []byte(keys[i].PrivateKey))
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+		err = s.Repositories().SigningKeys().Save(ctx, &keys[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	var active, pending *tokenrepo.SigningKey
+	for i := range keys {
+		key := &keys[i]
+		switch key.State {
+		case tokenrepo.SigningKeyStateActive:
+			active = key
+		case tokenrepo.SigningKeyStatePending:
+			pending = key
+		case tokenrepo.SigningKeyStateRetiring:
+			if now.Sub(key.StateChangedAt) >= s.config.GetSigningKeyRetirementPeriod() {
+				err = s.changeState(ctx, key, tokenrepo.SigningKeyStateRetired, now)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// The pending key is activated once it has been published long enough, or right away if there is no active key
+	if pending != nil && (active == nil || now.Sub(pending.StateChangedAt) >= s.config.GetSigningKeyPrepublicationPeriod()) {
+		if active != nil {
+			err = s.changeState(ctx, active, tokenrepo.SigningKeyStateRetiring, now)
+			if err != nil {
+				return err
+			}
+		}
+		return s.changeState(ctx, pending, tokenrepo.SigningKeyStateActive, now)
+	}
+
+	// The next key is generated ahead of the rotation, so that it is published for the prepublication period
+	if pending == nil {
+		state := tokenrepo.SigningKeyStatePending
+		if active == nil {
+			state = tokenrepo.SigningKeyStateActive
+		} else if now.Sub(active.StateChangedAt) < s.config.GetSigningKeyRotationInterval()-s.config.GetSigningKeyPrepublicationPeriod() {
+			return nil
+		}
+		key, privateKey, err := generateSigningKey(s.config.GetSigningKeyAlgorithm(), purpose, state, now)
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+		err = s.encryptPrivateKey(key, privateKey)
+		if err != nil {
+			return errors.NewInternalError(ctx, err)
+		}
+		return s.Repositories().SigningKeys().Create(ctx, key)
+	}
+	return nil
+}
+
+// importConfiguredKeys stores the private key of the configuration with the given purpose as the active key, and the
+// deprecated private key if any as a retiring key
+func (s *signingKeyServiceImpl) importConfiguredKeys(ctx context.Context, purpose string) error {
+	var key, deprecatedKey []byte
+	var kid, deprecatedKid string
+	if purpose == tokenrepo.SigningKeyPurposeUserAccount {
+		key, kid = s.config.GetUserAccountPrivateKey()
+		deprecatedKey, deprecatedKid = s.config.GetDeprecatedUserAccountPrivateKey()
+	} else {
+		key, kid = s.config.GetServiceAccountPrivateKey()
+		deprecatedKey, deprecatedKid = s.config.GetDeprecatedServiceAccountPrivateKey()
+	}
+
+	now := time.Now()
+	activeKey := &tokenrepo.SigningKey{
+		KeyID:          kid,
+		Purpose:        purpose,
+		State:          tokenrepo.SigningKeyStateActive,
+		StateChangedAt: now,
+	}
+	err := s.encryptPrivateKey(activeKey, key)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	err = s.Repositories().SigningKeys().Create(ctx, activeKey)
+	if err != nil {
+		return err
+	}
+	if len(deprecatedKey) == 0 || deprecatedKid == "" {
+		return nil
+	}
+	retiringKey := &tokenrepo.SigningKey{
+		KeyID:          deprecatedKid,
+		Purpose:        purpose,
+		State:          tokenrepo.SigningKeyStateRetiring,
+		StateChangedAt: now,
+	}
+	err = s.encryptPrivateKey(retiringKey, deprecatedKey)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	return s.Repositories().SigningKeys().Create(ctx, retiringKey)
+}
+
+// encryptPrivateKey sets the private key of the given signing key to the given PEM encoded private key, encrypted with
+// the encryption key of the configuration
+func (s *signingKeyServiceImpl) encryptPrivateKey(key *tokenrepo.SigningKey, privateKey []byte) error {
+	encrypted, err := authtoken.EncryptPrivateKey(privateKey, key.KeyID, s.config.GetSigningKeyEncryptionKey())
+	if err != nil {
+		return errs.Wrapf(err, "unable to encrypt signing key %s", key.KeyID)
+	}
+	key.PrivateKey = encrypted
+	return nil
+}
+
+// decryptPrivateKey returns the PEM encoded private key of the given signing key. The keys which were stored before
+// the private keys were encrypted are returned as is, until the next rotation encrypts them.
+func (s *signingKeyServiceImpl) decryptPrivateKey(key tokenrepo.SigningKey) ([]byte, error) {
+	if !authtoken.IsEncryptedPrivateKey(key.PrivateKey) {
+		return []byte(key.PrivateKey), nil
+	}
+	return authtoken.DecryptPrivateKey(key.PrivateKey, key.KeyID, s.config.GetSigningKeyEncryptionKey())
+}
+
+func (s *signingKeyServiceImpl) changeState(ctx context.Context, key *tokenrepo.SigningKey, state string, now time.Time) error {
+	log.Info(ctx, map[string]interface{}{
+		"kid":        key.KeyID,
+		"purpose":    key.Purpose,
+		"from_state": key.State,
+		"to_state":   state,
+	}, "changing signing key state")
+	key.State = state
+	key.StateChangedAt = now
+	return s.Repositories().SigningKeys().Save(ctx, key)
+}
+
+// LoadKeys loads the signing keys which are not retired into the token manager of the context. The active keys are
+// used to sign new tokens, while all the keys are published. The keys of both purposes are read in a single
+// transaction, so that a concurrent rotation can't result in an inconsistent key set.
+func (s *signingKeyServiceImpl) LoadKeys(ctx context.Context) error {
+	tokenManager, err := manager.ReadTokenManagerFromContext(ctx)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+
+	purposes := []string{tokenrepo.SigningKeyPurposeUserAccount, tokenrepo.SigningKeyPurposeServiceAccount}
+	keysByPurpose := map[string][]tokenrepo.SigningKey{}
+	err = s.ExecuteInTransaction(func() error {
+		for _, purpose := range purposes {
+			keys, err := s.Repositories().SigningKeys().ListByPurpose(ctx, purpose)
+			if err != nil {
+				return err
+			}
+			keysByPurpose[purpose] = keys
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	keySet := manager.KeySet{}
+	for _, purpose := range purposes {
+		for _, key := range keysByPurpose[purpose] {
+			privateKey, err := s.decryptPrivateKey(key)
+			if err != nil {
+				log.Error(ctx, map[string]interface{}{
+					"kid": key.KeyID,
+					"err": err,
+				}, "unable to decrypt signing key")
+				return errors.NewInternalError(ctx, err)
+			}
+			signer, err := authtoken.ParsePrivateKeyFromPEM(privateKey)
+			if err != nil {
+				log.Error(ctx, map[string]interface{}{
+					"kid": key.KeyID,
+					"err": err,
+				}, "unable to parse signing key")
+				return errors.NewInternalError(ctx, err)
+			}
+			privateKey := &authtoken.PrivateKey{KeyID: key.KeyID, Key: signer}
+			keySet.PublicKeys = append(keySet.PublicKeys, privateKey.PublicKey())
+			if key.State != tokenrepo.SigningKeyStateActive {
+				continue
+			}
+			if purpose == tokenrepo.SigningKeyPurposeUserAccount {
+				keySet.UserAccountPrivateKey = privateKey
+			} else {
+				keySet.ServiceAccountPrivateKey = privateKey
+			}
+		}
+	}
+	if keySet.UserAccountPrivateKey == nil || keySet.ServiceAccountPrivateKey == nil {
+		return errors.NewInternalErrorFromString(ctx, "no active user account or service account signing key found")
+	}
+
+	err = tokenManager.LoadKeySet(keySet)
+	if err != nil {
+		return errors.NewInternalError(ctx, err)
+	}
+	return nil
+}
+
+// generateSigningKey generates a new signing key for the given algorithm, with the given purpose and state, and returns
+// it along with its PEM encoded private key, which is yet to be set on the signing key. The ID of the key is its JWK
+// thumbprint, as defined by RFC 7638.
+func generateSigningKey(algorithm string, purpose string, state string, now time.Time) (*tokenrepo.SigningKey, []byte, error) {
+	signer, err := authtoken.GeneratePrivateKey(algorithm)
+	if err != nil {
+		return nil, nil, errs.Wrap(err, "unable to generate signing key")
+	}
+	thumbprint, err := (&jose.JSONWebKey{Key: signer.Public()}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, nil, errs.Wrap(err, "unable to compute the thumbprint of the signing key")
+	}
+	privateKey, err := authtoken.MarshalPrivateKeyToPEM(signer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &tokenrepo.SigningKey{
+		KeyID:          base64.RawURLEncoding.EncodeToString(thumbprint),
+		Purpose:        purpose,
+		State:          state,
+		StateChangedAt: now,
+	}, privateKey, nil
+}
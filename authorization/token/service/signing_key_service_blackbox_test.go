@@ -0,0 +1,161 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	authtoken "github.com/fabric8-services/fabric8-auth/authorization/token"
+	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
+	tokenrepo "github.com/fabric8-services/fabric8-auth/authorization/token/repository"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type signingKeyServiceBlackboxTest struct {
+	gormtestsupport.DBTestSuite
+}
+
+func TestSigningKeyServiceBlackbox(t *testing.T) {
+	suite.Run(t, &signingKeyServiceBlackboxTest{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *signingKeyServiceBlackboxTest) TestRotateAndLoadKeys() {
+	tm, err := manager.NewTokenManager(s.Configuration)
+	require.NoError(s.T(), err)
+	ctx := manager.ContextWithTokenManager(context.Background(), tm)
+	_, configuredKid := s.Configuration.GetUserAccountPrivateKey()
+
+	// listKeys returns the user account keys which are not retired, by state
+	listKeys := func(t *testing.T) map[string][]tokenrepo.SigningKey {
+		keys, err := s.Application.SigningKeys().ListByPurpose(ctx, tokenrepo.SigningKeyPurposeUserAccount)
+		require.NoError(t, err)
+		result := map[string][]tokenrepo.SigningKey{}
+		for _, key := range keys {
+			result[key.State] = append(result[key.State], key)
+		}
+		return result
+	}
+
+	// kids returns the IDs of the given keys
+	kids := func(keys []tokenrepo.SigningKey) []string {
+		result := []string{}
+		for _, key := range keys {
+			result = append(result, key.KeyID)
+		}
+		return result
+	}
+
+	// moveBack moves the state change of the given keys back in time by the given duration
+	moveBack := func(t *testing.T, keys []tokenrepo.SigningKey, d time.Duration) {
+		for _, key := range keys {
+			key.StateChangedAt = key.StateChangedAt.Add(-d)
+			err := s.Application.SigningKeys().Save(ctx, &key)
+			require.NoError(t, err)
+		}
+	}
+
+	// assertKeys loads the keys and checks that the active key is used to sign user tokens while all the given keys
+	// are published
+	assertKeys := func(t *testing.T, activeKid string, publishedKids ...string) {
+		err := s.Application.SigningKeyService().LoadKeys(ctx)
+		require.NoError(t, err)
+		for _, kid := range append(publishedKids, activeKid) {
+			assert.NotNil(t, tm.PublicKey(kid), "key %s is not published", kid)
+		}
+		signed, err := tm.SignRPTToken(ctx, jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "test"}))
+		require.NoError(t, err)
+		token, err := tm.Parse(ctx, signed)
+		require.NoError(t, err)
+		assert.Equal(t, activeKid, token.Header["kid"])
+		// the service account token is still valid
+		_, err = tm.Parse(ctx, tm.AuthServiceAccountToken())
+		require.NoError(t, err)
+	}
+
+	s.T().Run("configured keys imported", func(t *testing.T) {
+		err := s.Application.SigningKeyService().RotateKeys(ctx)
+		require.NoError(t, err)
+		keys := listKeys(t)
+		require.Len(t, keys[tokenrepo.SigningKeyStateActive], 1)
+		assert.Equal(t, configuredKid, keys[tokenrepo.SigningKeyStateActive][0].KeyID)
+		assert.Empty(t, keys[tokenrepo.SigningKeyStatePending])
+		assertKeys(t, configuredKid)
+	})
+
+	s.T().Run("private keys encrypted", func(t *testing.T) {
+		for _, key := range listKeys(t)[tokenrepo.SigningKeyStateActive] {
+			assert.True(t, authtoken.IsEncryptedPrivateKey(key.PrivateKey))
+			assert.NotContains(t, key.PrivateKey, "PRIVATE KEY")
+		}
+	})
+
+	s.T().Run("unencrypted private keys encrypted by the rotation", func(t *testing.T) {
+		// given a key stored before the private keys were encrypted
+		configuredKey, _ := s.Configuration.GetUserAccountPrivateKey()
+		key := listKeys(t)[tokenrepo.SigningKeyStateActive][0]
+		key.PrivateKey = string(configuredKey)
+		err := s.Application.SigningKeys().Save(ctx, &key)
+		require.NoError(t, err)
+		// the unencrypted key is still loaded
+		assertKeys(t, configuredKid)
+		// when
+		err = s.Application.SigningKeyService().RotateKeys(ctx)
+		// then
+		require.NoError(t, err)
+		keys := listKeys(t)
+		require.Len(t, keys[tokenrepo.SigningKeyStateActive], 1)
+		assert.True(t, authtoken.IsEncryptedPrivateKey(keys[tokenrepo.SigningKeyStateActive][0].PrivateKey))
+		assertKeys(t, configuredKid)
+	})
+
+	s.T().Run("no rotation before the rotation interval", func(t *testing.T) {
+		err := s.Application.SigningKeyService().RotateKeys(ctx)
+		require.NoError(t, err)
+		keys := listKeys(t)
+		require.Len(t, keys[tokenrepo.SigningKeyStateActive], 1)
+		assert.Equal(t, configuredKid, keys[tokenrepo.SigningKeyStateActive][0].KeyID)
+		assert.Empty(t, keys[tokenrepo.SigningKeyStatePending])
+	})
+
+	var pendingKid string
+	s.T().Run("pending key published ahead of the rotation", func(t *testing.T) {
+		moveBack(t, listKeys(t)[tokenrepo.SigningKeyStateActive], s.Configuration.GetSigningKeyRotationInterval())
+		err := s.Application.SigningKeyService().RotateKeys(ctx)
+		require.NoError(t, err)
+		keys := listKeys(t)
+		require.Len(t, keys[tokenrepo.SigningKeyStateActive], 1)
+		assert.Equal(t, configuredKid, keys[tokenrepo.SigningKeyStateActive][0].KeyID)
+		require.Len(t, keys[tokenrepo.SigningKeyStatePending], 1)
+		pendingKid = keys[tokenrepo.SigningKeyStatePending][0].KeyID
+		assertKeys(t, configuredKid, pendingKid)
+	})
+
+	s.T().Run("pending key activated after the prepublication period", func(t *testing.T) {
+		moveBack(t, listKeys(t)[tokenrepo.SigningKeyStatePending], s.Configuration.GetSigningKeyPrepublicationPeriod())
+		err := s.Application.SigningKeyService().RotateKeys(ctx)
+		require.NoError(t, err)
+		keys := listKeys(t)
+		require.Len(t, keys[tokenrepo.SigningKeyStateActive], 1)
+		assert.Equal(t, pendingKid, keys[tokenrepo.SigningKeyStateActive][0].KeyID)
+		assert.Contains(t, kids(keys[tokenrepo.SigningKeyStateRetiring]), configuredKid)
+		assert.Empty(t, keys[tokenrepo.SigningKeyStatePending])
+		assertKeys(t, pendingKid, configuredKid)
+	})
+
+	s.T().Run("retiring key retired after the retirement period", func(t *testing.T) {
+		moveBack(t, listKeys(t)[tokenrepo.SigningKeyStateRetiring], s.Configuration.GetSigningKeyRetirementPeriod())
+		err := s.Application.SigningKeyService().RotateKeys(ctx)
+		require.NoError(t, err)
+		keys := listKeys(t)
+		require.Len(t, keys[tokenrepo.SigningKeyStateActive], 1)
+		assert.Equal(t, pendingKid, keys[tokenrepo.SigningKeyStateActive][0].KeyID)
+		assert.Empty(t, keys[tokenrepo.SigningKeyStateRetiring])
+		assertKeys(t, pendingKid)
+		assert.Nil(t, tm.PublicKey(configuredKid))
+	})
+}
@@ -10,6 +10,7 @@ import (
 	servicecontext "github.com/fabric8-services/fabric8-auth/application/service/context"
 	accountrepo "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
 	"github.com/fabric8-services/fabric8-auth/authentication/provider"
+	permission "github.com/fabric8-services/fabric8-auth/authorization/permission/repository"
 	authtoken "github.com/fabric8-services/fabric8-auth/authorization/token"
 	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
 	tokenrepo "github.com/fabric8-services/fabric8-auth/authorization/token/repository"
@@ -22,6 +23,7 @@ import (
 	"golang.org/x/oauth2"
 
 	"sort"
+	"strings"
 	"time"
 )
 
@@ -39,7 +41,8 @@ type tokenServiceImpl struct {
 
 // NewTokenService returns a new Token Service
 func NewTokenService(context servicecontext.ServiceContext, config TokenServiceConfiguration) service.TokenService {
-	tokenManager, err := manager.NewTokenManager(config)
+	// The default token manager is used so that the token service takes the rotated signing keys into account
+	tokenManager, err := manager.DefaultManager(config)
 	if err != nil {
 		log.Panic(nil, map[string]interface{}{
 			"err": err,
@@ -344,6 +347,16 @@ func (s *tokenServiceImpl) ExchangeRefreshToken(ctx context.Context, refreshToke
 		return nil, errors.NewUnauthorizedError("unauthorized access")
 	}
 
+	// Reject the refresh token if it has been registered and subsequently revoked
+	revoked, err := s.isRevoked(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		log.Warn(ctx, map[string]interface{}{}, "revoked refresh token was used")
+		return nil, errors.NewUnauthorizedErrorWithCode("token revoked", errors.UNAUTHORIZED_CODE_TOKEN_REVOKED)
+	}
+
 	// Initialize an array of permission objects that *may* be included in the token
 	permissions := []manager.Permissions{}
 
@@ -486,6 +499,243 @@ func (s *tokenServiceImpl) ExchangeRefreshToken(ctx context.Context, refreshToke
 	return s.tokenManager.ConvertToken(*generatedToken)
 }
 
+// ExchangeToken exchanges the specified subject token, which must be the access token of a user, for an access token
+// issued to the specified actor on behalf of the user, as defined by RFC 8693. The new token is bound to the specified
+// audience, doesn't outlive the subject token and is down-scoped: it only contains the permissions for the specified
+// resource, if any, limited to the specified scopes. The scopes can't exceed the privileges of the user for the
+// resource, nor the permissions of the subject token if it was itself issued by token exchange.
+func (s *tokenServiceImpl) ExchangeToken(ctx context.Context, actorID string, subjectToken string, audience string,
+	resourceID *string, scopes []string) (*manager.TokenSet, error) {
+
+	if audience == "" {
+		return nil, errors.NewBadParameterError("audience", audience).Expected("the audience of the token")
+	}
+	if resourceID == nil && len(scopes) > 0 {
+		return nil, errors.NewBadParameterError("resource_id", nil).Expected("the resource of the requested scopes")
+	}
+
+	// Only the access tokens of the users can be exchanged
+	subjectClaims, err := s.tokenManager.ParseToken(ctx, subjectToken)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{"error": err}, "invalid subject token could not be parsed")
+		return nil, errors.NewBadParameterErrorFromString("subject_token", "", "invalid subject token could not be parsed")
+	}
+	subjectMapClaims, err := s.tokenManager.ParseTokenWithMapClaims(ctx, subjectToken)
+	if err != nil || (subjectMapClaims["typ"] != "Bearer" && subjectMapClaims["typ"] != manager.ExchangedTokenType) {
+		return nil, errors.NewBadParameterErrorFromString("subject_token", "", "the subject token is not an access token")
+	}
+	identity, err := s.loadIdentityFromSubClaim(ctx, subjectToken)
+	if err != nil {
+		if notFound, _ := errors.IsNotFoundError(err); notFound {
+			return nil, errors.NewBadParameterErrorFromString("subject_token", "", "the subject token doesn't belong to a user")
+		}
+		return nil, err
+	}
+	if identity.User.Deprovisioned {
+		return nil, errors.NewUnauthorizedErrorWithCode("token deprovisioned", errors.UNAUTHORIZED_CODE_TOKEN_DEPROVISIONED)
+	}
+
+	// The subject token must not have been revoked, if it was registered
+	subjectTokenID, err := uuid.FromString(subjectClaims.Id)
+	if err != nil {
+		return nil, errors.NewBadParameterErrorFromString("jti", subjectClaims.Id, "invalid jti identifier - not a UUID")
+	}
+	loadedToken, err := s.Repositories().TokenRepository().Load(ctx, subjectTokenID)
+	if err != nil {
+		if notFound, _ := errors.IsNotFoundError(err); !notFound {
+			return nil, errors.NewInternalError(ctx, err)
+		}
+	} else {
+		if loadedToken.HasStatus(authtoken.TOKEN_STATUS_DEPROVISIONED) {
+			return nil, errors.NewUnauthorizedErrorWithCode("token deprovisioned", errors.UNAUTHORIZED_CODE_TOKEN_DEPROVISIONED)
+		}
+		if loadedToken.HasStatus(authtoken.TOKEN_STATUS_REVOKED) || loadedToken.HasStatus(authtoken.TOKEN_STATUS_LOGGED_OUT) {
+			return nil, errors.NewUnauthorizedErrorWithCode("token revoked or logged out", errors.UNAUTHORIZED_CODE_TOKEN_REVOKED)
+		}
+	}
+
+	perms := []manager.Permissions{}
+	tokenPrivs := []tokenrepo.TokenPrivilege{}
+	if resourceID != nil {
+		err = s.Repositories().ResourceRepository().CheckExists(ctx, *resourceID)
+		if err != nil {
+			if notFound, _ := errors.IsNotFoundError(err); notFound {
+				return nil, errors.NewBadParameterErrorFromString("resource_id", *resourceID, "resource does not exist")
+			}
+			return nil, err
+		}
+		privilegeCache, err := s.Services().PrivilegeCacheService().CachedPrivileges(ctx, identity.ID, *resourceID)
+		if err != nil {
+			return nil, errors.NewInternalError(ctx, err)
+		}
+		grantedScopes := privilegeCache.ScopesAsArray()
+		// A token issued by token exchange can only be further down-scoped
+		if subjectClaims.Actor != nil {
+			grantedScopes = s.intersectScopes(grantedScopes, s.permissionScopes(subjectClaims.Permissions, *resourceID))
+		}
+		if len(scopes) == 0 {
+			scopes = grantedScopes
+		}
+		for _, scope := range scopes {
+			if !s.containsScope(grantedScopes, scope) {
+				return nil, errors.NewBadParameterErrorFromString("scope", scope, "the scope is not granted to the user for the resource")
+			}
+		}
+		perms = append(perms, manager.Permissions{
+			ResourceSetID: resourceID,
+			Scopes:        scopes,
+			Expiry:        privilegeCache.ExpiryTime.Unix(),
+		})
+		tokenPrivs = append(tokenPrivs, tokenrepo.TokenPrivilege{
+			PrivilegeCacheID: privilegeCache.PrivilegeCacheID,
+		})
+	}
+
+	// The new token is valid for the configured access token lifetime, but doesn't outlive the subject token
+	now := time.Now().Unix()
+	expiresAt := now + s.config.GetAccessTokenExpiresIn()
+	if subjectClaims.ExpiresAt != 0 && subjectClaims.ExpiresAt < expiresAt {
+		expiresAt = subjectClaims.ExpiresAt
+	}
+	tokenClaims := *subjectClaims
+	tokenClaims.Audience = audience
+	tokenClaims.IssuedAt = now
+	tokenClaims.NotBefore = 0
+	tokenClaims.ExpiresAt = expiresAt
+
+	// The prior actors of the subject token are kept in the delegation chain
+	actor := manager.Actor{
+		Subject: actorID,
+		Actor:   subjectClaims.Actor,
+	}
+
+	generatedToken, err := s.tokenManager.GenerateUnsignedExchangedTokenForIdentity(ctx, &tokenClaims, *identity, actor, perms)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	signedToken, err := s.tokenManager.SignRPTToken(ctx, generatedToken)
+	if err != nil {
+		return nil, errors.NewInternalError(ctx, err)
+	}
+	_, err = s.RegisterToken(ctx, identity.ID, signedToken, authtoken.TOKEN_TYPE_EXCHANGED, tokenPrivs)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"identity_id": identity.ID,
+		"actor_id":    actorID,
+		"audience":    audience,
+	}, "token exchanged")
+
+	tokenType := "Bearer"
+	expiresIn := expiresAt - now
+	return &manager.TokenSet{
+		AccessToken: &signedToken,
+		ExpiresIn:   &expiresIn,
+		TokenType:   &tokenType,
+	}, nil
+}
+
+// Introspect returns the state of the specified token, as defined by RFC 7662.  The token is active if its signature
+// is valid, it has not expired and, in the case of a registered token, its token record has no status flags set other
+// than STALE.  For a registered RPT token, only the permissions backed by a linked privilege which is neither stale nor
+// expired are returned.
+func (s *tokenServiceImpl) Introspect(ctx context.Context, tokenString string) (*app.TokenIntrospection, error) {
+	inactive := &app.TokenIntrospection{Active: false}
+
+	// Parse the claims from the provided token string, which also validates the signature and expiry
+	tokenClaims, err := s.tokenManager.ParseToken(ctx, tokenString)
+	if err != nil {
+		log.Info(ctx, map[string]interface{}{"error": err}, "token to introspect could not be parsed")
+		return inactive, nil
+	}
+	mapClaims, err := s.tokenManager.ParseTokenWithMapClaims(ctx, tokenString)
+	if err != nil {
+		log.Info(ctx, map[string]interface{}{"error": err}, "token to introspect could not be parsed")
+		return inactive, nil
+	}
+
+	permissions := []manager.Permissions{}
+	if tokenClaims.Permissions != nil {
+		permissions = *tokenClaims.Permissions
+	}
+
+	tokenID, err := uuid.FromString(tokenClaims.Id)
+	if err == nil {
+		loadedToken, err := s.Repositories().TokenRepository().Load(ctx, tokenID)
+		if err != nil {
+			if notFound, _ := errors.IsNotFoundError(err); !notFound {
+				return nil, errors.NewInternalError(ctx, err)
+			}
+			// This is not an error per se, the token just hasn't been registered
+			log.Debug(ctx, map[string]interface{}{
+				"token_id": tokenID,
+			}, "token to introspect not found")
+		} else {
+			// A stale token remains active, however any other status flag makes the token inactive
+			if !loadedToken.Valid() && loadedToken.Status != authtoken.TOKEN_STATUS_STALE {
+				return inactive, nil
+			}
+			privileges, err := s.Repositories().TokenRepository().ListPrivileges(ctx, loadedToken.TokenID)
+			if err != nil {
+				return nil, errors.NewInternalError(ctx, err)
+			}
+			permissions = s.validPermissions(permissions, privileges)
+		}
+	}
+
+	result := &app.TokenIntrospection{
+		Active: true,
+	}
+	if tokenClaims.Subject != "" {
+		result.Sub = &tokenClaims.Subject
+	}
+	if tokenClaims.Id != "" {
+		result.Jti = &tokenClaims.Id
+	}
+	if tokenClaims.ExpiresAt != 0 {
+		exp := int(tokenClaims.ExpiresAt)
+		result.Exp = &exp
+	}
+	if tokenClaims.IssuedAt != 0 {
+		iat := int(tokenClaims.IssuedAt)
+		result.Iat = &iat
+	}
+	if tokenClaims.Username != "" {
+		result.Username = &tokenClaims.Username
+	} else if saName, ok := mapClaims["service_accountname"].(string); ok {
+		result.Username = &saName
+	}
+	if typ, ok := mapClaims["typ"].(string); ok {
+		result.TokenType = &typ
+	}
+	if scope, ok := mapClaims["scope"].(string); ok {
+		result.Scope = &scope
+	} else if scopes, ok := mapClaims["scopes"].([]interface{}); ok {
+		values := make([]string, 0, len(scopes))
+		for _, value := range scopes {
+			values = append(values, fmt.Sprintf("%v", value))
+		}
+		scope := strings.Join(values, " ")
+		result.Scope = &scope
+	}
+	if tokenClaims.Permissions != nil {
+		result.Permissions = []*app.TokenPermission{}
+		for _, perm := range permissions {
+			exp := int(perm.Expiry)
+			result.Permissions = append(result.Permissions, &app.TokenPermission{
+				ResourceSetName: perm.ResourceSetName,
+				ResourceSetID:   perm.ResourceSetID,
+				Scopes:          perm.Scopes,
+				Exp:             &exp,
+			})
+		}
+	}
+
+	return result, nil
+}
+
 // RegisterToken creates a token record in the token repository for the specified token string
 func (s *tokenServiceImpl) RegisterToken(ctx context.Context, identityID uuid.UUID, tokenString string, tokenType string,
 	privileges []tokenrepo.TokenPrivilege) (*tokenrepo.Token, error) {
@@ -516,6 +766,12 @@ func (s *tokenServiceImpl) RegisterToken(ctx context.Context, identityID uuid.UU
 		ExpiryTime: expiryTime,
 	}
 
+	// If the token was issued by token exchange, record its audience and the client acting on behalf of the identity
+	if tokenClaims.Actor != nil {
+		tkn.Audience = &tokenClaims.Audience
+		tkn.ActorID = &tokenClaims.Actor.Subject
+	}
+
 	// Persist the token record to the database
 	err = s.ExecuteInTransaction(func() error {
 		err = s.Repositories().TokenRepository().Create(ctx, tkn)
@@ -681,6 +937,60 @@ func (c *tokenServiceImpl) DeleteExternalToken(ctx context.Context, currentIdent
 	return nil
 }
 
+// RevokeToken parses the specified token string and marks the corresponding token record as revoked.  As required by
+// RFC 7009, a token which is invalid, expired or unknown to the token repository is not treated as an error, since the
+// purpose of the revocation request (the token no longer being usable) has already been met.
+func (s *tokenServiceImpl) RevokeToken(ctx context.Context, tokenString string) error {
+	// Parse the claims from the provided token string
+	tokenClaims, err := s.tokenManager.ParseToken(ctx, tokenString)
+	if err != nil {
+		log.Info(ctx, map[string]interface{}{"error": err}, "token to revoke could not be parsed, ignoring")
+		return nil
+	}
+
+	// Extract the id from the token
+	tokenID, err := uuid.FromString(tokenClaims.Id)
+	if err != nil {
+		log.Info(ctx, map[string]interface{}{"error": err}, "could not extract token ID from token to revoke, ignoring")
+		return nil
+	}
+
+	err = s.ExecuteInTransaction(func() error {
+		loadedToken, err := s.Repositories().TokenRepository().Load(ctx, tokenID)
+		if err != nil {
+			if notFound, _ := errors.IsNotFoundError(err); notFound {
+				// This is not an error per se, so we'll just log an informational message
+				log.Info(ctx, map[string]interface{}{
+					"token_id": tokenID,
+				}, "token to revoke not found")
+				return nil
+			}
+			return err
+		}
+
+		if loadedToken.HasStatus(authtoken.TOKEN_STATUS_REVOKED) {
+			return nil
+		}
+
+		loadedToken.SetStatus(authtoken.TOKEN_STATUS_REVOKED, true)
+		return s.Repositories().TokenRepository().Save(ctx, loadedToken)
+	})
+
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":      err,
+			"token_id": tokenID,
+		}, "unable to revoke token")
+		return errors.NewInternalError(ctx, err)
+	}
+
+	log.Debug(ctx, map[string]interface{}{
+		"token_id": tokenID,
+	}, "token revoked")
+
+	return nil
+}
+
 // SetStatusForAllIdentityTokens parses the specified token string and extracts the sub claim, using it to then load
 // all tokens for that identity and setting their status flag with the specified status value
 func (s *tokenServiceImpl) SetStatusForAllIdentityTokens(ctx context.Context, accessToken *jwt.Token, status int) error {
@@ -784,6 +1094,83 @@ func (s *tokenServiceImpl) loadIdentityFromSubClaim(ctx context.Context, token s
 	return s.Repositories().Identities().LoadWithUser(ctx, identityID)
 }
 
+// isRevoked returns true if the specified token string has a corresponding token record with the REVOKED status flag
+// set.  Tokens which cannot be parsed or which have not been registered are not considered revoked.
+func (s *tokenServiceImpl) isRevoked(ctx context.Context, tokenString string) (bool, error) {
+	tokenClaims, err := s.tokenManager.ParseToken(ctx, tokenString)
+	if err != nil {
+		return false, nil
+	}
+	tokenID, err := uuid.FromString(tokenClaims.Id)
+	if err != nil {
+		return false, nil
+	}
+	loadedToken, err := s.Repositories().TokenRepository().Load(ctx, tokenID)
+	if err != nil {
+		if notFound, _ := errors.IsNotFoundError(err); notFound {
+			return false, nil
+		}
+		return false, errors.NewInternalError(ctx, err)
+	}
+	return loadedToken.HasStatus(authtoken.TOKEN_STATUS_REVOKED), nil
+}
+
+// validPermissions returns the permissions from the specified array for which there is a linked privilege that is
+// neither stale nor expired
+func (s *tokenServiceImpl) validPermissions(permissions []manager.Permissions, privileges []permission.PrivilegeCache) []manager.Permissions {
+	now := time.Now()
+	privilegesByResource := make(map[string]permission.PrivilegeCache)
+	for _, privilege := range privileges {
+		privilegesByResource[privilege.ResourceID] = privilege
+	}
+
+	result := []manager.Permissions{}
+	for _, perm := range permissions {
+		if perm.ResourceSetID == nil || time.Unix(perm.Expiry, 0).Before(now) {
+			continue
+		}
+		privilege, found := privilegesByResource[*perm.ResourceSetID]
+		if !found || privilege.Stale || privilege.ExpiryTime.Before(now) {
+			continue
+		}
+		result = append(result, perm)
+	}
+	return result
+}
+
+// permissionScopes returns the scopes of the specified permissions for the specified resource
+func (s *tokenServiceImpl) permissionScopes(permissions *[]manager.Permissions, resourceID string) []string {
+	if permissions == nil {
+		return []string{}
+	}
+	for _, perm := range *permissions {
+		if perm.ResourceSetID != nil && *perm.ResourceSetID == resourceID {
+			return perm.Scopes
+		}
+	}
+	return []string{}
+}
+
+// intersectScopes returns the scopes of the first array which are also contained in the second array
+func (s *tokenServiceImpl) intersectScopes(value1 []string, value2 []string) []string {
+	result := []string{}
+	for _, scope := range value1 {
+		if s.containsScope(value2, scope) {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+func (s *tokenServiceImpl) containsScope(scopes []string, scope string) bool {
+	for _, sc := range scopes {
+		if sc == scope {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *tokenServiceImpl) scopesEquivalent(value1 []string, value2 []string) bool {
 	if len(value1) != len(value2) {
 		return false
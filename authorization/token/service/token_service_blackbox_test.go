@@ -1052,6 +1052,170 @@ func (s *tokenServiceBlackboxTest) TestExchangeRefreshTokenWithInvalidRPTToken()
 	assert.IsType(s.T(), errors.UnauthorizedError{}, errs.Cause(err))
 }
 
+func (s *tokenServiceBlackboxTest) TestRevokeRPTToken() {
+	tm := testtoken.TokenManager
+	ctx := manager.ContextWithTokenManager(testtoken.ContextWithRequest(context.Background()), tm)
+	// create a user
+	user := s.Graph.CreateUser()
+	// Create an initial access token for the user
+	at, err := tm.GenerateUserTokenForIdentity(ctx, *user.Identity(), false)
+	require.NoError(s.T(), err)
+	// create space
+	space := s.Graph.CreateSpace().AddAdmin(user)
+	// create RPT for the space
+	rptToken, err := s.Application.TokenService().Audit(ctx, user.Identity(), at.AccessToken, space.SpaceID())
+	require.NoError(s.T(), err)
+	require.NotNil(s.T(), rptToken)
+
+	// when
+	err = s.Application.TokenService().RevokeToken(ctx, *rptToken)
+
+	// then
+	require.NoError(s.T(), err)
+	tokenClaims, err := tm.ParseToken(ctx, *rptToken)
+	require.NoError(s.T(), err)
+	tokenID, err := uuid.FromString(tokenClaims.Id)
+	require.NoError(s.T(), err)
+	tk, err := s.Application.TokenRepository().Load(ctx, tokenID)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), tk.HasStatus(token.TOKEN_STATUS_REVOKED))
+	assert.False(s.T(), tk.Valid())
+
+	// revoking the same token again is not an error
+	err = s.Application.TokenService().RevokeToken(ctx, *rptToken)
+	require.NoError(s.T(), err)
+
+	// and auditing the revoked token fails
+	_, err = s.Application.TokenService().Audit(ctx, user.Identity(), *rptToken, space.SpaceID())
+	require.Error(s.T(), err)
+	require.IsType(s.T(), errors.UnauthorizedError{}, errs.Cause(err))
+	require.Equal(s.T(), errors.UNAUTHORIZED_CODE_TOKEN_REVOKED, errs.Cause(err).(errors.UnauthorizedError).UnauthorizedCode)
+}
+
+func (s *tokenServiceBlackboxTest) TestRevokeRefreshToken() {
+	tm := testtoken.TokenManager
+	ctx := manager.ContextWithTokenManager(testtoken.ContextWithRequest(context.Background()), tm)
+	// create a user
+	user := s.Graph.CreateUser()
+	// Create an initial token for the user and register the refresh token
+	at, err := tm.GenerateUserTokenForIdentity(ctx, *user.Identity(), false)
+	require.NoError(s.T(), err)
+	_, err = s.Application.TokenService().RegisterToken(ctx, user.IdentityID(), at.RefreshToken, token.TOKEN_TYPE_REFRESH, nil)
+	require.NoError(s.T(), err)
+
+	// when
+	err = s.Application.TokenService().RevokeToken(ctx, at.RefreshToken)
+
+	// then the refresh token can no longer be exchanged
+	require.NoError(s.T(), err)
+	result, err := s.Application.TokenService().ExchangeRefreshToken(ctx, at.RefreshToken, "")
+	require.Error(s.T(), err)
+	assert.IsType(s.T(), errors.UnauthorizedError{}, errs.Cause(err))
+	assert.Empty(s.T(), result)
+}
+
+func (s *tokenServiceBlackboxTest) TestRevokeUnknownOrInvalidTokenOK() {
+	tm := testtoken.TokenManager
+	ctx := manager.ContextWithTokenManager(testtoken.ContextWithRequest(context.Background()), tm)
+
+	s.T().Run("unregistered token", func(t *testing.T) {
+		user := s.Graph.CreateUser()
+		at, err := tm.GenerateUserTokenForIdentity(ctx, *user.Identity(), false)
+		require.NoError(t, err)
+		err = s.Application.TokenService().RevokeToken(ctx, at.AccessToken)
+		require.NoError(t, err)
+	})
+
+	s.T().Run("invalid token", func(t *testing.T) {
+		err := s.Application.TokenService().RevokeToken(ctx, "foobar")
+		require.NoError(t, err)
+	})
+}
+
+func (s *tokenServiceBlackboxTest) TestIntrospectAccessToken() {
+	tm := testtoken.TokenManager
+	ctx := manager.ContextWithTokenManager(testtoken.ContextWithRequest(context.Background()), tm)
+	// create a user
+	user := s.Graph.CreateUser()
+	at, err := tm.GenerateUserTokenForIdentity(ctx, *user.Identity(), false)
+	require.NoError(s.T(), err)
+
+	s.T().Run("unregistered token is active", func(t *testing.T) {
+		// when
+		result, err := s.Application.TokenService().Introspect(ctx, at.AccessToken)
+		// then
+		require.NoError(t, err)
+		require.True(t, result.Active)
+		require.NotNil(t, result.Sub)
+		assert.Equal(t, user.IdentityID().String(), *result.Sub)
+		require.NotNil(t, result.Exp)
+		require.NotNil(t, result.Username)
+		assert.Equal(t, user.Identity().Username, *result.Username)
+		assert.Nil(t, result.Permissions)
+	})
+
+	s.T().Run("revoked token is inactive", func(t *testing.T) {
+		// given
+		_, err := s.Application.TokenService().RegisterToken(ctx, user.IdentityID(), at.AccessToken, token.TOKEN_TYPE_ACCESS, nil)
+		require.NoError(t, err)
+		err = s.Application.TokenService().RevokeToken(ctx, at.AccessToken)
+		require.NoError(t, err)
+		// when
+		result, err := s.Application.TokenService().Introspect(ctx, at.AccessToken)
+		// then
+		require.NoError(t, err)
+		assert.False(t, result.Active)
+		assert.Nil(t, result.Sub)
+	})
+
+	s.T().Run("invalid token is inactive", func(t *testing.T) {
+		// when
+		result, err := s.Application.TokenService().Introspect(ctx, "foobar")
+		// then
+		require.NoError(t, err)
+		assert.False(t, result.Active)
+	})
+}
+
+func (s *tokenServiceBlackboxTest) TestIntrospectRPTToken() {
+	tm := testtoken.TokenManager
+	ctx := manager.ContextWithTokenManager(testtoken.ContextWithRequest(context.Background()), tm)
+	// create a user
+	user := s.Graph.CreateUser()
+	at, err := tm.GenerateUserTokenForIdentity(ctx, *user.Identity(), false)
+	require.NoError(s.T(), err)
+	// create two spaces
+	space1 := s.Graph.CreateSpace().AddAdmin(user)
+	space2 := s.Graph.CreateSpace().AddViewer(user)
+	// create RPT for both spaces
+	rptToken, err := s.Application.TokenService().Audit(ctx, user.Identity(), at.AccessToken, space1.SpaceID())
+	require.NoError(s.T(), err)
+	rptToken, err = s.Application.TokenService().Audit(ctx, user.Identity(), *rptToken, space2.SpaceID())
+	require.NoError(s.T(), err)
+
+	// when
+	result, err := s.Application.TokenService().Introspect(ctx, *rptToken)
+
+	// then both permissions are returned
+	require.NoError(s.T(), err)
+	require.True(s.T(), result.Active)
+	require.Len(s.T(), result.Permissions, 2)
+
+	// given the privileges for the first space become stale
+	s.setPermissionStale(s.T(), user.IdentityID(), space1.SpaceID())
+	s.setTokenStatus(s.T(), *rptToken, token.TOKEN_STATUS_STALE)
+
+	// when
+	result, err = s.Application.TokenService().Introspect(ctx, *rptToken)
+
+	// then the token remains active, but only the permission for the second space is returned
+	require.NoError(s.T(), err)
+	require.True(s.T(), result.Active)
+	require.Len(s.T(), result.Permissions, 1)
+	assert.Equal(s.T(), space2.SpaceID(), *result.Permissions[0].ResourceSetID)
+	assert.ElementsMatch(s.T(), []string{authorization.ViewSpaceScope}, result.Permissions[0].Scopes)
+}
+
 func (s *tokenServiceBlackboxTest) setTokenStatus(t *testing.T, rptToken string, status int, resourceIDs ...string) string {
 	// Parse the signed RPT token to get the token ID
 	tm := testtoken.TokenManager
@@ -1082,3 +1246,173 @@ func (s *tokenServiceBlackboxTest) setPermissionStale(t *testing.T, identityID u
 		require.NoError(s.T(), err)
 	}
 }
+
+func (s *tokenServiceBlackboxTest) TestExchangeToken() {
+	tm := testtoken.TokenManager
+	ctx := manager.ContextWithTokenManager(testtoken.ContextWithRequest(context.Background()), tm)
+	actorID := uuid.NewV4().String()
+	audience := "https://backend.example.com"
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		space := s.Graph.CreateSpace().AddAdmin(user)
+		at, err := tm.GenerateUserTokenForIdentity(ctx, *user.Identity(), false)
+		require.NoError(t, err)
+		spaceID := space.SpaceID()
+		// when
+		result, err := s.Application.TokenService().ExchangeToken(ctx, actorID, at.AccessToken, audience, &spaceID, []string{authorization.ViewSpaceScope})
+		// then
+		require.NoError(t, err)
+		require.NotNil(t, result.AccessToken)
+		require.NotNil(t, result.ExpiresIn)
+		assert.True(t, *result.ExpiresIn > 0)
+		claims, err := tm.ParseToken(ctx, *result.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user.IdentityID().String(), claims.Subject)
+		assert.Equal(t, audience, claims.Audience)
+		require.NotNil(t, claims.Actor)
+		assert.Equal(t, actorID, claims.Actor.Subject)
+		assert.Nil(t, claims.Actor.Actor)
+		mapClaims, err := tm.ParseTokenWithMapClaims(ctx, *result.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, manager.ExchangedTokenType, mapClaims["typ"])
+		require.NotNil(t, claims.Permissions)
+		require.Len(t, *claims.Permissions, 1)
+		assert.Equal(t, spaceID, *(*claims.Permissions)[0].ResourceSetID)
+		assert.Equal(t, []string{authorization.ViewSpaceScope}, (*claims.Permissions)[0].Scopes)
+		// and the token is recorded along with its actor
+		tokenID, err := uuid.FromString(claims.Id)
+		require.NoError(t, err)
+		tk, err := s.Application.TokenRepository().Load(ctx, tokenID)
+		require.NoError(t, err)
+		assert.Equal(t, token.TOKEN_TYPE_EXCHANGED, tk.TokenType)
+		require.NotNil(t, tk.Audience)
+		assert.Equal(t, audience, *tk.Audience)
+		require.NotNil(t, tk.ActorID)
+		assert.Equal(t, actorID, *tk.ActorID)
+		privileges, err := s.Application.TokenRepository().ListPrivileges(ctx, tokenID)
+		require.NoError(t, err)
+		require.Len(t, privileges, 1)
+		assert.Equal(t, spaceID, privileges[0].ResourceID)
+	})
+
+	s.T().Run("all scopes of the user by default", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		space := s.Graph.CreateSpace().AddContributor(user)
+		at, err := tm.GenerateUserTokenForIdentity(ctx, *user.Identity(), false)
+		require.NoError(t, err)
+		spaceID := space.SpaceID()
+		// when
+		result, err := s.Application.TokenService().ExchangeToken(ctx, actorID, at.AccessToken, audience, &spaceID, nil)
+		// then
+		require.NoError(t, err)
+		claims, err := tm.ParseToken(ctx, *result.AccessToken)
+		require.NoError(t, err)
+		privilegeCache, err := s.Application.PrivilegeCacheService().CachedPrivileges(ctx, user.IdentityID(), spaceID)
+		require.NoError(t, err)
+		require.Len(t, *claims.Permissions, 1)
+		assert.ElementsMatch(t, privilegeCache.ScopesAsArray(), (*claims.Permissions)[0].Scopes)
+	})
+
+	s.T().Run("no resource", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		at, err := tm.GenerateUserTokenForIdentity(ctx, *user.Identity(), false)
+		require.NoError(t, err)
+		// when
+		result, err := s.Application.TokenService().ExchangeToken(ctx, actorID, at.AccessToken, audience, nil, nil)
+		// then
+		require.NoError(t, err)
+		claims, err := tm.ParseToken(ctx, *result.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, audience, claims.Audience)
+		require.NotNil(t, claims.Permissions)
+		assert.Empty(t, *claims.Permissions)
+	})
+
+	s.T().Run("scope not granted to the user", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		space := s.Graph.CreateSpace().AddViewer(user)
+		at, err := tm.GenerateUserTokenForIdentity(ctx, *user.Identity(), false)
+		require.NoError(t, err)
+		spaceID := space.SpaceID()
+		// when
+		_, err = s.Application.TokenService().ExchangeToken(ctx, actorID, at.AccessToken, audience, &spaceID, []string{authorization.ManageSpaceScope})
+		// then
+		require.Error(t, err)
+		assert.IsType(t, errors.BadParameterError{}, errs.Cause(err))
+	})
+
+	s.T().Run("exchanged token can only be further down-scoped", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		space := s.Graph.CreateSpace().AddAdmin(user)
+		at, err := tm.GenerateUserTokenForIdentity(ctx, *user.Identity(), false)
+		require.NoError(t, err)
+		spaceID := space.SpaceID()
+		exchanged, err := s.Application.TokenService().ExchangeToken(ctx, actorID, at.AccessToken, audience, &spaceID, []string{authorization.ViewSpaceScope})
+		require.NoError(t, err)
+		otherActorID := uuid.NewV4().String()
+
+		// when requesting a scope which is not in the exchanged token
+		_, err = s.Application.TokenService().ExchangeToken(ctx, otherActorID, *exchanged.AccessToken, "https://other.example.com", &spaceID, []string{authorization.ManageSpaceScope})
+		// then
+		require.Error(t, err)
+		assert.IsType(t, errors.BadParameterError{}, errs.Cause(err))
+
+		// when requesting the default scopes
+		result, err := s.Application.TokenService().ExchangeToken(ctx, otherActorID, *exchanged.AccessToken, "https://other.example.com", &spaceID, nil)
+		// then only the scopes of the exchanged token are included, and the delegation chain is kept
+		require.NoError(t, err)
+		claims, err := tm.ParseToken(ctx, *result.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, []string{authorization.ViewSpaceScope}, (*claims.Permissions)[0].Scopes)
+		require.NotNil(t, claims.Actor)
+		assert.Equal(t, otherActorID, claims.Actor.Subject)
+		require.NotNil(t, claims.Actor.Actor)
+		assert.Equal(t, actorID, claims.Actor.Actor.Subject)
+	})
+
+	s.T().Run("revoked subject token", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		at, err := tm.GenerateUserTokenForIdentity(ctx, *user.Identity(), false)
+		require.NoError(t, err)
+		_, err = s.Application.TokenService().RegisterToken(ctx, user.IdentityID(), at.AccessToken, token.TOKEN_TYPE_ACCESS, nil)
+		require.NoError(t, err)
+		err = s.Application.TokenService().RevokeToken(ctx, at.AccessToken)
+		require.NoError(t, err)
+		// when
+		_, err = s.Application.TokenService().ExchangeToken(ctx, actorID, at.AccessToken, audience, nil, nil)
+		// then
+		require.Error(t, err)
+		assert.IsType(t, errors.UnauthorizedError{}, errs.Cause(err))
+	})
+
+	s.T().Run("refresh token as subject token", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		at, err := tm.GenerateUserTokenForIdentity(ctx, *user.Identity(), false)
+		require.NoError(t, err)
+		// when
+		_, err = s.Application.TokenService().ExchangeToken(ctx, actorID, at.RefreshToken, audience, nil, nil)
+		// then
+		require.Error(t, err)
+		assert.IsType(t, errors.BadParameterError{}, errs.Cause(err))
+	})
+
+	s.T().Run("missing audience", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		at, err := tm.GenerateUserTokenForIdentity(ctx, *user.Identity(), false)
+		require.NoError(t, err)
+		// when
+		_, err = s.Application.TokenService().ExchangeToken(ctx, actorID, at.AccessToken, "", nil, nil)
+		// then
+		require.Error(t, err)
+		assert.IsType(t, errors.BadParameterError{}, errs.Cause(err))
+	})
+}
@@ -0,0 +1,52 @@
+package token
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+)
+
+// SigningMethodEdDSA implements the EdDSA signing method with Ed25519 keys, as defined by RFC 8037.
+// It is not provided by the jwt-go library, so it is registered when this package is loaded.
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+// ErrEdDSAVerification is returned when the EdDSA signature of a token is invalid
+var ErrEdDSAVerification = errors.New("crypto/ed25519: verification error")
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+type signingMethodEdDSA struct{}
+
+// Alg implements jwt.SigningMethod
+func (m *signingMethodEdDSA) Alg() string {
+	return AlgorithmEdDSA
+}
+
+// Verify implements jwt.SigningMethod. The key must be an ed25519.PublicKey.
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok || len(publicKey) != ed25519.PublicKeySize {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return ErrEdDSAVerification
+	}
+	return nil
+}
+
+// Sign implements jwt.SigningMethod. The key must be an ed25519.PrivateKey.
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok || len(privateKey) != ed25519.PrivateKeySize {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
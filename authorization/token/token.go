@@ -2,7 +2,7 @@ package token
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto"
 	"github.com/dgrijalva/jwt-go"
 	goajwt "github.com/goadesign/goa/middleware/security/jwt"
 )
@@ -32,21 +32,39 @@ const (
 	TOKEN_STATUS_LOGGED_OUT    = 4
 	TOKEN_STATUS_STALE         = 8
 
-	TOKEN_TYPE_RPT     = "RPT"
-	TOKEN_TYPE_ACCESS  = "ACC"
-	TOKEN_TYPE_REFRESH = "REF"
+	TOKEN_TYPE_RPT       = "RPT"
+	TOKEN_TYPE_ACCESS    = "ACC"
+	TOKEN_TYPE_REFRESH   = "REF"
+	TOKEN_TYPE_EXCHANGED = "EXC"
 )
 
-// PrivateKey represents an RSA private key with a Key ID
+// PrivateKey represents an RSA, ECDSA P-256 or Ed25519 private key with a Key ID
 type PrivateKey struct {
 	KeyID string
-	Key   *rsa.PrivateKey
+	// Either a *rsa.PrivateKey, a *ecdsa.PrivateKey or an ed25519.PrivateKey
+	Key crypto.Signer
 }
 
-// PublicKey represents an RSA public key with a Key ID
+// PublicKey returns the public key of the private key, with the same Key ID
+func (k *PrivateKey) PublicKey() *PublicKey {
+	return &PublicKey{KeyID: k.KeyID, Key: k.Key.Public()}
+}
+
+// SigningMethod returns the method used to sign tokens with the private key
+func (k *PrivateKey) SigningMethod() jwt.SigningMethod {
+	return SigningMethod(k.Key.Public())
+}
+
+// PublicKey represents an RSA, ECDSA P-256 or Ed25519 public key with a Key ID
 type PublicKey struct {
 	KeyID string
-	Key   *rsa.PublicKey
+	// Either a *rsa.PublicKey, a *ecdsa.PublicKey or an ed25519.PublicKey
+	Key crypto.PublicKey
+}
+
+// Algorithm returns the algorithm of the tokens signed with the matching private key, as defined by RFC 7518
+func (k *PublicKey) Algorithm() string {
+	return SigningMethod(k.Key).Alg()
 }
 
 // JSONKeys the remote keys encoded in a json document
@@ -2,6 +2,7 @@ package configuration
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"net/url"
 	"os"
@@ -50,6 +51,7 @@ const (
 	varUsersListLimit                  = "users.listlimit"
 	defaultConfigFile                  = "config.yaml"
 	varValidRedirectURLs               = "redirect.valid"
+	varRedirectValidationLogOnly       = "redirect.validation.logonly"
 	varLogLevel                        = "log.level"
 	varLogJSON                         = "log.json"
 	varEmailVerifiedRedirectURL        = "email.verify.url"
@@ -184,9 +186,50 @@ const (
 	// Public Client ID for logging into Auth service via OAuth2
 	varPublicOAuthClientID = "public.oauth.client.id"
 
+	// Device authorization grant, see RFC 8628
+	varDeviceCodeExpirySeconds          = "device.code.expiry.seconds"
+	varDeviceCodePollingIntervalSeconds = "device.code.polling.interval.seconds"
+
 	// Cluster information refresh interval in nanoseconds
 	varClusterRefreshInterval = "cluster.refresh.int"
 
+	// Signing key rotation
+	varSigningKeyRotationEnabled      = "signing.key.rotation.enabled"
+	varSigningKeyRotationInterval     = "signing.key.rotation.interval"
+	varSigningKeyPrepublicationPeriod = "signing.key.prepublication.period"
+	varSigningKeyRetirementPeriod     = "signing.key.retirement.period"
+	varSigningKeyRefreshInterval      = "signing.key.refresh.interval"
+	varSigningKeyAlgorithm            = "signing.key.algorithm"
+	varSigningKeyEncryptionKey        = "signing.key.encryption.key"
+
+	// Retention of the deleted and deprovisioned accounts and of the stale data
+	varRetentionEnabled                      = "retention.enabled"
+	varRetentionInterval                     = "retention.interval"
+	varRetentionBatchSize                    = "retention.batch.size"
+	varRetentionDeletedUserGracePeriod       = "retention.deleted.user.grace.period"
+	varRetentionDeprovisionedUserGracePeriod = "retention.deprovisioned.user.grace.period"
+	varRetentionExternalTokenGracePeriod     = "retention.external.token.grace.period"
+	varRetentionVerificationCodeGracePeriod  = "retention.verification.code.grace.period"
+	varRetentionOAuthStateGracePeriod        = "retention.oauth.state.grace.period"
+	varRetentionPrivilegeCacheGracePeriod    = "retention.privilege.cache.grace.period"
+
+	// Deletion of the accounts requested by their users
+	varUserDeletionEnabled          = "user.deletion.enabled"
+	varUserDeletionCoolingOffPeriod = "user.deletion.cooling.off.period"
+	varUserDeletionInterval         = "user.deletion.interval"
+	varUserDeletionBatchSize        = "user.deletion.batch.size"
+
+	// Revocation of the expired role assignments
+	varRoleExpiryEnabled   = "role.expiry.enabled"
+	varRoleExpiryInterval  = "role.expiry.interval"
+	varRoleExpiryBatchSize = "role.expiry.batch.size"
+
+	// Usernames released by a username change
+	varUsernameQuarantinePeriod = "user.username.quarantine.period"
+
+	// Reverting a change of the email address
+	varEmailRevertPeriod = "user.email.revert.period"
+
 	// sentry
 	varEnvironment = "environment"
 	varSentryDSN   = "sentry.dsn"
@@ -290,6 +333,9 @@ func NewConfigurationData(mainConfigFile string, serviceAccountConfigFile string
 	if c.GetValidRedirectURLs() == ".*" {
 		c.appendDefaultConfigErrorMessage("no restrictions for valid redirect URLs")
 	}
+	if c.IsRedirectValidationLogOnly() {
+		c.appendDefaultConfigErrorMessage("invalid redirect URLs are logged but not rejected")
+	}
 	c.validateURL(c.GetNotificationServiceURL(), "notification service")
 	if c.GetAccessTokenExpiresIn() < 3*60 {
 		c.appendDefaultConfigErrorMessage("too short lifespan of access tokens")
@@ -315,6 +361,59 @@ func NewConfigurationData(mainConfigFile string, serviceAccountConfigFile string
 	if c.GetClusterCacheRefreshInterval() < 5*time.Second || c.GetClusterCacheRefreshInterval() > time.Hour {
 		c.appendDefaultConfigErrorMessage("Cluster cache refresh interval is less than five seconds or more than one hour")
 	}
+	if c.IsSigningKeyRotationEnabled() {
+		if c.GetSigningKeyRetirementPeriod() < time.Duration(c.GetRefreshTokenExpiresIn())*time.Second ||
+			c.GetSigningKeyRetirementPeriod() < time.Duration(c.GetAccessTokenExpiresIn())*time.Second {
+			c.appendDefaultConfigErrorMessage("signing key retirement period is shorter than the lifespan of tokens")
+		}
+		if c.GetSigningKeyPrepublicationPeriod() >= c.GetSigningKeyRotationInterval() {
+			c.appendDefaultConfigErrorMessage("signing key prepublication period is not shorter than the rotation interval")
+		}
+		switch c.GetSigningKeyAlgorithm() {
+		case "RS256", "ES256", "EdDSA":
+		default:
+			c.appendDefaultConfigErrorMessage(fmt.Sprintf("unsupported signing key algorithm: %s", c.GetSigningKeyAlgorithm()))
+		}
+		if len(c.GetSigningKeyEncryptionKey()) != 32 {
+			c.appendDefaultConfigErrorMessage("signing key encryption key is not a base64 encoded 256-bit key")
+		}
+		if c.v.GetString(varSigningKeyEncryptionKey) == defaultSigningKeyEncryptionKey {
+			c.appendDefaultConfigErrorMessage("default signing key encryption key is used")
+		}
+	}
+	if c.IsRetentionEnabled() {
+		if c.GetRetentionInterval() < time.Minute {
+			c.appendDefaultConfigErrorMessage("retention interval is less than one minute")
+		}
+		if c.GetRetentionBatchSize() <= 0 {
+			c.appendDefaultConfigErrorMessage("retention batch size is not positive")
+		}
+	}
+	if c.GetUserDeletionCoolingOffPeriod() < 0 {
+		c.appendDefaultConfigErrorMessage("user deletion cooling-off period is negative")
+	}
+	if c.IsUserDeletionEnabled() {
+		if c.GetUserDeletionInterval() < time.Minute {
+			c.appendDefaultConfigErrorMessage("user deletion interval is less than one minute")
+		}
+		if c.GetUserDeletionBatchSize() <= 0 {
+			c.appendDefaultConfigErrorMessage("user deletion batch size is not positive")
+		}
+	}
+	if c.IsRoleExpiryEnabled() {
+		if c.GetRoleExpiryInterval() < time.Minute {
+			c.appendDefaultConfigErrorMessage("role expiry interval is less than one minute")
+		}
+		if c.GetRoleExpiryBatchSize() <= 0 {
+			c.appendDefaultConfigErrorMessage("role expiry batch size is not positive")
+		}
+	}
+	if c.GetUsernameQuarantinePeriod() < 0 {
+		c.appendDefaultConfigErrorMessage("username quarantine period is negative")
+	}
+	if c.GetEmailRevertPeriod() <= 0 {
+		c.appendDefaultConfigErrorMessage("email revert period is not positive")
+	}
 	if c.defaultConfigurationError != nil {
 		log.WithFields(map[string]interface{}{
 			"default_configuration_error": c.defaultConfigurationError.Error(),
@@ -494,6 +593,153 @@ func (c *ConfigurationData) GetClusterCacheRefreshInterval() time.Duration {
 	return c.v.GetDuration(varClusterRefreshInterval)
 }
 
+// IsSigningKeyRotationEnabled returns true if the keys used to sign tokens are stored in the DB and rotated
+// periodically. Otherwise the user account and service account private keys of the configuration are used.
+func (c *ConfigurationData) IsSigningKeyRotationEnabled() bool {
+	return c.v.GetBool(varSigningKeyRotationEnabled)
+}
+
+// GetSigningKeyRotationInterval returns how long a signing key is used to sign tokens before it is replaced by a new key
+func (c *ConfigurationData) GetSigningKeyRotationInterval() time.Duration {
+	return c.v.GetDuration(varSigningKeyRotationInterval)
+}
+
+// GetSigningKeyPrepublicationPeriod returns how long a new signing key is published before it is used to sign tokens,
+// so that the clients which cache the published keys know the new key before it is used
+func (c *ConfigurationData) GetSigningKeyPrepublicationPeriod() time.Duration {
+	return c.v.GetDuration(varSigningKeyPrepublicationPeriod)
+}
+
+// GetSigningKeyRetirementPeriod returns how long a replaced signing key is still published, so that the tokens it
+// signed remain valid. Should be longer than the lifespan of the access and refresh tokens.
+func (c *ConfigurationData) GetSigningKeyRetirementPeriod() time.Duration {
+	return c.v.GetDuration(varSigningKeyRetirementPeriod)
+}
+
+// GetSigningKeyRefreshInterval returns the interval between two refreshes of the signing keys, when the scheduled
+// rotations are applied and the keys are reloaded from the DB
+func (c *ConfigurationData) GetSigningKeyRefreshInterval() time.Duration {
+	return c.v.GetDuration(varSigningKeyRefreshInterval)
+}
+
+// GetSigningKeyAlgorithm returns the algorithm of the signing keys generated when the keys are rotated: RS256 for
+// RSA keys, ES256 for ECDSA P-256 keys or EdDSA for Ed25519 keys
+func (c *ConfigurationData) GetSigningKeyAlgorithm() string {
+	return c.v.GetString(varSigningKeyAlgorithm)
+}
+
+// GetSigningKeyEncryptionKey returns the AES-256 key with which the rotated signing keys are encrypted in the DB, so
+// that the private keys can't be read from the DB alone. Returns nil if the configured key is not valid base64.
+func (c *ConfigurationData) GetSigningKeyEncryptionKey() []byte {
+	key, err := base64.StdEncoding.DecodeString(c.v.GetString(varSigningKeyEncryptionKey))
+	if err != nil {
+		return nil
+	}
+	return key
+}
+
+// IsRetentionEnabled returns true if the data kept beyond its retention period is periodically purged
+func (c *ConfigurationData) IsRetentionEnabled() bool {
+	return c.v.GetBool(varRetentionEnabled)
+}
+
+// GetRetentionInterval returns the interval between two purges of the data kept beyond its retention period
+func (c *ConfigurationData) GetRetentionInterval() time.Duration {
+	return c.v.GetDuration(varRetentionInterval)
+}
+
+// GetRetentionBatchSize returns the maximum number of users purged at once
+func (c *ConfigurationData) GetRetentionBatchSize() int {
+	return c.v.GetInt(varRetentionBatchSize)
+}
+
+// GetRetentionDeletedUserGracePeriod returns how long the soft-deleted users are kept before being purged.
+// A zero grace period disables the purge.
+func (c *ConfigurationData) GetRetentionDeletedUserGracePeriod() time.Duration {
+	return c.v.GetDuration(varRetentionDeletedUserGracePeriod)
+}
+
+// GetRetentionDeprovisionedUserGracePeriod returns how long the deprovisioned users are kept since their last update
+// before being purged. A zero grace period disables the purge.
+func (c *ConfigurationData) GetRetentionDeprovisionedUserGracePeriod() time.Duration {
+	return c.v.GetDuration(varRetentionDeprovisionedUserGracePeriod)
+}
+
+// GetRetentionExternalTokenGracePeriod returns how long the external tokens of the deleted identities are kept before
+// being purged. A zero grace period disables the purge.
+func (c *ConfigurationData) GetRetentionExternalTokenGracePeriod() time.Duration {
+	return c.v.GetDuration(varRetentionExternalTokenGracePeriod)
+}
+
+// GetRetentionVerificationCodeGracePeriod returns how long the email verification codes are kept before being purged.
+// A zero grace period disables the purge.
+func (c *ConfigurationData) GetRetentionVerificationCodeGracePeriod() time.Duration {
+	return c.v.GetDuration(varRetentionVerificationCodeGracePeriod)
+}
+
+// GetRetentionOAuthStateGracePeriod returns how long the OAuth state references are kept before being purged.
+// A zero grace period disables the purge.
+func (c *ConfigurationData) GetRetentionOAuthStateGracePeriod() time.Duration {
+	return c.v.GetDuration(varRetentionOAuthStateGracePeriod)
+}
+
+// GetRetentionPrivilegeCacheGracePeriod returns how long the expired privilege caches are kept before being purged.
+// A zero grace period disables the purge.
+func (c *ConfigurationData) GetRetentionPrivilegeCacheGracePeriod() time.Duration {
+	return c.v.GetDuration(varRetentionPrivilegeCacheGracePeriod)
+}
+
+// IsUserDeletionEnabled returns true if the accounts whose deletion was requested by their users are periodically
+// deleted at the end of their cooling-off period
+func (c *ConfigurationData) IsUserDeletionEnabled() bool {
+	return c.v.GetBool(varUserDeletionEnabled)
+}
+
+// GetUserDeletionCoolingOffPeriod returns how long the users can cancel the deletion of their account after requesting
+// it, before the account is deleted
+func (c *ConfigurationData) GetUserDeletionCoolingOffPeriod() time.Duration {
+	return c.v.GetDuration(varUserDeletionCoolingOffPeriod)
+}
+
+// GetUserDeletionInterval returns the interval between two runs of the deletion of the accounts whose cooling-off
+// period is over
+func (c *ConfigurationData) GetUserDeletionInterval() time.Duration {
+	return c.v.GetDuration(varUserDeletionInterval)
+}
+
+// GetUserDeletionBatchSize returns the maximum number of accounts deleted at once
+func (c *ConfigurationData) GetUserDeletionBatchSize() int {
+	return c.v.GetInt(varUserDeletionBatchSize)
+}
+
+// IsRoleExpiryEnabled returns true if the role assignments whose validity window is over are periodically revoked
+func (c *ConfigurationData) IsRoleExpiryEnabled() bool {
+	return c.v.GetBool(varRoleExpiryEnabled)
+}
+
+// GetRoleExpiryInterval returns the interval between two runs of the revocation of the role assignments whose
+// validity window is over
+func (c *ConfigurationData) GetRoleExpiryInterval() time.Duration {
+	return c.v.GetDuration(varRoleExpiryInterval)
+}
+
+// GetRoleExpiryBatchSize returns the maximum number of expired role assignments revoked at once
+func (c *ConfigurationData) GetRoleExpiryBatchSize() int {
+	return c.v.GetInt(varRoleExpiryBatchSize)
+}
+
+// GetUsernameQuarantinePeriod returns how long a username released by a username change can't be claimed by another
+// user. The previous owner of the username can claim it back at any time.
+func (c *ConfigurationData) GetUsernameQuarantinePeriod() time.Duration {
+	return c.v.GetDuration(varUsernameQuarantinePeriod)
+}
+
+// GetEmailRevertPeriod returns how long the code sent to the previous email address of a user can revert the change
+// of the email address
+func (c *ConfigurationData) GetEmailRevertPeriod() time.Duration {
+	return c.v.GetDuration(varEmailRevertPeriod)
+}
+
 // GetDefaultConfigurationFile returns the default configuration file.
 func (c *ConfigurationData) GetDefaultConfigurationFile() string {
 	return defaultConfigFile
@@ -565,6 +811,9 @@ func (c *ConfigurationData) setConfigDefaults() {
 	// Enable development related features, e.g. token generation endpoint
 	c.v.SetDefault(varDeveloperModeEnabled, false)
 
+	// By default, the invalid redirect URLs are rejected
+	c.v.SetDefault(varRedirectValidationLogOnly, false)
+
 	// By default, test data should be cleaned from DB, unless explicitely said otherwise.
 	c.v.SetDefault(varCleanTestDataEnabled, true)
 	// By default, DB logs are not output in the console
@@ -623,9 +872,50 @@ func (c *ConfigurationData) setConfigDefaults() {
 	// RPT Token maximum permissions
 	c.v.SetDefault(varRPTTokenMaxPermissions, 10)
 
+	// Device authorization grant
+	c.v.SetDefault(varDeviceCodeExpirySeconds, 10*60)
+	c.v.SetDefault(varDeviceCodePollingIntervalSeconds, 5)
+
 	// Cluster service
 	c.v.SetDefault(varShortClusterServiceURL, "http://f8cluster")
 	c.v.SetDefault(varClusterRefreshInterval, 5*time.Minute) // 5 minutes
+
+	// Signing key rotation
+	c.v.SetDefault(varSigningKeyRotationEnabled, false)
+	c.v.SetDefault(varSigningKeyRotationInterval, 90*24*time.Hour)  // 90 days
+	c.v.SetDefault(varSigningKeyPrepublicationPeriod, 24*time.Hour) // 1 day
+	c.v.SetDefault(varSigningKeyRetirementPeriod, 31*24*time.Hour)  // 31 days, longer than the lifespan of tokens
+	c.v.SetDefault(varSigningKeyRefreshInterval, 5*time.Minute)     // 5 minutes
+	c.v.SetDefault(varSigningKeyAlgorithm, "RS256")
+	c.v.SetDefault(varSigningKeyEncryptionKey, defaultSigningKeyEncryptionKey)
+
+	// Retention
+	c.v.SetDefault(varRetentionEnabled, false)
+	c.v.SetDefault(varRetentionInterval, time.Hour)
+	c.v.SetDefault(varRetentionBatchSize, 100)
+	c.v.SetDefault(varRetentionDeletedUserGracePeriod, 30*24*time.Hour)       // 30 days
+	c.v.SetDefault(varRetentionDeprovisionedUserGracePeriod, 90*24*time.Hour) // 90 days
+	c.v.SetDefault(varRetentionExternalTokenGracePeriod, 24*time.Hour)        // 1 day
+	c.v.SetDefault(varRetentionVerificationCodeGracePeriod, 30*24*time.Hour)  // 30 days
+	c.v.SetDefault(varRetentionOAuthStateGracePeriod, 24*time.Hour)           // 1 day
+	c.v.SetDefault(varRetentionPrivilegeCacheGracePeriod, 24*time.Hour)       // 1 day
+
+	// User deletion
+	c.v.SetDefault(varUserDeletionEnabled, false)
+	c.v.SetDefault(varUserDeletionCoolingOffPeriod, 14*24*time.Hour) // 14 days
+	c.v.SetDefault(varUserDeletionInterval, time.Hour)
+	c.v.SetDefault(varUserDeletionBatchSize, 100)
+
+	// Role expiry
+	c.v.SetDefault(varRoleExpiryEnabled, false)
+	c.v.SetDefault(varRoleExpiryInterval, 5*time.Minute)
+	c.v.SetDefault(varRoleExpiryBatchSize, 100)
+
+	// Username changes
+	c.v.SetDefault(varUsernameQuarantinePeriod, 90*24*time.Hour) // 90 days
+
+	// Email changes
+	c.v.SetDefault(varEmailRevertPeriod, 7*24*time.Hour) // 7 days
 }
 
 // GetEmailVerifiedRedirectURL returns the url where the user would be redirected to after clicking on email
@@ -984,6 +1274,13 @@ func (c *ConfigurationData) GetValidRedirectURLs() string {
 	return DefaultValidRedirectURLs
 }
 
+// IsRedirectValidationLogOnly returns true if the redirect URLs which are not valid for the client of the request
+// should only be logged instead of being rejected. This allows tightening the redirect rules of the clients without
+// breaking them. (default: false)
+func (c *ConfigurationData) IsRedirectValidationLogOnly() bool {
+	return c.v.GetBool(varRedirectValidationLogOnly)
+}
+
 // GetInternalUsersEmailAddressSuffix returns the email address suffix of employees who can opt-in for the 'internal' features.
 func (c *ConfigurationData) GetInternalUsersEmailAddressSuffix() string {
 	return c.v.GetString(varInternalUsersEmailAddressSuffix)
@@ -1011,3 +1308,14 @@ func (c *ConfigurationData) GetPrivilegeCacheExpirySeconds() int64 {
 func (c *ConfigurationData) GetRPTTokenMaxPermissions() int {
 	return c.v.GetInt(varRPTTokenMaxPermissions)
 }
+
+// GetDeviceCodeExpirySeconds returns the number of seconds after which a device code and its user code expire
+func (c *ConfigurationData) GetDeviceCodeExpirySeconds() int {
+	return c.v.GetInt(varDeviceCodeExpirySeconds)
+}
+
+// GetDeviceCodePollingIntervalSeconds returns the minimum number of seconds that a device should wait between
+// polling requests to the token endpoint
+func (c *ConfigurationData) GetDeviceCodePollingIntervalSeconds() int {
+	return c.v.GetInt(varDeviceCodePollingIntervalSeconds)
+}
@@ -67,6 +67,10 @@ qCn3Rug8QWyBjjxnU3CxPRiLSmEllQAAVlzfRWn6kL4RKSyruUhZaA==
 
 	defaultUserAccountPrivateKeyID = "aUGv8mQA85jg4V1DU8Uk1W0uKsxn187KQONAGl6AMtc"
 
+	// defaultSigningKeyEncryptionKey is the base64 encoded AES-256 key with which the rotated signing keys are encrypted
+	// in the DB
+	defaultSigningKeyEncryptionKey = "NUs3N+RvZQZG0NDYat3uuUS0mMlopkQlcNhG3+vh8U8="
+
 	devModePublicKey = `-----BEGIN RSA PUBLIC KEY-----
 MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAvQ8p+HsTMrgcsuIMoOR1
 LXRhynL9YAU0qoDON6PLKCpdBv0Xy/jnsPjo5DrtUOijuJcID8CR7E0hYpY9MgK5
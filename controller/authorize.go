@@ -4,28 +4,21 @@ import (
 	"github.com/fabric8-services/fabric8-auth/app"
 	"github.com/fabric8-services/fabric8-auth/application"
 	"github.com/fabric8-services/fabric8-auth/client"
-	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/jsonapi"
-	"github.com/fabric8-services/fabric8-auth/log"
 	"github.com/fabric8-services/fabric8-auth/rest"
 
 	"github.com/goadesign/goa"
 )
 
-type AuthorizeControllerConfiguration interface {
-	GetPublicOAuthClientID() string
-}
-
 // AuthorizeController implements the authorize resource.
 type AuthorizeController struct {
 	*goa.Controller
-	app    application.Application
-	config AuthorizeControllerConfiguration
+	app application.Application
 }
 
 // NewAuthorizeController returns a new AuthorizeController
-func NewAuthorizeController(service *goa.Service, app application.Application, config AuthorizeControllerConfiguration) *AuthorizeController {
-	return &AuthorizeController{Controller: service.NewController("AuthorizeController"), app: app, config: config}
+func NewAuthorizeController(service *goa.Service, app application.Application) *AuthorizeController {
+	return &AuthorizeController{Controller: service.NewController("AuthorizeController"), app: app}
 }
 
 // Authorize runs the authorize action of /api/authorize endpoint.
@@ -37,19 +30,11 @@ func (c *AuthorizeController) Authorize(ctx *app.AuthorizeAuthorizeContext) erro
 		scopes = []string{*ctx.Scope}
 	}
 
-	// Default value of this public client id is set to "740650a2-9c44-4db5-b067-a3d1b2cd2d01"
-	if ctx.ClientID != c.config.GetPublicOAuthClientID() {
-		log.Error(ctx, map[string]interface{}{
-			"client_id": ctx.ClientID,
-		}, "unknown oauth client id")
-		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("invalid oauth client id"))
-	}
-
 	// Get the URL of the callback endpoint, the client will be redirected here after being redirected to the authentication provider
 	callbackURL := rest.AbsoluteURL(ctx.RequestData, client.CallbackAuthorizePath(), nil)
 
 	redirectTo, err := c.app.AuthenticationProviderService().GenerateAuthCodeURL(ctx, &ctx.RedirectURI, ctx.APIClient,
-		&ctx.State, scopes, ctx.ResponseMode, ctx.RequestData.Header.Get("Referer"), callbackURL)
+		&ctx.State, scopes, ctx.ResponseMode, ctx.RequestData.Header.Get("Referer"), callbackURL, ctx.CodeChallenge, ctx.CodeChallengeMethod, ctx.Nonce, &ctx.ClientID)
 	if err != nil {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
@@ -73,3 +58,36 @@ func (c *AuthorizeController) Callback(ctx *app.CallbackAuthorizeContext) error
 	ctx.ResponseData.Header().Set("Location", *redirectTo)
 	return ctx.TemporaryRedirect()
 }
+
+// Device runs the device action of /api/authorize/device endpoint. It issues a device code and a user code for
+// the device authorization grant, as defined by RFC 8628.
+func (c *AuthorizeController) Device(ctx *app.DeviceAuthorizeContext) error {
+	// Get the URL of the verification endpoint, the user will visit this URL in order to approve the device
+	verificationURI := rest.AbsoluteURL(ctx.RequestData, client.VerifyAuthorizePath(), nil)
+
+	deviceAuthorization, err := c.app.DeviceAuthorizationService().AuthorizeDevice(ctx, ctx.Payload.ClientID,
+		ctx.Payload.Scope, verificationURI)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	ctx.ResponseData.Header().Set("Cache-Control", "no-store")
+	return ctx.OK(deviceAuthorization)
+}
+
+// Verify runs the verify action of /api/authorize/device/verify endpoint. It redirects the user to the authentication
+// provider in order to approve the device identified by the user code.
+func (c *AuthorizeController) Verify(ctx *app.VerifyAuthorizeContext) error {
+	// Get the URL of the callback endpoint, the user will be redirected here after being redirected to the authentication provider
+	callbackURL := rest.AbsoluteURL(ctx.RequestData, client.CallbackAuthorizePath(), nil)
+
+	redirectTo, err := c.app.DeviceAuthorizationService().VerifyDevice(ctx, ctx.UserCode, ctx.Redirect,
+		ctx.RequestData.Header.Get("Referer"), callbackURL)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	ctx.ResponseData.Header().Set("Cache-Control", "no-cache")
+	ctx.ResponseData.Header().Set("Location", *redirectTo)
+	return ctx.TemporaryRedirect()
+}
@@ -35,7 +35,7 @@ func TestRunAuthorizeREST(t *testing.T) {
 
 func (rest *TestAuthorizeREST) UnSecuredController() (*goa.Service, *AuthorizeController) {
 	svc := testsupport.ServiceAsUser("Login-Service", testsupport.TestIdentity)
-	return svc, NewAuthorizeController(svc, rest.Application, rest.Configuration)
+	return svc, NewAuthorizeController(svc, rest.Application)
 }
 
 func (rest *TestAuthorizeREST) TestAuthorizeOK() {
@@ -48,17 +48,17 @@ func (rest *TestAuthorizeREST) TestAuthorizeOK() {
 	state := uuid.NewV4().String()
 	responseMode := "query"
 
-	test.AuthorizeAuthorizeTemporaryRedirect(t, svc.Context, svc, ctrl, nil, clientID, redirect, &responseMode, responseType, nil, state)
+	test.AuthorizeAuthorizeTemporaryRedirect(t, svc.Context, svc, ctrl, nil, clientID, nil, nil, nil, redirect, &responseMode, responseType, nil, state)
 
 	state = "not-uuid"
-	test.AuthorizeAuthorizeTemporaryRedirect(t, svc.Context, svc, ctrl, nil, clientID, redirect, &responseMode, responseType, nil, state)
+	test.AuthorizeAuthorizeTemporaryRedirect(t, svc.Context, svc, ctrl, nil, clientID, nil, nil, nil, redirect, &responseMode, responseType, nil, state)
 
 	state = uuid.NewV4().String()
 	responseMode = "fragment"
-	test.AuthorizeAuthorizeTemporaryRedirect(t, svc.Context, svc, ctrl, nil, clientID, redirect, &responseMode, responseType, nil, state)
+	test.AuthorizeAuthorizeTemporaryRedirect(t, svc.Context, svc, ctrl, nil, clientID, nil, nil, nil, redirect, &responseMode, responseType, nil, state)
 
 	state = uuid.NewV4().String()
-	test.AuthorizeAuthorizeTemporaryRedirect(t, svc.Context, svc, ctrl, nil, clientID, redirect, nil, responseType, nil, state)
+	test.AuthorizeAuthorizeTemporaryRedirect(t, svc.Context, svc, ctrl, nil, clientID, nil, nil, nil, redirect, nil, responseType, nil, state)
 }
 
 func (rest *TestAuthorizeREST) TestAuthorizeBadRequest() {
@@ -89,7 +89,7 @@ func (rest *TestAuthorizeREST) TestAuthorizeUnauthorizedError() {
 	responseType := "code"
 	state := uuid.NewV4().String()
 
-	test.AuthorizeAuthorizeUnauthorized(t, svc.Context, svc, ctrl, nil, clientID, redirect, nil, responseType, nil, state)
+	test.AuthorizeAuthorizeUnauthorized(t, svc.Context, svc, ctrl, nil, clientID, nil, nil, nil, redirect, nil, responseType, nil, state)
 }
 
 func (rest *TestAuthorizeREST) TestAuthorizeCallbackOK() {
@@ -278,6 +278,58 @@ func (rest *TestAuthorizeREST) TestAuthorizeCallbackUnauthorizedError() {
 	require.Equal(t, 401, statusCode)
 }
 
+func (rest *TestAuthorizeREST) TestDeviceOK() {
+	t := rest.T()
+	svc, ctrl := rest.UnSecuredController()
+
+	clientID := rest.Configuration.GetPublicOAuthClientID()
+	rw, deviceAuthorization := test.DeviceAuthorizeOK(t, svc.Context, svc, ctrl, &app.DeviceAuthorizationRequest{ClientID: clientID})
+
+	require.Equal(t, "no-store", rw.Header().Get("Cache-Control"))
+	require.NotEmpty(t, deviceAuthorization.DeviceCode)
+	require.Regexp(t, "^[BCDFGHJKLMNPQRSTVWXZ]{4}-[BCDFGHJKLMNPQRSTVWXZ]{4}$", deviceAuthorization.UserCode)
+	require.Equal(t, "http:///api/authorize/device/verify", deviceAuthorization.VerificationURI)
+	require.NotNil(t, deviceAuthorization.VerificationURIComplete)
+	require.Equal(t, "http:///api/authorize/device/verify?user_code="+deviceAuthorization.UserCode, *deviceAuthorization.VerificationURIComplete)
+	require.Equal(t, rest.Configuration.GetDeviceCodeExpirySeconds(), deviceAuthorization.ExpiresIn)
+	require.NotNil(t, deviceAuthorization.Interval)
+	require.Equal(t, rest.Configuration.GetDeviceCodePollingIntervalSeconds(), *deviceAuthorization.Interval)
+}
+
+func (rest *TestAuthorizeREST) TestDeviceUnauthorizedError() {
+	t := rest.T()
+	svc, ctrl := rest.UnSecuredController()
+
+	test.DeviceAuthorizeUnauthorized(t, svc.Context, svc, ctrl, &app.DeviceAuthorizationRequest{ClientID: uuid.NewV4().String()})
+}
+
+func (rest *TestAuthorizeREST) TestVerifyOK() {
+	t := rest.T()
+	svc, ctrl := rest.UnSecuredController()
+
+	clientID := rest.Configuration.GetPublicOAuthClientID()
+	_, deviceAuthorization := test.DeviceAuthorizeOK(t, svc.Context, svc, ctrl, &app.DeviceAuthorizationRequest{ClientID: clientID})
+
+	// the user code is case insensitive and dashes are ignored
+	userCode := strings.ToLower(strings.Replace(deviceAuthorization.UserCode, "-", "", -1))
+	redirect := "https://openshift.io/somepath"
+	rw := test.VerifyAuthorizeTemporaryRedirect(t, svc.Context, svc, ctrl, &redirect, userCode, nil)
+
+	locationString := rw.Header().Get("Location")
+	require.Contains(t, locationString, rest.Configuration.GetOAuthProviderEndpointAuth())
+	locationURL, err := url.Parse(locationString)
+	require.NoError(t, err)
+	require.NotEmpty(t, locationURL.Query().Get("state"))
+}
+
+func (rest *TestAuthorizeREST) TestVerifyBadRequest() {
+	t := rest.T()
+	svc, ctrl := rest.UnSecuredController()
+
+	redirect := "https://openshift.io/somepath"
+	test.VerifyAuthorizeBadRequest(t, svc.Context, svc, ctrl, &redirect, "BCDF-GHJK", nil)
+}
+
 func (rest *TestAuthorizeREST) checkInvalidRequest(testFor string, toBeRemoved string, prms url.Values, u *url.URL, t *testing.T) {
 	ctx := context.Background()
 	rw := httptest.NewRecorder()
@@ -105,6 +105,9 @@ func (c *CollaboratorsController) List(ctx *app.ListCollaboratorsContext) error
 		data := make([]*app.UserData, len(page))
 		for i := range resultUsers {
 			appUser := ConvertToAppUser(ctx.RequestData, &resultUsers[i], &resultIdentities[i], isServiceAccount)
+			if isServiceAccount {
+				setServiceProfileAttributes(appUser, &resultUsers[i])
+			}
 			data[i] = appUser.Data
 		}
 		response := app.UserList{
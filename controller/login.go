@@ -39,7 +39,7 @@ func (c *LoginController) Login(ctx *app.LoginLoginContext) error {
 	}
 
 	redirectURL, err := c.app.AuthenticationProviderService().GenerateAuthCodeURL(ctx, ctx.Redirect, ctx.APIClient,
-		&state, scopes, nil, ctx.RequestData.Header.Get("Referer"), callbackURL)
+		&state, scopes, nil, ctx.RequestData.Header.Get("Referer"), callbackURL, nil, nil, nil, nil)
 	if err != nil {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/application"
+	oauthclient "github.com/fabric8-services/fabric8-auth/authentication/oauthclient/repository"
+	oauthclientservice "github.com/fabric8-services/fabric8-auth/authentication/oauthclient/service"
+	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/jsonapi"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/goadesign/goa"
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+)
+
+// OauthClientController implements the oauth_client resource.
+type OauthClientController struct {
+	*goa.Controller
+	app application.Application
+}
+
+// NewOauthClientController creates an oauth_client controller.
+func NewOauthClientController(service *goa.Service, app application.Application) *OauthClientController {
+	return &OauthClientController{Controller: service.NewController("OauthClientController"), app: app}
+}
+
+// Create runs the create action.
+func (c *OauthClientController) Create(ctx *app.CreateOauthClientContext) error {
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	if ctx.Payload == nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("payload", "nil").Expected("client metadata"))
+	}
+
+	client, authMethod := convertToOAuthClient(ctx.Payload)
+	secret, err := c.app.OAuthClientService().CreateClient(ctx, *currentIdentity, client, authMethod)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":         err,
+			"identity_id": currentIdentity,
+		}, "failed to create oauth client")
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.Created(convertToAppOAuthClient(*client, secret))
+}
+
+// Register runs the register action, as defined by RFC 7591.
+func (c *OauthClientController) Register(ctx *app.RegisterOauthClientContext) error {
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	if ctx.Payload == nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("payload", "nil").Expected("client metadata"))
+	}
+
+	client, authMethod := convertToOAuthClient(ctx.Payload)
+	secret, err := c.app.OAuthClientService().RegisterClient(ctx, *currentIdentity, client, authMethod)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":         err,
+			"identity_id": currentIdentity,
+		}, "failed to register oauth client")
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.Created(convertToAppOAuthClient(*client, secret))
+}
+
+// List runs the list action.
+func (c *OauthClientController) List(ctx *app.ListOauthClientContext) error {
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	clients, err := c.app.OAuthClientService().ListClients(ctx, *currentIdentity)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	res := &app.OAuthClientList{
+		Data: make([]*app.OAuthClient, len(clients)),
+	}
+	for i, client := range clients {
+		res.Data[i] = convertToAppOAuthClient(client, nil)
+	}
+	return ctx.OK(res)
+}
+
+// Show runs the show action.
+func (c *OauthClientController) Show(ctx *app.ShowOauthClientContext) error {
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	client, err := c.app.OAuthClientService().ShowClient(ctx, *currentIdentity, ctx.ClientID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(convertToAppOAuthClient(*client, nil))
+}
+
+// Update runs the update action.
+func (c *OauthClientController) Update(ctx *app.UpdateOauthClientContext) error {
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	if ctx.Payload == nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("payload", "nil").Expected("client metadata"))
+	}
+
+	client, err := c.app.OAuthClientService().UpdateClient(ctx, *currentIdentity, ctx.ClientID, ctx.Payload.ClientName,
+		ctx.Payload.RedirectUris, ctx.Payload.RedirectURIMatch, ctx.Payload.GrantTypes)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":         err,
+			"client_id":   ctx.ClientID,
+			"identity_id": currentIdentity,
+		}, "failed to update oauth client")
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(convertToAppOAuthClient(*client, nil))
+}
+
+// Delete runs the delete action.
+func (c *OauthClientController) Delete(ctx *app.DeleteOauthClientContext) error {
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	err = c.app.OAuthClientService().DeleteClient(ctx, *currentIdentity, ctx.ClientID)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":         err,
+			"client_id":   ctx.ClientID,
+			"identity_id": currentIdentity,
+		}, "failed to delete oauth client")
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.NoContent()
+}
+
+// currentIdentityID returns the ID of the identity of the token in the given context
+func currentIdentityID(ctx context.Context) (*uuid.UUID, error) {
+	currentIdentity, err := manager.ContextIdentity(ctx)
+	if err != nil {
+		return nil, errors.NewUnauthorizedError(err.Error())
+	}
+	if currentIdentity == nil {
+		return nil, errors.NewUnauthorizedError("error finding the current user")
+	}
+	return currentIdentity, nil
+}
+
+// convertToOAuthClient converts the given client metadata to an OAuth client and its token endpoint authentication method
+func convertToOAuthClient(metadata *app.OAuthClientMetadata) (*oauthclient.OAuthClient, string) {
+	client := &oauthclient.OAuthClient{
+		RedirectURIs: pq.StringArray(metadata.RedirectUris),
+		GrantTypes:   pq.StringArray(metadata.GrantTypes),
+	}
+	if metadata.ClientName != nil {
+		client.Name = *metadata.ClientName
+	}
+	if metadata.RedirectURIMatch != nil {
+		client.RedirectURIMatch = *metadata.RedirectURIMatch
+	}
+	authMethod := ""
+	if metadata.TokenEndpointAuthMethod != nil {
+		authMethod = *metadata.TokenEndpointAuthMethod
+	}
+	return client, authMethod
+}
+
+// convertToAppOAuthClient converts the given OAuth client to its REST representation. The secret is only set when
+// the client has just been created.
+func convertToAppOAuthClient(client oauthclient.OAuthClient, secret *string) *app.OAuthClient {
+	authMethod := oauthclientservice.TokenEndpointAuthMethodNone
+	if client.Confidential() {
+		authMethod = oauthclientservice.TokenEndpointAuthMethodClientSecretPost
+	}
+	issuedAt := int(client.CreatedAt.Unix())
+	res := &app.OAuthClient{
+		ClientID:                client.ClientID,
+		ClientName:              client.Name,
+		RedirectUris:            append([]string{}, client.RedirectURIs...),
+		RedirectURIMatch:        client.RedirectURIMatch,
+		GrantTypes:              append([]string{}, client.GrantTypes...),
+		TokenEndpointAuthMethod: authMethod,
+		ClientIDIssuedAt:        &issuedAt,
+	}
+	if secret != nil {
+		// the generated secrets don't expire, as defined by RFC 7591
+		expiresAt := 0
+		res.ClientSecret = secret
+		res.ClientSecretExpiresAt = &expiresAt
+	}
+	return res
+}
@@ -0,0 +1,169 @@
+package controller_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/app/test"
+	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	. "github.com/fabric8-services/fabric8-auth/controller"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+
+	"github.com/goadesign/goa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type OAuthClientControllerTestSuite struct {
+	gormtestsupport.DBTestSuite
+}
+
+func TestRunOAuthClientControllerTestSuite(t *testing.T) {
+	suite.Run(t, &OAuthClientControllerTestSuite{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *OAuthClientControllerTestSuite) SecuredController(identity account.Identity) (*goa.Service, *OauthClientController) {
+	svc := testsupport.ServiceAsUser("OAuthClient-Service", identity)
+	return svc, NewOauthClientController(svc, s.Application)
+}
+
+func (s *OAuthClientControllerTestSuite) UnsecuredController() (*goa.Service, *OauthClientController) {
+	svc := goa.New("OAuthClient-Service")
+	return svc, NewOauthClientController(svc, s.Application)
+}
+
+// newAdmin returns a new user with the manage_oauth_clients scope
+func (s *OAuthClientControllerTestSuite) newAdmin(t *testing.T) account.Identity {
+	g := s.NewTestGraph(t)
+	admin := g.CreateUser()
+	g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+		AddRole(admin, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+	return *admin.Identity()
+}
+
+func (s *OAuthClientControllerTestSuite) TestRegister() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		svc, ctrl := s.SecuredController(s.newAdmin(t))
+		name := "registered client"
+		payload := &app.OAuthClientMetadata{
+			ClientName:   &name,
+			RedirectUris: []string{"https://client.example.com/callback"},
+		}
+		// when
+		_, client := test.RegisterOauthClientCreated(t, svc.Context, svc, ctrl, payload)
+		// then
+		require.NotEmpty(t, client.ClientID)
+		require.NotNil(t, client.ClientSecret)
+		assert.Equal(t, name, client.ClientName)
+		assert.Equal(t, []string{"authorization_code"}, client.GrantTypes)
+		assert.Equal(t, "exact", client.RedirectURIMatch)
+		assert.Equal(t, "client_secret_post", client.TokenEndpointAuthMethod)
+	})
+
+	s.T().Run("public client", func(t *testing.T) {
+		// given
+		svc, ctrl := s.SecuredController(s.newAdmin(t))
+		authMethod := "none"
+		payload := &app.OAuthClientMetadata{
+			RedirectUris:            []string{"https://client.example.com/callback"},
+			TokenEndpointAuthMethod: &authMethod,
+		}
+		// when
+		_, client := test.RegisterOauthClientCreated(t, svc.Context, svc, ctrl, payload)
+		// then
+		assert.Nil(t, client.ClientSecret)
+		assert.Equal(t, "none", client.TokenEndpointAuthMethod)
+	})
+
+	s.T().Run("client credentials", func(t *testing.T) {
+		// given
+		svc, ctrl := s.SecuredController(s.newAdmin(t))
+		payload := &app.OAuthClientMetadata{
+			GrantTypes: []string{"client_credentials"},
+		}
+		// when/then
+		test.RegisterOauthClientBadRequest(t, svc.Context, svc, ctrl, payload)
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		svc, ctrl := s.SecuredController(*g.CreateUser().Identity())
+		payload := &app.OAuthClientMetadata{
+			RedirectUris: []string{"https://attacker.example.com/callback"},
+		}
+		// when/then
+		test.RegisterOauthClientForbidden(t, svc.Context, svc, ctrl, payload)
+	})
+
+	s.T().Run("unauthorized", func(t *testing.T) {
+		svc, ctrl := s.UnsecuredController()
+		test.RegisterOauthClientUnauthorized(t, svc.Context, svc, ctrl, &app.OAuthClientMetadata{})
+	})
+}
+
+func (s *OAuthClientControllerTestSuite) TestManageClients() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		admin := g.CreateUser()
+		g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+			AddRole(admin, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+		svc, ctrl := s.SecuredController(*admin.Identity())
+		name := "backend client"
+		payload := &app.OAuthClientMetadata{
+			ClientName: &name,
+			GrantTypes: []string{"client_credentials"},
+		}
+
+		// when
+		_, created := test.CreateOauthClientCreated(t, svc.Context, svc, ctrl, payload)
+		// then
+		require.NotNil(t, created.ClientSecret)
+		_, shown := test.ShowOauthClientOK(t, svc.Context, svc, ctrl, created.ClientID)
+		assert.Equal(t, name, shown.ClientName)
+		assert.Nil(t, shown.ClientSecret)
+		_, list := test.ListOauthClientOK(t, svc.Context, svc, ctrl)
+		clientIDs := []string{}
+		for _, c := range list.Data {
+			clientIDs = append(clientIDs, c.ClientID)
+		}
+		assert.Contains(t, clientIDs, created.ClientID)
+
+		// when
+		updatedName := "updated client"
+		prefix := "prefix"
+		_, updated := test.UpdateOauthClientOK(t, svc.Context, svc, ctrl, created.ClientID, &app.OAuthClientUpdate{
+			ClientName:       &updatedName,
+			RedirectUris:     []string{"https://client.example.com/"},
+			RedirectURIMatch: &prefix,
+		})
+		// then
+		assert.Equal(t, updatedName, updated.ClientName)
+		assert.Equal(t, []string{"https://client.example.com/"}, updated.RedirectUris)
+		assert.Equal(t, "prefix", updated.RedirectURIMatch)
+
+		// when
+		test.DeleteOauthClientNoContent(t, svc.Context, svc, ctrl, created.ClientID)
+		// then
+		test.ShowOauthClientNotFound(t, svc.Context, svc, ctrl, created.ClientID)
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		g := s.NewTestGraph(t)
+		svc, ctrl := s.SecuredController(*g.CreateUser().Identity())
+		test.CreateOauthClientForbidden(t, svc.Context, svc, ctrl, &app.OAuthClientMetadata{})
+		test.ListOauthClientForbidden(t, svc.Context, svc, ctrl)
+	})
+
+	s.T().Run("unauthorized", func(t *testing.T) {
+		svc, ctrl := s.UnsecuredController()
+		test.ListOauthClientUnauthorized(t, svc.Context, svc, ctrl)
+	})
+}
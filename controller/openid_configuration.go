@@ -2,19 +2,32 @@ package controller
 
 import (
 	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/authorization/token"
+	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
 	"github.com/fabric8-services/fabric8-auth/client"
 	"github.com/fabric8-services/fabric8-auth/rest"
 	"github.com/goadesign/goa"
 )
 
+// OpenidConfigurationControllerConfiguration the configuration for the OpenidConfigurationController
+type OpenidConfigurationControllerConfiguration interface {
+	GetSigningKeyAlgorithm() string
+}
+
 // OpenidConfigurationController implements the openid_configuration resource.
 type OpenidConfigurationController struct {
 	*goa.Controller
+	TokenManager  manager.TokenManager
+	Configuration OpenidConfigurationControllerConfiguration
 }
 
 // NewOpenidConfigurationController creates a openid_configuration controller.
-func NewOpenidConfigurationController(service *goa.Service) *OpenidConfigurationController {
-	return &OpenidConfigurationController{Controller: service.NewController("OpenidConfigurationController")}
+func NewOpenidConfigurationController(service *goa.Service, tokenManager manager.TokenManager, config OpenidConfigurationControllerConfiguration) *OpenidConfigurationController {
+	return &OpenidConfigurationController{
+		Controller:    service.NewController("OpenidConfigurationController"),
+		TokenManager:  tokenManager,
+		Configuration: config,
+	}
 }
 
 // Show runs the show action.
@@ -26,6 +39,10 @@ func (c *OpenidConfigurationController) Show(ctx *app.ShowOpenidConfigurationCon
 	userinfoEndpoint := rest.AbsoluteURL(ctx.RequestData, client.ShowUserinfoPath(), nil)
 	logoutEndpoint := rest.AbsoluteURL(ctx.RequestData, client.LogoutLogoutPath(), nil)
 	jwksURI := rest.AbsoluteURL(ctx.RequestData, client.KeysTokenPath(), nil)
+	revocationEndpoint := rest.AbsoluteURL(ctx.RequestData, client.RevokeTokenPath(), nil)
+	introspectionEndpoint := rest.AbsoluteURL(ctx.RequestData, client.IntrospectTokenPath(), nil)
+	deviceAuthorizationEndpoint := rest.AbsoluteURL(ctx.RequestData, client.DeviceAuthorizePath(), nil)
+	registrationEndpoint := rest.AbsoluteURL(ctx.RequestData, client.RegisterOauthClientPath(), nil)
 
 	authOpenIDConfiguration := &app.OpenIDConfiguration{
 		// REQUIRED properties
@@ -43,20 +60,49 @@ func (c *OpenidConfigurationController) Show(ctx *app.ShowOpenidConfigurationCon
 		SubjectTypesSupported: []string{"public"},
 		// id_token_signing_alg_values_supported REQUIRED. JSON array containing a list of the JWS signing algorithms (alg values) supported by the OP for the ID Token to encode the Claims in a JWT [JWT].
 		// The algorithm RS256 MUST be included. The value none MAY be supported, but MUST NOT be used unless the Response Type used returns no ID Token from the Authorization Endpoint (such as when using the Authorization Code Flow).
-		IDTokenSigningAlgValuesSupported: []string{"RS256"},
+		IDTokenSigningAlgValuesSupported: c.idTokenSigningAlgorithms(),
 
 		// RECOMMENDED properties
 		UserinfoEndpoint: &userinfoEndpoint,
 		ScopesSupported:  []string{"openid", "offline_access"},
-		ClaimsSupported:  []string{"sub", "iss", "auth_time", "name", "given_name", "family_name", "preferred_username", "email"},
+		ClaimsSupported:  []string{"sub", "iss", "auth_time", "name", "given_name", "family_name", "preferred_username", "email", "email_verified", "aud", "nonce", "at_hash"},
 
 		// OPTIONAL properties
-		GrantTypesSupported: []string{"authorization_code", "refresh_token", "client_credentials"},
+		GrantTypesSupported: []string{"authorization_code", "refresh_token", "client_credentials", "urn:ietf:params:oauth:grant-type:device_code", "urn:ietf:params:oauth:grant-type:token-exchange"},
 		// client_secret_post for client_credentials grant_type
 		// client_secre_jwt for authorizatoin_code grant_type
 		TokenEndpointAuthMethodsSupported: []string{"client_secret_post", "client_secret_jwt"},
+		// RFC 7009 token revocation
+		RevocationEndpoint: &revocationEndpoint,
+		// RFC 7662 token introspection
+		IntrospectionEndpoint: &introspectionEndpoint,
+		// RFC 7636 proof key for code exchange
+		CodeChallengeMethodsSupported: []string{"plain", "S256"},
+		// RFC 8628 device authorization grant
+		DeviceAuthorizationEndpoint: &deviceAuthorizationEndpoint,
+		// RFC 7591 dynamic client registration
+		RegistrationEndpoint: &registrationEndpoint,
 		// response_modes_supported
 	}
 
 	return ctx.OK(authOpenIDConfiguration)
 }
+
+// idTokenSigningAlgorithms returns the algorithms of the published signing keys and of the keys generated when the
+// keys are rotated, with which the ID tokens are signed. RS256 is always included, as required by OpenID Connect.
+func (c *OpenidConfigurationController) idTokenSigningAlgorithms() []string {
+	algorithms := []string{"RS256"}
+	addAlgorithm := func(algorithm string) {
+		for _, a := range algorithms {
+			if a == algorithm {
+				return
+			}
+		}
+		algorithms = append(algorithms, algorithm)
+	}
+	for _, key := range c.TokenManager.PublicKeys() {
+		addAlgorithm(token.SigningMethod(key).Alg())
+	}
+	addAlgorithm(c.Configuration.GetSigningKeyAlgorithm())
+	return algorithms
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/app/test"
 	. "github.com/fabric8-services/fabric8-auth/controller"
 	"github.com/fabric8-services/fabric8-auth/resource"
+	testtoken "github.com/fabric8-services/fabric8-auth/test/token"
 
 	"github.com/goadesign/goa"
 	"github.com/stretchr/testify/require"
@@ -22,9 +23,21 @@ func TestRunOpenIDConfigurationREST(t *testing.T) {
 	suite.Run(t, &TestOpenIDConfigurationREST{})
 }
 
+type openIDConfigurationTestConfig struct {
+	signingKeyAlgorithm string
+}
+
+func (c openIDConfigurationTestConfig) GetSigningKeyAlgorithm() string {
+	return c.signingKeyAlgorithm
+}
+
 func (s *TestOpenIDConfigurationREST) UnSecuredController() (*goa.Service, *OpenidConfigurationController) {
+	return s.UnSecuredControllerWithSigningKeyAlgorithm("RS256")
+}
+
+func (s *TestOpenIDConfigurationREST) UnSecuredControllerWithSigningKeyAlgorithm(algorithm string) (*goa.Service, *OpenidConfigurationController) {
 	svc := goa.New("Status-Service")
-	return svc, NewOpenidConfigurationController(svc)
+	return svc, NewOpenidConfigurationController(svc, testtoken.TokenManager, openIDConfigurationTestConfig{signingKeyAlgorithm: algorithm})
 }
 
 func (s *TestOpenIDConfigurationREST) TestShowOpenIDConfiguration() {
@@ -39,6 +52,10 @@ func (s *TestOpenIDConfigurationREST) TestShowOpenIDConfiguration() {
 	userInfoEndpoint := "http:///api/userinfo"
 	logoutEndpoint := "http:///api/logout"
 	jwksURI := "http:///api/token/keys"
+	revocationEndpoint := "http:///api/token/revoke"
+	introspectionEndpoint := "http:///api/token/introspect"
+	deviceAuthorizationEndpoint := "http:///api/authorize/device"
+	registrationEndpoint := "http:///api/clients/register"
 
 	expectedOpenIDConfiguration := &app.OpenIDConfiguration{
 		Issuer:                            &issuer,
@@ -48,13 +65,32 @@ func (s *TestOpenIDConfigurationREST) TestShowOpenIDConfiguration() {
 		EndSessionEndpoint:                &logoutEndpoint,
 		ResponseTypesSupported:            []string{"code"},
 		JwksURI:                           &jwksURI,
-		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials", "urn:ietf:params:oauth:grant-type:device_code", "urn:ietf:params:oauth:grant-type:token-exchange"},
 		SubjectTypesSupported:             []string{"public"},
 		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
 		ScopesSupported:                   []string{"openid", "offline_access"},
-		ClaimsSupported:                   []string{"sub", "iss", "auth_time", "name", "given_name", "family_name", "preferred_username", "email"},
+		ClaimsSupported:                   []string{"sub", "iss", "auth_time", "name", "given_name", "family_name", "preferred_username", "email", "email_verified", "aud", "nonce", "at_hash"},
 		TokenEndpointAuthMethodsSupported: []string{"client_secret_post", "client_secret_jwt"},
+		RevocationEndpoint:                &revocationEndpoint,
+		IntrospectionEndpoint:             &introspectionEndpoint,
+		CodeChallengeMethodsSupported:     []string{"plain", "S256"},
+		DeviceAuthorizationEndpoint:       &deviceAuthorizationEndpoint,
+		RegistrationEndpoint:              &registrationEndpoint,
 	}
 
 	require.Equal(t, openIDConfiguration, expectedOpenIDConfiguration)
 }
+
+func (s *TestOpenIDConfigurationREST) TestShowIDTokenSigningAlgorithms() {
+	s.T().Run("rotated to ES256 keys", func(t *testing.T) {
+		svc, ctrl := s.UnSecuredControllerWithSigningKeyAlgorithm("ES256")
+		_, openIDConfiguration := test.ShowOpenidConfigurationOK(t, svc.Context, svc, ctrl)
+		require.Equal(t, []string{"RS256", "ES256"}, openIDConfiguration.IDTokenSigningAlgValuesSupported)
+	})
+
+	s.T().Run("rotated to EdDSA keys", func(t *testing.T) {
+		svc, ctrl := s.UnSecuredControllerWithSigningKeyAlgorithm("EdDSA")
+		_, openIDConfiguration := test.ShowOpenidConfigurationOK(t, svc.Context, svc, ctrl)
+		require.Equal(t, []string{"RS256", "EdDSA"}, openIDConfiguration.IDTokenSigningAlgValuesSupported)
+	})
+}
@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	"github.com/fabric8-services/fabric8-auth/authorization/token"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/jsonapi"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/goadesign/goa"
+	"github.com/satori/go.uuid"
+)
+
+// PermissionsController implements the permissions resource.
+type PermissionsController struct {
+	*goa.Controller
+	app application.Application
+}
+
+// NewPermissionsController creates a permissions controller.
+func NewPermissionsController(service *goa.Service, app application.Application) *PermissionsController {
+	return &PermissionsController{Controller: service.NewController("PermissionsController"), app: app}
+}
+
+// Check runs the check action.
+func (c *PermissionsController) Check(ctx *app.CheckPermissionsContext) error {
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	if ctx.Payload == nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("payload", "nil").Expected("permission checks"))
+	}
+
+	identityID := *currentIdentity
+	if ctx.Payload.IdentityID != nil {
+		identityID, err = uuid.FromString(*ctx.Payload.IdentityID)
+		if err != nil {
+			return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("identityID", *ctx.Payload.IdentityID).Expected("uuid"))
+		}
+		if identityID != *currentIdentity && !token.IsServiceAccount(ctx) {
+			log.Warn(ctx, map[string]interface{}{
+				"identity_id":    identityID,
+				"by_identity_id": currentIdentity,
+			}, "only the service accounts can check the permissions of another identity")
+			return jsonapi.JSONErrorResponse(ctx, errors.NewForbiddenError("only the service accounts can check the permissions of another identity"))
+		}
+	}
+
+	checks := make([]authorization.ResourceScope, len(ctx.Payload.Checks))
+	for i, check := range ctx.Payload.Checks {
+		checks[i] = authorization.ResourceScope{
+			ResourceID: check.ResourceID,
+			ScopeName:  check.ScopeName,
+		}
+	}
+	decisions, err := c.app.PermissionService().HasScopes(ctx, identityID, checks)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":         err,
+			"identity_id": identityID,
+		}, "error checking the permissions of the identity")
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	res := &app.PermissionCheckResult{
+		Data: make([]*app.PermissionCheckDecision, len(checks)),
+	}
+	for i, check := range checks {
+		res.Data[i] = &app.PermissionCheckDecision{
+			ResourceID: check.ResourceID,
+			ScopeName:  check.ScopeName,
+			HasScope:   decisions[i],
+		}
+	}
+	return ctx.OK(res)
+}
+
+// Explain runs the explain action.
+func (c *PermissionsController) Explain(ctx *app.ExplainPermissionsContext) error {
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	identityID, err := uuid.FromString(ctx.IdentityID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("identityId", ctx.IdentityID).Expected("uuid"))
+	}
+
+	explanation, err := c.app.PermissionService().ExplainScope(ctx, *currentIdentity, identityID, ctx.ResourceID, ctx.ScopeName)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":            err,
+			"identity_id":    identityID,
+			"resource_id":    ctx.ResourceID,
+			"scope_name":     ctx.ScopeName,
+			"by_identity_id": currentIdentity,
+		}, "error explaining the scope of the identity for the resource")
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(&app.ScopeExplanation{
+		Data: convertScopeExplanationToApp(*explanation),
+	})
+}
+
+func convertScopeExplanationToApp(explanation authorization.ScopeExplanation) *app.ScopeExplanationData {
+	data := &app.ScopeExplanationData{
+		IdentityID:        explanation.IdentityID.String(),
+		ResourceID:        explanation.ResourceID,
+		ResourceType:      explanation.ResourceType,
+		ScopeName:         explanation.ScopeName,
+		Granted:           explanation.Granted,
+		Memberships:       make([]*app.IdentityMembershipData, len(explanation.Memberships)),
+		ResourceHierarchy: explanation.ResourceHierarchy,
+		Steps:             make([]*app.ScopeDerivationStepData, len(explanation.Steps)),
+		Denials:           make([]*app.ScopeDenialData, len(explanation.Denials)),
+	}
+	for i, membership := range explanation.Memberships {
+		data.Memberships[i] = &app.IdentityMembershipData{
+			IdentityID: membership.IdentityID.String(),
+			MemberOf:   convertUUIDsToStrings(membership.MemberOf),
+		}
+	}
+	for i, step := range explanation.Steps {
+		stepData := &app.ScopeDerivationStepData{
+			AssigneeID:   step.AssigneeID.String(),
+			MemberOf:     convertUUIDsToStrings(step.MemberOf),
+			ResourceID:   step.ResourceID,
+			Inherited:    step.Inherited,
+			RoleName:     step.RoleName,
+			RoleMappings: make([]*app.RoleMappingStepData, len(step.RoleMappings)),
+			Scopes:       step.Scopes,
+			GrantsScope:  step.GrantsScope,
+		}
+		if stepData.Scopes == nil {
+			stepData.Scopes = []string{}
+		}
+		if step.EffectiveRoleName != "" {
+			effectiveRoleName := step.EffectiveRoleName
+			stepData.EffectiveRoleName = &effectiveRoleName
+		}
+		if step.Reason != "" {
+			reason := step.Reason
+			stepData.Reason = &reason
+		}
+		for j, mapping := range step.RoleMappings {
+			mappingData := &app.RoleMappingStepData{
+				RoleMappingID: mapping.RoleMappingID.String(),
+				ResourceID:    mapping.ResourceID,
+				FromRoleName:  mapping.FromRoleName,
+				ToRoleName:    mapping.ToRoleName,
+			}
+			if mapping.DefaultRoleMappingID != nil {
+				defaultRoleMappingID := mapping.DefaultRoleMappingID.String()
+				mappingData.DefaultRoleMappingID = &defaultRoleMappingID
+			}
+			stepData.RoleMappings[j] = mappingData
+		}
+		data.Steps[i] = stepData
+	}
+	for i, denial := range explanation.Denials {
+		data.Denials[i] = &app.ScopeDenialData{
+			DenialID:   denial.DenyAssignmentID.String(),
+			AssigneeID: denial.AssigneeID.String(),
+			MemberOf:   convertUUIDsToStrings(denial.MemberOf),
+			ResourceID: denial.ResourceID,
+			Inherited:  denial.Inherited,
+		}
+	}
+	return data
+}
+
+func convertUUIDsToStrings(ids []uuid.UUID) []string {
+	result := make([]string, len(ids))
+	for i, id := range ids {
+		result[i] = id.String()
+	}
+	return result
+}
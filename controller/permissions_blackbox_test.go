@@ -0,0 +1,197 @@
+package controller_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/app/test"
+	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	. "github.com/fabric8-services/fabric8-auth/controller"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+
+	"github.com/goadesign/goa"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type PermissionsControllerTestSuite struct {
+	gormtestsupport.DBTestSuite
+}
+
+func TestRunPermissionsControllerTestSuite(t *testing.T) {
+	suite.Run(t, &PermissionsControllerTestSuite{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *PermissionsControllerTestSuite) SecuredController(identity account.Identity) (*goa.Service, *PermissionsController) {
+	svc := testsupport.ServiceAsUser("Permissions-Service", identity)
+	return svc, NewPermissionsController(svc, s.Application)
+}
+
+func (s *PermissionsControllerTestSuite) SecuredServiceAccountController() (*goa.Service, *PermissionsController) {
+	svc := testsupport.ServiceAsServiceAccountUser("Permissions-ServiceAccount-Service", testsupport.TestNotificationIdentity)
+	return svc, NewPermissionsController(svc, s.Application)
+}
+
+func (s *PermissionsControllerTestSuite) UnsecuredController() (*goa.Service, *PermissionsController) {
+	svc := goa.New("Permissions-Service")
+	return svc, NewPermissionsController(svc, s.Application)
+}
+
+func (s *PermissionsControllerTestSuite) TestCheck() {
+
+	s.T().Run("ok for the current user", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		resourceType := g.CreateResourceType()
+		role := g.CreateRole(resourceType, "test-role").AddScope("test-scope")
+		resource := g.CreateResource(resourceType).AddRole(user, role)
+		otherResource := g.CreateResource(resourceType)
+		unknownResourceID := uuid.NewV4().String()
+		svc, ctrl := s.SecuredController(*user.Identity())
+		payload := &app.PermissionCheckRequest{
+			Checks: []*app.PermissionCheck{
+				{ResourceID: resource.ResourceID(), ScopeName: "test-scope"},
+				{ResourceID: resource.ResourceID(), ScopeName: "other-scope"},
+				{ResourceID: otherResource.ResourceID(), ScopeName: "test-scope"},
+				{ResourceID: unknownResourceID, ScopeName: "test-scope"},
+			},
+		}
+		// when
+		_, result := test.CheckPermissionsOK(t, svc.Context, svc, ctrl, payload)
+		// then
+		require.Len(t, result.Data, 4)
+		for i, check := range payload.Checks {
+			assert.Equal(t, check.ResourceID, result.Data[i].ResourceID)
+			assert.Equal(t, check.ScopeName, result.Data[i].ScopeName)
+		}
+		assert.True(t, result.Data[0].HasScope)
+		assert.False(t, result.Data[1].HasScope)
+		assert.False(t, result.Data[2].HasScope)
+		assert.False(t, result.Data[3].HasScope)
+	})
+
+	s.T().Run("ok for another identity by a service account", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		resourceType := g.CreateResourceType()
+		role := g.CreateRole(resourceType, "test-role").AddScope("test-scope")
+		resource := g.CreateResource(resourceType).AddRole(user, role)
+		svc, ctrl := s.SecuredServiceAccountController()
+		identityID := user.IdentityID().String()
+		payload := &app.PermissionCheckRequest{
+			IdentityID: &identityID,
+			Checks: []*app.PermissionCheck{
+				{ResourceID: resource.ResourceID(), ScopeName: "test-scope"},
+			},
+		}
+		// when
+		_, result := test.CheckPermissionsOK(t, svc.Context, svc, ctrl, payload)
+		// then
+		require.Len(t, result.Data, 1)
+		assert.True(t, result.Data[0].HasScope)
+	})
+
+	s.T().Run("forbidden for another identity by a user", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		otherUser := g.CreateUser()
+		resource := g.CreateResource()
+		svc, ctrl := s.SecuredController(*user.Identity())
+		identityID := otherUser.IdentityID().String()
+		payload := &app.PermissionCheckRequest{
+			IdentityID: &identityID,
+			Checks: []*app.PermissionCheck{
+				{ResourceID: resource.ResourceID(), ScopeName: "test-scope"},
+			},
+		}
+		// when/then
+		test.CheckPermissionsForbidden(t, svc.Context, svc, ctrl, payload)
+	})
+
+	s.T().Run("invalid identity ID", func(t *testing.T) {
+		// given
+		svc, ctrl := s.SecuredServiceAccountController()
+		identityID := "foo"
+		payload := &app.PermissionCheckRequest{
+			IdentityID: &identityID,
+			Checks: []*app.PermissionCheck{
+				{ResourceID: uuid.NewV4().String(), ScopeName: "test-scope"},
+			},
+		}
+		// when/then
+		test.CheckPermissionsBadRequest(t, svc.Context, svc, ctrl, payload)
+	})
+
+	s.T().Run("unauthorized", func(t *testing.T) {
+		// given
+		svc, ctrl := s.UnsecuredController()
+		payload := &app.PermissionCheckRequest{
+			Checks: []*app.PermissionCheck{
+				{ResourceID: uuid.NewV4().String(), ScopeName: "test-scope"},
+			},
+		}
+		// when/then
+		test.CheckPermissionsUnauthorized(t, svc.Context, svc, ctrl, payload)
+	})
+}
+
+func (s *PermissionsControllerTestSuite) TestExplain() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		admin := g.CreateUser()
+		g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+			AddRole(admin, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+		user := g.CreateUser()
+		team := g.CreateTeam().AddMember(user)
+		space := g.CreateSpace().AddAdmin(team)
+		svc, ctrl := s.SecuredController(*admin.Identity())
+		// when
+		_, result := test.ExplainPermissionsOK(t, svc.Context, svc, ctrl, user.IdentityID().String(), space.SpaceID(), authorization.ManageSpaceScope)
+		// then
+		require.NotNil(t, result.Data)
+		assert.True(t, result.Data.Granted)
+		assert.Equal(t, authorization.ResourceTypeSpace, result.Data.ResourceType)
+		require.Len(t, result.Data.Memberships, 1)
+		assert.Equal(t, team.TeamID().String(), result.Data.Memberships[0].IdentityID)
+		require.Len(t, result.Data.Steps, 1)
+		assert.True(t, result.Data.Steps[0].GrantsScope)
+		assert.Equal(t, team.TeamID().String(), result.Data.Steps[0].AssigneeID)
+		assert.Equal(t, authorization.SpaceAdminRole, result.Data.Steps[0].RoleName)
+		assert.Nil(t, result.Data.Steps[0].Reason)
+	})
+
+	s.T().Run("bad identity ID", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		admin := g.CreateUser()
+		svc, ctrl := s.SecuredController(*admin.Identity())
+		// when/then
+		test.ExplainPermissionsBadRequest(t, svc.Context, svc, ctrl, "foo", uuid.NewV4().String(), authorization.ManageSpaceScope)
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		space := g.CreateSpace().AddAdmin(user)
+		svc, ctrl := s.SecuredController(*user.Identity())
+		// when/then
+		test.ExplainPermissionsForbidden(t, svc.Context, svc, ctrl, user.IdentityID().String(), space.SpaceID(), authorization.ManageSpaceScope)
+	})
+
+	s.T().Run("unauthorized", func(t *testing.T) {
+		// given
+		svc, ctrl := s.UnsecuredController()
+		// when/then
+		test.ExplainPermissionsUnauthorized(t, svc.Context, svc, ctrl, uuid.NewV4().String(), uuid.NewV4().String(), authorization.ManageSpaceScope)
+	})
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/application"
+	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/jsonapi"
+	"github.com/fabric8-services/fabric8-auth/log"
+
+	"github.com/goadesign/goa"
+)
+
+// ProfileAttributeController implements the profile_attribute resource.
+type ProfileAttributeController struct {
+	*goa.Controller
+	app application.Application
+}
+
+// NewProfileAttributeController creates a profile_attribute controller.
+func NewProfileAttributeController(service *goa.Service, app application.Application) *ProfileAttributeController {
+	return &ProfileAttributeController{Controller: service.NewController("ProfileAttributeController"), app: app}
+}
+
+// List runs the list action.
+func (c *ProfileAttributeController) List(ctx *app.ListProfileAttributeContext) error {
+	_, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	definitions, err := c.app.ProfileAttributeService().ListDefinitions(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	res := &app.ProfileAttributeDefinitionList{
+		Data: make([]*app.ProfileAttributeDefinition, len(definitions)),
+	}
+	for i, definition := range definitions {
+		res.Data[i] = convertToAppProfileAttributeDefinition(definition)
+	}
+	return ctx.OK(res)
+}
+
+// Create runs the create action.
+func (c *ProfileAttributeController) Create(ctx *app.CreateProfileAttributeContext) error {
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	if ctx.Payload == nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("payload", "nil").Expected("profile attribute definition"))
+	}
+
+	definition := &account.ProfileAttributeDefinition{
+		Name: ctx.Payload.Name,
+		Type: ctx.Payload.Type,
+	}
+	if ctx.Payload.Description != nil {
+		definition.Description = *ctx.Payload.Description
+	}
+	if ctx.Payload.Pattern != nil {
+		definition.Pattern = *ctx.Payload.Pattern
+	}
+	if ctx.Payload.Visibility != nil {
+		definition.Visibility = *ctx.Payload.Visibility
+	}
+	if ctx.Payload.EditableByUser != nil {
+		definition.EditableByUser = *ctx.Payload.EditableByUser
+	}
+	err = c.app.ProfileAttributeService().CreateDefinition(ctx, *currentIdentity, definition)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":         err,
+			"name":        definition.Name,
+			"identity_id": currentIdentity,
+		}, "failed to create profile attribute definition")
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.Created(convertToAppProfileAttributeDefinition(*definition))
+}
+
+// Update runs the update action.
+func (c *ProfileAttributeController) Update(ctx *app.UpdateProfileAttributeContext) error {
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	if ctx.Payload == nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("payload", "nil").Expected("profile attribute definition"))
+	}
+
+	definition, err := c.app.ProfileAttributeService().UpdateDefinition(ctx, *currentIdentity, ctx.Name, ctx.Payload.Description,
+		ctx.Payload.Pattern, ctx.Payload.Visibility, ctx.Payload.EditableByUser)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":         err,
+			"name":        ctx.Name,
+			"identity_id": currentIdentity,
+		}, "failed to update profile attribute definition")
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(convertToAppProfileAttributeDefinition(*definition))
+}
+
+// Delete runs the delete action.
+func (c *ProfileAttributeController) Delete(ctx *app.DeleteProfileAttributeContext) error {
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	err = c.app.ProfileAttributeService().DeleteDefinition(ctx, *currentIdentity, ctx.Name)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":         err,
+			"name":        ctx.Name,
+			"identity_id": currentIdentity,
+		}, "failed to delete profile attribute definition")
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.NoContent()
+}
+
+// convertToAppProfileAttributeDefinition converts the given profile attribute definition to its REST representation
+func convertToAppProfileAttributeDefinition(definition account.ProfileAttributeDefinition) *app.ProfileAttributeDefinition {
+	res := &app.ProfileAttributeDefinition{
+		Name:           definition.Name,
+		Type:           definition.Type,
+		Visibility:     definition.Visibility,
+		EditableByUser: definition.EditableByUser,
+	}
+	if definition.Description != "" {
+		res.Description = &definition.Description
+	}
+	if definition.Pattern != "" {
+		res.Pattern = &definition.Pattern
+	}
+	return res
+}
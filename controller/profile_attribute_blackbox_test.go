@@ -0,0 +1,118 @@
+package controller_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/app/test"
+	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	. "github.com/fabric8-services/fabric8-auth/controller"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+
+	"github.com/goadesign/goa"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ProfileAttributeControllerTestSuite struct {
+	gormtestsupport.DBTestSuite
+}
+
+func TestRunProfileAttributeControllerTestSuite(t *testing.T) {
+	suite.Run(t, &ProfileAttributeControllerTestSuite{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *ProfileAttributeControllerTestSuite) SecuredController(identity account.Identity) (*goa.Service, *ProfileAttributeController) {
+	svc := testsupport.ServiceAsUser("ProfileAttribute-Service", identity)
+	return svc, NewProfileAttributeController(svc, s.Application)
+}
+
+func (s *ProfileAttributeControllerTestSuite) UnsecuredController() (*goa.Service, *ProfileAttributeController) {
+	svc := goa.New("ProfileAttribute-Service")
+	return svc, NewProfileAttributeController(svc, s.Application)
+}
+
+func (s *ProfileAttributeControllerTestSuite) TestManageDefinitions() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		admin := g.CreateUser()
+		g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+			AddRole(admin, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+		svc, ctrl := s.SecuredController(*admin.Identity())
+		visibility := "public"
+		payload := &app.ProfileAttributeDefinitionCreate{
+			Name:       "github_" + uuid.NewV4().String()[:8],
+			Type:       "url",
+			Visibility: &visibility,
+		}
+
+		// when
+		_, created := test.CreateProfileAttributeCreated(t, svc.Context, svc, ctrl, payload)
+		// then
+		assert.Equal(t, payload.Name, created.Name)
+		assert.Equal(t, "url", created.Type)
+		assert.Equal(t, "public", created.Visibility)
+		assert.False(t, created.EditableByUser)
+
+		// when
+		_, list := test.ListProfileAttributeOK(t, svc.Context, svc, ctrl)
+		// then
+		names := []string{}
+		for _, definition := range list.Data {
+			names = append(names, definition.Name)
+		}
+		assert.Contains(t, names, payload.Name)
+
+		// when
+		editable := true
+		description := "The GitHub profile of the user"
+		_, updated := test.UpdateProfileAttributeOK(t, svc.Context, svc, ctrl, payload.Name, &app.ProfileAttributeDefinitionUpdate{
+			Description:    &description,
+			EditableByUser: &editable,
+		})
+		// then
+		require.NotNil(t, updated.Description)
+		assert.Equal(t, description, *updated.Description)
+		assert.True(t, updated.EditableByUser)
+		assert.Equal(t, "public", updated.Visibility)
+
+		// when
+		test.DeleteProfileAttributeNoContent(t, svc.Context, svc, ctrl, payload.Name)
+		// then
+		test.DeleteProfileAttributeNotFound(t, svc.Context, svc, ctrl, payload.Name)
+	})
+
+	s.T().Run("invalid pattern", func(t *testing.T) {
+		g := s.NewTestGraph(t)
+		admin := g.CreateUser()
+		g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+			AddRole(admin, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+		svc, ctrl := s.SecuredController(*admin.Identity())
+		pattern := "[a-"
+		test.CreateProfileAttributeBadRequest(t, svc.Context, svc, ctrl, &app.ProfileAttributeDefinitionCreate{
+			Name:    "code_" + uuid.NewV4().String()[:8],
+			Type:    "string",
+			Pattern: &pattern,
+		})
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		g := s.NewTestGraph(t)
+		svc, ctrl := s.SecuredController(*g.CreateUser().Identity())
+		test.CreateProfileAttributeForbidden(t, svc.Context, svc, ctrl, &app.ProfileAttributeDefinitionCreate{
+			Name: "attr_" + uuid.NewV4().String()[:8],
+			Type: "string",
+		})
+	})
+
+	s.T().Run("unauthorized", func(t *testing.T) {
+		svc, ctrl := s.UnsecuredController()
+		test.ListProfileAttributeUnauthorized(t, svc.Context, svc, ctrl)
+	})
+}
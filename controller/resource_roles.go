@@ -3,6 +3,8 @@ package controller
 import (
 	"github.com/fabric8-services/fabric8-auth/app"
 	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	"github.com/fabric8-services/fabric8-auth/authorization/role"
 	rolerepository "github.com/fabric8-services/fabric8-auth/authorization/role/repository"
 	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
 	"github.com/fabric8-services/fabric8-auth/errors"
@@ -109,7 +111,11 @@ func (c *ResourceRolesController) AssignRole(ctx *app.AssignRoleResourceRolesCon
 			}
 		}
 	}
-	err = c.app.RoleManagementService().Assign(ctx, *currentIdentity, roleAssignments, ctx.ResourceID, false)
+	validity := role.Validity{
+		ValidFrom:  ctx.Payload.ValidFrom,
+		ValidUntil: ctx.Payload.ValidUntil,
+	}
+	err = c.app.RoleManagementService().Assign(ctx, *currentIdentity, roleAssignments, ctx.ResourceID, false, validity)
 	if err != nil {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
@@ -150,6 +156,151 @@ func (c *ResourceRolesController) HasScope(ctx *app.HasScopeResourceRolesContext
 	})
 }
 
+// ListPrincipals lists the identities which effectively have the given scope in the requested resource
+func (c *ResourceRolesController) ListPrincipals(ctx *app.ListPrincipalsResourceRolesContext) error {
+	currentIdentity, err := manager.ContextIdentity(ctx)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"resource_id": ctx.ResourceID,
+		}, "error getting identity information from token")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError(err.Error()))
+	}
+
+	principals, err := c.app.RoleManagementService().ListPrincipalsByScope(ctx, *currentIdentity, ctx.ResourceID, ctx.ScopeName)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"resource_id": ctx.ResourceID,
+			"scope_name":  ctx.ScopeName,
+			"err":         err,
+		}, "error listing the identities which have the given scope in the requested resource")
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	res := &app.EffectivePrincipals{
+		Data: make([]*app.EffectivePrincipalData, len(principals)),
+	}
+	for i, principal := range principals {
+		res.Data[i] = convertEffectivePrincipalToApp(principal)
+	}
+	return ctx.OK(res)
+}
+
+// ListDenials lists the scopes denied to identities for the requested resource
+func (c *ResourceRolesController) ListDenials(ctx *app.ListDenialsResourceRolesContext) error {
+	currentIdentity, err := manager.ContextIdentity(ctx)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"resource_id": ctx.ResourceID,
+		}, "error getting identity information from token")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError(err.Error()))
+	}
+
+	denyAssignments, err := c.app.RoleManagementService().ListDenials(ctx, *currentIdentity, ctx.ResourceID)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"resource_id": ctx.ResourceID,
+			"err":         err,
+		}, "error retrieving list of denials for a specific resource")
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	res := &app.DenyAssignments{
+		Data: make([]*app.DenyAssignmentData, len(denyAssignments)),
+	}
+	for i, denyAssignment := range denyAssignments {
+		res.Data[i] = convertDenyAssignmentToApp(denyAssignment)
+	}
+	return ctx.OK(res)
+}
+
+// Deny denies scopes for a resource to one or more identities.
+func (c *ResourceRolesController) Deny(ctx *app.DenyResourceRolesContext) error {
+	currentIdentity, err := manager.ContextIdentity(ctx)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"resource_id": ctx.ResourceID,
+		}, "error getting identity information from token")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError(err.Error()))
+	}
+
+	denials := make(map[string][]uuid.UUID)
+	for _, denial := range ctx.Payload.Data {
+		for _, id := range denial.Ids {
+			identityIDAsUUID, err := uuid.FromString(id)
+			if err != nil {
+				log.Error(ctx, map[string]interface{}{
+					"resource_id": ctx.ResourceID,
+					"identity_id": id,
+					"scope":       denial.Scope,
+				}, "invalid identity ID")
+				return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("ids", id).Expected("uuid"))
+			}
+			denials[denial.Scope] = append(denials[denial.Scope], identityIDAsUUID)
+		}
+	}
+	err = c.app.RoleManagementService().Deny(ctx, *currentIdentity, denials, ctx.ResourceID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.NoContent()
+}
+
+// RevokeDenial revokes a scope denial for a resource
+func (c *ResourceRolesController) RevokeDenial(ctx *app.RevokeDenialResourceRolesContext) error {
+	currentIdentity, err := manager.ContextIdentity(ctx)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"resource_id": ctx.ResourceID,
+		}, "error getting identity information from token")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError(err.Error()))
+	}
+	denialID, err := uuid.FromString(ctx.DenialID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("denialID", ctx.DenialID).Expected("uuid"))
+	}
+
+	err = c.app.RoleManagementService().RevokeDenial(ctx, *currentIdentity, ctx.ResourceID, denialID)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"resource_id": ctx.ResourceID,
+			"denial_id":   denialID,
+			"err":         err,
+		}, "error revoking the denial for a specific resource")
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.NoContent()
+}
+
+func convertDenyAssignmentToApp(denyAssignment rolerepository.DenyAssignment) *app.DenyAssignmentData {
+	assigneeType := "user"
+	if denyAssignment.Identity.IdentityResourceID.Valid {
+		assigneeType = "group"
+	}
+	return &app.DenyAssignmentData{
+		ID:           denyAssignment.DenyAssignmentID.String(),
+		ScopeName:    denyAssignment.ScopeName,
+		AssigneeID:   denyAssignment.IdentityID.String(),
+		AssigneeType: assigneeType,
+	}
+}
+
+func convertEffectivePrincipalToApp(principal authorization.EffectivePrincipal) *app.EffectivePrincipalData {
+	data := &app.EffectivePrincipalData{
+		IdentityID: principal.IdentityID.String(),
+		Name:       principal.Name,
+		Grants:     make([]*app.ScopeGrantData, len(principal.Grants)),
+	}
+	for i, grant := range principal.Grants {
+		data.Grants[i] = &app.ScopeGrantData{
+			AssigneeID:  grant.AssigneeID.String(),
+			MemberOf:    convertUUIDsToStrings(grant.MemberOf),
+			ResourceID:  grant.ResourceID,
+			Inherited:   grant.Inherited,
+			RoleName:    grant.RoleName,
+			MappedRoles: grant.MappedRoles,
+		}
+	}
+	return data
+}
+
 func convertIdentityRoleToAppRoles(roles []rolerepository.IdentityRole) []*app.IdentityRolesData {
 	var rolesList []*app.IdentityRolesData
 	for _, r := range roles {
@@ -165,6 +316,8 @@ func convertIdentityRoleToAppRole(r rolerepository.IdentityRole) *app.IdentityRo
 		AssigneeType: "user", // will change for teams/orgs/groups
 		Inherited:    inherited,
 		RoleName:     r.Role.Name,
+		ValidFrom:    r.ValidFrom,
+		ValidUntil:   r.ValidUntil,
 	}
 	if inherited {
 		rolesData.InheritedFrom = r.Resource.ParentResourceID
@@ -2,6 +2,7 @@ package controller_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/fabric8-services/fabric8-auth/app"
 	"github.com/fabric8-services/fabric8-auth/app/test"
@@ -147,6 +148,42 @@ func (s *ResourceRolesControllerTestSuite) TestAssignRole() {
 		test.AssignRoleResourceRolesNoContent(t, svc.Context, svc, ctrl, res.SpaceID(), payload)
 	})
 
+	s.T().Run("ok with a validity window", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		res := g.CreateSpace()
+		testUser := g.CreateUser()
+		res.AddViewer(testUser)
+		adminUser := g.CreateUser()
+		res.AddAdmin(adminUser)
+		validUntil := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+		svc, ctrl := s.SecuredControllerWithIdentity(*adminUser.Identity())
+		payload := &app.AssignRoleResourceRolesPayload{
+			Data: []*app.AssignRoleData{
+				{
+					Role: authorization.SpaceContributorRole,
+					Ids:  []string{testUser.IdentityID().String()},
+				},
+			},
+			ValidUntil: &validUntil,
+		}
+		// when
+		test.AssignRoleResourceRolesNoContent(t, svc.Context, svc, ctrl, res.SpaceID(), payload)
+		// then
+		_, returnedIdentityRoles := test.ListAssignedResourceRolesOK(t, svc.Context, svc, ctrl, res.SpaceID())
+		found := false
+		for _, identityRole := range returnedIdentityRoles.Data {
+			if identityRole.AssigneeID == testUser.IdentityID().String() {
+				found = true
+				assert.Equal(t, authorization.SpaceContributorRole, identityRole.RoleName)
+				assert.Nil(t, identityRole.ValidFrom)
+				require.NotNil(t, identityRole.ValidUntil)
+				assert.True(t, validUntil.Equal(*identityRole.ValidUntil))
+			}
+		}
+		assert.True(t, found)
+	})
+
 	s.T().Run("conflict", func(t *testing.T) {
 
 		t.Run("assign lower role", func(t *testing.T) {
@@ -211,6 +248,29 @@ func (s *ResourceRolesControllerTestSuite) TestAssignRole() {
 
 	s.T().Run("bad request", func(t *testing.T) {
 
+		t.Run("validity window over", func(t *testing.T) {
+			// given
+			g := s.NewTestGraph(t)
+			res := g.CreateSpace()
+			testUser := g.CreateUser()
+			res.AddViewer(testUser)
+			adminUser := g.CreateUser()
+			res.AddAdmin(adminUser)
+			validUntil := time.Now().Add(-time.Hour)
+			svc, ctrl := s.SecuredControllerWithIdentity(*adminUser.Identity())
+			payload := &app.AssignRoleResourceRolesPayload{
+				Data: []*app.AssignRoleData{
+					{
+						Role: authorization.SpaceContributorRole,
+						Ids:  []string{testUser.IdentityID().String()},
+					},
+				},
+				ValidUntil: &validUntil,
+			}
+			// when/then
+			test.AssignRoleResourceRolesBadRequest(t, svc.Context, svc, ctrl, res.SpaceID(), payload)
+		})
+
 		t.Run("invalid identity", func(t *testing.T) {
 			// given
 			g := s.NewTestGraph(t)
@@ -437,6 +497,176 @@ func (s *ResourceRolesControllerTestSuite) TestListScopes() {
 
 }
 
+func (s *ResourceRolesControllerTestSuite) TestListPrincipals() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		admin := g.CreateUser()
+		member := g.CreateUser()
+		team := g.CreateTeam().AddMember(member)
+		contributor := g.CreateUser()
+		space := g.CreateSpace().AddAdmin(admin).AddAdmin(team).AddContributor(contributor)
+		svc, ctrl := s.SecuredControllerWithIdentity(*contributor.Identity())
+		// when
+		_, principals := test.ListPrincipalsResourceRolesOK(t, svc.Context, svc, ctrl, space.SpaceID(), authorization.ManageSpaceScope)
+		// then
+		require.NotNil(t, principals)
+		found := make(map[string]*app.EffectivePrincipalData)
+		for _, principal := range principals.Data {
+			found[principal.IdentityID] = principal
+		}
+		require.Len(t, found, 3)
+		require.Contains(t, found, admin.IdentityID().String())
+		require.Len(t, found[admin.IdentityID().String()].Grants, 1)
+		assert.Equal(t, authorization.SpaceAdminRole, found[admin.IdentityID().String()].Grants[0].RoleName)
+		assert.Empty(t, found[admin.IdentityID().String()].Grants[0].MemberOf)
+		require.Contains(t, found, team.TeamID().String())
+		require.Contains(t, found, member.IdentityID().String())
+		require.Len(t, found[member.IdentityID().String()].Grants, 1)
+		assert.Equal(t, team.TeamID().String(), found[member.IdentityID().String()].Grants[0].AssigneeID)
+		assert.Equal(t, []string{team.TeamID().String()}, found[member.IdentityID().String()].Grants[0].MemberOf)
+		assert.NotContains(t, found, contributor.IdentityID().String())
+	})
+
+	s.T().Run("ok for a service account", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		admin := g.CreateUser()
+		space := g.CreateSpace().AddAdmin(admin)
+		svc := testsupport.ServiceAsServiceAccountUser("Resource-roles-ServiceAccount-Service", testsupport.TestNotificationIdentity)
+		ctrl := NewResourceRolesController(svc, s.Application)
+		// when
+		_, principals := test.ListPrincipalsResourceRolesOK(t, svc.Context, svc, ctrl, space.SpaceID(), authorization.ManageSpaceScope)
+		// then
+		require.Len(t, principals.Data, 1)
+		assert.Equal(t, admin.IdentityID().String(), principals.Data[0].IdentityID)
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		space := g.CreateSpace()
+		svc, ctrl := s.SecuredControllerWithIdentity(*user.Identity())
+		// when/then
+		test.ListPrincipalsResourceRolesForbidden(t, svc.Context, svc, ctrl, space.SpaceID(), authorization.ManageSpaceScope)
+	})
+
+	s.T().Run("forbidden for another service account", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		space := g.CreateSpace()
+		svc := testsupport.ServiceAsServiceAccountUser("Resource-roles-ServiceAccount-Service", testsupport.TestTenantIdentity)
+		ctrl := NewResourceRolesController(svc, s.Application)
+		// when/then
+		test.ListPrincipalsResourceRolesForbidden(t, svc.Context, svc, ctrl, space.SpaceID(), authorization.ManageSpaceScope)
+	})
+
+	s.T().Run("unauthorized", func(t *testing.T) {
+		// given
+		svc, ctrl := s.UnsecuredController()
+		// when/then
+		test.ListPrincipalsResourceRolesUnauthorized(t, svc.Context, svc, ctrl, "", authorization.ManageSpaceScope)
+	})
+
+	s.T().Run("not found", func(t *testing.T) {
+		// given
+		svc := testsupport.ServiceAsServiceAccountUser("Resource-roles-ServiceAccount-Service", testsupport.TestNotificationIdentity)
+		ctrl := NewResourceRolesController(svc, s.Application)
+		// when/then
+		test.ListPrincipalsResourceRolesNotFound(t, svc.Context, svc, ctrl, uuid.NewV4().String(), authorization.ManageSpaceScope)
+	})
+}
+
+func (s *ResourceRolesControllerTestSuite) TestDenials() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		admin := g.CreateUser()
+		contributor := g.CreateUser()
+		space := g.CreateSpace().AddAdmin(admin).AddContributor(contributor)
+		svc, ctrl := s.SecuredControllerWithIdentity(*admin.Identity())
+		contributorSvc, contributorCtrl := s.SecuredControllerWithIdentity(*contributor.Identity())
+		payload := &app.DenyScopeArray{
+			Data: []*app.DenyScopeData{
+				{Scope: authorization.ContributeSpaceScope, Ids: []string{contributor.IdentityID().String()}},
+			},
+		}
+
+		// when
+		test.DenyResourceRolesNoContent(t, svc.Context, svc, ctrl, space.SpaceID(), payload)
+
+		// then
+		_, denials := test.ListDenialsResourceRolesOK(t, svc.Context, svc, ctrl, space.SpaceID())
+		require.Len(t, denials.Data, 1)
+		assert.Equal(t, contributor.IdentityID().String(), denials.Data[0].AssigneeID)
+		assert.Equal(t, "user", denials.Data[0].AssigneeType)
+		assert.Equal(t, authorization.ContributeSpaceScope, denials.Data[0].ScopeName)
+		_, scopes := test.HasScopeResourceRolesOK(t, contributorSvc.Context, contributorSvc, contributorCtrl, space.SpaceID(), authorization.ContributeSpaceScope)
+		assert.False(t, scopes.Data.HasScope)
+		_, scopes = test.HasScopeResourceRolesOK(t, contributorSvc.Context, contributorSvc, contributorCtrl, space.SpaceID(), authorization.ViewSpaceScope)
+		assert.True(t, scopes.Data.HasScope)
+
+		// when
+		test.RevokeDenialResourceRolesNoContent(t, svc.Context, svc, ctrl, space.SpaceID(), denials.Data[0].ID)
+
+		// then
+		_, denials = test.ListDenialsResourceRolesOK(t, svc.Context, svc, ctrl, space.SpaceID())
+		assert.Empty(t, denials.Data)
+		_, scopes = test.HasScopeResourceRolesOK(t, contributorSvc.Context, contributorSvc, contributorCtrl, space.SpaceID(), authorization.ContributeSpaceScope)
+		assert.True(t, scopes.Data.HasScope)
+	})
+
+	s.T().Run("invalid identity ID", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		admin := g.CreateUser()
+		space := g.CreateSpace().AddAdmin(admin)
+		svc, ctrl := s.SecuredControllerWithIdentity(*admin.Identity())
+		payload := &app.DenyScopeArray{
+			Data: []*app.DenyScopeData{
+				{Scope: authorization.ContributeSpaceScope, Ids: []string{"foo"}},
+			},
+		}
+		// when/then
+		test.DenyResourceRolesBadRequest(t, svc.Context, svc, ctrl, space.SpaceID(), payload)
+	})
+
+	s.T().Run("invalid denial ID", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		admin := g.CreateUser()
+		space := g.CreateSpace().AddAdmin(admin)
+		svc, ctrl := s.SecuredControllerWithIdentity(*admin.Identity())
+		// when/then
+		test.RevokeDenialResourceRolesBadRequest(t, svc.Context, svc, ctrl, space.SpaceID(), "foo")
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		contributor := g.CreateUser()
+		space := g.CreateSpace().AddContributor(contributor)
+		svc, ctrl := s.SecuredControllerWithIdentity(*contributor.Identity())
+		payload := &app.DenyScopeArray{
+			Data: []*app.DenyScopeData{
+				{Scope: authorization.ContributeSpaceScope, Ids: []string{contributor.IdentityID().String()}},
+			},
+		}
+		// when/then
+		test.DenyResourceRolesForbidden(t, svc.Context, svc, ctrl, space.SpaceID(), payload)
+	})
+
+	s.T().Run("unauthorized", func(t *testing.T) {
+		// given
+		svc, ctrl := s.UnsecuredController()
+		// when/then
+		test.ListDenialsResourceRolesUnauthorized(t, svc.Context, svc, ctrl, uuid.NewV4().String())
+	})
+}
+
 func (s *ResourceRolesControllerTestSuite) checkExists(t *testing.T, identities []uuid.UUID, roleNames []string, pool *app.Identityroles) {
 	for _, retrievedRole := range pool.Data {
 		var foundUser bool
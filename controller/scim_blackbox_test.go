@@ -0,0 +1,214 @@
+package controller_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/app/test"
+	"github.com/fabric8-services/fabric8-auth/application/service/factory"
+	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/authentication/scim"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	. "github.com/fabric8-services/fabric8-auth/controller"
+	"github.com/fabric8-services/fabric8-auth/gormapplication"
+	"github.com/fabric8-services/fabric8-auth/gormtestsupport"
+	testsupport "github.com/fabric8-services/fabric8-auth/test"
+	"github.com/fabric8-services/fabric8-auth/test/graph"
+
+	"github.com/goadesign/goa"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ScimControllerTestSuite struct {
+	gormtestsupport.DBTestSuite
+	tenantService *dummyTenantService
+}
+
+func TestRunScimControllerTestSuite(t *testing.T) {
+	suite.Run(t, &ScimControllerTestSuite{DBTestSuite: gormtestsupport.NewDBTestSuite()})
+}
+
+func (s *ScimControllerTestSuite) SetupSuite() {
+	s.DBTestSuite.SetupSuite()
+	witServiceMock := testsupport.NewWITMock(s.T(), uuid.NewV4().String(), "")
+	s.Application = gormapplication.NewGormDB(s.DB, s.Configuration, s.Wrappers,
+		factory.WithClusterService(testsupport.NewClusterServiceMock(s.T())), factory.WithWITService(witServiceMock))
+}
+
+func (s *ScimControllerTestSuite) SetupTest() {
+	s.DBTestSuite.SetupTest()
+	s.tenantService = &dummyTenantService{}
+}
+
+func (s *ScimControllerTestSuite) SecuredUsersController(identity account.Identity) (*goa.Service, *ScimUsersController) {
+	svc := testsupport.ServiceAsUser("ScimUsers-Service", identity)
+	return svc, NewScimUsersController(svc, s.Application, s.tenantService)
+}
+
+func (s *ScimControllerTestSuite) SecuredServiceAccountUsersController(identity account.Identity) (*goa.Service, *ScimUsersController) {
+	svc := testsupport.ServiceAsServiceAccountUser("ScimUsers-ServiceAccount-Service", identity)
+	return svc, NewScimUsersController(svc, s.Application, s.tenantService)
+}
+
+func (s *ScimControllerTestSuite) UnsecuredUsersController() (*goa.Service, *ScimUsersController) {
+	svc := goa.New("ScimUsers-Service")
+	return svc, NewScimUsersController(svc, s.Application, s.tenantService)
+}
+
+func (s *ScimControllerTestSuite) SecuredGroupsController(identity account.Identity) (*goa.Service, *ScimGroupsController) {
+	svc := testsupport.ServiceAsUser("ScimGroups-Service", identity)
+	return svc, NewScimGroupsController(svc, s.Application)
+}
+
+// admin creates a user with the manage_user scope for the system resources
+func (s *ScimControllerTestSuite) admin(g *graph.TestGraph) account.Identity {
+	admin := g.CreateUser()
+	g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).
+		AddRole(admin, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+	return *admin.Identity()
+}
+
+func newScimUserPayload() *app.ScimUserPayload {
+	name := uuid.NewV4().String()
+	displayName := "User " + name
+	return &app.ScimUserPayload{
+		UserName:    "user-" + name,
+		DisplayName: &displayName,
+		Emails:      []*app.ScimEmail{{Value: name + "@example.com"}},
+	}
+}
+
+func (s *ScimControllerTestSuite) TestUsers() {
+
+	s.T().Run("provision and deprovision", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		svc, ctrl := s.SecuredUsersController(s.admin(&g))
+		payload := newScimUserPayload()
+
+		// when
+		rw, created := test.CreateScimUsersCreated(t, svc.Context, svc, ctrl, payload)
+		// then
+		assert.Equal(t, payload.UserName, created.UserName)
+		assert.Equal(t, *payload.DisplayName, *created.DisplayName)
+		assert.Equal(t, payload.Emails[0].Value, created.Emails[0].Value)
+		assert.True(t, created.Active)
+		assert.Equal(t, created.Meta.Location, rw.Header().Get("Location"))
+		assert.Equal(t, created.Meta.Version, rw.Header().Get(app.ETag))
+		id, err := uuid.FromString(created.ID)
+		require.NoError(t, err)
+
+		// when
+		filter := `userName eq "` + payload.UserName + `"`
+		_, list := test.ListScimUsersOK(t, svc.Context, svc, ctrl, nil, &filter, nil)
+		// then
+		assert.Equal(t, 1, list.TotalResults)
+		require.Len(t, list.Resources, 1)
+		assert.Equal(t, created.ID, list.Resources[0].ID)
+
+		// when
+		path := "active"
+		_, patched := test.PatchScimUsersOK(t, svc.Context, svc, ctrl, id, &created.Meta.Version, &app.ScimPatchOp{
+			Operations: []*app.ScimPatchOperation{{Op: "replace", Path: &path, Value: false}},
+		})
+		// then
+		assert.False(t, patched.Active)
+		assert.Equal(t, id, s.tenantService.identityID)
+
+		// when
+		s.tenantService.identityID = uuid.Nil
+		test.DeleteScimUsersNoContent(t, svc.Context, svc, ctrl, id, nil)
+		// then
+		assert.Equal(t, id, s.tenantService.identityID)
+		_, shown := test.ShowScimUsersOK(t, svc.Context, svc, ctrl, id)
+		assert.False(t, shown.Active)
+	})
+
+	s.T().Run("outdated version", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		svc, ctrl := s.SecuredUsersController(s.admin(&g))
+		_, created := test.CreateScimUsersCreated(t, svc.Context, svc, ctrl, newScimUserPayload())
+		id, err := uuid.FromString(created.ID)
+		require.NoError(t, err)
+		version := "outdated"
+		// when/then
+		test.ReplaceScimUsersConflict(t, svc.Context, svc, ctrl, id, &version, newScimUserPayload())
+	})
+
+	s.T().Run("unsupported filter", func(t *testing.T) {
+		g := s.NewTestGraph(t)
+		svc, ctrl := s.SecuredUsersController(s.admin(&g))
+		filter := `userName sw "user"`
+		rw, scimErr := test.ListScimUsersBadRequest(t, svc.Context, svc, ctrl, nil, &filter, nil)
+		assert.Equal(t, "application/scim+json", rw.Header().Get("Content-Type"))
+		assert.Equal(t, []string{scim.ErrorSchema}, scimErr.Schemas)
+		assert.Equal(t, "400", scimErr.Status)
+		require.NotNil(t, scimErr.ScimType)
+		assert.Equal(t, scim.ErrorTypeInvalidFilter, *scimErr.ScimType)
+	})
+
+	s.T().Run("online registration service account", func(t *testing.T) {
+		svc, ctrl := s.SecuredServiceAccountUsersController(testsupport.TestOnlineRegistrationAppIdentity)
+		test.CreateScimUsersCreated(t, svc.Context, svc, ctrl, newScimUserPayload())
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		g := s.NewTestGraph(t)
+		svc, ctrl := s.SecuredUsersController(*g.CreateUser().Identity())
+		test.ListScimUsersForbidden(t, svc.Context, svc, ctrl, nil, nil, nil)
+	})
+
+	s.T().Run("unauthorized", func(t *testing.T) {
+		svc, ctrl := s.UnsecuredUsersController()
+		test.ListScimUsersUnauthorized(t, svc.Context, svc, ctrl, nil, nil, nil)
+	})
+}
+
+func (s *ScimControllerTestSuite) TestGroups() {
+
+	s.T().Run("patch members", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		member := g.CreateUser()
+		team := g.CreateTeam()
+		svc, ctrl := s.SecuredGroupsController(s.admin(&g))
+		_, group := test.ShowScimGroupsOK(t, svc.Context, svc, ctrl, team.TeamID())
+		assert.Equal(t, team.TeamName(), group.DisplayName)
+		assert.Empty(t, group.Members)
+
+		// when
+		path := "members"
+		rw, patched := test.PatchScimGroupsOK(t, svc.Context, svc, ctrl, team.TeamID(), &group.Meta.Version, &app.ScimPatchOp{
+			Operations: []*app.ScimPatchOperation{{
+				Op:    "add",
+				Path:  &path,
+				Value: []interface{}{map[string]interface{}{"value": member.IdentityID().String()}},
+			}},
+		})
+		// then
+		require.Len(t, patched.Members, 1)
+		assert.Equal(t, member.IdentityID().String(), patched.Members[0].Value)
+		assert.Equal(t, member.Identity().Username, *patched.Members[0].Display)
+		assert.NotEqual(t, group.Meta.Version, patched.Meta.Version)
+		assert.Equal(t, patched.Meta.Version, rw.Header().Get(app.ETag))
+
+		// outdated version
+		test.PatchScimGroupsConflict(t, svc.Context, svc, ctrl, team.TeamID(), &group.Meta.Version, &app.ScimPatchOp{
+			Operations: []*app.ScimPatchOperation{{Op: "remove", Path: &path}},
+		})
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		g := s.NewTestGraph(t)
+		svc, ctrl := s.SecuredGroupsController(*g.CreateUser().Identity())
+		rw, scimErr := test.ListScimGroupsForbidden(t, svc.Context, svc, ctrl, nil, nil, nil)
+		assert.Equal(t, "application/scim+json", rw.Header().Get("Content-Type"))
+		assert.Equal(t, []string{scim.ErrorSchema}, scimErr.Schemas)
+		assert.Equal(t, "403", scimErr.Status)
+		assert.Nil(t, scimErr.ScimType)
+	})
+}
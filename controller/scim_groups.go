@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/authentication/scim"
+	"github.com/fabric8-services/fabric8-auth/client"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/rest"
+
+	"github.com/goadesign/goa"
+)
+
+// ScimGroupsController implements the scim_groups resource.
+type ScimGroupsController struct {
+	*goa.Controller
+	app application.Application
+}
+
+// NewScimGroupsController creates a scim_groups controller.
+func NewScimGroupsController(service *goa.Service, app application.Application) *ScimGroupsController {
+	return &ScimGroupsController{Controller: service.NewController("ScimGroupsController"), app: app}
+}
+
+// List runs the list action.
+func (c *ScimGroupsController) List(ctx *app.ListScimGroupsContext) error {
+	err := checkScimAccess(ctx, c.app)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+	filter, err := parseScimFilter(ctx.Filter)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+	startIndex, count := scimPage(ctx.StartIndex, ctx.Count)
+
+	groups, total, err := c.app.ScimService().ListGroups(ctx, filter, startIndex, count)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+	res := &app.ScimGroupList{
+		Schemas:      []string{scim.ListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(groups),
+		Resources:    make([]*app.ScimGroup, len(groups)),
+	}
+	for i, group := range groups {
+		res.Resources[i] = convertToAppScimGroup(ctx.RequestData, group)
+	}
+	return ctx.OK(res)
+}
+
+// Show runs the show action.
+func (c *ScimGroupsController) Show(ctx *app.ShowScimGroupsContext) error {
+	err := checkScimAccess(ctx, c.app)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+
+	group, err := c.app.ScimService().LoadGroup(ctx, ctx.ID)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+	ctx.ResponseData.Header().Set(app.ETag, app.GenerateEntityTag(*group))
+	return ctx.OK(convertToAppScimGroup(ctx.RequestData, *group))
+}
+
+// Patch runs the patch action.
+func (c *ScimGroupsController) Patch(ctx *app.PatchScimGroupsContext) error {
+	err := checkScimAccess(ctx, c.app)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+	if ctx.Payload == nil {
+		return scimErrorResponse(ctx, errors.NewBadParameterError("payload", "nil").Expected("PATCH operations"))
+	}
+
+	group, err := c.app.ScimService().PatchGroup(ctx, ctx.ID, ctx.IfMatch, convertToPatchOperations(ctx.Payload))
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":      err,
+			"group_id": ctx.ID,
+		}, "failed to patch group")
+		return scimErrorResponse(ctx, err)
+	}
+	ctx.ResponseData.Header().Set(app.ETag, app.GenerateEntityTag(*group))
+	return ctx.OK(convertToAppScimGroup(ctx.RequestData, *group))
+}
+
+// convertToAppScimGroup converts the given team or organization to a SCIM group. The members are displayed with their
+// username, or with their name if they are teams or organizations.
+func convertToAppScimGroup(request *goa.RequestData, group scim.Group) *app.ScimGroup {
+	created := group.Identity.CreatedAt
+	lastModified := group.Identity.UpdatedAt
+	members := make([]*app.ScimGroupMember, len(group.Members))
+	for i, member := range group.Members {
+		display := member.Username
+		if member.IdentityResourceID.Valid {
+			display = member.IdentityResource.Name
+		}
+		members[i] = &app.ScimGroupMember{
+			Value:   member.ID.String(),
+			Display: &display,
+		}
+	}
+	return &app.ScimGroup{
+		Schemas:     []string{scim.GroupSchema},
+		ID:          group.Identity.ID.String(),
+		DisplayName: group.DisplayName(),
+		Members:     members,
+		Meta: &app.ScimMeta{
+			ResourceType: "Group",
+			Created:      &created,
+			LastModified: &lastModified,
+			Location:     rest.AbsoluteURL(request, client.ShowScimGroupsPath(group.Identity.ID), nil),
+			Version:      app.GenerateEntityTag(group),
+		},
+	}
+}
@@ -0,0 +1,334 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/fabric8-services/fabric8-auth/app"
+	"github.com/fabric8-services/fabric8-auth/application"
+	"github.com/fabric8-services/fabric8-auth/authentication/account"
+	accountrepo "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	accountservice "github.com/fabric8-services/fabric8-auth/authentication/account/service"
+	"github.com/fabric8-services/fabric8-auth/authentication/scim"
+	"github.com/fabric8-services/fabric8-auth/authorization"
+	"github.com/fabric8-services/fabric8-auth/authorization/token"
+	"github.com/fabric8-services/fabric8-auth/client"
+	"github.com/fabric8-services/fabric8-auth/errors"
+	"github.com/fabric8-services/fabric8-auth/jsonapi"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/rest"
+	"github.com/fabric8-services/fabric8-auth/sentry"
+
+	"github.com/goadesign/goa"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	// scimDefaultCount is the default number of resources of the SCIM list responses
+	scimDefaultCount = 100
+	// scimMaxCount is the maximum number of resources of the SCIM list responses
+	scimMaxCount = 1000
+)
+
+// ScimUsersController implements the scim_users resource.
+type ScimUsersController struct {
+	*goa.Controller
+	app           application.Application
+	tenantService accountservice.TenantService
+}
+
+// NewScimUsersController creates a scim_users controller.
+func NewScimUsersController(service *goa.Service, app application.Application, tenantService accountservice.TenantService) *ScimUsersController {
+	return &ScimUsersController{
+		Controller:    service.NewController("ScimUsersController"),
+		app:           app,
+		tenantService: tenantService,
+	}
+}
+
+// List runs the list action.
+func (c *ScimUsersController) List(ctx *app.ListScimUsersContext) error {
+	err := checkScimAccess(ctx, c.app)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+	filter, err := parseScimFilter(ctx.Filter)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+	startIndex, count := scimPage(ctx.StartIndex, ctx.Count)
+
+	identities, total, err := c.app.ScimService().ListUsers(ctx, filter, startIndex, count)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+	res := &app.ScimUserList{
+		Schemas:      []string{scim.ListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(identities),
+		Resources:    make([]*app.ScimUser, len(identities)),
+	}
+	for i, identity := range identities {
+		res.Resources[i] = convertToAppScimUser(ctx.RequestData, identity)
+	}
+	return ctx.OK(res)
+}
+
+// Show runs the show action.
+func (c *ScimUsersController) Show(ctx *app.ShowScimUsersContext) error {
+	err := checkScimAccess(ctx, c.app)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+
+	identity, err := c.app.ScimService().LoadUser(ctx, ctx.ID)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+	ctx.ResponseData.Header().Set(app.ETag, app.GenerateEntityTag(identity.User))
+	return ctx.OK(convertToAppScimUser(ctx.RequestData, *identity))
+}
+
+// Create runs the create action.
+func (c *ScimUsersController) Create(ctx *app.CreateScimUsersContext) error {
+	err := checkScimAccess(ctx, c.app)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+	if ctx.Payload == nil {
+		return scimErrorResponse(ctx, errors.NewBadParameterError("payload", "nil").Expected("user"))
+	}
+
+	identity, err := c.app.ScimService().CreateUser(ctx, convertToScimUser(ctx.Payload))
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":      err,
+			"username": ctx.Payload.UserName,
+		}, "failed to provision user")
+		return scimErrorResponse(ctx, err)
+	}
+	res := convertToAppScimUser(ctx.RequestData, *identity)
+	ctx.ResponseData.Header().Set("Location", res.Meta.Location)
+	ctx.ResponseData.Header().Set(app.ETag, res.Meta.Version)
+	return ctx.Created(res)
+}
+
+// Replace runs the replace action.
+func (c *ScimUsersController) Replace(ctx *app.ReplaceScimUsersContext) error {
+	err := checkScimAccess(ctx, c.app)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+	if ctx.Payload == nil {
+		return scimErrorResponse(ctx, errors.NewBadParameterError("payload", "nil").Expected("user"))
+	}
+
+	identity, deactivated, err := c.app.ScimService().ReplaceUser(ctx, ctx.ID, ctx.IfMatch, convertToScimUser(ctx.Payload))
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":         err,
+			"identity_id": ctx.ID,
+		}, "failed to replace user")
+		return scimErrorResponse(ctx, err)
+	}
+	if deactivated {
+		c.deleteTenant(ctx, identity.ID)
+	}
+	ctx.ResponseData.Header().Set(app.ETag, app.GenerateEntityTag(identity.User))
+	return ctx.OK(convertToAppScimUser(ctx.RequestData, *identity))
+}
+
+// Patch runs the patch action.
+func (c *ScimUsersController) Patch(ctx *app.PatchScimUsersContext) error {
+	err := checkScimAccess(ctx, c.app)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+	if ctx.Payload == nil {
+		return scimErrorResponse(ctx, errors.NewBadParameterError("payload", "nil").Expected("PATCH operations"))
+	}
+
+	identity, deactivated, err := c.app.ScimService().PatchUser(ctx, ctx.ID, ctx.IfMatch, convertToPatchOperations(ctx.Payload))
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":         err,
+			"identity_id": ctx.ID,
+		}, "failed to patch user")
+		return scimErrorResponse(ctx, err)
+	}
+	if deactivated {
+		c.deleteTenant(ctx, identity.ID)
+	}
+	ctx.ResponseData.Header().Set(app.ETag, app.GenerateEntityTag(identity.User))
+	return ctx.OK(convertToAppScimUser(ctx.RequestData, *identity))
+}
+
+// Delete runs the delete action.
+func (c *ScimUsersController) Delete(ctx *app.DeleteScimUsersContext) error {
+	err := checkScimAccess(ctx, c.app)
+	if err != nil {
+		return scimErrorResponse(ctx, err)
+	}
+
+	err = c.app.ScimService().DeleteUser(ctx, ctx.ID, ctx.IfMatch)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":         err,
+			"identity_id": ctx.ID,
+		}, "failed to deprovision user")
+		return scimErrorResponse(ctx, err)
+	}
+	c.deleteTenant(ctx, ctx.ID)
+	return ctx.NoContent()
+}
+
+// deleteTenant deletes the tenant of the deprovisioned identity (if access to tenant service is configured/enabled)
+func (c *ScimUsersController) deleteTenant(ctx context.Context, identityID uuid.UUID) {
+	if c.tenantService == nil {
+		return
+	}
+	err := c.tenantService.Delete(ctx, identityID)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err":         err,
+			"identity_id": identityID,
+		}, "unable to delete tenant when deprovisioning user")
+		sentry.Sentry().CaptureError(ctx, err)
+		// Just log the error and proceed
+	}
+}
+
+// checkScimAccess returns ForbiddenError unless the request is made by the online registration service account, or by
+// an identity with the manage_user scope for the system resources
+func checkScimAccess(ctx context.Context, appDB application.Application) error {
+	if token.IsSpecificServiceAccount(ctx, token.OnlineRegistration) {
+		return nil
+	}
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return err
+	}
+	return appDB.PermissionService().RequireSystemScope(ctx, *currentIdentity, authorization.ManageUserSystemScope)
+}
+
+// scimErrorResponse writes the SCIM error response of the given error, as defined by RFC 7644, section 3.12, instead of
+// a JSON API error document
+func scimErrorResponse(ctx context.Context, err error) error {
+	jsonErr, status := jsonapi.ErrorToJSONAPIError(ctx, err)
+	body := &app.ScimError{
+		Schemas: []string{scim.ErrorSchema},
+		Status:  strconv.Itoa(status),
+		Detail:  &jsonErr.Detail,
+	}
+	if scimType := scim.ErrorType(err); scimType != "" {
+		body.ScimType = &scimType
+	}
+	rw := goa.ContextResponse(ctx)
+	rw.Header().Set("Content-Type", "application/scim+json")
+	rw.WriteHeader(status)
+	return json.NewEncoder(rw).Encode(body)
+}
+
+// parseScimFilter parses the given optional SCIM filter
+func parseScimFilter(filter *string) (*scim.Filter, error) {
+	if filter == nil || *filter == "" {
+		return nil, nil
+	}
+	return scim.ParseFilter(*filter)
+}
+
+// scimPage returns the 1-based index of the first resource and the number of resources of the requested page
+func scimPage(startIndex *int, count *int) (int, int) {
+	start := 1
+	if startIndex != nil && *startIndex > 1 {
+		start = *startIndex
+	}
+	limit := scimDefaultCount
+	if count != nil {
+		limit = *count
+	}
+	if limit < 0 {
+		limit = 0
+	} else if limit > scimMaxCount {
+		limit = scimMaxCount
+	}
+	return start, limit
+}
+
+// convertToScimUser converts the given payload to the SCIM attributes of a user. The display name falls back to the
+// formatted name, then to the given and family names, and the email is the primary email, or the first one.
+func convertToScimUser(payload *app.ScimUserPayload) scim.User {
+	user := scim.User{
+		UserName: payload.UserName,
+		Active:   true,
+	}
+	if payload.Active != nil {
+		user.Active = *payload.Active
+	}
+	if payload.DisplayName != nil {
+		user.DisplayName = *payload.DisplayName
+	} else if payload.Name != nil && payload.Name.Formatted != nil {
+		user.DisplayName = *payload.Name.Formatted
+	} else if payload.Name != nil {
+		user.DisplayName = account.GenerateFullName(payload.Name.GivenName, payload.Name.FamilyName)
+	}
+	for _, email := range payload.Emails {
+		if email.Primary != nil && *email.Primary {
+			user.Email = email.Value
+			break
+		}
+	}
+	if user.Email == "" && len(payload.Emails) > 0 {
+		user.Email = payload.Emails[0].Value
+	}
+	return user
+}
+
+// convertToPatchOperations converts the given payload to SCIM PATCH operations
+func convertToPatchOperations(payload *app.ScimPatchOp) []scim.PatchOperation {
+	operations := make([]scim.PatchOperation, len(payload.Operations))
+	for i, op := range payload.Operations {
+		operations[i] = scim.PatchOperation{
+			Op:    op.Op,
+			Path:  op.Path,
+			Value: op.Value,
+		}
+	}
+	return operations
+}
+
+// convertToAppScimUser converts the given identity and its user to a SCIM user. Its version is the ETag of the user.
+func convertToAppScimUser(request *goa.RequestData, identity accountrepo.Identity) *app.ScimUser {
+	primary := true
+	created := identity.User.CreatedAt
+	lastModified := identity.User.UpdatedAt
+	res := &app.ScimUser{
+		Schemas:  []string{scim.UserSchema},
+		ID:       identity.ID.String(),
+		UserName: identity.Username,
+		Emails: []*app.ScimEmail{
+			{
+				Value:   identity.User.Email,
+				Primary: &primary,
+			},
+		},
+		Active: !identity.User.Deprovisioned,
+		Meta: &app.ScimMeta{
+			ResourceType: "User",
+			Created:      &created,
+			LastModified: &lastModified,
+			Location:     rest.AbsoluteURL(request, client.ShowScimUsersPath(identity.ID), nil),
+			Version:      app.GenerateEntityTag(identity.User),
+		},
+	}
+	if identity.User.FullName != "" {
+		fullName := identity.User.FullName
+		res.DisplayName = &fullName
+		res.Name = &app.ScimName{
+			Formatted: &fullName,
+		}
+	}
+	return res
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"net/url"
 	"regexp"
 
 	"github.com/fabric8-services/fabric8-auth/app"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/fabric8-services/fabric8-auth/application/transaction"
 	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
 )
 
 type searchConfiguration interface {
@@ -60,9 +62,21 @@ func (c *SearchController) Users(ctx *app.UsersSearchContext) error {
 		searchLimit = c.configuration.GetMaxUsersListLimit() - offset
 	}
 
+	// the filters are also kept in the paging links
+	filters := []func(*gorm.DB) *gorm.DB{}
+	additionalQuery := []string{"q=" + url.QueryEscape(q)}
+	if ctx.Company != nil {
+		filters = append(filters, account.IdentitySearchFilterByCompany(*ctx.Company))
+		additionalQuery = append(additionalQuery, "company="+url.QueryEscape(*ctx.Company))
+	}
+	if ctx.Cluster != nil {
+		filters = append(filters, account.IdentitySearchFilterByCluster(*ctx.Cluster))
+		additionalQuery = append(additionalQuery, "cluster="+url.QueryEscape(*ctx.Cluster))
+	}
+
 	if r.MatchString(q) && len(q) > 1 { // 2 or more characters
 		err = transaction.Transactional(c.app, func(tr transaction.TransactionalResources) error {
-			result, count, err = tr.Identities().Search(ctx, q, offset, searchLimit)
+			result, count, err = tr.Identities().Search(ctx, q, offset, searchLimit, filters...)
 			return err
 		})
 		if err != nil {
@@ -122,7 +136,7 @@ func (c *SearchController) Users(ctx *app.UsersSearchContext) error {
 		Links: &app.PagingLinks{},
 		Meta:  &app.UserListMeta{TotalCount: count},
 	}
-	setPagingLinks(response.Links, buildAbsoluteURL(ctx.RequestData), len(result), offset, limit, count, "q="+q)
+	setPagingLinks(response.Links, buildAbsoluteURL(ctx.RequestData), len(result), offset, limit, count, additionalQuery...)
 
 	return ctx.OK(&response)
 
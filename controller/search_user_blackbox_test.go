@@ -2,6 +2,7 @@ package controller_test
 
 import (
 	"context"
+	"net/url"
 	"reflect"
 	"strconv"
 	"testing"
@@ -82,7 +83,7 @@ func (s *TestSearchUserSearch) TestUsersSearchOK() {
 	}
 
 	for _, tt := range tests {
-		_, result := test.UsersSearchOK(s.T(), s.controller.Context, s.svc, s.controller, tt.userSearchTestArgs.pageLimit, tt.userSearchTestArgs.pageOffset, tt.userSearchTestArgs.q)
+		_, result := test.UsersSearchOK(s.T(), s.controller.Context, s.svc, s.controller, nil, nil, tt.userSearchTestArgs.pageLimit, tt.userSearchTestArgs.pageOffset, tt.userSearchTestArgs.q)
 		for _, userSearchTestExpect := range tt.userSearchTestExpects {
 			userSearchTestExpect(s.T(), tt, result)
 		}
@@ -100,7 +101,7 @@ func (s *TestSearchUserSearch) TestUsersSearchBadRequest() {
 	}
 
 	for _, tt := range tests {
-		test.UsersSearchBadRequest(t, s.controller.Context, s.svc, s.controller, tt.userSearchTestArgs.pageLimit, tt.userSearchTestArgs.pageOffset, tt.userSearchTestArgs.q)
+		test.UsersSearchBadRequest(t, s.controller.Context, s.svc, s.controller, nil, nil, tt.userSearchTestArgs.pageLimit, tt.userSearchTestArgs.pageOffset, tt.userSearchTestArgs.q)
 	}
 }
 
@@ -173,14 +174,51 @@ func (s *TestSearchUserSearch) TestEmailPrivateSearchOK() {
 	offset := "0"
 	pageLimit := 1
 	// OK to search by username
-	_, results := test.UsersSearchOK(s.T(), s.controller.Context, s.svc, s.controller, &pageLimit, &offset, randomName)
+	_, results := test.UsersSearchOK(s.T(), s.controller.Context, s.svc, s.controller, nil, nil, &pageLimit, &offset, randomName)
 
 	for _, result := range results.Data {
 		require.Equal(s.T(), "", *result.Attributes.Email)
 	}
 
 	// Empty result if searching by private email
-	_, results = test.UsersSearchOK(s.T(), s.controller.Context, s.svc, s.controller, &pageLimit, &offset, email)
+	_, results = test.UsersSearchOK(s.T(), s.controller.Context, s.svc, s.controller, nil, nil, &pageLimit, &offset, email)
+	require.Empty(s.T(), results.Data)
+}
+
+func (s *TestSearchUserSearch) TestSearchWithFiltersOK() {
+	// given two users of the same company and cluster, and a third one in another company
+	randomName := uuid.NewV4().String()
+	company := "company-" + uuid.NewV4().String()
+	cluster := "https://api.cluster-" + uuid.NewV4().String() + ".openshift.com/"
+	g := s.NewTestGraph(s.T())
+	for _, userCompany := range []string{company, company, "other " + company} {
+		user := g.CreateUser(randomName).User()
+		user.Company = userCompany
+		user.Cluster = cluster
+		err := s.Application.Users().Save(s.Ctx, user)
+		require.NoError(s.T(), err)
+	}
+	offset := "0"
+	pageLimit := 1
+
+	// when
+	_, results := test.UsersSearchOK(s.T(), s.controller.Context, s.svc, s.controller, nil, &company, &pageLimit, &offset, randomName)
+	// then the filters are kept in the paging links
+	require.Len(s.T(), results.Data, 1)
+	require.Equal(s.T(), 2, results.Meta.TotalCount)
+	require.NotNil(s.T(), results.Links.Next)
+	require.Contains(s.T(), *results.Links.Next, "company="+url.QueryEscape(company))
+
+	// when
+	pageLimit = 10
+	_, results = test.UsersSearchOK(s.T(), s.controller.Context, s.svc, s.controller, &cluster, nil, &pageLimit, &offset, randomName)
+	// then
+	require.Len(s.T(), results.Data, 3)
+
+	// when
+	otherCluster := "https://api.other.openshift.com/"
+	_, results = test.UsersSearchOK(s.T(), s.controller.Context, s.svc, s.controller, &otherCluster, &company, &pageLimit, &offset, randomName)
+	// then
 	require.Empty(s.T(), results.Data)
 }
 
@@ -199,7 +237,7 @@ func (s *TestSearchUserSearch) TestEmailNotPrivateSearchOK() {
 
 	offset := "0"
 	pageLimit := 1
-	_, results := test.UsersSearchOK(s.T(), s.controller.Context, s.svc, s.controller, &pageLimit, &offset, randomName)
+	_, results := test.UsersSearchOK(s.T(), s.controller.Context, s.svc, s.controller, nil, nil, &pageLimit, &offset, randomName)
 
 	for _, result := range results.Data {
 		require.NotEmpty(s.T(), *result.Attributes.Email)
@@ -308,10 +346,10 @@ func (s *TestSearchUserSearch) SecuredController() (*goa.Service, *SearchControl
 
 func (s *TestSearchUserSearch) TestSearchUnauthorized() {
 	_, ctrl := s.UnSecuredController()
-	test.UsersSearchUnauthorized(s.T(), ctrl.Context, ctrl.Service, ctrl, nil, nil, "a")
+	test.UsersSearchUnauthorized(s.T(), ctrl.Context, ctrl.Service, ctrl, nil, nil, nil, nil, "a")
 }
 
 func (s *TestSearchUserSearch) TestSearchUnauthorizedForDeprovisionedUser() {
 	_, ctrl := s.UnsecuredControllerDeprovisionedUser()
-	test.UsersSearchUnauthorized(s.T(), ctrl.Context, ctrl.Service, ctrl, nil, nil, "a")
+	test.UsersSearchUnauthorized(s.T(), ctrl.Context, ctrl.Service, ctrl, nil, nil, nil, nil, "a")
 }
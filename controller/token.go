@@ -2,9 +2,12 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/fabric8-services/fabric8-auth/app"
 	"github.com/fabric8-services/fabric8-auth/application"
@@ -12,25 +15,25 @@ import (
 	"github.com/fabric8-services/fabric8-auth/authorization/token"
 	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
 	"github.com/fabric8-services/fabric8-auth/client"
-	"github.com/fabric8-services/fabric8-auth/configuration"
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/jsonapi"
 	"github.com/fabric8-services/fabric8-auth/log"
 	"github.com/fabric8-services/fabric8-auth/rest"
 	"github.com/goadesign/goa"
 	goajwt "github.com/goadesign/goa/middleware/security/jwt"
-	"golang.org/x/crypto/bcrypt"
 )
 
 const (
 	DevUsername = "developer"
 	DevEmail    = "osio-developer@email.com"
+
+	// accessTokenType is the type of the access tokens in the token exchange requests, as defined by RFC 8693
+	accessTokenType = "urn:ietf:params:oauth:token-type:access_token"
 )
 
 type TokenControllerConfiguration interface {
 	provider.IdentityProviderConfiguration
 	IsPostgresDeveloperModeEnabled() bool
-	GetServiceAccounts() map[string]configuration.ServiceAccount
 	GetPublicOAuthClientID() string
 }
 
@@ -163,6 +166,8 @@ func (c *TokenController) Delete(ctx *app.DeleteTokenContext) error {
 // grant_type="authorization_code" is part of OAuth2 authorization flow.
 //
 // grant_type="refresh_token" covers OpenID Connect token refresh flow.
+//
+// grant_type="urn:ietf:params:oauth:grant-type:device_code" is part of OAuth2 device authorization flow.
 func (c *TokenController) Exchange(ctx *app.ExchangeTokenContext) error {
 	payload := ctx.Payload
 	if payload == nil {
@@ -188,6 +193,10 @@ func (c *TokenController) Exchange(ctx *app.ExchangeTokenContext) error {
 		if payload.Code == nil {
 			return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("code", "nil").Expected("authorization code"))
 		}
+		_, err = c.app.OAuthClientService().AuthenticateClient(ctx, payload.ClientID, payload.ClientSecret, payload.GrantType)
+		if err != nil {
+			return jsonapi.JSONErrorResponse(ctx, err)
+		}
 		redirectURL, err := url.Parse(rest.AbsoluteURL(ctx.RequestData, client.CallbackAuthorizePath(), nil))
 		if err != nil {
 			log.Error(ctx, map[string]interface{}{
@@ -198,7 +207,7 @@ func (c *TokenController) Exchange(ctx *app.ExchangeTokenContext) error {
 		}
 
 		notApprovedRedirect, token, err = c.app.AuthenticationProviderService().ExchangeAuthorizationCodeForUserToken(
-			profileCtx, *payload.Code, payload.ClientID, redirectURL)
+			profileCtx, *payload.Code, payload.ClientID, redirectURL, payload.CodeVerifier)
 		ctx.ResponseData.Header().Set("Cache-Control", "no-cache")
 
 		if err != nil {
@@ -207,8 +216,38 @@ func (c *TokenController) Exchange(ctx *app.ExchangeTokenContext) error {
 
 	case "refresh_token":
 		token, err = c.exchangeWithGrantTypeRefreshToken(ctx)
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		if payload.DeviceCode == nil {
+			return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("device_code", "nil").Expected("device code"))
+		}
+		_, err = c.app.OAuthClientService().AuthenticateClient(ctx, payload.ClientID, payload.ClientSecret, payload.GrantType)
+		if err != nil {
+			return jsonapi.JSONErrorResponse(ctx, err)
+		}
+		redirectURL, err := url.Parse(rest.AbsoluteURL(ctx.RequestData, client.CallbackAuthorizePath(), nil))
+		if err != nil {
+			log.Error(ctx, map[string]interface{}{
+				"redirectURL": rest.AbsoluteURL(ctx.RequestData, client.CallbackAuthorizePath(), nil),
+				"err":         err,
+			}, "failed to parse referrer")
+			return jsonapi.JSONErrorResponse(ctx, errors.NewInternalError(ctx, err))
+		}
+
+		notApprovedRedirect, token, err = c.app.DeviceAuthorizationService().ExchangeDeviceCode(
+			profileCtx, *payload.DeviceCode, payload.ClientID, redirectURL)
+		ctx.ResponseData.Header().Set("Cache-Control", "no-store")
+
+		if err != nil {
+			// the polling devices tell the errors apart by their OAuth error code
+			if ok, oauthErr := errors.IsOAuthError(err); ok {
+				return oauthErrorResponse(ctx, oauthErr.(errors.OAuthError))
+			}
+			return jsonapi.JSONErrorResponse(ctx, err)
+		}
+	case "urn:ietf:params:oauth:grant-type:token-exchange":
+		token, err = c.exchangeWithGrantTypeTokenExchange(ctx)
 	default:
-		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("grant_type", payload.GrantType).Expected("grant_type=client_credentials or grant_type=authorization_code or grant_type=refresh_token"))
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("grant_type", payload.GrantType).Expected("grant_type=client_credentials or grant_type=authorization_code or grant_type=refresh_token or grant_type=urn:ietf:params:oauth:grant-type:device_code or grant_type=urn:ietf:params:oauth:grant-type:token-exchange"))
 	}
 
 	if err != nil {
@@ -228,6 +267,19 @@ func (c *TokenController) Exchange(ctx *app.ExchangeTokenContext) error {
 	return ctx.OK(token)
 }
 
+// oauthErrorResponse writes the error response defined by RFC 6749, section 5.2, instead of a JSON API error document
+func oauthErrorResponse(ctx *app.ExchangeTokenContext, err errors.OAuthError) error {
+	body := map[string]string{
+		"error": err.Code,
+	}
+	if err.Error() != "" {
+		body["error_description"] = err.Error()
+	}
+	ctx.ResponseData.Header().Set("Content-Type", "application/json")
+	ctx.ResponseData.WriteHeader(http.StatusBadRequest)
+	return json.NewEncoder(ctx.ResponseData).Encode(body)
+}
+
 func (c *TokenController) exchangeWithGrantTypeRefreshToken(ctx *app.ExchangeTokenContext) (*app.OauthToken, error) {
 	// retrieve the access token from the request header, but ignore if it was not found
 	accessToken := goajwt.ContextJWT(ctx)
@@ -237,12 +289,9 @@ func (c *TokenController) exchangeWithGrantTypeRefreshToken(ctx *app.ExchangeTok
 		return nil, errors.NewBadParameterError("refresh_token", nil).Expected("not nil")
 	}
 
-	// Default value of this public client id is set to "740650a2-9c44-4db5-b067-a3d1b2cd2d01"
-	if payload.ClientID != c.Configuration.GetPublicOAuthClientID() {
-		log.Error(ctx, map[string]interface{}{
-			"client_id": payload.ClientID,
-		}, "unknown oauth client id")
-		return nil, errors.NewUnauthorizedError("invalid oauth client id")
+	_, err := c.app.OAuthClientService().AuthenticateClient(ctx, payload.ClientID, payload.ClientSecret, payload.GrantType)
+	if err != nil {
+		return nil, err
 	}
 
 	t, err := c.app.TokenService().ExchangeRefreshToken(ctx, *refreshToken, accessToken.Raw)
@@ -267,40 +316,116 @@ func (c *TokenController) exchangeWithGrantTypeRefreshToken(ctx *app.ExchangeTok
 	return token, nil
 }
 
+// exchangeWithGrantTypeTokenExchange exchanges the access token of a user for a down-scoped access token issued to
+// the authenticated client on behalf of the user, as defined by RFC 8693
+func (c *TokenController) exchangeWithGrantTypeTokenExchange(ctx *app.ExchangeTokenContext) (*app.OauthToken, error) {
+	payload := ctx.Payload
+	if payload.ClientSecret == nil {
+		return nil, errors.NewBadParameterError("client_secret", "nil").Expected("Service Account secret")
+	}
+	if payload.SubjectToken == nil {
+		return nil, errors.NewBadParameterError("subject_token", "nil").Expected("access token of the user")
+	}
+	if payload.SubjectTokenType == nil || *payload.SubjectTokenType != accessTokenType {
+		return nil, errors.NewBadParameterError("subject_token_type", payload.SubjectTokenType).Expected(accessTokenType)
+	}
+	if payload.Audience == nil {
+		return nil, errors.NewBadParameterError("audience", "nil").Expected("audience of the token")
+	}
+
+	oauthClient, err := c.app.OAuthClientService().AuthenticateClient(ctx, payload.ClientID, payload.ClientSecret, payload.GrantType)
+	if err != nil {
+		return nil, err
+	}
+	var scopes []string
+	if payload.Scope != nil {
+		scopes = strings.Fields(*payload.Scope)
+	}
+
+	t, err := c.app.TokenService().ExchangeToken(ctx, oauthClient.ClientID, *payload.SubjectToken, *payload.Audience, payload.ResourceID, scopes)
+	if err != nil {
+		return nil, err
+	}
+	ctx.ResponseData.Header().Set("Cache-Control", "no-store")
+
+	expiresIn := strconv.FormatInt(*t.ExpiresIn, 10)
+	issuedTokenType := accessTokenType
+	return &app.OauthToken{
+		AccessToken:     t.AccessToken,
+		ExpiresIn:       &expiresIn,
+		TokenType:       t.TokenType,
+		IssuedTokenType: &issuedTokenType,
+	}, nil
+}
+
 func (c *TokenController) exchangeWithGrantTypeClientCredentials(ctx *app.ExchangeTokenContext) (*app.OauthToken, error) {
 	payload := ctx.Payload
 	if payload.ClientSecret == nil {
 		return nil, errors.NewBadParameterError("client_secret", "nil").Expected("Service Account secret")
 	}
 
-	sa, found := c.Configuration.GetServiceAccounts()[payload.ClientID]
-	if !found {
-		log.Error(ctx, map[string]interface{}{
-			"client_id":     payload.ClientID,
-			"client_secret": *payload.ClientSecret,
-		}, "Unknown Service Account ID")
-		return nil, errors.NewUnauthorizedError("invalid Service Account ID or secret")
-	}
-	secret := []byte(*payload.ClientSecret)
-	for _, hash := range sa.Secrets {
-		if bcrypt.CompareHashAndPassword([]byte(hash), secret) == nil {
-			tokenType := "Bearer"
-			accessToken, err := c.TokenManager.GenerateServiceAccountToken(sa.ID, sa.Name)
-			if err != nil {
-				return nil, err
-			}
-			pat := &app.OauthToken{
-				AccessToken: &accessToken,
-				TokenType:   &tokenType,
-			}
-			return pat, nil
-		}
+	oauthClient, err := c.app.OAuthClientService().AuthenticateClient(ctx, payload.ClientID, payload.ClientSecret, payload.GrantType)
+	if err != nil {
+		return nil, err
+	}
+	tokenType := "Bearer"
+	accessToken, err := c.TokenManager.GenerateServiceAccountToken(oauthClient.ClientID, oauthClient.Name)
+	if err != nil {
+		return nil, err
+	}
+	pat := &app.OauthToken{
+		AccessToken: &accessToken,
+		TokenType:   &tokenType,
+	}
+	return pat, nil
+}
+
+// Revoke revokes an access or refresh token as defined by RFC 7009.
+// The client must be a known OAuth client, authenticated with its secret if it is a confidential client.
+// As required by RFC 7009, 200 OK is returned if the token was invalid or unknown.
+func (c *TokenController) Revoke(ctx *app.RevokeTokenContext) error {
+	payload := ctx.Payload
+	if payload == nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("payload", "nil").Expected("not empty payload"))
+	}
+	if payload.Token == "" {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("token", "").Expected("token to revoke"))
 	}
-	log.Error(ctx, map[string]interface{}{
-		"client_id":     payload.ClientID,
-		"client_secret": *payload.ClientSecret,
-	}, "Service Account secret doesn't match")
-	return nil, errors.NewUnauthorizedError("invalid Service Account ID or secret")
+
+	// any client is allowed to revoke the tokens, but confidential clients must be authenticated with their secret
+	_, err := c.app.OAuthClientService().AuthenticateClient(ctx, payload.ClientID, payload.ClientSecret, "")
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	err = c.app.TokenService().RevokeToken(ctx, payload.Token)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	ctx.ResponseData.Header().Set("Cache-Control", "no-cache")
+	return ctx.OK([]byte{})
+}
+
+// Introspect returns the state of an access or refresh token as defined by RFC 7662.
+// Only service accounts are allowed to introspect tokens.
+func (c *TokenController) Introspect(ctx *app.IntrospectTokenContext) error {
+	if !token.IsServiceAccount(ctx) {
+		log.Error(ctx, map[string]interface{}{}, "Unable to introspect token. Not a service account")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("not a service account"))
+	}
+	payload := ctx.Payload
+	if payload == nil || payload.Token == "" {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("token", "").Expected("token to introspect"))
+	}
+
+	result, err := c.app.TokenService().Introspect(ctx, payload.Token)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+
+	ctx.ResponseData.Header().Set("Cache-Control", "no-store")
+	return ctx.OK(result)
 }
 
 // Link links the user account to an external resource provider such as GitHub
@@ -2,8 +2,10 @@ package controller_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"path/filepath"
 	"strconv"
@@ -525,6 +527,94 @@ func (s *TokenControllerTestSuite) TestAuditRevokedToken() {
 	require.True(s.T(), strings.HasPrefix(authHeader, "LOGIN"))
 }
 
+func (s *TokenControllerTestSuite) TestRevokeToken() {
+
+	s.T().Run("ok with public client", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		at, err := testtoken.TokenManager.GenerateUserTokenForIdentity(s.Ctx, *user.Identity(), false)
+		require.NoError(t, err)
+		tk, err := s.Application.TokenService().RegisterToken(s.Ctx, user.IdentityID(), at.AccessToken, tokenPkg.TOKEN_TYPE_ACCESS, nil)
+		require.NoError(t, err)
+		svc, ctrl := s.UnsecuredController()
+		hint := "access_token"
+		// when
+		test.RevokeTokenOK(t, svc.Context, svc, ctrl, &app.TokenRevocation{Token: at.AccessToken, TokenTypeHint: &hint, ClientID: s.Configuration.GetPublicOAuthClientID()})
+		// then
+		loaded, err := s.Application.TokenRepository().Load(s.Ctx, tk.TokenID)
+		require.NoError(t, err)
+		assert.True(t, loaded.HasStatus(tokenPkg.TOKEN_STATUS_REVOKED))
+	})
+
+	s.T().Run("ok with service account", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		at, err := testtoken.TokenManager.GenerateUserTokenForIdentity(s.Ctx, *user.Identity(), false)
+		require.NoError(t, err)
+		tk, err := s.Application.TokenService().RegisterToken(s.Ctx, user.IdentityID(), at.RefreshToken, tokenPkg.TOKEN_TYPE_REFRESH, nil)
+		require.NoError(t, err)
+		svc, ctrl := s.UnsecuredController()
+		secret := "witsecret"
+		// when
+		test.RevokeTokenOK(t, svc.Context, svc, ctrl, &app.TokenRevocation{Token: at.RefreshToken, ClientID: "5dec5fdb-09e3-4453-b73f-5c828832b28e", ClientSecret: &secret})
+		// then
+		loaded, err := s.Application.TokenRepository().Load(s.Ctx, tk.TokenID)
+		require.NoError(t, err)
+		assert.True(t, loaded.HasStatus(tokenPkg.TOKEN_STATUS_REVOKED))
+	})
+
+	s.T().Run("ok with invalid token", func(t *testing.T) {
+		svc, ctrl := s.UnsecuredController()
+		test.RevokeTokenOK(t, svc.Context, svc, ctrl, &app.TokenRevocation{Token: "foobar", ClientID: s.Configuration.GetPublicOAuthClientID()})
+	})
+
+	s.T().Run("unauthorized with unknown client", func(t *testing.T) {
+		svc, ctrl := s.UnsecuredController()
+		test.RevokeTokenUnauthorized(t, svc.Context, svc, ctrl, &app.TokenRevocation{Token: "foobar", ClientID: uuid.NewV4().String()})
+	})
+
+	s.T().Run("unauthorized with wrong service account secret", func(t *testing.T) {
+		svc, ctrl := s.UnsecuredController()
+		secret := "foo"
+		test.RevokeTokenUnauthorized(t, svc.Context, svc, ctrl, &app.TokenRevocation{Token: "foobar", ClientID: "5dec5fdb-09e3-4453-b73f-5c828832b28e", ClientSecret: &secret})
+	})
+}
+
+func (s *TokenControllerTestSuite) TestIntrospectToken() {
+	user := s.Graph.CreateUser()
+	at, err := testtoken.TokenManager.GenerateUserTokenForIdentity(testtoken.ContextWithRequest(context.Background()), *user.Identity(), false)
+	require.NoError(s.T(), err)
+
+	s.T().Run("ok with service account", func(t *testing.T) {
+		// given
+		svc := testsupport.ServiceAsServiceAccountUser("Token-Service", account.Identity{Username: "fabric8-wit"})
+		ctrl := NewTokenController(svc, s.Application, testtoken.TokenManager, s.Configuration)
+		// when
+		_, result := test.IntrospectTokenOK(t, svc.Context, svc, ctrl, &app.TokenIntrospectionRequest{Token: at.AccessToken})
+		// then
+		require.True(t, result.Active)
+		require.NotNil(t, result.Sub)
+		assert.Equal(t, user.IdentityID().String(), *result.Sub)
+	})
+
+	s.T().Run("inactive with invalid token", func(t *testing.T) {
+		// given
+		svc := testsupport.ServiceAsServiceAccountUser("Token-Service", account.Identity{Username: "fabric8-wit"})
+		ctrl := NewTokenController(svc, s.Application, testtoken.TokenManager, s.Configuration)
+		// when
+		_, result := test.IntrospectTokenOK(t, svc.Context, svc, ctrl, &app.TokenIntrospectionRequest{Token: "foobar"})
+		// then
+		assert.False(t, result.Active)
+	})
+
+	s.T().Run("unauthorized with user account", func(t *testing.T) {
+		// given
+		svc, ctrl := s.SecuredControllerWithIdentity(*user.Identity())
+		// when/then
+		test.IntrospectTokenUnauthorized(t, svc.Context, svc, ctrl, &app.TokenIntrospectionRequest{Token: at.AccessToken})
+	})
+}
+
 func validateToken(t *testing.T, token *app.AuthToken) {
 	assert.NotNil(t, token, "Token data is nil")
 	assert.NotEmpty(t, token.Token.AccessToken, "Access token is empty")
@@ -547,6 +637,154 @@ func validateUserAndIdentity(t *testing.T, app application.Application) {
 	assert.Equal(t, identities[0].User.ID, users[0].ID)
 }
 
+func (s *TokenControllerTestSuite) TestExchangeWithDeviceCode() {
+	// given
+	provider, identity := s.getDummyOAuthIDPProvider(true)
+	testsupport.ActivateDummyIdentityProviderFactory(s, provider)
+	defer s.ResetFactories()
+	_, expectedAccessToken, expectedRefreshToken := newOAuthMockService(s.T(), identity)
+	svc, ctrl, _ := s.SecuredController()
+	clientID := ctrl.Configuration.GetPublicOAuthClientID()
+	grantType := "urn:ietf:params:oauth:grant-type:device_code"
+	ctx := manager.ContextWithTokenManager(testtoken.ContextWithRequest(context.Background()), testtoken.TokenManager)
+	deviceAuthorization, err := s.Application.DeviceAuthorizationService().AuthorizeDevice(ctx, clientID, nil,
+		"https://auth.openshift.io/api/authorize/device/verify")
+	require.NoError(s.T(), err)
+
+	s.T().Run("missing device code", func(t *testing.T) {
+		test.ExchangeTokenBadRequest(t, svc.Context, svc, ctrl, &app.TokenExchange{GrantType: grantType, ClientID: clientID})
+	})
+
+	s.T().Run("unknown device code", func(t *testing.T) {
+		deviceCode := uuid.NewV4().String()
+		oauthErr := exchangeTokenOAuthError(t, svc, ctrl, &app.TokenExchange{GrantType: grantType, ClientID: clientID, DeviceCode: &deviceCode})
+		assert.Equal(t, "invalid_grant", oauthErr)
+	})
+
+	s.T().Run("authorization pending", func(t *testing.T) {
+		oauthErr := exchangeTokenOAuthError(t, svc, ctrl, &app.TokenExchange{GrantType: grantType, ClientID: clientID, DeviceCode: &deviceAuthorization.DeviceCode})
+		assert.Equal(t, "authorization_pending", oauthErr)
+		// polling again within the interval
+		oauthErr = exchangeTokenOAuthError(t, svc, ctrl, &app.TokenExchange{GrantType: grantType, ClientID: clientID, DeviceCode: &deviceAuthorization.DeviceCode})
+		assert.Equal(t, "slow_down", oauthErr)
+	})
+
+	s.T().Run("ok once verified", func(t *testing.T) {
+		// the user verifies the device with the authentication provider
+		redirect := "https://openshift.io/somepath"
+		authCodeURL, err := s.Application.DeviceAuthorizationService().VerifyDevice(ctx, deviceAuthorization.UserCode,
+			&redirect, "", "https://auth.openshift.io/api/authorize/callback")
+		require.NoError(t, err)
+		locationURL, err := url.Parse(*authCodeURL)
+		require.NoError(t, err)
+		state := locationURL.Query().Get("state")
+		require.NotEmpty(t, state)
+		redirectTo, err := s.Application.AuthenticationProviderService().AuthorizeCallback(ctx, state, "SOME_OAUTH2.0_CODE")
+		require.NoError(t, err)
+		assert.Equal(t, redirect, *redirectTo)
+
+		_, token := test.ExchangeTokenOK(t, svc.Context, svc, ctrl, &app.TokenExchange{GrantType: grantType, ClientID: clientID, DeviceCode: &deviceAuthorization.DeviceCode})
+		require.NotNil(t, token)
+		require.NotNil(t, token.AccessToken)
+		assert.NoError(t, testtoken.EqualAccessTokens(context.Background(), expectedAccessToken, *token.AccessToken))
+		require.NotNil(t, token.RefreshToken)
+		assert.NoError(t, testtoken.EqualRefreshTokens(context.Background(), expectedRefreshToken, *token.RefreshToken))
+
+		// the device code can't be exchanged twice
+		oauthErr := exchangeTokenOAuthError(t, svc, ctrl, &app.TokenExchange{GrantType: grantType, ClientID: clientID, DeviceCode: &deviceAuthorization.DeviceCode})
+		assert.Equal(t, "invalid_grant", oauthErr)
+	})
+}
+
+// exchangeTokenOAuthError requests a token with the given payload, and returns the code of the OAuth error response
+// defined by RFC 6749, section 5.2, which is not a JSON API error document
+func exchangeTokenOAuthError(t *testing.T, svc *goa.Service, ctrl *TokenController, payload *app.TokenExchange) string {
+	rw := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/api/token", nil)
+	require.NoError(t, err)
+	goaCtx := goa.NewContext(goa.WithAction(svc.Context, "ExchangeTokenTest"), rw, req, url.Values{})
+	exchangeCtx, err := app.NewExchangeTokenContext(goaCtx, req, svc)
+	require.NoError(t, err)
+	exchangeCtx.Payload = payload
+
+	err = ctrl.Exchange(exchangeCtx)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+	var body map[string]string
+	err = json.NewDecoder(rw.Body).Decode(&body)
+	require.NoError(t, err)
+	return body["error"]
+}
+
+func (s *TokenControllerTestSuite) TestExchangeWithTokenExchange() {
+	// given
+	svc, ctrl, _ := s.SecuredController()
+	clientID := "5dec5fdb-09e3-4453-b73f-5c828832b28e"
+	clientSecret := "witsecret"
+	grantType := "urn:ietf:params:oauth:grant-type:token-exchange"
+	subjectTokenType := "urn:ietf:params:oauth:token-type:access_token"
+	audience := "https://backend.example.com"
+	ctx := manager.ContextWithTokenManager(testtoken.ContextWithRequest(context.Background()), testtoken.TokenManager)
+	g := s.NewTestGraph(s.T())
+	user := g.CreateUser()
+	space := g.CreateSpace().AddAdmin(user)
+	spaceID := space.SpaceID()
+	at, err := testtoken.TokenManager.GenerateUserTokenForIdentity(ctx, *user.Identity(), false)
+	require.NoError(s.T(), err)
+
+	s.T().Run("ok", func(t *testing.T) {
+		// when
+		scope := "view"
+		_, token := test.ExchangeTokenOK(t, svc.Context, svc, ctrl, &app.TokenExchange{
+			GrantType:        grantType,
+			ClientID:         clientID,
+			ClientSecret:     &clientSecret,
+			SubjectToken:     &at.AccessToken,
+			SubjectTokenType: &subjectTokenType,
+			Audience:         &audience,
+			ResourceID:       &spaceID,
+			Scope:            &scope,
+		})
+		// then
+		require.NotNil(t, token.AccessToken)
+		require.NotNil(t, token.IssuedTokenType)
+		assert.Equal(t, subjectTokenType, *token.IssuedTokenType)
+		require.NotNil(t, token.TokenType)
+		assert.Equal(t, "Bearer", *token.TokenType)
+		assert.Nil(t, token.RefreshToken)
+		claims, err := testtoken.TokenManager.ParseToken(ctx, *token.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user.IdentityID().String(), claims.Subject)
+		assert.Equal(t, audience, claims.Audience)
+		require.NotNil(t, claims.Actor)
+		assert.Equal(t, clientID, claims.Actor.Subject)
+		require.Len(t, *claims.Permissions, 1)
+		assert.Equal(t, []string{"view"}, (*claims.Permissions)[0].Scopes)
+	})
+
+	s.T().Run("incomplete payload", func(t *testing.T) {
+		test.ExchangeTokenBadRequest(t, svc.Context, svc, ctrl, &app.TokenExchange{GrantType: grantType, ClientID: clientID, ClientSecret: &clientSecret,
+			SubjectTokenType: &subjectTokenType, Audience: &audience})
+		test.ExchangeTokenBadRequest(t, svc.Context, svc, ctrl, &app.TokenExchange{GrantType: grantType, ClientID: clientID, ClientSecret: &clientSecret,
+			SubjectToken: &at.AccessToken, Audience: &audience})
+		test.ExchangeTokenBadRequest(t, svc.Context, svc, ctrl, &app.TokenExchange{GrantType: grantType, ClientID: clientID, ClientSecret: &clientSecret,
+			SubjectToken: &at.AccessToken, SubjectTokenType: &subjectTokenType})
+	})
+
+	s.T().Run("wrong credentials", func(t *testing.T) {
+		wrongSecret := "someString"
+		test.ExchangeTokenUnauthorized(t, svc.Context, svc, ctrl, &app.TokenExchange{GrantType: grantType, ClientID: clientID, ClientSecret: &wrongSecret,
+			SubjectToken: &at.AccessToken, SubjectTokenType: &subjectTokenType, Audience: &audience})
+	})
+
+	s.T().Run("public client", func(t *testing.T) {
+		publicClientID := s.Configuration.GetPublicOAuthClientID()
+		test.ExchangeTokenUnauthorized(t, svc.Context, svc, ctrl, &app.TokenExchange{GrantType: grantType, ClientID: publicClientID, ClientSecret: &clientSecret,
+			SubjectToken: &at.AccessToken, SubjectTokenType: &subjectTokenType, Audience: &audience})
+	})
+}
+
 func (s *TokenControllerTestSuite) checkServiceAccountCredentials(name string, id string, secret string) {
 	svc, ctrl, _ := s.SecuredController()
 	_, saToken := test.ExchangeTokenOK(s.T(), svc.Context, svc, ctrl, &app.TokenExchange{GrantType: "client_credentials", ClientSecret: &secret, ClientID: id})
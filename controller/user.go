@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/fabric8-services/fabric8-auth/app"
 	"github.com/fabric8-services/fabric8-auth/application"
@@ -14,6 +15,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/rest"
 
 	"github.com/goadesign/goa"
+	"github.com/satori/go.uuid"
 )
 
 // UserController implements the user resource.
@@ -96,6 +98,51 @@ func (c *UserController) ListResources(ctx *app.ListResourcesUserContext) error
 	return ctx.OK(convertToUserResources(ctx.RequestData, resourceType, resourceIDs))
 }
 
+// Export returns an archive of all the personal data held about the authorized user
+func (c *UserController) Export(ctx *app.ExportUserContext) error {
+	// retrieve the user's identity ID from the token
+	identityID, err := c.tokenManager.Locate(ctx)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err": err,
+		}, "Bad Token")
+		return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError("bad or missing token"))
+	}
+	result, err := c.app.UserService().ExportPersonalData(ctx, identityID)
+	if err != nil {
+		if notFound, _ := errors.IsNotFoundError(err); notFound {
+			return jsonapi.JSONErrorResponse(ctx, errors.NewUnauthorizedError(fmt.Sprintf("auth token contains id %s of unknown Identity", identityID)))
+		}
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	setUserDataExportHeaders(ctx.ResponseData, identityID)
+	return ctx.OK(result)
+}
+
+// Delete schedules the deletion of the account of the authorized user at the end of the cooling-off period
+func (c *UserController) Delete(ctx *app.DeleteUserContext) error {
+	identity, err := c.app.UserService().RequestDeletion(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(ConvertToAppUser(ctx.RequestData, &identity.User, identity, true))
+}
+
+// CancelDeletion cancels the scheduled deletion of the account of the authorized user
+func (c *UserController) CancelDeletion(ctx *app.CancelDeletionUserContext) error {
+	identity, err := c.app.UserService().CancelDeletion(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(ConvertToAppUser(ctx.RequestData, &identity.User, identity, true))
+}
+
+// setUserDataExportHeaders sets the headers to download the export of the personal data of the given identity as a file
+func setUserDataExportHeaders(response *goa.ResponseData, identityID uuid.UUID) {
+	response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"user-data-%s.json\"", identityID))
+	response.Header().Set("Cache-Control", "no-store")
+}
+
 // convertToUserResources converts a list of resources to which the user has a role
 func convertToUserResources(request *goa.RequestData, resourceType string, resourceIDs []string) *app.UserResourcesList {
 	data := make([]*app.UserResourceData, 0)
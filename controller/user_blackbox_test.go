@@ -283,6 +283,83 @@ func (s *UserControllerTestSuite) TestListUserResources() {
 
 }
 
+func (s *UserControllerTestSuite) TestExportUser() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		g := s.NewTestGraph(t)
+		user := g.CreateUser()
+		space := g.CreateSpace().AddAdmin(user)
+		svc, userCtrl := s.SecuredController(*user.Identity())
+		// when
+		res, result := test.ExportUserOK(t, svc.Context, svc, userCtrl)
+		// then
+		assert.Equal(t, user.User().ID, result.User.ID)
+		require.Len(t, result.Identities, 1)
+		assert.Equal(t, user.IdentityID(), result.Identities[0].ID)
+		require.Len(t, result.Roles, 1)
+		assert.Equal(t, space.SpaceID(), result.Roles[0].ResourceID)
+		assert.Equal(t, fmt.Sprintf("attachment; filename=\"user-data-%s.json\"", user.IdentityID()), res.Header().Get("Content-Disposition"))
+		assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+	})
+
+	s.T().Run("unauthorized", func(t *testing.T) {
+
+		t.Run("missing token", func(t *testing.T) {
+			// given
+			svc, userCtrl := s.UnsecuredController()
+			// when/then
+			test.ExportUserUnauthorized(t, svc.Context, svc, userCtrl)
+		})
+
+		t.Run("unknown identity", func(t *testing.T) {
+			// given
+			svc, userCtrl := s.SecuredController(account.Identity{ID: uuid.NewV4(), Username: "unknown"})
+			// when/then
+			test.ExportUserUnauthorized(t, svc.Context, svc, userCtrl)
+		})
+	})
+}
+
+func (s *UserControllerTestSuite) TestDeleteUser() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		svc, userCtrl := s.SecuredController(*user.Identity())
+		// when
+		_, result := test.DeleteUserOK(t, svc.Context, svc, userCtrl)
+		// then
+		assert.Equal(t, user.IdentityID().String(), *result.Data.ID)
+		require.NotNil(t, result.Data.Attributes.DeletionScheduledAt)
+		assert.True(t, result.Data.Attributes.DeletionScheduledAt.After(time.Now()))
+
+		t.Run("cancel", func(t *testing.T) {
+			// when
+			_, result := test.CancelDeletionUserOK(t, svc.Context, svc, userCtrl)
+			// then
+			assert.Equal(t, user.IdentityID().String(), *result.Data.ID)
+			assert.Nil(t, result.Data.Attributes.DeletionScheduledAt)
+		})
+	})
+
+	s.T().Run("unauthorized", func(t *testing.T) {
+		// given
+		svc, userCtrl := s.UnsecuredController()
+		// when/then
+		test.DeleteUserUnauthorized(t, svc.Context, svc, userCtrl)
+		test.CancelDeletionUserUnauthorized(t, svc.Context, svc, userCtrl)
+	})
+
+	s.T().Run("no deletion scheduled", func(t *testing.T) {
+		// given
+		user := s.Graph.CreateUser()
+		svc, userCtrl := s.SecuredController(*user.Identity())
+		// when/then
+		test.CancelDeletionUserNotFound(t, svc.Context, svc, userCtrl)
+	})
+}
+
 func (s *UserControllerTestSuite) checkPrivateEmailVisible(t *testing.T, emailPrivate bool) {
 	testUser := account.User{
 		ID:           uuid.NewV4(),
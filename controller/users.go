@@ -16,6 +16,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/authentication/account"
 	accountrepo "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
 	"github.com/fabric8-services/fabric8-auth/authentication/account/service"
+	"github.com/fabric8-services/fabric8-auth/authorization"
 	"github.com/fabric8-services/fabric8-auth/errors"
 	"github.com/fabric8-services/fabric8-auth/jsonapi"
 	"github.com/fabric8-services/fabric8-auth/log"
@@ -85,10 +86,90 @@ func (c *UsersController) Show(ctx *app.ShowUsersContext) error {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
 	return ctx.ConditionalRequest(identity.User, c.config.GetCacheControlUser, func() error {
-		return ctx.OK(ConvertToAppUser(ctx.RequestData, &identity.User, identity, isServiceAccount))
+		appUser := ConvertToAppUser(ctx.RequestData, &identity.User, identity, isServiceAccount)
+		if isServiceAccount {
+			setServiceProfileAttributes(appUser, &identity.User)
+		}
+		return ctx.OK(appUser)
 	})
 }
 
+// Export returns an archive of all the personal data held about the user with the given identity ID.
+// Requires the manage user scope on the system resource.
+func (c *UsersController) Export(ctx *app.ExportUsersContext) error {
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	err = c.app.PermissionService().RequireSystemScope(ctx, *currentIdentity, authorization.ManageUserSystemScope)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	identityID, err := uuid.FromString(ctx.ID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("identity_id", ctx.ID))
+	}
+	result, err := c.app.UserService().ExportPersonalData(ctx, identityID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	log.Info(ctx, map[string]interface{}{
+		"identity_id":         identityID,
+		"current_identity_id": *currentIdentity,
+	}, "personal data of the user exported by an administrator")
+	setUserDataExportHeaders(ctx.ResponseData, identityID)
+	return ctx.OK(result)
+}
+
+// Merge merges the user of the source identity given in the payload into the user with the given identity ID
+func (c *UsersController) Merge(ctx *app.MergeUsersContext) error {
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	err = c.app.PermissionService().RequireSystemScope(ctx, *currentIdentity, authorization.ManageUserSystemScope)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	targetIdentityID, err := uuid.FromString(ctx.ID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("identity_id", ctx.ID))
+	}
+	sourceIdentityID, err := uuid.FromString(ctx.Payload.Data.Attributes.SourceIdentityID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("source_identity_id", ctx.Payload.Data.Attributes.SourceIdentityID))
+	}
+	identity, err := c.app.UserService().MergeUsers(ctx, sourceIdentityID, targetIdentityID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	log.Info(ctx, map[string]interface{}{
+		"source_identity_id":  sourceIdentityID,
+		"target_identity_id":  targetIdentityID,
+		"current_identity_id": *currentIdentity,
+	}, "users merged by an administrator")
+	return ctx.OK(ConvertToAppUser(ctx.RequestData, &identity.User, identity, true))
+}
+
+// UpdateProfileAttributes sets the values of the custom profile attributes of the user with the given identity ID.
+// Requires the manage user scope on the system resource.
+func (c *UsersController) UpdateProfileAttributes(ctx *app.UpdateProfileAttributesUsersContext) error {
+	currentIdentity, err := currentIdentityID(ctx)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	identityID, err := uuid.FromString(ctx.ID)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, errors.NewBadParameterError("identity_id", ctx.ID))
+	}
+	identity, err := c.app.ProfileAttributeService().UpdateAttributes(ctx, *currentIdentity, identityID, ctx.Payload.ProfileAttributes)
+	if err != nil {
+		return jsonapi.JSONErrorResponse(ctx, err)
+	}
+	appUser := ConvertToAppUser(ctx.RequestData, &identity.User, identity, true)
+	return ctx.OK(setServiceProfileAttributes(appUser, &identity.User))
+}
+
 // Create creates a user when requested using a service account token
 func (c *UsersController) Create(ctx *app.CreateUsersContext) error {
 
@@ -149,9 +230,11 @@ func (c *UsersController) Create(ctx *app.CreateUsersContext) error {
 	if err != nil {
 		log.Error(ctx, map[string]interface{}{
 			"err":      err,
-			"username": identity.Username,
+			"username": ctx.Payload.Data.Attributes.Username,
 		}, "failed to create user in DB")
-
+		if badParameter, _ := errors.IsBadParameterError(err); badParameter {
+			return jsonapi.JSONErrorResponse(ctx, err)
+		}
 		return jsonapi.JSONErrorResponse(ctx, errors.NewInternalError(ctx, err))
 	}
 
@@ -216,7 +299,6 @@ func (c *UsersController) createUserInDB(ctx *app.CreateUsersContext, identityID
 	}
 	identity = &accountrepo.Identity{
 		ID:           identityID,
-		Username:     ctx.Payload.Data.Attributes.Username,
 		ProviderType: accountrepo.DefaultIDP, // Ignore Provider Type passed in the payload. We should always use the default
 	}
 
@@ -267,6 +349,10 @@ func (c *UsersController) createUserInDB(ctx *app.CreateUsersContext, identityID
 	}
 
 	returnErrorResponse := transaction.Transactional(c.app, func(tr transaction.TransactionalResources) error {
+		err = c.app.UserService().ClaimUsername(ctx, tr, identity, ctx.Payload.Data.Attributes.Username)
+		if err != nil {
+			return err
+		}
 		err = tr.Users().Create(ctx, user)
 		if err != nil {
 			return err
@@ -296,7 +382,7 @@ func (c *UsersController) Update(ctx *app.UpdateUsersContext) error {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
 
-	var isEmailVerificationNeeded bool
+	var isEmailChangeRequested bool
 
 	var identity *accountrepo.Identity
 	var user *accountrepo.User
@@ -314,8 +400,17 @@ func (c *UsersController) Update(ctx *app.UpdateUsersContext) error {
 			}
 		}
 
+		// the custom profile attributes are validated first, and saved along with the rest of the profile
+		updatedProfileAttributes := ctx.Payload.Data.Attributes.ProfileAttributes
+		if updatedProfileAttributes != nil {
+			err = c.app.ProfileAttributeService().SetAttributes(ctx, tr, identity.ID, identity.ID, user, updatedProfileAttributes)
+			if err != nil {
+				return err
+			}
+		}
+
 		updatedEmail := ctx.Payload.Data.Attributes.Email
-		if updatedEmail != nil && *updatedEmail != user.Email {
+		if updatedEmail != nil && *updatedEmail != user.Email && *updatedEmail != user.PendingEmail {
 			isValid := isEmailValid(*updatedEmail)
 			if !isValid {
 				return errors.NewBadParameterError("email", *updatedEmail).Expected("valid email")
@@ -328,10 +423,9 @@ func (c *UsersController) Update(ctx *app.UpdateUsersContext) error {
 				// TODO: Add errors.NewConflictError(..)
 				return errs.Wrap(errors.NewBadParameterError("email", *updatedEmail).Expected("unique email"), fmt.Sprintf("email : %s is already in use", *updatedEmail))
 			}
-			user.Email = *updatedEmail
-
-			isEmailVerificationNeeded = true
-			user.EmailVerified = false
+			// the new email address only replaces the current one once the change is confirmed from both addresses
+			user.PendingEmail = *updatedEmail
+			isEmailChangeRequested = true
 		}
 
 		updatedUserName := ctx.Payload.Data.Attributes.Username
@@ -351,7 +445,10 @@ func (c *UsersController) Update(ctx *app.UpdateUsersContext) error {
 				// TODO : Add errors.NewConflictError(..)
 				return errs.Wrap(errors.NewBadParameterError("username", *updatedUserName).Expected("unique username"), fmt.Sprintf("username : %s is already in use", *updatedUserName))
 			}
-			identity.Username = *updatedUserName
+			err = c.app.UserService().ClaimUsername(ctx, tr, identity, *updatedUserName)
+			if err != nil {
+				return err
+			}
 		}
 
 		updatedRegistratedCompleted := ctx.Payload.Data.Attributes.RegistrationCompleted
@@ -439,15 +536,16 @@ func (c *UsersController) Update(ctx *app.UpdateUsersContext) error {
 		return jsonapi.JSONErrorResponse(ctx, err)
 	}
 
-	if isEmailVerificationNeeded {
-		_, err = c.EmailVerificationService.SendVerificationCode(ctx, ctx.RequestData, *identity)
+	if isEmailChangeRequested {
+		err = c.EmailVerificationService.SendEmailChangeCodes(ctx, ctx.RequestData, *identity)
 		if err != nil {
 			log.Error(ctx, map[string]interface{}{
 				"identity_id": loggedInIdentity.ID.String(),
 				"err":         err,
 				"username":    identity.Username,
 				"email":       user.Email,
-			}, "failed to send verification email for update on email")
+				"new_email":   user.PendingEmail,
+			}, "failed to send the confirmation emails for update on email")
 		}
 	}
 
@@ -669,6 +767,25 @@ func (c *UsersController) VerifyEmail(ctx *app.VerifyEmailUsersContext) error {
 	return ctx.TemporaryRedirect()
 }
 
+// RevertEmail reverts the change of a user's email address, using the code sent to the previous address.
+func (c *UsersController) RevertEmail(ctx *app.RevertEmailUsersContext) error {
+	_, err := c.EmailVerificationService.RevertEmail(ctx, ctx.Code)
+	isReverted := err == nil
+	redirectURL, rerr := rest.AddParam(c.config.GetEmailVerifiedRedirectURL(), "reverted", fmt.Sprint(isReverted))
+	if rerr != nil {
+		return rerr
+	}
+	if err != nil {
+		redirectURL, rerr = rest.AddParam(redirectURL, "error", err.Error())
+		if rerr != nil {
+			return rerr
+		}
+	}
+
+	ctx.ResponseData.Header().Set("Location", redirectURL)
+	return ctx.TemporaryRedirect()
+}
+
 func filterUsers(repos repository.Repositories, ctx *app.ListUsersContext) ([]accountrepo.User, []accountrepo.Identity, error) {
 	var err error
 	var resultUsers []accountrepo.User
@@ -680,6 +797,14 @@ func filterUsers(repos repository.Repositories, ctx *app.ListUsersContext) ([]ac
 	*/
 	identityFilters := []func(*gorm.DB) *gorm.DB{}
 	userFilters := []func(*gorm.DB) *gorm.DB{}
+	var profileAttributeName string
+	var profileAttributeValue interface{}
+	if ctx.FilterProfileAttribute != nil {
+		profileAttributeName, profileAttributeValue, err = parseProfileAttributeFilter(ctx, repos, *ctx.FilterProfileAttribute)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 	/*** Start filtering on Identities table ****/
 	if ctx.FilterUsername != nil {
 		identityFilters = append(identityFilters, accountrepo.IdentityFilterByUsername(*ctx.FilterUsername))
@@ -693,10 +818,20 @@ func filterUsers(repos repository.Repositories, ctx *app.ListUsersContext) ([]ac
 		if err != nil {
 			return nil, nil, errs.Wrap(err, "error fetching identities with filter(s)")
 		}
+		if len(filteredIdentities) == 0 && ctx.FilterUsername != nil {
+			// resolve a previous username to the identity which released it last
+			filteredIdentities, err = loadIdentityByPreviousUsername(ctx, repos, *ctx.FilterUsername)
+			if err != nil {
+				return nil, nil, errs.Wrap(err, "error fetching identities by previous username")
+			}
+		}
 		// cumulatively filter out those not matching the user-based filters.
 		for _, identity := range filteredIdentities {
 			// this is where you keep trying all other filters one by one for 'user' fields like email.
 			// If email filter is present then ignore private emails
+			if ctx.FilterProfileAttribute != nil && !hasPublicProfileAttribute(identity.User, profileAttributeName, profileAttributeValue) {
+				continue
+			}
 			if ctx.FilterEmail == nil || (identity.User.Email == *ctx.FilterEmail && !identity.User.EmailPrivate) {
 				resultUsers = append(resultUsers, identity.User)
 				resultIdentities = append(resultIdentities, identity)
@@ -709,6 +844,9 @@ func filterUsers(repos repository.Repositories, ctx *app.ListUsersContext) ([]ac
 			userFilters = append(userFilters, accountrepo.UserFilterByEmail(*ctx.FilterEmail))
 			userFilters = append(userFilters, accountrepo.UserFilterByEmailPrivacy(false)) // Ignore users with private emails
 		}
+		if ctx.FilterProfileAttribute != nil {
+			userFilters = append(userFilters, accountrepo.UserFilterByProfileAttribute(profileAttributeName, profileAttributeValue, account.ProfileAttributeVisibilityPublic))
+		}
 		// .. Add other filters in future when needed into the userFilters slice in the above manner.
 		if len(userFilters) != 0 {
 			filteredUsers, err = repos.Users().Query(userFilters...)
@@ -732,6 +870,51 @@ func filterUsers(repos repository.Repositories, ctx *app.ListUsersContext) ([]ac
 	return resultUsers, resultIdentities, nil
 }
 
+// parseProfileAttributeFilter parses the given filter on a public custom profile attribute, formatted as name:value,
+// and returns the name of the attribute and the value in the form in which it is stored
+func parseProfileAttributeFilter(ctx context.Context, repos repository.Repositories, filter string) (string, interface{}, error) {
+	parts := strings.SplitN(filter, ":", 2)
+	if len(parts) != 2 {
+		return "", nil, errors.NewBadParameterErrorFromString("filter[profileAttribute]", filter, "the filter must be formatted as name:value")
+	}
+	definition, err := repos.ProfileAttributeDefinitions().LoadByName(ctx, parts[0])
+	if err != nil {
+		if notFound, _ := errors.IsNotFoundError(err); notFound {
+			return "", nil, errors.NewBadParameterErrorFromString("filter[profileAttribute]", filter, "unknown profile attribute")
+		}
+		return "", nil, err
+	}
+	if definition.Visibility != account.ProfileAttributeVisibilityPublic {
+		return "", nil, errors.NewBadParameterErrorFromString("filter[profileAttribute]", filter, "only the public profile attributes can be used to search users")
+	}
+	value, err := service.ParseProfileAttributeValue(*definition, parts[1])
+	if err != nil {
+		return "", nil, err
+	}
+	return definition.Name, value, nil
+}
+
+// hasPublicProfileAttribute returns true if the given user has the given value of the given public custom profile attribute
+func hasPublicProfileAttribute(user accountrepo.User, name string, value interface{}) bool {
+	attribute, found := user.ProfileAttributes[name]
+	return found && attribute.Visibility == account.ProfileAttributeVisibilityPublic && attribute.Value == value
+}
+
+// loadIdentityByPreviousUsername returns the default IDP identity which released the given username last, if any
+func loadIdentityByPreviousUsername(ctx context.Context, repos repository.Repositories, username string) ([]accountrepo.Identity, error) {
+	history, err := repos.UsernameHistory().LoadLatestByUsername(ctx, username)
+	if err != nil {
+		if notFound, _ := errors.IsNotFoundError(err); notFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return repos.Identities().Query(
+		accountrepo.IdentityFilterByID(history.IdentityID),
+		accountrepo.IdentityFilterByProviderType(accountrepo.DefaultIDP),
+		accountrepo.IdentityWithUser())
+}
+
 // loadDefaultIdpIdentities loads identities for the default IDP users and returns the valid users along with their KC identities
 // (if a user is missing his/her KC identity, he/she is filtered out of the result array)
 func loadDefaultIdpIdentities(repos repository.Repositories, users []accountrepo.User) ([]accountrepo.User, []accountrepo.Identity, error) {
@@ -765,9 +948,9 @@ func loadDefaultIdpIdentity(repos repository.Repositories, user accountrepo.User
 
 // ConvertToAppUser converts a complete Identity object into REST representation
 // if isAuthenticated is set to True, then the 'email' field is populated irrespective of whether
-// 'emailPrivate' = true/false.
+// 'emailPrivate' = true/false, and the private custom profile attributes are returned.
 // if isAuthenticated is set of False, then the 'email' field is populated only if
-// 'emailPrivate' = false.
+// 'emailPrivate' = false, and only the public custom profile attributes are returned.
 func ConvertToAppUser(request *goa.RequestData, user *accountrepo.User, identity *accountrepo.Identity, isAuthenticated bool) *app.User {
 	userID := user.ID.String()
 	identityID := identity.ID.String()
@@ -837,6 +1020,19 @@ func ConvertToAppUser(request *goa.RequestData, user *accountrepo.User, identity
 			Links: createUserLinks(request, &identity.ID),
 		},
 	}
+	if user != nil && isAuthenticated {
+		if user.PendingEmail != "" {
+			converted.Data.Attributes.PendingEmail = &user.PendingEmail
+		}
+		converted.Data.Attributes.DeletionScheduledAt = user.DeletionScheduledAt
+	}
+	if user != nil {
+		if isAuthenticated {
+			converted.Data.Attributes.ProfileAttributes = user.ProfileAttributes.Visible(account.ProfileAttributeVisibilityPublic, account.ProfileAttributeVisibilityPrivate)
+		} else {
+			converted.Data.Attributes.ProfileAttributes = user.ProfileAttributes.Visible(account.ProfileAttributeVisibilityPublic)
+		}
+	}
 	for name, value := range contextInformation {
 		if value == nil {
 			// this can be used to unset a key in contextInformation
@@ -847,6 +1043,14 @@ func ConvertToAppUser(request *goa.RequestData, user *accountrepo.User, identity
 	return &converted
 }
 
+// setServiceProfileAttributes sets all the custom profile attributes of the given user in its given REST representation,
+// including the attributes which are only visible to the service accounts
+func setServiceProfileAttributes(converted *app.User, user *accountrepo.User) *app.User {
+	converted.Data.Attributes.ProfileAttributes = user.ProfileAttributes.Visible(
+		account.ProfileAttributeVisibilityPublic, account.ProfileAttributeVisibilityPrivate, account.ProfileAttributeVisibilityService)
+	return converted
+}
+
 // ConvertUsersSimple converts a array of simple Identity IDs into a Generic Reletionship List
 func ConvertUsersSimple(request *goa.RequestData, identityIDs []interface{}) []*app.GenericData {
 	var ops []*app.GenericData
@@ -14,6 +14,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/authentication/account"
 	accountrepo "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
 	"github.com/fabric8-services/fabric8-auth/authentication/account/service"
+	"github.com/fabric8-services/fabric8-auth/authorization"
 	"github.com/fabric8-services/fabric8-auth/configuration"
 	. "github.com/fabric8-services/fabric8-auth/controller"
 	"github.com/fabric8-services/fabric8-auth/errors"
@@ -64,7 +65,7 @@ func (s *UsersControllerTestSuite) SetupSuite() {
 func (s *UsersControllerTestSuite) UnsecuredController() (*goa.Service, *UsersController) {
 	svc := testsupport.UnsecuredService("Users-Service")
 	controller := NewUsersController(s.svc, s.Application, s.Configuration)
-	controller.EmailVerificationService = service.NewEmailVerificationClient(s.Application)
+	controller.EmailVerificationService = service.NewEmailVerificationClient(s.Application, s.Configuration)
 	return svc, controller
 }
 
@@ -74,14 +75,14 @@ func (s *UsersControllerTestSuite) UnsecuredControllerDeprovisionedUser() (*goa.
 
 	svc := testsupport.ServiceAsUser("Users-Service", identity)
 	controller := NewUsersController(s.svc, s.Application, s.Configuration)
-	controller.EmailVerificationService = service.NewEmailVerificationClient(s.Application)
+	controller.EmailVerificationService = service.NewEmailVerificationClient(s.Application, s.Configuration)
 	return svc, controller
 }
 
 func (s *UsersControllerTestSuite) SecuredController(identity accountrepo.Identity) (*goa.Service, *UsersController) {
 	svc := testsupport.ServiceAsUser("Users-Service", identity)
 	controller := NewUsersController(s.svc, s.Application, s.Configuration)
-	controller.EmailVerificationService = service.NewEmailVerificationClient(s.Application)
+	controller.EmailVerificationService = service.NewEmailVerificationClient(s.Application, s.Configuration)
 	return svc, controller
 }
 
@@ -570,7 +571,7 @@ func (s *UsersControllerTestSuite) TestUpdateUser() {
 			// when
 			email := user.Email
 			// by default, email is public.
-			_, result := test.ListUsersOK(t, nil, nil, s.controller, &email, nil, nil, nil)
+			_, result := test.ListUsersOK(t, nil, nil, s.controller, &email, nil, nil, nil, nil)
 			returnedUser := result.Data[0].Attributes
 			require.Equal(t, email, *returnedUser.Email)
 			require.False(t, *returnedUser.EmailPrivate)
@@ -625,7 +626,7 @@ func (s *UsersControllerTestSuite) TestUpdateUser() {
 			// when
 			email := user.Email
 			// by default, email is public.
-			_, result := test.ListUsersOK(t, nil, nil, s.controller, &email, nil, nil, nil)
+			_, result := test.ListUsersOK(t, nil, nil, s.controller, &email, nil, nil, nil, nil)
 			returnedUser := result.Data[0].Attributes
 			require.Equal(t, email, *returnedUser.Email)
 			require.False(t, *returnedUser.EmailPrivate)
@@ -652,7 +653,7 @@ func (s *UsersControllerTestSuite) TestUpdateUser() {
 
 			// But when you try to access the same with an API which doesn't respect auth,
 			// it wouldn't be visible.
-			_, result = test.ListUsersOK(t, nil, nil, s.controller, &email, nil, nil, nil)
+			_, result = test.ListUsersOK(t, nil, nil, s.controller, &email, nil, nil, nil, nil)
 			require.Empty(t, result.Data)
 
 			// the /api/users/<ID> endpoint should also hide out the email.
@@ -719,6 +720,17 @@ func (s *UsersControllerTestSuite) TestUpdateUser() {
 			test.UpdateUsersBadRequest(t, secureService.Context, secureService, secureController, updateUsersPayload)
 		})
 
+		t.Run("quarantined username", func(t *testing.T) {
+			// given a username released by another user
+			_, identity1 := s.createRandomUserIdentity(t, "TestUpdateUser")
+			_, identity2 := s.createRandomUserIdentity(t, "TestUpdateUser")
+			secureService, secureController := s.SecuredController(identity1)
+			test.UpdateUsersOK(t, secureService.Context, secureService, secureController, newUpdateUsersPayload(WithUpdatedUsername(identity1.Username+"-renamed")))
+			// when/then
+			secureService, secureController = s.SecuredController(identity2)
+			test.UpdateUsersBadRequest(t, secureService.Context, secureService, secureController, newUpdateUsersPayload(WithUpdatedUsername(identity1.Username)))
+		})
+
 		t.Run("existing email", func(t *testing.T) {
 			// create 2 users.
 			// user1, identity1 := s.createRandomUserIdentity(t, "TestUpdateUser")
@@ -844,6 +856,122 @@ func (s *UsersControllerTestSuite) TestUpdateUser() {
 
 }
 
+func (s *UsersControllerTestSuite) TestExportUser() {
+	g := s.NewTestGraph(s.T())
+	admin := g.CreateUser()
+	g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).AddRole(admin, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		user := g.CreateUser()
+		org := g.CreateOrganization().AddMember(user)
+		svc, ctrl := s.SecuredController(*admin.Identity())
+		// when
+		res, result := test.ExportUsersOK(t, svc.Context, svc, ctrl, user.IdentityID().String())
+		// then
+		assert.Equal(t, user.User().ID, result.User.ID)
+		assert.Equal(t, user.User().Email, result.User.Email)
+		require.Len(t, result.Memberships, 1)
+		assert.Equal(t, org.ResourceID(), result.Memberships[0].ResourceID)
+		assert.Equal(t, fmt.Sprintf("attachment; filename=\"user-data-%s.json\"", user.IdentityID()), res.Header().Get("Content-Disposition"))
+	})
+
+	s.T().Run("bad request", func(t *testing.T) {
+		// given
+		svc, ctrl := s.SecuredController(*admin.Identity())
+		// when/then
+		test.ExportUsersBadRequest(t, svc.Context, svc, ctrl, "foo")
+	})
+
+	s.T().Run("not found", func(t *testing.T) {
+		// given
+		svc, ctrl := s.SecuredController(*admin.Identity())
+		// when/then
+		test.ExportUsersNotFound(t, svc.Context, svc, ctrl, uuid.NewV4().String())
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		// given
+		user := g.CreateUser()
+		svc, ctrl := s.SecuredController(*user.Identity())
+		// when/then
+		test.ExportUsersForbidden(t, svc.Context, svc, ctrl, admin.IdentityID().String())
+	})
+
+	s.T().Run("unauthorized", func(t *testing.T) {
+		// given
+		svc, ctrl := s.UnsecuredController()
+		// when/then
+		test.ExportUsersUnauthorized(t, svc.Context, svc, ctrl, admin.IdentityID().String())
+	})
+}
+
+func (s *UsersControllerTestSuite) TestMergeUsers() {
+	g := s.NewTestGraph(s.T())
+	admin := g.CreateUser()
+	g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).AddRole(admin, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+	mergePayload := func(sourceIdentityID string) *app.MergeUsersPayload {
+		return &app.MergeUsersPayload{
+			Data: &app.MergeUsersData{
+				Type:       "identities",
+				Attributes: &app.MergeUsersDataAttributes{SourceIdentityID: sourceIdentityID},
+			},
+		}
+	}
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		source := g.CreateUser()
+		target := g.CreateUser()
+		space := g.CreateSpace().AddContributor(source)
+		svc, ctrl := s.SecuredController(*admin.Identity())
+		// when
+		_, result := test.MergeUsersOK(t, svc.Context, svc, ctrl, target.IdentityID().String(), mergePayload(source.IdentityID().String()))
+		// then
+		assert.Equal(t, target.IdentityID().String(), *result.Data.ID)
+		assert.Equal(t, target.User().Email, *result.Data.Attributes.Email)
+		identity, err := s.Application.Identities().LoadWithUser(s.Ctx, source.IdentityID())
+		require.NoError(t, err)
+		assert.Equal(t, target.User().ID, identity.User.ID)
+		identityRoles, err := s.Application.IdentityRoleRepository().FindIdentityRolesByIdentityAndResource(s.Ctx, space.SpaceID(), target.IdentityID())
+		require.NoError(t, err)
+		assert.Len(t, identityRoles, 1)
+	})
+
+	s.T().Run("bad request", func(t *testing.T) {
+		// given
+		user := g.CreateUser()
+		svc, ctrl := s.SecuredController(*admin.Identity())
+		// when/then
+		test.MergeUsersBadRequest(t, svc.Context, svc, ctrl, "foo", mergePayload(user.IdentityID().String()))
+		test.MergeUsersBadRequest(t, svc.Context, svc, ctrl, user.IdentityID().String(), mergePayload("foo"))
+		test.MergeUsersBadRequest(t, svc.Context, svc, ctrl, user.IdentityID().String(), mergePayload(user.IdentityID().String()))
+	})
+
+	s.T().Run("not found", func(t *testing.T) {
+		// given
+		user := g.CreateUser()
+		svc, ctrl := s.SecuredController(*admin.Identity())
+		// when/then
+		test.MergeUsersNotFound(t, svc.Context, svc, ctrl, user.IdentityID().String(), mergePayload(uuid.NewV4().String()))
+	})
+
+	s.T().Run("forbidden", func(t *testing.T) {
+		// given
+		user := g.CreateUser()
+		svc, ctrl := s.SecuredController(*user.Identity())
+		// when/then
+		test.MergeUsersForbidden(t, svc.Context, svc, ctrl, user.IdentityID().String(), mergePayload(g.CreateUser().IdentityID().String()))
+	})
+
+	s.T().Run("unauthorized", func(t *testing.T) {
+		// given
+		svc, ctrl := s.UnsecuredController()
+		// when/then
+		test.MergeUsersUnauthorized(t, svc.Context, svc, ctrl, admin.IdentityID().String(), mergePayload(uuid.NewV4().String()))
+	})
+}
+
 func (s *UsersControllerTestSuite) checkIfUserDeprovisioned(id uuid.UUID, expected bool) {
 	identityRepository := accountrepo.NewIdentityRepository(s.DB)
 	identity, err := identityRepository.LoadWithUser(context.Background(), id)
@@ -897,9 +1025,10 @@ func (s *UsersControllerTestSuite) TestVerifyEmail() {
 		test.ShowUsersOK(t, nil, nil, s.controller, identity.ID.String(), nil, nil)
 
 		// when
+		newEmail := "TestUpdateUserOK-" + uuid.NewV4().String() + "@email.com"
 		secureService, secureController := s.SecuredController(identity)
 		updateUsersPayload := newUpdateUsersPayload(
-			WithUpdatedEmail("TestUpdateUserOK-"+uuid.NewV4().String()+"@email.com"),
+			WithUpdatedEmail(newEmail),
 			WithUpdatedFullName("TestUpdateUserOK"),
 			WithUpdatedBio("new bio"),
 			WithUpdatedImageURL("http://new.image.io/imageurl"),
@@ -911,18 +1040,33 @@ func (s *UsersControllerTestSuite) TestVerifyEmail() {
 				"rate":         100.00,
 				"count":        3,
 			}))
-		test.UpdateUsersOK(t, secureService.Context, secureService, secureController, updateUsersPayload)
-		// then
-		codes, err := s.Application.VerificationCodes().Query(accountrepo.VerificationCodeWithUser(), accountrepo.VerificationCodeFilterByUserID(user.ID))
+		_, result := test.UpdateUsersOK(t, secureService.Context, secureService, secureController, updateUsersPayload)
+		// then the email address is not changed until both addresses are confirmed
+		assert.Equal(t, user.Email, *result.Data.Attributes.Email)
+		require.NotNil(t, result.Data.Attributes.PendingEmail)
+		assert.Equal(t, newEmail, *result.Data.Attributes.PendingEmail)
+		codes, err := s.Application.VerificationCodes().Query(
+			accountrepo.VerificationCodeFilterByUserID(user.ID),
+			accountrepo.VerificationCodeFilterByKind(accountrepo.VerificationCodeKindEmailChange))
 		require.NoError(t, err)
-		require.Len(t, codes, 1)
-		verificationCode := codes[0].Code
+		require.Len(t, codes, 2)
 
-		rw := test.VerifyEmailUsersTemporaryRedirect(t, secureService.Context, secureService, secureController, verificationCode)
-		redirectLocation := rw.Header().Get("Location")
-		assert.Equal(t, "https://prod-preview.openshift.io/_home?verified=true", redirectLocation)
+		for i, code := range codes {
+			rw := test.VerifyEmailUsersTemporaryRedirect(t, secureService.Context, secureService, secureController, code.Code)
+			redirectLocation := rw.Header().Get("Location")
+			assert.Equal(t, "https://prod-preview.openshift.io/_home?verified=true", redirectLocation)
+			_, result = test.ShowUsersOK(t, nil, nil, s.controller, identity.ID.String(), nil, nil)
+			if i == 0 {
+				assert.Equal(t, user.Email, *result.Data.Attributes.Email)
+			} else {
+				assert.Equal(t, newEmail, *result.Data.Attributes.Email)
+				assert.True(t, *result.Data.Attributes.EmailVerified)
+			}
+		}
 
-		codes, err = s.Application.VerificationCodes().Query(accountrepo.VerificationCodeWithUser(), accountrepo.VerificationCodeFilterByUserID(user.ID))
+		codes, err = s.Application.VerificationCodes().Query(
+			accountrepo.VerificationCodeFilterByUserID(user.ID),
+			accountrepo.VerificationCodeFilterByKind(accountrepo.VerificationCodeKindEmailChange))
 		require.NoError(t, err)
 		require.Len(t, codes, 0)
 	})
@@ -938,6 +1082,40 @@ func (s *UsersControllerTestSuite) TestVerifyEmail() {
 	})
 }
 
+func (s *UsersControllerTestSuite) TestRevertEmail() {
+
+	s.T().Run("ok", func(t *testing.T) {
+		// given
+		user, identity := s.createRandomUserIdentity(t, "TestRevertEmailOK")
+		secureService, secureController := s.SecuredController(identity)
+		updateUsersPayload := newUpdateUsersPayload(WithUpdatedEmail("TestRevertEmailOK-" + uuid.NewV4().String() + "@email.com"))
+		test.UpdateUsersOK(t, secureService.Context, secureService, secureController, updateUsersPayload)
+		codes, err := s.Application.VerificationCodes().Query(
+			accountrepo.VerificationCodeFilterByUserID(user.ID),
+			accountrepo.VerificationCodeFilterByKind(accountrepo.VerificationCodeKindEmailRevert))
+		require.NoError(t, err)
+		require.Len(t, codes, 1)
+		// when
+		rw := test.RevertEmailUsersTemporaryRedirect(t, secureService.Context, secureService, secureController, codes[0].Code)
+		// then
+		assert.Equal(t, "https://prod-preview.openshift.io/_home?reverted=true", rw.Header().Get("Location"))
+		loadedUser, err := s.Application.Users().Load(secureService.Context, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user.Email, loadedUser.Email)
+		assert.Empty(t, loadedUser.PendingEmail)
+	})
+
+	s.T().Run("fail", func(t *testing.T) {
+		// given
+		_, identity := s.createRandomUserIdentity(t, "TestRevertEmailFail")
+		secureService, secureController := s.SecuredController(identity)
+		// when
+		rw := test.RevertEmailUsersTemporaryRedirect(t, secureService.Context, secureService, secureController, "ABCD")
+		// then
+		testsupport.EqualURLs(t, "https://prod-preview.openshift.io/_home?reverted=false&error=code+with+id+%27ABCD%27+not+found", rw.Header().Get("Location"))
+	})
+}
+
 func (s *UsersControllerTestSuite) TestShowUserOK() {
 	// given user
 	user, identity := s.createRandomUserIdentity(s.T(), "TestShowUserOK")
@@ -1031,10 +1209,10 @@ func (s *UsersControllerTestSuite) TestListUsersOK() {
 	// given user2
 	user2, identity2 := s.createRandomUserIdentity(s.T(), "TestListUsersOK2")
 	// when
-	res, result := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, &identity1.Username, nil, nil)
+	res, result := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, nil, &identity1.Username, nil, nil)
 	// then
 	assertUser(s.T(), findUser(identity1.ID, result.Data), user1, identity1)
-	res, result = test.ListUsersOK(s.T(), nil, nil, s.controller, nil, &identity2.Username, nil, nil)
+	res, result = test.ListUsersOK(s.T(), nil, nil, s.controller, nil, nil, &identity2.Username, nil, nil)
 	assertUser(s.T(), findUser(identity2.ID, result.Data), user2, identity2)
 	assertMultiUsersResponseHeaders(s.T(), res, user2)
 }
@@ -1050,7 +1228,7 @@ func (s *UsersControllerTestSuite) TestListUsersWithMissingKeycloakIdentityOK()
 	// given user2
 	user2, identity2 := s.createRandomUserIdentity(s.T(), "TestListUsersOK2")
 	// when
-	res, result := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, &identity2.Username, nil, nil)
+	res, result := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, nil, &identity2.Username, nil, nil)
 	// then
 	assertUser(s.T(), findUser(identity2.ID, result.Data), user2, identity2)
 	assertMultiUsersResponseHeaders(s.T(), res, user2)
@@ -1063,10 +1241,10 @@ func (s *UsersControllerTestSuite) TestListUsersOKUsingExpiredIfModifiedSinceHea
 	user2, identity2 := s.createRandomUserIdentity(s.T(), "TestListUsersOKUsingExpiredIfModifiedSinceHeader2")
 	// when
 	ifModifiedSinceHeader := app.ToHTTPTime(user2.UpdatedAt.Add(-1 * time.Hour))
-	res, result := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, &identity1.Username, &ifModifiedSinceHeader, nil)
+	res, result := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, nil, &identity1.Username, &ifModifiedSinceHeader, nil)
 	// then
 	assertUser(s.T(), findUser(identity1.ID, result.Data), user1, identity1)
-	res, result = test.ListUsersOK(s.T(), nil, nil, s.controller, nil, &identity2.Username, &ifModifiedSinceHeader, nil)
+	res, result = test.ListUsersOK(s.T(), nil, nil, s.controller, nil, nil, &identity2.Username, &ifModifiedSinceHeader, nil)
 	assertUser(s.T(), findUser(identity2.ID, result.Data), user2, identity2)
 	assertMultiUsersResponseHeaders(s.T(), res, user2)
 }
@@ -1078,10 +1256,10 @@ func (s *UsersControllerTestSuite) TestListUsersOKUsingExpiredIfNoneMatchHeader(
 	user2, identity2 := s.createRandomUserIdentity(s.T(), "TestListUsersOKUsingExpiredIfNoneMatchHeader2")
 	// when
 	ifNoneMatch := "foo"
-	res, result := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, &identity1.Username, nil, &ifNoneMatch)
+	res, result := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, nil, &identity1.Username, nil, &ifNoneMatch)
 	// then
 	assertUser(s.T(), findUser(identity1.ID, result.Data), user1, identity1)
-	res, result = test.ListUsersOK(s.T(), nil, nil, s.controller, nil, &identity2.Username, nil, &ifNoneMatch)
+	res, result = test.ListUsersOK(s.T(), nil, nil, s.controller, nil, nil, &identity2.Username, nil, &ifNoneMatch)
 	assertUser(s.T(), findUser(identity2.ID, result.Data), user2, identity2)
 	assertMultiUsersResponseHeaders(s.T(), res, user2)
 }
@@ -1089,11 +1267,11 @@ func (s *UsersControllerTestSuite) TestListUsersOKUsingExpiredIfNoneMatchHeader(
 func (s *UsersControllerTestSuite) TestListUsersNotModifiedUsingIfModifiedSinceHeader() {
 	// given user
 	s.createRandomUserIdentity(s.T(), "TestListUsersNotModifiedUsingIfModifiedSinceHeader2")
-	res, _ := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, nil, nil, nil)
+	res, _ := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, nil, nil, nil, nil)
 	lastModified, err := getHeader(res, app.LastModified)
 	require.NoError(s.T(), err)
 	// when
-	res = test.ListUsersNotModified(s.T(), nil, nil, s.controller, nil, nil, lastModified, nil)
+	res = test.ListUsersNotModified(s.T(), nil, nil, s.controller, nil, nil, nil, lastModified, nil)
 	// then
 	assertResponseHeaders(s.T(), res)
 }
@@ -1104,7 +1282,7 @@ func (s *UsersControllerTestSuite) TestListUsersByUsernameOK() {
 	s.createRandomUserIdentity(s.T(), "TestListUsersOK2") // other unused users, will not appear in list result
 	s.createRandomUserIdentity(s.T(), "TestListUsersOK3")
 	// when
-	_, result := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, &identity1.Username, nil, nil)
+	_, result := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, nil, &identity1.Username, nil, nil)
 	// then
 	for i, data := range result.Data {
 		s.T().Log(fmt.Sprintf("Result #%d: %s %v", i, *data.ID, *data.Attributes.Username))
@@ -1113,6 +1291,127 @@ func (s *UsersControllerTestSuite) TestListUsersByUsernameOK() {
 	assertUser(s.T(), findUser(identity1.ID, result.Data), user1, identity1)
 }
 
+func (s *UsersControllerTestSuite) TestListUsersByPreviousUsernameOK() {
+	// given a user whose username changed
+	_, identity := s.createRandomUserIdentity(s.T(), "TestListUsersOK1")
+	previousUsername := identity.Username
+	newUsername := identity.Username + "-renamed"
+	secureService, secureController := s.SecuredController(identity)
+	test.UpdateUsersOK(s.T(), secureService.Context, secureService, secureController, newUpdateUsersPayload(WithUpdatedUsername(newUsername)))
+	// when
+	_, result := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, nil, &previousUsername, nil, nil)
+	// then the previous username resolves to the current identity
+	require.Len(s.T(), result.Data, 1)
+	assert.Equal(s.T(), identity.ID.String(), *result.Data[0].ID)
+	assert.Equal(s.T(), newUsername, *result.Data[0].Attributes.Username)
+}
+
+func (s *UsersControllerTestSuite) TestProfileAttributes() {
+	// given an administrator and the definitions of a public, a private and a service attribute
+	g := s.NewTestGraph(s.T())
+	admin := g.CreateUser()
+	g.CreateResource(g.LoadResourceType(authorization.ResourceTypeSystem)).AddRole(admin, g.RoleByNameAndResourceType(authorization.SystemUserAdminRole, authorization.ResourceTypeSystem))
+	definitions := map[string]*accountrepo.ProfileAttributeDefinition{}
+	for _, visibility := range []string{account.ProfileAttributeVisibilityPublic, account.ProfileAttributeVisibilityPrivate, account.ProfileAttributeVisibilityService} {
+		definition := &accountrepo.ProfileAttributeDefinition{
+			Name:           visibility + "_" + uuid.NewV4().String()[:8],
+			Type:           accountrepo.ProfileAttributeTypeString,
+			Visibility:     visibility,
+			EditableByUser: visibility != account.ProfileAttributeVisibilityService,
+		}
+		require.NoError(s.T(), s.Application.ProfileAttributeService().CreateDefinition(s.Ctx, admin.IdentityID(), definition))
+		definitions[visibility] = definition
+	}
+	public := definitions[account.ProfileAttributeVisibilityPublic].Name
+	private := definitions[account.ProfileAttributeVisibilityPrivate].Name
+	serviceOnly := definitions[account.ProfileAttributeVisibilityService].Name
+	_, identity := s.createRandomUserIdentity(s.T(), "TestProfileAttributes")
+	publicValue := "public-" + uuid.NewV4().String()
+
+	s.T().Run("update by the user", func(t *testing.T) {
+		// when
+		secureService, secureController := s.SecuredController(identity)
+		_, result := test.UpdateUsersOK(t, secureService.Context, secureService, secureController, newUpdateUsersPayload(
+			WithUpdatedProfileAttributes(map[string]interface{}{public: publicValue, private: "private value"})))
+		// then
+		assert.Equal(t, map[string]interface{}{public: publicValue, private: "private value"}, result.Data.Attributes.ProfileAttributes)
+	})
+
+	s.T().Run("update of a non editable attribute by the user", func(t *testing.T) {
+		secureService, secureController := s.SecuredController(identity)
+		test.UpdateUsersForbidden(t, secureService.Context, secureService, secureController, newUpdateUsersPayload(
+			WithUpdatedProfileAttributes(map[string]interface{}{serviceOnly: "service value"})))
+	})
+
+	s.T().Run("update along with an invalid attribute of the profile", func(t *testing.T) {
+		// when
+		secureService, secureController := s.SecuredController(identity)
+		test.UpdateUsersBadRequest(t, secureService.Context, secureService, secureController, newUpdateUsersPayload(
+			WithUpdatedProfileAttributes(map[string]interface{}{public: "not saved"}),
+			WithUpdatedEmail("invalid-email")))
+		// then the profile attributes are not updated
+		_, result := test.ShowUsersOK(t, nil, nil, s.controller, identity.ID.String(), nil, nil)
+		assert.Equal(t, map[string]interface{}{public: publicValue}, result.Data.Attributes.ProfileAttributes)
+	})
+
+	s.T().Run("update along with an invalid profile attribute", func(t *testing.T) {
+		// when
+		secureService, secureController := s.SecuredController(identity)
+		test.UpdateUsersForbidden(t, secureService.Context, secureService, secureController, newUpdateUsersPayload(
+			WithUpdatedProfileAttributes(map[string]interface{}{serviceOnly: "service value"}),
+			WithUpdatedBio("not saved")))
+		// then the rest of the profile is not updated
+		_, result := test.ShowUsersOK(t, nil, nil, s.controller, identity.ID.String(), nil, nil)
+		assert.NotEqual(t, "not saved", *result.Data.Attributes.Bio)
+	})
+
+	s.T().Run("update by an administrator", func(t *testing.T) {
+		// when
+		secureService, secureController := s.SecuredController(*admin.Identity())
+		_, result := test.UpdateProfileAttributesUsersOK(t, secureService.Context, secureService, secureController, identity.ID.String(),
+			&app.UpdateProfileAttributesUsersPayload{ProfileAttributes: map[string]interface{}{serviceOnly: "service value"}})
+		// then
+		assert.Equal(t, map[string]interface{}{public: publicValue, private: "private value", serviceOnly: "service value"}, result.Data.Attributes.ProfileAttributes)
+	})
+
+	s.T().Run("update by another user", func(t *testing.T) {
+		secureService, secureController := s.SecuredController(*g.CreateUser().Identity())
+		test.UpdateProfileAttributesUsersForbidden(t, secureService.Context, secureService, secureController, identity.ID.String(),
+			&app.UpdateProfileAttributesUsersPayload{ProfileAttributes: map[string]interface{}{public: "other value"}})
+	})
+
+	s.T().Run("show", func(t *testing.T) {
+		// only the public attributes are returned without a token
+		_, result := test.ShowUsersOK(t, nil, nil, s.controller, identity.ID.String(), nil, nil)
+		assert.Equal(t, map[string]interface{}{public: publicValue}, result.Data.Attributes.ProfileAttributes)
+		// all the attributes are returned to the service accounts
+		secureService, secureController := s.SecuredServiceAccountController(testsupport.TestNotificationIdentity)
+		_, result = test.ShowUsersOK(t, secureService.Context, secureService, secureController, identity.ID.String(), nil, nil)
+		assert.Equal(t, map[string]interface{}{public: publicValue, private: "private value", serviceOnly: "service value"}, result.Data.Attributes.ProfileAttributes)
+	})
+
+	s.T().Run("list by public attribute", func(t *testing.T) {
+		// when
+		filter := public + ":" + publicValue
+		_, result := test.ListUsersOK(t, nil, nil, s.controller, nil, &filter, nil, nil, nil)
+		// then
+		require.Len(t, result.Data, 1)
+		assert.Equal(t, identity.ID.String(), *result.Data[0].ID)
+		assert.Equal(t, map[string]interface{}{public: publicValue}, result.Data[0].Attributes.ProfileAttributes)
+	})
+
+	s.T().Run("list by username and public attribute", func(t *testing.T) {
+		filter := public + ":other value"
+		_, result := test.ListUsersOK(t, nil, nil, s.controller, nil, &filter, &identity.Username, nil, nil)
+		require.Len(t, result.Data, 0)
+	})
+
+	s.T().Run("list by private attribute", func(t *testing.T) {
+		filter := private + ":private value"
+		test.ListUsersBadRequest(t, nil, nil, s.controller, nil, &filter, nil, nil, nil)
+	})
+}
+
 func (s *UsersControllerTestSuite) TestListUsersByUsernameOKEmptyResult() {
 	// given user1
 	s.createRandomUserIdentity(s.T(), "TestListUsersOK1")
@@ -1120,7 +1419,7 @@ func (s *UsersControllerTestSuite) TestListUsersByUsernameOKEmptyResult() {
 	s.createRandomUserIdentity(s.T(), "TestListUsersOK2")
 	// when
 	username := "foobar"
-	_, result := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, &username, nil, nil)
+	_, result := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, nil, &username, nil, nil)
 	// then
 	require.Len(s.T(), result.Data, 0)
 }
@@ -1128,11 +1427,11 @@ func (s *UsersControllerTestSuite) TestListUsersByUsernameOKEmptyResult() {
 func (s *UsersControllerTestSuite) TestListUsersByUsernameNotModifiedUsingIfNoneMatchHeader() {
 	// given user1
 	_, identity := s.createRandomUserIdentity(s.T(), "TestListUsersOK1")
-	res, _ := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, &identity.Username, nil, nil)
+	res, _ := test.ListUsersOK(s.T(), nil, nil, s.controller, nil, nil, &identity.Username, nil, nil)
 	etag, err := getHeader(res, app.ETag)
 	require.NoError(s.T(), err)
 	// when
-	res = test.ListUsersNotModified(s.T(), nil, nil, s.controller, nil, &identity.Username, nil, etag)
+	res = test.ListUsersNotModified(s.T(), nil, nil, s.controller, nil, nil, &identity.Username, nil, etag)
 	// then
 	assertResponseHeaders(s.T(), res)
 }
@@ -1143,7 +1442,7 @@ func (s *UsersControllerTestSuite) TestListUsersByEmailOK() {
 	// given user2
 	s.createRandomUserIdentity(s.T(), "TestListUsersOK2")
 	// when
-	_, result := test.ListUsersOK(s.T(), nil, nil, s.controller, &user1.Email, nil, nil, nil)
+	_, result := test.ListUsersOK(s.T(), nil, nil, s.controller, &user1.Email, nil, nil, nil, nil)
 	// then
 	for i, data := range result.Data {
 		s.T().Log(fmt.Sprintf("Result #%d: %s %v", i, *data.ID, *data.Attributes.Username))
@@ -1161,7 +1460,7 @@ func (s *UsersControllerTestSuite) TestListUsersByEmailOKEmptyResult() {
 	s.createRandomUserIdentity(s.T(), "TestListUsersOK2")
 	// when
 	email := "foo@bar.com"
-	_, result := test.ListUsersOK(s.T(), nil, nil, s.controller, &email, nil, nil, nil)
+	_, result := test.ListUsersOK(s.T(), nil, nil, s.controller, &email, nil, nil, nil, nil)
 	// then
 	require.Len(s.T(), result.Data, 0)
 }
@@ -1171,11 +1470,11 @@ func (s *UsersControllerTestSuite) TestListUsersByEmailNotModifiedUsingIfNoneMat
 	user1, _ := s.createRandomUserIdentity(s.T(), "TestListUsersOK1")
 	// given user2
 	s.createRandomUserIdentity(s.T(), "TestListUsersOK2")
-	res, _ := test.ListUsersOK(s.T(), nil, nil, s.controller, &user1.Email, nil, nil, nil)
+	res, _ := test.ListUsersOK(s.T(), nil, nil, s.controller, &user1.Email, nil, nil, nil, nil)
 	etag, err := getHeader(res, app.ETag)
 	require.NoError(s.T(), err)
 	// when
-	res = test.ListUsersNotModified(s.T(), nil, nil, s.controller, &user1.Email, nil, nil, etag)
+	res = test.ListUsersNotModified(s.T(), nil, nil, s.controller, &user1.Email, nil, nil, nil, etag)
 	// then
 	assertResponseHeaders(s.T(), res)
 }
@@ -1316,6 +1615,12 @@ func WithUpdatedUsername(username string) UpdateUserOption {
 	}
 }
 
+func WithUpdatedProfileAttributes(profileAttributes map[string]interface{}) UpdateUserOption {
+	return func(attrs *app.UpdateIdentityDataAttributes) {
+		attrs.ProfileAttributes = profileAttributes
+	}
+}
+
 func WithUpdatedBio(bio string) UpdateUserOption {
 	return func(attrs *app.UpdateIdentityDataAttributes) {
 		attrs.Bio = &bio
@@ -1545,6 +1850,21 @@ func (s *UsersControllerTestSuite) TestCreateUserAsServiceAccountForExistingUser
 
 }
 
+func (s *UsersControllerTestSuite) TestCreateUserAsServiceAccountWithQuarantinedUsernameFails() {
+	// given a username released by another user
+	_, identity := s.createRandomUserIdentity(s.T(), "TestCreateUser")
+	secureService, secureController := s.SecuredController(identity)
+	test.UpdateUsersOK(s.T(), secureService.Context, secureService, secureController, newUpdateUsersPayload(WithUpdatedUsername(identity.Username+"-renamed")))
+	*s.witService = *testsupport.NewWITMock(s.T(), uuid.NewV4().String(), "test-space")
+	secureService, secureController = s.SecuredServiceAccountController(testsupport.TestOnlineRegistrationAppIdentity)
+	email := uuid.NewV4().String() + "@email.com"
+	cluster := "some cluster"
+	createUserPayload := newCreateUsersPayload(&email, nil, nil, nil, nil, nil, &identity.Username, nil, uuid.NewV4().String(), &cluster, nil, nil, nil)
+	// when/then
+	test.CreateUsersBadRequest(s.T(), secureService.Context, secureService, secureController, createUserPayload)
+	require.Equal(s.T(), uint64(0), s.witService.CreateUserCounter)
+}
+
 func (s *UsersControllerTestSuite) TestCreateUserAsServiceAccountWithRequiredFieldsOnlyOK() {
 	s.checkCreateUserAsServiceAccountOK(fmt.Sprintf("testuser%s@email.com", uuid.NewV4().String()))
 }
@@ -1737,10 +2057,21 @@ func (s *DummyEmailVerificationService) SendVerificationCode(ctx context.Context
 	return nil, errors.NewInternalErrorFromString(ctx, "failed to send out email")
 }
 
+func (s *DummyEmailVerificationService) SendEmailChangeCodes(ctx context.Context, req *goa.RequestData, identity accountrepo.Identity) error {
+	if s.success {
+		return nil
+	}
+	return errors.NewInternalErrorFromString(ctx, "failed to send out email")
+}
+
 func (s *DummyEmailVerificationService) VerifyCode(ctx context.Context, code string) (*accountrepo.VerificationCode, error) {
 	return nil, nil
 }
 
+func (s *DummyEmailVerificationService) RevertEmail(ctx context.Context, code string) (*accountrepo.VerificationCode, error) {
+	return nil, nil
+}
+
 type dummyTenantService struct {
 	identityID uuid.UUID
 	error
@@ -12,11 +12,11 @@ var _ = a.API("auth", func() {
 	a.Host("openshift.io")
 	a.Scheme("http")
 	a.BasePath("/api")
-	a.Consumes("application/json")
+	a.Consumes("application/json", "application/scim+json")
 	a.Consumes("application/x-www-form-urlencoded", func() {
 		a.Package("github.com/goadesign/goa/encoding/form")
 	})
-	a.Produces("application/json")
+	a.Produces("application/json", "application/scim+json")
 	a.Produces("application/x-www-form-urlencoded", func() {
 		a.Package("github.com/goadesign/goa/encoding/form")
 	})
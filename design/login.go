@@ -66,6 +66,16 @@ var _ = a.Resource("authorize", func() {
 			a.Param("scope", d.String, "")
 			a.Param("state", d.String, "")
 			a.Param("api_client", d.String, "The name of the api client which is requesting a token")
+			a.Param("code_challenge", d.String, func() {
+				a.MinLength(43)
+				a.MaxLength(128)
+				a.Description("PKCE code challenge derived from the code verifier, as defined by RFC 7636")
+			})
+			a.Param("code_challenge_method", d.String, func() {
+				a.Enum("plain", "S256")
+				a.Description("Method used to derive the PKCE code challenge from the code verifier. Defaults to \"plain\" if not present in the request")
+			})
+			a.Param("nonce", d.String, "OpenID Connect nonce, used to associate a client session with an ID token and to mitigate replay attacks. The value is returned in the ID token")
 			a.Required("state", "response_type", "redirect_uri", "client_id")
 		})
 		a.Description("Authorize service client")
@@ -90,6 +100,69 @@ var _ = a.Resource("authorize", func() {
 		a.Response(d.InternalServerError, JSONAPIErrors)
 		a.Response(d.BadRequest, JSONAPIErrors)
 	})
+
+	a.Action("device", func() {
+		a.Routing(
+			a.POST("device"),
+		)
+		a.Payload(deviceAuthorizationRequest)
+		a.Description("Device authorization request, as defined by RFC 8628. Issues a device code and a user code for input-constrained devices")
+		a.Response(d.OK, func() {
+			a.Media(DeviceAuthorization)
+		})
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.BadRequest, JSONAPIErrors)
+	})
+
+	a.Action("verify", func() {
+		a.Routing(
+			a.GET("device/verify"),
+		)
+		a.Headers(func() {
+			a.Header("Referer", d.String)
+		})
+		a.Params(func() {
+			a.Param("user_code", d.String, "The user code displayed on the device")
+			a.Param("redirect", d.String, "URL to be redirected to after successful device verification. If not set then will redirect to the referrer instead.")
+			a.Required("user_code")
+		})
+		a.Description("Device verification. Redirects the user to the authentication provider in order to approve the device identified by the user code")
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.TemporaryRedirect)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.BadRequest, JSONAPIErrors)
+	})
+})
+
+var deviceAuthorizationRequest = a.Type("DeviceAuthorizationRequest", func() {
+	a.Attribute("client_id", d.String, "Public OAuth client ID")
+	a.Attribute("scope", d.String, "The scope of the access request")
+	a.Required("client_id")
+})
+
+// DeviceAuthorization represents a device authorization response, as defined by RFC 8628
+var DeviceAuthorization = a.MediaType("application/vnd.deviceauthorization+json", func() {
+	a.TypeName("DeviceAuthorization")
+	a.Description("Device authorization response")
+	a.Attributes(func() {
+		a.Attribute("device_code", d.String, "The device verification code")
+		a.Attribute("user_code", d.String, "The end-user verification code")
+		a.Attribute("verification_uri", d.String, "The end-user verification URI on the authorization server")
+		a.Attribute("verification_uri_complete", d.String, "The verification URI that includes the user code")
+		a.Attribute("expires_in", d.Integer, "The lifetime in seconds of the device code and user code")
+		a.Attribute("interval", d.Integer, "The minimum amount of time in seconds that the client should wait between polling requests to the token endpoint")
+		a.Required("device_code", "user_code", "verification_uri", "expires_in")
+	})
+	a.View("default", func() {
+		a.Attribute("device_code")
+		a.Attribute("user_code")
+		a.Attribute("verification_uri")
+		a.Attribute("verification_uri_complete")
+		a.Attribute("expires_in")
+		a.Attribute("interval")
+		a.Required("device_code", "user_code", "verification_uri", "expires_in")
+	})
 })
 
 var _ = a.Resource("logout", func() {
@@ -0,0 +1,167 @@
+package design
+
+import (
+	d "github.com/goadesign/goa/design"
+	a "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = a.Resource("oauth_client", func() {
+
+	a.BasePath("/clients")
+
+	a.Action("create", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST(""),
+		)
+		a.Description("Create a new OAuth client. The client secret is only returned in the response of this request")
+		a.Payload(OAuthClientMetadata)
+		a.Response(d.Created, OAuthClientMedia)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("list", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET(""),
+		)
+		a.Description("List the registered OAuth clients")
+		a.Response(d.OK, OAuthClientList)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("show", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/:clientID"),
+		)
+		a.Params(func() {
+			a.Param("clientID", d.String, "The client ID of the OAuth client")
+		})
+		a.Description("Show a registered OAuth client")
+		a.Response(d.OK, OAuthClientMedia)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("update", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.PATCH("/:clientID"),
+		)
+		a.Params(func() {
+			a.Param("clientID", d.String, "The client ID of the OAuth client")
+		})
+		a.Description("Update the name, redirect URIs, redirect URI matching mode or grant types of a registered OAuth client")
+		a.Payload(OAuthClientUpdate)
+		a.Response(d.OK, OAuthClientMedia)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("delete", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.DELETE("/:clientID"),
+		)
+		a.Params(func() {
+			a.Param("clientID", d.String, "The client ID of the OAuth client")
+		})
+		a.Description("Delete a registered OAuth client")
+		a.Response(d.NoContent)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("register", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("/register"),
+		)
+		a.Description("Register a new OAuth client, as defined by RFC 7591. The client secret is only returned in the response of this request. The user must have the manage_oauth_clients scope for the system resources")
+		a.Payload(OAuthClientMetadata)
+		a.Response(d.Created, OAuthClientMedia)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+})
+
+// OAuthClientMetadata represents the metadata of a new OAuth client, as defined by RFC 7591
+var OAuthClientMetadata = a.Type("OAuthClientMetadata", func() {
+	a.Description("The metadata of a new OAuth client")
+	a.Attribute("client_name", d.String, "Human-readable name of the client. The client ID is used if left blank")
+	a.Attribute("redirect_uris", a.ArrayOf(d.String), "The redirect URIs which can be used in the authorization requests of the client")
+	a.Attribute("redirect_uri_match", d.String, "How the redirect URIs of the authorization requests are matched against the registered redirect URIs: they must either be equal to one of them, or start with one of them. Defaults to exact, which is the only mode allowed for the dynamically registered clients", func() {
+		a.Enum("exact", "prefix")
+	})
+	a.Attribute("grant_types", a.ArrayOf(d.String), "The grant types which can be used by the client. Defaults to authorization_code")
+	a.Attribute("token_endpoint_auth_method", d.String, "The authentication method of the client in the token requests. Defaults to client_secret_post", func() {
+		a.Enum("none", "client_secret_post")
+	})
+})
+
+// OAuthClientUpdate represents the updated metadata of an OAuth client
+var OAuthClientUpdate = a.Type("OAuthClientUpdate", func() {
+	a.Description("The updated metadata of an OAuth client. The attributes which are left blank are not updated")
+	a.Attribute("client_name", d.String, "Human-readable name of the client")
+	a.Attribute("redirect_uris", a.ArrayOf(d.String), "The redirect URIs which can be used in the authorization requests of the client")
+	a.Attribute("redirect_uri_match", d.String, "How the redirect URIs of the authorization requests are matched against the registered redirect URIs: they must either be equal to one of them, or start with one of them", func() {
+		a.Enum("exact", "prefix")
+	})
+	a.Attribute("grant_types", a.ArrayOf(d.String), "The grant types which can be used by the client")
+})
+
+// OAuthClientMedia represents an OAuth client, as defined by RFC 7591
+var OAuthClientMedia = a.MediaType("application/vnd.oauth_client+json", func() {
+	a.TypeName("OAuthClient")
+	a.Description("An OAuth client")
+	a.Attributes(func() {
+		a.Attribute("client_id", d.String, "The client ID of the client")
+		a.Attribute("client_secret", d.String, "The client secret, only returned when the client is created")
+		a.Attribute("client_secret_expires_at", d.Integer, "The expiration time of the client secret, 0 as the secret doesn't expire")
+		a.Attribute("client_id_issued_at", d.Integer, "The time at which the client ID was issued, as the number of seconds since the Unix epoch")
+		a.Attribute("client_name", d.String, "Human-readable name of the client")
+		a.Attribute("redirect_uris", a.ArrayOf(d.String), "The redirect URIs which can be used in the authorization requests of the client")
+		a.Attribute("redirect_uri_match", d.String, "How the redirect URIs of the authorization requests are matched against the registered redirect URIs")
+		a.Attribute("grant_types", a.ArrayOf(d.String), "The grant types which can be used by the client")
+		a.Attribute("token_endpoint_auth_method", d.String, "The authentication method of the client in the token requests")
+		a.Required("client_id", "client_name", "redirect_uris", "redirect_uri_match", "grant_types", "token_endpoint_auth_method")
+	})
+	a.View("default", func() {
+		a.Attribute("client_id")
+		a.Attribute("client_secret")
+		a.Attribute("client_secret_expires_at")
+		a.Attribute("client_id_issued_at")
+		a.Attribute("client_name")
+		a.Attribute("redirect_uris")
+		a.Attribute("redirect_uri_match")
+		a.Attribute("grant_types")
+		a.Attribute("token_endpoint_auth_method")
+	})
+})
+
+// OAuthClientList represents the list of the registered OAuth clients
+var OAuthClientList = a.MediaType("application/vnd.oauth_client_list+json", func() {
+	a.Description("The list of the registered OAuth clients")
+	a.Attributes(func() {
+		a.Attribute("data", a.ArrayOf(OAuthClientMedia), "The OAuth clients")
+		a.Required("data")
+	})
+	a.View("default", func() {
+		a.Attribute("data")
+	})
+})
@@ -25,6 +25,11 @@ var openIDConfiguration = a.MediaType("application/vnd.openIDConfiguration+json"
 		a.Attribute("scopes_supported", a.ArrayOf(d.String), "RECOMMENDED. JSON array containing a list of the OAuth 2.0 scope values that this server supports. The server MUST support the `openid` scope value.")
 		a.Attribute("claims_supported", a.ArrayOf(d.String), "RECOMMENDED. JSON array containing a list of the Claim Names of the Claims that the OpenID Provider MAY be able to supply values for. Note that for privacy or other reasons, this might not be an exhaustive list.")
 		a.Attribute("token_endpoint_auth_methods_supported", a.ArrayOf(d.String), "OPTIONAL. JSON array containing a list of Client Authentication methods supported by this Token Endpoint. The options are client_secret_post, client_secret_basic, client_secret_jwt, and private_key_jwt etc.")
+		a.Attribute("revocation_endpoint", d.String, "OPTIONAL. URL of the authorization server's OAuth 2.0 revocation endpoint, as defined by RFC 7009")
+		a.Attribute("introspection_endpoint", d.String, "OPTIONAL. URL of the authorization server's OAuth 2.0 introspection endpoint, as defined by RFC 7662")
+		a.Attribute("code_challenge_methods_supported", a.ArrayOf(d.String), "OPTIONAL. JSON array containing a list of PKCE code challenge methods supported by this authorization server, as defined by RFC 7636")
+		a.Attribute("device_authorization_endpoint", d.String, "OPTIONAL. URL of the authorization server's device authorization endpoint, as defined by RFC 8628")
+		a.Attribute("registration_endpoint", d.String, "OPTIONAL. URL of the authorization server's OAuth 2.0 dynamic client registration endpoint, as defined by RFC 7591")
 	})
 	a.View("default", func() {
 		a.Attribute("issuer", d.String, "")
@@ -40,6 +45,11 @@ var openIDConfiguration = a.MediaType("application/vnd.openIDConfiguration+json"
 		a.Attribute("scopes_supported", a.ArrayOf(d.String), "")
 		a.Attribute("claims_supported", a.ArrayOf(d.String), "")
 		a.Attribute("token_endpoint_auth_methods_supported", a.ArrayOf(d.String), "")
+		a.Attribute("revocation_endpoint", d.String, "")
+		a.Attribute("introspection_endpoint", d.String, "")
+		a.Attribute("code_challenge_methods_supported", a.ArrayOf(d.String), "")
+		a.Attribute("device_authorization_endpoint", d.String, "")
+		a.Attribute("registration_endpoint", d.String, "")
 	})
 })
 
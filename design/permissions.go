@@ -0,0 +1,152 @@
+package design
+
+import (
+	d "github.com/goadesign/goa/design"
+	a "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = a.Resource("permissions", func() {
+
+	a.BasePath("/permissions")
+
+	a.Action("check", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("/check"),
+		)
+		a.Description("Checks in one request whether an identity has the given scopes on the given resources. The identity defaults to the current user, only the service accounts can check the scopes of another identity.")
+		a.Payload(permissionCheckRequest)
+		a.Response(d.OK, permissionCheckResult)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("explain", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/explain"),
+		)
+		a.Params(func() {
+			a.Param("identityId", d.String, "The ID of the identity")
+			a.Param("resourceId", d.String, "The ID of the resource")
+			a.Param("scopeName", d.String, "The name of the scope")
+			a.Required("identityId", "resourceId", "scopeName")
+		})
+		a.Description("Explains how the decision of a scope check for an identity on a resource is made: the teams and organizations of the identity, the ancestors of the resource, which assigned roles and role mappings grant or fail to grant the scope, and which denials withdraw it. Requires the manage user scope on the system resource.")
+		a.Response(d.OK, scopeExplanationMedia)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+})
+
+// permissionCheckRequest represents a batch of scope checks for an identity
+var permissionCheckRequest = a.Type("PermissionCheckRequest", func() {
+	a.Description("A batch of scope checks for an identity")
+	a.Attribute("identityID", d.String, "The ID of the identity to check the scopes for. Defaults to the current user, can only be set by the service accounts")
+	a.Attribute("checks", a.ArrayOf(permissionCheck), "The scopes to check", func() {
+		a.MinLength(1)
+		a.MaxLength(500)
+	})
+	a.Required("checks")
+})
+
+// permissionCheck represents a scope to check on a resource
+var permissionCheck = a.Type("PermissionCheck", func() {
+	a.Attribute("resourceID", d.String, "The ID of the resource")
+	a.Attribute("scopeName", d.String, "The name of the scope to check")
+	a.Required("resourceID", "scopeName")
+})
+
+// permissionCheckResult represents the decisions of a batch of scope checks, in the order of the checks
+var permissionCheckResult = a.MediaType("application/vnd.permission_check_result+json", func() {
+	a.UseTrait("jsonapi-media-type")
+	a.TypeName("PermissionCheckResult")
+	a.Description("The decisions of a batch of scope checks, in the order of the checks")
+	a.Attributes(func() {
+		a.Attribute("data", a.ArrayOf(permissionCheckDecision))
+		a.Required("data")
+	})
+	a.View("default", func() {
+		a.Attribute("data")
+		a.Required("data")
+	})
+})
+
+// permissionCheckDecision represents the decision of a scope check on a resource
+var permissionCheckDecision = a.Type("PermissionCheckDecision", func() {
+	a.Attribute("resourceID", d.String, "The ID of the resource")
+	a.Attribute("scopeName", d.String, "The name of the scope that was checked")
+	a.Attribute("hasScope", d.Boolean, "'true' if the identity has the given scope on the resource, 'false' otherwise")
+	a.Required("resourceID", "scopeName", "hasScope")
+})
+
+// scopeExplanationMedia represents the derivation of the decision of a scope check for an identity on a resource
+var scopeExplanationMedia = a.MediaType("application/vnd.scope_explanation+json", func() {
+	a.UseTrait("jsonapi-media-type")
+	a.TypeName("ScopeExplanation")
+	a.Description("The derivation of the decision of a scope check for an identity on a resource")
+	a.Attributes(func() {
+		a.Attribute("data", scopeExplanationData)
+		a.Required("data")
+	})
+	a.View("default", func() {
+		a.Attribute("data")
+		a.Required("data")
+	})
+})
+
+var scopeExplanationData = a.Type("ScopeExplanationData", func() {
+	a.Attribute("identityID", d.String, "The ID of the identity")
+	a.Attribute("resourceID", d.String, "The ID of the resource")
+	a.Attribute("resourceType", d.String, "The type of the resource")
+	a.Attribute("scopeName", d.String, "The name of the scope")
+	a.Attribute("granted", d.Boolean, "'true' if the identity has the scope on the resource, 'false' otherwise")
+	a.Attribute("memberships", a.ArrayOf(identityMembershipData), "The teams and organizations the identity belongs to, whatever the depth of the memberships")
+	a.Attribute("resourceHierarchy", a.ArrayOf(d.String), "The ID of the resource followed by the IDs of its ancestors")
+	a.Attribute("steps", a.ArrayOf(scopeDerivationStepData), "The roles assigned to the identity or its teams and organizations for the resource or its ancestors, and whether they grant the scope")
+	a.Attribute("denials", a.ArrayOf(scopeDenialData), "The denials of the scope to the identity or its teams and organizations for the resource or its ancestors, which take precedence over the roles granting the scope")
+	a.Required("identityID", "resourceID", "resourceType", "scopeName", "granted", "memberships", "resourceHierarchy", "steps", "denials")
+})
+
+var identityMembershipData = a.Type("IdentityMembershipData", func() {
+	a.Attribute("identityID", d.String, "The ID of the team or organization")
+	a.Attribute("memberOf", a.ArrayOf(d.String), "The chain of teams and organizations from the one the identity is a direct member of, ending with this one")
+	a.Required("identityID", "memberOf")
+})
+
+var scopeDerivationStepData = a.Type("ScopeDerivationStepData", func() {
+	a.Attribute("assigneeID", d.String, "The ID of the identity to which the role is assigned, either the identity itself or a team or organization it belongs to")
+	a.Attribute("memberOf", a.ArrayOf(d.String), "The chain of teams and organizations from the one the identity is a direct member of, ending with the assignee")
+	a.Attribute("resourceID", d.String, "The ID of the resource for which the role is assigned")
+	a.Attribute("inherited", d.Boolean, "'true' if the role is assigned for an ancestor of the resource")
+	a.Attribute("roleName", d.String, "The name of the assigned role")
+	a.Attribute("roleMappings", a.ArrayOf(roleMappingStepData), "The chain of role mappings through which the assigned role was mapped to the effective role")
+	a.Attribute("effectiveRoleName", d.String, "The name of the role of the type of the resource which was obtained")
+	a.Attribute("scopes", a.ArrayOf(d.String), "The scopes of the effective role")
+	a.Attribute("grantsScope", d.Boolean, "'true' if the step grants the scope")
+	a.Attribute("reason", d.String, "Why the step doesn't grant the scope")
+	a.Required("assigneeID", "memberOf", "resourceID", "inherited", "roleName", "roleMappings", "scopes", "grantsScope")
+})
+
+var scopeDenialData = a.Type("ScopeDenialData", func() {
+	a.Attribute("denialID", d.String, "The ID of the denial")
+	a.Attribute("assigneeID", d.String, "The ID of the identity to which the scope is denied, either the identity itself or a team or organization it belongs to")
+	a.Attribute("memberOf", a.ArrayOf(d.String), "The chain of teams and organizations from the one the identity is a direct member of, ending with the assignee")
+	a.Attribute("resourceID", d.String, "The ID of the resource for which the scope is denied")
+	a.Attribute("inherited", d.Boolean, "'true' if the scope is denied for an ancestor of the resource")
+	a.Required("denialID", "assigneeID", "memberOf", "resourceID", "inherited")
+})
+
+var roleMappingStepData = a.Type("RoleMappingStepData", func() {
+	a.Attribute("roleMappingID", d.String, "The ID of the role mapping")
+	a.Attribute("resourceID", d.String, "The ID of the resource for which the role mapping is defined")
+	a.Attribute("defaultRoleMappingID", d.String, "The ID of the default role mapping from which the role mapping was created, if any")
+	a.Attribute("fromRoleName", d.String, "The name of the role which is mapped")
+	a.Attribute("toRoleName", d.String, "The name of the role it is mapped to")
+	a.Required("roleMappingID", "resourceID", "fromRoleName", "toRoleName")
+})
@@ -0,0 +1,133 @@
+package design
+
+import (
+	d "github.com/goadesign/goa/design"
+	a "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = a.Resource("profile_attribute", func() {
+
+	a.BasePath("/profileattributes")
+
+	a.Action("list", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET(""),
+		)
+		a.Description("List the definitions of the custom profile attributes of the users")
+		a.Response(d.OK, ProfileAttributeDefinitionList)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("create", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST(""),
+		)
+		a.Description("Define a new custom profile attribute. Requires the manage user scope on the system resource.")
+		a.Payload(ProfileAttributeDefinitionCreate)
+		a.Response(d.Created, ProfileAttributeDefinitionMedia)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.Conflict, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("update", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.PATCH("/:name"),
+		)
+		a.Params(func() {
+			a.Param("name", d.String, "The name of the profile attribute")
+		})
+		a.Description("Update the description, pattern, visibility or editable flag of a custom profile attribute. Requires the manage user scope on the system resource.")
+		a.Payload(ProfileAttributeDefinitionUpdate)
+		a.Response(d.OK, ProfileAttributeDefinitionMedia)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("delete", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.DELETE("/:name"),
+		)
+		a.Params(func() {
+			a.Param("name", d.String, "The name of the profile attribute")
+		})
+		a.Description("Delete a custom profile attribute, along with its values in the profile of the users. Requires the manage user scope on the system resource.")
+		a.Response(d.NoContent)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+})
+
+// ProfileAttributeDefinitionCreate represents the definition of a new custom profile attribute
+var ProfileAttributeDefinitionCreate = a.Type("ProfileAttributeDefinitionCreate", func() {
+	a.Description("The definition of a new custom profile attribute")
+	a.Attribute("name", d.String, "The name of the attribute, used as its key in the profile of the users")
+	a.Attribute("description", d.String, "Human-readable description of the attribute")
+	a.Attribute("type", d.String, "The type of the values of the attribute", func() {
+		a.Enum("string", "number", "boolean", "url")
+	})
+	a.Attribute("pattern", d.String, "The regular expression which the values of the string and url attributes must match")
+	a.Attribute("visibility", d.String, "Who the values are returned to: everyone, the user and the service accounts, or only the service accounts. Defaults to private", func() {
+		a.Enum("public", "private", "service")
+	})
+	a.Attribute("editable_by_user", d.Boolean, "Whether the users can set the value of the attribute in their own profile. Defaults to false")
+	a.Required("name", "type")
+})
+
+// ProfileAttributeDefinitionUpdate represents the updated definition of a custom profile attribute
+var ProfileAttributeDefinitionUpdate = a.Type("ProfileAttributeDefinitionUpdate", func() {
+	a.Description("The updated definition of a custom profile attribute. The attributes which are left blank are not updated")
+	a.Attribute("description", d.String, "Human-readable description of the attribute")
+	a.Attribute("pattern", d.String, "The regular expression which the values of the string and url attributes must match")
+	a.Attribute("visibility", d.String, "Who the values are returned to: everyone, the user and the service accounts, or only the service accounts", func() {
+		a.Enum("public", "private", "service")
+	})
+	a.Attribute("editable_by_user", d.Boolean, "Whether the users can set the value of the attribute in their own profile")
+})
+
+// ProfileAttributeDefinitionMedia represents the definition of a custom profile attribute
+var ProfileAttributeDefinitionMedia = a.MediaType("application/vnd.profile_attribute_definition+json", func() {
+	a.TypeName("ProfileAttributeDefinition")
+	a.Description("The definition of a custom profile attribute")
+	a.Attributes(func() {
+		a.Attribute("name", d.String, "The name of the attribute, used as its key in the profile of the users")
+		a.Attribute("description", d.String, "Human-readable description of the attribute")
+		a.Attribute("type", d.String, "The type of the values of the attribute")
+		a.Attribute("pattern", d.String, "The regular expression which the values of the string and url attributes must match")
+		a.Attribute("visibility", d.String, "Who the values are returned to")
+		a.Attribute("editable_by_user", d.Boolean, "Whether the users can set the value of the attribute in their own profile")
+		a.Required("name", "type", "visibility", "editable_by_user")
+	})
+	a.View("default", func() {
+		a.Attribute("name")
+		a.Attribute("description")
+		a.Attribute("type")
+		a.Attribute("pattern")
+		a.Attribute("visibility")
+		a.Attribute("editable_by_user")
+	})
+})
+
+// ProfileAttributeDefinitionList represents the list of the definitions of the custom profile attributes
+var ProfileAttributeDefinitionList = a.MediaType("application/vnd.profile_attribute_definition_list+json", func() {
+	a.Description("The list of the definitions of the custom profile attributes")
+	a.Attributes(func() {
+		a.Attribute("data", a.ArrayOf(ProfileAttributeDefinitionMedia), "The profile attribute definitions")
+		a.Required("data")
+	})
+	a.View("default", func() {
+		a.Attribute("data")
+	})
+})
@@ -102,6 +102,61 @@ var _ = a.Resource("resource_roles", func() {
 		a.Response(d.InternalServerError, JSONAPIErrors)
 		a.Response(d.NotFound, JSONAPIErrors)
 	})
+	a.Action("listPrincipals", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/:resourceId/scopes/:scopeName/principals"),
+		)
+		a.Params(func() {
+			a.Param("resourceId", d.String, "The identifier of the resource")
+			a.Param("scopeName", d.String, "The name of the scope")
+		})
+		a.Description("List the identities which effectively have the given scope on the requested resource, through their roles, the roles of their teams and organizations, the roles on the parent resources and the role mappings, with an explanation of how each identity obtained the scope")
+		a.Response(d.OK, effectivePrincipalsMedia)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+	})
+	a.Action("listDenials", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/:resourceID/denials"),
+		)
+		a.Description("List the scopes denied to identities for a specific resource")
+		a.Response(d.OK, denyAssignmentsMedia)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+	})
+	a.Action("deny", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.PUT("/:resourceID/denials"),
+		)
+		a.Payload(denyScopeArray)
+		a.Description("Denies scopes to one or more identities, for a specific resource and its descendants. A denial takes precedence over the roles granting the scope, whether they are assigned to the identity or to its teams and organizations, for the resource or its parent resources, directly or through role mappings")
+		a.Response(d.NoContent)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+	})
+	a.Action("revokeDenial", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.DELETE("/:resourceID/denials/:denialID"),
+		)
+		a.Description("Revokes a scope denial for a specific resource")
+		a.Response(d.NoContent)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+	})
 
 })
 
@@ -125,6 +180,8 @@ var identityRolesData = a.Type("identityRolesData", func() {
 	a.Attribute("assignee_type", d.String, "The type of assignee, example: user,group,team")
 	a.Attribute("inherited", d.Boolean)
 	a.Attribute("inherited_from", d.String, "The ID of the resource from this role was inherited")
+	a.Attribute("valid_from", d.DateTime, "When the role starts granting its scopes, if the assignment is time-bound")
+	a.Attribute("valid_until", d.DateTime, "When the role stops granting its scopes and is revoked, if the assignment is time-bound")
 
 	a.Required("role_name", "assignee_id", "assignee_type", "inherited")
 })
@@ -135,10 +192,14 @@ var assignRoleArray = a.MediaType("application/vnd.assign-role-array+json", func
 	a.Description("Role Assignment Array")
 	a.Attributes(func() {
 		a.Attribute("data", a.ArrayOf(assignRoleData))
+		a.Attribute("valid_from", d.DateTime, "When the assigned roles start granting their scopes. Defaults to now")
+		a.Attribute("valid_until", d.DateTime, "When the assigned roles stop granting their scopes and are revoked. Defaults to never")
 		a.Required("data")
 	})
 	a.View("default", func() {
 		a.Attribute("data")
+		a.Attribute("valid_from")
+		a.Attribute("valid_until")
 		a.Required("data")
 	})
 })
@@ -170,3 +231,76 @@ var identityResourceScopeData = a.Type("identityResourceScopeData", func() {
 	a.Attribute("hasScope", d.Boolean, "'true' if the user has the given scope, 'false' otherwise")
 	a.Required("scopeName", "hasScope")
 })
+
+// effectivePrincipalsMedia represents the identities which effectively have a scope on a resource
+var effectivePrincipalsMedia = a.MediaType("application/vnd.effectivePrincipals+json", func() {
+	a.TypeName("EffectivePrincipals")
+	a.Description("Identities which effectively have a scope on a resource")
+	a.Attributes(func() {
+		a.Attribute("data", a.ArrayOf(effectivePrincipalData))
+		a.Required("data")
+	})
+	a.View("default", func() {
+		a.Attribute("data")
+		a.Required("data")
+	})
+})
+
+var effectivePrincipalData = a.Type("effectivePrincipalData", func() {
+	a.Attribute("identity_id", d.String, "The ID of the identity")
+	a.Attribute("name", d.String, "The username of the user, or the name of the team or organization")
+	a.Attribute("grants", a.ArrayOf(scopeGrantData), "How the identity obtained the scope")
+	a.Required("identity_id", "name", "grants")
+})
+
+var scopeGrantData = a.Type("scopeGrantData", func() {
+	a.Attribute("assignee_id", d.String, "The ID of the identity to which the role is assigned, either the identity itself or a team or organization it belongs to")
+	a.Attribute("member_of", a.ArrayOf(d.String), "The IDs of the teams and organizations through which the identity belongs to the assignee, starting with the one it is a direct member of")
+	a.Attribute("resource_id", d.String, "The ID of the resource for which the role is assigned")
+	a.Attribute("inherited", d.Boolean, "'true' if the role is assigned for a parent resource")
+	a.Attribute("role_name", d.String, "The name of the assigned role")
+	a.Attribute("mapped_roles", a.ArrayOf(d.String), "The names of the roles to which the assigned role is mapped, ending with the role which has the scope")
+	a.Required("assignee_id", "member_of", "resource_id", "inherited", "role_name", "mapped_roles")
+})
+
+// denyAssignmentsMedia represents the scopes denied to identities for a resource
+var denyAssignmentsMedia = a.MediaType("application/vnd.denyAssignments+json", func() {
+	a.TypeName("DenyAssignments")
+	a.Description("Scopes denied to identities for a resource")
+	a.Attributes(func() {
+		a.Attribute("data", a.ArrayOf(denyAssignmentData))
+		a.Required("data")
+	})
+	a.View("default", func() {
+		a.Attribute("data")
+		a.Required("data")
+	})
+})
+
+var denyAssignmentData = a.Type("denyAssignmentData", func() {
+	a.Attribute("id", d.String, "The ID of the denial")
+	a.Attribute("scope_name", d.String, "The name of the denied scope")
+	a.Attribute("assignee_id", d.String, "The ID of the identity to which the scope is denied")
+	a.Attribute("assignee_type", d.String, "The type of assignee, example: user,group,team")
+	a.Required("id", "scope_name", "assignee_id", "assignee_type")
+})
+
+var denyScopeArray = a.MediaType("application/vnd.deny-scope-array+json", func() {
+	a.UseTrait("jsonapi-media-type")
+	a.TypeName("DenyScopeArray")
+	a.Description("Scope Denial Array")
+	a.Attributes(func() {
+		a.Attribute("data", a.ArrayOf(denyScopeData))
+		a.Required("data")
+	})
+	a.View("default", func() {
+		a.Attribute("data")
+		a.Required("data")
+	})
+})
+
+var denyScopeData = a.Type("DenyScopeData", func() {
+	a.Attribute("scope", d.String, "name of the scope to deny")
+	a.Attribute("ids", a.ArrayOf(d.String), "identity ids to deny the scope to")
+	a.Required("scope", "ids")
+})
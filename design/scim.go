@@ -0,0 +1,369 @@
+package design
+
+import (
+	d "github.com/goadesign/goa/design"
+	a "github.com/goadesign/goa/design/apidsl"
+)
+
+var _ = a.Resource("scim_users", func() {
+
+	a.BasePath("/scim/v2/Users")
+
+	a.Action("list", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET(""),
+		)
+		a.Params(func() {
+			a.Param("filter", d.String, `Equality filter on the userName or the emails of the users, such as userName eq "john"`)
+			a.Param("startIndex", d.Integer, "The 1-based index of the first user to return. Defaults to 1", func() {
+				a.Minimum(1)
+			})
+			a.Param("count", d.Integer, "The maximum number of users to return. Defaults to 100", func() {
+				a.Minimum(0)
+			})
+		})
+		a.Description("List the users provisioned with SCIM, sorted by userName")
+		a.Response(d.OK, ScimUserList)
+		a.Response(d.BadRequest, ScimError)
+		a.Response(d.Unauthorized, ScimError)
+		a.Response(d.Forbidden, ScimError)
+		a.Response(d.InternalServerError, ScimError)
+	})
+
+	a.Action("show", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/:id"),
+		)
+		a.Params(func() {
+			a.Param("id", d.UUID, "The identity ID of the user")
+		})
+		a.Description("Show a user")
+		a.Response(d.OK, ScimUserMedia)
+		a.Response(d.Unauthorized, ScimError)
+		a.Response(d.Forbidden, ScimError)
+		a.Response(d.NotFound, ScimError)
+		a.Response(d.InternalServerError, ScimError)
+	})
+
+	a.Action("create", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST(""),
+		)
+		a.Description("Provision a user, linked to the default cluster")
+		a.Payload(ScimUserPayload)
+		a.Response(d.Created, ScimUserMedia)
+		a.Response(d.BadRequest, ScimError)
+		a.Response(d.Unauthorized, ScimError)
+		a.Response(d.Forbidden, ScimError)
+		a.Response(d.Conflict, ScimError)
+		a.Response(d.InternalServerError, ScimError)
+	})
+
+	a.Action("replace", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.PUT("/:id"),
+		)
+		a.Params(func() {
+			a.Param("id", d.UUID, "The identity ID of the user")
+		})
+		a.Headers(func() {
+			a.Header("If-Match", d.String, "The ETag of the user, which must not have been modified since")
+		})
+		a.Description("Replace the attributes of a user. The user is deprovisioned when it becomes inactive")
+		a.Payload(ScimUserPayload)
+		a.Response(d.OK, ScimUserMedia)
+		a.Response(d.BadRequest, ScimError)
+		a.Response(d.Unauthorized, ScimError)
+		a.Response(d.Forbidden, ScimError)
+		a.Response(d.NotFound, ScimError)
+		a.Response(d.Conflict, ScimError)
+		a.Response(d.InternalServerError, ScimError)
+	})
+
+	a.Action("patch", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.PATCH("/:id"),
+		)
+		a.Params(func() {
+			a.Param("id", d.UUID, "The identity ID of the user")
+		})
+		a.Headers(func() {
+			a.Header("If-Match", d.String, "The ETag of the user, which must not have been modified since")
+		})
+		a.Description("Modify the userName, displayName, emails or active attributes of a user. The user is deprovisioned when it becomes inactive")
+		a.Payload(ScimPatchOp)
+		a.Response(d.OK, ScimUserMedia)
+		a.Response(d.BadRequest, ScimError)
+		a.Response(d.Unauthorized, ScimError)
+		a.Response(d.Forbidden, ScimError)
+		a.Response(d.NotFound, ScimError)
+		a.Response(d.Conflict, ScimError)
+		a.Response(d.InternalServerError, ScimError)
+	})
+
+	a.Action("delete", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.DELETE("/:id"),
+		)
+		a.Params(func() {
+			a.Param("id", d.UUID, "The identity ID of the user")
+		})
+		a.Headers(func() {
+			a.Header("If-Match", d.String, "The ETag of the user, which must not have been modified since")
+		})
+		a.Description("Deprovision a user. The account is kept as inactive, so that it can be reactivated")
+		a.Response(d.NoContent)
+		a.Response(d.Unauthorized, ScimError)
+		a.Response(d.Forbidden, ScimError)
+		a.Response(d.NotFound, ScimError)
+		a.Response(d.Conflict, ScimError)
+		a.Response(d.InternalServerError, ScimError)
+	})
+})
+
+var _ = a.Resource("scim_groups", func() {
+
+	a.BasePath("/scim/v2/Groups")
+
+	a.Action("list", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET(""),
+		)
+		a.Params(func() {
+			a.Param("filter", d.String, `Equality filter on the displayName of the groups, such as displayName eq "developers"`)
+			a.Param("startIndex", d.Integer, "The 1-based index of the first group to return. Defaults to 1", func() {
+				a.Minimum(1)
+			})
+			a.Param("count", d.Integer, "The maximum number of groups to return. Defaults to 100", func() {
+				a.Minimum(0)
+			})
+		})
+		a.Description("List the teams and organizations, along with their direct members")
+		a.Response(d.OK, ScimGroupList)
+		a.Response(d.BadRequest, ScimError)
+		a.Response(d.Unauthorized, ScimError)
+		a.Response(d.Forbidden, ScimError)
+		a.Response(d.InternalServerError, ScimError)
+	})
+
+	a.Action("show", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/:id"),
+		)
+		a.Params(func() {
+			a.Param("id", d.UUID, "The identity ID of the team or organization")
+		})
+		a.Description("Show a team or organization, along with its direct members")
+		a.Response(d.OK, ScimGroupMedia)
+		a.Response(d.Unauthorized, ScimError)
+		a.Response(d.Forbidden, ScimError)
+		a.Response(d.NotFound, ScimError)
+		a.Response(d.InternalServerError, ScimError)
+	})
+
+	a.Action("patch", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.PATCH("/:id"),
+		)
+		a.Params(func() {
+			a.Param("id", d.UUID, "The identity ID of the team or organization")
+		})
+		a.Headers(func() {
+			a.Header("If-Match", d.String, "The ETag of the group, which must not have been modified since")
+		})
+		a.Description("Add, remove or replace the members of a team or organization")
+		a.Payload(ScimPatchOp)
+		a.Response(d.OK, ScimGroupMedia)
+		a.Response(d.BadRequest, ScimError)
+		a.Response(d.Unauthorized, ScimError)
+		a.Response(d.Forbidden, ScimError)
+		a.Response(d.NotFound, ScimError)
+		a.Response(d.Conflict, ScimError)
+		a.Response(d.InternalServerError, ScimError)
+	})
+})
+
+// ScimName represents the name of a SCIM user
+var ScimName = a.Type("ScimName", func() {
+	a.Description("The name of a user")
+	a.Attribute("formatted", d.String, "The full name of the user")
+	a.Attribute("givenName", d.String, "The given name of the user, only used when the full name is missing")
+	a.Attribute("familyName", d.String, "The family name of the user, only used when the full name is missing")
+})
+
+// ScimEmail represents an email of a SCIM user
+var ScimEmail = a.Type("ScimEmail", func() {
+	a.Description("An email of a user")
+	a.Attribute("value", d.String, "The email address")
+	a.Attribute("type", d.String, "The type of the email, such as work")
+	a.Attribute("primary", d.Boolean, "Whether the email is the primary email of the user")
+	a.Required("value")
+})
+
+// ScimMeta represents the metadata of a SCIM resource
+var ScimMeta = a.Type("ScimMeta", func() {
+	a.Description("The metadata of a resource")
+	a.Attribute("resourceType", d.String, "The type of the resource, User or Group")
+	a.Attribute("created", d.DateTime, "The creation time of the resource")
+	a.Attribute("lastModified", d.DateTime, "The last modification time of the resource")
+	a.Attribute("location", d.String, "The URI of the resource")
+	a.Attribute("version", d.String, "The ETag of the resource")
+	a.Required("resourceType", "location", "version")
+})
+
+// ScimGroupMember represents a member of a SCIM group
+var ScimGroupMember = a.Type("ScimGroupMember", func() {
+	a.Description("A direct member of a group")
+	a.Attribute("value", d.String, "The identity ID of the member")
+	a.Attribute("display", d.String, "The username of the member, or the name of the member team or organization")
+	a.Required("value")
+})
+
+// ScimUserPayload represents a user provisioned with SCIM
+var ScimUserPayload = a.Type("ScimUserPayload", func() {
+	a.Description("The attributes of a user. The display name (or the formatted name) is the full name of the user, and the primary email (or the first one) is the email of the user")
+	a.Attribute("schemas", a.ArrayOf(d.String), "The schemas of the user")
+	a.Attribute("userName", d.String, "The username of the user")
+	a.Attribute("name", ScimName, "The name of the user")
+	a.Attribute("displayName", d.String, "The full name of the user")
+	a.Attribute("emails", a.ArrayOf(ScimEmail), "The emails of the user")
+	a.Attribute("active", d.Boolean, "Whether the user is active, ie not deprovisioned. Defaults to true")
+	a.Required("userName", "emails")
+})
+
+// ScimPatchOp represents a SCIM PATCH request
+var ScimPatchOp = a.Type("ScimPatchOp", func() {
+	a.Description("The operations of a PATCH request")
+	a.Attribute("schemas", a.ArrayOf(d.String), "The schemas of the request")
+	a.Attribute("Operations", a.ArrayOf(ScimPatchOperation), "The operations to apply")
+	a.Required("Operations")
+})
+
+// ScimPatchOperation represents an operation of a SCIM PATCH request
+var ScimPatchOperation = a.Type("ScimPatchOperation", func() {
+	a.Description("An operation of a PATCH request")
+	a.Attribute("op", d.String, "The operation, add, remove or replace")
+	a.Attribute("path", d.String, "The path of the modified attribute. The value holds the modified attributes if it is left blank")
+	a.Attribute("value", d.Any, "The value of the operation")
+	a.Required("op")
+})
+
+// ScimUserMedia represents a SCIM user
+var ScimUserMedia = a.MediaType("application/vnd.scim_user+json", func() {
+	a.ContentType("application/scim+json")
+	a.TypeName("ScimUser")
+	a.Description("A user")
+	a.Attributes(func() {
+		a.Attribute("schemas", a.ArrayOf(d.String), "The schemas of the user")
+		a.Attribute("id", d.String, "The identity ID of the user")
+		a.Attribute("userName", d.String, "The username of the user")
+		a.Attribute("name", ScimName, "The name of the user")
+		a.Attribute("displayName", d.String, "The full name of the user")
+		a.Attribute("emails", a.ArrayOf(ScimEmail), "The email of the user")
+		a.Attribute("active", d.Boolean, "Whether the user is active, ie not deprovisioned")
+		a.Attribute("meta", ScimMeta, "The metadata of the user")
+		a.Required("schemas", "id", "userName", "emails", "active", "meta")
+	})
+	a.View("default", func() {
+		a.Attribute("schemas")
+		a.Attribute("id")
+		a.Attribute("userName")
+		a.Attribute("name")
+		a.Attribute("displayName")
+		a.Attribute("emails")
+		a.Attribute("active")
+		a.Attribute("meta")
+	})
+})
+
+// ScimUserList represents a page of SCIM users
+var ScimUserList = a.MediaType("application/vnd.scim_user_list+json", func() {
+	a.ContentType("application/scim+json")
+	a.Description("A page of users")
+	a.Attributes(func() {
+		a.Attribute("schemas", a.ArrayOf(d.String), "The schemas of the response")
+		a.Attribute("totalResults", d.Integer, "The total number of matching users")
+		a.Attribute("startIndex", d.Integer, "The 1-based index of the first user of the page")
+		a.Attribute("itemsPerPage", d.Integer, "The number of users of the page")
+		a.Attribute("Resources", a.ArrayOf(ScimUserMedia), "The users of the page")
+		a.Required("schemas", "totalResults", "startIndex", "itemsPerPage", "Resources")
+	})
+	a.View("default", func() {
+		a.Attribute("schemas")
+		a.Attribute("totalResults")
+		a.Attribute("startIndex")
+		a.Attribute("itemsPerPage")
+		a.Attribute("Resources")
+	})
+})
+
+// ScimError represents a SCIM error response, as defined by RFC 7644, section 3.12
+var ScimError = a.MediaType("application/vnd.scim_error+json", func() {
+	a.ContentType("application/scim+json")
+	a.Description("An error")
+	a.Attributes(func() {
+		a.Attribute("schemas", a.ArrayOf(d.String), "The schemas of the response")
+		a.Attribute("status", d.String, "The HTTP status code of the error")
+		a.Attribute("scimType", d.String, "The SCIM detail error keyword, such as invalidFilter")
+		a.Attribute("detail", d.String, "The description of the error")
+		a.Required("schemas", "status")
+	})
+	a.View("default", func() {
+		a.Attribute("schemas")
+		a.Attribute("status")
+		a.Attribute("scimType")
+		a.Attribute("detail")
+	})
+})
+
+// ScimGroupMedia represents a SCIM group, which is a team or an organization
+var ScimGroupMedia = a.MediaType("application/vnd.scim_group+json", func() {
+	a.ContentType("application/scim+json")
+	a.TypeName("ScimGroup")
+	a.Description("A team or organization")
+	a.Attributes(func() {
+		a.Attribute("schemas", a.ArrayOf(d.String), "The schemas of the group")
+		a.Attribute("id", d.String, "The identity ID of the team or organization")
+		a.Attribute("displayName", d.String, "The name of the team or organization")
+		a.Attribute("members", a.ArrayOf(ScimGroupMember), "The direct members of the group")
+		a.Attribute("meta", ScimMeta, "The metadata of the group")
+		a.Required("schemas", "id", "displayName", "members", "meta")
+	})
+	a.View("default", func() {
+		a.Attribute("schemas")
+		a.Attribute("id")
+		a.Attribute("displayName")
+		a.Attribute("members")
+		a.Attribute("meta")
+	})
+})
+
+// ScimGroupList represents a page of SCIM groups
+var ScimGroupList = a.MediaType("application/vnd.scim_group_list+json", func() {
+	a.ContentType("application/scim+json")
+	a.Description("A page of teams and organizations")
+	a.Attributes(func() {
+		a.Attribute("schemas", a.ArrayOf(d.String), "The schemas of the response")
+		a.Attribute("totalResults", d.Integer, "The total number of matching groups")
+		a.Attribute("startIndex", d.Integer, "The 1-based index of the first group of the page")
+		a.Attribute("itemsPerPage", d.Integer, "The number of groups of the page")
+		a.Attribute("Resources", a.ArrayOf(ScimGroupMedia), "The groups of the page")
+		a.Required("schemas", "totalResults", "startIndex", "itemsPerPage", "Resources")
+	})
+	a.View("default", func() {
+		a.Attribute("schemas")
+		a.Attribute("totalResults")
+		a.Attribute("startIndex")
+		a.Attribute("itemsPerPage")
+		a.Attribute("Resources")
+	})
+})
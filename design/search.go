@@ -13,11 +13,13 @@ var _ = a.Resource("search", func() {
 		a.Routing(
 			a.GET("users"),
 		)
-		a.Description("Search by fullname")
+		a.Description("Search users by username, fullname or public email. The users are sorted by relevance and the search tolerates typos")
 		a.Params(func() {
 			a.Param("q", d.String)
 			a.Param("page[offset]", d.String, "Paging start position") // #428
 			a.Param("page[limit]", d.Integer, "Paging size")
+			a.Param("company", d.String, "Only return the users of this company (case insensitive)")
+			a.Param("cluster", d.String, "Only return the users of this cluster")
 			a.Required("q")
 		})
 		a.Response(d.OK, func() {
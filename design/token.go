@@ -104,7 +104,7 @@ var _ = a.Resource("token", func() {
 			a.POST(""),
 		)
 		a.Payload(tokenExchange)
-		a.Description("Obtain a security token")
+		a.Description("Obtain a security token. The errors returned while polling with a device code are not JSON API errors but the OAuth error responses defined by RFC 8628, section 3.5")
 		a.Response(d.OK, func() {
 			a.Media(OauthToken)
 		})
@@ -115,6 +115,33 @@ var _ = a.Resource("token", func() {
 		a.Response(d.Forbidden, JSONAPIErrors)
 	})
 
+	a.Action("Revoke", func() {
+		a.Routing(
+			a.POST("revoke"),
+		)
+		a.Payload(tokenRevocation)
+		a.Description("Revoke an access or refresh token, as defined by RFC 7009. Returns 200 OK if the token has been revoked or if the token was invalid")
+		a.Response(d.OK)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
+	a.Action("Introspect", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("introspect"),
+		)
+		a.Payload(tokenIntrospectionRequest)
+		a.Description("Introspect an access or refresh token, as defined by RFC 7662. Only available to service accounts")
+		a.Response(d.OK, func() {
+			a.Media(TokenIntrospection)
+		})
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
 	a.Action("keys", func() {
 		a.Routing(
 			a.GET("keys"),
@@ -219,17 +246,83 @@ var refreshToken = a.Type("RefreshToken", func() {
 
 var tokenExchange = a.Type("TokenExchange", func() {
 	a.Attribute("grant_type", d.String, func() {
-		a.Enum("client_credentials", "authorization_code", "refresh_token")
-		a.Description("Grant type. If set to \"client_credentials\" then this token exchange request is for a Protection API Token (PAT). PAT can be used to authenticate the corresponding Service Account. If the Grant Type is \"authorization_code\" we can use a authorization_code to get access_token")
+		a.Enum("client_credentials", "authorization_code", "refresh_token", "urn:ietf:params:oauth:grant-type:device_code", "urn:ietf:params:oauth:grant-type:token-exchange")
+		a.Description("Grant type. If set to \"client_credentials\" then this token exchange request is for a Protection API Token (PAT). PAT can be used to authenticate the corresponding Service Account. If the Grant Type is \"authorization_code\" we can use a authorization_code to get access_token. If the Grant Type is \"urn:ietf:params:oauth:grant-type:device_code\" we can use a device_code to get access_token. If the Grant Type is \"urn:ietf:params:oauth:grant-type:token-exchange\" a Service Account can exchange the access token of a user for a down-scoped access token bound to a target audience, as defined by RFC 8693")
 	})
 	a.Attribute("client_id", d.String, "Service Account ID. Used to obtain a PAT for this service account.")
 	a.Attribute("client_secret", d.String, "Service Account secret. Used to obtain a PAT for this service account.")
 	a.Attribute("redirect_uri", d.String, "Must be identical to the redirect URI provided while getting the authorization_code")
 	a.Attribute("code", d.String, "this is the authorization_code you received from /api/authorize endpoint")
 	a.Attribute("refresh_token", d.String, "Refresh Token")
+	a.Attribute("code_verifier", d.String, "PKCE code verifier. Required if a code_challenge was provided while getting the authorization_code")
+	a.Attribute("device_code", d.String, "this is the device_code you received from /api/authorize/device endpoint")
+	a.Attribute("subject_token", d.String, "The access token of the user on behalf of whom the token exchange is requested")
+	a.Attribute("subject_token_type", d.String, func() {
+		a.Enum("urn:ietf:params:oauth:token-type:access_token")
+		a.Description("The type of the subject token")
+	})
+	a.Attribute("audience", d.String, "The target service where the exchanged token is intended to be used")
+	a.Attribute("resource_id", d.String, "The ID of the resource for which permissions are included in the exchanged token")
+	a.Attribute("scope", d.String, "Space-separated list of the scopes of the resource which are included in the exchanged token. Defaults to all the scopes of the user for the resource")
 	a.Required("grant_type", "client_id")
 })
 
+var tokenRevocation = a.Type("TokenRevocation", func() {
+	a.Attribute("token", d.String, "The token that the client wants to get revoked")
+	a.Attribute("token_type_hint", d.String, func() {
+		a.Enum("access_token", "refresh_token")
+		a.Description("A hint about the type of the token submitted for revocation")
+	})
+	a.Attribute("client_id", d.String, "Public OAuth client ID or Service Account ID")
+	a.Attribute("client_secret", d.String, "Service Account secret. Required if the client ID is a Service Account ID.")
+	a.Required("token", "client_id")
+})
+
+var tokenIntrospectionRequest = a.Type("TokenIntrospectionRequest", func() {
+	a.Attribute("token", d.String, "The token to introspect")
+	a.Attribute("token_type_hint", d.String, func() {
+		a.Enum("access_token", "refresh_token")
+		a.Description("A hint about the type of the token submitted for introspection")
+	})
+	a.Required("token")
+})
+
+// TokenIntrospection represents the state of a token, as defined by RFC 7662
+var TokenIntrospection = a.MediaType("application/vnd.tokenintrospection+json", func() {
+	a.TypeName("TokenIntrospection")
+	a.Description("Token introspection response")
+	a.Attributes(func() {
+		a.Attribute("active", d.Boolean, "Whether or not the token is currently active")
+		a.Attribute("sub", d.String, "Subject of the token")
+		a.Attribute("exp", d.Integer, "Expiry time of the token, in seconds since the Unix epoch")
+		a.Attribute("iat", d.Integer, "Time the token was issued, in seconds since the Unix epoch")
+		a.Attribute("jti", d.String, "Unique identifier of the token")
+		a.Attribute("scope", d.String, "Space-separated list of scopes associated with the token")
+		a.Attribute("token_type", d.String, "Type of the token")
+		a.Attribute("username", d.String, "Username of the resource owner who authorized the token")
+		a.Attribute("permissions", a.ArrayOf(tokenPermission), "Permissions of the RPT token which are still valid")
+		a.Required("active")
+	})
+	a.View("default", func() {
+		a.Attribute("active")
+		a.Attribute("sub")
+		a.Attribute("exp")
+		a.Attribute("iat")
+		a.Attribute("jti")
+		a.Attribute("scope")
+		a.Attribute("token_type")
+		a.Attribute("username")
+		a.Attribute("permissions")
+	})
+})
+
+var tokenPermission = a.Type("TokenPermission", func() {
+	a.Attribute("resource_set_name", d.String, "Name of the resource")
+	a.Attribute("resource_set_id", d.String, "ID of the resource")
+	a.Attribute("scopes", a.ArrayOf(d.String), "Scopes granted for the resource")
+	a.Attribute("exp", d.Integer, "Expiry time of the permission, in seconds since the Unix epoch")
+})
+
 // AuthToken represents an authentication JWT Token
 var AuthToken = a.MediaType("application/vnd.authtoken+json", func() {
 	a.TypeName("AuthToken")
@@ -275,12 +368,16 @@ var OauthToken = a.MediaType("application/vnd.oauthtoken+json", func() {
 		a.Attribute("expires_in", d.String, "Access token expires in seconds")
 		a.Attribute("refresh_token", d.String, "RefreshToken")
 		a.Attribute("token_type", d.String, "Token type")
+		a.Attribute("id_token", d.String, "OpenID Connect ID token, issued if the openid scope was requested")
+		a.Attribute("issued_token_type", d.String, "Type of the token issued by token exchange")
 	})
 	a.View("default", func() {
 		a.Attribute("access_token")
 		a.Attribute("expires_in")
 		a.Attribute("refresh_token")
 		a.Attribute("token_type")
+		a.Attribute("id_token")
+		a.Attribute("issued_token_type")
 	})
 })
 
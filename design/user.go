@@ -22,6 +22,29 @@ var _ = a.Resource("user", func() {
 		a.Response(d.Unauthorized, JSONAPIErrors)
 	})
 
+	a.Action("delete", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.DELETE(""),
+		)
+		a.Description("Request the deletion of the account of the authenticated user. All the tokens of the user are revoked, and the account is deleted at the end of a cooling-off period during which the deletion can be cancelled.")
+		a.Response(d.OK, showUser)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+	})
+
+	a.Action("cancelDeletion", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.DELETE("/deletion"),
+		)
+		a.Description("Cancel the scheduled deletion of the account of the authenticated user")
+		a.Response(d.OK, showUser)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+	})
+
 	a.Action("listResources", func() {
 		a.Security("jwt")
 		a.Routing(
@@ -41,6 +64,17 @@ var _ = a.Resource("user", func() {
 		a.Response(d.InternalServerError, JSONAPIErrors)
 		a.Response(d.Unauthorized, JSONAPIErrors)
 	})
+
+	a.Action("export", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/export"),
+		)
+		a.Description("Download an archive of all the personal data held about the authenticated user")
+		a.Response(d.OK, userDataExport)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+	})
 })
 
 // showUser represents an identified user object to show
@@ -59,6 +93,108 @@ var showUser = a.MediaType("application/vnd.user+json", func() {
 	})
 })
 
+// userDataExport represents the archive of all the personal data held about a user
+var userDataExport = a.MediaType("application/vnd.user-data-export+json", func() {
+	a.TypeName("UserDataExport")
+	a.Description("Archive of the personal data held about a user")
+	a.Attributes(func() {
+		a.Attribute("exportedAt", d.DateTime, "The date of the export")
+		a.Attribute("user", userDataExportUser, "The user account")
+		a.Attribute("identities", a.ArrayOf(userDataExportIdentity), "The identities of the user")
+		a.Attribute("externalAccounts", a.ArrayOf(userDataExportExternalAccount), "The external accounts linked to the identities of the user. The tokens are not included")
+		a.Attribute("memberships", a.ArrayOf(userDataExportAssociation), "The organizations, teams and groups of which the user is a member")
+		a.Attribute("roles", a.ArrayOf(userDataExportAssociation), "The roles assigned to the user")
+		a.Attribute("invitations", a.ArrayOf(userDataExportInvitation), "The invitations sent to the user")
+		a.Attribute("emailVerifications", a.ArrayOf(userDataExportEmailVerification), "The email verification codes sent to the user. The codes are not included")
+		a.Required("exportedAt", "user", "identities", "externalAccounts", "memberships", "roles", "invitations", "emailVerifications")
+	})
+	a.View("default", func() {
+		a.Attribute("exportedAt")
+		a.Attribute("user")
+		a.Attribute("identities")
+		a.Attribute("externalAccounts")
+		a.Attribute("memberships")
+		a.Attribute("roles")
+		a.Attribute("invitations")
+		a.Attribute("emailVerifications")
+	})
+})
+
+// userDataExportUser represents the user account in an export of the personal data
+var userDataExportUser = a.Type("UserDataExportUser", func() {
+	a.Attribute("id", d.UUID, "The id of the user")
+	a.Attribute("email", d.String, "The email")
+	a.Attribute("emailVerified", d.Boolean, "Whether the email is a verified one")
+	a.Attribute("emailPrivate", d.Boolean, "Whether the email address is private")
+	a.Attribute("fullName", d.String, "The user's full name")
+	a.Attribute("imageURL", d.String, "The avatar image for the user")
+	a.Attribute("bio", d.String, "The bio")
+	a.Attribute("url", d.String, "The url")
+	a.Attribute("company", d.String, "The company")
+	a.Attribute("featureLevel", d.String, "The level of features that the user wants to use")
+	a.Attribute("cluster", d.String, "The OpenShift API URL of the cluster where the user is provisioned to")
+	a.Attribute("deprovisioned", d.Boolean, "Whether the user has been deprovisioned")
+	a.Attribute("contextInformation", a.HashOf(d.String, d.Any), "User context information of any type as a json")
+	a.Attribute("profileAttributes", a.HashOf(d.String, d.Any), "The values of the custom profile attributes of the user")
+	a.Attribute("created-at", d.DateTime, "The date of creation of the user")
+	a.Attribute("updated-at", d.DateTime, "The date of update of the user")
+	a.Required("id", "email", "emailVerified", "emailPrivate", "fullName", "imageURL", "bio", "url", "company", "featureLevel", "cluster", "deprovisioned", "created-at", "updated-at")
+})
+
+// userDataExportIdentity represents an identity of the user in an export of the personal data
+var userDataExportIdentity = a.Type("UserDataExportIdentity", func() {
+	a.Attribute("id", d.UUID, "The id of the identity")
+	a.Attribute("username", d.String, "The username")
+	a.Attribute("providerType", d.String, "The IDP provided this identity")
+	a.Attribute("profileURL", d.String, "The URL of the profile of the identity")
+	a.Attribute("registrationCompleted", d.Boolean, "Whether the registration has been completed")
+	a.Attribute("previousUsernames", a.ArrayOf(d.String), "The usernames previously used by the identity, the most recent first")
+	a.Attribute("created-at", d.DateTime, "The date of creation of the identity")
+	a.Attribute("updated-at", d.DateTime, "The date of update of the identity")
+	a.Required("id", "username", "providerType", "registrationCompleted", "created-at", "updated-at")
+})
+
+// userDataExportExternalAccount represents an external account linked to an identity of the user, without its token
+var userDataExportExternalAccount = a.Type("UserDataExportExternalAccount", func() {
+	a.Attribute("id", d.UUID, "The id of the external token")
+	a.Attribute("identityID", d.UUID, "The id of the linked identity")
+	a.Attribute("providerID", d.UUID, "The id of the external provider")
+	a.Attribute("username", d.String, "The username in the external provider")
+	a.Attribute("scope", d.String, "The scope granted by the external provider")
+	a.Attribute("created-at", d.DateTime, "The date of the link")
+	a.Attribute("updated-at", d.DateTime, "The date of update of the link")
+	a.Required("id", "identityID", "providerID", "username", "scope", "created-at", "updated-at")
+})
+
+// userDataExportAssociation represents a resource with which the user is associated through a membership or a role
+var userDataExportAssociation = a.Type("UserDataExportAssociation", func() {
+	a.Attribute("resourceID", d.String, "The id of the resource")
+	a.Attribute("resourceName", d.String, "The name of the resource")
+	a.Attribute("parentResourceID", d.String, "The id of the parent resource")
+	a.Attribute("identityID", d.UUID, "The id of the organization, team or group identity")
+	a.Attribute("member", d.Boolean, "Whether the user is a member")
+	a.Attribute("roles", a.ArrayOf(d.String), "The names of the roles")
+	a.Required("resourceID", "resourceName", "member", "roles")
+})
+
+// userDataExportInvitation represents an invitation sent to the user, without its accept code
+var userDataExportInvitation = a.Type("UserDataExportInvitation", func() {
+	a.Attribute("id", d.UUID, "The id of the invitation")
+	a.Attribute("inviteTo", d.UUID, "The id of the organization, team or group identity to which the user is invited")
+	a.Attribute("resourceID", d.String, "The id of the resource for which the user is invited to accept roles")
+	a.Attribute("member", d.Boolean, "Whether the user is invited to become a member")
+	a.Attribute("roles", a.ArrayOf(d.String), "The names of the offered roles")
+	a.Attribute("created-at", d.DateTime, "The date of the invitation")
+	a.Required("id", "member", "roles", "created-at")
+})
+
+// userDataExportEmailVerification represents a verification code sent to the user, without the code
+var userDataExportEmailVerification = a.Type("UserDataExportEmailVerification", func() {
+	a.Attribute("id", d.UUID, "The id of the verification code")
+	a.Attribute("created-at", d.DateTime, "The date when the code was sent")
+	a.Required("id", "created-at")
+})
+
 // userArray represents an array of user objects
 // Deprecated. Use userList instead
 var userArray = a.MediaType("application/vnd.user-array+json", func() {
@@ -118,6 +254,9 @@ var userDataAttributes = a.Type("UserDataAttributes", func() {
 	a.Attribute("contextInformation", a.HashOf(d.String, d.Any), "User context information of any type as a json", func() {
 		a.Example(map[string]interface{}{"last_visited_url": "https://a.openshift.io", "space": "3d6dab8d-f204-42e8-ab29-cdb1c93130ad"})
 	})
+	a.Attribute("pendingEmail", d.String, "The new email address of the user, until the change is confirmed from both the current and the new address. Only returned to the authenticated user.")
+	a.Attribute("deletionScheduledAt", d.DateTime, "The date after which the account is deleted, if the user requested its deletion. Only returned to the authenticated user.")
+	a.Attribute("profileAttributes", a.HashOf(d.String, d.Any), "The values of the custom profile attributes of the user. The private attributes are only returned to the authenticated user and the service accounts, the service attributes only to the service accounts.")
 })
 
 // showUserResources a list of resources in which the user has a role
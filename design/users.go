@@ -21,6 +21,19 @@ var _ = a.Resource("users", func() {
 		a.Response(d.InternalServerError, JSONAPIErrors)
 	})
 
+	a.Action("revertEmail", func() {
+		a.Routing(
+			a.GET("/revertemail"),
+		)
+		a.Params(func() {
+			a.Param("code", d.String, "code")
+			a.Required("code")
+		})
+		a.Description("Revert the change of the email address of a user, using the code sent to the previous address")
+		a.Response(d.TemporaryRedirect)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+	})
+
 	a.Action("sendEmailVerificationCode", func() {
 		a.Security("jwt")
 		a.Routing(
@@ -92,6 +105,7 @@ var _ = a.Resource("users", func() {
 			// This is not filtering - mutliple params do not work as "AND".
 			a.Param("filter[username]", d.String, "username to search users")
 			a.Param("filter[email]", d.String, "email to search users")
+			a.Param("filter[profileAttribute]", d.String, "public custom profile attribute to search users, as name:value")
 		})
 		a.UseTrait("conditional")
 		a.Response(d.OK, userArray)
@@ -99,6 +113,66 @@ var _ = a.Resource("users", func() {
 		a.Response(d.BadRequest, JSONAPIErrors)
 		a.Response(d.InternalServerError, JSONAPIErrors)
 	})
+
+	a.Action("export", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/:id/export"),
+		)
+		a.Description("Download an archive of all the personal data held about the user with the given identity ID. Requires the manage user scope on the system resource.")
+		a.Params(func() {
+			a.Param("id", d.String, "Identity ID")
+		})
+		a.Response(d.OK, userDataExport)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+	})
+
+	a.Action("updateProfileAttributes", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.PATCH("/:id/profileattributes"),
+		)
+		a.Description("Set the values of the custom profile attributes of the user with the given identity ID. A null value removes the attribute. Requires the manage user scope on the system resource.")
+		a.Params(func() {
+			a.Param("id", d.String, "Identity ID")
+		})
+		a.Payload(func() {
+			a.Attribute("profileAttributes", a.HashOf(d.String, d.Any), "The values of the custom profile attributes")
+			a.Required("profileAttributes")
+		})
+		a.Response(d.OK, func() {
+			a.Media(showUser)
+		})
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+	})
+
+	a.Action("merge", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("/:id/merge"),
+		)
+		a.Description("Merge the user of the source identity given in the payload into the user with the given identity ID. The identities, external tokens, memberships, roles and invitations of the source user are moved to the target user, and the source user is deleted. Requires the manage user scope on the system resource.")
+		a.Params(func() {
+			a.Param("id", d.String, "Identity ID of the target user")
+		})
+		a.Payload(mergeUsers)
+		a.Response(d.OK, func() {
+			a.Media(showUser)
+		})
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+	})
 })
 
 // createUser represents an identified user object to create
@@ -148,6 +222,34 @@ var createUserDataAttributes = a.Type("CreateIdentityDataAttributes", func() {
 	a.Required("username", "email", "cluster", "rhd_user_id")
 })
 
+// mergeUsers represents the request to merge a user into another user
+var mergeUsers = a.MediaType("application/vnd.mergeusers+json", func() {
+	a.UseTrait("jsonapi-media-type")
+	a.TypeName("MergeUsers")
+	a.Description("Users Merge")
+	a.Attributes(func() {
+		a.Attribute("data", mergeUsersData)
+		a.Required("data")
+	})
+	a.View("default", func() {
+		a.Attribute("data")
+		a.Required("data")
+	})
+})
+
+// mergeUsersData represents the data of the request to merge a user into another user
+var mergeUsersData = a.Type("MergeUsersData", func() {
+	a.Attribute("type", d.String, "type of the merge request")
+	a.Attribute("attributes", mergeUsersDataAttributes, "Attributes of the merge request")
+	a.Required("type", "attributes")
+})
+
+// mergeUsersDataAttributes represents the attributes of the request to merge a user into another user
+var mergeUsersDataAttributes = a.Type("MergeUsersDataAttributes", func() {
+	a.Attribute("sourceIdentityID", d.String, "The ID of an identity of the user to merge, which is deleted by the merge")
+	a.Required("sourceIdentityID")
+})
+
 // updateUser represents an identified user object to update
 var updateUser = a.MediaType("application/vnd.updateuser+json", func() {
 	a.UseTrait("jsonapi-media-type")
@@ -188,4 +290,5 @@ var updateUserDataAttributes = a.Type("UpdateIdentityDataAttributes", func() {
 		a.Example(map[string]interface{}{"last_visited_url": "https://a.openshift.io", "space": "3d6dab8d-f204-42e8-ab29-cdb1c93130ad"})
 	})
 	a.Attribute("deprovisioned", d.Boolean, "Whether the identity has been deprovisioned")
+	a.Attribute("profileAttributes", a.HashOf(d.String, d.Any), "The values of the custom profile attributes which are editable by the user. A null value removes the attribute")
 })
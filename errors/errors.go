@@ -168,6 +168,11 @@ func (err BadParameterError) Expected(expected interface{}) BadParameterError {
 	return err
 }
 
+// Parameter returns the name of the invalid parameter
+func (err BadParameterError) Parameter() string {
+	return err.parameter
+}
+
 // NewBadParameterError returns the custom defined error of type BadParameterError.
 func NewBadParameterError(param string, actual interface{}) BadParameterError {
 	return BadParameterError{parameter: param, value: actual}
@@ -247,3 +252,25 @@ func IsNotFoundError(err error) (bool, error) {
 	}
 	return true, e
 }
+
+// OAuthError is an error response defined by the OAuth 2.0 specifications, such as the errors returned to the
+// devices polling the token endpoint, as defined by RFC 8628, section 3.5. Clients tell these errors apart by their code
+type OAuthError struct {
+	simpleError
+	Code string
+}
+
+// NewOAuthError returns the custom defined error of type OAuthError.
+func NewOAuthError(code string, description string) OAuthError {
+	return OAuthError{simpleError{description}, code}
+}
+
+// IsOAuthError returns true if the cause of the given error can be
+// converted to an OAuthError, which is returned as the second result.
+func IsOAuthError(err error) (bool, error) {
+	e, ok := errs.Cause(err).(OAuthError)
+	if !ok {
+		return false, nil
+	}
+	return true, e
+}
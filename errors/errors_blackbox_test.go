@@ -42,6 +42,7 @@ func TestNewBadParameterError(t *testing.T) {
 	assert.Equal(t, fmt.Sprintf("Bad value for parameter '%s': '%v' (expected: '%v') - ", param, value, expectedValue), err.Error())
 	err = errors.NewBadParameterErrorFromString(param, value, "Something went wrong")
 	assert.Equal(t, fmt.Sprintf("Bad value for parameter '%s': '%v' - Something went wrong", param, value), err.Error())
+	assert.Equal(t, param, err.Parameter())
 }
 
 func TestNewNotFoundError(t *testing.T) {
@@ -77,6 +78,16 @@ func TestNewForbiddenError(t *testing.T) {
 	assert.Equal(t, msg, err.Error())
 }
 
+func TestNewOAuthError(t *testing.T) {
+	t.Parallel()
+	resource.Require(t, resource.UnitTest)
+	msg := "authorization is pending"
+	err := errors.NewOAuthError("authorization_pending", msg)
+
+	assert.Equal(t, msg, err.Error())
+	assert.Equal(t, "authorization_pending", err.Code)
+}
+
 func TestIsXYError(t *testing.T) {
 	resource.Require(t, resource.UnitTest)
 	t.Parallel()
@@ -102,6 +113,9 @@ func TestIsXYError(t *testing.T) {
 		{"IsNotFoundError - is a NotFoundError", errors.NewNotFoundError("entity", "id"), errors.IsNotFoundError, true},
 		{"IsNotFoundError - is a wrapped NotFoundError", errs.Wrap(errs.Wrap(errors.NewNotFoundError("entity", "id"), "msg1"), "msg2"), errors.IsNotFoundError, true},
 		{"IsNotFoundError - is not a NotFoundError", errors.NewInternalError(ctx, errs.New("some message")), errors.IsNotFoundError, false},
+		{"IsOAuthError - is an OAuthError", errors.NewOAuthError("slow_down", "some message"), errors.IsOAuthError, true},
+		{"IsOAuthError - is a wrapped OAuthError", errs.Wrap(errs.Wrap(errors.NewOAuthError("slow_down", "some message"), "msg1"), "msg2"), errors.IsOAuthError, true},
+		{"IsOAuthError - is not an OAuthError", errors.NewBadParameterError("param", "actual"), errors.IsOAuthError, false},
 		{"IsUnauthorizedError - is an UnauthorizedError", errors.NewUnauthorizedError("some message"), errors.IsUnauthorizedError, true},
 		{"IsUnauthorizedError - is a wrapped UnauthorizedError", errs.Wrap(errs.Wrap(errors.NewUnauthorizedError("some message"), "msg1"), "msg2"), errors.IsUnauthorizedError, true},
 		{"IsUnauthorizedError - is not an UnauthorizedError", errors.NewInternalError(ctx, errs.New("some message")), errors.IsUnauthorizedError, false},
@@ -1,3 +1,3 @@
-// This package contains a custom goa middleware that aims to extract, when possible,
-// the token from the http requests.
+// This package contains custom goa middlewares that aim to extract, when possible,
+// the token from the http requests, and to validate it with the keys of the token manager.
 package goamiddleware
@@ -0,0 +1,112 @@
+package goamiddleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
+	"github.com/fabric8-services/fabric8-auth/log"
+	"github.com/fabric8-services/fabric8-auth/rest"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/goadesign/goa"
+	"github.com/goadesign/goa/middleware/security/jwt"
+)
+
+// JWT is a new goa middleware which validates the token of the Authorization header with the public keys of the token
+// manager, and stores it in the context. It replaces the goa JWT middleware which only supports RSA, ECDSA and HMAC
+// keys, so that the tokens signed with any of the keys published by the token manager (including Ed25519 keys and the
+// keys loaded after a key rotation) are accepted.
+// Unlike the TokenContext middleware, an error is returned if the Authorization header is missing.
+func JWT(tokenManager manager.TokenManager, scheme *goa.JWTSecurity) goa.Middleware {
+	return func(nextHandler goa.Handler) goa.Handler {
+		return jwtHandler(tokenManager, scheme, nextHandler)
+	}
+}
+
+func jwtHandler(tokenManager manager.TokenManager, scheme *goa.JWTSecurity, nextHandler goa.Handler) goa.Handler {
+	return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		if scheme.In != goa.LocHeader {
+			log.Error(ctx, nil, fmt.Sprintf("whoops, security scheme with location (in) %q not supported", scheme.In))
+			return fmt.Errorf("whoops, security scheme with location (in) %q not supported", scheme.In)
+		}
+		val := req.Header.Get(scheme.Name)
+		if val == "" {
+			return jwt.ErrJWTError(fmt.Sprintf("missing header %q", scheme.Name))
+		}
+		if !strings.HasPrefix(strings.ToLower(val), "bearer ") {
+			return jwt.ErrJWTError(fmt.Sprintf("invalid or malformed %q header, expected 'Authorization: Bearer JWT-token...'", val))
+		}
+		incomingToken := strings.Split(val, " ")[1]
+
+		token, err := tokenManager.Parse(ctx, incomingToken)
+		if err != nil {
+			return jwt.ErrJWTError("JWT validation failed")
+		}
+
+		err = checkAudience(req, token)
+		if err != nil {
+			return jwt.ErrJWTError(err)
+		}
+
+		scopesInClaim, err := claimScopes(token)
+		if err != nil {
+			return jwt.ErrJWTError(err)
+		}
+		requiredScopes := goa.ContextRequiredScopes(ctx)
+		for _, scope := range requiredScopes {
+			if !scopesInClaim[scope] {
+				return jwt.ErrJWTError("authorization failed: required 'scopes' not present in JWT claim", "required", requiredScopes)
+			}
+		}
+
+		ctx = jwt.WithJWT(ctx, token)
+		return nextHandler(ctx, rw, req)
+	}
+}
+
+// claimScopes returns the scopes of the "scopes" claim of the given token, which is either a space separated list of
+// scopes or an array of scopes
+func claimScopes(token *jwtgo.Token) (map[string]bool, error) {
+	result := map[string]bool{}
+	claims, ok := token.Claims.(jwtgo.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("unsupported claims shape")
+	}
+	switch scopes := claims["scopes"].(type) {
+	case nil:
+	case string:
+		for _, scope := range strings.Split(scopes, " ") {
+			result[scope] = true
+		}
+	case []interface{}:
+		for _, scope := range scopes {
+			if val, ok := scope.(string); ok {
+				result[val] = true
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported 'scopes' format in incoming JWT claim, was type %T", scopes)
+	}
+	return result, nil
+}
+
+// checkAudience returns an error if the given token was issued by token exchange for another audience than the
+// service which received the request. The exchanged tokens are down-scoped tokens, which must not be used in place of
+// the access token of the user.
+func checkAudience(req *http.Request, token *jwtgo.Token) error {
+	claims, ok := token.Claims.(jwtgo.MapClaims)
+	if !ok {
+		return fmt.Errorf("unsupported claims shape")
+	}
+	if claims["typ"] != manager.ExchangedTokenType {
+		return nil
+	}
+	audience := rest.AbsoluteURL(&goa.RequestData{Request: req}, "", nil)
+	if !claims.VerifyAudience(audience, true) {
+		return fmt.Errorf("authorization failed: the exchanged token is not issued for audience '%s'", audience)
+	}
+	return nil
+}
@@ -43,6 +43,11 @@ func handler(tokenManager manager.TokenManager, scheme *goa.JWTSecurity, nextHan
 				tokenManager.AddLoginRequiredHeader(rw)
 				return errUnauthorized("token is invalid")
 			}
+			err = checkAudience(req, token)
+			if err != nil {
+				log.Error(ctx, map[string]interface{}{"error": err}, "exchanged token used outside of its audience in TokenContext middleware")
+				return errUnauthorized("token is invalid")
+			}
 			ctx = jwt.WithJWT(ctx, token)
 		}
 
@@ -0,0 +1,141 @@
+package goamiddleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
+	testsuite "github.com/fabric8-services/fabric8-auth/test/suite"
+	testtoken "github.com/fabric8-services/fabric8-auth/test/token"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/goadesign/goa"
+	"github.com/goadesign/goa/middleware/security/jwt"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestJWT(t *testing.T) {
+	suite.Run(t, &TestJWTSuite{})
+}
+
+type TestJWTSuite struct {
+	testsuite.UnitTestSuite
+}
+
+func (s *TestJWTSuite) TestHandler() {
+	schema := &goa.JWTSecurity{}
+	rw := httptest.NewRecorder()
+	rq := &http.Request{Header: make(map[string][]string)}
+	h := jwtHandler(testtoken.TokenManager, schema, tokenCheckingHandler)
+
+	err := h(context.Background(), rw, rq)
+	require.Error(s.T(), err)
+	assert.Equal(s.T(), "whoops, security scheme with location (in) \"\" not supported", err.Error())
+
+	// Get 401 if no Authorization header
+	schema.In = "header"
+	schema.Name = "Authorization"
+	err = h(context.Background(), rw, rq)
+	require.Error(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "401 jwt_security_error: missing header \"Authorization\"")
+
+	// Get 401 if not bearer
+	rq.Header.Set("Authorization", "something")
+	err = h(context.Background(), rw, rq)
+	require.Error(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "401 jwt_security_error: invalid or malformed \"something\" header")
+
+	// Get 401 if token is invalid
+	rq.Header.Set("Authorization", "Bearer token")
+	err = h(context.Background(), rw, rq)
+	require.Error(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "401 jwt_security_error: JWT validation failed")
+
+	// OK if token is valid
+	t, err := testtoken.TokenManager.GenerateServiceAccountToken(uuid.NewV4().String(), "sa-name")
+	require.NoError(s.T(), err)
+	rq.Header.Set("Authorization", "Bearer "+t)
+	err = h(context.Background(), rw, rq)
+	require.Error(s.T(), err)
+	assert.Equal(s.T(), "next-handler-error", err.Error())
+
+	// OK if the token has the required scopes
+	err = h(goa.WithRequiredScopes(context.Background(), []string{"uma_protection"}), rw, rq)
+	require.Error(s.T(), err)
+	assert.Equal(s.T(), "next-handler-error", err.Error())
+
+	// Get 401 if the token does not have the required scopes
+	err = h(goa.WithRequiredScopes(context.Background(), []string{"uma_protection", "offline_access"}), rw, rq)
+	require.Error(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "401 jwt_security_error: authorization failed: required 'scopes' not present in JWT claim")
+}
+
+func (s *TestJWTSuite) TestHandlerWithExchangedToken() {
+	schema := &goa.JWTSecurity{In: goa.LocHeader, Name: "Authorization"}
+	rw := httptest.NewRecorder()
+	h := jwtHandler(testtoken.TokenManager, schema, tokenCheckingHandler)
+
+	s.T().Run("refused outside of its audience", func(t *testing.T) {
+		// given
+		rq := &http.Request{Host: "auth.openshift.io", Header: make(map[string][]string)}
+		rq.Header.Set("Authorization", "Bearer "+s.exchangedToken(t, "https://backend.example.com"))
+		// when
+		err := h(context.Background(), rw, rq)
+		// then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "401 jwt_security_error: authorization failed: the exchanged token is not issued for audience 'http://auth.openshift.io'")
+	})
+
+	s.T().Run("accepted by its audience", func(t *testing.T) {
+		// given
+		rq := &http.Request{Host: "auth.openshift.io", Header: make(map[string][]string)}
+		rq.Header.Set("Authorization", "Bearer "+s.exchangedToken(t, "http://auth.openshift.io"))
+		// when
+		err := h(context.Background(), rw, rq)
+		// then
+		require.Error(t, err)
+		assert.Equal(t, "next-handler-error", err.Error())
+	})
+}
+
+// exchangedToken returns a signed token issued by token exchange for the given audience
+func (s *TestJWTSuite) exchangedToken(t *testing.T, audience string) string {
+	identity := repository.Identity{
+		ID:       uuid.NewV4(),
+		Username: "exchanged-token-user",
+		User: repository.User{
+			ID:    uuid.NewV4(),
+			Email: "exchanged-token-user@example.com",
+		},
+	}
+	now := time.Now().Unix()
+	tokenClaims := manager.TokenClaims{
+		StandardClaims: jwtgo.StandardClaims{
+			Audience:  audience,
+			IssuedAt:  now,
+			ExpiresAt: now + 60,
+		},
+	}
+	actor := manager.Actor{Subject: uuid.NewV4().String()}
+	token, err := testtoken.TokenManager.GenerateUnsignedExchangedTokenForIdentity(context.Background(), &tokenClaims, identity, actor, []manager.Permissions{})
+	require.NoError(t, err)
+	signed, err := testtoken.TokenManager.SignRPTToken(context.Background(), token)
+	require.NoError(t, err)
+	return signed
+}
+
+// tokenCheckingHandler returns an error if there is no token in the context, a dummy error otherwise
+func tokenCheckingHandler(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+	if jwt.ContextJWT(ctx) == nil {
+		return errors.New("missing token in context")
+	}
+	return errors.New("next-handler-error")
+}
@@ -84,6 +84,9 @@ func init() {
 	// structures to ignore during code generation (mostly because they correspond to model structures which were already taken into account)
 	ignoredStructs = []string{
 		"CommentRelationship",
+		// the SCIM resources handle the If-Match header themselves
+		"ScimUser",
+		"ScimGroup",
 	}
 
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/fabric8-services/fabric8-auth/application/service/factory"
 	"github.com/fabric8-services/fabric8-auth/application/transaction"
 	account "github.com/fabric8-services/fabric8-auth/authentication/account/repository"
+	oauthclient "github.com/fabric8-services/fabric8-auth/authentication/oauthclient/repository"
 	provider "github.com/fabric8-services/fabric8-auth/authentication/provider/repository"
 	invitation "github.com/fabric8-services/fabric8-auth/authorization/invitation/repository"
 	permission "github.com/fabric8-services/fabric8-auth/authorization/permission/repository"
@@ -99,16 +100,41 @@ func (g *GormBase) OauthStates() provider.OauthStateReferenceRepository {
 	return provider.NewOauthStateReferenceRepository(g.db)
 }
 
+// DeviceCodes returns a device code repository
+func (g *GormBase) DeviceCodes() provider.DeviceCodeRepository {
+	return provider.NewDeviceCodeRepository(g.db)
+}
+
+// OAuthClients returns an OAuth client repository
+func (g *GormBase) OAuthClients() oauthclient.OAuthClientRepository {
+	return oauthclient.NewOAuthClientRepository(g.db)
+}
+
 // ExternalTokens returns an ExternalTokens repository
 func (g *GormBase) ExternalTokens() token.ExternalTokenRepository {
 	return token.NewExternalTokenRepository(g.db)
 }
 
+// SigningKeys returns a signing key repository
+func (g *GormBase) SigningKeys() token.SigningKeyRepository {
+	return token.NewSigningKeyRepository(g.db)
+}
+
 // VerificationCodes returns an VerificationCodes repository
 func (g *GormBase) VerificationCodes() account.VerificationCodeRepository {
 	return account.NewVerificationCodeRepository(g.db)
 }
 
+// UsernameHistory returns a username history repository
+func (g *GormBase) UsernameHistory() account.UsernameHistoryRepository {
+	return account.NewUsernameHistoryRepository(g.db)
+}
+
+// ProfileAttributeDefinitions returns a profile attribute definition repository
+func (g *GormBase) ProfileAttributeDefinitions() account.ProfileAttributeDefinitionRepository {
+	return account.NewProfileAttributeDefinitionRepository(g.db)
+}
+
 func (g *GormBase) InvitationRepository() invitation.InvitationRepository {
 	return invitation.NewInvitationRepository(g.db)
 }
@@ -141,6 +167,10 @@ func (g *GormBase) RoleMappingRepository() role.RoleMappingRepository {
 	return role.NewRoleMappingRepository(g.db)
 }
 
+func (g *GormBase) DenyAssignmentRepository() role.DenyAssignmentRepository {
+	return role.NewDenyAssignmentRepository(g.db)
+}
+
 func (g *GormBase) TokenRepository() token.TokenRepository {
 	return token.NewTokenRepository(g.db)
 }
@@ -159,6 +189,10 @@ func (g *GormDB) AuthenticationProviderService() service.AuthenticationProviderS
 	return g.serviceFactory.AuthenticationProviderService()
 }
 
+func (g *GormDB) DeviceAuthorizationService() service.DeviceAuthorizationService {
+	return g.serviceFactory.DeviceAuthorizationService()
+}
+
 func (g *GormDB) InvitationService() service.InvitationService {
 	return g.serviceFactory.InvitationService()
 }
@@ -175,6 +209,10 @@ func (g *GormDB) OSOSubscriptionService() service.OSOSubscriptionService {
 	return g.serviceFactory.OSOSubscriptionService()
 }
 
+func (g *GormDB) OAuthClientService() service.OAuthClientService {
+	return g.serviceFactory.OAuthClientService()
+}
+
 func (g *GormDB) OrganizationService() service.OrganizationService {
 	return g.serviceFactory.OrganizationService()
 }
@@ -187,10 +225,22 @@ func (g *GormDB) PrivilegeCacheService() service.PrivilegeCacheService {
 	return g.serviceFactory.PrivilegeCacheService()
 }
 
+func (g *GormDB) ProfileAttributeService() service.ProfileAttributeService {
+	return g.serviceFactory.ProfileAttributeService()
+}
+
+func (g *GormDB) RetentionService() service.RetentionService {
+	return g.serviceFactory.RetentionService()
+}
+
 func (g *GormDB) RoleManagementService() service.RoleManagementService {
 	return g.serviceFactory.RoleManagementService()
 }
 
+func (g *GormDB) ScimService() service.ScimService {
+	return g.serviceFactory.ScimService()
+}
+
 func (g *GormDB) TeamService() service.TeamService {
 	return g.serviceFactory.TeamService()
 }
@@ -199,6 +249,10 @@ func (g *GormDB) ResourceService() service.ResourceService {
 	return g.serviceFactory.ResourceService()
 }
 
+func (g *GormDB) SigningKeyService() service.SigningKeyService {
+	return g.serviceFactory.SigningKeyService()
+}
+
 func (g *GormDB) SpaceService() service.SpaceService {
 	return g.serviceFactory.SpaceService()
 }
@@ -211,6 +265,10 @@ func (g *GormDB) UserService() service.UserService {
 	return g.serviceFactory.UserService()
 }
 
+func (g *GormDB) UserTransferService() service.UserTransferService {
+	return g.serviceFactory.UserTransferService()
+}
+
 func (g *GormDB) UserProfileService() service.UserProfileService {
 	return g.serviceFactory.UserProfileService()
 }
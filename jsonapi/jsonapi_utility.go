@@ -43,6 +43,10 @@ func ErrorToJSONAPIError(ctx context.Context, err error) (app.JSONAPIError, int)
 		code = ErrorCodeNotFound
 		title = "Not found error"
 		statusCode = http.StatusNotFound
+	case errors.OAuthError:
+		code = cause.(errors.OAuthError).Code
+		title = "OAuth error"
+		statusCode = http.StatusBadRequest
 	case errors.ConversionError:
 		code = ErrorCodeConversionError
 		title = "Conversion error"
@@ -13,7 +13,9 @@ import (
 	factorymanager "github.com/fabric8-services/fabric8-auth/application/factory/manager"
 	"github.com/fabric8-services/fabric8-auth/application/transaction"
 	accountservice "github.com/fabric8-services/fabric8-auth/authentication/account/service"
+	roleservice "github.com/fabric8-services/fabric8-auth/authorization/role/service"
 	"github.com/fabric8-services/fabric8-auth/authorization/token/manager"
+	tokenservice "github.com/fabric8-services/fabric8-auth/authorization/token/service"
 	"github.com/fabric8-services/fabric8-auth/configuration"
 	"github.com/fabric8-services/fabric8-auth/controller"
 	"github.com/fabric8-services/fabric8-auth/goamiddleware"
@@ -27,7 +29,6 @@ import (
 	"github.com/goadesign/goa/logging/logrus"
 	"github.com/goadesign/goa/middleware"
 	"github.com/goadesign/goa/middleware/gzip"
-	"github.com/goadesign/goa/middleware/security/jwt"
 	"github.com/jinzhu/gorm"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -40,12 +41,24 @@ func main() {
 	var serviceAccountConfigFile string
 	var printConfig bool
 	var migrateDB bool
+	var exportUsers string
+	var importUsers string
 	flag.StringVar(&configFile, "config", "", "Path to the config file to read")
 	flag.StringVar(&serviceAccountConfigFile, "serviceAccountConfig", "", "Path to the service account configuration file")
 	flag.BoolVar(&printConfig, "printConfig", false, "Prints the config (including merged environment variables) and exits")
 	flag.BoolVar(&migrateDB, "migrateDatabase", false, "Migrates the database to the newest version and exits.")
+	flag.StringVar(&exportUsers, "exportUsers", "", "Exports the users, their identities, memberships and roles, and the resources to the given JSON Lines file and exits.")
+	flag.StringVar(&importUsers, "importUsers", "", "Imports the users, their identities, memberships and roles, and the resources from the given JSON Lines file and exits.")
 	flag.Parse()
 
+	// The users can't be exported and imported at once, since only one of them would be performed
+	if exportUsers != "" && importUsers != "" {
+		log.Panic(nil, map[string]interface{}{
+			"export_file": exportUsers,
+			"import_file": importUsers,
+		}, "the -exportUsers and -importUsers flags can't be used together")
+	}
+
 	// Override default -config switch with environment variable only if -config switch was
 	// not explicitly given via the command line.
 	configFile = configFileFromFlags("config", "AUTH_CONFIG_FILE_PATH")
@@ -125,6 +138,12 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Export or import the users, then exit
+	if exportUsers != "" || importUsers != "" {
+		transferUsers(gormapplication.NewGormDB(db, config, factorymanager.NewDisabledFactoryWrappers()), exportUsers, importUsers)
+		os.Exit(0)
+	}
+
 	// Create service
 	service := goa.New("auth")
 
@@ -153,7 +172,28 @@ func main() {
 
 	service.Use(manager.InjectTokenManager(tokenManager))
 	service.Use(log.LogRequest(config.IsPostgresDeveloperModeEnabled()))
-	app.UseJWTMiddleware(service, jwt.New(tokenManager.PublicKeys(), nil, app.NewJWTSecurity()))
+	// Middleware that validates the token with the keys of the token manager, so that the rotated signing keys and all
+	// the signing algorithms are taken into account
+	app.UseJWTMiddleware(service, goamiddleware.JWT(tokenManager, app.NewJWTSecurity()))
+
+	// Rotate and load the signing keys stored in the DB, instead of the keys of the configuration
+	if config.IsSigningKeyRotationEnabled() {
+		keyRotator := tokenservice.NewSigningKeyRotator(appDB.SigningKeyService(), tokenManager, config)
+		err = keyRotator.Start(context.Background())
+		if err != nil {
+			log.Panic(nil, map[string]interface{}{
+				"err": err,
+			}, "failed to load the signing keys")
+		}
+		defer keyRotator.Stop()
+	}
+
+	// Purge the deleted accounts and the stale data kept beyond their retention period
+	if config.IsRetentionEnabled() {
+		retentionWorker := accountservice.NewRetentionWorker(appDB.RetentionService(), config)
+		retentionWorker.Start()
+		defer retentionWorker.Stop()
+	}
 
 	var tenantService accountservice.TenantService
 	if config.GetTenantServiceURL() != "" {
@@ -163,6 +203,20 @@ func main() {
 		log.Logger().Warn("Tenant service is not enabled")
 	}
 
+	// Delete the accounts whose deletion was requested by their users, at the end of the cooling-off period
+	if config.IsUserDeletionEnabled() {
+		userDeletionWorker := accountservice.NewUserDeletionWorker(appDB.UserService(), tenantService, tokenManager, config)
+		userDeletionWorker.Start()
+		defer userDeletionWorker.Stop()
+	}
+
+	// Revoke the role assignments whose validity window is over
+	if config.IsRoleExpiryEnabled() {
+		roleExpiryWorker := roleservice.NewRoleExpiryWorker(appDB.RoleManagementService(), config)
+		roleExpiryWorker.Start()
+		defer roleExpiryWorker.Stop()
+	}
+
 	// Try to fetch the initial list of clusters and start Cluster Service cache refresher
 	_, err = appDB.ClusterService().Status(context.Background(), func(c *http.Client) {
 		c.Timeout = 3 * time.Second
@@ -191,9 +245,17 @@ func main() {
 	app.MountRolesController(service, rolesCtrl)
 
 	// Mount "authorize" controller
-	authorizeCtrl := controller.NewAuthorizeController(service, appDB, config)
+	authorizeCtrl := controller.NewAuthorizeController(service, appDB)
 	app.MountAuthorizeController(service, authorizeCtrl)
 
+	// Mount "oauth_client" controller
+	oauthClientCtrl := controller.NewOauthClientController(service, appDB)
+	app.MountOauthClientController(service, oauthClientCtrl)
+
+	// Mount "profile_attribute" controller
+	profileAttributeCtrl := controller.NewProfileAttributeController(service, appDB)
+	app.MountProfileAttributeController(service, profileAttributeCtrl)
+
 	// Mount "logout" controller
 	logoutCtrl := controller.NewLogoutController(service, appDB)
 	app.MountLogoutController(service, logoutCtrl)
@@ -211,7 +273,7 @@ func main() {
 	app.MountSpaceController(service, spaceCtrl)
 
 	// Mount "open-configuration" controller
-	openidConfigurationCtrl := controller.NewOpenidConfigurationController(service)
+	openidConfigurationCtrl := controller.NewOpenidConfigurationController(service, tokenManager, config)
 	app.MountOpenidConfigurationController(service, openidConfigurationCtrl)
 
 	// Mount "user" controller
@@ -223,7 +285,7 @@ func main() {
 	app.MountSearchController(service, searchCtrl)
 
 	// Mount "users" controller
-	emailVerificationService := accountservice.NewEmailVerificationClient(appDB)
+	emailVerificationService := accountservice.NewEmailVerificationClient(appDB, config)
 	usersCtrl := controller.NewUsersController(service, appDB, config)
 	usersCtrl.EmailVerificationService = emailVerificationService
 	app.MountUsersController(service, usersCtrl)
@@ -232,6 +294,12 @@ func main() {
 	namedusersCtrl := controller.NewNamedusersController(service, appDB, config, tenantService)
 	app.MountNamedusersController(service, namedusersCtrl)
 
+	// Mount "scim_users" and "scim_groups" controllers
+	scimUsersCtrl := controller.NewScimUsersController(service, appDB, tenantService)
+	app.MountScimUsersController(service, scimUsersCtrl)
+	scimGroupsCtrl := controller.NewScimGroupsController(service, appDB)
+	app.MountScimGroupsController(service, scimGroupsCtrl)
+
 	//Mount "userinfo" controller
 	userInfoCtrl := controller.NewUserinfoController(service, appDB, tokenManager)
 	app.MountUserinfoController(service, userInfoCtrl)
@@ -248,6 +316,10 @@ func main() {
 	resourcesCtrl := controller.NewResourceController(service, appDB)
 	app.MountResourceController(service, resourcesCtrl)
 
+	// Mount "permissions" controller
+	permissionsCtrl := controller.NewPermissionsController(service, appDB)
+	app.MountPermissionsController(service, permissionsCtrl)
+
 	// Mount "organizations" controller
 	organizationCtrl := controller.NewOrganizationController(service, appDB)
 	app.MountOrganizationController(service, organizationCtrl)
@@ -312,6 +384,49 @@ func configFileFromFlags(flagName string, envVarName string) string {
 	return ""
 }
 
+// transferUsers exports the users to the given file, or imports them from the given file. Only one of the files is
+// given, which is checked when the flags are parsed.
+func transferUsers(appDB *gormapplication.GormDB, exportFile string, importFile string) {
+	ctx := context.Background()
+	if exportFile != "" {
+		f, err := os.Create(exportFile)
+		if err != nil {
+			log.Panic(nil, map[string]interface{}{
+				"file": exportFile,
+				"err":  err,
+			}, "failed to create the export file")
+		}
+		defer f.Close()
+		count, err := appDB.UserTransferService().Export(ctx, f)
+		if err != nil {
+			log.Panic(nil, map[string]interface{}{
+				"file":    exportFile,
+				"records": count,
+				"err":     err,
+			}, "failed to export the users")
+		}
+		log.Logger().Infof("Exported %d records to %s", count, exportFile)
+		return
+	}
+	f, err := os.Open(importFile)
+	if err != nil {
+		log.Panic(nil, map[string]interface{}{
+			"file": importFile,
+			"err":  err,
+		}, "failed to open the import file")
+	}
+	defer f.Close()
+	count, err := appDB.UserTransferService().Import(ctx, f)
+	if err != nil {
+		log.Panic(nil, map[string]interface{}{
+			"file":    importFile,
+			"records": count,
+			"err":     err,
+		}, "failed to import the users")
+	}
+	log.Logger().Infof("Imported %d records from %s", count, importFile)
+}
+
 func printUserInfo() {
 	u, err := user.Current()
 	if err != nil {
@@ -236,6 +236,63 @@ func GetMigrations(configuration MigrationConfiguration) Migrations {
 	// Version 42
 	m = append(m, steps{ExecuteSQLFile("042-token-index.sql")})
 
+	// Version 43
+	m = append(m, steps{ExecuteSQLFile("043-add-code-challenge-to-oauth-state-reference.sql")})
+
+	// Version 44
+	m = append(m, steps{ExecuteSQLFile("044-device-codes.sql")})
+
+	// Version 45
+	m = append(m, steps{ExecuteSQLFile("045-add-nonce-to-oauth-state-reference.sql")})
+
+	// Version 46
+	m = append(m, steps{ExecuteSQLFile("046-signing-keys.sql")})
+
+	// Version 47
+	m = append(m, steps{ExecuteSQLFile("047-oauth-clients.sql")})
+
+	// Version 48
+	m = append(m, steps{ExecuteSQLFile("048-oauth-client-redirect-uri-match.sql")})
+
+	// Version 49
+	m = append(m, steps{ExecuteSQLFile("049-token-exchange.sql")})
+
+	// Version 50
+	m = append(m, steps{ExecuteSQLFile("050-user-search-indexes.sql")})
+
+	// Version 51
+	m = append(m, steps{ExecuteSQLFile("051-user-merge.sql")})
+
+	// Version 52
+	m = append(m, steps{ExecuteSQLFile("052-user-deletion.sql")})
+
+	// Version 53
+	m = append(m, steps{ExecuteSQLFile("053-user-email-change.sql")})
+
+	// Version 54
+	m = append(m, steps{ExecuteSQLFile("054-username-history.sql")})
+
+	// Version 55
+	m = append(m, steps{ExecuteSQLFile("055-profile-attributes.sql")})
+
+	// Version 56
+	m = append(m, steps{ExecuteSQLFile("056-deny-assignments.sql")})
+
+	// Version 57
+	m = append(m, steps{ExecuteSQLFile("057-identity-role-validity.sql")})
+
+	// Version 58
+	m = append(m, steps{ExecuteSQLFile("058-device-code-sealing.sql")})
+
+	// Version 59
+	m = append(m, steps{ExecuteSQLFile("059-add-scope-to-oauth-state-reference.sql")})
+
+	// Version 60
+	m = append(m, steps{ExecuteSQLFile("060-device-code-authorization-code.sql")})
+
+	// Version 61
+	m = append(m, steps{ExecuteSQLFile("061-add-auth-time-to-oauth-state-reference.sql")})
+
 	// Version N
 	//
 	// In order to add an upgrade, simply append an array of MigrationFunc to the
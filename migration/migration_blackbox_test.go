@@ -122,6 +122,25 @@ func TestMigrations(t *testing.T) {
 	t.Run("TestMigration38", testMigration38)
 	t.Run("TestMigration39", testMigration39)
 	t.Run("TestMigration41", testMigration41)
+	t.Run("TestMigration43", testMigration43)
+	t.Run("TestMigration44", testMigration44)
+	t.Run("TestMigration45", testMigration45)
+	t.Run("TestMigration46", testMigration46)
+	t.Run("TestMigration47", testMigration47)
+	t.Run("TestMigration48", testMigration48)
+	t.Run("TestMigration49", testMigration49)
+	t.Run("TestMigration50", testMigration50)
+	t.Run("TestMigration51", testMigration51)
+	t.Run("TestMigration52", testMigration52)
+	t.Run("TestMigration53", testMigration53)
+	t.Run("TestMigration54", testMigration54)
+	t.Run("TestMigration55", testMigration55)
+	t.Run("TestMigration56", testMigration56)
+	t.Run("TestMigration57", testMigration57)
+	t.Run("TestMigration58", testMigration58)
+	t.Run("TestMigration59", testMigration59)
+	t.Run("TestMigration60", testMigration60)
+	t.Run("TestMigration61", testMigration61)
 
 	// Perform the migration
 	if err := migration.Migrate(sqlDB, databaseName, conf); err != nil {
@@ -522,6 +541,142 @@ func testMigration41(t *testing.T) {
 	require.Nil(t, runSQLscript(sqlDB, "041-identity-role-index.sql"))
 }
 
+func testMigration43(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(44)], (44))
+	assert.True(t, dialect.HasColumn("oauth_state_references", "code_challenge"))
+	assert.True(t, dialect.HasColumn("oauth_state_references", "code_challenge_method"))
+	assert.True(t, dialect.HasColumn("oauth_state_references", "code_hash"))
+	assert.True(t, dialect.HasIndex("oauth_state_references", "idx_oauth_state_references_code_hash"))
+}
+
+func testMigration44(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(45)], (45))
+	assert.True(t, dialect.HasTable("device_codes"))
+	assert.True(t, dialect.HasColumn("device_codes", "device_code_hash"))
+	assert.True(t, dialect.HasColumn("device_codes", "user_code"))
+	assert.True(t, dialect.HasColumn("device_codes", "expiry_time"))
+	assert.True(t, dialect.HasIndex("device_codes", "idx_device_codes_device_code_hash"))
+	assert.True(t, dialect.HasIndex("device_codes", "idx_device_codes_user_code"))
+}
+
+func testMigration45(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(46)], (46))
+	assert.True(t, dialect.HasColumn("oauth_state_references", "nonce"))
+}
+
+func testMigration46(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(47)], (47))
+	assert.True(t, dialect.HasTable("signing_keys"))
+	assert.True(t, dialect.HasColumn("signing_keys", "kid"))
+	assert.True(t, dialect.HasColumn("signing_keys", "private_key"))
+	assert.True(t, dialect.HasColumn("signing_keys", "state"))
+	assert.True(t, dialect.HasIndex("signing_keys", "idx_signing_keys_kid"))
+	assert.True(t, dialect.HasIndex("signing_keys", "idx_signing_keys_active"))
+}
+
+func testMigration47(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(48)], (48))
+	assert.True(t, dialect.HasTable("oauth_clients"))
+	assert.True(t, dialect.HasColumn("oauth_clients", "client_id"))
+	assert.True(t, dialect.HasColumn("oauth_clients", "redirect_uris"))
+	assert.True(t, dialect.HasColumn("oauth_clients", "grant_types"))
+	assert.True(t, dialect.HasColumn("oauth_clients", "secret_hashes"))
+	assert.True(t, dialect.HasIndex("oauth_clients", "idx_oauth_clients_client_id"))
+	assert.True(t, dialect.HasColumn("oauth_state_references", "client_id"))
+	countRows(t, "SELECT count(1) FROM role_scope rs INNER JOIN resource_type_scope s ON rs.scope_id = s.resource_type_scope_id WHERE s.name = 'manage_oauth_clients' AND rs.role_id = '2c993cbd-83f5-4e8c-858f-ca11bcf718b0'", 1)
+}
+
+func testMigration48(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(49)], (49))
+	assert.True(t, dialect.HasColumn("oauth_clients", "redirect_uri_match"))
+	_, err := sqlDB.Exec("INSERT INTO oauth_clients (client_id, name, redirect_uri_match) VALUES ('migration-test-client', 'test', 'regex')")
+	require.Error(t, err)
+}
+
+func testMigration49(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(50)], (50))
+	assert.True(t, dialect.HasColumn("token", "audience"))
+	assert.True(t, dialect.HasColumn("token", "actor_id"))
+	assert.True(t, dialect.HasIndex("token", "idx_token_actor_id"))
+}
+
+func testMigration50(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(51)], (51))
+	assert.True(t, dialect.HasIndex("users", "ix_users_company"))
+	assert.True(t, dialect.HasIndex("users", "ix_users_cluster"))
+}
+
+func testMigration51(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(52)], (52))
+	assert.True(t, dialect.HasColumn("users", "merged_into"))
+}
+
+func testMigration52(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(53)], (53))
+	assert.True(t, dialect.HasColumn("users", "deletion_scheduled_at"))
+	assert.True(t, dialect.HasIndex("users", "ix_users_deletion_scheduled_at"))
+}
+
+func testMigration53(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(54)], (54))
+	assert.True(t, dialect.HasColumn("users", "pending_email"))
+	assert.True(t, dialect.HasColumn("verification_codes", "kind"))
+	assert.True(t, dialect.HasColumn("verification_codes", "email"))
+}
+
+func testMigration54(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(55)], (55))
+	assert.True(t, dialect.HasTable("username_history"))
+	assert.True(t, dialect.HasIndex("username_history", "idx_username_history_username"))
+	assert.True(t, dialect.HasIndex("username_history", "idx_username_history_identity_id"))
+}
+
+func testMigration55(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(56)], (56))
+	assert.True(t, dialect.HasTable("profile_attribute_definitions"))
+	assert.True(t, dialect.HasIndex("profile_attribute_definitions", "idx_profile_attribute_definitions_name"))
+	assert.True(t, dialect.HasColumn("users", "profile_attributes"))
+	assert.True(t, dialect.HasIndex("users", "idx_users_profile_attributes"))
+}
+
+func testMigration56(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(57)], (57))
+	assert.True(t, dialect.HasTable("deny_assignment"))
+	assert.True(t, dialect.HasIndex("deny_assignment", "uq_deny_assignment_identity_resource_scope"))
+	assert.True(t, dialect.HasIndex("deny_assignment", "idx_deny_assignment_resource_id"))
+}
+
+func testMigration57(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(58)], (58))
+	assert.True(t, dialect.HasColumn("identity_role", "valid_from"))
+	assert.True(t, dialect.HasColumn("identity_role", "valid_until"))
+	assert.True(t, dialect.HasIndex("identity_role", "idx_identity_role_valid_until"))
+}
+
+func testMigration58(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(59)], (59))
+	assert.True(t, dialect.HasColumn("device_codes", "public_key"))
+	assert.True(t, dialect.HasColumn("device_codes", "sealed_code"))
+	assert.False(t, dialect.HasColumn("device_codes", "code"))
+}
+
+func testMigration59(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(60)], (60))
+	assert.True(t, dialect.HasColumn("oauth_state_references", "scope"))
+}
+
+func testMigration60(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(61)], (61))
+	assert.True(t, dialect.HasColumn("device_codes", "code"))
+	assert.False(t, dialect.HasColumn("device_codes", "public_key"))
+	assert.False(t, dialect.HasColumn("device_codes", "sealed_code"))
+}
+
+func testMigration61(t *testing.T) {
+	migrateToVersion(sqlDB, migrations[:(62)], (62))
+	assert.True(t, dialect.HasColumn("oauth_state_references", "auth_time"))
+}
+
 // runSQLscript loads the given filename from the packaged SQL test files and
 // executes it on the given database. Golang text/template module is used
 // to handle all the optional arguments passed to the sql test files
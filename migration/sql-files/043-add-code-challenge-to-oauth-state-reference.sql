@@ -0,0 +1,5 @@
+-- Alter Oauth state reference table to add the PKCE code challenge used in the authorization_code workflow
+ALTER TABLE oauth_state_references ADD COLUMN code_challenge TEXT;
+ALTER TABLE oauth_state_references ADD COLUMN code_challenge_method TEXT;
+ALTER TABLE oauth_state_references ADD COLUMN code_hash TEXT;
+CREATE INDEX idx_oauth_state_references_code_hash ON oauth_state_references (code_hash);
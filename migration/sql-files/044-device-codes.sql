@@ -0,0 +1,19 @@
+-- Create device code table for pending device authorization requests, as defined by RFC 8628
+CREATE TABLE device_codes (
+  device_code_id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+  device_code_hash varchar NOT NULL,
+  user_code varchar NOT NULL,
+  client_id varchar NOT NULL,
+  scope varchar,
+  state varchar,
+  code varchar,
+  expiry_time timestamp with time zone NOT NULL,
+  last_polled_at timestamp with time zone,
+  created_at timestamp with time zone,
+  updated_at timestamp with time zone,
+  deleted_at timestamp with time zone
+);
+
+CREATE UNIQUE INDEX idx_device_codes_device_code_hash ON device_codes (device_code_hash) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX idx_device_codes_user_code ON device_codes (user_code) WHERE deleted_at IS NULL;
+CREATE INDEX idx_device_codes_state ON device_codes (state);
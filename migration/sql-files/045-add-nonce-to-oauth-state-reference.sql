@@ -0,0 +1,2 @@
+-- Alter Oauth state reference table to add the OpenID Connect nonce, which is returned in the ID token
+ALTER TABLE oauth_state_references ADD COLUMN nonce TEXT;
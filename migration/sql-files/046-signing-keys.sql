@@ -0,0 +1,19 @@
+-- Create signing key table for the keys used to sign user and service account tokens, so that the keys can be rotated
+-- without redeploying the service
+CREATE TABLE signing_keys (
+  signing_key_id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+  kid varchar NOT NULL,
+  purpose varchar NOT NULL,
+  private_key text NOT NULL,
+  state varchar NOT NULL,
+  state_changed_at timestamp with time zone NOT NULL,
+  created_at timestamp with time zone,
+  updated_at timestamp with time zone,
+  deleted_at timestamp with time zone
+);
+
+CREATE UNIQUE INDEX idx_signing_keys_kid ON signing_keys (kid) WHERE deleted_at IS NULL;
+-- There is at most one pending and one active key per purpose
+CREATE UNIQUE INDEX idx_signing_keys_pending ON signing_keys (purpose) WHERE state = 'pending' AND deleted_at IS NULL;
+CREATE UNIQUE INDEX idx_signing_keys_active ON signing_keys (purpose) WHERE state = 'active' AND deleted_at IS NULL;
+CREATE INDEX idx_signing_keys_purpose_state ON signing_keys (purpose, state);
@@ -0,0 +1,37 @@
+-- Create OAuth client table for the clients registered by the administrators or dynamically registered as defined
+-- by RFC 7591
+CREATE TABLE oauth_clients (
+  oauth_client_id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+  client_id varchar NOT NULL,
+  name varchar NOT NULL,
+  redirect_uris text[] NOT NULL DEFAULT '{}',
+  grant_types text[] NOT NULL DEFAULT '{}',
+  secret_hashes text[] NOT NULL DEFAULT '{}',
+  dynamically_registered boolean NOT NULL DEFAULT false,
+  created_by uuid REFERENCES identities (id) ON DELETE SET NULL,
+  created_at timestamp with time zone,
+  updated_at timestamp with time zone,
+  deleted_at timestamp with time zone
+);
+
+CREATE UNIQUE INDEX idx_oauth_clients_client_id ON oauth_clients (client_id) WHERE deleted_at IS NULL;
+
+-- Alter Oauth state reference table to add the ID of the client which sent the authorization request, so that the
+-- authorization code can only be exchanged by the same client
+ALTER TABLE oauth_state_references ADD COLUMN client_id TEXT;
+
+-- create a scope named manage_oauth_clients for the system resource type, and add it to the role 'user_admin'
+
+INSERT INTO resource_type_scope
+            (resource_type_scope_id,
+             resource_type_id,
+             NAME)
+VALUES     ('1ab4f3c5-4e5b-4a6e-9d9a-3f0b6d3b2c71',
+            'f5dd9ef5-1bf6-4222-a844-9247ed961a1d',
+            'manage_oauth_clients');
+
+INSERT INTO role_scope
+            (scope_id,
+             role_id)
+VALUES     ('1ab4f3c5-4e5b-4a6e-9d9a-3f0b6d3b2c71',
+            '2c993cbd-83f5-4e8c-858f-ca11bcf718b0');
@@ -0,0 +1,4 @@
+-- Add the matching mode of the redirect URIs of the OAuth clients: the redirect URI of an authorization request must
+-- either be equal to one of the registered redirect URIs ('exact'), or start with one of them ('prefix')
+ALTER TABLE oauth_clients ADD COLUMN redirect_uri_match varchar NOT NULL DEFAULT 'exact';
+ALTER TABLE oauth_clients ADD CONSTRAINT oauth_clients_redirect_uri_match_check CHECK (redirect_uri_match IN ('exact', 'prefix'));
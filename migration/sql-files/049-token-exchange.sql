@@ -0,0 +1,4 @@
+-- Record the audience and the acting party of the tokens issued by token exchange, as defined by RFC 8693
+ALTER TABLE token ADD COLUMN audience text;
+ALTER TABLE token ADD COLUMN actor_id text;
+CREATE INDEX idx_token_actor_id ON token (actor_id) WHERE actor_id IS NOT NULL;
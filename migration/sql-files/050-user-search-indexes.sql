@@ -0,0 +1,4 @@
+-- Index the company and the cluster of the users, which can be used to filter the user search. The username, full name
+-- and email are already indexed with pg_trgm, which supports both the prefix and the similarity matches of the search
+CREATE INDEX ix_users_company ON users (lower(company)) WHERE deleted_at IS NULL;
+CREATE INDEX ix_users_cluster ON users (cluster) WHERE deleted_at IS NULL;
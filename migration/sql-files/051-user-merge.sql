@@ -0,0 +1,2 @@
+-- Record the user into which a user was merged, the merged user being kept as a soft deleted tombstone
+ALTER TABLE users ADD COLUMN merged_into uuid;
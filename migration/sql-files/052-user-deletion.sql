@@ -0,0 +1,3 @@
+-- Record when the accounts whose deletion was requested by their users are deleted, unless the deletion is cancelled
+ALTER TABLE users ADD COLUMN deletion_scheduled_at timestamp with time zone;
+CREATE INDEX ix_users_deletion_scheduled_at ON users (deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
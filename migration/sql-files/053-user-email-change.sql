@@ -0,0 +1,5 @@
+-- Keep the new email address of the users aside until the change is confirmed from both the old and the new address
+ALTER TABLE users ADD COLUMN pending_email text;
+-- Record what the verification codes are used for, and the email address to which they were sent
+ALTER TABLE verification_codes ADD COLUMN kind text NOT NULL DEFAULT 'verify';
+ALTER TABLE verification_codes ADD COLUMN email text;
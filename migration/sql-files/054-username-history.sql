@@ -0,0 +1,14 @@
+-- Keep the usernames released by a username change, to resolve the previous usernames of the identities and to
+-- quarantine the released usernames
+CREATE TABLE username_history (
+  username_history_id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+  identity_id uuid NOT NULL REFERENCES identities (id) ON DELETE CASCADE,
+  username text NOT NULL,
+  released_at timestamp with time zone NOT NULL,
+  created_at timestamp with time zone,
+  updated_at timestamp with time zone,
+  deleted_at timestamp with time zone
+);
+
+CREATE INDEX idx_username_history_username ON username_history (username) WHERE deleted_at IS NULL;
+CREATE INDEX idx_username_history_identity_id ON username_history (identity_id);
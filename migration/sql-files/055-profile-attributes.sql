@@ -0,0 +1,20 @@
+-- Definitions of the custom profile attributes, managed by the administrators
+CREATE TABLE profile_attribute_definitions (
+  profile_attribute_definition_id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+  name text NOT NULL,
+  description text,
+  type text NOT NULL,
+  pattern text,
+  visibility text NOT NULL DEFAULT 'private',
+  editable_by_user boolean NOT NULL DEFAULT false,
+  created_at timestamp with time zone,
+  updated_at timestamp with time zone,
+  deleted_at timestamp with time zone
+);
+
+CREATE UNIQUE INDEX idx_profile_attribute_definitions_name ON profile_attribute_definitions (name) WHERE deleted_at IS NULL;
+
+-- The values of the custom profile attributes of the users, along with their visibility
+ALTER TABLE users ADD COLUMN profile_attributes jsonb;
+
+CREATE INDEX idx_users_profile_attributes ON users USING GIN (profile_attributes);
@@ -0,0 +1,16 @@
+-- Deny assignments, which withdraw a scope from an identity (and its members) for a resource (and its descendants),
+-- whatever the roles granting the scope
+CREATE TABLE deny_assignment (
+  deny_assignment_id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+  identity_id uuid NOT NULL,
+  resource_id varchar(256) NOT NULL,
+  scope_name text NOT NULL,
+  created_at timestamp with time zone,
+  updated_at timestamp with time zone,
+  deleted_at timestamp with time zone,
+  CONSTRAINT deny_assignment_identity_id_fkey FOREIGN KEY (identity_id) REFERENCES identities (id) ON DELETE CASCADE,
+  CONSTRAINT deny_assignment_resource_id_fkey FOREIGN KEY (resource_id) REFERENCES resource (resource_id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX uq_deny_assignment_identity_resource_scope ON deny_assignment (identity_id, resource_id, scope_name) WHERE deleted_at IS NULL;
+CREATE INDEX idx_deny_assignment_resource_id ON deny_assignment (resource_id);
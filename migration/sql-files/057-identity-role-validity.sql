@@ -0,0 +1,6 @@
+-- Optional validity window of the role assignments, outside of which the assigned role doesn't grant any scope
+ALTER TABLE identity_role ADD COLUMN valid_from timestamp with time zone;
+ALTER TABLE identity_role ADD COLUMN valid_until timestamp with time zone;
+ALTER TABLE identity_role ADD CONSTRAINT identity_role_validity_check CHECK (valid_from IS NULL OR valid_until IS NULL OR valid_from < valid_until);
+
+CREATE INDEX idx_identity_role_valid_until ON identity_role (valid_until) WHERE valid_until IS NOT NULL AND deleted_at IS NULL;
@@ -0,0 +1,6 @@
+-- The authorization code recorded for a device is sealed with a public key derived from the device code, instead of
+-- being stored in plain text. The pending device codes can't be sealed, hence they are dropped.
+DELETE FROM device_codes;
+ALTER TABLE device_codes DROP COLUMN code;
+ALTER TABLE device_codes ADD COLUMN public_key varchar NOT NULL;
+ALTER TABLE device_codes ADD COLUMN sealed_code varchar;
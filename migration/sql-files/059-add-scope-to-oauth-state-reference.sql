@@ -0,0 +1,2 @@
+-- Alter Oauth state reference table to add the requested scopes, an ID token is only issued if openid is requested
+ALTER TABLE oauth_state_references ADD COLUMN scope TEXT;
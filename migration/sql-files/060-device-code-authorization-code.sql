@@ -0,0 +1,6 @@
+-- The authorization code recorded for a device is kept with the device code, which is only looked up by its hash,
+-- instead of being sealed with a public key derived from the device code. The pending device codes are dropped.
+DELETE FROM device_codes;
+ALTER TABLE device_codes DROP COLUMN public_key;
+ALTER TABLE device_codes DROP COLUMN sealed_code;
+ALTER TABLE device_codes ADD COLUMN code varchar;
@@ -0,0 +1,3 @@
+-- Alter Oauth state reference table to add the time when the user authenticated with the authentication provider,
+-- which is returned in the ID token
+ALTER TABLE oauth_state_references ADD COLUMN auth_time timestamp with time zone;
@@ -2,6 +2,7 @@ package notification
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/satori/go.uuid"
 )
@@ -36,6 +37,92 @@ func NewUserEmailUpdated(identityID string, custom map[string]interface{}) Messa
 	}
 }
 
+// NewUserMerged creates a Message for the notification service in order to inform a user that another of their user
+// accounts was merged into the account with the given identity ID
+//
+// The following custom parameter values are required:
+//
+// mergedUsername - the username of the merged account
+// mergedEmail - the email address of the merged account
+func NewUserMerged(identityID string, mergedUsername string, mergedEmail string) Message {
+	return Message{
+		MessageID:   uuid.NewV4(),
+		MessageType: "user.merge",
+		TargetID:    identityID,
+		UserID:      &identityID,
+		Custom: map[string]interface{}{
+			"mergedUsername": mergedUsername,
+			"mergedEmail":    mergedEmail,
+		},
+	}
+}
+
+// NewUserDeletionScheduled creates a Message for the notification service in order to inform a user that the deletion
+// of their account was scheduled, and can be cancelled until then
+//
+// The following custom parameter values are required:
+//
+// deletionDate - the date after which the account is deleted, in RFC 3339 format
+func NewUserDeletionScheduled(identityID string, deletionDate time.Time) Message {
+	return Message{
+		MessageID:   uuid.NewV4(),
+		MessageType: "user.deletion.scheduled",
+		TargetID:    identityID,
+		UserID:      &identityID,
+		Custom: map[string]interface{}{
+			"deletionDate": deletionDate.UTC().Format(time.RFC3339),
+		},
+	}
+}
+
+// NewRoleAssignmentExpired creates a Message for the notification service in order to inform a user that a role
+// assigned to them for a limited time expired and was revoked
+//
+// The following custom parameter values are required:
+//
+// resourceID - the ID of the resource for which the role was assigned
+// resourceName - the name of the resource
+// roleName - the name of the role
+// expiredAt - the end of the validity of the assignment, in RFC 3339 format
+func NewRoleAssignmentExpired(identityID string, resourceID string, resourceName string, roleName string, expiredAt time.Time) Message {
+	return Message{
+		MessageID:   uuid.NewV4(),
+		MessageType: "role.assignment.expired",
+		TargetID:    identityID,
+		UserID:      &identityID,
+		Custom: map[string]interface{}{
+			"resourceID":   resourceID,
+			"resourceName": resourceName,
+			"roleName":     roleName,
+			"expiredAt":    expiredAt.UTC().Format(time.RFC3339),
+		},
+	}
+}
+
+// NewUserEmailChangeRequested creates a Message for the notification service in order to inform a user, at their
+// current email address, that a change of their email address was requested
+//
+// The following custom parameter values are required:
+//
+// email - the current email address of the user, to which the message is sent
+// newEmail - the requested email address
+// verifyURL - the URL to confirm the change from the current address
+// revertURL - the URL to cancel the change, or to restore the current address if the change already took effect
+func NewUserEmailChangeRequested(identityID string, email string, newEmail string, verifyURL string, revertURL string) Message {
+	return Message{
+		MessageID:   uuid.NewV4(),
+		MessageType: "user.email.change",
+		TargetID:    identityID,
+		UserID:      &identityID,
+		Custom: map[string]interface{}{
+			"email":     email,
+			"newEmail":  newEmail,
+			"verifyURL": verifyURL,
+			"revertURL": revertURL,
+		},
+	}
+}
+
 // NewTeamInvitationEmail creates a Message for the notification service in order to send an invitation e-mail to a user
 //
 // The following custom parameter values are required:
@@ -2,6 +2,7 @@ package notification_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/fabric8-services/fabric8-auth/notification"
 	testsuite "github.com/fabric8-services/fabric8-auth/test/suite"
@@ -30,3 +31,56 @@ func (s *TestNotificationSuite) TestNewUserEmailUpdatedOK() {
 	assert.Equal(s.T(), &userID, msg.UserID)
 	assert.Equal(s.T(), custom, msg.Custom)
 }
+
+func (s *TestNotificationSuite) TestNewUserMergedOK() {
+	identityID := uuid.NewV4().String()
+
+	msg := notification.NewUserMerged(identityID, "jdoe", "jdoe@example.com")
+	assert.Equal(s.T(), "user.merge", msg.MessageType)
+	assert.Equal(s.T(), identityID, msg.TargetID)
+	assert.Equal(s.T(), &identityID, msg.UserID)
+	assert.Equal(s.T(), map[string]interface{}{"mergedUsername": "jdoe", "mergedEmail": "jdoe@example.com"}, msg.Custom)
+}
+
+func (s *TestNotificationSuite) TestNewUserDeletionScheduledOK() {
+	identityID := uuid.NewV4().String()
+	deletionDate := time.Date(2018, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	msg := notification.NewUserDeletionScheduled(identityID, deletionDate)
+	assert.Equal(s.T(), "user.deletion.scheduled", msg.MessageType)
+	assert.Equal(s.T(), identityID, msg.TargetID)
+	assert.Equal(s.T(), &identityID, msg.UserID)
+	assert.Equal(s.T(), map[string]interface{}{"deletionDate": "2018-07-01T12:00:00Z"}, msg.Custom)
+}
+
+func (s *TestNotificationSuite) TestNewRoleAssignmentExpiredOK() {
+	identityID := uuid.NewV4().String()
+	resourceID := uuid.NewV4().String()
+	expiredAt := time.Date(2018, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	msg := notification.NewRoleAssignmentExpired(identityID, resourceID, "myspace", "admin", expiredAt)
+	assert.Equal(s.T(), "role.assignment.expired", msg.MessageType)
+	assert.Equal(s.T(), identityID, msg.TargetID)
+	assert.Equal(s.T(), &identityID, msg.UserID)
+	assert.Equal(s.T(), map[string]interface{}{
+		"resourceID":   resourceID,
+		"resourceName": "myspace",
+		"roleName":     "admin",
+		"expiredAt":    "2018-07-01T12:00:00Z",
+	}, msg.Custom)
+}
+
+func (s *TestNotificationSuite) TestNewUserEmailChangeRequestedOK() {
+	identityID := uuid.NewV4().String()
+
+	msg := notification.NewUserEmailChangeRequested(identityID, "old@example.com", "new@example.com", "https://auth/verify", "https://auth/revert")
+	assert.Equal(s.T(), "user.email.change", msg.MessageType)
+	assert.Equal(s.T(), identityID, msg.TargetID)
+	assert.Equal(s.T(), &identityID, msg.UserID)
+	assert.Equal(s.T(), map[string]interface{}{
+		"email":     "old@example.com",
+		"newEmail":  "new@example.com",
+		"verifyURL": "https://auth/verify",
+		"revertURL": "https://auth/revert",
+	}, msg.Custom)
+}
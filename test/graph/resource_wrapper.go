@@ -2,6 +2,7 @@ package graph
 
 import (
 	"context"
+	"time"
 
 	resource "github.com/fabric8-services/fabric8-auth/authorization/resource/repository"
 	resourcetype "github.com/fabric8-services/fabric8-auth/authorization/resourcetype/repository"
@@ -106,6 +107,25 @@ func (w *resourceWrapper) AddRole(wrapper interface{}, roleWrapper *roleWrapper)
 	return w
 }
 
+// AddRoleWithValidity assigns the given role to a user, team or organization for the resource, within the given
+// validity window. Any of its bounds can be nil.
+func (w *resourceWrapper) AddRoleWithValidity(wrapper interface{}, roleWrapper *roleWrapper, validFrom *time.Time, validUntil *time.Time) *resourceWrapper {
+	addRoleWithValidity(w.baseWrapper, w.resource, w.resource.ResourceType.Name, identityIDFromWrapper(w.graph.t, wrapper), roleWrapper.Role(), validFrom, validUntil)
+	return w
+}
+
+// AddDenial denies the given scope to a user, team or organization for the resource
+func (w *resourceWrapper) AddDenial(wrapper interface{}, scopeName string) *resourceWrapper {
+	denyAssignment := &role.DenyAssignment{
+		ResourceID: w.resource.ResourceID,
+		IdentityID: identityIDFromWrapper(w.graph.t, wrapper),
+		ScopeName:  scopeName,
+	}
+	err := w.graph.app.DenyAssignmentRepository().Create(w.graph.ctx, denyAssignment)
+	require.NoError(w.graph.t, err)
+	return w
+}
+
 func addRoleByName(w baseWrapper, resource *resource.Resource, resourceTypeName string, identityID uuid.UUID, roleName string) {
 	r, err := w.graph.app.RoleRepository().Lookup(w.graph.ctx, roleName, resourceTypeName)
 	require.NoError(w.graph.t, err)
@@ -133,6 +153,10 @@ func removeRoleByName(w baseWrapper, resource *resource.Resource, resourceTypeNa
 }
 
 func addRole(w baseWrapper, res *resource.Resource, resourceTypeName string, identityID uuid.UUID, r *role.Role) {
+	addRoleWithValidity(w, res, resourceTypeName, identityID, r, nil, nil)
+}
+
+func addRoleWithValidity(w baseWrapper, res *resource.Resource, resourceTypeName string, identityID uuid.UUID, r *role.Role, validFrom *time.Time, validUntil *time.Time) {
 	// check that the role applies to the given resource type
 	require.NotNil(w.graph.t, r)
 	r, err := w.graph.app.RoleRepository().Load(w.graph.ctx, r.RoleID)
@@ -143,6 +167,8 @@ func addRole(w baseWrapper, res *resource.Resource, resourceTypeName string, ide
 		ResourceID: res.ResourceID,
 		IdentityID: identityID,
 		RoleID:     r.RoleID,
+		ValidFrom:  validFrom,
+		ValidUntil: validUntil,
 	}
 	err = w.graph.app.IdentityRoleRepository().Create(w.graph.ctx, identityRole)
 	require.NoError(w.graph.t, err)